@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"runtime"
+	"sync"
 
 	"github.com/cryingmouse/data_management_engine/common"
 )
@@ -15,29 +16,103 @@ type Agent interface {
 	CreateDirectories(ctx context.Context, names []string) (dirPaths []string, err error)
 	DeleteDirectory(ctx context.Context, name string) (err error)
 	DeleteDirectories(ctx context.Context, names []string) (err error)
-	CreateCIFSShare(ctx context.Context, name, directoryName, description string, usernames []string) (err error)
+	// UpdateDirectory renames the directory, it fails if the new name is used already.
+	UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error)
+	CreateCIFSShare(ctx context.Context, name, directoryName, description string, access []common.ShareAccess) (err error)
 	DeleteCIFSShare(ctx context.Context, name string) (err error)
+	UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error)
+	GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error)
+	RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error)
 	GetCIFSShareDetail(ctx context.Context, name string) (detail common.ShareDetail, err error)
 	GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error)
 	MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error)
 	UnmountCIFSShare(ctx context.Context, mountPoint string) (err error)
 	CreateLocalUser(ctx context.Context, username, password string) (err error)
 	DeleteLocalUser(ctx context.Context, username string) (err error)
+	UpdateLocalUser(ctx context.Context, username string, update common.LocalUserUpdate) (err error)
 	GetLocalUserDetail(ctx context.Context, username string) (detail common.LocalUserDetail, err error)
 	GetLocalUsersDetail(ctx context.Context, usernames []string) (detail []common.LocalUserDetail, err error)
+	CreateLocalGroup(ctx context.Context, name, description string) (err error)
+	DeleteLocalGroup(ctx context.Context, name string) (err error)
+	AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error)
+	RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error)
+	GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error)
+	GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error)
+	CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error)
+	DeleteNFSExport(ctx context.Context, directoryName string) (err error)
+	GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error)
+	GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error)
+	SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error)
+	ClearDirectoryQuota(ctx context.Context, name string) (err error)
+	GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error)
+	GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error)
+	SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error)
+	// GetDirectoryUsage walks the directory tree, it is stopped once the context is done.
+	GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error)
+	CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error)
+	DeleteSnapshot(ctx context.Context, directoryName, name string) (err error)
+	ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error)
+	RestoreSnapshot(ctx context.Context, directoryName, name string) (err error)
+	// GetReplicationManifest lists the entries of the directory with the checksums of its files.
+	GetReplicationManifest(ctx context.Context, directoryName string) (manifest []common.ReplicationEntry, err error)
+	ReadReplicationChunk(ctx context.Context, directoryName, path string, offset, length int64) (chunk []byte, err error)
+	// PullReplication makes the directory the same as the directory of the source agent by the changes of the files.
+	PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error)
 	GetSystemInfo(ctx context.Context) (system common.SystemInfo, err error)
+	GetStatus(ctx context.Context) (status common.AgentStatus, err error)
 }
 
+// Version is the version of the agent reported in its heartbeats, it is set at build time by
+// -ldflags "-X github.com/cryingmouse/data_management_engine/agent.Version=<version>".
+var Version = "dev"
+
+// Factory constructs the agent of an operating system.
+type Factory func() Agent
+
+var (
+	registryMu sync.Mutex
+	factories  = make(map[string]Factory)
+	// The agent of the running operating system, it is constructed by the first call of GetAgent.
+	instance Agent
+)
+
+func init() {
+	Register("windows", func() Agent { return &WindowsAgent{Runner: &ExecCommandRunner{}} })
+	Register("linux", func() Agent { return &LinuxAgent{Runner: &ExecCommandRunner{}} })
+}
+
+// Register makes the agent available for the operating system named as runtime.GOOS.
+// Register panics if it is called twice for the same operating system or the factory is nil.
+func Register(goos string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("agent: Register factory is nil")
+	}
+
+	if _, exist := factories[goos]; exist {
+		panic("agent: Register called twice for " + goos)
+	}
+
+	factories[goos] = factory
+}
+
+// GetAgent returns the agent of the running operating system, or nil if there is no agent registered for it.
 func GetAgent() Agent {
-	agents := map[string]Agent{
-		"windows": &WindowsAgent{},
-		"linux":   &LinuxAgent{},
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if instance != nil {
+		return instance
 	}
 
-	agent, ok := agents[runtime.GOOS]
+	factory, ok := factories[runtime.GOOS]
 	if !ok {
 		return nil
 	}
 
-	return agent
+	instance = factory()
+
+	return instance
 }
@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() of a registered operating system does not panic")
+		}
+	}()
+
+	Register("linux", func() Agent { return &LinuxAgent{} })
+}
+
+func TestGetAgent(t *testing.T) {
+	agent := GetAgent()
+
+	switch runtime.GOOS {
+	case "linux":
+		if _, ok := agent.(*LinuxAgent); !ok {
+			t.Errorf("GetAgent() = %T, want *LinuxAgent", agent)
+		}
+	case "windows":
+		if _, ok := agent.(*WindowsAgent); !ok {
+			t.Errorf("GetAgent() = %T, want *WindowsAgent", agent)
+		}
+	}
+
+	if GetAgent() != agent {
+		t.Errorf("GetAgent() returns a new instance")
+	}
+}
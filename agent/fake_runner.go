@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// FakeCommand is a command recorded by FakeCommandRunner.
+type FakeCommand struct {
+	Name  string
+	Args  []string
+	Stdin string
+}
+
+// String returns the command line, e.g. "useradd --no-create-home alice".
+func (c FakeCommand) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+type fakeExpectation struct {
+	name   string
+	args   []string
+	result CommandResult
+}
+
+// FakeCommandRunner records the commands run by the agents and replays the canned results, it never runs a real command.
+type FakeCommandRunner struct {
+	mu           sync.Mutex
+	expectations []fakeExpectation
+	commands     []FakeCommand
+}
+
+func NewFakeCommandRunner() *FakeCommandRunner {
+	return &FakeCommandRunner{}
+}
+
+// Expect registers the result for the command whose name matches and whose arguments start with args.
+// The latest registered expectation wins if several of them match the same command.
+func (r *FakeCommandRunner) Expect(result CommandResult, name string, args ...string) *FakeCommandRunner {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.expectations = append(r.expectations, fakeExpectation{name: name, args: args, result: result})
+
+	return r
+}
+
+// ExpectStdout is a shortcut of Expect for the commands which succeed with the stdout.
+func (r *FakeCommandRunner) ExpectStdout(stdout string, name string, args ...string) *FakeCommandRunner {
+	return r.Expect(CommandResult{Stdout: []byte(stdout)}, name, args...)
+}
+
+// Commands returns the commands run so far in order.
+func (r *FakeCommandRunner) Commands() []FakeCommand {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]FakeCommand(nil), r.commands...)
+}
+
+// Reset forgets the recorded commands, the expectations are kept.
+func (r *FakeCommandRunner) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands = nil
+}
+
+func (r *FakeCommandRunner) Run(ctx context.Context, stdin string, name string, args ...string) (result CommandResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands = append(r.commands, FakeCommand{Name: name, Args: append([]string(nil), args...), Stdin: stdin})
+
+	expectation, ok := r.match(name, args)
+	if !ok {
+		return CommandResult{ExitCode: 127}, &CommandError{Name: name, ExitCode: 127, Stderr: fmt.Sprintf("unexpected command: %s", FakeCommand{Name: name, Args: args})}
+	}
+
+	if expectation.result.ExitCode != 0 {
+		return expectation.result, &CommandError{Name: name, ExitCode: expectation.result.ExitCode, Stderr: string(expectation.result.Stderr)}
+	}
+
+	return expectation.result, nil
+}
+
+// LookPath succeeds for the commands which have any expectation.
+func (r *FakeCommandRunner) LookPath(file string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, expectation := range r.expectations {
+		if expectation.name == file {
+			return "/usr/bin/" + file, nil
+		}
+	}
+
+	return "", fmt.Errorf("executable file not found in $PATH: %s", file)
+}
+
+func (r *FakeCommandRunner) match(name string, args []string) (fakeExpectation, bool) {
+	for i := len(r.expectations) - 1; i >= 0; i-- {
+		expectation := r.expectations[i]
+		if expectation.name != name || len(expectation.args) > len(args) {
+			continue
+		}
+
+		matched := true
+		for j, arg := range expectation.args {
+			if args[j] != arg {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return expectation, true
+		}
+	}
+
+	return fakeExpectation{}, false
+}
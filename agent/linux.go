@@ -1,18 +1,83 @@
 package agent
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/cryingmouse/data_management_engine/common"
 )
 
+// The files read by the Linux agent. They are variables so that the tests can point them to fixtures.
+var (
+	osReleaseFile = "/etc/os-release"
+	loadavgFile   = "/proc/loadavg"
+	uptimeFile    = "/proc/uptime"
+	passwdFile    = "/etc/passwd"
+	shadowFile    = "/etc/shadow"
+	groupFile     = "/etc/group"
+)
+
+// The layout of the time strings reported in DirectoryDetail.
+const linuxTimeLayout = "2006-01-02 15:04:05"
+
+// The first UID and GID assigned to the regular users and groups, the accounts below are system accounts.
+const linuxMinRegularUID = 1000
+
 type LinuxAgent struct {
+	// Runner runs the external commands, the commands are run on the local host if it is nil.
+	Runner CommandRunner
+}
+
+func (agent *LinuxAgent) runner() CommandRunner {
+	if agent.Runner == nil {
+		return &ExecCommandRunner{}
+	}
+
+	return agent.Runner
+}
+
+// validateLinuxName rejects the name which is not a single path element or contains the control characters, so that
+// the name of a directory cannot escape the root folder and no name can add lines to the configuration files.
+// The name with the prefix of the staging folders of the restores is rejected as well, so that no directory is
+// mistaken for a staging folder.
+func validateLinuxName(kind, name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') || containsControl(name) {
+		return fmt.Errorf("invalid name of the %s: %q", kind, name)
+	}
+
+	if strings.HasPrefix(name, restoreStagingPrefix) {
+		return fmt.Errorf("invalid name of the %s: %q, the prefix %s is reserved", kind, name, restoreStagingPrefix)
+	}
+
+	return nil
+}
+
+func containsControl(value string) bool {
+	return strings.IndexFunc(value, unicode.IsControl) >= 0
+}
+
+// getDirectoryPath returns the path of the directory under the root folder.
+func (agent *LinuxAgent) getDirectoryPath(name string) (string, error) {
+	if err := validateLinuxName("directory", name); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(common.Config.Agent.LinuxRootFolder, name), nil
 }
 
 func (agent *LinuxAgent) CreateDirectory(ctx context.Context, name string) (dirPath string, err error) {
-	dirPath = fmt.Sprintf("%s\\%s", "C:\\test", name)
+	if dirPath, err = agent.getDirectoryPath(name); err != nil {
+		return "", err
+	}
 
 	err = os.Mkdir(dirPath, os.ModePerm)
 	if err != nil {
@@ -23,22 +88,51 @@ func (agent *LinuxAgent) CreateDirectory(ctx context.Context, name string) (dirP
 }
 
 func (agent *LinuxAgent) CreateDirectories(ctx context.Context, names []string) (dirPaths []string, err error) {
-	for index, name := range names {
+	for _, name := range names {
 		dirPath, err := agent.CreateDirectory(ctx, name)
 		if err != nil {
 			return dirPaths, err
 		}
 
-		dirPaths[index] = dirPath
+		dirPaths = append(dirPaths, dirPath)
 	}
 
 	return dirPaths, err
 }
 
+// DeleteDirectory removes the empty directory together with its snapshots.
 func (agent *LinuxAgent) DeleteDirectory(ctx context.Context, name string) (err error) {
-	dirPath := fmt.Sprintf("%s\\%s", "C:\\test", name)
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return err
+	}
+
+	// The project of the quota is released with the directory, so that its ID is allocated again without the limits.
+	projectID, mountPoint, projectErr := agent.getQuotaProject(ctx, dirPath, false)
+
+	if err = os.Remove(dirPath); err != nil {
+		return err
+	}
+
+	if projectErr == nil {
+		if err = agent.releaseQuotaProject(ctx, projectID, mountPoint); err != nil {
+			return err
+		}
+	}
+
+	snapshots, err := agent.ListSnapshots(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		if err = agent.DeleteSnapshot(ctx, name, snapshot.Name); err != nil {
+			return err
+		}
+	}
 
-	return os.Remove(dirPath)
+	// The files received for the replication interrupted are useless without the directory.
+	return os.RemoveAll(filepath.Join(getLinuxReplicationFolder(), name))
 }
 
 func (agent *LinuxAgent) DeleteDirectories(ctx context.Context, names []string) (err error) {
@@ -46,60 +140,1477 @@ func (agent *LinuxAgent) DeleteDirectories(ctx context.Context, names []string)
 		if err = agent.DeleteDirectory(ctx, name); err != nil {
 			return err
 		}
-
 	}
 
 	return err
 }
 
-func (agent *LinuxAgent) GetDirectoryDetail(ctx context.Context, path string) (detail common.DirectoryDetail, err error) {
+// UpdateDirectory renames the directory, the shares and the exports of the old path are not changed. The directory
+// with any snapshot or the files of a replication transfer is not renamed, since they are kept in the folders named
+// by the directory.
+func (agent *LinuxAgent) UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error) {
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return err
+	}
+
+	newPath, err := agent.getDirectoryPath(update.NewName)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := listSnapshotMetadata(filepath.Join(getLinuxSnapshotFolder(), name))
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 {
+		return fmt.Errorf("the directory %s has %d snapshots, delete them before renaming it", name, len(snapshots))
+	}
+
+	if _, err = os.Stat(filepath.Join(getLinuxReplicationFolder(), name)); err == nil {
+		return fmt.Errorf("the directory %s has a replication transfer running or interrupted", name)
+	}
+
+	// rename(2) replaces the empty directory of the new path silently.
+	if _, err = os.Lstat(newPath); err == nil {
+		return fmt.Errorf("the directory %s already exists", update.NewName)
+	}
+
+	return os.Rename(dirPath, newPath)
+}
+
+func (agent *LinuxAgent) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return detail, err
+	}
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return detail, err
+	}
+
+	if !info.IsDir() {
+		return detail, fmt.Errorf("%s is not a directory", dirPath)
+	}
+
+	ctime, atime, mtime := getFileTimes(info)
+
+	detail = common.DirectoryDetail{
+		Name:           info.Name(),
+		FullPath:       dirPath,
+		CreationTime:   ctime.Format(linuxTimeLayout),
+		LastAccessTime: atime.Format(linuxTimeLayout),
+		LastWriteTime:  mtime.Format(linuxTimeLayout),
+		Exist:          true,
+		ParentFullPath: filepath.Dir(dirPath),
+	}
+
 	return detail, nil
 }
 
-func (agent *LinuxAgent) GetDirectoriesDetail(ctx context.Context, paths []string) (detail []common.DirectoryDetail, err error) {
+// GetDirectoriesDetail returns the details of the existing directories, the missing ones are skipped.
+// All the directories in the root folder are returned if no name is given.
+func (agent *LinuxAgent) GetDirectoriesDetail(ctx context.Context, names []string) (detail []common.DirectoryDetail, err error) {
+	if len(names) == 0 {
+		entries, err := os.ReadDir(common.Config.Agent.LinuxRootFolder)
+		if err != nil {
+			return detail, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), restoreStagingPrefix) {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+
+	for _, name := range names {
+		directory, err := agent.GetDirectoryDetail(ctx, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return detail, err
+		}
+
+		detail = append(detail, directory)
+	}
+
 	return detail, nil
 }
 
-func (agent *LinuxAgent) CreateCIFSShare(ctx context.Context, name, directoryName, description string, usernames []string) (err error) {
-	return err
+func (agent *LinuxAgent) CreateCIFSShare(ctx context.Context, name, directoryName, description string, access []common.ShareAccess) (err error) {
+	configFile := common.Config.Agent.SambaConfigFile
+
+	if err = validateSambaShare(name, description); err != nil {
+		return err
+	}
+
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	section := &sambaSection{Name: name}
+	section.Set("path", dirPath)
+	section.Set("comment", description)
+	section.Set("browseable", "yes")
+	section.Set("read only", "no")
+	section.Set("guest ok", "no")
+	section.setShareAccess(access)
+
+	if err = config.AddSection(section); err != nil {
+		return err
+	}
+
+	if err = config.Save(configFile); err != nil {
+		return err
+	}
+
+	return agent.reloadSambaConfig(ctx)
 }
 
 func (agent *LinuxAgent) DeleteCIFSShare(ctx context.Context, name string) (err error) {
-	return err
+	configFile := common.Config.Agent.SambaConfigFile
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	if err = config.RemoveSection(name); err != nil {
+		return err
+	}
+
+	if err = config.Save(configFile); err != nil {
+		return err
+	}
+
+	return agent.reloadSambaConfig(ctx)
+}
+
+func (agent *LinuxAgent) UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error) {
+	if update.Description != nil && containsControl(*update.Description) {
+		return fmt.Errorf("invalid description of the share: %q", *update.Description)
+	}
+
+	return agent.updateSambaSection(ctx, name, func(section *sambaSection) {
+		if update.Description != nil {
+			section.Set("comment", *update.Description)
+		}
+	})
+}
+
+// GrantCIFSShareAccess gives the access levels to the users, the level of the user given already is replaced.
+func (agent *LinuxAgent) GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error) {
+	return agent.updateCIFSShareAccess(ctx, name, func(current []common.ShareAccess) []common.ShareAccess {
+		return common.GrantShareAccess(current, access)
+	})
+}
+
+func (agent *LinuxAgent) RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error) {
+	return agent.updateCIFSShareAccess(ctx, name, func(current []common.ShareAccess) []common.ShareAccess {
+		return common.RevokeShareAccess(current, userNames, groupNames)
+	})
+}
+
+func (agent *LinuxAgent) updateCIFSShareAccess(ctx context.Context, name string, update func([]common.ShareAccess) []common.ShareAccess) (err error) {
+	return agent.updateSambaSection(ctx, name, func(section *sambaSection) {
+		section.setShareAccess(update(section.getShareAccess()))
+	})
+}
+
+// updateSambaSection changes the section of the share in smb.conf by the update, and reloads the configuration.
+func (agent *LinuxAgent) updateSambaSection(ctx context.Context, name string, update func(section *sambaSection)) (err error) {
+	configFile := common.Config.Agent.SambaConfigFile
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		return err
+	}
+
+	section := config.Section(name)
+	if section == nil || section.isReserved() {
+		return fmt.Errorf("the share %s does not exist", name)
+	}
+
+	update(section)
+
+	if err = config.Save(configFile); err != nil {
+		return err
+	}
+
+	return agent.reloadSambaConfig(ctx)
 }
 
 func (agent *LinuxAgent) GetCIFSShareDetail(ctx context.Context, name string) (detail common.ShareDetail, err error) {
-	return detail, err
+	config, err := loadSambaConfig(common.Config.Agent.SambaConfigFile)
+	if err != nil {
+		return detail, err
+	}
+
+	section := config.Section(name)
+	if section == nil || section.isReserved() {
+		return detail, fmt.Errorf("the share %s does not exist", name)
+	}
+
+	return sambaSectionToShareDetail(section), nil
 }
 
+// GetCIFSSharesDetail returns the details of the shares with the names, or all the shares if no name is given.
 func (agent *LinuxAgent) GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error) {
-	return detail, err
+	config, err := loadSambaConfig(common.Config.Agent.SambaConfigFile)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, section := range config.Shares() {
+		if len(names) > 0 && !containsFold(names, section.Name) {
+			continue
+		}
+
+		detail = append(detail, sambaSectionToShareDetail(section))
+	}
+
+	return detail, nil
+}
+
+func sambaSectionToShareDetail(section *sambaSection) common.ShareDetail {
+	state := "online"
+	if strings.EqualFold(section.Get("available"), "no") {
+		state = "offline"
+	}
+
+	return common.ShareDetail{
+		Name:          section.Name,
+		DirectoryPath: section.Get("path"),
+		Description:   section.Get("comment"),
+		State:         state,
+	}
+}
+
+func getLinuxMountFolder() string {
+	if folder := common.Config.Agent.LinuxMountFolder; folder != "" {
+		return folder
+	}
+
+	return "/mnt"
+}
+
+// getMountPointPath returns the cleaned path of the mount point, which must be a folder under the mount folder,
+// so that no share is mounted over the system folders.
+func getMountPointPath(mountPoint string) (string, error) {
+	if !filepath.IsAbs(mountPoint) || containsControl(mountPoint) {
+		return "", fmt.Errorf("invalid mount point: %q", mountPoint)
+	}
+
+	mountPath := filepath.Clean(mountPoint)
+	relPath, err := filepath.Rel(filepath.Clean(getLinuxMountFolder()), mountPath)
+	if err != nil || relPath == "." || relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", fmt.Errorf("the mount point %s is not under the mount folder %s", mountPoint, getLinuxMountFolder())
+	}
+
+	return mountPath, nil
+}
+
+// validateCIFSCredentials rejects the credentials with the control characters, since mount.cifs reads the credentials
+// file line by line, e.g. the password "x\ndomain=..." would add a line.
+func validateCIFSCredentials(userName, password string) error {
+	if userName == "" || containsControl(userName) {
+		return fmt.Errorf("invalid name of the user: %q", userName)
+	}
+
+	if containsControl(password) {
+		return errors.New("the password of the user must not contain the control characters")
+	}
+
+	return nil
 }
 
 func (agent *LinuxAgent) MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error) {
+	if err = validateCIFSCredentials(userName, password); err != nil {
+		return err
+	}
+
+	if mountPoint, err = getMountPointPath(mountPoint); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(mountPoint, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Keep the password out of the process list by passing it through a credentials file.
+	credentialsFile, err := os.CreateTemp("", "cifs-credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(credentialsFile.Name())
+
+	_, err = fmt.Fprintf(credentialsFile, "username=%s\npassword=%s\n", userName, password)
+	if closeErr := credentialsFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// The engine builds the share path in UNC format, e.g. \\192.168.0.1\share.
+	source := strings.ReplaceAll(sharePath, "\\", "/")
+
+	_, err = agent.runCommand(ctx, "", "mount", "-t", "cifs", source, mountPoint, "-o", "credentials="+credentialsFile.Name())
+
 	return err
 }
 
 func (agent *LinuxAgent) UnmountCIFSShare(ctx context.Context, mountPoint string) (err error) {
+	if mountPoint, err = getMountPointPath(mountPoint); err != nil {
+		return err
+	}
+
+	_, err = agent.runCommand(ctx, "", "umount", mountPoint)
+
 	return err
 }
 
-func (agent *LinuxAgent) CreateLocalUser(ctx context.Context, username, password string) (err error) {
-	return err
+func (agent *LinuxAgent) CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error) {
+	exportsFile := common.Config.Agent.NFSExportsFile
+
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return err
+	}
+
+	export, err := newNFSExport(dirPath, clients)
+	if err != nil {
+		return err
+	}
+
+	exports, err := loadNFSExportsFile(exportsFile)
+	if err != nil {
+		return err
+	}
+
+	if err = exports.AddExport(export); err != nil {
+		return err
+	}
+
+	if err = exports.Save(exportsFile); err != nil {
+		return err
+	}
+
+	return agent.reloadNFSExports(ctx)
 }
 
-func (agent *LinuxAgent) DeleteLocalUser(ctx context.Context, username string) (err error) {
-	return err
+func (agent *LinuxAgent) DeleteNFSExport(ctx context.Context, directoryName string) (err error) {
+	exportsFile := common.Config.Agent.NFSExportsFile
+
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return err
+	}
+
+	exports, err := loadNFSExportsFile(exportsFile)
+	if err != nil {
+		return err
+	}
+
+	if err = exports.RemoveExport(dirPath); err != nil {
+		return err
+	}
+
+	if err = exports.Save(exportsFile); err != nil {
+		return err
+	}
+
+	return agent.reloadNFSExports(ctx)
 }
 
-func (agent *LinuxAgent) GetLocalUserDetail(ctx context.Context, username string) (detail common.LocalUserDetail, err error) {
-	return detail, nil
+func (agent *LinuxAgent) GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error) {
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return detail, err
+	}
+
+	exports, err := loadNFSExportsFile(common.Config.Agent.NFSExportsFile)
+	if err != nil {
+		return detail, err
+	}
+
+	export := exports.Export(dirPath)
+	if export == nil {
+		return detail, fmt.Errorf("the directory %s is not exported", directoryName)
+	}
+
+	return agent.nfsExportToDetail(export), nil
 }
 
-func (agent *LinuxAgent) GetLocalUsersDetail(ctx context.Context, usernames []string) (detail []common.LocalUserDetail, err error) {
+// GetNFSExportsDetail returns the exports of the directories with the names, or all the exports if no name is given.
+func (agent *LinuxAgent) GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error) {
+	exports, err := loadNFSExportsFile(common.Config.Agent.NFSExportsFile)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, export := range exports.Exports() {
+		exportDetail := agent.nfsExportToDetail(export)
+		if len(directoryNames) > 0 && !containsString(directoryNames, exportDetail.Name) {
+			continue
+		}
+
+		detail = append(detail, exportDetail)
+	}
+
 	return detail, nil
 }
 
-func (agent *LinuxAgent) GetSystemInfo(ctx context.Context) (system common.SystemInfo, err error) {
-	return system, nil
+// nfsExportToDetail names the export by the directory name under the root folder, or by the full path for the others.
+func (agent *LinuxAgent) nfsExportToDetail(export *nfsExport) common.NFSExportDetail {
+	name, err := filepath.Rel(common.Config.Agent.LinuxRootFolder, export.Path)
+	if err != nil || name == "." || strings.HasPrefix(name, "..") {
+		name = export.Path
+	}
+
+	return common.NFSExportDetail{
+		Name:          name,
+		DirectoryPath: export.Path,
+		Clients:       export.ToNFSClients(),
+	}
+}
+
+// validateLocalUserPassword rejects the user name with ":" or the control characters and the password with the control
+// characters, since chpasswd reads the line "name:password" and smbpasswd reads the password line by line.
+func validateLocalUserPassword(username, password string) error {
+	if username == "" || strings.ContainsRune(username, ':') || containsControl(username) {
+		return fmt.Errorf("invalid name of the local user: %q", username)
+	}
+
+	if containsControl(password) {
+		return errors.New("the password of the local user must not contain the control characters")
+	}
+
+	return nil
+}
+
+// CreateLocalUser creates a user without home directory and login shell, and enables it for samba if samba is installed.
+func (agent *LinuxAgent) CreateLocalUser(ctx context.Context, username, password string) (err error) {
+	if err = validateLocalUserPassword(username, password); err != nil {
+		return err
+	}
+
+	if _, err = agent.runCommand(ctx, "", "useradd", "--no-create-home", "--shell", "/usr/sbin/nologin", username); err != nil {
+		return err
+	}
+
+	if _, err = agent.runCommand(ctx, fmt.Sprintf("%s:%s\n", username, password), "chpasswd"); err != nil {
+		return err
+	}
+
+	if _, lookErr := agent.runner().LookPath("smbpasswd"); lookErr == nil {
+		_, err = agent.runCommand(ctx, fmt.Sprintf("%s\n%s\n", password, password), "smbpasswd", "-a", "-s", username)
+	}
+
+	return err
+}
+
+func (agent *LinuxAgent) DeleteLocalUser(ctx context.Context, username string) (err error) {
+	if _, lookErr := agent.runner().LookPath("smbpasswd"); lookErr == nil {
+		// The user may have never been added to samba, so the failure is ignored.
+		agent.runCommand(ctx, "", "smbpasswd", "-x", username)
+	}
+
+	_, err = agent.runCommand(ctx, "", "userdel", username)
+
+	return err
+}
+
+// UpdateLocalUser changes the password of the user in the system and samba, unlocks the password and enables or disables the account.
+// The account is disabled by expiring it, so the password is kept.
+func (agent *LinuxAgent) UpdateLocalUser(ctx context.Context, username string, update common.LocalUserUpdate) (err error) {
+	_, lookErr := agent.runner().LookPath("smbpasswd")
+	withSamba := lookErr == nil
+
+	if update.Password != "" {
+		if err = validateLocalUserPassword(username, update.Password); err != nil {
+			return err
+		}
+
+		if _, err = agent.runCommand(ctx, fmt.Sprintf("%s:%s\n", username, update.Password), "chpasswd"); err != nil {
+			return err
+		}
+
+		if withSamba {
+			if _, err = agent.runCommand(ctx, fmt.Sprintf("%s\n%s\n", update.Password, update.Password), "smbpasswd", "-a", "-s", username); err != nil {
+				return err
+			}
+		}
+	}
+
+	if update.Unlock {
+		if _, err = agent.runCommand(ctx, "", "usermod", "--unlock", username); err != nil {
+			return err
+		}
+
+		// The failed logons are counted by pam_faillock if it is installed.
+		if _, lookErr := agent.runner().LookPath("faillock"); lookErr == nil {
+			if _, err = agent.runCommand(ctx, "", "faillock", "--user", username, "--reset"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if update.Disabled != nil {
+		expireDate, smbFlag := "", "-e"
+		if *update.Disabled {
+			// The day 1 of the epoch has passed, so the account is expired.
+			expireDate, smbFlag = "1", "-d"
+		}
+
+		if _, err = agent.runCommand(ctx, "", "usermod", "--expiredate", expireDate, username); err != nil {
+			return err
+		}
+
+		if withSamba {
+			if _, err = agent.runCommand(ctx, "", "smbpasswd", smbFlag, username); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (agent *LinuxAgent) GetLocalUserDetail(ctx context.Context, username string) (detail common.LocalUserDetail, err error) {
+	users, err := readLinuxUsers()
+	if err != nil {
+		return detail, err
+	}
+
+	for _, user := range users {
+		if user.Name == username {
+			return user, nil
+		}
+	}
+
+	return detail, fmt.Errorf("the local user %s does not exist", username)
+}
+
+// GetLocalUsersDetail returns the details of the users with the names, or all the regular users if no name is given.
+func (agent *LinuxAgent) GetLocalUsersDetail(ctx context.Context, usernames []string) (detail []common.LocalUserDetail, err error) {
+	users, err := readLinuxUsers()
+	if err != nil {
+		return detail, err
+	}
+
+	for _, user := range users {
+		if len(usernames) > 0 {
+			if !containsString(usernames, user.Name) {
+				continue
+			}
+		} else if uid, _ := strconv.Atoi(user.UID); uid < linuxMinRegularUID || user.Name == "nobody" {
+			continue
+		}
+
+		detail = append(detail, user)
+	}
+
+	return detail, nil
+}
+
+// CreateLocalGroup creates the group, the description is ignored since the Linux groups have none.
+// validateLinuxAccountName rejects the name of a group or a user which cannot be kept in /etc/group, whose fields are
+// separated by ":" and whose members are separated by ",", or which would be parsed as an option of the commands.
+func validateLinuxAccountName(kind, name string) error {
+	if err := validateLinuxName(kind, name); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(name, ":,") || strings.HasPrefix(name, "-") {
+		return fmt.Errorf("invalid name of the %s: %q", kind, name)
+	}
+
+	return nil
+}
+
+// validateLinuxGroupMembers checks the name of the group and the names of its members.
+func validateLinuxGroupMembers(name string, members []string) error {
+	if err := validateLinuxAccountName("local group", name); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if err := validateLinuxAccountName("member", member); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (agent *LinuxAgent) CreateLocalGroup(ctx context.Context, name, description string) (err error) {
+	if err = validateLinuxAccountName("local group", name); err != nil {
+		return err
+	}
+
+	_, err = agent.runCommand(ctx, "", "groupadd", "--", name)
+
+	return err
+}
+
+func (agent *LinuxAgent) DeleteLocalGroup(ctx context.Context, name string) (err error) {
+	if err = validateLinuxAccountName("local group", name); err != nil {
+		return err
+	}
+
+	_, err = agent.runCommand(ctx, "", "groupdel", "--", name)
+
+	return err
+}
+
+// AddLocalGroupMembers adds the users to the supplementary members of the group.
+func (agent *LinuxAgent) AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	if err = validateLinuxGroupMembers(name, members); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if _, err = agent.runCommand(ctx, "", "gpasswd", "--add", member, "--", name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (agent *LinuxAgent) RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	if err = validateLinuxGroupMembers(name, members); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if _, err = agent.runCommand(ctx, "", "gpasswd", "--delete", member, "--", name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (agent *LinuxAgent) GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error) {
+	groups, err := agent.GetLocalGroupsDetail(ctx, []string{name})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(groups) == 0 {
+		return detail, fmt.Errorf("the local group %s does not exist", name)
+	}
+
+	return groups[0], nil
+}
+
+// GetLocalGroupsDetail returns the details of the groups with the names, or all the regular groups if no name is given.
+// The members are the supplementary ones, the users whose primary group is the group are not listed.
+func (agent *LinuxAgent) GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error) {
+	groups, err := readLinuxGroups()
+	if err != nil {
+		return detail, err
+	}
+
+	for _, group := range groups {
+		if len(names) > 0 {
+			if !containsString(names, group.Name) {
+				continue
+			}
+		} else if gid, _ := strconv.Atoi(group.GID); gid < linuxMinRegularUID || group.Name == "nogroup" {
+			continue
+		}
+
+		detail = append(detail, group)
+	}
+
+	return detail, nil
+}
+
+func (agent *LinuxAgent) GetSystemInfo(ctx context.Context) (system common.SystemInfo, err error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return system, err
+	}
+
+	osRelease, err := readOSRelease(osReleaseFile)
+	if err != nil {
+		return system, err
+	}
+
+	machine, release, err := getKernelInfo()
+	if err != nil {
+		return system, err
+	}
+
+	caption := osRelease["PRETTY_NAME"]
+	if caption == "" {
+		caption = strings.TrimSpace(osRelease["NAME"] + " " + osRelease["VERSION"])
+	}
+
+	system = common.SystemInfo{
+		ComputerName:   hostname,
+		Caption:        caption,
+		OSArchitecture: machine,
+		OSVersion:      osRelease["VERSION_ID"],
+		BuildNumber:    release,
+	}
+
+	return system, nil
+}
+
+// readOSRelease parses the KEY=value pairs in os-release, the values may be quoted.
+func readOSRelease(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"'`)
+		}
+
+		result[key] = value
+	}
+
+	return result, nil
+}
+
+func (agent *LinuxAgent) GetStatus(ctx context.Context) (status common.AgentStatus, err error) {
+	load, err := readFirstFloat(loadavgFile)
+	if err != nil {
+		return status, err
+	}
+
+	uptime, err := readFirstFloat(uptimeFile)
+	if err != nil {
+		return status, err
+	}
+
+	status = common.AgentStatus{
+		AgentVersion: Version,
+		Load:         load,
+		Uptime:       int64(uptime),
+	}
+
+	return status, nil
+}
+
+// readFirstFloat parses the first field of the file, e.g. the load average of the last minute in /proc/loadavg,
+// or the seconds since the boot in /proc/uptime.
+func readFirstFloat(path string) (float64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid content of %s", path)
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+type shadowEntry struct {
+	password   string
+	lastChange int
+	minAge     int
+	maxAge     int
+	expire     int
+}
+
+// readLinuxUsers reads the accounts in passwd, and the password status in shadow if it is readable.
+func readLinuxUsers() (users []common.LocalUserDetail, err error) {
+	content, err := os.ReadFile(passwdFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only root can read shadow, the password status is left as default otherwise.
+	shadow := map[string]shadowEntry{}
+	if shadowContent, err := os.ReadFile(shadowFile); err == nil {
+		shadow = parseShadow(shadowContent)
+	}
+
+	today := int(time.Now().Unix() / (24 * 60 * 60))
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// name:password:UID:GID:GECOS:directory:shell
+		fields := strings.Split(line, ":")
+		if len(fields) < 7 {
+			continue
+		}
+
+		user := common.LocalUserDetail{
+			Name:                 fields[0],
+			UID:                  fields[2],
+			FullName:             strings.Split(fields[4], ",")[0],
+			Description:          fields[4],
+			Status:               "OK",
+			IsPasswordRequired:   true,
+			IsPasswordChangeable: true,
+		}
+
+		if entry, ok := shadow[user.Name]; ok {
+			user.IsPasswordRequired = entry.password != ""
+			user.IsLockout = strings.HasPrefix(entry.password, "!")
+			user.IsDisabled = entry.expire > 0 && entry.expire <= today
+			user.IsPasswordChangeable = entry.minAge <= 0 || today-entry.lastChange >= entry.minAge
+			user.IsPasswordExpired = entry.lastChange == 0 || (entry.maxAge > 0 && entry.lastChange+entry.maxAge < today)
+
+			if user.IsLockout || user.IsDisabled {
+				user.Status = "Degraded"
+			}
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+func readLinuxGroups() (groups []common.LocalGroupDetail, err error) {
+	content, err := os.ReadFile(groupFile)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// name:password:GID:members
+		fields := strings.Split(line, ":")
+		if len(fields) < 4 {
+			continue
+		}
+
+		groups = append(groups, common.LocalGroupDetail{
+			Name:    fields[0],
+			GID:     fields[2],
+			Members: common.SplitToList(fields[3]),
+		})
+	}
+
+	return groups, nil
+}
+
+func parseShadow(content []byte) map[string]shadowEntry {
+	entries := make(map[string]shadowEntry)
+
+	// Convert the empty fields to -1, which means the policy is disabled.
+	toInt := func(s string) int {
+		if s == "" {
+			return -1
+		}
+		value, err := strconv.Atoi(s)
+		if err != nil {
+			return -1
+		}
+		return value
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// name:password:lastchg:min:max:warn:inactive:expire:reserved
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) < 8 {
+			continue
+		}
+
+		entries[fields[0]] = shadowEntry{
+			password:   fields[1],
+			lastChange: toInt(fields[2]),
+			minAge:     toInt(fields[3]),
+			maxAge:     toInt(fields[4]),
+			expire:     toInt(fields[7]),
+		}
+	}
+
+	return entries
+}
+
+// reloadSambaConfig asks the running smbd to reload smb.conf.
+func (agent *LinuxAgent) reloadSambaConfig(ctx context.Context) error {
+	_, err := agent.runCommand(ctx, "", "smbcontrol", "smbd", "reload-config")
+
+	return err
+}
+
+// reloadNFSExports re-exports all the directories in exports and unexports the removed ones.
+func (agent *LinuxAgent) reloadNFSExports(ctx context.Context) error {
+	_, err := agent.runCommand(ctx, "", "exportfs", "-ra")
+
+	return err
+}
+
+func (agent *LinuxAgent) GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error) {
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return usage, err
+	}
+
+	return walkDirectoryUsage(ctx, dirPath, time.Now())
+}
+
+func (agent *LinuxAgent) GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error) {
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return acl, err
+	}
+
+	output, err := agent.runCommand(ctx, "", "getfacl", "--absolute-names", dirPath)
+	if err != nil {
+		return acl, err
+	}
+
+	return parsePOSIXACL(output)
+}
+
+// SetDirectoryACL replaces the POSIX ACL of the directory, and changes its owner and owning group if they are given.
+// The inheritable entries are set as the default ACL, which applies to the children created since then.
+func (agent *LinuxAgent) SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error) {
+	if err = acl.Validate(); err != nil {
+		return err
+	}
+
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return err
+	}
+
+	current, err := agent.GetDirectoryACL(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if acl.Owner == "" {
+		acl.Owner = current.Owner
+	}
+	if acl.Group == "" {
+		acl.Group = current.Group
+	}
+
+	spec, err := formatPOSIXACL(acl)
+	if err != nil {
+		return err
+	}
+
+	if acl.Owner != current.Owner || acl.Group != current.Group {
+		if _, err = agent.runCommand(ctx, "", "chown", acl.Owner+":"+acl.Group, dirPath); err != nil {
+			return err
+		}
+	}
+
+	_, err = agent.runCommand(ctx, "", "setfacl", "--set", spec, dirPath)
+
+	return err
+}
+
+// SetDirectoryQuota limits the directory by the project quota of its file system, which has to be mounted with prjquota.
+// The files created in the directory inherit its project ID, so they are charged to the quota.
+func (agent *LinuxAgent) SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error) {
+	if err = quota.Validate(); err != nil {
+		return err
+	}
+
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return err
+	}
+
+	projectID, mountPoint, err := agent.getQuotaProject(ctx, dirPath, true)
+	if err != nil {
+		return err
+	}
+
+	if _, err = agent.runCommand(ctx, "", "chattr", "-R", "+P", "-p", formatProjectID(projectID), dirPath); err != nil {
+		return err
+	}
+
+	_, err = agent.runCommand(ctx, "", "setquota", "-P", formatProjectID(projectID),
+		toQuotaBlocks(quota.SoftLimitBytes), toQuotaBlocks(quota.HardLimitBytes),
+		strconv.FormatInt(quota.SoftLimitFiles, 10), strconv.FormatInt(quota.HardLimitFiles, 10), mountPoint)
+
+	return err
+}
+
+// ClearDirectoryQuota removes the limits of the directory, its project ID is kept so that the usage is still accounted.
+func (agent *LinuxAgent) ClearDirectoryQuota(ctx context.Context, name string) (err error) {
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return err
+	}
+
+	projectID, mountPoint, err := agent.getQuotaProject(ctx, dirPath, false)
+	if errors.Is(err, errNoQuotaProject) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = agent.runCommand(ctx, "", "setquota", "-P", formatProjectID(projectID), "0", "0", "0", "0", mountPoint)
+
+	return err
+}
+
+func (agent *LinuxAgent) GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error) {
+	dirPath, err := agent.getDirectoryPath(name)
+	if err != nil {
+		return quota, err
+	}
+
+	// The directory without the project has never been limited.
+	projectID, mountPoint, err := agent.getQuotaProject(ctx, dirPath, false)
+	if errors.Is(err, errNoQuotaProject) {
+		return quota, nil
+	} else if err != nil {
+		return quota, err
+	}
+
+	output, err := agent.runCommand(ctx, "", "quota", "-P", "-v", "-w", "-p", "--show-mntpoint", "--hide-device", formatProjectID(projectID))
+	if err != nil {
+		return quota, err
+	}
+
+	return parseProjectQuota(output, mountPoint)
+}
+
+var errNoQuotaProject = errors.New("the directory has no project of the quota")
+
+// getQuotaProject returns the project ID of the directory and the mount point of its file system. The directory keeps
+// the project allocated by the agent once it is limited. If it has none, a new project is allocated if allocate is true,
+// or errNoQuotaProject is returned otherwise.
+func (agent *LinuxAgent) getQuotaProject(ctx context.Context, dirPath string, allocate bool) (projectID uint32, mountPoint string, err error) {
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return 0, "", err
+	}
+
+	device, _, ok := getFileIDs(info)
+	if !ok {
+		return 0, "", fmt.Errorf("project quota is not supported on %s", dirPath)
+	}
+
+	// The mount point is the topmost ancestor on the same device.
+	mountPoint = dirPath
+	for {
+		parent := filepath.Dir(mountPoint)
+		if parent == mountPoint {
+			break
+		}
+
+		parentInfo, err := os.Stat(parent)
+		if err != nil {
+			return 0, "", err
+		}
+
+		if parentDevice, _, _ := getFileIDs(parentInfo); parentDevice != device {
+			break
+		}
+
+		mountPoint = parent
+	}
+
+	projectID, err = agent.getProjectID(ctx, dirPath)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The project set by the administrator or the other tools is not taken over.
+	_, projects, err := readProjid(getProjidFile())
+	if err != nil {
+		return 0, "", err
+	}
+	if isAgentQuotaProject(projects, projectID) {
+		return projectID, mountPoint, nil
+	}
+
+	if !allocate {
+		return 0, "", errNoQuotaProject
+	}
+
+	projectID, err = allocateQuotaProject()
+
+	return projectID, mountPoint, err
+}
+
+// releaseQuotaProject removes the limits of the project and unregisters it.
+func (agent *LinuxAgent) releaseQuotaProject(ctx context.Context, projectID uint32, mountPoint string) error {
+	if _, err := agent.runCommand(ctx, "", "setquota", "-P", formatProjectID(projectID), "0", "0", "0", "0", mountPoint); err != nil {
+		return fmt.Errorf("failed to remove the limits of the project %d: %w", projectID, err)
+	}
+
+	return unregisterQuotaProject(projectID)
+}
+
+func formatProjectID(projectID uint32) string {
+	return strconv.FormatUint(uint64(projectID), 10)
+}
+
+// toQuotaBlocks converts the bytes to the 1 KiB blocks used by setquota, rounding up so the limit is not lowered.
+func toQuotaBlocks(bytes int64) string {
+	return strconv.FormatInt((bytes+1023)/1024, 10)
+}
+
+// parseProjectQuota parses the line of the mount point in the output of "quota -w -p --show-mntpoint --hide-device",
+// whose fields are the blocks, the soft and hard limits of blocks, the grace time, and the same of the files.
+// The usage is suffixed by "*" if it exceeds the soft limit.
+func parseProjectQuota(output []byte, mountPoint string) (quota common.DirectoryQuota, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 9 || fields[0] != mountPoint {
+			continue
+		}
+
+		values := make([]int64, 0, 6)
+		for _, index := range []int{1, 2, 3, 5, 6, 7} {
+			value, err := strconv.ParseInt(strings.TrimSuffix(fields[index], "*"), 10, 64)
+			if err != nil {
+				return quota, fmt.Errorf("invalid quota of %s: %w", mountPoint, err)
+			}
+
+			values = append(values, value)
+		}
+
+		quota = common.DirectoryQuota{
+			UsedBytes:      values[0] * 1024,
+			SoftLimitBytes: values[1] * 1024,
+			HardLimitBytes: values[2] * 1024,
+			UsedFiles:      values[3],
+			SoftLimitFiles: values[4],
+			HardLimitFiles: values[5],
+		}
+
+		return quota, nil
+	}
+
+	return quota, fmt.Errorf("no project quota is reported on %s", mountPoint)
+}
+
+// CreateSnapshot takes the snapshot of the directory by btrfs if the directory is a subvolume, or copies the directory
+// by reflink if its file system supports, or copies it plainly otherwise.
+func (agent *LinuxAgent) CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error) {
+	if err = common.ValidateSnapshotName(name); err != nil {
+		return detail, err
+	}
+
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return detail, err
+	}
+
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		return detail, err
+	}
+
+	if !info.IsDir() {
+		return detail, fmt.Errorf("%s is not a directory", dirPath)
+	}
+
+	// The incomplete snapshot left without its metadata is not replaced either, cp would copy the directory into it.
+	snapshotPath, metadataPath, err := getSnapshotPath(directoryName, name)
+	if err != nil {
+		return detail, err
+	}
+	for _, path := range []string{snapshotPath, metadataPath} {
+		if _, err = os.Lstat(path); err == nil {
+			return detail, fmt.Errorf("the snapshot %s of the directory %s already exists", name, directoryName)
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(snapshotPath), 0700); err != nil {
+		return detail, err
+	}
+
+	detail = common.SnapshotDetail{Name: name, DirectoryName: directoryName, CreationTime: time.Now()}
+
+	if detail.Method, err = agent.copySnapshot(ctx, dirPath, snapshotPath); err != nil {
+		return detail, err
+	}
+
+	if err = writeSnapshotMetadata(metadataPath, detail); err != nil {
+		agent.removeSnapshot(ctx, snapshotPath, detail.Method)
+		return detail, err
+	}
+
+	return detail, nil
+}
+
+// copySnapshot copies the directory to the snapshot by the first method which works, and returns the method.
+func (agent *LinuxAgent) copySnapshot(ctx context.Context, dirPath, snapshotPath string) (method string, err error) {
+	if agent.isBtrfsSubvolume(ctx, dirPath) {
+		// The read-only snapshot shares all the blocks of the subvolume until the files are changed.
+		if _, err = agent.runCommand(ctx, "", "btrfs", "subvolume", "snapshot", "-r", dirPath, snapshotPath); err != nil {
+			return "", err
+		}
+
+		return common.SnapshotMethodBtrfs, nil
+	}
+
+	if _, err = agent.runCommand(ctx, "", "cp", "-a", "--reflink=always", dirPath, snapshotPath); err == nil {
+		return common.SnapshotMethodReflink, nil
+	}
+
+	// The file system does not support reflink, the partial copy is removed before copying plainly.
+	if err = os.RemoveAll(snapshotPath); err != nil {
+		return "", err
+	}
+
+	if _, err = agent.runCommand(ctx, "", "cp", "-a", dirPath, snapshotPath); err != nil {
+		os.RemoveAll(snapshotPath)
+		return "", err
+	}
+
+	return common.SnapshotMethodCopy, nil
+}
+
+// isBtrfsSubvolume reports whether the directory is the root of a btrfs subvolume, whose inode number is always 256.
+func (agent *LinuxAgent) isBtrfsSubvolume(ctx context.Context, dirPath string) bool {
+	fsType, err := agent.runCommand(ctx, "", "stat", "--file-system", "--format=%T", dirPath)
+	if err != nil || strings.TrimSpace(string(fsType)) != "btrfs" {
+		return false
+	}
+
+	inode, err := agent.runCommand(ctx, "", "stat", "--format=%i", dirPath)
+
+	return err == nil && strings.TrimSpace(string(inode)) == "256"
+}
+
+func (agent *LinuxAgent) removeSnapshot(ctx context.Context, snapshotPath, method string) (err error) {
+	if method == common.SnapshotMethodBtrfs {
+		_, err = agent.runCommand(ctx, "", "btrfs", "subvolume", "delete", snapshotPath)
+		return err
+	}
+
+	return os.RemoveAll(snapshotPath)
+}
+
+func (agent *LinuxAgent) DeleteSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	if err = common.ValidateSnapshotName(name); err != nil {
+		return err
+	}
+
+	snapshotPath, metadataPath, err := getSnapshotPath(directoryName, name)
+	if err != nil {
+		return err
+	}
+
+	detail, err := readSnapshotMetadata(metadataPath)
+	if err != nil {
+		return fmt.Errorf("failed to get the snapshot %s of the directory %s: %w", name, directoryName, err)
+	}
+
+	if err = agent.removeSnapshot(ctx, snapshotPath, detail.Method); err != nil {
+		return err
+	}
+
+	if err = os.Remove(metadataPath); err != nil {
+		return err
+	}
+
+	// The folder of the directory is removed with its last snapshot, it fails silently while any snapshot is left.
+	os.Remove(filepath.Dir(snapshotPath))
+
+	return nil
+}
+
+func (agent *LinuxAgent) ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error) {
+	if err = validateLinuxName("directory", directoryName); err != nil {
+		return nil, err
+	}
+
+	return listSnapshotMetadata(filepath.Join(getLinuxSnapshotFolder(), directoryName))
+}
+
+// RestoreSnapshot replaces the directory by a copy of the snapshot, the files created since the snapshot are removed.
+// The copy is swapped in by a rename, so the directory is a new folder with the owner and the ACL of the snapshot,
+// and the NFS clients get stale file handles until they mount it again. Its shares and quota still apply by its
+// path and project, and the NFS exports are reloaded if it is exported.
+func (agent *LinuxAgent) RestoreSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	if err = common.ValidateSnapshotName(name); err != nil {
+		return err
+	}
+
+	snapshotPath, metadataPath, err := getSnapshotPath(directoryName, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = readSnapshotMetadata(metadataPath); err != nil {
+		return fmt.Errorf("failed to get the snapshot %s of the directory %s: %w", name, directoryName, err)
+	}
+
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(dirPath); err != nil {
+		return err
+	}
+
+	// The snapshot is copied into the staging folder beside the directory, so that it is renamed in the same file
+	// system, and the content of the directory is kept until the copy is swapped in.
+	stagingPath, err := os.MkdirTemp(filepath.Dir(dirPath), restoreStagingPrefix+directoryName+"-")
+	if err != nil {
+		return err
+	}
+
+	// The copy has the mode, the owner and the ACL of the snapshot.
+	restoredPath := filepath.Join(stagingPath, "restored")
+	if _, err = agent.runCommand(ctx, "", "cp", "-a", "--reflink=auto", snapshotPath, restoredPath); err != nil {
+		os.RemoveAll(stagingPath)
+		return err
+	}
+
+	// The copy is charged to the quota of the directory, the project is kept by the directory once it is limited.
+	if projectID, _, projectErr := agent.getQuotaProject(ctx, dirPath, false); projectErr == nil {
+		if _, err = agent.runCommand(ctx, "", "chattr", "-R", "+P", "-p", formatProjectID(projectID), restoredPath); err != nil {
+			os.RemoveAll(stagingPath)
+			return err
+		}
+	}
+
+	if err = swapDirectory(dirPath, restoredPath, filepath.Join(stagingPath, "replaced")); err != nil {
+		// The staging folder is kept if the original content is left in it.
+		if _, statErr := os.Stat(dirPath); statErr == nil {
+			os.RemoveAll(stagingPath)
+		}
+		return err
+	}
+
+	removeErr := os.RemoveAll(stagingPath)
+	if err = agent.reexportDirectory(ctx, dirPath); err != nil {
+		return err
+	}
+
+	return removeErr
+}
+
+// reexportDirectory reloads the NFS exports if the directory is exported, so that the export refers to the folder
+// at its path once the folder is replaced.
+func (agent *LinuxAgent) reexportDirectory(ctx context.Context, dirPath string) error {
+	exports, err := loadNFSExportsFile(common.Config.Agent.NFSExportsFile)
+	if err != nil {
+		return err
+	}
+
+	if exports.Export(dirPath) == nil {
+		return nil
+	}
+
+	return agent.reloadNFSExports(ctx)
+}
+
+func (agent *LinuxAgent) GetReplicationManifest(ctx context.Context, directoryName string) (manifest []common.ReplicationEntry, err error) {
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(dirPath); err != nil {
+		return nil, err
+	}
+
+	return buildReplicationManifest(ctx, dirPath)
+}
+
+func (agent *LinuxAgent) ReadReplicationChunk(ctx context.Context, directoryName, path string, offset, length int64) (chunk []byte, err error) {
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return nil, err
+	}
+
+	return readReplicationChunk(dirPath, path, offset, length)
+}
+
+// PullReplication pulls the changes of the directory of the source agent into the directory, the files are received
+// into the replication folder first, so that the transfer interrupted is resumed at the next pull.
+func (agent *LinuxAgent) PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error) {
+	dirPath, err := agent.getDirectoryPath(directoryName)
+	if err != nil {
+		return result, err
+	}
+
+	if info, err := os.Stat(dirPath); err != nil {
+		return result, err
+	} else if !info.IsDir() {
+		return result, fmt.Errorf("the destination of the replication is not a directory: %s", directoryName)
+	}
+
+	peer, err := newReplicationPeer(source)
+	if err != nil {
+		return result, err
+	}
+
+	return pullReplication(ctx, peer, dirPath, filepath.Join(getLinuxReplicationFolder(), directoryName))
+}
+
+// runCommand runs the command with the stdin, and returns the stdout. The stderr is attached to the error.
+func (agent *LinuxAgent) runCommand(ctx context.Context, stdin string, name string, args ...string) ([]byte, error) {
+	result, err := agent.runner().Run(ctx, stdin, name, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+
+	return result.Stdout, nil
+}
+
+func containsFold(list []string, target string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, target string) bool {
+	for _, item := range list {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
 }
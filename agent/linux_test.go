@@ -0,0 +1,1828 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+const testSambaConfig = `# Samba configuration
+[global]
+   workgroup = WORKGROUP
+   security = user
+
+[homes]
+   comment = Home Directories
+   browseable = no
+
+[public]
+   # The public share
+   path = /srv/dme/public
+   comment = public share
+   read only = no
+
+[archive]
+   path = /srv/dme/archive
+   comment = archived files
+   available = no
+`
+
+func setupLinuxRootFolder(t *testing.T) string {
+	rootFolder := t.TempDir()
+	setLinuxRootFolder(t, rootFolder)
+
+	return rootFolder
+}
+
+func setLinuxRootFolder(t *testing.T, rootFolder string) {
+	original := common.Config.Agent.LinuxRootFolder
+	common.Config.Agent.LinuxRootFolder = rootFolder
+	t.Cleanup(func() {
+		common.Config.Agent.LinuxRootFolder = original
+	})
+}
+
+func setupSambaConfigFile(t *testing.T, content string) string {
+	configFile := filepath.Join(t.TempDir(), "smb.conf")
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	original := common.Config.Agent.SambaConfigFile
+	common.Config.Agent.SambaConfigFile = configFile
+	t.Cleanup(func() {
+		common.Config.Agent.SambaConfigFile = original
+	})
+
+	return configFile
+}
+
+func TestLinuxAgent_CreateDirectories(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+
+	tests := []struct {
+		name         string
+		names        []string
+		wantDirPaths []string
+		wantErr      bool
+	}{
+		{
+			name:         "test_create_directories",
+			names:        []string{testDirectoryName1, testDirectoryName2},
+			wantDirPaths: []string{filepath.Join(rootFolder, testDirectoryName1), filepath.Join(rootFolder, testDirectoryName2)},
+			wantErr:      false,
+		},
+		{
+			name:         "test_create_existing_directory",
+			names:        []string{testDirectoryName1},
+			wantDirPaths: nil,
+			wantErr:      true,
+		},
+		{
+			name:         "test_create_directory_outside_root_folder",
+			names:        []string{"../escaped"},
+			wantDirPaths: nil,
+			wantErr:      true,
+		},
+		{
+			name:         "test_create_directory_with_newline",
+			names:        []string{"test\ndirectory"},
+			wantDirPaths: nil,
+			wantErr:      true,
+		},
+		{
+			name:         "test_create_directory_with_restore_prefix",
+			names:        []string{restoreStagingPrefix + "data"},
+			wantDirPaths: nil,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &LinuxAgent{}
+			gotDirPaths, err := agent.CreateDirectories(context.Background(), tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinuxAgent.CreateDirectories() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotDirPaths, tt.wantDirPaths) {
+				t.Errorf("LinuxAgent.CreateDirectories() = %v, want %v", gotDirPaths, tt.wantDirPaths)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_GetDirectoriesDetail(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+
+	agent := &LinuxAgent{}
+	if _, err := agent.CreateDirectory(context.Background(), testDirectoryName); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		names     []string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "test_get_directories_detail",
+			names:     []string{testDirectoryName},
+			wantNames: []string{testDirectoryName},
+			wantErr:   false,
+		},
+		{
+			name:      "test_get_directories_detail_skip_missing",
+			names:     []string{testDirectoryName, testDirectoryName1},
+			wantNames: []string{testDirectoryName},
+			wantErr:   false,
+		},
+		{
+			name:      "test_get_directories_detail_all",
+			wantNames: []string{testDirectoryName},
+			wantErr:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDetail, err := agent.GetDirectoriesDetail(context.Background(), tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinuxAgent.GetDirectoriesDetail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var gotNames []string
+			for _, detail := range gotDetail {
+				gotNames = append(gotNames, detail.Name)
+
+				if !detail.Exist || detail.ParentFullPath != rootFolder || detail.CreationTime == "" || detail.LastWriteTime == "" {
+					t.Errorf("LinuxAgent.GetDirectoriesDetail() returns incomplete detail %+v", detail)
+				}
+			}
+			if !reflect.DeepEqual(gotNames, tt.wantNames) {
+				t.Errorf("LinuxAgent.GetDirectoriesDetail() = %v, want %v", gotNames, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_DeleteDirectory(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	snapshotFolder := setupLinuxSnapshotFolder(t)
+
+	agent := &LinuxAgent{Runner: NewFakeCommandRunner().ExpectStdout("xfs\n", "stat").ExpectStdout("", "cp")}
+	if _, err := agent.CreateDirectory(context.Background(), testDirectoryName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.CreateSnapshot(context.Background(), testDirectoryName, "daily-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := agent.DeleteDirectory(context.Background(), testDirectoryName); err != nil {
+		t.Errorf("LinuxAgent.DeleteDirectory() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(rootFolder, testDirectoryName)); !os.IsNotExist(err) {
+		t.Errorf("LinuxAgent.DeleteDirectory() does not remove the directory")
+	}
+	if _, err := os.Stat(filepath.Join(snapshotFolder, testDirectoryName)); !os.IsNotExist(err) {
+		t.Errorf("LinuxAgent.DeleteDirectory() does not remove the snapshots of the directory")
+	}
+}
+
+func TestLinuxAgent_UpdateDirectory(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+
+	agent := &LinuxAgent{}
+	if _, err := agent.CreateDirectories(context.Background(), []string{testDirectoryName, "existing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := agent.UpdateDirectory(context.Background(), testDirectoryName, common.DirectoryUpdate{NewName: "existing"}); err == nil {
+		t.Errorf("LinuxAgent.UpdateDirectory() replaces the existing directory without error")
+	}
+
+	if err := agent.UpdateDirectory(context.Background(), testDirectoryName, common.DirectoryUpdate{NewName: "renamed"}); err != nil {
+		t.Fatalf("LinuxAgent.UpdateDirectory() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(rootFolder, "renamed")); err != nil {
+		t.Errorf("LinuxAgent.UpdateDirectory() does not rename the directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootFolder, testDirectoryName)); !os.IsNotExist(err) {
+		t.Errorf("LinuxAgent.UpdateDirectory() keeps the directory of the old name")
+	}
+}
+
+func TestLinuxAgent_UpdateDirectory_snapshotsAndReplication(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	snapshotFolder := setupLinuxSnapshotFolder(t)
+
+	agent := &LinuxAgent{Runner: NewFakeCommandRunner().ExpectStdout("xfs\n", "stat").ExpectStdout("", "cp")}
+	if _, err := agent.CreateDirectory(context.Background(), testDirectoryName); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agent.CreateSnapshot(context.Background(), testDirectoryName, "daily-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The snapshots are kept by the name of the directory, so it is not renamed until they are deleted.
+	if err := agent.UpdateDirectory(context.Background(), testDirectoryName, common.DirectoryUpdate{NewName: "renamed"}); err == nil {
+		t.Errorf("LinuxAgent.UpdateDirectory() renames the directory with the snapshots")
+	}
+	if _, err := os.Stat(filepath.Join(rootFolder, testDirectoryName)); err != nil {
+		t.Errorf("LinuxAgent.UpdateDirectory() with the snapshots changes the directory: %v", err)
+	}
+
+	if err := agent.DeleteSnapshot(context.Background(), testDirectoryName, "daily-1"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(snapshotFolder); len(entries) != 0 {
+		t.Fatalf("LinuxAgent.DeleteSnapshot() leaves %d entries in the snapshot folder", len(entries))
+	}
+
+	// The files of the interrupted replication transfer are kept by the name of the directory as well.
+	replicationPath := filepath.Join(getLinuxReplicationFolder(), testDirectoryName)
+	if err := os.MkdirAll(replicationPath, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.UpdateDirectory(context.Background(), testDirectoryName, common.DirectoryUpdate{NewName: "renamed"}); err == nil {
+		t.Errorf("LinuxAgent.UpdateDirectory() renames the directory with the replication transfer")
+	}
+
+	if err := os.RemoveAll(replicationPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := agent.UpdateDirectory(context.Background(), testDirectoryName, common.DirectoryUpdate{NewName: "renamed"}); err != nil {
+		t.Errorf("LinuxAgent.UpdateDirectory() error = %v", err)
+	}
+}
+
+func TestLinuxAgent_GetCIFSSharesDetail(t *testing.T) {
+	setupSambaConfigFile(t, testSambaConfig)
+
+	tests := []struct {
+		name       string
+		names      []string
+		wantDetail []common.ShareDetail
+	}{
+		{
+			name:  "test_get_all_shares_detail",
+			names: nil,
+			wantDetail: []common.ShareDetail{
+				{Name: "public", DirectoryPath: "/srv/dme/public", Description: "public share", State: "online"},
+				{Name: "archive", DirectoryPath: "/srv/dme/archive", Description: "archived files", State: "offline"},
+			},
+		},
+		{
+			name:  "test_get_shares_detail_by_name",
+			names: []string{"ARCHIVE"},
+			wantDetail: []common.ShareDetail{
+				{Name: "archive", DirectoryPath: "/srv/dme/archive", Description: "archived files", State: "offline"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &LinuxAgent{}
+			gotDetail, err := agent.GetCIFSSharesDetail(context.Background(), tt.names)
+			if err != nil {
+				t.Errorf("LinuxAgent.GetCIFSSharesDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("LinuxAgent.GetCIFSSharesDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_GetCIFSShareDetail(t *testing.T) {
+	setupSambaConfigFile(t, testSambaConfig)
+
+	tests := []struct {
+		name       string
+		shareName  string
+		wantDetail common.ShareDetail
+		wantErr    bool
+	}{
+		{
+			name:       "test_get_share_detail",
+			shareName:  "public",
+			wantDetail: common.ShareDetail{Name: "public", DirectoryPath: "/srv/dme/public", Description: "public share", State: "online"},
+			wantErr:    false,
+		},
+		{
+			name:      "test_get_reserved_section",
+			shareName: "global",
+			wantErr:   true,
+		},
+		{
+			name:      "test_get_missing_share",
+			shareName: "missing",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &LinuxAgent{}
+			gotDetail, err := agent.GetCIFSShareDetail(context.Background(), tt.shareName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinuxAgent.GetCIFSShareDetail() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("LinuxAgent.GetCIFSShareDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_CreateCIFSShare(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	configFile := setupSambaConfigFile(t, testSambaConfig)
+
+	tests := []struct {
+		name          string
+		shareName     string
+		directoryName string
+		description   string
+		reloadResult  CommandResult
+		wantErr       bool
+	}{
+		{
+			name:          "test_create_cifs_share",
+			shareName:     testShareName,
+			directoryName: testDirectoryName,
+			description:   "this is a test cifs share",
+			wantErr:       false,
+		},
+		{
+			name:          "test_create_existing_cifs_share",
+			shareName:     "PUBLIC",
+			directoryName: testDirectoryName,
+			wantErr:       true,
+		},
+		{
+			name:          "test_create_cifs_share_reload_failed",
+			shareName:     "test_cifs_share_1",
+			directoryName: testDirectoryName,
+			reloadResult:  CommandResult{ExitCode: 1, Stderr: []byte("Can't find pid for destination 'smbd'")},
+			wantErr:       true,
+		},
+		{
+			name:          "test_create_cifs_share_injecting_section",
+			shareName:     "test]\n[global",
+			directoryName: testDirectoryName,
+			wantErr:       true,
+		},
+		{
+			name:          "test_create_cifs_share_injecting_option",
+			shareName:     "test_cifs_share_2",
+			directoryName: testDirectoryName,
+			description:   "comment\n   guest ok = yes",
+			wantErr:       true,
+		},
+		{
+			name:          "test_create_cifs_share_outside_root_folder",
+			shareName:     "test_cifs_share_3",
+			directoryName: "../../etc",
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeCommandRunner().Expect(tt.reloadResult, "smbcontrol", "smbd", "reload-config")
+			agent := &LinuxAgent{Runner: runner}
+
+			err := agent.CreateCIFSShare(context.Background(), tt.shareName, tt.directoryName, tt.description, []common.ShareAccess{{UserName: testLocalUserName, Permission: common.SharePermissionFull}})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinuxAgent.CreateCIFSShare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	section := config.Section(testShareName)
+	if section == nil {
+		t.Fatalf("LinuxAgent.CreateCIFSShare() does not add the share to %s", configFile)
+	}
+	if got, want := section.Get("path"), filepath.Join(rootFolder, testDirectoryName); got != want {
+		t.Errorf("LinuxAgent.CreateCIFSShare() path = %v, want %v", got, want)
+	}
+	if got, want := section.Get("valid users"), testLocalUserName; got != want {
+		t.Errorf("LinuxAgent.CreateCIFSShare() valid users = %v, want %v", got, want)
+	}
+}
+
+func TestLinuxAgent_DeleteCIFSShare(t *testing.T) {
+	configFile := setupSambaConfigFile(t, testSambaConfig)
+
+	runner := NewFakeCommandRunner().ExpectStdout("", "smbcontrol", "smbd", "reload-config")
+	agent := &LinuxAgent{Runner: runner}
+
+	if err := agent.DeleteCIFSShare(context.Background(), "archive"); err != nil {
+		t.Errorf("LinuxAgent.DeleteCIFSShare() error = %v", err)
+	}
+	if err := agent.DeleteCIFSShare(context.Background(), "archive"); err == nil {
+		t.Errorf("LinuxAgent.DeleteCIFSShare() deletes the missing share without error")
+	}
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Section("archive") != nil {
+		t.Errorf("LinuxAgent.DeleteCIFSShare() does not remove the share from %s", configFile)
+	}
+
+	// The samba configuration is reloaded only once, the second deletion fails before saving.
+	if got := len(runner.Commands()); got != 1 {
+		t.Errorf("LinuxAgent.DeleteCIFSShare() runs %d commands, want 1", got)
+	}
+}
+
+func TestLinuxAgent_GrantCIFSShareAccess(t *testing.T) {
+	configFile := setupSambaConfigFile(t, testSambaConfig)
+
+	runner := NewFakeCommandRunner().ExpectStdout("", "smbcontrol", "smbd", "reload-config")
+	agent := &LinuxAgent{Runner: runner}
+
+	access := []common.ShareAccess{
+		{UserName: "alice", Permission: common.SharePermissionFull},
+		{UserName: "bob", Permission: common.SharePermissionRead},
+		{UserName: "carol", Permission: common.SharePermissionDeny},
+		{GroupName: "staff", Permission: common.SharePermissionRead},
+		{GroupName: "alice", Permission: common.SharePermissionFull},
+	}
+	if err := agent.GrantCIFSShareAccess(context.Background(), "public", access); err != nil {
+		t.Fatalf("LinuxAgent.GrantCIFSShareAccess() error = %v", err)
+	}
+	// The level of bob is replaced.
+	access = []common.ShareAccess{{UserName: "BOB", Permission: common.SharePermissionChange}}
+	if err := agent.GrantCIFSShareAccess(context.Background(), "public", access); err != nil {
+		t.Fatalf("LinuxAgent.GrantCIFSShareAccess() error = %v", err)
+	}
+	// The group alice is kept since only the user alice is revoked.
+	if err := agent.RevokeCIFSShareAccess(context.Background(), "public", []string{"alice"}, nil); err != nil {
+		t.Fatalf("LinuxAgent.RevokeCIFSShareAccess() error = %v", err)
+	}
+	if err := agent.GrantCIFSShareAccess(context.Background(), "missing", access); err == nil {
+		t.Errorf("LinuxAgent.GrantCIFSShareAccess() grants the access to the missing share without error")
+	}
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	section := config.Section("public")
+
+	wantOptions := map[string]string{"valid users": "@staff @alice BOB", "read list": "@staff", "invalid users": "carol"}
+	for key, want := range wantOptions {
+		if got := section.Get(key); got != want {
+			t.Errorf("LinuxAgent.GrantCIFSShareAccess() %s = %q, want %q", key, got, want)
+		}
+	}
+
+	wantAccess := []common.ShareAccess{
+		{GroupName: "staff", Permission: common.SharePermissionRead},
+		{GroupName: "alice", Permission: common.SharePermissionChange},
+		{UserName: "BOB", Permission: common.SharePermissionChange},
+		{UserName: "carol", Permission: common.SharePermissionDeny},
+	}
+	if got := section.getShareAccess(); !reflect.DeepEqual(got, wantAccess) {
+		t.Errorf("sambaSection.getShareAccess() = %+v, want %+v", got, wantAccess)
+	}
+}
+
+func TestLinuxAgent_UpdateCIFSShare(t *testing.T) {
+	configFile := setupSambaConfigFile(t, testSambaConfig)
+
+	runner := NewFakeCommandRunner().ExpectStdout("", "smbcontrol", "smbd", "reload-config")
+	agent := &LinuxAgent{Runner: runner}
+
+	description := "the shared files"
+	if err := agent.UpdateCIFSShare(context.Background(), "public", common.ShareUpdate{Description: &description}); err != nil {
+		t.Fatalf("LinuxAgent.UpdateCIFSShare() error = %v", err)
+	}
+	if err := agent.UpdateCIFSShare(context.Background(), "homes", common.ShareUpdate{Description: &description}); err == nil {
+		t.Errorf("LinuxAgent.UpdateCIFSShare() updates the reserved section without error")
+	}
+
+	config, err := loadSambaConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.Section("public").Get("comment"); got != description {
+		t.Errorf("LinuxAgent.UpdateCIFSShare() comment = %q, want %q", got, description)
+	}
+	if got := config.Section("public").Get("path"); got != "/srv/dme/public" {
+		t.Errorf("LinuxAgent.UpdateCIFSShare() changes the path to %q", got)
+	}
+}
+
+func TestLinuxAgent_UpdateLocalUser(t *testing.T) {
+	disabled, enabled := true, false
+
+	tests := []struct {
+		name         string
+		update       common.LocalUserUpdate
+		withSamba    bool
+		wantCommands []string
+	}{
+		{
+			name:      "test_reset_password",
+			update:    common.LocalUserUpdate{Password: testLocalUserPassword},
+			withSamba: true,
+			wantCommands: []string{
+				"chpasswd",
+				"smbpasswd -a -s " + testLocalUserName,
+			},
+		},
+		{
+			name:      "test_disable_local_user",
+			update:    common.LocalUserUpdate{Disabled: &disabled},
+			withSamba: true,
+			wantCommands: []string{
+				"usermod --expiredate 1 " + testLocalUserName,
+				"smbpasswd -d " + testLocalUserName,
+			},
+		},
+		{
+			name:   "test_unlock_and_enable_local_user",
+			update: common.LocalUserUpdate{Disabled: &enabled, Unlock: true},
+			wantCommands: []string{
+				"usermod --unlock " + testLocalUserName,
+				"usermod --expiredate  " + testLocalUserName,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeCommandRunner().ExpectStdout("", "chpasswd").ExpectStdout("", "usermod")
+			if tt.withSamba {
+				runner.ExpectStdout("", "smbpasswd")
+			}
+			agent := &LinuxAgent{Runner: runner}
+
+			if err := agent.UpdateLocalUser(context.Background(), testLocalUserName, tt.update); err != nil {
+				t.Fatalf("LinuxAgent.UpdateLocalUser() error = %v", err)
+			}
+
+			var gotCommands []string
+			for _, command := range runner.Commands() {
+				gotCommands = append(gotCommands, command.String())
+			}
+			if !reflect.DeepEqual(gotCommands, tt.wantCommands) {
+				t.Errorf("LinuxAgent.UpdateLocalUser() commands = %v, want %v", gotCommands, tt.wantCommands)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_UpdateLocalUser_invalidPassword(t *testing.T) {
+	runner := NewFakeCommandRunner().ExpectStdout("", "chpasswd")
+	agent := &LinuxAgent{Runner: runner}
+
+	update := common.LocalUserUpdate{Password: "x\nroot:pwned"}
+	if err := agent.UpdateLocalUser(context.Background(), testLocalUserName, update); err == nil {
+		t.Fatalf("LinuxAgent.UpdateLocalUser() expected an error for the password with a newline")
+	}
+
+	if commands := runner.Commands(); len(commands) != 0 {
+		t.Errorf("LinuxAgent.UpdateLocalUser() runs %v, want no command", commands)
+	}
+}
+
+func TestLinuxAgent_CreateLocalUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		username     string
+		password     string
+		withSamba    bool
+		useraddErr   bool
+		wantCommands []string
+		wantErr      bool
+	}{
+		{
+			name:      "test_create_local_user_with_samba",
+			withSamba: true,
+			wantCommands: []string{
+				"useradd --no-create-home --shell /usr/sbin/nologin " + testLocalUserName,
+				"chpasswd",
+				"smbpasswd -a -s " + testLocalUserName,
+			},
+			wantErr: false,
+		},
+		{
+			name:      "test_create_local_user_without_samba",
+			withSamba: false,
+			wantCommands: []string{
+				"useradd --no-create-home --shell /usr/sbin/nologin " + testLocalUserName,
+				"chpasswd",
+			},
+			wantErr: false,
+		},
+		{
+			name:       "test_create_existing_local_user",
+			withSamba:  true,
+			useraddErr: true,
+			wantCommands: []string{
+				"useradd --no-create-home --shell /usr/sbin/nologin " + testLocalUserName,
+			},
+			wantErr: true,
+		},
+		{
+			name:         "test_create_local_user_injecting_password_line",
+			password:     "x\nroot:pwned",
+			withSamba:    true,
+			wantCommands: nil,
+			wantErr:      true,
+		},
+		{
+			name:         "test_create_local_user_with_colon",
+			username:     "root:x",
+			withSamba:    true,
+			wantCommands: nil,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeCommandRunner().ExpectStdout("", "useradd").ExpectStdout("", "chpasswd")
+			if tt.withSamba {
+				runner.ExpectStdout("Added user "+testLocalUserName+".", "smbpasswd")
+			}
+			if tt.useraddErr {
+				runner.Expect(CommandResult{ExitCode: 9, Stderr: []byte("useradd: user 'test_account' already exists")}, "useradd")
+			}
+			agent := &LinuxAgent{Runner: runner}
+
+			username, password := testLocalUserName, testLocalUserPassword
+			if tt.username != "" {
+				username = tt.username
+			}
+			if tt.password != "" {
+				password = tt.password
+			}
+
+			err := agent.CreateLocalUser(context.Background(), username, password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinuxAgent.CreateLocalUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var gotCommands []string
+			for _, command := range runner.Commands() {
+				gotCommands = append(gotCommands, command.String())
+			}
+			if !reflect.DeepEqual(gotCommands, tt.wantCommands) {
+				t.Errorf("LinuxAgent.CreateLocalUser() commands = %v, want %v", gotCommands, tt.wantCommands)
+			}
+
+			if commands := runner.Commands(); len(commands) > 1 && commands[1].Stdin != testLocalUserName+":"+testLocalUserPassword+"\n" {
+				t.Errorf("LinuxAgent.CreateLocalUser() chpasswd stdin = %q", commands[1].Stdin)
+			}
+		})
+	}
+}
+
+func Test_sambaConfig(t *testing.T) {
+	config := parseSambaConfig([]byte(testSambaConfig))
+
+	// Rendering an unchanged configuration keeps the file as is.
+	if got := string(config.Bytes()); got != testSambaConfig {
+		t.Errorf("sambaConfig.Bytes() = %q, want %q", got, testSambaConfig)
+	}
+
+	section := &sambaSection{Name: testShareName}
+	section.Set("path", "/srv/dme/test_directory")
+	section.Set("Valid  Users", "alice")
+	section.Set("valid users", "alice bob")
+	if err := config.AddSection(section); err != nil {
+		t.Fatalf("sambaConfig.AddSection() error = %v", err)
+	}
+
+	if err := config.AddSection(&sambaSection{Name: "PUBLIC"}); err == nil {
+		t.Errorf("sambaConfig.AddSection() adds a duplicated section")
+	}
+
+	reloaded := parseSambaConfig(config.Bytes())
+	if got := reloaded.Section(testShareName).Get("valid users"); got != "alice bob" {
+		t.Errorf("sambaSection.Get() = %v, want %v", got, "alice bob")
+	}
+
+	if err := reloaded.RemoveSection("public"); err != nil {
+		t.Errorf("sambaConfig.RemoveSection() error = %v", err)
+	}
+
+	var gotShares []string
+	for _, share := range reloaded.Shares() {
+		gotShares = append(gotShares, share.Name)
+	}
+	if wantShares := []string{"archive", testShareName}; !reflect.DeepEqual(gotShares, wantShares) {
+		t.Errorf("sambaConfig.Shares() = %v, want %v", gotShares, wantShares)
+	}
+}
+
+func Test_readOSRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "os-release")
+	content := "NAME=\"Ubuntu\"\nVERSION_ID=\"22.04\"\nPRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\n# comment\nID=ubuntu\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readOSRelease(path)
+	if err != nil {
+		t.Fatalf("readOSRelease() error = %v", err)
+	}
+
+	want := map[string]string{
+		"NAME":        "Ubuntu",
+		"VERSION_ID":  "22.04",
+		"PRETTY_NAME": "Ubuntu 22.04.3 LTS",
+		"ID":          "ubuntu",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readOSRelease() = %v, want %v", got, want)
+	}
+}
+
+func TestLinuxAgent_GetLocalUsersDetail(t *testing.T) {
+	dir := t.TempDir()
+
+	passwd := "root:x:0:0:root:/root:/bin/bash\n" +
+		"nobody:x:65534:65534:nobody:/nonexistent:/usr/sbin/nologin\n" +
+		"alice:x:1000:1000:Alice Smith,,,:/home/alice:/bin/bash\n" +
+		"bob:x:1001:1001::/home/bob:/usr/sbin/nologin\n"
+	shadow := "root:*:19000:0:99999:7:::\n" +
+		"alice:$6$salt$hash:19000:0:99999:7:::\n" +
+		"bob:!$6$salt$hash:19000:0:99999:7::1:\n"
+
+	originalPasswd, originalShadow := passwdFile, shadowFile
+	passwdFile, shadowFile = filepath.Join(dir, "passwd"), filepath.Join(dir, "shadow")
+	defer func() {
+		passwdFile, shadowFile = originalPasswd, originalShadow
+	}()
+
+	os.WriteFile(passwdFile, []byte(passwd), 0644)
+	os.WriteFile(shadowFile, []byte(shadow), 0600)
+
+	tests := []struct {
+		name       string
+		usernames  []string
+		wantDetail []common.LocalUserDetail
+	}{
+		{
+			name:      "test_get_regular_users",
+			usernames: nil,
+			wantDetail: []common.LocalUserDetail{
+				{Name: "alice", UID: "1000", FullName: "Alice Smith", Description: "Alice Smith,,,", Status: "OK", IsPasswordRequired: true, IsPasswordChangeable: true},
+				{Name: "bob", UID: "1001", Status: "Degraded", IsPasswordRequired: true, IsPasswordChangeable: true, IsLockout: true, IsDisabled: true},
+			},
+		},
+		{
+			name:      "test_get_users_by_name",
+			usernames: []string{"root"},
+			wantDetail: []common.LocalUserDetail{
+				{Name: "root", UID: "0", FullName: "root", Description: "root", Status: "OK", IsPasswordRequired: true, IsPasswordChangeable: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &LinuxAgent{}
+			gotDetail, err := agent.GetLocalUsersDetail(context.Background(), tt.usernames)
+			if err != nil {
+				t.Errorf("LinuxAgent.GetLocalUsersDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("LinuxAgent.GetLocalUsersDetail() = %+v, want %+v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_GetLocalGroupsDetail(t *testing.T) {
+	group := "root:x:0:\n" +
+		"nogroup:x:65534:\n" +
+		"staff:x:1000:alice,bob\n" +
+		"empty:x:1001:\n"
+
+	original := groupFile
+	groupFile = filepath.Join(t.TempDir(), "group")
+	defer func() {
+		groupFile = original
+	}()
+
+	os.WriteFile(groupFile, []byte(group), 0644)
+
+	tests := []struct {
+		name       string
+		names      []string
+		wantDetail []common.LocalGroupDetail
+	}{
+		{
+			name:  "test_get_regular_groups",
+			names: nil,
+			wantDetail: []common.LocalGroupDetail{
+				{Name: "staff", GID: "1000", Members: []string{"alice", "bob"}},
+				{Name: "empty", GID: "1001"},
+			},
+		},
+		{
+			name:  "test_get_groups_by_name",
+			names: []string{"root"},
+			wantDetail: []common.LocalGroupDetail{
+				{Name: "root", GID: "0"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &LinuxAgent{}
+			gotDetail, err := agent.GetLocalGroupsDetail(context.Background(), tt.names)
+			if err != nil {
+				t.Errorf("LinuxAgent.GetLocalGroupsDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("LinuxAgent.GetLocalGroupsDetail() = %+v, want %+v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_AddLocalGroupMembers(t *testing.T) {
+	runner := NewFakeCommandRunner().ExpectStdout("", "gpasswd")
+	agent := &LinuxAgent{Runner: runner}
+
+	if err := agent.AddLocalGroupMembers(context.Background(), "staff", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("LinuxAgent.AddLocalGroupMembers() error = %v", err)
+	}
+	if err := agent.RemoveLocalGroupMembers(context.Background(), "staff", []string{"bob"}); err != nil {
+		t.Fatalf("LinuxAgent.RemoveLocalGroupMembers() error = %v", err)
+	}
+
+	var gotCommands []string
+	for _, command := range runner.Commands() {
+		gotCommands = append(gotCommands, command.String())
+	}
+	wantCommands := []string{"gpasswd --add alice -- staff", "gpasswd --add bob -- staff", "gpasswd --delete bob -- staff"}
+	if !reflect.DeepEqual(gotCommands, wantCommands) {
+		t.Errorf("LinuxAgent commands = %v, want %v", gotCommands, wantCommands)
+	}
+}
+
+func TestLinuxAgent_LocalGroupInvalidNames(t *testing.T) {
+	runner := NewFakeCommandRunner().ExpectStdout("", "groupadd").ExpectStdout("", "groupdel").ExpectStdout("", "gpasswd")
+	agent := &LinuxAgent{Runner: runner}
+
+	for _, name := range []string{"", "-f", "--help", "staff:x", "staff,root", "staff\nroot::0:", "a/b", restoreStagingPrefix + "x"} {
+		if err := agent.CreateLocalGroup(context.Background(), name, ""); err == nil {
+			t.Errorf("LinuxAgent.CreateLocalGroup(%q) error = nil, want the invalid name", name)
+		}
+		if err := agent.DeleteLocalGroup(context.Background(), name); err == nil {
+			t.Errorf("LinuxAgent.DeleteLocalGroup(%q) error = nil, want the invalid name", name)
+		}
+		if err := agent.AddLocalGroupMembers(context.Background(), name, []string{"alice"}); err == nil {
+			t.Errorf("LinuxAgent.AddLocalGroupMembers() to %q error = nil, want the invalid name", name)
+		}
+		if err := agent.AddLocalGroupMembers(context.Background(), "staff", []string{"alice", name}); err == nil {
+			t.Errorf("LinuxAgent.AddLocalGroupMembers(%q) error = nil, want the invalid name", name)
+		}
+		if err := agent.RemoveLocalGroupMembers(context.Background(), "staff", []string{name}); err == nil {
+			t.Errorf("LinuxAgent.RemoveLocalGroupMembers(%q) error = nil, want the invalid name", name)
+		}
+	}
+
+	// No command is run for any invalid name, even for the valid members before the invalid one.
+	if commands := runner.Commands(); len(commands) != 0 {
+		t.Errorf("LinuxAgent runs %v, want no command", commands)
+	}
+
+	if err := agent.CreateLocalGroup(context.Background(), "staff", ""); err != nil {
+		t.Fatalf("LinuxAgent.CreateLocalGroup() error = %v", err)
+	}
+	if err := agent.DeleteLocalGroup(context.Background(), "staff"); err != nil {
+		t.Fatalf("LinuxAgent.DeleteLocalGroup() error = %v", err)
+	}
+	var gotCommands []string
+	for _, command := range runner.Commands() {
+		gotCommands = append(gotCommands, command.String())
+	}
+	if wantCommands := []string{"groupadd -- staff", "groupdel -- staff"}; !reflect.DeepEqual(gotCommands, wantCommands) {
+		t.Errorf("LinuxAgent commands = %v, want %v", gotCommands, wantCommands)
+	}
+}
+
+const testNFSExports = `# /etc/exports: the access control list for filesystems which may be exported
+/srv/dme/public 192.168.0.0/24(rw,sync,no_subtree_check) *(ro)
+"/srv/dme/team docs" -rw,no_root_squash \
+	10.0.0.1 10.0.0.2(ro)
+/var/backup backup.example.com(rw,no_root_squash)
+`
+
+func setupNFSExportsFile(t *testing.T, content string) string {
+	exportsFile := filepath.Join(t.TempDir(), "exports")
+	if err := os.WriteFile(exportsFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	original := common.Config.Agent.NFSExportsFile
+	common.Config.Agent.NFSExportsFile = exportsFile
+	t.Cleanup(func() {
+		common.Config.Agent.NFSExportsFile = original
+	})
+
+	return exportsFile
+}
+
+func TestLinuxAgent_GetNFSExportsDetail(t *testing.T) {
+	setLinuxRootFolder(t, "/srv/dme")
+	setupNFSExportsFile(t, testNFSExports)
+
+	public := common.NFSExportDetail{
+		Name:          "public",
+		DirectoryPath: "/srv/dme/public",
+		Clients: []common.NFSClient{
+			{Host: "192.168.0.0/24", Access: "rw", RootSquash: true},
+			{Host: "*", Access: "ro", RootSquash: true},
+		},
+	}
+	teamDocs := common.NFSExportDetail{
+		Name:          "team docs",
+		DirectoryPath: "/srv/dme/team docs",
+		Clients: []common.NFSClient{
+			{Host: "10.0.0.1", Access: "rw", RootSquash: false},
+			{Host: "10.0.0.2", Access: "ro", RootSquash: false},
+		},
+	}
+	backup := common.NFSExportDetail{
+		Name:          "/var/backup",
+		DirectoryPath: "/var/backup",
+		Clients: []common.NFSClient{
+			{Host: "backup.example.com", Access: "rw", RootSquash: false},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		directoryNames []string
+		wantDetail     []common.NFSExportDetail
+	}{
+		{
+			name:           "test_get_all_nfs_exports_detail",
+			directoryNames: nil,
+			wantDetail:     []common.NFSExportDetail{public, teamDocs, backup},
+		},
+		{
+			name:           "test_get_nfs_exports_detail_by_name",
+			directoryNames: []string{"team docs", "missing"},
+			wantDetail:     []common.NFSExportDetail{teamDocs},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := &LinuxAgent{}
+			gotDetail, err := agent.GetNFSExportsDetail(context.Background(), tt.directoryNames)
+			if err != nil {
+				t.Errorf("LinuxAgent.GetNFSExportsDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("LinuxAgent.GetNFSExportsDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_MountCIFSShare(t *testing.T) {
+	mountFolder := t.TempDir()
+	original := common.Config.Agent.LinuxMountFolder
+	common.Config.Agent.LinuxMountFolder = mountFolder
+	t.Cleanup(func() {
+		common.Config.Agent.LinuxMountFolder = original
+	})
+
+	runner := NewFakeCommandRunner().ExpectStdout("", "mount").ExpectStdout("", "umount")
+	agent := &LinuxAgent{Runner: runner}
+	mountPoint := filepath.Join(mountFolder, "public")
+
+	tests := []struct {
+		name       string
+		mountPoint string
+		userName   string
+		password   string
+	}{
+		{name: "test_password_with_newline", mountPoint: mountPoint, userName: "alice", password: "x\ndomain=CORP"},
+		{name: "test_password_with_carriage_return", mountPoint: mountPoint, userName: "alice", password: "x\rdomain=CORP"},
+		{name: "test_password_with_nul", mountPoint: mountPoint, userName: "alice", password: "x\x00"},
+		{name: "test_username_with_newline", mountPoint: mountPoint, userName: "alice\npassword=x", password: "Password123"},
+		{name: "test_mount_point_outside_mount_folder", mountPoint: "/etc", userName: "alice", password: "Password123"},
+		{name: "test_mount_point_escaping_mount_folder", mountPoint: filepath.Join(mountFolder, "..", "etc"), userName: "alice", password: "Password123"},
+		{name: "test_mount_folder_itself", mountPoint: mountFolder, userName: "alice", password: "Password123"},
+		{name: "test_relative_mount_point", mountPoint: "public", userName: "alice", password: "Password123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := agent.MountCIFSShare(context.Background(), tt.mountPoint, `\\192.168.0.1\public`, tt.userName, tt.password); err == nil {
+				t.Errorf("LinuxAgent.MountCIFSShare() error = nil, want the invalid input rejected")
+			}
+		})
+	}
+	if commands := runner.Commands(); len(commands) != 0 {
+		t.Fatalf("LinuxAgent.MountCIFSShare() runs %v for the invalid input", commands)
+	}
+
+	if err := agent.MountCIFSShare(context.Background(), mountPoint, `\\192.168.0.1\public`, "alice", "Password123"); err != nil {
+		t.Fatalf("LinuxAgent.MountCIFSShare() error = %v", err)
+	}
+	commands := runner.Commands()
+	if len(commands) != 1 || commands[0].Args[2] != "//192.168.0.1/public" || commands[0].Args[3] != mountPoint {
+		t.Errorf("LinuxAgent.MountCIFSShare() runs %v", commands)
+	}
+
+	if err := agent.UnmountCIFSShare(context.Background(), "/"); err == nil {
+		t.Errorf("LinuxAgent.UnmountCIFSShare() error = nil, want the mount point outside the mount folder rejected")
+	}
+	if err := agent.UnmountCIFSShare(context.Background(), mountPoint); err != nil {
+		t.Errorf("LinuxAgent.UnmountCIFSShare() error = %v", err)
+	}
+}
+
+func TestLinuxAgent_CreateNFSExport(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	exportsFile := setupNFSExportsFile(t, testNFSExports)
+
+	tests := []struct {
+		name          string
+		directoryName string
+		clients       []common.NFSClient
+		wantErr       bool
+	}{
+		{
+			name:          "test_create_nfs_export",
+			directoryName: testDirectoryName,
+			clients: []common.NFSClient{
+				{Host: "192.168.0.0/24", Access: "rw", RootSquash: true},
+				{Host: "192.168.1.10", Access: "ro", RootSquash: false},
+			},
+			wantErr: false,
+		},
+		{
+			name:          "test_create_existing_nfs_export",
+			directoryName: testDirectoryName,
+			clients: []common.NFSClient{
+				{Host: "*", Access: "ro", RootSquash: true},
+			},
+			wantErr: true,
+		},
+		{
+			name:          "test_create_nfs_export_without_clients",
+			directoryName: testDirectoryName1,
+			clients:       nil,
+			wantErr:       true,
+		},
+		{
+			name:          "test_create_nfs_export_with_invalid_access",
+			directoryName: testDirectoryName1,
+			clients: []common.NFSClient{
+				{Host: "*", Access: "full", RootSquash: true},
+			},
+			wantErr: true,
+		},
+		{
+			name:          "test_create_nfs_export_injecting_export",
+			directoryName: testDirectoryName1,
+			clients: []common.NFSClient{
+				{Host: "x\n/ *(rw,no_root_squash)", Access: "ro", RootSquash: true},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeCommandRunner().ExpectStdout("", "exportfs", "-ra")
+			agent := &LinuxAgent{Runner: runner}
+
+			err := agent.CreateNFSExport(context.Background(), tt.directoryName, tt.clients)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LinuxAgent.CreateNFSExport() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotCommands := len(runner.Commands()); !tt.wantErr && gotCommands != 1 {
+				t.Errorf("LinuxAgent.CreateNFSExport() runs %d commands, want 1", gotCommands)
+			}
+		})
+	}
+
+	content, err := os.ReadFile(exportsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing exports and comments are kept as is.
+	wantContent := testNFSExports + filepath.Join(rootFolder, testDirectoryName) +
+		" 192.168.0.0/24(rw,sync,no_subtree_check,root_squash) 192.168.1.10(ro,sync,no_subtree_check,no_root_squash)\n"
+	if string(content) != wantContent {
+		t.Errorf("LinuxAgent.CreateNFSExport() exports = %q, want %q", content, wantContent)
+	}
+}
+
+func TestLinuxAgent_DeleteNFSExport(t *testing.T) {
+	setLinuxRootFolder(t, "/srv/dme")
+	exportsFile := setupNFSExportsFile(t, testNFSExports)
+
+	runner := NewFakeCommandRunner().ExpectStdout("", "exportfs", "-ra")
+	agent := &LinuxAgent{Runner: runner}
+
+	if err := agent.DeleteNFSExport(context.Background(), "team docs"); err != nil {
+		t.Errorf("LinuxAgent.DeleteNFSExport() error = %v", err)
+	}
+	if err := agent.DeleteNFSExport(context.Background(), "team docs"); err == nil {
+		t.Errorf("LinuxAgent.DeleteNFSExport() deletes the missing export without error")
+	}
+
+	content, err := os.ReadFile(exportsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantContent := `# /etc/exports: the access control list for filesystems which may be exported
+/srv/dme/public 192.168.0.0/24(rw,sync,no_subtree_check) *(ro)
+/var/backup backup.example.com(rw,no_root_squash)
+`
+	if string(content) != wantContent {
+		t.Errorf("LinuxAgent.DeleteNFSExport() exports = %q, want %q", content, wantContent)
+	}
+}
+
+func TestLinuxAgent_GetStatus(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		loadavg    string
+		uptime     string
+		wantStatus common.AgentStatus
+		wantErr    bool
+	}{
+		{
+			name:       "test_get_status",
+			loadavg:    "0.52 0.58 0.59 1/467 12345\n",
+			uptime:     "350735.47 234388.90\n",
+			wantStatus: common.AgentStatus{AgentVersion: Version, Load: 0.52, Uptime: 350735},
+		},
+		{
+			name:    "test_get_status_invalid_loadavg",
+			loadavg: "\n",
+			uptime:  "350735.47 234388.90\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			originalLoadavgFile, originalUptimeFile := loadavgFile, uptimeFile
+			loadavgFile, uptimeFile = filepath.Join(dir, "loadavg"), filepath.Join(dir, "uptime")
+			t.Cleanup(func() { loadavgFile, uptimeFile = originalLoadavgFile, originalUptimeFile })
+
+			os.WriteFile(loadavgFile, []byte(tt.loadavg), 0644)
+			os.WriteFile(uptimeFile, []byte(tt.uptime), 0644)
+
+			agent := &LinuxAgent{}
+			gotStatus, err := agent.GetStatus(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LinuxAgent.GetStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotStatus, tt.wantStatus) {
+				t.Errorf("LinuxAgent.GetStatus() = %v, want %v", gotStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func setupProjidFile(t *testing.T, content string) string {
+	projidFile := filepath.Join(t.TempDir(), "projid")
+	if content != "" {
+		if err := os.WriteFile(projidFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	original := common.Config.Agent.ProjidFile
+	common.Config.Agent.ProjidFile = projidFile
+	t.Cleanup(func() {
+		common.Config.Agent.ProjidFile = original
+	})
+
+	return projidFile
+}
+
+func TestLinuxAgent_SetDirectoryQuota(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+	if err := os.Mkdir(dirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		projid        string
+		lsattr        string
+		quota         common.DirectoryQuota
+		wantProjectID string
+		wantSetquota  []string
+		wantProjid    string
+		wantErr       bool
+	}{
+		{
+			name:          "test_set_directory_quota",
+			lsattr:        "0 ---------------------- " + dirPath,
+			quota:         common.DirectoryQuota{SoftLimitBytes: 1 << 20, HardLimitBytes: 2<<20 + 1, HardLimitFiles: 1000},
+			wantProjectID: "3000000",
+			wantSetquota:  []string{"1024", "2049", "0", "1000"},
+			wantProjid:    "dme-3000000:3000000\n",
+		},
+		{
+			name:          "test_set_directory_quota_skip_registered_id",
+			projid:        "web:3000000\n# reserved\ndme-3000001:3000002",
+			lsattr:        "0 ---------------------- " + dirPath,
+			quota:         common.DirectoryQuota{HardLimitFiles: 1000},
+			wantProjectID: "3000003",
+			wantSetquota:  []string{"0", "0", "0", "1000"},
+			wantProjid:    "web:3000000\n# reserved\ndme-3000001:3000002\ndme-3000003:3000003\n",
+		},
+		{
+			name:          "test_set_directory_quota_keep_project",
+			projid:        "dme-3000005:3000005\n",
+			lsattr:        "3000005 ---------------P------ " + dirPath,
+			quota:         common.DirectoryQuota{HardLimitFiles: 1000},
+			wantProjectID: "3000005",
+			wantSetquota:  []string{"0", "0", "0", "1000"},
+			wantProjid:    "dme-3000005:3000005\n",
+		},
+		{
+			name:          "test_set_directory_quota_project_of_administrator",
+			projid:        "web:42\n",
+			lsattr:        "42 ---------------P------ " + dirPath,
+			quota:         common.DirectoryQuota{HardLimitFiles: 1000},
+			wantProjectID: "3000000",
+			wantSetquota:  []string{"0", "0", "0", "1000"},
+			wantProjid:    "web:42\ndme-3000000:3000000\n",
+		},
+		{
+			name:    "test_set_directory_quota_soft_exceeds_hard",
+			quota:   common.DirectoryQuota{SoftLimitFiles: 2000, HardLimitFiles: 1000},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projidFile := setupProjidFile(t, tt.projid)
+
+			runner := NewFakeCommandRunner().ExpectStdout(tt.lsattr, "lsattr").ExpectStdout("", "chattr").ExpectStdout("", "setquota")
+			agent := &LinuxAgent{Runner: runner}
+
+			err := agent.SetDirectoryQuota(context.Background(), testDirectoryName, tt.quota)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LinuxAgent.SetDirectoryQuota() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			commands := runner.Commands()
+			if tt.wantErr {
+				if len(commands) != 0 {
+					t.Errorf("LinuxAgent.SetDirectoryQuota() runs %d commands, want 0", len(commands))
+				}
+				return
+			}
+			if len(commands) != 3 {
+				t.Fatalf("LinuxAgent.SetDirectoryQuota() runs %d commands, want 3", len(commands))
+			}
+
+			// The project ID given to chattr is the one limited by setquota.
+			if got := commands[1].Args[3]; got != tt.wantProjectID {
+				t.Errorf("LinuxAgent.SetDirectoryQuota() sets the project %s, want %s", got, tt.wantProjectID)
+			}
+			if got := commands[2].Args[1]; got != tt.wantProjectID {
+				t.Errorf("LinuxAgent.SetDirectoryQuota() limits the project %s, want %s", got, tt.wantProjectID)
+			}
+			if got := commands[2].Args[2:6]; !reflect.DeepEqual(got, tt.wantSetquota) {
+				t.Errorf("LinuxAgent.SetDirectoryQuota() limits = %v, want %v", got, tt.wantSetquota)
+			}
+
+			if content, _ := os.ReadFile(projidFile); string(content) != tt.wantProjid {
+				t.Errorf("LinuxAgent.SetDirectoryQuota() registers %q, want %q", content, tt.wantProjid)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_ClearDirectoryQuota(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+	if err := os.Mkdir(dirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	setupProjidFile(t, "web:42\ndme-3000000:3000000\n")
+
+	tests := []struct {
+		name         string
+		lsattr       string
+		wantSetquota bool
+	}{
+		{name: "test_clear_directory_quota", lsattr: "3000000 ---------------P------ " + dirPath, wantSetquota: true},
+		{name: "test_clear_directory_quota_no_project", lsattr: "0 ---------------------- " + dirPath},
+		{name: "test_clear_directory_quota_project_of_administrator", lsattr: "42 ---------------P------ " + dirPath},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeCommandRunner().ExpectStdout(tt.lsattr, "lsattr").ExpectStdout("", "setquota")
+			agent := &LinuxAgent{Runner: runner}
+
+			if err := agent.ClearDirectoryQuota(context.Background(), testDirectoryName); err != nil {
+				t.Fatalf("LinuxAgent.ClearDirectoryQuota() error = %v", err)
+			}
+
+			commands := runner.Commands()
+			if got := commands[len(commands)-1].Name == "setquota"; got != tt.wantSetquota {
+				t.Errorf("LinuxAgent.ClearDirectoryQuota() runs %v, want setquota %v", commands, tt.wantSetquota)
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_DeleteDirectory_releaseQuotaProject(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	setupLinuxSnapshotFolder(t)
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+	if err := os.Mkdir(dirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	projidFile := setupProjidFile(t, "web:42\ndme-3000000:3000000\n")
+
+	runner := NewFakeCommandRunner().ExpectStdout("3000000 ---------------P------ "+dirPath, "lsattr").ExpectStdout("", "setquota")
+	agent := &LinuxAgent{Runner: runner}
+
+	if err := agent.DeleteDirectory(context.Background(), testDirectoryName); err != nil {
+		t.Fatalf("LinuxAgent.DeleteDirectory() error = %v", err)
+	}
+
+	commands := runner.Commands()
+	if len(commands) != 2 || commands[1].Name != "setquota" || commands[1].Args[1] != "3000000" {
+		t.Errorf("LinuxAgent.DeleteDirectory() runs %v, want the limits of the project 3000000 removed", commands)
+	}
+	if content, _ := os.ReadFile(projidFile); string(content) != "web:42\n" {
+		t.Errorf("LinuxAgent.DeleteDirectory() leaves %q in the projid file, want %q", content, "web:42\n")
+	}
+}
+
+func Test_parseProjectQuota(t *testing.T) {
+	output := `Disk quotas for project #1234 (gid 1234):
+     Filesystem   blocks   quota   limit   grace   files   quota   limit   grace
+           /srv    2048*    1024    4096  1700000000     12       0    1000       0
+       /srv/dme      100       0       0       0       3       0       0       0
+`
+
+	tests := []struct {
+		name       string
+		mountPoint string
+		wantQuota  common.DirectoryQuota
+		wantErr    bool
+	}{
+		{
+			name:       "test_parse_project_quota",
+			mountPoint: "/srv",
+			wantQuota: common.DirectoryQuota{
+				SoftLimitBytes: 1024 * 1024,
+				HardLimitBytes: 4096 * 1024,
+				HardLimitFiles: 1000,
+				UsedBytes:      2048 * 1024,
+				UsedFiles:      12,
+			},
+		},
+		{
+			name:       "test_parse_project_quota_missing_mount_point",
+			mountPoint: "/data",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuota, err := parseProjectQuota([]byte(output), tt.mountPoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProjectQuota() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotQuota, tt.wantQuota) {
+				t.Errorf("parseProjectQuota() = %v, want %v", gotQuota, tt.wantQuota)
+			}
+		})
+	}
+}
+
+const testGetfaclOutput = `# file: /srv/dme/test_directory
+# owner: alice
+# group: staff
+user::rwx
+user:bob:r-x
+group::r-x
+group:dev:rwx	#effective:r-x
+mask::r-x
+other::---
+default:user::rwx
+default:user:bob:r-x
+default:user:carol:-wx
+default:group::r-x
+default:mask::rwx
+default:other::---
+`
+
+func Test_parsePOSIXACL(t *testing.T) {
+	acl, err := parsePOSIXACL([]byte(testGetfaclOutput))
+	if err != nil {
+		t.Fatalf("parsePOSIXACL() error = %v", err)
+	}
+
+	wantACL := common.DirectoryACL{
+		Owner: "alice",
+		Group: "staff",
+		Entries: []common.ACLEntry{
+			{Principal: "alice", PrincipalType: "user", Type: "allow", Permission: "full", Inherit: true},
+			{Principal: "bob", PrincipalType: "user", Type: "allow", Permission: "read", Inherit: true},
+			{Principal: "staff", PrincipalType: "group", Type: "allow", Permission: "read", Inherit: true},
+			{Principal: "dev", PrincipalType: "group", Type: "allow", Permission: "modify"},
+			{Principal: "carol", PrincipalType: "user", Type: "allow", Permission: "write", Inherit: true, InheritOnly: true},
+		},
+	}
+	if !reflect.DeepEqual(acl, wantACL) {
+		t.Errorf("parsePOSIXACL() = %+v, want %+v", acl, wantACL)
+	}
+
+	// The ACL set by the parsed one is the same.
+	spec, err := formatPOSIXACL(acl)
+	if err != nil {
+		t.Fatalf("formatPOSIXACL() error = %v", err)
+	}
+	wantSpec := "u::rwx,g::r-x,o::---,u:bob:r-x,g:dev:rwx,d:u::rwx,d:u:bob:r-x,d:g::r-x,d:u:carol:-wx"
+	if spec != wantSpec {
+		t.Errorf("formatPOSIXACL() = %s, want %s", spec, wantSpec)
+	}
+}
+
+func TestLinuxAgent_SetDirectoryACL(t *testing.T) {
+	setLinuxRootFolder(t, "/srv/dme")
+	dirPath := "/srv/dme/" + testDirectoryName
+
+	tests := []struct {
+		name         string
+		acl          common.DirectoryACL
+		wantCommands []string
+		wantErr      bool
+	}{
+		{
+			name: "test_set_directory_acl",
+			acl: common.DirectoryACL{
+				Entries: []common.ACLEntry{
+					{Principal: "alice", PrincipalType: "user", Type: "allow", Permission: "full"},
+					{PrincipalType: "everyone", Type: "allow", Permission: "read", Inherit: true},
+				},
+			},
+			wantCommands: []string{
+				"getfacl --absolute-names " + dirPath,
+				"setfacl --set u::rwx,g::---,o::r-x,d:o::r-x " + dirPath,
+			},
+		},
+		{
+			name: "test_set_directory_acl_with_owner",
+			acl: common.DirectoryACL{
+				Owner: "bob",
+				Group: "dev",
+				Entries: []common.ACLEntry{
+					{Principal: "dev", PrincipalType: "group", Type: "allow", Permission: "modify"},
+				},
+			},
+			wantCommands: []string{
+				"getfacl --absolute-names " + dirPath,
+				"chown bob:dev " + dirPath,
+				"setfacl --set u::---,g::rwx,o::--- " + dirPath,
+			},
+		},
+		{
+			name: "test_set_directory_acl_with_deny",
+			acl: common.DirectoryACL{
+				Entries: []common.ACLEntry{
+					{Principal: "bob", PrincipalType: "user", Type: "deny", Permission: "write"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := NewFakeCommandRunner().
+				ExpectStdout(testGetfaclOutput, "getfacl").
+				ExpectStdout("", "chown").
+				ExpectStdout("", "setfacl")
+			agent := &LinuxAgent{Runner: runner}
+
+			err := agent.SetDirectoryACL(context.Background(), testDirectoryName, tt.acl)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LinuxAgent.SetDirectoryACL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotCommands []string
+			for _, command := range runner.Commands() {
+				gotCommands = append(gotCommands, command.String())
+			}
+			if !reflect.DeepEqual(gotCommands, tt.wantCommands) {
+				t.Errorf("LinuxAgent.SetDirectoryACL() runs %v, want %v", gotCommands, tt.wantCommands)
+			}
+		})
+	}
+}
+
+func setupLinuxSnapshotFolder(t *testing.T) string {
+	snapshotFolder := t.TempDir()
+
+	original := common.Config.Agent.LinuxSnapshotFolder
+	common.Config.Agent.LinuxSnapshotFolder = snapshotFolder
+	t.Cleanup(func() {
+		common.Config.Agent.LinuxSnapshotFolder = original
+	})
+
+	return snapshotFolder
+}
+
+func TestLinuxAgent_CreateSnapshot(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	if err := os.Mkdir(filepath.Join(rootFolder, testDirectoryName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+
+	tests := []struct {
+		name       string
+		runner     *FakeCommandRunner
+		wantMethod string
+		wantLast   string
+	}{
+		{
+			name: "test_create_snapshot_btrfs_subvolume",
+			runner: NewFakeCommandRunner().
+				ExpectStdout("btrfs\n", "stat", "--file-system").
+				ExpectStdout("256\n", "stat", "--format=%i").
+				ExpectStdout("", "btrfs", "subvolume", "snapshot"),
+			wantMethod: common.SnapshotMethodBtrfs,
+			wantLast:   "btrfs subvolume snapshot -r " + dirPath,
+		},
+		{
+			name: "test_create_snapshot_btrfs_not_subvolume",
+			runner: NewFakeCommandRunner().
+				ExpectStdout("btrfs\n", "stat", "--file-system").
+				ExpectStdout("1234\n", "stat", "--format=%i").
+				ExpectStdout("", "cp", "-a", "--reflink=always"),
+			wantMethod: common.SnapshotMethodReflink,
+			wantLast:   "cp -a --reflink=always " + dirPath,
+		},
+		{
+			name: "test_create_snapshot_reflink",
+			runner: NewFakeCommandRunner().
+				ExpectStdout("xfs\n", "stat", "--file-system").
+				ExpectStdout("", "cp", "-a", "--reflink=always"),
+			wantMethod: common.SnapshotMethodReflink,
+			wantLast:   "cp -a --reflink=always " + dirPath,
+		},
+		{
+			name: "test_create_snapshot_plain_copy",
+			runner: NewFakeCommandRunner().
+				ExpectStdout("ext2/ext3\n", "stat", "--file-system").
+				ExpectStdout("", "cp", "-a").
+				Expect(CommandResult{ExitCode: 1, Stderr: []byte("failed to clone: Operation not supported")}, "cp", "-a", "--reflink=always"),
+			wantMethod: common.SnapshotMethodCopy,
+			wantLast:   "cp -a " + dirPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshotFolder := setupLinuxSnapshotFolder(t)
+			agent := &LinuxAgent{Runner: tt.runner}
+
+			detail, err := agent.CreateSnapshot(context.Background(), testDirectoryName, "daily-1")
+			if err != nil {
+				t.Fatalf("LinuxAgent.CreateSnapshot() error = %v", err)
+			}
+			if detail.Method != tt.wantMethod || detail.Name != "daily-1" || detail.DirectoryName != testDirectoryName {
+				t.Errorf("LinuxAgent.CreateSnapshot() = %+v, want the snapshot daily-1 by %s", detail, tt.wantMethod)
+			}
+
+			commands := tt.runner.Commands()
+			snapshotPath := filepath.Join(snapshotFolder, testDirectoryName, "daily-1")
+			if got := commands[len(commands)-1].String(); got != tt.wantLast+" "+snapshotPath {
+				t.Errorf("LinuxAgent.CreateSnapshot() runs %q, want %q", got, tt.wantLast+" "+snapshotPath)
+			}
+
+			snapshots, err := agent.ListSnapshots(context.Background(), testDirectoryName)
+			if err != nil {
+				t.Fatalf("LinuxAgent.ListSnapshots() error = %v", err)
+			}
+			if len(snapshots) != 1 || snapshots[0].Name != "daily-1" || snapshots[0].Method != tt.wantMethod {
+				t.Errorf("LinuxAgent.ListSnapshots() = %+v, want the snapshot daily-1", snapshots)
+			}
+
+			if _, err = agent.CreateSnapshot(context.Background(), testDirectoryName, "daily-1"); err == nil {
+				t.Errorf("LinuxAgent.CreateSnapshot() replaces the existing snapshot without error")
+			}
+		})
+	}
+}
+
+func TestLinuxAgent_CreateSnapshot_invalid(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	setupLinuxSnapshotFolder(t)
+	if err := os.Mkdir(filepath.Join(rootFolder, testDirectoryName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewFakeCommandRunner()
+	agent := &LinuxAgent{Runner: runner}
+
+	for _, name := range []string{"", ".hidden", "../escape", `a\b`} {
+		if _, err := agent.CreateSnapshot(context.Background(), testDirectoryName, name); err == nil {
+			t.Errorf("LinuxAgent.CreateSnapshot(%q) error = nil, want the invalid name", name)
+		}
+	}
+
+	if _, err := agent.CreateSnapshot(context.Background(), "missing", "daily-1"); err == nil {
+		t.Errorf("LinuxAgent.CreateSnapshot() of the missing directory error = nil")
+	}
+
+	if commands := runner.Commands(); len(commands) != 0 {
+		t.Errorf("LinuxAgent.CreateSnapshot() runs %d commands, want 0", len(commands))
+	}
+}
+
+func TestLinuxAgent_DeleteSnapshot(t *testing.T) {
+	setupLinuxRootFolder(t)
+	snapshotFolder := setupLinuxSnapshotFolder(t)
+
+	// The snapshots are written as taken by the methods, the copies have a file in them.
+	folder := filepath.Join(snapshotFolder, testDirectoryName)
+	for _, snapshot := range []common.SnapshotDetail{
+		{Name: "copied", DirectoryName: testDirectoryName, Method: common.SnapshotMethodCopy},
+		{Name: "subvolume", DirectoryName: testDirectoryName, Method: common.SnapshotMethodBtrfs},
+	} {
+		if err := os.MkdirAll(filepath.Join(folder, snapshot.Name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(folder, snapshot.Name, "file.txt"), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeSnapshotMetadata(filepath.Join(folder, snapshot.Name+".json"), snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runner := NewFakeCommandRunner().ExpectStdout("", "btrfs", "subvolume", "delete")
+	agent := &LinuxAgent{Runner: runner}
+
+	if err := agent.DeleteSnapshot(context.Background(), testDirectoryName, "copied"); err != nil {
+		t.Fatalf("LinuxAgent.DeleteSnapshot() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(folder, "copied")); !os.IsNotExist(err) {
+		t.Errorf("LinuxAgent.DeleteSnapshot() does not remove the copy")
+	}
+	if len(runner.Commands()) != 0 {
+		t.Errorf("LinuxAgent.DeleteSnapshot() runs %v, want no command for the copy", runner.Commands())
+	}
+
+	if err := agent.DeleteSnapshot(context.Background(), testDirectoryName, "subvolume"); err != nil {
+		t.Fatalf("LinuxAgent.DeleteSnapshot() error = %v", err)
+	}
+	want := "btrfs subvolume delete " + filepath.Join(folder, "subvolume")
+	if commands := runner.Commands(); len(commands) != 1 || commands[0].String() != want {
+		t.Errorf("LinuxAgent.DeleteSnapshot() runs %v, want %q", commands, want)
+	}
+
+	// No snapshot is listed once its metadata is removed, though the fake btrfs leaves the subvolume.
+	if snapshots, err := agent.ListSnapshots(context.Background(), testDirectoryName); err != nil || len(snapshots) != 0 {
+		t.Errorf("LinuxAgent.ListSnapshots() = %v, %v, want no snapshots", snapshots, err)
+	}
+
+	if err := agent.DeleteSnapshot(context.Background(), testDirectoryName, "copied"); err == nil {
+		t.Errorf("LinuxAgent.DeleteSnapshot() of the deleted snapshot error = nil")
+	}
+}
+
+// copyCommandRunner runs cp indeed, the other commands are faked.
+type copyCommandRunner struct {
+	*FakeCommandRunner
+}
+
+func (r *copyCommandRunner) Run(ctx context.Context, stdin string, name string, args ...string) (CommandResult, error) {
+	if name == "cp" {
+		return (&ExecCommandRunner{}).Run(ctx, stdin, name, args...)
+	}
+
+	return r.FakeCommandRunner.Run(ctx, stdin, name, args...)
+}
+
+func TestLinuxAgent_RestoreSnapshot(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	snapshotFolder := setupLinuxSnapshotFolder(t)
+
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+	if err := os.MkdirAll(filepath.Join(dirPath, "created", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirPath, "changed.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewFakeCommandRunner().ExpectStdout("xfs\n", "stat").ExpectStdout("", "cp")
+	agent := &LinuxAgent{Runner: runner}
+
+	if _, err := agent.CreateSnapshot(context.Background(), testDirectoryName, "daily-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := agent.RestoreSnapshot(context.Background(), testDirectoryName, "missing"); err == nil {
+		t.Errorf("LinuxAgent.RestoreSnapshot() of the missing snapshot error = nil")
+	}
+	if entries, _ := os.ReadDir(dirPath); len(entries) != 2 {
+		t.Fatalf("LinuxAgent.RestoreSnapshot() of the missing snapshot changes the directory")
+	}
+
+	snapshotPath := filepath.Join(snapshotFolder, testDirectoryName, "daily-1")
+	if err := os.MkdirAll(snapshotPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(snapshotPath, "changed.txt"), []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The content of the directory is kept if the snapshot fails to be copied.
+	runner.Reset()
+	runner.Expect(CommandResult{ExitCode: 1}, "cp")
+	if err := agent.RestoreSnapshot(context.Background(), testDirectoryName, "daily-1"); err == nil {
+		t.Errorf("LinuxAgent.RestoreSnapshot() with the failed copy error = nil")
+	}
+	if entries, _ := os.ReadDir(dirPath); len(entries) != 2 {
+		t.Errorf("LinuxAgent.RestoreSnapshot() with the failed copy changes the directory")
+	}
+	want := "cp -a --reflink=auto " + snapshotPath + " "
+	if commands := runner.Commands(); len(commands) != 1 || !strings.HasPrefix(commands[0].String(), want) {
+		t.Errorf("LinuxAgent.RestoreSnapshot() runs %v, want %q", commands, want)
+	}
+
+	// The copy gets the project of the quota of the directory, and the directory is moved back if the copy is missing.
+	setupProjidFile(t, "dme-3000000:3000000\n")
+	runner.Reset()
+	runner.ExpectStdout("", "cp").ExpectStdout("3000000 ---------------P------ "+dirPath, "lsattr").ExpectStdout("", "chattr")
+	if err := agent.RestoreSnapshot(context.Background(), testDirectoryName, "daily-1"); err == nil {
+		t.Errorf("LinuxAgent.RestoreSnapshot() without the copy error = nil")
+	}
+	if entries, _ := os.ReadDir(dirPath); len(entries) != 2 {
+		t.Errorf("LinuxAgent.RestoreSnapshot() without the copy changes the directory")
+	}
+	if commands := runner.Commands(); len(commands) != 3 || commands[2].Name != "chattr" || commands[2].Args[3] != "3000000" {
+		t.Errorf("LinuxAgent.RestoreSnapshot() runs %v, want the project 3000000 set on the copy", commands)
+	}
+
+	// The snapshot is copied by cp indeed, and swapped in for the content of the directory, which is exported again.
+	setupNFSExportsFile(t, dirPath+" 192.168.0.0/24(rw)\n")
+	runner.Reset()
+	runner.ExpectStdout("", "exportfs", "-ra")
+	agent.Runner = &copyCommandRunner{FakeCommandRunner: runner}
+	if err := agent.RestoreSnapshot(context.Background(), testDirectoryName, "daily-1"); err != nil {
+		t.Fatalf("LinuxAgent.RestoreSnapshot() error = %v", err)
+	}
+	if commands := runner.Commands(); len(commands) == 0 || commands[len(commands)-1].String() != "exportfs -ra" {
+		t.Errorf("LinuxAgent.RestoreSnapshot() runs %v, want the exports reloaded", commands)
+	}
+	if content, err := os.ReadFile(filepath.Join(dirPath, "changed.txt")); err != nil || string(content) != "original" {
+		t.Errorf("LinuxAgent.RestoreSnapshot() restores %q, error = %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(dirPath, "created")); !os.IsNotExist(err) {
+		t.Errorf("LinuxAgent.RestoreSnapshot() keeps the content created after the snapshot")
+	}
+
+	// No staging folder is left in the root folder.
+	if entries, err := os.ReadDir(rootFolder); err != nil || len(entries) != 1 {
+		t.Errorf("LinuxAgent.RestoreSnapshot() leaves %d entries in the root folder, error = %v", len(entries), err)
+	}
+}
@@ -0,0 +1,278 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The options written for the exports created by the agent, besides rw/ro and root_squash/no_root_squash.
+var nfsDefaultOptions = []string{"sync", "no_subtree_check"}
+
+type nfsExportClient struct {
+	Host    string
+	Options []string
+}
+
+type nfsExport struct {
+	Path string
+	// The default options given by "-option" before the clients.
+	DefaultOptions []string
+	Clients        []nfsExportClient
+}
+
+// nfsExportsLine is a logical line in exports, the continued lines are joined.
+type nfsExportsLine struct {
+	// The original text, which is written back as is unless the export is changed.
+	Raw    string
+	Export *nfsExport
+}
+
+type nfsExportsFile struct {
+	Lines []*nfsExportsLine
+}
+
+func loadNFSExportsFile(path string) (*nfsExportsFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &nfsExportsFile{}, nil
+		}
+		return nil, err
+	}
+
+	return parseNFSExportsFile(content)
+}
+
+func parseNFSExportsFile(content []byte) (*nfsExportsFile, error) {
+	file := &nfsExportsFile{}
+
+	var raw []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		raw = append(raw, line)
+
+		// A backslash at the end of line continues the export on the next line.
+		if strings.HasSuffix(line, "\\") {
+			continue
+		}
+
+		if err := file.appendLine(raw); err != nil {
+			return nil, err
+		}
+		raw = nil
+	}
+
+	if len(raw) > 0 {
+		if err := file.appendLine(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+func (f *nfsExportsFile) appendLine(raw []string) error {
+	joined := make([]string, len(raw))
+	for i, line := range raw {
+		joined[i] = strings.TrimSuffix(line, "\\")
+	}
+
+	text := strings.TrimSpace(strings.Join(joined, " "))
+	if index := strings.Index(text, "#"); index >= 0 {
+		text = strings.TrimSpace(text[:index])
+	}
+
+	line := &nfsExportsLine{Raw: strings.Join(raw, "\n")}
+	if text != "" {
+		export, err := parseNFSExport(text)
+		if err != nil {
+			return err
+		}
+		line.Export = export
+	}
+
+	f.Lines = append(f.Lines, line)
+
+	return nil
+}
+
+// parseNFSExport parses the export like `/srv/dme/data 192.168.0.0/24(rw,sync) *(ro)`.
+func parseNFSExport(text string) (*nfsExport, error) {
+	export := &nfsExport{}
+
+	// The path may be quoted if it contains spaces.
+	if strings.HasPrefix(text, `"`) {
+		end := strings.Index(text[1:], `"`)
+		if end < 0 {
+			return nil, fmt.Errorf("invalid export %q: unterminated quote", text)
+		}
+		export.Path = text[1 : end+1]
+		text = text[end+2:]
+	} else {
+		export.Path = text
+		text = ""
+		if index := strings.IndexAny(export.Path, " \t"); index >= 0 {
+			export.Path, text = export.Path[:index], export.Path[index:]
+		}
+	}
+
+	for _, field := range strings.Fields(text) {
+		if strings.HasPrefix(field, "-") {
+			export.DefaultOptions = append(export.DefaultOptions, strings.Split(field[1:], ",")...)
+			continue
+		}
+
+		host, options, hasOptions := strings.Cut(field, "(")
+		client := nfsExportClient{Host: host}
+		if hasOptions {
+			if !strings.HasSuffix(options, ")") {
+				return nil, fmt.Errorf("invalid export %q: unterminated options of client %s", text, host)
+			}
+			client.Options = strings.Split(strings.TrimSuffix(options, ")"), ",")
+		}
+		// A client without host exports to the world.
+		if client.Host == "" {
+			client.Host = "*"
+		}
+
+		export.Clients = append(export.Clients, client)
+	}
+
+	return export, nil
+}
+
+// Export returns the export of the path, or nil if the path is not exported.
+func (f *nfsExportsFile) Export(path string) *nfsExport {
+	for _, line := range f.Lines {
+		if line.Export != nil && line.Export.Path == path {
+			return line.Export
+		}
+	}
+
+	return nil
+}
+
+func (f *nfsExportsFile) Exports() []*nfsExport {
+	var exports []*nfsExport
+	for _, line := range f.Lines {
+		if line.Export != nil {
+			exports = append(exports, line.Export)
+		}
+	}
+
+	return exports
+}
+
+func (f *nfsExportsFile) AddExport(export *nfsExport) error {
+	if f.Export(export.Path) != nil {
+		return fmt.Errorf("the path %s is already exported", export.Path)
+	}
+
+	f.Lines = append(f.Lines, &nfsExportsLine{Raw: export.String(), Export: export})
+
+	return nil
+}
+
+func (f *nfsExportsFile) RemoveExport(path string) error {
+	for i, line := range f.Lines {
+		if line.Export != nil && line.Export.Path == path {
+			f.Lines = append(f.Lines[:i], f.Lines[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the path %s is not exported", path)
+}
+
+func (f *nfsExportsFile) Bytes() []byte {
+	var buffer bytes.Buffer
+
+	for _, line := range f.Lines {
+		buffer.WriteString(line.Raw + "\n")
+	}
+
+	return buffer.Bytes()
+}
+
+func (f *nfsExportsFile) Save(path string) error {
+	return writeFileAtomically(path, f.Bytes(), 0644)
+}
+
+func (e *nfsExport) String() string {
+	path := e.Path
+	if strings.ContainsAny(path, " \t") {
+		path = strconv.Quote(path)
+	}
+
+	fields := []string{path}
+	if len(e.DefaultOptions) > 0 {
+		fields = append(fields, "-"+strings.Join(e.DefaultOptions, ","))
+	}
+	for _, client := range e.Clients {
+		fields = append(fields, fmt.Sprintf("%s(%s)", client.Host, strings.Join(client.Options, ",")))
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// ToNFSClients converts the options of the clients to common.NFSClient, the defaults of exports(5) are ro and root_squash.
+func (e *nfsExport) ToNFSClients() []common.NFSClient {
+	clients := make([]common.NFSClient, 0, len(e.Clients))
+
+	for _, client := range e.Clients {
+		nfsClient := common.NFSClient{Host: client.Host, Access: "ro", RootSquash: true}
+
+		// The options of the client override the default options.
+		for _, option := range append(append([]string{}, e.DefaultOptions...), client.Options...) {
+			switch strings.TrimSpace(option) {
+			case "rw":
+				nfsClient.Access = "rw"
+			case "ro":
+				nfsClient.Access = "ro"
+			case "root_squash":
+				nfsClient.RootSquash = true
+			case "no_root_squash":
+				nfsClient.RootSquash = false
+			}
+		}
+
+		clients = append(clients, nfsClient)
+	}
+
+	return clients
+}
+
+func newNFSExport(path string, clients []common.NFSClient) (*nfsExport, error) {
+	if len(clients) == 0 {
+		return nil, fmt.Errorf("no client is specified for the export of %s", path)
+	}
+
+	export := &nfsExport{Path: path}
+
+	for _, client := range clients {
+		if err := common.ValidateNFSClientHost(client.Host); err != nil {
+			return nil, err
+		}
+
+		if client.Access != "rw" && client.Access != "ro" {
+			return nil, fmt.Errorf("invalid access %q of NFS client %s, it should be rw or ro", client.Access, client.Host)
+		}
+
+		squash := "root_squash"
+		if !client.RootSquash {
+			squash = "no_root_squash"
+		}
+
+		options := append([]string{client.Access}, nfsDefaultOptions...)
+		export.Clients = append(export.Clients, nfsExportClient{Host: client.Host, Options: append(options, squash)})
+	}
+
+	return export, nil
+}
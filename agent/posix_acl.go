@@ -0,0 +1,193 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+var errPOSIXDenyNotSupported = errors.New("the deny entries are not supported by the POSIX ACLs")
+
+// The permissions set for the normalized ones. The execute bit is set with the read and the write ones, since the
+// directory cannot be entered without it.
+var posixPermissions = map[string]string{
+	common.ACLPermissionRead:   "r-x",
+	common.ACLPermissionWrite:  "-wx",
+	common.ACLPermissionModify: "rwx",
+	common.ACLPermissionFull:   "rwx",
+}
+
+// posixACLKey identifies the entry of a principal in the access ACL and the default ACL.
+type posixACLKey struct {
+	principalType string
+	principal     string
+}
+
+// parsePOSIXACL parses the output of getfacl. The entries without read or write permission are left out, and the
+// default entries are merged into the access entries of the same principal with the same permission.
+func parsePOSIXACL(output []byte) (acl common.DirectoryACL, err error) {
+	var defaultLines []string
+	indexes := make(map[posixACLKey]int)
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case strings.HasPrefix(line, "# owner:"):
+			acl.Owner = strings.TrimSpace(strings.TrimPrefix(line, "# owner:"))
+			continue
+		case strings.HasPrefix(line, "# group:"):
+			acl.Group = strings.TrimSpace(strings.TrimPrefix(line, "# group:"))
+			continue
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "default:"):
+			defaultLines = append(defaultLines, strings.TrimPrefix(line, "default:"))
+			continue
+		}
+
+		entry, ok, err := parsePOSIXACLEntry(line, acl)
+		if err != nil {
+			return acl, err
+		}
+		if !ok {
+			continue
+		}
+
+		indexes[posixACLKey{entry.PrincipalType, entry.Principal}] = len(acl.Entries)
+		acl.Entries = append(acl.Entries, entry)
+	}
+
+	for _, line := range defaultLines {
+		entry, ok, err := parsePOSIXACLEntry(line, acl)
+		if err != nil {
+			return acl, err
+		}
+		if !ok {
+			continue
+		}
+
+		entry.Inherit = true
+
+		index, exist := indexes[posixACLKey{entry.PrincipalType, entry.Principal}]
+		if exist && acl.Entries[index].Permission == entry.Permission {
+			acl.Entries[index].Inherit = true
+			continue
+		}
+
+		entry.InheritOnly = true
+		acl.Entries = append(acl.Entries, entry)
+	}
+
+	return acl, nil
+}
+
+// parsePOSIXACLEntry parses the entry such as "user:alice:rwx #effective:r-x", the mask entry and the entries without
+// read or write permission are not reported.
+func parsePOSIXACLEntry(line string, acl common.DirectoryACL) (entry common.ACLEntry, ok bool, err error) {
+	if index := strings.Index(line, "#"); index >= 0 {
+		line = strings.TrimSpace(line[:index])
+	}
+
+	fields := strings.Split(line, ":")
+	if len(fields) != 3 || len(fields[2]) != 3 {
+		return entry, false, fmt.Errorf("invalid ACL entry: %s", line)
+	}
+
+	tag, qualifier, perms := fields[0], fields[1], fields[2]
+
+	entry.Type = common.ACLTypeAllow
+
+	switch tag {
+	case "user":
+		entry.PrincipalType = common.PrincipalTypeUser
+		entry.Principal = qualifier
+		if qualifier == "" {
+			entry.Principal = acl.Owner
+		}
+	case "group":
+		entry.PrincipalType = common.PrincipalTypeGroup
+		entry.Principal = qualifier
+		if qualifier == "" {
+			entry.Principal = acl.Group
+		}
+	case "other":
+		entry.PrincipalType = common.PrincipalTypeEveryone
+	case "mask":
+		return entry, false, nil
+	default:
+		return entry, false, fmt.Errorf("invalid ACL entry: %s", line)
+	}
+
+	read, write := perms[0] == 'r', perms[1] == 'w'
+
+	switch {
+	case read && write && tag == "user" && qualifier == "":
+		// The owner may change the permissions as well.
+		entry.Permission = common.ACLPermissionFull
+	case read && write:
+		entry.Permission = common.ACLPermissionModify
+	case write:
+		entry.Permission = common.ACLPermissionWrite
+	case read:
+		entry.Permission = common.ACLPermissionRead
+	default:
+		return entry, false, nil
+	}
+
+	return entry, true, nil
+}
+
+// formatPOSIXACL returns the ACL for "setfacl --set", which replaces the whole ACL of the directory. The owner, the
+// owning group and the others have no permission unless an entry is given for them.
+func formatPOSIXACL(acl common.DirectoryACL) (string, error) {
+	base := map[string]string{"u::": "---", "g::": "---", "o::": "---"}
+	var named, defaults []string
+
+	for _, entry := range acl.Entries {
+		if entry.Inherited {
+			continue
+		}
+
+		if entry.Type == common.ACLTypeDeny {
+			return "", errPOSIXDenyNotSupported
+		}
+
+		var tag string
+		switch {
+		case entry.PrincipalType == common.PrincipalTypeEveryone:
+			tag = "o::"
+		case entry.PrincipalType == common.PrincipalTypeUser && entry.Principal == acl.Owner:
+			tag = "u::"
+		case entry.PrincipalType == common.PrincipalTypeUser:
+			tag = "u:" + entry.Principal + ":"
+		case entry.PrincipalType == common.PrincipalTypeGroup && entry.Principal == acl.Group:
+			tag = "g::"
+		default:
+			tag = "g:" + entry.Principal + ":"
+		}
+
+		perms := posixPermissions[entry.Permission]
+
+		if !entry.InheritOnly {
+			if _, ok := base[tag]; ok {
+				base[tag] = perms
+			} else {
+				named = append(named, tag+perms)
+			}
+		}
+
+		if entry.Inherit {
+			defaults = append(defaults, "d:"+tag+perms)
+		}
+	}
+
+	spec := append([]string{"u::" + base["u::"], "g::" + base["g::"], "o::" + base["o::"]}, named...)
+
+	return strings.Join(append(spec, defaults...), ","), nil
+}
@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The project IDs of the directories with a quota are allocated from the range reserved for the agent, and registered
+// in the projid file by the names with the prefix, e.g. dme-3000000:3000000. The IDs out of the range or registered
+// by others belong to the administrator, so they are never used or released by the agent.
+const (
+	quotaProjectIDMin  = 3000000
+	quotaProjectIDMax  = 3999999
+	quotaProjectPrefix = "dme-"
+
+	defaultProjidFile = "/etc/projid"
+)
+
+// projidMu serializes the allocations and the releases, so the same ID is not allocated twice.
+var projidMu sync.Mutex
+
+func getProjidFile() string {
+	if file := common.Config.Agent.ProjidFile; file != "" {
+		return file
+	}
+
+	return defaultProjidFile
+}
+
+func getQuotaProjectName(id uint32) string {
+	return quotaProjectPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// readProjid returns the content of the projid file with the names of the projects by their IDs, there is no project
+// if the file does not exist.
+func readProjid(path string) (content []byte, projects map[uint32]string, err error) {
+	content, err = os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	projects = make(map[uint32]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, idText, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		id, err := strconv.ParseUint(strings.TrimSpace(idText), 10, 32)
+		if err != nil {
+			continue
+		}
+
+		projects[uint32(id)] = name
+	}
+
+	return content, projects, scanner.Err()
+}
+
+// isAgentQuotaProject reports whether the project is allocated by the agent.
+func isAgentQuotaProject(projects map[uint32]string, id uint32) bool {
+	return id >= quotaProjectIDMin && id <= quotaProjectIDMax && projects[id] == getQuotaProjectName(id)
+}
+
+// allocateQuotaProject registers the first ID in the reserved range which is not in the projid file.
+func allocateQuotaProject() (uint32, error) {
+	projidMu.Lock()
+	defer projidMu.Unlock()
+
+	path := getProjidFile()
+
+	content, projects, err := readProjid(path)
+	if err != nil {
+		return 0, err
+	}
+
+	names := make(map[string]bool, len(projects))
+	for _, name := range projects {
+		names[name] = true
+	}
+
+	for id := uint32(quotaProjectIDMin); id <= quotaProjectIDMax; id++ {
+		if _, exist := projects[id]; exist || names[getQuotaProjectName(id)] {
+			continue
+		}
+
+		if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+			content = append(content, '\n')
+		}
+		content = append(content, fmt.Sprintf("%s:%d\n", getQuotaProjectName(id), id)...)
+
+		if err = writeFileAtomically(path, content, 0644); err != nil {
+			return 0, err
+		}
+
+		return id, nil
+	}
+
+	return 0, fmt.Errorf("no project ID is free in the range from %d to %d", quotaProjectIDMin, quotaProjectIDMax)
+}
+
+// unregisterQuotaProject removes the project allocated by the agent from the projid file.
+func unregisterQuotaProject(id uint32) error {
+	projidMu.Lock()
+	defer projidMu.Unlock()
+
+	path := getProjidFile()
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	entry := fmt.Sprintf("%s:%d", getQuotaProjectName(id), id)
+
+	var buffer bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == entry {
+			continue
+		}
+
+		buffer.WriteString(scanner.Text())
+		buffer.WriteByte('\n')
+	}
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	return writeFileAtomically(path, buffer.Bytes(), 0644)
+}
+
+// getProjectID returns the project ID of the directory reported by "lsattr -d -p", e.g. "3000000 ---------P-- /srv/dme/data".
+func (agent *LinuxAgent) getProjectID(ctx context.Context, dirPath string) (uint32, error) {
+	output, err := agent.runCommand(ctx, "", "lsattr", "-d", "-p", dirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no project ID of %s is reported by lsattr", dirPath)
+	}
+
+	id, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid project ID of %s reported by lsattr: %s", dirPath, fields[0])
+	}
+
+	return uint32(id), nil
+}
@@ -0,0 +1,564 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/pki"
+)
+
+// The files replicated are transferred in the chunks of the size, and every chunk is checked by its checksum.
+const replicationChunkSize = 4 << 20
+
+// The time limit of a request to the source agent, the manifest of a large directory takes long to be hashed.
+const replicationRequestTimeout = 30 * time.Minute
+
+// The files being received are kept in the replication folder by their checksum with the suffix, so that the transfer
+// interrupted is resumed from the chunks received.
+const replicationPartialSuffix = ".partial"
+
+func getLinuxReplicationFolder() string {
+	if folder := common.Config.Agent.LinuxReplicationFolder; folder != "" {
+		return folder
+	}
+
+	return filepath.Clean(common.Config.Agent.LinuxRootFolder) + "-replication"
+}
+
+// fileHashCache keeps the checksums of the files with their size and modification time, so that the files not changed
+// since the last replication are not read again.
+type fileHashCache struct {
+	mu     sync.Mutex
+	hashes map[string]cachedFileHash
+}
+
+type cachedFileHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+var replicationHashes = fileHashCache{hashes: make(map[string]cachedFileHash)}
+
+func (c *fileHashCache) get(path string, info fs.FileInfo) (string, error) {
+	c.mu.Lock()
+	cached, exist := c.hashes[path]
+	c.mu.Unlock()
+
+	if exist && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	sum, err := hashFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.hashes[path] = cachedFileHash{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	c.mu.Unlock()
+
+	return sum, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// buildReplicationManifest lists the entries under the root in the lexical order, so every directory is listed before
+// its entries. The symbolic links are listed rather than followed, and the special files, e.g. sockets, are skipped.
+func buildReplicationManifest(ctx context.Context, root string) ([]common.ReplicationEntry, error) {
+	manifest := []common.ReplicationEntry{}
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		entry := common.ReplicationEntry{
+			Path:    filepath.ToSlash(relPath),
+			Mode:    uint32(info.Mode().Perm()),
+			ModTime: info.ModTime(),
+		}
+
+		switch {
+		case d.IsDir():
+			entry.Type = common.ReplicationEntryDirectory
+		case d.Type()&fs.ModeSymlink != 0:
+			entry.Type = common.ReplicationEntrySymlink
+			if entry.LinkTarget, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case d.Type().IsRegular():
+			entry.Type = common.ReplicationEntryFile
+			entry.Size = info.Size()
+			if entry.SHA256, err = replicationHashes.get(path, info); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		manifest = append(manifest, entry)
+
+		return nil
+	})
+
+	return manifest, err
+}
+
+// resolveReplicationPath returns the path of the entry under the root. The path must be relative and stay under the
+// root, and none of its parents may be a symbolic link, so that no entry is read or written out of the root.
+func resolveReplicationPath(root, path string) (string, error) {
+	cleanPath := filepath.Clean(filepath.FromSlash(path))
+	if path == "" || filepath.IsAbs(cleanPath) || filepath.ToSlash(cleanPath) != path || cleanPath == ".." ||
+		strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path of the replication: %s", path)
+	}
+
+	parent := root
+	parts := strings.Split(cleanPath, string(filepath.Separator))
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+
+		info, err := os.Lstat(parent)
+		if err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("the parent of the path of the replication is a symbolic link: %s", path)
+		} else if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return filepath.Join(root, cleanPath), nil
+}
+
+// readReplicationChunk reads the chunk of the regular file under the root, the chunk is shorter than the length at the
+// end of the file.
+func readReplicationChunk(root, path string, offset, length int64) ([]byte, error) {
+	if offset < 0 || length <= 0 || length > replicationChunkSize {
+		return nil, fmt.Errorf("invalid chunk of the replication: offset %d, length %d", offset, length)
+	}
+
+	filePath, err := resolveReplicationPath(root, path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("the path of the replication is not a regular file: %s", path)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	chunk := make([]byte, length)
+	n, err := file.ReadAt(chunk, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return chunk[:n], nil
+}
+
+// replicationPeer reads the directory replicated from the source agent by the token issued by it.
+type replicationPeer struct {
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+func newReplicationPeer(source common.ReplicationSource) (*replicationPeer, error) {
+	peer := &replicationPeer{
+		client: &http.Client{Timeout: replicationRequestTimeout},
+		token:  source.Token,
+	}
+
+	// The token and the content of the directory are sent over mutual TLS only, the source agent is pinned by the
+	// fingerprint of the certificate enrolled by the engine.
+	if source.Scheme != "https" {
+		return nil, fmt.Errorf("the directory is replicated over mutual TLS only, unsupported scheme of the replication source: %q", source.Scheme)
+	}
+
+	config := common.Config.Agent
+	tlsConfig, err := pki.PeerTLSConfig(config.CertFile, config.KeyFile, config.EngineCAFile, source.CertFingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	peer.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	peer.baseURL = "https://" + source.Address + "/replication"
+
+	return peer, nil
+}
+
+func (p *replicationPeer) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set(common.ReplicationTokenHeader, p.token)
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+
+		var result common.FailedRESTResponse
+		json.NewDecoder(response.Body).Decode(&result)
+
+		return nil, fmt.Errorf("failed to get the %s from the replication source: %s", path, result.Error)
+	}
+
+	return response, nil
+}
+
+func (p *replicationPeer) getManifest(ctx context.Context) (manifest []common.ReplicationEntry, err error) {
+	response, err := p.get(ctx, "manifest", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	err = json.NewDecoder(response.Body).Decode(&manifest)
+
+	return manifest, err
+}
+
+// getChunk returns the chunk of the file after it is checked by the checksum returned with it.
+func (p *replicationPeer) getChunk(ctx context.Context, path string, offset, length int64) ([]byte, error) {
+	query := url.Values{
+		"path":   {path},
+		"offset": {strconv.FormatInt(offset, 10)},
+		"length": {strconv.FormatInt(length, 10)},
+	}
+
+	response, err := p.get(ctx, "chunk", query)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	chunk, err := io.ReadAll(io.LimitReader(response.Body, length))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(chunk)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), response.Header.Get(common.ReplicationChunkHeader)) {
+		return nil, fmt.Errorf("the checksum of the chunk of %s at %d does not match", path, offset)
+	}
+
+	return chunk, nil
+}
+
+// replicationPuller mirrors the directory of the source agent into the root, the files are received into the staging
+// folder before they are moved into the root.
+type replicationPuller struct {
+	peer    *replicationPeer
+	root    string
+	staging string
+	result  common.ReplicationResult
+}
+
+// pullReplication makes the root the same as the directory of the source agent. Only the files changed are
+// transferred: a file of the same size and modification time is taken as unchanged, and so is a file of the same
+// checksum. The entries not in the source directory are deleted.
+func pullReplication(ctx context.Context, peer *replicationPeer, root, staging string) (common.ReplicationResult, error) {
+	puller := replicationPuller{peer: peer, root: root, staging: staging}
+
+	manifest, err := peer.getManifest(ctx)
+	if err != nil {
+		return puller.result, err
+	}
+
+	if err = os.MkdirAll(staging, 0700); err != nil {
+		return puller.result, err
+	}
+
+	kept := make(map[string]bool, len(manifest))
+	directories := []string{}
+	directoryTimes := []time.Time{}
+
+	for _, entry := range manifest {
+		if err = ctx.Err(); err != nil {
+			return puller.result, err
+		}
+
+		target, err := resolveReplicationPath(root, entry.Path)
+		if err != nil {
+			return puller.result, err
+		}
+		kept[target] = true
+
+		switch entry.Type {
+		case common.ReplicationEntryDirectory:
+			err = puller.pullDirectory(target, entry)
+			directories = append(directories, target)
+			directoryTimes = append(directoryTimes, entry.ModTime)
+		case common.ReplicationEntrySymlink:
+			err = puller.pullSymlink(target, entry)
+		case common.ReplicationEntryFile:
+			err = puller.pullFile(ctx, target, entry)
+		default:
+			err = fmt.Errorf("invalid type of the entry: %s", entry.Type)
+		}
+
+		if err != nil {
+			return puller.result, fmt.Errorf("failed to replicate %s: %w", entry.Path, err)
+		}
+	}
+
+	if err = puller.deleteExtraneous(kept); err != nil {
+		return puller.result, err
+	}
+
+	// The modification time of the directories is changed by the entries created in them, so it is set at last.
+	for i := len(directories) - 1; i >= 0; i-- {
+		if err = os.Chtimes(directories[i], directoryTimes[i], directoryTimes[i]); err != nil {
+			return puller.result, err
+		}
+	}
+
+	// The files left in the staging folder were changed on the source before their transfer was resumed.
+	return puller.result, os.RemoveAll(staging)
+}
+
+func (p *replicationPuller) pullDirectory(target string, entry common.ReplicationEntry) error {
+	if info, err := os.Lstat(target); err == nil && !info.IsDir() {
+		if err = os.Remove(target); err != nil {
+			return err
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.Mkdir(target, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	return os.Chmod(target, fs.FileMode(entry.Mode))
+}
+
+func (p *replicationPuller) pullSymlink(target string, entry common.ReplicationEntry) error {
+	if info, err := os.Lstat(target); err == nil {
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if linkTarget, err := os.Readlink(target); err == nil && linkTarget == entry.LinkTarget {
+				return nil
+			}
+		}
+
+		if err = os.RemoveAll(target); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(entry.LinkTarget, target)
+}
+
+func (p *replicationPuller) pullFile(ctx context.Context, target string, entry common.ReplicationEntry) error {
+	// The checksum names the file in the staging folder, so it must not be a path.
+	if !isSHA256Hex(entry.SHA256) {
+		return fmt.Errorf("invalid checksum of the file: %q", entry.SHA256)
+	}
+
+	if info, err := os.Lstat(target); err == nil && info.Mode().IsRegular() && info.Size() == entry.Size {
+		unchanged := info.ModTime().Equal(entry.ModTime)
+		if !unchanged {
+			sum, err := hashFile(target)
+			if err != nil {
+				return err
+			}
+			unchanged = sum == entry.SHA256
+		}
+
+		if unchanged {
+			p.result.FilesUnchanged++
+
+			if err = os.Chmod(target, fs.FileMode(entry.Mode)); err != nil {
+				return err
+			}
+
+			return os.Chtimes(target, entry.ModTime, entry.ModTime)
+		}
+	}
+
+	partialPath, err := p.receiveFile(ctx, entry)
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(target); err == nil && info.IsDir() {
+		if err = os.RemoveAll(target); err != nil {
+			return err
+		}
+	}
+
+	if err = os.Rename(partialPath, target); err != nil {
+		return err
+	}
+
+	p.result.FilesTransferred++
+
+	return nil
+}
+
+// isSHA256Hex reports whether the checksum is a SHA-256 in 64 lowercase hexadecimal digits, as hashFile returns.
+func isSHA256Hex(sum string) bool {
+	if len(sum) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+
+	for _, r := range sum {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// receiveFile receives the file into the staging folder chunk by chunk, and returns the path of the file received.
+// The file interrupted before is resumed from its last whole chunk.
+func (p *replicationPuller) receiveFile(ctx context.Context, entry common.ReplicationEntry) (string, error) {
+	partialPath := filepath.Join(p.staging, entry.SHA256+replicationPartialSuffix)
+
+	partial, err := os.OpenFile(partialPath, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer partial.Close()
+
+	info, err := partial.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	offset := info.Size() - info.Size()%replicationChunkSize
+	if offset > entry.Size {
+		offset = 0
+	}
+	if err = partial.Truncate(offset); err != nil {
+		return "", err
+	}
+	if offset > 0 {
+		p.result.FilesResumed++
+	}
+
+	for offset < entry.Size {
+		length := entry.Size - offset
+		if length > replicationChunkSize {
+			length = replicationChunkSize
+		}
+
+		chunk, err := p.peer.getChunk(ctx, entry.Path, offset, length)
+		if err != nil {
+			return "", err
+		}
+		if len(chunk) == 0 {
+			return "", errors.New("the file is truncated on the source during the transfer")
+		}
+
+		if _, err = partial.WriteAt(chunk, offset); err != nil {
+			return "", err
+		}
+
+		offset += int64(len(chunk))
+		p.result.BytesTransferred += int64(len(chunk))
+	}
+
+	if err = partial.Close(); err != nil {
+		return "", err
+	}
+
+	sum, err := hashFile(partialPath)
+	if err != nil {
+		return "", err
+	}
+	if sum != entry.SHA256 {
+		os.Remove(partialPath)
+		return "", errors.New("the checksum of the file received does not match, it is changed on the source during the transfer")
+	}
+
+	if err = os.Chmod(partialPath, fs.FileMode(entry.Mode)); err != nil {
+		return "", err
+	}
+
+	return partialPath, os.Chtimes(partialPath, entry.ModTime, entry.ModTime)
+}
+
+// deleteExtraneous deletes the entries under the root which are not kept, a directory is deleted with its entries.
+func (p *replicationPuller) deleteExtraneous(kept map[string]bool) error {
+	return filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == p.root || kept[path] {
+			return nil
+		}
+
+		if err = os.RemoveAll(path); err != nil {
+			return err
+		}
+		p.result.FilesDeleted++
+
+		if d.IsDir() {
+			return fs.SkipDir
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,322 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/pki"
+)
+
+const testReplicationToken = "replication-token"
+
+// setupReplicationTLS enrolls the source and the destination agents by a CA as the engine does, the destination is the
+// local agent. It returns the TLS configuration of the source agent and the fingerprint of its certificate.
+func setupReplicationTLS(t *testing.T) (*tls.Config, string) {
+	dir := t.TempDir()
+
+	ca, err := pki.LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "engine-ca.crt"), ca.CertificatePEM(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprints := map[string]string{}
+	for _, name := range []string{"source", "destination"} {
+		key, err := pki.LoadOrCreateKey(filepath.Join(dir, name+".key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := pki.CreateCertificateRequest(key, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certPEM, fingerprint, err := ca.SignAgentCertificate(csr, "127.0.0.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0644); err != nil {
+			t.Fatal(err)
+		}
+		fingerprints[name] = fingerprint
+	}
+
+	original := common.Config.Agent
+	common.Config.Agent.CertFile = filepath.Join(dir, "destination.crt")
+	common.Config.Agent.KeyFile = filepath.Join(dir, "destination.key")
+	common.Config.Agent.EngineCAFile = filepath.Join(dir, "engine-ca.crt")
+	t.Cleanup(func() {
+		common.Config.Agent = original
+	})
+
+	serverConfig, err := pki.ServerTLSConfig(filepath.Join(dir, "source.crt"), filepath.Join(dir, "source.key"), filepath.Join(dir, "engine-ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return serverConfig, fingerprints["source"]
+}
+
+// startReplicationSource serves the root as the source agent does, the checksum of the chunks is corrupted if corrupt
+// is set.
+func startReplicationSource(t *testing.T, root string, corrupt bool) common.ReplicationSource {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/replication/manifest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(common.ReplicationTokenHeader) != testReplicationToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		manifest, err := buildReplicationManifest(r.Context(), root)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(common.FailedRESTResponse{Error: err.Error()})
+			return
+		}
+
+		json.NewEncoder(w).Encode(manifest)
+	})
+	mux.HandleFunc("/replication/chunk", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+		length, _ := strconv.ParseInt(r.URL.Query().Get("length"), 10, 64)
+
+		chunk, err := readReplicationChunk(root, r.URL.Query().Get("path"), offset, length)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(common.FailedRESTResponse{Error: err.Error()})
+			return
+		}
+
+		sum := sha256.Sum256(chunk)
+		if corrupt {
+			sum[0]++
+		}
+		w.Header().Set(common.ReplicationChunkHeader, hex.EncodeToString(sum[:]))
+		w.Write(chunk)
+	})
+
+	serverConfig, fingerprint := setupReplicationTLS(t)
+
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = serverConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return common.ReplicationSource{Scheme: "https", Address: server.Listener.Addr().String(), CertFingerprint: fingerprint, Token: testReplicationToken}
+}
+
+func writeTestFile(t *testing.T, path string, content []byte) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setupReplication returns the source directory with a nested file, a file larger than a chunk and a symbolic link,
+// and the destination directory with the files not in the source.
+func setupReplication(t *testing.T) (sourceRoot, destinationRoot string, large []byte) {
+	sourceRoot = t.TempDir()
+	destinationRoot = t.TempDir()
+
+	large = bytes.Repeat([]byte("0123456789abcdef"), replicationChunkSize/16+100)
+	writeTestFile(t, filepath.Join(sourceRoot, "docs", "readme.txt"), []byte("hello"))
+	writeTestFile(t, filepath.Join(sourceRoot, "large.bin"), large)
+	if err := os.Symlink("docs/readme.txt", filepath.Join(sourceRoot, "readme")); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, filepath.Join(destinationRoot, "stale.txt"), []byte("stale"))
+	writeTestFile(t, filepath.Join(destinationRoot, "old", "file.txt"), []byte("old"))
+
+	return sourceRoot, destinationRoot, large
+}
+
+func pullTestReplication(t *testing.T, source common.ReplicationSource, destinationRoot, staging string) (common.ReplicationResult, error) {
+	peer, err := newReplicationPeer(source)
+	if err != nil {
+		t.Fatalf("newReplicationPeer() error = %v", err)
+	}
+
+	return pullReplication(context.Background(), peer, destinationRoot, staging)
+}
+
+func TestPullReplication(t *testing.T) {
+	sourceRoot, destinationRoot, large := setupReplication(t)
+	staging := filepath.Join(t.TempDir(), "staging")
+	source := startReplicationSource(t, sourceRoot, false)
+
+	result, err := pullTestReplication(t, source, destinationRoot, staging)
+	if err != nil {
+		t.Fatalf("pullReplication() error = %v", err)
+	}
+
+	want := common.ReplicationResult{FilesTransferred: 2, BytesTransferred: int64(len(large) + len("hello")), FilesDeleted: 2}
+	if result != want {
+		t.Errorf("pullReplication() result = %+v, want %+v", result, want)
+	}
+
+	if content, _ := os.ReadFile(filepath.Join(destinationRoot, "large.bin")); !bytes.Equal(content, large) {
+		t.Errorf("pullReplication() the large file is not replicated")
+	}
+	if target, _ := os.Readlink(filepath.Join(destinationRoot, "readme")); target != "docs/readme.txt" {
+		t.Errorf("pullReplication() link target = %s, want docs/readme.txt", target)
+	}
+	for _, name := range []string{"stale.txt", "old"} {
+		if _, err := os.Lstat(filepath.Join(destinationRoot, name)); !os.IsNotExist(err) {
+			t.Errorf("pullReplication() %s is not deleted", name)
+		}
+	}
+	if _, err := os.Stat(staging); !os.IsNotExist(err) {
+		t.Errorf("pullReplication() the staging folder is not removed")
+	}
+
+	// Only the file changed is transferred again.
+	writeTestFile(t, filepath.Join(sourceRoot, "docs", "readme.txt"), []byte("hello again"))
+
+	result, err = pullTestReplication(t, source, destinationRoot, staging)
+	if err != nil {
+		t.Fatalf("pullReplication() error = %v", err)
+	}
+
+	want = common.ReplicationResult{FilesTransferred: 1, BytesTransferred: int64(len("hello again")), FilesUnchanged: 1}
+	if result != want {
+		t.Errorf("pullReplication() result = %+v, want %+v", result, want)
+	}
+	if content, _ := os.ReadFile(filepath.Join(destinationRoot, "docs", "readme.txt")); string(content) != "hello again" {
+		t.Errorf("pullReplication() content = %s, want hello again", content)
+	}
+}
+
+func TestPullReplication_resume(t *testing.T) {
+	sourceRoot, destinationRoot, large := setupReplication(t)
+	staging := filepath.Join(t.TempDir(), "staging")
+	source := startReplicationSource(t, sourceRoot, false)
+
+	// The transfer was interrupted in the middle of the second chunk.
+	sum := sha256.Sum256(large)
+	writeTestFile(t, filepath.Join(staging, hex.EncodeToString(sum[:])+replicationPartialSuffix), large[:replicationChunkSize+10])
+
+	result, err := pullTestReplication(t, source, destinationRoot, staging)
+	if err != nil {
+		t.Fatalf("pullReplication() error = %v", err)
+	}
+
+	if result.FilesResumed != 1 {
+		t.Errorf("pullReplication() files resumed = %d, want 1", result.FilesResumed)
+	}
+	if want := int64(len(large) - replicationChunkSize + len("hello")); result.BytesTransferred != want {
+		t.Errorf("pullReplication() bytes transferred = %d, want %d", result.BytesTransferred, want)
+	}
+	if content, _ := os.ReadFile(filepath.Join(destinationRoot, "large.bin")); !bytes.Equal(content, large) {
+		t.Errorf("pullReplication() the large file is not replicated")
+	}
+}
+
+func TestPullReplication_checksumMismatch(t *testing.T) {
+	sourceRoot, destinationRoot, _ := setupReplication(t)
+	staging := filepath.Join(t.TempDir(), "staging")
+	source := startReplicationSource(t, sourceRoot, true)
+
+	if _, err := pullTestReplication(t, source, destinationRoot, staging); err == nil {
+		t.Fatalf("pullReplication() expected an error for the corrupted chunk")
+	}
+
+	if _, err := os.Stat(filepath.Join(destinationRoot, "large.bin")); !os.IsNotExist(err) {
+		t.Errorf("pullReplication() the corrupted file is moved into the directory")
+	}
+}
+
+func TestPullReplication_invalidToken(t *testing.T) {
+	sourceRoot, destinationRoot, _ := setupReplication(t)
+	source := startReplicationSource(t, sourceRoot, false)
+	source.Token = "other"
+
+	if _, err := pullTestReplication(t, source, destinationRoot, t.TempDir()); err == nil {
+		t.Fatalf("pullReplication() expected an error for the invalid token")
+	}
+}
+
+func TestPullReplication_mutualTLSOnly(t *testing.T) {
+	sourceRoot, _, _ := setupReplication(t)
+	source := startReplicationSource(t, sourceRoot, false)
+
+	for _, scheme := range []string{"", "http"} {
+		source.Scheme = scheme
+		if _, err := newReplicationPeer(source); err == nil {
+			t.Errorf("newReplicationPeer() of the scheme %q error = nil", scheme)
+		}
+	}
+
+	// The source agent pinned by another fingerprint is rejected.
+	source.Scheme = "https"
+	source.CertFingerprint = pki.Fingerprint([]byte("other"))
+	if _, err := pullTestReplication(t, source, t.TempDir(), t.TempDir()); err == nil {
+		t.Errorf("pullReplication() expected an error for the other fingerprint")
+	}
+}
+
+func TestPullReplication_invalidChecksum(t *testing.T) {
+	destinationRoot := t.TempDir()
+	staging := t.TempDir()
+	puller := replicationPuller{root: destinationRoot, staging: staging}
+
+	for _, sum := range []string{"", "../../../etc/passwd", strings.Repeat("A", 64), strings.Repeat("a", 63), strings.Repeat("a", 64) + "/"} {
+		entry := common.ReplicationEntry{Path: "file.txt", Type: common.ReplicationEntryFile, SHA256: sum}
+		if err := puller.pullFile(context.Background(), filepath.Join(destinationRoot, "file.txt"), entry); err == nil {
+			t.Errorf("pullFile() of the checksum %q error = nil", sum)
+		}
+	}
+
+	if entries, _ := os.ReadDir(staging); len(entries) != 0 {
+		t.Errorf("pullFile() creates %d entries in the staging folder, want none", len(entries))
+	}
+}
+
+func Test_resolveReplicationPath(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink("/etc", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "Nested path", path: "docs/readme.txt", want: filepath.Join(root, "docs", "readme.txt")},
+		{name: "Symbolic link itself", path: "link", want: filepath.Join(root, "link")},
+		{name: "Empty path", path: "", wantErr: true},
+		{name: "Absolute path", path: "/etc/passwd", wantErr: true},
+		{name: "Parent of the root", path: "../passwd", wantErr: true},
+		{name: "Unclean path", path: "docs/../../passwd", wantErr: true},
+		{name: "Under a symbolic link", path: "link/passwd", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveReplicationPath(root, tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveReplicationPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("resolveReplicationPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
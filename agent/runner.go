@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CommandRunner runs the external commands on behalf of the agents, so that the agents can be tested without the real commands.
+type CommandRunner interface {
+	// Run runs the command with the stdin. The error is a *CommandError if the command exits with a non-zero code.
+	Run(ctx context.Context, stdin string, name string, args ...string) (result CommandResult, err error)
+	// LookPath searches for the executable in the directories named by the PATH environment variable.
+	LookPath(file string) (string, error)
+}
+
+type CommandResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+type CommandError struct {
+	Name     string
+	ExitCode int
+	Stderr   string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %s exited with code %d: %s", e.Name, e.ExitCode, strings.TrimSpace(e.Stderr))
+}
+
+// ExecCommandRunner runs the commands on the local host by os/exec.
+type ExecCommandRunner struct{}
+
+func (r *ExecCommandRunner) Run(ctx context.Context, stdin string, name string, args ...string) (result CommandResult, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	var stdout, stderr bytes.Buffer
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+
+	result = CommandResult{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, &CommandError{Name: name, ExitCode: result.ExitCode, Stderr: stderr.String()}
+	}
+
+	return result, err
+}
+
+func (r *ExecCommandRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
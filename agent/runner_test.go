@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExecCommandRunner_Run(t *testing.T) {
+	tests := []struct {
+		name         string
+		stdin        string
+		args         []string
+		wantStdout   string
+		wantExitCode int
+		wantErr      bool
+	}{
+		{
+			name:       "test_run_command",
+			stdin:      "hello",
+			args:       []string{"-c", "cat"},
+			wantStdout: "hello",
+			wantErr:    false,
+		},
+		{
+			name:         "test_run_failed_command",
+			args:         []string{"-c", "echo failed >&2; exit 3"},
+			wantExitCode: 3,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &ExecCommandRunner{}
+			if _, err := runner.LookPath("sh"); err != nil {
+				t.Skip("sh is not available")
+			}
+
+			result, err := runner.Run(context.Background(), tt.stdin, "sh", tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ExecCommandRunner.Run() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			var commandErr *CommandError
+			if tt.wantErr && (!errors.As(err, &commandErr) || commandErr.ExitCode != tt.wantExitCode || commandErr.Stderr != "failed\n") {
+				t.Errorf("ExecCommandRunner.Run() error = %#v, want exit code %d", err, tt.wantExitCode)
+			}
+			if string(result.Stdout) != tt.wantStdout || result.ExitCode != tt.wantExitCode {
+				t.Errorf("ExecCommandRunner.Run() = %q, %d, want %q, %d", result.Stdout, result.ExitCode, tt.wantStdout, tt.wantExitCode)
+			}
+		})
+	}
+}
+
+func TestFakeCommandRunner_Run(t *testing.T) {
+	runner := NewFakeCommandRunner().
+		ExpectStdout("any", "net").
+		ExpectStdout("use", "net", "use").
+		Expect(CommandResult{ExitCode: 2}, "net", "use", "Z:")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantStdout string
+		wantErr    bool
+	}{
+		{name: "test_match_name", args: []string{"share"}, wantStdout: "any", wantErr: false},
+		{name: "test_match_latest_prefix", args: []string{"use", "Y:"}, wantStdout: "use", wantErr: false},
+		{name: "test_match_exit_code", args: []string{"use", "Z:", "/delete"}, wantStdout: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := runner.Run(context.Background(), "", "net", tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FakeCommandRunner.Run() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if string(result.Stdout) != tt.wantStdout {
+				t.Errorf("FakeCommandRunner.Run() = %q, want %q", result.Stdout, tt.wantStdout)
+			}
+		})
+	}
+
+	if _, err := runner.Run(context.Background(), "", "ipconfig"); err == nil {
+		t.Errorf("FakeCommandRunner.Run() runs the unexpected command without error")
+	}
+	if got := len(runner.Commands()); got != 4 {
+		t.Errorf("FakeCommandRunner.Commands() = %d commands, want 4", got)
+	}
+	if _, err := runner.LookPath("ipconfig"); err == nil {
+		t.Errorf("FakeCommandRunner.LookPath() finds the unexpected command")
+	}
+}
@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The options of the share which give the access levels, Samba has no difference between change and full at the
+// share level, so both of them are allowed by "valid users" only.
+const (
+	sambaValidUsers   = "valid users"
+	sambaReadList     = "read list"
+	sambaInvalidUsers = "invalid users"
+)
+
+// The prefixes of the groups in the lists of the users, "@" looks up the NIS netgroups before the UNIX groups, "+" the
+// UNIX groups only and "&" the NIS netgroups only. The groups are written with "@".
+const sambaGroupPrefixes = "@+&"
+
+// The sections in smb.conf which are not shares managed by the agent.
+var sambaReservedSections = []string{"global", "homes", "printers", "print$"}
+
+type sambaSection struct {
+	Name string
+	// The raw lines following the section header, including comments and blank lines.
+	Lines []string
+}
+
+// Get returns the value of the option in the section, or "" if the option is not set.
+func (s *sambaSection) Get(key string) string {
+	for _, line := range s.Lines {
+		if k, v, ok := parseSambaOption(line); ok && k == normalizeSambaKey(key) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Set replaces the value of the option in the section, or appends it if the option is not set.
+func (s *sambaSection) Set(key, value string) {
+	newLine := fmt.Sprintf("   %s = %s", normalizeSambaKey(key), value)
+
+	for i, line := range s.Lines {
+		if k, _, ok := parseSambaOption(line); ok && k == normalizeSambaKey(key) {
+			s.Lines[i] = newLine
+			return
+		}
+	}
+
+	// Keep the trailing blank lines at the end of the section.
+	index := len(s.Lines)
+	for index > 0 && strings.TrimSpace(s.Lines[index-1]) == "" {
+		index--
+	}
+	s.Lines = append(s.Lines[:index], append([]string{newLine}, s.Lines[index:]...)...)
+}
+
+// Unset removes the option from the section.
+func (s *sambaSection) Unset(key string) {
+	lines := s.Lines[:0]
+	for _, line := range s.Lines {
+		if k, _, ok := parseSambaOption(line); ok && k == normalizeSambaKey(key) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	s.Lines = lines
+}
+
+// getShareAccess returns the access levels given by the options of the share.
+func (s *sambaSection) getShareAccess() []common.ShareAccess {
+	var access []common.ShareAccess
+
+	readList := splitSambaList(s.Get(sambaReadList))
+	for _, name := range splitSambaList(s.Get(sambaValidUsers)) {
+		permission := common.SharePermissionChange
+		if containsFold(readList, name) {
+			permission = common.SharePermissionRead
+		}
+
+		access = append(access, toSambaShareAccess(name, permission))
+	}
+
+	for _, name := range splitSambaList(s.Get(sambaInvalidUsers)) {
+		access = append(access, toSambaShareAccess(name, common.SharePermissionDeny))
+	}
+
+	return access
+}
+
+// toSambaShareAccess returns the access level of the name in the lists of the users, which is a group if it is prefixed.
+func toSambaShareAccess(name, permission string) common.ShareAccess {
+	if groupName := strings.TrimLeft(name, sambaGroupPrefixes); groupName != name {
+		return common.ShareAccess{GroupName: groupName, Permission: permission}
+	}
+
+	return common.ShareAccess{UserName: name, Permission: permission}
+}
+
+// toSambaName returns the name of the user or the group in the lists of the users.
+func toSambaName(entry common.ShareAccess) string {
+	if entry.IsGroup() {
+		return "@" + entry.GroupName
+	}
+
+	return entry.UserName
+}
+
+// setShareAccess replaces the options of the share by the access levels. The share without any user allowed is open
+// to every user, since Samba takes the empty "valid users" as no restriction.
+func (s *sambaSection) setShareAccess(access []common.ShareAccess) {
+	var validUsers, readList, invalidUsers []string
+
+	for _, entry := range access {
+		name := toSambaName(entry)
+
+		switch entry.Permission {
+		case common.SharePermissionDeny:
+			invalidUsers = append(invalidUsers, name)
+		case common.SharePermissionRead:
+			validUsers = append(validUsers, name)
+			readList = append(readList, name)
+		default:
+			validUsers = append(validUsers, name)
+		}
+	}
+
+	s.setList(sambaValidUsers, validUsers)
+	s.setList(sambaReadList, readList)
+	s.setList(sambaInvalidUsers, invalidUsers)
+}
+
+func (s *sambaSection) setList(key string, values []string) {
+	if len(values) == 0 {
+		s.Unset(key)
+		return
+	}
+
+	s.Set(key, strings.Join(values, " "))
+}
+
+// splitSambaList splits the list of the option, whose values are separated by spaces or commas.
+func splitSambaList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '\t'
+	})
+}
+
+// validateSambaShare rejects the name and the description of the share which would break the lines of smb.conf.
+func validateSambaShare(name, description string) error {
+	if err := validateLinuxName("share", name); err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(name, "[]") {
+		return fmt.Errorf("invalid name of the share: %q", name)
+	}
+
+	if containsControl(description) {
+		return fmt.Errorf("invalid description of the share: %q", description)
+	}
+
+	return nil
+}
+
+func (s *sambaSection) isReserved() bool {
+	for _, name := range sambaReservedSections {
+		if strings.EqualFold(s.Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type sambaConfig struct {
+	// The lines before the first section.
+	Header   []string
+	Sections []*sambaSection
+}
+
+func loadSambaConfig(path string) (*sambaConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &sambaConfig{}, nil
+		}
+		return nil, err
+	}
+
+	return parseSambaConfig(content), nil
+}
+
+func parseSambaConfig(content []byte) *sambaConfig {
+	config := &sambaConfig{}
+
+	var current *sambaSection
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = &sambaSection{Name: strings.TrimSpace(trimmed[1 : len(trimmed)-1])}
+			config.Sections = append(config.Sections, current)
+			continue
+		}
+
+		if current == nil {
+			config.Header = append(config.Header, line)
+		} else {
+			current.Lines = append(current.Lines, line)
+		}
+	}
+
+	return config
+}
+
+// Section returns the section with the name, or nil if it does not exist. Section names are case insensitive.
+func (c *sambaConfig) Section(name string) *sambaSection {
+	for _, section := range c.Sections {
+		if strings.EqualFold(section.Name, name) {
+			return section
+		}
+	}
+
+	return nil
+}
+
+// Shares returns the share sections, excluding the global and the special sections.
+func (c *sambaConfig) Shares() []*sambaSection {
+	var shares []*sambaSection
+	for _, section := range c.Sections {
+		if !section.isReserved() {
+			shares = append(shares, section)
+		}
+	}
+
+	return shares
+}
+
+func (c *sambaConfig) AddSection(section *sambaSection) error {
+	if c.Section(section.Name) != nil {
+		return fmt.Errorf("the section [%s] already exists in samba configuration", section.Name)
+	}
+
+	// Separate the new section from the previous one.
+	if len(c.Sections) > 0 {
+		last := c.Sections[len(c.Sections)-1]
+		if len(last.Lines) == 0 || strings.TrimSpace(last.Lines[len(last.Lines)-1]) != "" {
+			last.Lines = append(last.Lines, "")
+		}
+	}
+
+	c.Sections = append(c.Sections, section)
+
+	return nil
+}
+
+func (c *sambaConfig) RemoveSection(name string) error {
+	for i, section := range c.Sections {
+		if strings.EqualFold(section.Name, name) {
+			c.Sections = append(c.Sections[:i], c.Sections[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the section [%s] does not exist in samba configuration", name)
+}
+
+func (c *sambaConfig) Bytes() []byte {
+	var buffer bytes.Buffer
+
+	for _, line := range c.Header {
+		buffer.WriteString(line + "\n")
+	}
+
+	for _, section := range c.Sections {
+		buffer.WriteString("[" + section.Name + "]\n")
+		for _, line := range section.Lines {
+			buffer.WriteString(line + "\n")
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+// Save writes the configuration to a temporary file first and renames it, so smbd never reads a partial file.
+func (c *sambaConfig) Save(path string) error {
+	return writeFileAtomically(path, c.Bytes(), 0644)
+}
+
+func parseSambaOption(line string) (key, value string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+		return "", "", false
+	}
+
+	key, value, ok = strings.Cut(trimmed, "=")
+	if !ok {
+		return "", "", false
+	}
+
+	return normalizeSambaKey(key), strings.TrimSpace(value), true
+}
+
+// normalizeSambaKey lowers the option name and collapses the spaces, e.g. "Read  Only" -> "read only".
+func normalizeSambaKey(key string) string {
+	return strings.Join(strings.Fields(strings.ToLower(key)), " ")
+}
+
+func writeFileAtomically(path string, content []byte, perm os.FileMode) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err = tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmpFile.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The snapshots of a directory are kept in the folder of the directory under the snapshot folder, every snapshot is
+// a copy of the directory tree with a metadata file beside it, e.g. data/daily-1 and data/daily-1.json.
+const snapshotMetadataSuffix = ".json"
+
+// The snapshot is restored into the staging folder in the root folder first, which is not listed as a directory.
+const restoreStagingPrefix = ".restore-"
+
+func getLinuxSnapshotFolder() string {
+	if folder := common.Config.Agent.LinuxSnapshotFolder; folder != "" {
+		return folder
+	}
+
+	return filepath.Clean(common.Config.Agent.LinuxRootFolder) + "-snapshots"
+}
+
+// getSnapshotPath returns the path of the snapshot and the path of its metadata file.
+func getSnapshotPath(directoryName, name string) (snapshotPath, metadataPath string, err error) {
+	if err = validateLinuxName("directory", directoryName); err != nil {
+		return "", "", err
+	}
+
+	snapshotPath = filepath.Join(getLinuxSnapshotFolder(), directoryName, name)
+
+	return snapshotPath, snapshotPath + snapshotMetadataSuffix, nil
+}
+
+func readSnapshotMetadata(path string) (detail common.SnapshotDetail, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return detail, err
+	}
+
+	if err = json.Unmarshal(content, &detail); err != nil {
+		return detail, fmt.Errorf("invalid metadata of the snapshot %s: %w", path, err)
+	}
+
+	return detail, nil
+}
+
+// writeSnapshotMetadata writes the metadata file once the snapshot is taken, so a snapshot without the metadata file
+// is an incomplete one and never listed.
+func writeSnapshotMetadata(path string, detail common.SnapshotDetail) error {
+	content, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err = os.WriteFile(tempPath, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// listSnapshotMetadata returns the snapshots in the folder of a directory in the order of their creation.
+func listSnapshotMetadata(folder string) ([]common.SnapshotDetail, error) {
+	entries, err := os.ReadDir(folder)
+	if os.IsNotExist(err) {
+		return []common.SnapshotDetail{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	snapshots := []common.SnapshotDetail{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), snapshotMetadataSuffix) {
+			continue
+		}
+
+		detail, err := readSnapshotMetadata(filepath.Join(folder, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		snapshots = append(snapshots, detail)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].CreationTime.Before(snapshots[j].CreationTime)
+	})
+
+	return snapshots, nil
+}
+
+// swapDirectory replaces the directory by the new one, the directory is moved to the old path, so that it is removed
+// only after the swap succeeds. The directory is moved back if the new one fails to be moved in.
+func swapDirectory(dirPath, newPath, oldPath string) error {
+	if err := os.Rename(dirPath, oldPath); err != nil {
+		return err
+	}
+
+	if err := os.Rename(newPath, dirPath); err != nil {
+		if rollbackErr := os.Rename(oldPath, dirPath); rollbackErr != nil {
+			return fmt.Errorf("failed to restore %s: %v, and the original is left in %s: %v", dirPath, err, oldPath, rollbackErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
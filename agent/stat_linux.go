@@ -0,0 +1,43 @@
+package agent
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// getFileTimes returns the change, access and modification time of the file.
+func getFileTimes(info os.FileInfo) (ctime, atime, mtime time.Time) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime(), info.ModTime(), info.ModTime()
+	}
+
+	ctime = time.Unix(stat.Ctim.Unix())
+	atime = time.Unix(stat.Atim.Unix())
+	mtime = time.Unix(stat.Mtim.Unix())
+
+	return ctime, atime, mtime
+}
+
+// getFileIDs returns the ID of the device containing the file and the inode number of the file.
+func getFileIDs(info os.FileInfo) (device, inode uint64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return uint64(stat.Dev), stat.Ino, true
+}
+
+// getKernelInfo returns the machine hardware name and the kernel release reported by uname.
+func getKernelInfo() (machine, release string, err error) {
+	var uname unix.Utsname
+	if err = unix.Uname(&uname); err != nil {
+		return "", "", err
+	}
+
+	return unix.ByteSliceToString(uname.Machine[:]), unix.ByteSliceToString(uname.Release[:]), nil
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package agent
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+// getFileTimes returns the modification time for all the timestamps since the change and access time are not portable.
+func getFileTimes(info os.FileInfo) (ctime, atime, mtime time.Time) {
+	return info.ModTime(), info.ModTime(), info.ModTime()
+}
+
+// getFileIDs reports the IDs are unknown since the inode numbers are not portable.
+func getFileIDs(info os.FileInfo) (device, inode uint64, ok bool) {
+	return 0, 0, false
+}
+
+// getKernelInfo returns the architecture of the running binary since uname is not available.
+func getKernelInfo() (machine, release string, err error) {
+	return runtime.GOARCH, "", nil
+}
@@ -0,0 +1,146 @@
+package agent
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The number of the largest files reported in DirectoryUsage.
+const largestFilesCount = 10
+
+// The lower bounds in days of the buckets in the age histogram, the last bucket has no upper bound.
+var ageBucketDays = []int{0, 30, 90, 180, 365}
+
+// walkLimiter paces the walk to the rate of entries per second, so the walk does not starve the I/O of the host.
+type walkLimiter struct {
+	interval time.Duration
+	next     time.Time
+}
+
+func newWalkLimiter(rate int) *walkLimiter {
+	if rate <= 0 {
+		return &walkLimiter{}
+	}
+
+	return &walkLimiter{interval: time.Second / time.Duration(rate)}
+}
+
+// wait blocks until the next entry is allowed, or returns the error of the context once it is done.
+func (l *walkLimiter) wait(ctx context.Context) error {
+	if l.interval == 0 {
+		return ctx.Err()
+	}
+
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(l.interval)
+
+	// Sleep in slices instead of once per entry, the timers are too coarse for the high rates.
+	delay := l.next.Sub(now)
+	if delay < 10*time.Millisecond {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// walkDirectoryUsage sums up the regular files in the tree of the directory. The symbolic links are not followed, and
+// the entries which cannot be read are skipped so that one of them does not fail the whole walk.
+func walkDirectoryUsage(ctx context.Context, dirPath string, now time.Time) (usage common.DirectoryUsage, err error) {
+	limiter := newWalkLimiter(common.Config.Agent.UsageWalkRate)
+
+	usage.AgeHistogram = make([]common.AgeBucket, len(ageBucketDays))
+	for i, days := range ageBucketDays {
+		usage.AgeHistogram[i].MinAgeDays = days
+		if i+1 < len(ageBucketDays) {
+			usage.AgeHistogram[i].MaxAgeDays = ageBucketDays[i+1]
+		}
+	}
+
+	err = filepath.WalkDir(dirPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dirPath {
+				return err
+			}
+
+			return nil
+		}
+
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		usage.UsedBytes += info.Size()
+		usage.FileCount++
+
+		bucket := &usage.AgeHistogram[getAgeBucket(now.Sub(info.ModTime()))]
+		bucket.FileCount++
+		bucket.Bytes += info.Size()
+
+		relativePath, _ := filepath.Rel(dirPath, path)
+		usage.LargestFiles = addLargestFile(usage.LargestFiles, common.FileUsage{
+			Path:          filepath.ToSlash(relativePath),
+			Size:          info.Size(),
+			LastWriteTime: info.ModTime().Format(linuxTimeLayout),
+		})
+
+		return nil
+	})
+
+	return usage, err
+}
+
+func getAgeBucket(age time.Duration) int {
+	days := int(age / (24 * time.Hour))
+
+	for i := len(ageBucketDays) - 1; i > 0; i-- {
+		if days >= ageBucketDays[i] {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// addLargestFile keeps the largest files in descending order of size, the list is never longer than largestFilesCount.
+func addLargestFile(files []common.FileUsage, file common.FileUsage) []common.FileUsage {
+	if len(files) == largestFilesCount && file.Size <= files[len(files)-1].Size {
+		return files
+	}
+
+	index := sort.Search(len(files), func(i int) bool { return files[i].Size < file.Size })
+
+	files = append(files, common.FileUsage{})
+	copy(files[index+1:], files[index:])
+	files[index] = file
+
+	if len(files) > largestFilesCount {
+		files = files[:largestFilesCount]
+	}
+
+	return files
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+func TestLinuxAgent_GetDirectoryUsage(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+
+	now := time.Now()
+	files := []struct {
+		path string
+		size int
+		age  time.Duration
+	}{
+		{path: "new.txt", size: 100},
+		{path: "sub/old.log", size: 300, age: 400 * 24 * time.Hour},
+		{path: "sub/deep/medium.bin", size: 200, age: 45 * 24 * time.Hour},
+	}
+	for _, file := range files {
+		path := filepath.Join(dirPath, file.path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, file.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-file.age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The symbolic links are not followed, so the file is counted once.
+	if err := os.Symlink(filepath.Join(dirPath, "new.txt"), filepath.Join(dirPath, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &LinuxAgent{}
+	usage, err := agent.GetDirectoryUsage(context.Background(), testDirectoryName)
+	if err != nil {
+		t.Fatalf("LinuxAgent.GetDirectoryUsage() error = %v", err)
+	}
+
+	if usage.UsedBytes != 600 || usage.FileCount != 3 {
+		t.Errorf("LinuxAgent.GetDirectoryUsage() = %d bytes in %d files, want 600 bytes in 3 files", usage.UsedBytes, usage.FileCount)
+	}
+
+	var gotPaths []string
+	for _, file := range usage.LargestFiles {
+		gotPaths = append(gotPaths, file.Path)
+	}
+	if wantPaths := []string{"sub/old.log", "sub/deep/medium.bin", "new.txt"}; !reflect.DeepEqual(gotPaths, wantPaths) {
+		t.Errorf("LinuxAgent.GetDirectoryUsage() largest files = %v, want %v", gotPaths, wantPaths)
+	}
+
+	wantHistogram := []common.AgeBucket{
+		{MinAgeDays: 0, MaxAgeDays: 30, FileCount: 1, Bytes: 100},
+		{MinAgeDays: 30, MaxAgeDays: 90, FileCount: 1, Bytes: 200},
+		{MinAgeDays: 90, MaxAgeDays: 180},
+		{MinAgeDays: 180, MaxAgeDays: 365},
+		{MinAgeDays: 365, MaxAgeDays: 0, FileCount: 1, Bytes: 300},
+	}
+	if !reflect.DeepEqual(usage.AgeHistogram, wantHistogram) {
+		t.Errorf("LinuxAgent.GetDirectoryUsage() age histogram = %v, want %v", usage.AgeHistogram, wantHistogram)
+	}
+
+	if _, err := agent.GetDirectoryUsage(context.Background(), testDirectoryName1); err == nil {
+		t.Errorf("LinuxAgent.GetDirectoryUsage() walks the missing directory without error")
+	}
+}
+
+func TestLinuxAgent_GetDirectoryUsage_Cancel(t *testing.T) {
+	rootFolder := setupLinuxRootFolder(t)
+	dirPath := filepath.Join(rootFolder, testDirectoryName)
+	if err := os.Mkdir(dirPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := os.WriteFile(filepath.Join(dirPath, fmt.Sprintf("file%d", i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The walk paced to one entry per second is stopped by the deadline long before it visits all the entries.
+	original := common.Config.Agent.UsageWalkRate
+	common.Config.Agent.UsageWalkRate = 1
+	t.Cleanup(func() { common.Config.Agent.UsageWalkRate = original })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	agent := &LinuxAgent{}
+	if _, err := agent.GetDirectoryUsage(ctx, testDirectoryName); err != context.DeadlineExceeded {
+		t.Errorf("LinuxAgent.GetDirectoryUsage() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("LinuxAgent.GetDirectoryUsage() is stopped after %v", elapsed)
+	}
+}
+
+func Test_addLargestFile(t *testing.T) {
+	var files []common.FileUsage
+	for i := 1; i <= largestFilesCount+5; i++ {
+		// The sizes from 1 to 15 are not in order, i.e. 7, 14, 5, 12, ...
+		size := int64(i * 7 % 16)
+		files = addLargestFile(files, common.FileUsage{Path: fmt.Sprint(size), Size: size})
+	}
+
+	if len(files) != largestFilesCount {
+		t.Fatalf("addLargestFile() keeps %d files, want %d", len(files), largestFilesCount)
+	}
+	for i, file := range files {
+		if want := int64(largestFilesCount + 5 - i); file.Size != want {
+			t.Errorf("addLargestFile() files[%d] = %d, want %d", i, file.Size, want)
+		}
+	}
+}
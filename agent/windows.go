@@ -3,23 +3,41 @@ package agent
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"golang.org/x/text/transform"
 )
 
-type WindowsAgent struct{}
+type WindowsAgent struct {
+	// Runner runs the PowerShell commands, the commands are run on the local host if it is nil.
+	Runner CommandRunner
+}
+
+func (agent *WindowsAgent) runner() CommandRunner {
+	if agent.Runner == nil {
+		return &ExecCommandRunner{}
+	}
+
+	return agent.Runner
+}
+
+// getDirectoryPath always joins with backslash, so the path is the same wherever the agent is tested.
+func (agent *WindowsAgent) getDirectoryPath(name string) string {
+	return fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, name)
+}
 
 func (agent *WindowsAgent) CreateDirectory(ctx context.Context, name string) (dirPath string, err error) {
-	dirPath = fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, name)
+	dirPath = agent.getDirectoryPath(name)
 
-	err = os.Mkdir(dirPath, os.ModePerm)
+	_, err = agent.execPowerShellCommand(ctx, "New-Item", "-ItemType", "Directory", "-Path", common.AddQuotes(dirPath))
 	if err != nil {
 		return "", err
 	}
@@ -41,24 +59,9 @@ func (agent *WindowsAgent) CreateDirectories(ctx context.Context, names []string
 }
 
 func (agent *WindowsAgent) DeleteDirectory(ctx context.Context, name string) (err error) {
-	dirPath := fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, name)
+	dirPath := agent.getDirectoryPath(name)
 
-	return os.Remove(dirPath)
-}
-
-func (agent *WindowsAgent) GetDirectoryList(ctx context.Context) (err error) {
-	cmdlet := "Get-ChildItem"
-
-	// Define the arguments
-	args := []string{
-		common.Config.Agent.WindowsRootFolder,
-	}
-
-	// Execute the PowerShell command
-	cmd := exec.Command("powershell.exe", append([]string{"-Command", cmdlet}, args...)...)
-
-	// Capture the command output
-	_, err = cmd.CombinedOutput()
+	_, err = agent.execPowerShellCommand(ctx, "Remove-Item", "-Path", common.AddQuotes(dirPath))
 
 	return err
 }
@@ -73,105 +76,302 @@ func (agent *WindowsAgent) DeleteDirectories(ctx context.Context, names []string
 	return err
 }
 
-func (agent *WindowsAgent) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
-	script := "./agent/windows/Get-DirectoryDetail.ps1"
+// UpdateDirectory renames the directory, Rename-Item fails if the new name is used already.
+func (agent *WindowsAgent) UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error) {
+	dirPath := agent.getDirectoryPath(name)
 
-	dirPath := fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, name)
+	_, err = agent.execPowerShellCommand(ctx, "Rename-Item", "-Path", common.AddQuotes(dirPath), "-NewName", common.AddQuotes(update.NewName))
 
-	output, err := execPowerShellCmdlet(script, "-DirectoryPaths", dirPath)
-	if err != nil {
-		return detail, err
+	return err
+}
+
+// The objects written by the scripts in agent/windows with ConvertTo-Json.
+type windowsDirectory struct {
+	Name           string `json:"Name"`
+	FullPath       string `json:"FullPath"`
+	CreationTime   string `json:"CreationTime"`
+	LastWriteTime  string `json:"LastWriteTime"`
+	LastAccessTime string `json:"LastAccessTime"`
+	Exist          bool   `json:"Exist"`
+	ParentFullPath string `json:"ParentFullPath"`
+}
+
+type windowsShare struct {
+	Name          string `json:"Name"`
+	DirectoryPath string `json:"DirectoryPath"`
+	Description   string `json:"Description"`
+	ShareState    int    `json:"ShareState"`
+}
+
+type windowsLocalUser struct {
+	Name               string `json:"Name"`
+	SID                string `json:"SID"`
+	FullName           string `json:"FullName"`
+	Description        string `json:"Description"`
+	Status             string `json:"Status"`
+	Disabled           bool   `json:"Disabled"`
+	PasswordRequired   bool   `json:"PasswordRequired"`
+	PasswordExpires    bool   `json:"PasswordExpires"`
+	PasswordChangeable bool   `json:"PasswordChangeable"`
+	Lockout            bool   `json:"Lockout"`
+}
+
+type windowsLocalGroup struct {
+	Name        string   `json:"Name"`
+	SID         string   `json:"SID"`
+	Description string   `json:"Description"`
+	Members     []string `json:"Members"`
+}
+
+type windowsSystem struct {
+	Caption        string `json:"Caption"`
+	Version        string `json:"Version"`
+	OSArchitecture string `json:"OSArchitecture"`
+	BuildNumber    string `json:"BuildNumber"`
+	ComputerName   string `json:"ComputerName"`
+}
+
+type windowsQuota struct {
+	Size      int64 `json:"Size"`
+	SoftLimit bool  `json:"SoftLimit"`
+	Usage     int64 `json:"Usage"`
+}
+
+type windowsACL struct {
+	Owner   string            `json:"Owner"`
+	Entries []windowsACLEntry `json:"Entries"`
+}
+
+type windowsACLEntry struct {
+	IdentityReference string `json:"IdentityReference"`
+	PrincipalType     string `json:"PrincipalType"`
+	AccessControlType string `json:"AccessControlType"`
+	FileSystemRights  string `json:"FileSystemRights"`
+	IsInherited       bool   `json:"IsInherited"`
+	InheritanceFlags  string `json:"InheritanceFlags"`
+	PropagationFlags  string `json:"PropagationFlags"`
+}
+
+// The rule read by Set-DirectoryACL.ps1 to construct the FileSystemAccessRule.
+type windowsAccessRule struct {
+	Identity          string `json:"Identity"`
+	Rights            string `json:"Rights"`
+	InheritanceFlags  string `json:"InheritanceFlags"`
+	PropagationFlags  string `json:"PropagationFlags"`
+	AccessControlType string `json:"AccessControlType"`
+}
+
+// The rights set for the normalized permissions.
+var windowsRights = map[string]string{
+	common.ACLPermissionRead:   "ReadAndExecute",
+	common.ACLPermissionWrite:  "Write",
+	common.ACLPermissionModify: "Modify",
+	common.ACLPermissionFull:   "FullControl",
+}
+
+type windowsSystemStatus struct {
+	LoadPercentage float64 `json:"LoadPercentage"`
+	UptimeSeconds  int64   `json:"UptimeSeconds"`
+}
+
+func (directory windowsDirectory) toDirectoryDetail() common.DirectoryDetail {
+	return common.DirectoryDetail{
+		Name:           directory.Name,
+		FullPath:       directory.FullPath,
+		CreationTime:   directory.CreationTime,
+		LastWriteTime:  directory.LastWriteTime,
+		LastAccessTime: directory.LastAccessTime,
+		Exist:          directory.Exist,
+		ParentFullPath: directory.ParentFullPath,
 	}
+}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(output, &result)
+// toDirectoryACL normalizes the rules, the rules of the special rights which are not normalized are left out.
+func (acl windowsACL) toDirectoryACL() common.DirectoryACL {
+	directoryACL := common.DirectoryACL{Owner: acl.Owner}
+
+	for _, rule := range acl.Entries {
+		permission, ok := toACLPermission(rule.FileSystemRights)
+		if !ok {
+			continue
+		}
+
+		entry := common.ACLEntry{
+			Principal:     rule.IdentityReference,
+			PrincipalType: rule.PrincipalType,
+			Type:          strings.ToLower(rule.AccessControlType),
+			Permission:    permission,
+			Inherit:       rule.InheritanceFlags != "None",
+			InheritOnly:   strings.Contains(rule.PropagationFlags, "InheritOnly"),
+			Inherited:     rule.IsInherited,
+		}
+		if entry.PrincipalType == common.PrincipalTypeEveryone {
+			entry.Principal = ""
+		}
+
+		directoryACL.Entries = append(directoryACL.Entries, entry)
+	}
+
+	return directoryACL
+}
+
+// toACLPermission normalizes FileSystemRights such as "Modify, Synchronize". The generic rights, which are written
+// as numbers, are found in the rules of CREATOR OWNER.
+func toACLPermission(rights string) (string, bool) {
+	flags := make(map[string]bool)
+	for _, flag := range strings.Split(rights, ",") {
+		flags[strings.TrimSpace(flag)] = true
+	}
+
+	read := flags["Read"] || flags["ReadAndExecute"] || flags["ReadData"]
+	write := flags["Write"] || flags["WriteData"]
+
+	switch {
+	case flags["FullControl"] || flags["268435456"]:
+		return common.ACLPermissionFull, true
+	case flags["Modify"] || flags["-536805376"] || (read && write):
+		return common.ACLPermissionModify, true
+	case write:
+		return common.ACLPermissionWrite, true
+	case read || flags["-1610612736"]:
+		return common.ACLPermissionRead, true
+	default:
+		return "", false
+	}
+}
+
+func (share windowsShare) toShareDetail() common.ShareDetail {
+	// The value of MSFT_SmbShare.ShareState, 1 means online.
+	state := "offline"
+	if share.ShareState == 1 {
+		state = "online"
+	}
+
+	return common.ShareDetail{
+		Name:          share.Name,
+		DirectoryPath: share.DirectoryPath,
+		Description:   share.Description,
+		State:         state,
+	}
+}
+
+func (user windowsLocalUser) toLocalUserDetail() common.LocalUserDetail {
+	return common.LocalUserDetail{
+		Name:                 user.Name,
+		UID:                  user.SID,
+		FullName:             user.FullName,
+		Description:          user.Description,
+		Status:               user.Status,
+		IsPasswordExpired:    user.PasswordExpires,
+		IsPasswordChangeable: user.PasswordChangeable,
+		IsPasswordRequired:   user.PasswordRequired,
+		IsLockout:            user.Lockout,
+		IsDisabled:           user.Disabled,
+	}
+}
+
+func (agent *WindowsAgent) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
+	directories, err := agent.GetDirectoriesDetail(ctx, []string{name})
 	if err != nil {
 		return detail, err
 	}
 
-	detail = common.DirectoryDetail{
-		Name:           result["Name"].(string),
-		FullPath:       result["FullPath"].(string),
-		CreationTime:   result["CreationTime"].(string),
-		LastWriteTime:  result["LastWriteTime"].(string),
-		LastAccessTime: result["LastAccessTime"].(string),
-		Exist:          result["Exist"].(bool),
-		ParentFullPath: result["ParentFullPath"].(string),
+	if len(directories) == 0 {
+		return detail, fmt.Errorf("the directory %s does not exist", agent.getDirectoryPath(name))
 	}
 
-	return detail, err
+	return directories[0], nil
 }
 
+// GetDirectoriesDetail returns the details of the existing directories, the missing ones are skipped by the script.
+// All the directories in the root folder are returned if no name is given.
 func (agent *WindowsAgent) GetDirectoriesDetail(ctx context.Context, names []string) (detail []common.DirectoryDetail, err error) {
 	script := "./agent/windows/Get-DirectoryDetail.ps1"
 
-	dirPaths := make([]string, len(names))
-	for i, name := range names {
-		dirPaths[i] = fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, name)
+	args := []string{"-RootPath", common.Config.Agent.WindowsRootFolder}
+	if len(names) > 0 {
+		dirPaths := make([]string, len(names))
+		for i, name := range names {
+			dirPaths[i] = agent.getDirectoryPath(name)
+		}
+
+		args = []string{"-DirectoryPaths", strings.Join(dirPaths, ",")}
 	}
 
-	output, err := execPowerShellCmdlet(script, "-DirectoryPaths", strings.Join(dirPaths, ","))
+	output, err := agent.execPowerShellScript(ctx, script, args...)
 	if err != nil {
 		return detail, err
 	}
 
-	var result []map[string]interface{}
-	err = json.Unmarshal(output, &result)
+	directories, err := unmarshalPowerShellJSON[windowsDirectory](output)
 	if err != nil {
-		// In case that only one file path to query.
-		var result map[string]interface{}
-		err = json.Unmarshal(output, &result)
-		if err != nil {
-			return detail, err
-		}
-		directory := common.DirectoryDetail{
-			Name:           result["Name"].(string),
-			FullPath:       result["FullPath"].(string),
-			CreationTime:   result["CreationTime"].(string),
-			LastWriteTime:  result["LastWriteTime"].(string),
-			LastAccessTime: result["LastAccessTime"].(string),
-			Exist:          result["Exist"].(bool),
-			ParentFullPath: result["ParentFullPath"].(string),
-		}
-		detail = append(detail, directory)
-	} else {
+		return detail, err
+	}
 
-		for _, item := range result {
-			directory := common.DirectoryDetail{
-				Name:           item["Name"].(string),
-				FullPath:       item["FullPath"].(string),
-				CreationTime:   item["CreationTime"].(string),
-				LastWriteTime:  item["LastWriteTime"].(string),
-				LastAccessTime: item["LastAccessTime"].(string),
-				Exist:          item["Exist"].(bool),
-				ParentFullPath: item["ParentFullPath"].(string),
-			}
-			detail = append(detail, directory)
-		}
+	for _, directory := range directories {
+		detail = append(detail, directory.toDirectoryDetail())
 	}
 
-	return detail, err
+	return detail, nil
+}
+
+// The parameters of New-SmbShare for the access levels.
+var windowsShareAccessParameters = map[string]string{
+	common.SharePermissionRead:   "-ReadAccess",
+	common.SharePermissionChange: "-ChangeAccess",
+	common.SharePermissionFull:   "-FullAccess",
+	common.SharePermissionDeny:   "-NoAccess",
 }
 
-func (agent *WindowsAgent) CreateCIFSShare(ctx context.Context, name, directoryName, description string, usernames []string) (err error) {
+// CreateCIFSShare creates the share with the access levels, SMB gives everyone the read access if no level is given.
+func (agent *WindowsAgent) CreateCIFSShare(ctx context.Context, name, directoryName, description string, access []common.ShareAccess) (err error) {
 	cmdlet := "New-SmbShare"
 
-	directoryPath := fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, directoryName)
+	directoryPath := agent.getDirectoryPath(directoryName)
 
 	// Define the arguments
 	args := []string{
 		"-Name", name,
 		"-Path", common.AddQuotes(directoryPath),
 		"-Description", common.AddQuotes(description),
-		"-FullAccess", strings.Join(usernames, ", "),
-		"-FolderEnumerationMode", "Unrestricted",
 	}
 
-	// Execute the PowerShell command
-	cmd := exec.Command("powershell.exe", append([]string{"-Command", cmdlet}, args...)...)
+	// The local users and the local groups share the names of the accounts.
+	accountNames := make(map[string][]string)
+	for _, entry := range access {
+		accountNames[entry.Permission] = append(accountNames[entry.Permission], common.AddQuotes(entry.Principal()))
+	}
+	for _, permission := range []string{common.SharePermissionRead, common.SharePermissionChange, common.SharePermissionFull, common.SharePermissionDeny} {
+		if len(accountNames[permission]) > 0 {
+			args = append(args, windowsShareAccessParameters[permission], strings.Join(accountNames[permission], ", "))
+		}
+	}
+
+	args = append(args, "-FolderEnumerationMode", "Unrestricted")
+
+	_, err = agent.execPowerShellCommand(ctx, cmdlet, args...)
+
+	return err
+}
+
+// GrantCIFSShareAccess gives the access levels to the users and the groups, the level of the one given already is replaced.
+func (agent *WindowsAgent) GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error) {
+	content, err := json.Marshal(access)
+	if err != nil {
+		return err
+	}
+
+	script := "./agent/windows/Set-ShareAccess.ps1"
+	_, err = agent.execPowerShellScript(ctx, script, "-Name", name, "-Grant", base64.StdEncoding.EncodeToString(content))
+
+	return err
+}
+
+func (agent *WindowsAgent) RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error) {
+	accountNames := append(append([]string{}, userNames...), groupNames...)
 
-	// Capture the command output
-	_, err = cmd.CombinedOutput()
+	script := "./agent/windows/Set-ShareAccess.ps1"
+	_, err = agent.execPowerShellScript(ctx, script, "-Name", name, "-Revoke", strings.Join(accountNames, ","))
 
 	return err
 }
@@ -185,93 +385,53 @@ func (agent *WindowsAgent) DeleteCIFSShare(ctx context.Context, name string) (er
 		"-Force",
 	}
 
-	// Execute the PowerShell command
-	cmd := exec.Command("powershell.exe", append([]string{"-Command", cmdlet}, args...)...)
+	_, err = agent.execPowerShellCommand(ctx, cmdlet, args...)
 
-	// Capture the command output
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Println("Error executing PowerShell command:", err.Error())
+	return err
+}
+
+func (agent *WindowsAgent) UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error) {
+	if update.Description == nil {
+		return nil
 	}
 
-	fmt.Println(string(output))
+	_, err = agent.execPowerShellCommand(ctx, "Set-SmbShare", "-Name", name, "-Description", common.AddQuotes(*update.Description), "-Force")
+
 	return err
 }
 
 func (agent *WindowsAgent) GetCIFSShareDetail(ctx context.Context, name string) (detail common.ShareDetail, err error) {
-	script := "./agent/windows/Get-ShareDetail.ps1"
-	output, err := execPowerShellCmdlet(script, "-ShareNames", name)
+	shares, err := agent.GetCIFSSharesDetail(ctx, []string{name})
 	if err != nil {
 		return detail, err
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(output, &result)
-	if err != nil {
-		return detail, err
-	}
-
-	detail = common.ShareDetail{
-		Name:          result["Name"].(string),
-		DirectoryPath: result["DirectoryPath"].(string),
-		Description:   result["Description"].(string),
-		State: func() string {
-			if result["ShareState"].(float64) == 1 {
-				return "online"
-			}
-			return "offline"
-		}(),
+	if len(shares) == 0 {
+		return detail, fmt.Errorf("the share %s does not exist", name)
 	}
 
-	return detail, err
+	return shares[0], nil
 }
 
+// GetCIFSSharesDetail returns the details of the shares with the names, or all the shares if no name is given.
 func (agent *WindowsAgent) GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error) {
 	script := "./agent/windows/Get-ShareDetail.ps1"
-	output, err := execPowerShellCmdlet(script, "-ShareNames", strings.Join(names, ","))
+
+	output, err := agent.execPowerShellScript(ctx, script, "-ShareNames", strings.Join(names, ","))
 	if err != nil {
 		return nil, err
 	}
 
-	var result []map[string]interface{}
-	err = json.Unmarshal(output, &result)
+	shares, err := unmarshalPowerShellJSON[windowsShare](output)
 	if err != nil {
-		// In case that only one file path to query.
-		var result map[string]interface{}
-		err = json.Unmarshal(output, &result)
-		if err != nil {
-			return detail, err
-		}
-		share := common.ShareDetail{
-			Name:          result["Name"].(string),
-			DirectoryPath: result["DirectoryPath"].(string),
-			Description:   result["Description"].(string),
-			State: func() string {
-				if result["ShareState"].(float64) == 1 {
-					return "online"
-				}
-				return "offline"
-			}(),
-		}
-		detail = append(detail, share)
-	}
-
-	for _, item := range result {
-		share := common.ShareDetail{
-			Name:          item["Name"].(string),
-			DirectoryPath: item["DirectoryPath"].(string),
-			Description:   item["Description"].(string),
-			State: func() string {
-				if item["ShareState"].(float64) == 1 {
-					return "online"
-				}
-				return "offline"
-			}(),
-		}
-		detail = append(detail, share)
+		return detail, err
+	}
+
+	for _, share := range shares {
+		detail = append(detail, share.toShareDetail())
 	}
 
-	return detail, err
+	return detail, nil
 }
 
 func (agent *WindowsAgent) MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error) {
@@ -286,16 +446,8 @@ func (agent *WindowsAgent) MountCIFSShare(ctx context.Context, mountPoint, share
 		"/user:" + userName,
 	}
 
-	// Execute the PowerShell command
-	cmd := exec.Command("powershell.exe", append([]string{"-Command", cmdlet}, args...)...)
-
-	// Capture the command output
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Println("Error executing PowerShell command:", err.Error())
-	}
+	_, err = agent.execPowerShellCommand(ctx, cmdlet, args...)
 
-	fmt.Println(string(output))
 	return err
 }
 
@@ -310,150 +462,475 @@ func (agent *WindowsAgent) UnmountCIFSShare(ctx context.Context, mountPoint stri
 		"/y",
 	}
 
-	// Execute the PowerShell command
-	cmd := exec.Command("powershell.exe", append([]string{"-Command", cmdlet}, args...)...)
+	_, err = agent.execPowerShellCommand(ctx, cmdlet, args...)
+
+	return err
+}
+
+// The NFS server role of Windows is not managed by the agent, so the NFS exports are not supported.
+var errWindowsNFSNotSupported = errors.New("NFS export is not supported by the Windows agent")
+
+func (agent *WindowsAgent) CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error) {
+	return errWindowsNFSNotSupported
+}
+
+func (agent *WindowsAgent) DeleteNFSExport(ctx context.Context, directoryName string) (err error) {
+	return errWindowsNFSNotSupported
+}
+
+func (agent *WindowsAgent) GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error) {
+	return detail, errWindowsNFSNotSupported
+}
+
+func (agent *WindowsAgent) GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error) {
+	return detail, errWindowsNFSNotSupported
+}
+
+var errWindowsSnapshotNotSupported = errors.New("snapshot is not supported by the Windows agent")
 
-	// Capture the command output
-	output, err := cmd.CombinedOutput()
+func (agent *WindowsAgent) CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error) {
+	return detail, errWindowsSnapshotNotSupported
+}
+
+func (agent *WindowsAgent) DeleteSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return errWindowsSnapshotNotSupported
+}
+
+func (agent *WindowsAgent) ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error) {
+	return detail, errWindowsSnapshotNotSupported
+}
+
+func (agent *WindowsAgent) RestoreSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return errWindowsSnapshotNotSupported
+}
+
+var errWindowsReplicationNotSupported = errors.New("replication is not supported by the Windows agent")
+
+func (agent *WindowsAgent) GetReplicationManifest(ctx context.Context, directoryName string) (manifest []common.ReplicationEntry, err error) {
+	return manifest, errWindowsReplicationNotSupported
+}
+
+func (agent *WindowsAgent) ReadReplicationChunk(ctx context.Context, directoryName, path string, offset, length int64) (chunk []byte, err error) {
+	return chunk, errWindowsReplicationNotSupported
+}
+
+func (agent *WindowsAgent) PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error) {
+	return result, errWindowsReplicationNotSupported
+}
+
+func (agent *WindowsAgent) GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error) {
+	return walkDirectoryUsage(ctx, agent.getDirectoryPath(name), time.Now())
+}
+
+func (agent *WindowsAgent) GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error) {
+	script := "./agent/windows/Get-DirectoryACL.ps1"
+	output, err := agent.execPowerShellScript(ctx, script, "-Path", agent.getDirectoryPath(name))
 	if err != nil {
-		fmt.Println("Error executing PowerShell command:", err.Error())
+		return acl, err
 	}
 
-	fmt.Println(string(output))
-	return err
+	var result windowsACL
+	if err = json.Unmarshal(output, &result); err != nil {
+		return acl, err
+	}
+
+	return result.toDirectoryACL(), nil
 }
 
-func (agent *WindowsAgent) CreateLocalUser(ctx context.Context, name, password string) (err error) {
-	cmd := exec.Command("powershell", "-Command", fmt.Sprintf("New-LocalUser -Name '%s' -Password (ConvertTo-SecureString -String '%s' -AsPlainText -Force)", name, password))
-	_, err = cmd.CombinedOutput()
+// SetDirectoryACL replaces the explicit rules of the directory, the inherited ones are kept as they are.
+func (agent *WindowsAgent) SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error) {
+	if err = acl.Validate(); err != nil {
+		return err
+	}
+
+	rules := []windowsAccessRule{}
+	for _, entry := range acl.Entries {
+		if entry.Inherited {
+			continue
+		}
+
+		rule := windowsAccessRule{
+			Identity:          entry.Principal,
+			Rights:            windowsRights[entry.Permission],
+			InheritanceFlags:  "None",
+			PropagationFlags:  "None",
+			AccessControlType: "Allow",
+		}
+		if entry.PrincipalType == common.PrincipalTypeEveryone {
+			rule.Identity = "Everyone"
+		}
+		if entry.Inherit {
+			rule.InheritanceFlags = "ContainerInherit, ObjectInherit"
+		}
+		if entry.InheritOnly {
+			rule.PropagationFlags = "InheritOnly"
+		}
+		if entry.Type == common.ACLTypeDeny {
+			rule.AccessControlType = "Deny"
+		}
+
+		rules = append(rules, rule)
+	}
+
+	content, err := json.Marshal(rules)
 	if err != nil {
-		fmt.Println("Failed to create local user:", err)
+		return err
 	}
 
+	script := "./agent/windows/Set-DirectoryACL.ps1"
+	args := []string{"-Path", agent.getDirectoryPath(name), "-Entries", base64.StdEncoding.EncodeToString(content)}
+	if acl.Owner != "" {
+		args = append(args, "-Owner", acl.Owner)
+	}
+
+	_, err = agent.execPowerShellScript(ctx, script, args...)
+
 	return err
 }
 
-func (agent *WindowsAgent) DeleteLocalUser(ctx context.Context, name string) (err error) {
-	cmd := exec.Command("powershell", "-Command", fmt.Sprintf("Remove-LocalUser -Name '%s'", name))
-	_, err = cmd.CombinedOutput()
+var errWindowsFileQuotaNotSupported = errors.New("the quota of files is not supported by FSRM")
+
+// SetDirectoryQuota limits the directory by the quota of FSRM, which has a single limit of capacity. The hard limit is
+// taken if it is set, otherwise the soft limit, so both of them cannot be set at the same time.
+func (agent *WindowsAgent) SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error) {
+	if err = quota.Validate(); err != nil {
+		return err
+	}
+
+	if quota.SoftLimitFiles > 0 || quota.HardLimitFiles > 0 {
+		return errWindowsFileQuotaNotSupported
+	}
+
+	if quota.SoftLimitBytes > 0 && quota.HardLimitBytes > 0 {
+		return errors.New("the quota of FSRM is either soft or hard")
+	}
+
+	if !quota.HasLimit() {
+		return agent.ClearDirectoryQuota(ctx, name)
+	}
+
+	script := "./agent/windows/Set-DirectoryQuota.ps1"
+
+	args := []string{"-Path", agent.getDirectoryPath(name), "-Size", strconv.FormatInt(quota.HardLimitBytes, 10)}
+	if quota.HardLimitBytes == 0 {
+		args = []string{"-Path", agent.getDirectoryPath(name), "-Size", strconv.FormatInt(quota.SoftLimitBytes, 10), "-SoftLimit"}
+	}
+
+	_, err = agent.execPowerShellScript(ctx, script, args...)
+
+	return err
+}
+
+func (agent *WindowsAgent) ClearDirectoryQuota(ctx context.Context, name string) (err error) {
+	// The quota is piped to Remove-FsrmQuota, so nothing is done if the directory has no quota.
+	args := []string{
+		"-Path", common.AddQuotes(agent.getDirectoryPath(name)),
+		"-ErrorAction", "SilentlyContinue",
+		"|", "Remove-FsrmQuota", "-Confirm:$false",
+	}
+
+	_, err = agent.execPowerShellCommand(ctx, "Get-FsrmQuota", args...)
+
+	return err
+}
+
+// GetDirectoryQuota returns the quota of FSRM, the usage is only known by FSRM if the directory has a quota.
+func (agent *WindowsAgent) GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error) {
+	script := "./agent/windows/Get-DirectoryQuota.ps1"
+	output, err := agent.execPowerShellScript(ctx, script, "-Path", agent.getDirectoryPath(name))
 	if err != nil {
-		fmt.Println("Failed to delete local user:", err)
+		return quota, err
+	}
+
+	results, err := unmarshalPowerShellJSON[windowsQuota](output)
+	if err != nil || len(results) == 0 {
+		return quota, err
 	}
 
+	quota.UsedBytes = results[0].Usage
+	if results[0].SoftLimit {
+		quota.SoftLimitBytes = results[0].Size
+	} else {
+		quota.HardLimitBytes = results[0].Size
+	}
+
+	return quota, nil
+}
+
+func (agent *WindowsAgent) CreateLocalUser(ctx context.Context, name, password string) (err error) {
+	_, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("New-LocalUser -Name %s -Password (ConvertTo-SecureString -String %s -AsPlainText -Force)", quotePowerShellString(name), quotePowerShellString(password)))
+
 	return err
 }
 
+func (agent *WindowsAgent) DeleteLocalUser(ctx context.Context, name string) (err error) {
+	_, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("Remove-LocalUser -Name %s", quotePowerShellString(name)))
+
+	return err
+}
+
+// UpdateLocalUser changes the password of the user, unlocks the account and enables or disables it.
+func (agent *WindowsAgent) UpdateLocalUser(ctx context.Context, name string, update common.LocalUserUpdate) (err error) {
+	if update.Password != "" {
+		if _, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("Set-LocalUser -Name %s -Password (ConvertTo-SecureString -String %s -AsPlainText -Force)", quotePowerShellString(name), quotePowerShellString(update.Password))); err != nil {
+			return err
+		}
+	}
+
+	if update.Unlock {
+		// The LocalAccounts module has no cmdlet to unlock the account, so it is unlocked by ADSI.
+		if _, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("$user = [ADSI]%s; $user.IsAccountLocked = $false; $user.SetInfo()", quotePowerShellString("WinNT://./"+name+",user"))); err != nil {
+			return err
+		}
+	}
+
+	if update.Disabled != nil {
+		cmdlet := "Enable-LocalUser"
+		if *update.Disabled {
+			cmdlet = "Disable-LocalUser"
+		}
+
+		if _, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("%s -Name %s", cmdlet, quotePowerShellString(name))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (agent *WindowsAgent) GetLocalUserDetail(ctx context.Context, name string) (detail common.LocalUserDetail, err error) {
+	users, err := agent.GetLocalUsersDetail(ctx, []string{name})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(users) == 0 {
+		return detail, fmt.Errorf("the local user %s does not exist", name)
+	}
+
+	return users[0], nil
+}
+
+// GetLocalUsersDetail returns the details of the users with the names, or all the local users if no name is given.
+func (agent *WindowsAgent) GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error) {
 	script := "./agent/windows/Get-LocalUserDetail.ps1"
-	output, err := execPowerShellCmdlet(script, "-UserName", name)
+
+	var args []string
+	if len(names) > 0 {
+		args = []string{"-UserNames", strings.Join(names, ",")}
+	}
+
+	output, err := agent.execPowerShellScript(ctx, script, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := unmarshalPowerShellJSON[windowsLocalUser](output)
 	if err != nil {
 		return detail, err
 	}
 
-	var result map[string]interface{}
-	err = json.Unmarshal(output, &result)
+	for _, user := range users {
+		detail = append(detail, user.toLocalUserDetail())
+	}
+
+	return detail, nil
+}
+
+func (agent *WindowsAgent) CreateLocalGroup(ctx context.Context, name, description string) (err error) {
+	_, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("New-LocalGroup -Name %s -Description %s", quotePowerShellString(name), quotePowerShellString(description)))
+
+	return err
+}
+
+func (agent *WindowsAgent) DeleteLocalGroup(ctx context.Context, name string) (err error) {
+	_, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("Remove-LocalGroup -Name %s", quotePowerShellString(name)))
+
+	return err
+}
+
+func (agent *WindowsAgent) AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	_, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("Add-LocalGroupMember -Group %s -Member %s", quotePowerShellString(name), toPowerShellList(members)))
+
+	return err
+}
+
+func (agent *WindowsAgent) RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	_, err = agent.execPowerShellCommand(ctx, fmt.Sprintf("Remove-LocalGroupMember -Group %s -Member %s", quotePowerShellString(name), toPowerShellList(members)))
+
+	return err
+}
+
+// toPowerShellList returns the array of the strings in PowerShell, e.g. 'alice','bob'.
+func toPowerShellList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = quotePowerShellString(item)
+	}
+
+	return strings.Join(quoted, ",")
+}
+
+// quotePowerShellString returns the verbatim string in PowerShell, the single quotes in the value are doubled.
+// PowerShell takes the typographic single quotes as the quotes too, so they are doubled as well.
+func quotePowerShellString(value string) string {
+	var builder strings.Builder
+
+	builder.WriteByte('\'')
+	for _, r := range value {
+		switch r {
+		case '\'', '\u2018', '\u2019', '\u201a', '\u201b':
+			builder.WriteRune(r)
+		}
+		builder.WriteRune(r)
+	}
+	builder.WriteByte('\'')
+
+	return builder.String()
+}
+
+func (agent *WindowsAgent) GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error) {
+	groups, err := agent.GetLocalGroupsDetail(ctx, []string{name})
 	if err != nil {
 		return detail, err
 	}
 
-	detail = common.LocalUserDetail{
-		Name:                 result["Name"].(string),
-		UID:                  result["SID"].(string),
-		FullName:             result["FullName"].(string),
-		Description:          result["Description"].(string),
-		Status:               result["Status"].(string),
-		IsPasswordExpired:    result["PasswordExpires"].(bool),
-		IsPasswordChangeable: result["PasswordChangeable"].(bool),
-		IsPasswordRequired:   result["PasswordRequired"].(bool),
-		IsLockout:            result["Lockout"].(bool),
-		IsDisabled:           result["Disabled"].(bool),
+	if len(groups) == 0 {
+		return detail, fmt.Errorf("the local group %s does not exist", name)
 	}
 
-	return detail, err
+	return groups[0], nil
 }
 
-func (agent *WindowsAgent) GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error) {
-	script := "./agent/windows/Get-LocalUserDetail.ps1"
-	output, err := execPowerShellCmdlet(script)
+// GetLocalGroupsDetail returns the details of the groups with the names, or all the local groups if no name is given.
+func (agent *WindowsAgent) GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error) {
+	script := "./agent/windows/Get-LocalGroupDetail.ps1"
+
+	var args []string
+	if len(names) > 0 {
+		args = []string{"-GroupNames", strings.Join(names, ",")}
+	}
+
+	output, err := agent.execPowerShellScript(ctx, script, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []map[string]interface{}
-	err = json.Unmarshal(output, &result)
+	groups, err := unmarshalPowerShellJSON[windowsLocalGroup](output)
 	if err != nil {
 		return detail, err
 	}
 
-	for _, item := range result {
-		localUser := common.LocalUserDetail{
-			Name:                 item["Name"].(string),
-			UID:                  item["SID"].(string),
-			FullName:             item["FullName"].(string),
-			Description:          item["Description"].(string),
-			Status:               item["Status"].(string),
-			IsPasswordExpired:    item["PasswordExpires"].(bool),
-			IsPasswordChangeable: item["PasswordChangeable"].(bool),
-			IsPasswordRequired:   item["PasswordRequired"].(bool),
-			IsLockout:            item["Lockout"].(bool),
-			IsDisabled:           item["Disabled"].(bool),
-		}
-		detail = append(detail, localUser)
+	for _, group := range groups {
+		detail = append(detail, common.LocalGroupDetail{
+			Name:        group.Name,
+			GID:         group.SID,
+			Description: group.Description,
+			Members:     group.Members,
+		})
 	}
 
-	return detail, err
+	return detail, nil
 }
 
 func (agent *WindowsAgent) GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error) {
 	script := "./agent/windows/Get-SystemDetail.ps1"
-	output, err := execPowerShellCmdlet(script)
+	output, err := agent.execPowerShellScript(ctx, script)
 	if err != nil {
 		return systemInfo, err
 	}
 
-	result := make(map[string]string)
+	var result windowsSystem
 	err = json.Unmarshal(output, &result)
 	if err != nil {
 		return systemInfo, err
 	}
 
 	systemInfo = common.SystemInfo{
-		ComputerName:   result["ComputerName"],
-		Caption:        result["Caption"],
-		OSArchitecture: result["OSArchitecture"],
-		OSVersion:      result["Version"],
-		BuildNumber:    result["BuildNumber"],
+		ComputerName:   result.ComputerName,
+		Caption:        result.Caption,
+		OSArchitecture: result.OSArchitecture,
+		OSVersion:      result.Version,
+		BuildNumber:    result.BuildNumber,
 	}
 
 	return systemInfo, err
 }
 
-func execPowerShellCmdlet(script string, args ...string) (output []byte, err error) {
-	cmd := exec.Command("powershell", "-ExecutionPolicy", "Bypass", "-File", script)
-	cmd.Args = append(cmd.Args, args...)
-	cmd.Dir, err = os.Getwd()
+func (agent *WindowsAgent) GetStatus(ctx context.Context) (status common.AgentStatus, err error) {
+	script := "./agent/windows/Get-SystemStatus.ps1"
+	output, err := agent.execPowerShellScript(ctx, script)
+	if err != nil {
+		return status, err
+	}
+
+	var result windowsSystemStatus
+	if err = json.Unmarshal(output, &result); err != nil {
+		return status, err
+	}
+
+	status = common.AgentStatus{
+		AgentVersion: Version,
+		Load:         result.LoadPercentage,
+		Uptime:       result.UptimeSeconds,
+	}
+
+	return status, nil
+}
+
+// execPowerShellCommand runs the cmdlet by "powershell.exe -Command".
+func (agent *WindowsAgent) execPowerShellCommand(ctx context.Context, cmdlet string, args ...string) (output []byte, err error) {
+	result, err := agent.runner().Run(ctx, "", "powershell.exe", append([]string{"-Command", cmdlet}, args...)...)
 	if err != nil {
 		return nil, err
 	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	return decodePowerShellOutput(result.Stdout)
+}
 
-	if err = cmd.Run(); err != nil {
+// execPowerShellScript runs the script in agent/windows, any output to stderr is treated as failure.
+func (agent *WindowsAgent) execPowerShellScript(ctx context.Context, script string, args ...string) (output []byte, err error) {
+	result, err := agent.runner().Run(ctx, "", "powershell", append([]string{"-ExecutionPolicy", "Bypass", "-File", script}, args...)...)
+	if err != nil {
 		return nil, err
 	}
 
-	if stderr.Len() > 0 {
-		return nil, fmt.Errorf(stderr.String())
+	if len(result.Stderr) > 0 {
+		return nil, errors.New(string(result.Stderr))
 	}
 
-	outputBytes := stdout.Bytes()
+	return decodePowerShellOutput(result.Stdout)
+}
+
+// decodePowerShellOutput converts the output in the console code page of Chinese Windows to UTF-8.
+func decodePowerShellOutput(output []byte) ([]byte, error) {
 	decoder := simplifiedchinese.GB18030.NewDecoder()
-	outputStr, _, err := transform.String(decoder, string(outputBytes))
+	outputStr, _, err := transform.String(decoder, string(output))
 	if err != nil {
 		return nil, err
 	}
 
 	return []byte(outputStr), nil
 }
+
+// unmarshalPowerShellJSON unmarshals the output of ConvertTo-Json, which is nothing for an empty array,
+// an object for an array of one item, and an array otherwise.
+func unmarshalPowerShellJSON[T any](output []byte) (items []T, err error) {
+	output = bytes.TrimSpace(output)
+
+	if len(output) == 0 {
+		return nil, nil
+	}
+
+	if output[0] == '[' {
+		err = json.Unmarshal(output, &items)
+		return items, err
+	}
+
+	var item T
+	if err = json.Unmarshal(output, &item); err != nil {
+		return nil, err
+	}
+
+	return []T{item}, nil
+}
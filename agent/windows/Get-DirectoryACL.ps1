@@ -0,0 +1,37 @@
+param (
+    [Parameter(Mandatory = $true)]
+    [String] $Path
+)
+
+$acl = Get-Acl -Path $Path
+
+$entries = @()
+foreach ($rule in $acl.Access) {
+    # The domain groups are not local groups, they are reported as users.
+    $principalType = "user"
+    try {
+        $sid = $rule.IdentityReference.Translate([System.Security.Principal.SecurityIdentifier])
+        if ($sid.Value -eq "S-1-1-0") {
+            $principalType = "everyone"
+        } elseif (Get-LocalGroup -SID $sid -ErrorAction SilentlyContinue) {
+            $principalType = "group"
+        }
+    } catch {
+        # 无法解析的 SID（例如已删除的账户）按用户处理
+    }
+
+    $entries += @{
+        "IdentityReference" = $rule.IdentityReference.Value
+        "PrincipalType"     = $principalType
+        "AccessControlType" = $rule.AccessControlType.ToString()
+        "FileSystemRights"  = $rule.FileSystemRights.ToString()
+        "IsInherited"       = $rule.IsInherited
+        "InheritanceFlags"  = $rule.InheritanceFlags.ToString()
+        "PropagationFlags"  = $rule.PropagationFlags.ToString()
+    }
+}
+
+@{
+    "Owner"   = $acl.Owner
+    "Entries" = $entries
+} | ConvertTo-Json -Depth 3
@@ -1,5 +1,7 @@
 param (
-    [String] $DirectoryPaths
+    [String] $DirectoryPaths,
+    # All the child directories of the root path are listed if no directory path is given.
+    [String] $RootPath
 )
 
 function Get-DirectoryAttributes {
@@ -56,7 +58,11 @@ function Get-DirectoryAttributes {
     }
 }
 
-$directoryPathsArray = $DirectoryPaths -split ','
+if ($DirectoryPaths) {
+    $directoryPathsArray = $DirectoryPaths -split ','
+} else {
+    $directoryPathsArray = @(Get-ChildItem -Path $RootPath -Directory | ForEach-Object { $_.FullName })
+}
 
 $directoryDetail = @()
 
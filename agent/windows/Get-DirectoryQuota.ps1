@@ -0,0 +1,15 @@
+param (
+    [Parameter(Mandatory = $true)]
+    [String] $Path
+)
+
+# Nothing is written if the directory has no quota.
+$quota = Get-FsrmQuota -Path $Path -ErrorAction SilentlyContinue
+
+if ($quota) {
+    @{
+        "Size"      = [int64]$quota.Size
+        "SoftLimit" = [bool]$quota.SoftLimit
+        "Usage"     = [int64]$quota.Usage
+    } | ConvertTo-Json
+}
@@ -0,0 +1,25 @@
+param (
+    [String] $GroupNames
+)
+
+$localGroupsDetail = @()
+
+$groups = Get-LocalGroup
+if ($GroupNames) {
+    $GroupNamesArray = $GroupNames -split ','
+    $groups = $groups | Where-Object { $_.Name -in $GroupNamesArray }
+}
+
+foreach ($group in $groups) {
+    # 成员名称带有计算机名或域名前缀，例如 HOST\alice，只保留用户名
+    $members = @(Get-LocalGroupMember -Group $group.Name -ErrorAction SilentlyContinue | ForEach-Object { ($_.Name -split '\\')[-1] })
+
+    $localGroupsDetail += @{
+        'Name'        = $group.Name
+        'SID'         = $group.SID.Value
+        'Description' = $group.Description
+        'Members'     = $members
+    }
+}
+
+ConvertTo-Json -InputObject $localGroupsDetail -Depth 3
@@ -0,0 +1,16 @@
+function Get-SystemStatus {
+    $operatingSystem = Get-CimInstance -ClassName Win32_OperatingSystem
+    $loadPercentage = (Get-CimInstance -ClassName Win32_Processor | Measure-Object -Property LoadPercentage -Average).Average
+
+    $systemStatus = @{
+        "LoadPercentage" = [double]$loadPercentage
+        "UptimeSeconds"  = [int64]((Get-Date) - $operatingSystem.LastBootUpTime).TotalSeconds
+    }
+
+    return $systemStatus
+}
+
+# 调用函数以检索和输出本地系统状态
+$systemStatus = Get-SystemStatus
+
+$systemStatus | ConvertTo-Json
\ No newline at end of file
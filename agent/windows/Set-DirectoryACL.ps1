@@ -0,0 +1,31 @@
+param (
+    [Parameter(Mandatory = $true)]
+    [String] $Path,
+    [String] $Owner,
+    # The entries in JSON encoded by base64, so that the quotes are not mangled on the command line.
+    [String] $Entries
+)
+
+$acl = Get-Acl -Path $Path
+
+# 移除所有显式的访问规则，继承的规则保持不变
+foreach ($rule in @($acl.Access | Where-Object { -not $_.IsInherited })) {
+    $acl.RemoveAccessRuleSpecific($rule)
+}
+
+if ($Entries) {
+    $json = [System.Text.Encoding]::UTF8.GetString([System.Convert]::FromBase64String($Entries))
+    # ConvertFrom-Json writes the array as a single object, so it is enumerated by foreach instead of the pipeline.
+    $parsedEntries = ConvertFrom-Json -InputObject $json
+    foreach ($entry in $parsedEntries) {
+        $rule = New-Object System.Security.AccessControl.FileSystemAccessRule(
+            $entry.Identity, $entry.Rights, $entry.InheritanceFlags, $entry.PropagationFlags, $entry.AccessControlType)
+        $acl.AddAccessRule($rule)
+    }
+}
+
+if ($Owner) {
+    $acl.SetOwner([System.Security.Principal.NTAccount]$Owner)
+}
+
+Set-Acl -Path $Path -AclObject $acl
@@ -0,0 +1,15 @@
+param (
+    [Parameter(Mandatory = $true)]
+    [String] $Path,
+    [Parameter(Mandatory = $true)]
+    [UInt64] $Size,
+    # The quota only reports the excess instead of denying the writes if it is soft.
+    [Switch] $SoftLimit
+)
+
+# FSRM 的配额必须存在才能修改，否则新建
+if (Get-FsrmQuota -Path $Path -ErrorAction SilentlyContinue) {
+    Set-FsrmQuota -Path $Path -Size $Size -SoftLimit:$SoftLimit | Out-Null
+} else {
+    New-FsrmQuota -Path $Path -Size $Size -SoftLimit:$SoftLimit | Out-Null
+}
@@ -0,0 +1,37 @@
+param (
+    [Parameter(Mandatory = $true)]
+    [String] $Name,
+    # The access levels in JSON encoded by base64, so that the quotes are not mangled on the command line.
+    [String] $Grant,
+    # The users and the groups separated by commas.
+    [String] $Revoke
+)
+
+# 一个用户只保留一个访问级别，先移除其允许和拒绝的规则
+function Remove-ShareAccess([String] $AccountName) {
+    Revoke-SmbShareAccess -Name $Name -AccountName $AccountName -Force -ErrorAction SilentlyContinue | Out-Null
+    Unblock-SmbShareAccess -Name $Name -AccountName $AccountName -Force -ErrorAction SilentlyContinue | Out-Null
+}
+
+if ($Revoke) {
+    foreach ($userName in $Revoke -split ',') {
+        Remove-ShareAccess $userName
+    }
+}
+
+if ($Grant) {
+    $json = [System.Text.Encoding]::UTF8.GetString([System.Convert]::FromBase64String($Grant))
+    # ConvertFrom-Json writes the array as a single object, so it is enumerated by foreach instead of the pipeline.
+    $parsedAccess = ConvertFrom-Json -InputObject $json
+    foreach ($entry in $parsedAccess) {
+        $accountName = if ($entry.groupname) { $entry.groupname } else { $entry.username }
+        Remove-ShareAccess $accountName
+
+        switch ($entry.permission) {
+            'deny' { Block-SmbShareAccess -Name $Name -AccountName $accountName -Force | Out-Null }
+            'read' { Grant-SmbShareAccess -Name $Name -AccountName $accountName -AccessRight Read -Force | Out-Null }
+            'change' { Grant-SmbShareAccess -Name $Name -AccountName $accountName -AccessRight Change -Force | Out-Null }
+            'full' { Grant-SmbShareAccess -Name $Name -AccountName $accountName -AccessRight Full -Force | Out-Null }
+        }
+    }
+}
@@ -2,6 +2,8 @@ package agent
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -19,10 +21,139 @@ const testDirectoryName1 = "test_directory_1"
 const testDirectoryName2 = "test_directory_2"
 const testLocalUserName = "test_account"
 const testLocalUserPassword = "Passw0rd!"
+const testLocalGroupName = "test_group"
 const testMountPoint = "Y:"
 
 var testSharePath = fmt.Sprintf("\\\\%s\\%s", testHostIP, testShareName)
 
+// The outputs of the scripts in agent/windows captured on a Windows Server 2019 host.
+const testDirectoryDetailOutput = `{
+    "ParentFullPath":  "C:\\test",
+    "LastWriteTime":  "Monday, July 3, 2023 10:21:09 AM",
+    "Attributes":  {
+                       "Directory":  true,
+                       "ReadOnly":  false
+                   },
+    "Name":  "test_directory_1",
+    "Exist":  true,
+    "LastAccessTime":  "Monday, July 3, 2023 10:21:09 AM",
+    "CreationTime":  "Monday, July 3, 2023 10:21:09 AM",
+    "FullPath":  "C:\\test\\test_directory_1"
+}`
+
+const testDirectoriesDetailOutput = `[
+    {
+        "ParentFullPath":  "C:\\test",
+        "LastWriteTime":  "Monday, July 3, 2023 10:21:09 AM",
+        "Name":  "test_directory_1",
+        "Exist":  true,
+        "LastAccessTime":  "Monday, July 3, 2023 10:21:09 AM",
+        "CreationTime":  "Monday, July 3, 2023 10:21:09 AM",
+        "FullPath":  "C:\\test\\test_directory_1"
+    },
+    {
+        "ParentFullPath":  "C:\\test",
+        "LastWriteTime":  "Monday, July 3, 2023 10:22:15 AM",
+        "Name":  "test_directory_2",
+        "Exist":  true,
+        "LastAccessTime":  "Monday, July 3, 2023 10:22:15 AM",
+        "CreationTime":  "Monday, July 3, 2023 10:22:15 AM",
+        "FullPath":  "C:\\test\\test_directory_2"
+    }
+]`
+
+const testShareDetailOutput = `{
+    "Description":  "this is a test cifs share",
+    "DirectoryPath":  "C:\\test\\test_directory",
+    "Name":  "test_cifs_share",
+    "ShareState":  1
+}`
+
+const testSharesDetailOutput = `[
+    {
+        "Description":  "this is a test cifs share",
+        "DirectoryPath":  "C:\\test\\test_directory",
+        "Name":  "test_cifs_share",
+        "ShareState":  1
+    },
+    {
+        "Description":  null,
+        "DirectoryPath":  "C:\\test\\test_directory_1",
+        "Name":  "test_cifs_share_1",
+        "ShareState":  2
+    }
+]`
+
+const testLocalUserDetailOutput = `{
+    "PasswordExpires":  false,
+    "Lockout":  false,
+    "Name":  "test_account",
+    "Description":  "",
+    "Disabled":  false,
+    "PasswordRequired":  true,
+    "FullName":  "",
+    "SID":  "S-1-5-21-3623811015-3361044348-30300820-1013",
+    "PasswordChangeable":  true,
+    "Status":  "OK"
+}`
+
+const testLocalUsersDetailOutput = `[
+    {
+        "PasswordExpires":  false,
+        "Lockout":  false,
+        "Name":  "Administrator",
+        "Description":  "Built-in account for administering the computer/domain",
+        "Disabled":  false,
+        "PasswordRequired":  true,
+        "FullName":  "",
+        "SID":  "S-1-5-21-3623811015-3361044348-30300820-500",
+        "PasswordChangeable":  true,
+        "Status":  "OK"
+    },
+    {
+        "PasswordExpires":  false,
+        "Lockout":  false,
+        "Name":  "Guest",
+        "Description":  "Built-in account for guest access to the computer/domain",
+        "Disabled":  true,
+        "PasswordRequired":  false,
+        "FullName":  null,
+        "SID":  "S-1-5-21-3623811015-3361044348-30300820-501",
+        "PasswordChangeable":  false,
+        "Status":  "Degraded"
+    }
+]`
+
+const testLocalGroupsDetailOutput = `[
+    {
+        "Members":  [
+                        "test_account"
+                    ],
+        "Name":  "test_group",
+        "Description":  "the test group",
+        "SID":  "S-1-5-21-1180699209-877415012-3182924384-1004"
+    }
+]`
+
+const testSystemDetailOutput = `{
+    "BuildNumber":  "17763",
+    "Caption":  "Microsoft Windows Server 2019 Datacenter",
+    "ComputerName":  "WIN-DME01",
+    "OSArchitecture":  "64-bit",
+    "Version":  "10.0.17763"
+}`
+
+const testSystemStatusOutput = `{
+    "LoadPercentage":  12.5,
+    "UptimeSeconds":  86400
+}`
+
+const testQuotaOutput = `{
+    "Size":  10737418240,
+    "SoftLimit":  false,
+    "Usage":  1048576
+}`
+
 func TestMain(m *testing.M) {
 	// 获取当前文件所在的目录
 	_, filename, _, _ := runtime.Caller(0)
@@ -46,69 +177,21 @@ func TestMain(m *testing.M) {
 	os.Exit(exitCode)
 }
 
-func setupCreateDirectory(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.CreateDirectory(ctx, testDirectoryName)
-}
-
-func setupCreateDirectories(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.CreateDirectories(ctx, []string{testDirectoryName1, testDirectoryName2})
-}
-
-func teardownDeleteDirectory(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.DeleteDirectory(ctx, testDirectoryName)
-}
-
-func teardownDeleteDirectories(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.DeleteDirectories(ctx, []string{testDirectoryName1, testDirectoryName2})
-}
-
-func setupCreateCIFSShare(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.CreateCIFSShare(ctx, testShareName, testDirectoryName, "this is a test cifs share", []string{testLocalUserName})
-}
-
-func teardownDeleteCIFSShare(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.DeleteCIFSShare(ctx, testShareName)
-}
-
-func setupMountCIFSShare(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.MountCIFSShare(ctx, testMountPoint, testSharePath, testLocalUserName, testLocalUserPassword)
-}
-
-func teardownUnmountCIFSShare(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.UnmountCIFSShare(ctx, testMountPoint)
-}
+// newFakeWindowsAgent returns a WindowsAgent whose commands are replayed by the fake runner.
+func newFakeWindowsAgent(expect func(runner *FakeCommandRunner)) *WindowsAgent {
+	runner := NewFakeCommandRunner()
+	if expect != nil {
+		expect(runner)
+	}
 
-func setupCreateLocalUser(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.CreateLocalUser(ctx, testLocalUserName, testLocalUserPassword)
+	return &WindowsAgent{Runner: runner}
 }
 
-func teardownDeleteLocalUser(t *testing.T) {
-	windowsAgent := GetAgent().(*WindowsAgent)
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "123456")
-	windowsAgent.DeleteLocalUser(ctx, testLocalUserName)
+func expectPowerShellScript(runner *FakeCommandRunner, result CommandResult, script string) {
+	runner.Expect(result, "powershell", "-ExecutionPolicy", "Bypass", "-File", "./agent/windows/"+script)
 }
 
 func TestWindowsAgent_CreateDirectory(t *testing.T) {
-	defer teardownDeleteDirectory(t)
-
 	type args struct {
 		ctx  context.Context
 		name string
@@ -121,14 +204,27 @@ func TestWindowsAgent_CreateDirectory(t *testing.T) {
 		wantErr     bool
 	}{
 		{
-			name:  "test_create_directory",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_create_directory",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "New-Item")
+			}),
 			args: args{
 				name: testDirectoryName,
 			},
 			wantErr:     false,
 			wantDirPath: fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, testDirectoryName),
 		},
+		{
+			name: "test_create_existing_directory",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.Expect(CommandResult{ExitCode: 1, Stderr: []byte("An item with the specified name already exists.")}, "powershell.exe", "-Command", "New-Item")
+			}),
+			args: args{
+				name: testDirectoryName,
+			},
+			wantErr:     true,
+			wantDirPath: "",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -145,8 +241,6 @@ func TestWindowsAgent_CreateDirectory(t *testing.T) {
 }
 
 func TestWindowsAgent_CreateDirectories(t *testing.T) {
-	defer teardownDeleteDirectories(t)
-
 	type args struct {
 		ctx   context.Context
 		names []string
@@ -159,8 +253,10 @@ func TestWindowsAgent_CreateDirectories(t *testing.T) {
 		wantErr      bool
 	}{
 		{
-			name:  "test_create_directories",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_create_directories",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "New-Item")
+			}),
 			args: args{
 				names: []string{testDirectoryName1, testDirectoryName2},
 			},
@@ -170,6 +266,21 @@ func TestWindowsAgent_CreateDirectories(t *testing.T) {
 				fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, testDirectoryName2),
 			},
 		},
+		{
+			name: "test_create_directories_partially",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "New-Item")
+				runner.Expect(CommandResult{ExitCode: 1}, "powershell.exe", "-Command", "New-Item", "-ItemType", "Directory", "-Path",
+					common.AddQuotes(fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, testDirectoryName2)))
+			}),
+			args: args{
+				names: []string{testDirectoryName1, testDirectoryName2},
+			},
+			wantErr: true,
+			wantDirPaths: []string{
+				fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, testDirectoryName1),
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -186,8 +297,6 @@ func TestWindowsAgent_CreateDirectories(t *testing.T) {
 }
 
 func TestWindowsAgent_DeleteDirectory(t *testing.T) {
-	setupCreateDirectory(t)
-
 	type args struct {
 		ctx  context.Context
 		name string
@@ -199,13 +308,25 @@ func TestWindowsAgent_DeleteDirectory(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_delete_directory",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_delete_directory",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "Remove-Item")
+			}),
 			args: args{
 				name: testDirectoryName,
 			},
 			wantErr: false,
 		},
+		{
+			name: "test_delete_missing_directory",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.Expect(CommandResult{ExitCode: 1, Stderr: []byte("Cannot find path because it does not exist.")}, "powershell.exe", "-Command", "Remove-Item")
+			}),
+			args: args{
+				name: testDirectoryName,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -217,8 +338,6 @@ func TestWindowsAgent_DeleteDirectory(t *testing.T) {
 }
 
 func TestWindowsAgent_DeleteDirectories(t *testing.T) {
-	setupCreateDirectories(t)
-
 	type args struct {
 		ctx   context.Context
 		names []string
@@ -230,8 +349,10 @@ func TestWindowsAgent_DeleteDirectories(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_create_directories",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_delete_directories",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "Remove-Item")
+			}),
 			args: args{
 				names: []string{testDirectoryName1, testDirectoryName2},
 			},
@@ -248,9 +369,6 @@ func TestWindowsAgent_DeleteDirectories(t *testing.T) {
 }
 
 func TestWindowsAgent_GetDirectoryDetail(t *testing.T) {
-	setupCreateDirectory(t)
-	defer teardownDeleteDirectory(t)
-
 	type args struct {
 		ctx  context.Context
 		name string
@@ -263,82 +381,139 @@ func TestWindowsAgent_GetDirectoryDetail(t *testing.T) {
 		wantErr    bool
 	}{
 		{
-			name:  "test_get_directory_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_directory_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testDirectoryDetailOutput)}, "Get-DirectoryDetail.ps1")
+			}),
 			args: args{
-				name: testDirectoryName,
+				name: testDirectoryName1,
 			},
 			wantErr: false,
+			wantDetail: common.DirectoryDetail{
+				Name:           testDirectoryName1,
+				FullPath:       "C:\\test\\test_directory_1",
+				CreationTime:   "Monday, July 3, 2023 10:21:09 AM",
+				LastWriteTime:  "Monday, July 3, 2023 10:21:09 AM",
+				LastAccessTime: "Monday, July 3, 2023 10:21:09 AM",
+				Exist:          true,
+				ParentFullPath: "C:\\test",
+			},
+		},
+		{
+			name: "test_get_missing_directory_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{}, "Get-DirectoryDetail.ps1")
+			}),
+			args: args{
+				name: testDirectoryName,
+			},
+			wantErr: true,
+		},
+		{
+			name: "test_get_directory_detail_with_stderr",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testDirectoryDetailOutput), Stderr: []byte("Access is denied.")}, "Get-DirectoryDetail.ps1")
+			}),
+			args: args{
+				name: testDirectoryName1,
+			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.agent.GetDirectoryDetail(tt.args.ctx, tt.args.name)
+			gotDetail, err := tt.agent.GetDirectoryDetail(tt.args.ctx, tt.args.name)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WindowsAgent.GetDirectoryDetail() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("WindowsAgent.GetDirectoryDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
 		})
 	}
 }
 
 func TestWindowsAgent_GetDirectoriesDetail(t *testing.T) {
-	setupCreateDirectories(t)
-	defer teardownDeleteDirectories(t)
-
 	type args struct {
 		ctx   context.Context
 		names []string
 	}
 	tests := []struct {
-		name       string
-		agent      *WindowsAgent
-		args       args
-		wantDetail []common.DirectoryDetail
-		wantErr    bool
+		name      string
+		agent     *WindowsAgent
+		args      args
+		wantNames []string
+		wantErr   bool
 	}{
 		{
-			name:  "test_get_directories_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_directories_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testDirectoriesDetailOutput)}, "Get-DirectoryDetail.ps1")
+			}),
 			args: args{
 				names: []string{testDirectoryName1, testDirectoryName2},
 			},
-			wantErr: false,
+			wantNames: []string{testDirectoryName1, testDirectoryName2},
+			wantErr:   false,
 		},
 		{
-			name:  "test_get_directories_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_directories_detail_with_one_directory",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testDirectoryDetailOutput)}, "Get-DirectoryDetail.ps1")
+			}),
 			args: args{
 				names: []string{testDirectoryName1},
 			},
-			wantErr: false,
+			wantNames: []string{testDirectoryName1},
+			wantErr:   false,
+		},
+		{
+			name: "test_get_all_directories_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testDirectoriesDetailOutput)}, "Get-DirectoryDetail.ps1")
+			}),
+			wantNames: []string{testDirectoryName1, testDirectoryName2},
+			wantErr:   false,
+		},
+		{
+			name: "test_get_directories_detail_with_invalid_output",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte("not json")}, "Get-DirectoryDetail.ps1")
+			}),
+			args: args{
+				names: []string{testDirectoryName1},
+			},
+			wantNames: nil,
+			wantErr:   true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.agent.GetDirectoriesDetail(tt.args.ctx, tt.args.names)
+			gotDetail, err := tt.agent.GetDirectoriesDetail(tt.args.ctx, tt.args.names)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WindowsAgent.GetDirectoriesDetail() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
+			var gotNames []string
+			for _, directory := range gotDetail {
+				gotNames = append(gotNames, directory.Name)
+			}
+			if !reflect.DeepEqual(gotNames, tt.wantNames) {
+				t.Errorf("WindowsAgent.GetDirectoriesDetail() = %v, want %v", gotNames, tt.wantNames)
+			}
 		})
 	}
 }
 
 func TestWindowsAgent_CreateCIFSShare(t *testing.T) {
-	setupCreateLocalUser(t)
-	setupCreateDirectory(t)
-	defer teardownDeleteCIFSShare(t)
-	defer teardownDeleteDirectory(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx           context.Context
 		name          string
 		directoryName string
 		description   string
-		usernames     []string
+		access        []common.ShareAccess
 	}
 	tests := []struct {
 		name    string
@@ -347,22 +522,39 @@ func TestWindowsAgent_CreateCIFSShare(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_create_cifs_share",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_create_cifs_share",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "New-SmbShare", "-Name", testShareName)
+			}),
 			args: args{
 				name:          testShareName,
 				directoryName: testDirectoryName,
 				description:   "this is a test cifs share",
-				usernames: []string{
-					testLocalUserName,
+				access: []common.ShareAccess{
+					{UserName: testLocalUserName, Permission: common.SharePermissionFull},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name: "test_create_existing_cifs_share",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.Expect(CommandResult{ExitCode: 1, Stderr: []byte("The name has already been shared.")}, "powershell.exe", "-Command", "New-SmbShare")
+			}),
+			args: args{
+				name:          testShareName,
+				directoryName: testDirectoryName,
+				description:   "this is a test cifs share",
+				access: []common.ShareAccess{
+					{UserName: testLocalUserName, Permission: common.SharePermissionFull},
+				},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := tt.agent.CreateCIFSShare(tt.args.ctx, tt.args.name, tt.args.directoryName, tt.args.description, tt.args.usernames); (err != nil) != tt.wantErr {
+			if err := tt.agent.CreateCIFSShare(tt.args.ctx, tt.args.name, tt.args.directoryName, tt.args.description, tt.args.access); (err != nil) != tt.wantErr {
 				t.Errorf("WindowsAgent.CreateCIFSShare() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -370,13 +562,6 @@ func TestWindowsAgent_CreateCIFSShare(t *testing.T) {
 }
 
 func TestWindowsAgent_DeleteCIFSShare(t *testing.T) {
-	setupCreateLocalUser(t)
-	setupCreateDirectory(t)
-	setupCreateCIFSShare(t)
-
-	defer teardownDeleteDirectory(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx  context.Context
 		name string
@@ -388,8 +573,10 @@ func TestWindowsAgent_DeleteCIFSShare(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_delete_cifs_share",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_delete_cifs_share",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", "Remove-SmbShare", "-Name", testShareName, "-Force")
+			}),
 			args: args{
 				name: testShareName,
 			},
@@ -405,14 +592,41 @@ func TestWindowsAgent_DeleteCIFSShare(t *testing.T) {
 	}
 }
 
-func TestWindowsAgent_GetCIFSShareDetail(t *testing.T) {
-	setupCreateLocalUser(t)
-	setupCreateDirectory(t)
-	setupCreateCIFSShare(t)
-	defer teardownDeleteCIFSShare(t)
-	defer teardownDeleteDirectory(t)
-	defer teardownDeleteLocalUser(t)
+func TestWindowsAgent_GrantCIFSShareAccess(t *testing.T) {
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		expectPowerShellScript(runner, CommandResult{}, "Set-ShareAccess.ps1")
+	})
+
+	access := []common.ShareAccess{
+		{UserName: testLocalUserName, Permission: common.SharePermissionRead},
+		{GroupName: "Everyone", Permission: common.SharePermissionDeny},
+	}
+	if err := agent.GrantCIFSShareAccess(context.Background(), testShareName, access); err != nil {
+		t.Fatalf("WindowsAgent.GrantCIFSShareAccess() error = %v", err)
+	}
+	if err := agent.RevokeCIFSShareAccess(context.Background(), testShareName, []string{testLocalUserName}, []string{"Everyone"}); err != nil {
+		t.Fatalf("WindowsAgent.RevokeCIFSShareAccess() error = %v", err)
+	}
 
+	commands := agent.Runner.(*FakeCommandRunner).Commands()
+	if len(commands) != 2 {
+		t.Fatalf("WindowsAgent runs %d commands, want 2", len(commands))
+	}
+
+	content, _ := json.Marshal(access)
+	wantArgs := [][]string{
+		{"-Name", testShareName, "-Grant", base64.StdEncoding.EncodeToString(content)},
+		{"-Name", testShareName, "-Revoke", testLocalUserName + ",Everyone"},
+	}
+	for i, command := range commands {
+		// The arguments follow "-ExecutionPolicy Bypass -File <script>".
+		if got := command.Args[4:]; !reflect.DeepEqual(got, wantArgs[i]) {
+			t.Errorf("WindowsAgent runs the script with %v, want %v", got, wantArgs[i])
+		}
+	}
+}
+
+func TestWindowsAgent_GetCIFSShareDetail(t *testing.T) {
 	type args struct {
 		ctx  context.Context
 		name string
@@ -425,8 +639,10 @@ func TestWindowsAgent_GetCIFSShareDetail(t *testing.T) {
 		wantErr    bool
 	}{
 		{
-			name:  "test_get_cifs_share_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_cifs_share_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testShareDetailOutput)}, "Get-ShareDetail.ps1")
+			}),
 			args: args{
 				name: testShareName,
 			},
@@ -434,10 +650,20 @@ func TestWindowsAgent_GetCIFSShareDetail(t *testing.T) {
 			wantDetail: common.ShareDetail{
 				Name:          testShareName,
 				Description:   "this is a test cifs share",
-				DirectoryPath: fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, testDirectoryName),
+				DirectoryPath: "C:\\test\\test_directory",
 				State:         "online",
 			},
 		},
+		{
+			name: "test_get_missing_cifs_share_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{}, "Get-ShareDetail.ps1")
+			}),
+			args: args{
+				name: testShareName,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -454,13 +680,6 @@ func TestWindowsAgent_GetCIFSShareDetail(t *testing.T) {
 }
 
 func TestWindowsAgent_GetCIFSSharesDetail(t *testing.T) {
-	setupCreateLocalUser(t)
-	setupCreateDirectory(t)
-	setupCreateCIFSShare(t)
-	defer teardownDeleteCIFSShare(t)
-	defer teardownDeleteDirectory(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx   context.Context
 		names []string
@@ -473,8 +692,10 @@ func TestWindowsAgent_GetCIFSSharesDetail(t *testing.T) {
 		wantErr    bool
 	}{
 		{
-			name:  "test_get_cifs_shares_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_cifs_shares_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testShareDetailOutput)}, "Get-ShareDetail.ps1")
+			}),
 			args: args{
 				names: []string{testShareName},
 			},
@@ -483,11 +704,46 @@ func TestWindowsAgent_GetCIFSSharesDetail(t *testing.T) {
 				{
 					Name:          testShareName,
 					Description:   "this is a test cifs share",
-					DirectoryPath: fmt.Sprintf("%s\\%s", common.Config.Agent.WindowsRootFolder, testDirectoryName),
+					DirectoryPath: "C:\\test\\test_directory",
 					State:         "online",
 				},
 			},
 		},
+		{
+			name: "test_get_all_cifs_shares_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testSharesDetailOutput)}, "Get-ShareDetail.ps1")
+			}),
+			args: args{
+				names: nil,
+			},
+			wantErr: false,
+			wantDetail: []common.ShareDetail{
+				{
+					Name:          testShareName,
+					Description:   "this is a test cifs share",
+					DirectoryPath: "C:\\test\\test_directory",
+					State:         "online",
+				},
+				{
+					Name:          "test_cifs_share_1",
+					Description:   "",
+					DirectoryPath: "C:\\test\\test_directory_1",
+					State:         "offline",
+				},
+			},
+		},
+		{
+			name: "test_get_no_cifs_shares_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte("\r\n")}, "Get-ShareDetail.ps1")
+			}),
+			args: args{
+				names: []string{testShareName},
+			},
+			wantErr:    false,
+			wantDetail: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -504,14 +760,6 @@ func TestWindowsAgent_GetCIFSSharesDetail(t *testing.T) {
 }
 
 func TestWindowsAgent_MountCIFSShare(t *testing.T) {
-	setupCreateLocalUser(t)
-	setupCreateDirectory(t)
-	setupCreateCIFSShare(t)
-	defer teardownUnmountCIFSShare(t)
-	defer teardownDeleteCIFSShare(t)
-	defer teardownDeleteDirectory(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx        context.Context
 		mountPoint string
@@ -526,8 +774,10 @@ func TestWindowsAgent_MountCIFSShare(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_mount_cifs_share",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_mount_cifs_share",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("The command completed successfully.", "powershell.exe", "-Command", "net", "use", testMountPoint, testSharePath, testLocalUserPassword, "/user:"+testLocalUserName)
+			}),
 			args: args{
 				mountPoint: testMountPoint,
 				sharePath:  testSharePath,
@@ -536,6 +786,19 @@ func TestWindowsAgent_MountCIFSShare(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "test_mount_cifs_share_with_wrong_password",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.Expect(CommandResult{ExitCode: 2, Stderr: []byte("System error 86 has occurred.")}, "powershell.exe", "-Command", "net", "use")
+			}),
+			args: args{
+				mountPoint: testMountPoint,
+				sharePath:  testSharePath,
+				userName:   testLocalUserName,
+				password:   "wrong",
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -547,14 +810,6 @@ func TestWindowsAgent_MountCIFSShare(t *testing.T) {
 }
 
 func TestWindowsAgent_UnmountCIFSShare(t *testing.T) {
-	setupCreateLocalUser(t)
-	setupCreateDirectory(t)
-	setupCreateCIFSShare(t)
-	setupMountCIFSShare(t)
-	defer teardownDeleteCIFSShare(t)
-	defer teardownDeleteDirectory(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx        context.Context
 		mountPoint string
@@ -566,8 +821,10 @@ func TestWindowsAgent_UnmountCIFSShare(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_unmount_cifs_share",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_unmount_cifs_share",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("Y: was deleted successfully.", "powershell.exe", "-Command", "net", "use", testMountPoint, "/delete", "/y")
+			}),
 			args: args{
 				mountPoint: testMountPoint,
 			},
@@ -584,8 +841,6 @@ func TestWindowsAgent_UnmountCIFSShare(t *testing.T) {
 }
 
 func TestWindowsAgent_CreateLocalUser(t *testing.T) {
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx      context.Context
 		name     string
@@ -598,8 +853,11 @@ func TestWindowsAgent_CreateLocalUser(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_create_local_user",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_create_local_user",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command",
+					fmt.Sprintf("New-LocalUser -Name '%s' -Password (ConvertTo-SecureString -String '%s' -AsPlainText -Force)", testLocalUserName, testLocalUserPassword))
+			}),
 			args: args{
 				name:     testLocalUserName,
 				password: testLocalUserPassword,
@@ -616,9 +874,142 @@ func TestWindowsAgent_CreateLocalUser(t *testing.T) {
 	}
 }
 
-func TestWindowsAgent_DeleteLocalUser(t *testing.T) {
-	setupCreateLocalUser(t)
+func TestWindowsAgent_UpdateLocalUser(t *testing.T) {
+	disabled := true
+
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		runner.ExpectStdout("", "powershell.exe", "-Command")
+	})
+
+	update := common.LocalUserUpdate{Password: testLocalUserPassword, Disabled: &disabled, Unlock: true}
+	if err := agent.UpdateLocalUser(context.Background(), testLocalUserName, update); err != nil {
+		t.Fatalf("WindowsAgent.UpdateLocalUser() error = %v", err)
+	}
+
+	wantCmdlets := []string{
+		fmt.Sprintf("Set-LocalUser -Name '%s' -Password (ConvertTo-SecureString -String '%s' -AsPlainText -Force)", testLocalUserName, testLocalUserPassword),
+		fmt.Sprintf("$user = [ADSI]'WinNT://./%s,user'; $user.IsAccountLocked = $false; $user.SetInfo()", testLocalUserName),
+		fmt.Sprintf("Disable-LocalUser -Name '%s'", testLocalUserName),
+	}
+
+	commands := agent.Runner.(*FakeCommandRunner).Commands()
+	if len(commands) != len(wantCmdlets) {
+		t.Fatalf("WindowsAgent runs %d commands, want %d", len(commands), len(wantCmdlets))
+	}
+	for i, command := range commands {
+		if got := command.Args[1]; got != wantCmdlets[i] {
+			t.Errorf("WindowsAgent runs %q, want %q", got, wantCmdlets[i])
+		}
+	}
+}
+
+func TestWindowsAgent_UpdateLocalUser_quotes(t *testing.T) {
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		runner.ExpectStdout("", "powershell.exe", "-Command")
+	})
+
+	update := common.LocalUserUpdate{Password: "pa'ss'); Remove-Item C:\\ -Recurse; ('", Unlock: true}
+	if err := agent.UpdateLocalUser(context.Background(), "o'brien", update); err != nil {
+		t.Fatalf("WindowsAgent.UpdateLocalUser() error = %v", err)
+	}
+
+	wantCmdlets := []string{
+		"Set-LocalUser -Name 'o''brien' -Password (ConvertTo-SecureString -String 'pa''ss''); Remove-Item C:\\ -Recurse; (''' -AsPlainText -Force)",
+		"$user = [ADSI]'WinNT://./o''brien,user'; $user.IsAccountLocked = $false; $user.SetInfo()",
+	}
+
+	commands := agent.Runner.(*FakeCommandRunner).Commands()
+	if len(commands) != len(wantCmdlets) {
+		t.Fatalf("WindowsAgent runs %d commands, want %d", len(commands), len(wantCmdlets))
+	}
+	for i, command := range commands {
+		if got := command.Args[1]; got != wantCmdlets[i] {
+			t.Errorf("WindowsAgent runs %q, want %q", got, wantCmdlets[i])
+		}
+	}
+}
+
+func TestWindowsAgent_AddLocalGroupMembers(t *testing.T) {
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		runner.ExpectStdout("", "powershell.exe", "-Command")
+	})
+
+	if err := agent.AddLocalGroupMembers(context.Background(), testLocalGroupName, []string{testLocalUserName, "bob"}); err != nil {
+		t.Fatalf("WindowsAgent.AddLocalGroupMembers() error = %v", err)
+	}
+	if err := agent.RemoveLocalGroupMembers(context.Background(), testLocalGroupName, []string{"bob"}); err != nil {
+		t.Fatalf("WindowsAgent.RemoveLocalGroupMembers() error = %v", err)
+	}
+
+	wantCmdlets := []string{
+		fmt.Sprintf("Add-LocalGroupMember -Group '%s' -Member '%s','bob'", testLocalGroupName, testLocalUserName),
+		fmt.Sprintf("Remove-LocalGroupMember -Group '%s' -Member 'bob'", testLocalGroupName),
+	}
+
+	commands := agent.Runner.(*FakeCommandRunner).Commands()
+	if len(commands) != len(wantCmdlets) {
+		t.Fatalf("WindowsAgent runs %d commands, want %d", len(commands), len(wantCmdlets))
+	}
+	for i, command := range commands {
+		if got := command.Args[1]; got != wantCmdlets[i] {
+			t.Errorf("WindowsAgent runs %q, want %q", got, wantCmdlets[i])
+		}
+	}
+}
+
+func TestWindowsAgent_CreateLocalGroup_quotes(t *testing.T) {
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		runner.ExpectStdout("", "powershell.exe", "-Command")
+	})
+
+	if err := agent.CreateLocalGroup(context.Background(), testLocalGroupName, "it's'; Remove-Item C:\\ -Recurse; '"); err != nil {
+		t.Fatalf("WindowsAgent.CreateLocalGroup() error = %v", err)
+	}
+	if err := agent.AddLocalGroupMembers(context.Background(), testLocalGroupName, []string{"o\u2019brien"}); err != nil {
+		t.Fatalf("WindowsAgent.AddLocalGroupMembers() error = %v", err)
+	}
 
+	wantCmdlets := []string{
+		fmt.Sprintf("New-LocalGroup -Name '%s' -Description 'it''s''; Remove-Item C:\\ -Recurse; '''", testLocalGroupName),
+		fmt.Sprintf("Add-LocalGroupMember -Group '%s' -Member 'o\u2019\u2019brien'", testLocalGroupName),
+	}
+
+	commands := agent.Runner.(*FakeCommandRunner).Commands()
+	if len(commands) != len(wantCmdlets) {
+		t.Fatalf("WindowsAgent runs %d commands, want %d", len(commands), len(wantCmdlets))
+	}
+	for i, command := range commands {
+		if got := command.Args[1]; got != wantCmdlets[i] {
+			t.Errorf("WindowsAgent runs %q, want %q", got, wantCmdlets[i])
+		}
+	}
+}
+
+func TestWindowsAgent_GetLocalGroupsDetail(t *testing.T) {
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		expectPowerShellScript(runner, CommandResult{Stdout: []byte(testLocalGroupsDetailOutput)}, "Get-LocalGroupDetail.ps1")
+	})
+
+	gotDetail, err := agent.GetLocalGroupsDetail(context.Background(), []string{testLocalGroupName})
+	if err != nil {
+		t.Fatalf("WindowsAgent.GetLocalGroupsDetail() error = %v", err)
+	}
+
+	wantDetail := []common.LocalGroupDetail{
+		{Name: testLocalGroupName, GID: "S-1-5-21-1180699209-877415012-3182924384-1004", Description: "the test group", Members: []string{testLocalUserName}},
+	}
+	if !reflect.DeepEqual(gotDetail, wantDetail) {
+		t.Errorf("WindowsAgent.GetLocalGroupsDetail() = %+v, want %+v", gotDetail, wantDetail)
+	}
+
+	if _, err := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		expectPowerShellScript(runner, CommandResult{Stdout: []byte("[]")}, "Get-LocalGroupDetail.ps1")
+	}).GetLocalGroupDetail(context.Background(), "missing"); err == nil {
+		t.Errorf("WindowsAgent.GetLocalGroupDetail() returns the missing group without error")
+	}
+}
+
+func TestWindowsAgent_DeleteLocalUser(t *testing.T) {
 	type args struct {
 		ctx  context.Context
 		name string
@@ -630,13 +1021,23 @@ func TestWindowsAgent_DeleteLocalUser(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:  "test_delete_local_user",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_delete_local_user",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				runner.ExpectStdout("", "powershell.exe", "-Command", fmt.Sprintf("Remove-LocalUser -Name '%s'", testLocalUserName))
+			}),
 			args: args{
 				name: testLocalUserName,
 			},
 			wantErr: false,
 		},
+		{
+			name:  "test_delete_local_user_failed",
+			agent: newFakeWindowsAgent(nil),
+			args: args{
+				name: testLocalUserName,
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -648,9 +1049,6 @@ func TestWindowsAgent_DeleteLocalUser(t *testing.T) {
 }
 
 func TestWindowsAgent_GetLocalUserDetail(t *testing.T) {
-	setupCreateLocalUser(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx  context.Context
 		name string
@@ -663,29 +1061,48 @@ func TestWindowsAgent_GetLocalUserDetail(t *testing.T) {
 		wantErr    bool
 	}{
 		{
-			name:  "test_get_local_user_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_local_user_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testLocalUserDetailOutput)}, "Get-LocalUserDetail.ps1")
+			}),
 			args: args{
 				name: testLocalUserName,
 			},
 			wantErr: false,
+			wantDetail: common.LocalUserDetail{
+				Name:                 testLocalUserName,
+				UID:                  "S-1-5-21-3623811015-3361044348-30300820-1013",
+				Status:               "OK",
+				IsPasswordRequired:   true,
+				IsPasswordChangeable: true,
+			},
+		},
+		{
+			name: "test_get_missing_local_user_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{}, "Get-LocalUserDetail.ps1")
+			}),
+			args: args{
+				name: testLocalUserName,
+			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.agent.GetLocalUserDetail(tt.args.ctx, tt.args.name)
+			gotDetail, err := tt.agent.GetLocalUserDetail(tt.args.ctx, tt.args.name)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WindowsAgent.GetLocalUserDetail() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("WindowsAgent.GetLocalUserDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
 		})
 	}
 }
 
 func TestWindowsAgent_GetLocalUsersDetail(t *testing.T) {
-	setupCreateLocalUser(t)
-	defer teardownDeleteLocalUser(t)
-
 	type args struct {
 		ctx   context.Context
 		names []string
@@ -698,22 +1115,43 @@ func TestWindowsAgent_GetLocalUsersDetail(t *testing.T) {
 		wantErr    bool
 	}{
 		{
-			name:  "test_get_local_users_detail",
-			agent: GetAgent().(*WindowsAgent),
+			name: "test_get_local_users_detail",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testLocalUsersDetailOutput)}, "Get-LocalUserDetail.ps1")
+			}),
 			args: args{
-				names: []string{testLocalUserName},
+				names: nil,
 			},
 			wantErr: false,
+			wantDetail: []common.LocalUserDetail{
+				{
+					Name:                 "Administrator",
+					UID:                  "S-1-5-21-3623811015-3361044348-30300820-500",
+					Description:          "Built-in account for administering the computer/domain",
+					Status:               "OK",
+					IsPasswordRequired:   true,
+					IsPasswordChangeable: true,
+				},
+				{
+					Name:        "Guest",
+					UID:         "S-1-5-21-3623811015-3361044348-30300820-501",
+					Description: "Built-in account for guest access to the computer/domain",
+					Status:      "Degraded",
+					IsDisabled:  true,
+				},
+			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.agent.GetLocalUsersDetail(tt.args.ctx, tt.args.names)
+			gotDetail, err := tt.agent.GetLocalUsersDetail(tt.args.ctx, tt.args.names)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WindowsAgent.GetLocalUsersDetail() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("WindowsAgent.GetLocalUsersDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
 		})
 	}
 }
@@ -730,20 +1168,269 @@ func TestWindowsAgent_GetSystemInfo(t *testing.T) {
 		wantErr        bool
 	}{
 		{
-			name:    "test_get_system_info",
-			agent:   GetAgent().(*WindowsAgent),
+			name: "test_get_system_info",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testSystemDetailOutput)}, "Get-SystemDetail.ps1")
+			}),
 			args:    args{},
 			wantErr: false,
+			wantSystemInfo: common.SystemInfo{
+				ComputerName:   "WIN-DME01",
+				Caption:        "Microsoft Windows Server 2019 Datacenter",
+				OSArchitecture: "64-bit",
+				OSVersion:      "10.0.17763",
+				BuildNumber:    "17763",
+			},
+		},
+		{
+			name: "test_get_system_info_failed",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{ExitCode: 1}, "Get-SystemDetail.ps1")
+			}),
+			args:    args{},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.agent.GetSystemInfo(tt.args.ctx)
+			gotSystemInfo, err := tt.agent.GetSystemInfo(tt.args.ctx)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WindowsAgent.GetSystemInfo() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if !reflect.DeepEqual(gotSystemInfo, tt.wantSystemInfo) {
+				t.Errorf("WindowsAgent.GetSystemInfo() = %v, want %v", gotSystemInfo, tt.wantSystemInfo)
+			}
+		})
+	}
+}
+
+func TestWindowsAgent_GetStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		agent      *WindowsAgent
+		wantStatus common.AgentStatus
+		wantErr    bool
+	}{
+		{
+			name: "test_get_status",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testSystemStatusOutput)}, "Get-SystemStatus.ps1")
+			}),
+			wantStatus: common.AgentStatus{AgentVersion: Version, Load: 12.5, Uptime: 86400},
+		},
+		{
+			name: "test_get_status_failed",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{ExitCode: 1}, "Get-SystemStatus.ps1")
+			}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStatus, err := tt.agent.GetStatus(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WindowsAgent.GetStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotStatus, tt.wantStatus) {
+				t.Errorf("WindowsAgent.GetStatus() = %v, want %v", gotStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWindowsAgent_CreateNFSExport(t *testing.T) {
+	agent := newFakeWindowsAgent(nil)
+
+	err := agent.CreateNFSExport(context.Background(), testDirectoryName, []common.NFSClient{{Host: "*", Access: "ro", RootSquash: true}})
+	if err == nil {
+		t.Errorf("WindowsAgent.CreateNFSExport() error = %v, wantErr %v", err, true)
+	}
+	if len(agent.Runner.(*FakeCommandRunner).Commands()) != 0 {
+		t.Errorf("WindowsAgent.CreateNFSExport() runs commands on the host")
+	}
+}
 
+func TestWindowsAgent_SetDirectoryQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		quota    common.DirectoryQuota
+		wantArgs []string
+		wantErr  bool
+	}{
+		{
+			name:     "test_set_hard_quota",
+			quota:    common.DirectoryQuota{HardLimitBytes: 10737418240},
+			wantArgs: []string{"-Size", "10737418240"},
+		},
+		{
+			name:     "test_set_soft_quota",
+			quota:    common.DirectoryQuota{SoftLimitBytes: 1048576},
+			wantArgs: []string{"-Size", "1048576", "-SoftLimit"},
+		},
+		{
+			name:    "test_set_soft_and_hard_quota",
+			quota:   common.DirectoryQuota{SoftLimitBytes: 1048576, HardLimitBytes: 10737418240},
+			wantErr: true,
+		},
+		{
+			name:    "test_set_file_quota",
+			quota:   common.DirectoryQuota{HardLimitFiles: 1000},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{}, "Set-DirectoryQuota.ps1")
+			})
+
+			err := agent.SetDirectoryQuota(context.Background(), testDirectoryName, tt.quota)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WindowsAgent.SetDirectoryQuota() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			commands := agent.Runner.(*FakeCommandRunner).Commands()
+			if tt.wantErr {
+				if len(commands) != 0 {
+					t.Errorf("WindowsAgent.SetDirectoryQuota() runs commands on the host")
+				}
+				return
+			}
+
+			wantArgs := append([]string{"-ExecutionPolicy", "Bypass", "-File", "./agent/windows/Set-DirectoryQuota.ps1",
+				"-Path", agent.getDirectoryPath(testDirectoryName)}, tt.wantArgs...)
+			if len(commands) != 1 || !reflect.DeepEqual(commands[0].Args, wantArgs) {
+				t.Errorf("WindowsAgent.SetDirectoryQuota() runs %v, want %v", commands, wantArgs)
+			}
 		})
 	}
 }
+
+func TestWindowsAgent_GetDirectoryQuota(t *testing.T) {
+	tests := []struct {
+		name      string
+		agent     *WindowsAgent
+		wantQuota common.DirectoryQuota
+		wantErr   bool
+	}{
+		{
+			name: "test_get_directory_quota",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{Stdout: []byte(testQuotaOutput)}, "Get-DirectoryQuota.ps1")
+			}),
+			wantQuota: common.DirectoryQuota{HardLimitBytes: 10737418240, UsedBytes: 1048576},
+		},
+		{
+			name: "test_get_directory_without_quota",
+			agent: newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+				expectPowerShellScript(runner, CommandResult{}, "Get-DirectoryQuota.ps1")
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuota, err := tt.agent.GetDirectoryQuota(context.Background(), testDirectoryName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WindowsAgent.GetDirectoryQuota() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotQuota, tt.wantQuota) {
+				t.Errorf("WindowsAgent.GetDirectoryQuota() = %v, want %v", gotQuota, tt.wantQuota)
+			}
+		})
+	}
+}
+
+const testACLOutput = `{
+  "Owner": "BUILTIN\\Administrators",
+  "Entries": [
+    {"IdentityReference": "CONTOSO\\alice", "PrincipalType": "user", "AccessControlType": "Allow",
+     "FileSystemRights": "Modify, Synchronize", "IsInherited": false,
+     "InheritanceFlags": "ContainerInherit, ObjectInherit", "PropagationFlags": "None"},
+    {"IdentityReference": "Everyone", "PrincipalType": "everyone", "AccessControlType": "Deny",
+     "FileSystemRights": "Write, Synchronize", "IsInherited": false,
+     "InheritanceFlags": "None", "PropagationFlags": "None"},
+    {"IdentityReference": "CREATOR OWNER", "PrincipalType": "user", "AccessControlType": "Allow",
+     "FileSystemRights": "268435456", "IsInherited": true,
+     "InheritanceFlags": "ContainerInherit, ObjectInherit", "PropagationFlags": "InheritOnly"},
+    {"IdentityReference": "BUILTIN\\Users", "PrincipalType": "group", "AccessControlType": "Allow",
+     "FileSystemRights": "AppendData", "IsInherited": true,
+     "InheritanceFlags": "ContainerInherit", "PropagationFlags": "None"}
+  ]
+}`
+
+func TestWindowsAgent_GetDirectoryACL(t *testing.T) {
+	agent := newFakeWindowsAgent(func(runner *FakeCommandRunner) {
+		expectPowerShellScript(runner, CommandResult{Stdout: []byte(testACLOutput)}, "Get-DirectoryACL.ps1")
+	})
+
+	gotACL, err := agent.GetDirectoryACL(context.Background(), testDirectoryName)
+	if err != nil {
+		t.Fatalf("WindowsAgent.GetDirectoryACL() error = %v", err)
+	}
+
+	// The rule of the special rights is left out.
+	wantACL := common.DirectoryACL{
+		Owner: `BUILTIN\Administrators`,
+		Entries: []common.ACLEntry{
+			{Principal: `CONTOSO\alice`, PrincipalType: "user", Type: "allow", Permission: "modify", Inherit: true},
+			{PrincipalType: "everyone", Type: "deny", Permission: "write"},
+			{Principal: "CREATOR OWNER", PrincipalType: "user", Type: "allow", Permission: "full", Inherit: true, InheritOnly: true, Inherited: true},
+		},
+	}
+	if !reflect.DeepEqual(gotACL, wantACL) {
+		t.Errorf("WindowsAgent.GetDirectoryACL() = %+v, want %+v", gotACL, wantACL)
+	}
+}
+
+func TestWindowsAgent_SetDirectoryACL(t *testing.T) {
+	runner := NewFakeCommandRunner()
+	expectPowerShellScript(runner, CommandResult{}, "Set-DirectoryACL.ps1")
+	agent := &WindowsAgent{Runner: runner}
+
+	acl := common.DirectoryACL{
+		Owner: `CONTOSO\alice`,
+		Entries: []common.ACLEntry{
+			{Principal: `CONTOSO\alice`, PrincipalType: "user", Type: "allow", Permission: "full", Inherit: true},
+			{PrincipalType: "everyone", Type: "deny", Permission: "write", InheritOnly: true, Inherit: true},
+			// The inherited entries are kept by the directory, they are not set again.
+			{Principal: "SYSTEM", PrincipalType: "user", Type: "allow", Permission: "full", Inherited: true},
+		},
+	}
+	if err := agent.SetDirectoryACL(context.Background(), testDirectoryName, acl); err != nil {
+		t.Fatalf("WindowsAgent.SetDirectoryACL() error = %v", err)
+	}
+
+	commands := runner.Commands()
+	if len(commands) != 1 {
+		t.Fatalf("WindowsAgent.SetDirectoryACL() runs %d commands, want 1", len(commands))
+	}
+
+	// The arguments are "-ExecutionPolicy Bypass -File <script> -Path <path> -Entries <rules> -Owner <owner>".
+	args := commands[0].Args
+	if len(args) != 10 || args[6] != "-Entries" {
+		t.Fatalf("WindowsAgent.SetDirectoryACL() runs %v without the entries", args)
+	}
+	if wantOwner := []string{"-Owner", `CONTOSO\alice`}; !reflect.DeepEqual(args[8:], wantOwner) {
+		t.Errorf("WindowsAgent.SetDirectoryACL() sets the owner by %v, want %v", args[8:], wantOwner)
+	}
+
+	content, err := base64.StdEncoding.DecodeString(args[7])
+	if err != nil {
+		t.Fatalf("WindowsAgent.SetDirectoryACL() sets the invalid entries: %v", err)
+	}
+
+	var gotRules []windowsAccessRule
+	if err = json.Unmarshal(content, &gotRules); err != nil {
+		t.Fatalf("WindowsAgent.SetDirectoryACL() sets the invalid entries: %v", err)
+	}
+	wantRules := []windowsAccessRule{
+		{Identity: `CONTOSO\alice`, Rights: "FullControl", InheritanceFlags: "ContainerInherit, ObjectInherit", PropagationFlags: "None", AccessControlType: "Allow"},
+		{Identity: "Everyone", Rights: "Write", InheritanceFlags: "ContainerInherit, ObjectInherit", PropagationFlags: "InheritOnly", AccessControlType: "Deny"},
+	}
+	if !reflect.DeepEqual(gotRules, wantRules) {
+		t.Errorf("WindowsAgent.SetDirectoryACL() sets %+v, want %+v", gotRules, wantRules)
+	}
+}
@@ -1,11 +1,15 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
@@ -19,8 +23,29 @@ type RestClient struct {
 	ContentType string
 	authEnabled bool
 	tokenKey    string
-	AuthToken   string
+	session     *restSession
 	TraceID     string
+	ctx         context.Context
+}
+
+// restSession keeps the token returned by the server, it is shared by the copies of RestClient made by WithContext.
+type restSession struct {
+	mu    sync.Mutex
+	token string
+}
+
+func (s *restSession) getToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.token
+}
+
+func (s *restSession) setToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token = token
 }
 
 // GetRestClient returns a new instance of the RestClient.
@@ -34,93 +59,156 @@ func GetRestClient(scheme string, hostContext common.HostContext, port int, pref
 		ContentType: "application/json",
 		authEnabled: authEnabled,
 		tokenKey:    tokenKey,
-		AuthToken:   "",
+		session:     &restSession{},
 		TraceID:     traceID,
 	}
 }
 
+// WithContext returns a copy of the RestClient whose requests are bound to the context and carry its trace ID.
+// The copy shares the connections and the session token with the original one, so it is cheap to make one per call.
+func (c *RestClient) WithContext(ctx context.Context) *RestClient {
+	clone := *c
+	clone.ctx = ctx
+
+	if traceID, ok := ctx.Value(common.TraceIDKey("TraceID")).(string); ok {
+		clone.TraceID = traceID
+	}
+
+	return &clone
+}
+
+// SetTLSConfig sets the TLS configuration used by the https requests, e.g. to skip the verification of a self-signed certificate.
+func (c *RestClient) SetTLSConfig(config *tls.Config) {
+	c.client.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}
+}
+
+// SetTimeout sets the time limit of each request.
+func (c *RestClient) SetTimeout(timeout time.Duration) {
+	c.client.Timeout = timeout
+}
+
+// WithTimeout returns a copy of the RestClient whose requests are limited by the timeout instead, e.g. for a long walk.
+func (c *RestClient) WithTimeout(timeout time.Duration) *RestClient {
+	clone := *c
+
+	client := *c.client
+	client.Timeout = timeout
+	clone.client = &client
+
+	return &clone
+}
+
 // getAuthorizationHeader returns the Authorization header value based on the current authentication state.
 func (c *RestClient) getAuthorizationHeader() string {
-	if c.AuthToken != "" {
-		return "Bearer " + c.AuthToken
+	if token := c.session.getToken(); token != "" {
+		return "Bearer " + token
 	}
 	// Fallback to Basic Authentication if token is missing
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.hostContext.Username+":"+c.hostContext.Password))
 }
 
 func (c *RestClient) refreshAuthToken(response *http.Response) error {
-	if c.tokenKey != "" {
-		token := response.Header.Get(c.tokenKey)
-		if token != "" {
-			c.AuthToken = token
-		} else {
+	// The server without token authentication is always accessed by Basic Authentication.
+	if c.tokenKey == "" || response == nil {
+		return nil
+	}
+
+	// The request rejected by the server carries no token, the next request is authenticated again.
+	if response.StatusCode == http.StatusUnauthorized {
+		return nil
+	}
+
+	token := response.Header.Get(c.tokenKey)
+	if token == "" {
+		if common.Logger != nil {
 			common.Logger.WithFields(log.Fields{"token": c.tokenKey}).Error("Failed to get the token from response.")
-			return fmt.Errorf("failed to get the token from response. Token key: %s", c.tokenKey)
 		}
-	} else {
-		common.Logger.Error("No token key in RestClient.")
-		return fmt.Errorf("no token key in RestClient")
+		return fmt.Errorf("failed to get the token from response. Token key: %s", c.tokenKey)
 	}
 
+	c.session.setToken(token)
+
 	return nil
 }
 
-// Get performs an HTTP GET request.
-func (c *RestClient) Get(url string) (*http.Response, error) {
-	fullURL := fmt.Sprintf(c.baseURL+"/%s", url)
-
-	req, err := http.NewRequest(http.MethodGet, fullURL, nil)
-	if err != nil {
-		return nil, err
+// do sends the request, the body is buffered so that the request can be sent again with Basic Authentication.
+func (c *RestClient) do(method, url string, body io.Reader) (*http.Response, error) {
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
 	}
 
-	// Set the Authorization header
-	req.Header.Set("Content-Type", c.ContentType)
-	req.Header.Set("X-Trace-ID", c.TraceID)
+	for {
+		fullURL := fmt.Sprintf(c.baseURL+"/%s", url)
 
-	if c.authEnabled {
-		req.Header.Set("Authorization", c.getAuthorizationHeader())
-	}
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(content)
+		}
 
-	resp, err := c.client.Do(req)
-	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
-		// Try using Basic Authentication if token returns a 401 status code
-		c.AuthToken = "" // Reset the AuthToken to trigger Basic Authentication
-		return c.Get(url)
-	} else if c.authEnabled {
-		c.refreshAuthToken(resp)
-	}
+		ctx := c.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
 
-	return resp, err
-}
+		req, err := http.NewRequestWithContext(ctx, method, fullURL, reader)
+		if err != nil {
+			return nil, err
+		}
 
-// Post performs an HTTP POST request.
-func (c *RestClient) Post(url string, body io.Reader) (*http.Response, error) {
-	fullURL := fmt.Sprintf(c.baseURL+"/%s", url)
+		// Set the Authorization header
+		req.Header.Set("Content-Type", c.ContentType)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("X-Trace-ID", c.TraceID)
 
-	req, err := http.NewRequest(http.MethodPost, fullURL, body)
-	if err != nil {
-		return nil, err
-	}
+		if c.authEnabled {
+			req.Header.Set("Authorization", c.getAuthorizationHeader())
+		}
 
-	// Set the Authorization header
-	req.Header.Set("Content-Type", c.ContentType)
-	req.Header.Set("X-Trace-ID", c.TraceID)
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return resp, err
+		}
 
-	if c.authEnabled {
-		req.Header.Set("Authorization", c.getAuthorizationHeader())
-	}
+		if resp.StatusCode == http.StatusUnauthorized && c.session.getToken() != "" {
+			// Try using Basic Authentication if token returns a 401 status code
+			resp.Body.Close()
+			c.session.setToken("") // Reset the token to trigger Basic Authentication
+			continue
+		}
+
+		if c.authEnabled {
+			c.refreshAuthToken(resp)
+		}
 
-	resp, err := c.client.Do(req)
-	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
-		// Try using Basic Authentication if token returns a 401 status code
-		c.AuthToken = "" // Reset the AuthToken to trigger Basic Authentication
-		return c.Post(url, body)
-	} else if c.authEnabled {
-		c.refreshAuthToken(resp)
+		return resp, nil
 	}
+}
+
+// Get performs an HTTP GET request.
+func (c *RestClient) Get(url string) (*http.Response, error) {
+	return c.do(http.MethodGet, url, nil)
+}
+
+// Post performs an HTTP POST request.
+func (c *RestClient) Post(url string, body io.Reader) (*http.Response, error) {
+	return c.do(http.MethodPost, url, body)
+}
+
+// Patch performs an HTTP PATCH request.
+func (c *RestClient) Patch(url string, body io.Reader) (*http.Response, error) {
+	return c.do(http.MethodPatch, url, body)
+}
 
-	return resp, err
+// Delete performs an HTTP DELETE request.
+func (c *RestClient) Delete(url string) (*http.Response, error) {
+	return c.do(http.MethodDelete, url, nil)
 }
 
 // GetResponseBody reads the response body and unmarshals it into the provided result.
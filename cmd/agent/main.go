@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/webservice"
+)
+
+var configFile = flag.String("config", "agent.ini", "the configuration file of the agent")
+
+// The agent manages the host it runs on for the engine, it keeps no state of its own but the files in [agent],
+// so it never opens the database.
+func main() {
+	flag.Parse()
+
+	// Initialize the configuration first and then Loggers.
+	if err := common.InitializeConfig(*configFile); err != nil {
+		panic(err)
+	}
+
+	common.SetupLoggers()
+	common.Logger.Debug("Initialize logger successfully.")
+
+	webservice.StartAgent()
+	common.Logger.Debug("Start agent web service successfully.")
+}
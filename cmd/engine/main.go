@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/cryingmouse/data_management_engine/scheduler"
+	"github.com/cryingmouse/data_management_engine/webservice"
+)
+
+var (
+	configFile = flag.String("config", "config.ini", "the configuration file of the engine")
+	// The command line option to rotate the encryption key instead of starting the engine.
+	rotateKey = flag.Bool("rotate-key", false, "rotate the encryption key and re-encrypt the passwords in database, then exit")
+)
+
+func main() {
+	flag.Parse()
+
+	// Initialize the configuration first and then Loggers.
+	if err := common.InitializeConfig(*configFile); err != nil {
+		panic(err)
+	}
+
+	common.SetupLoggers()
+	common.Logger.Debug("Initialize logger successfully.")
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		common.Logger.Error("Failed to initialize database. Error: %w", err)
+		panic(err)
+	}
+	common.Logger.Debug("Initialize database successfully.")
+
+	if err := engine.Migrate(); err != nil {
+		common.Logger.Error("Failed to migration database. Error: %w", err)
+	}
+
+	if *rotateKey {
+		rotation, err := mgmtmodel.RotateEncryptionKey(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate the encryption key: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("The passwords are encrypted by the key %s, %d of them are re-encrypted.\n", rotation.KeyID, rotation.ReencryptedCount)
+		return
+	}
+
+	if err := mgmtmodel.InitializeAccounts(); err != nil {
+		common.Logger.WithError(err).Error("Failed to initialize the admin account.")
+	}
+
+	if err := mgmtmodel.StartJobWorkers(); err != nil {
+		common.Logger.WithError(err).Error("Failed to start the job workers.")
+	}
+
+	scheduler.StartScheduler()
+	common.Logger.Debug("Start scheduler successfully.")
+
+	webservice.StartEngine()
+	common.Logger.Debug("Start web service successfully.")
+}
@@ -17,13 +17,142 @@ type LoggerConfig struct {
 }
 
 type AgentConfig struct {
+	// The address and the port which the agent listens on over plain HTTP, e.g. to be enrolled by the engine.
+	ListenAddress     string `mapstructure:"listen-address"`
+	Port              int    `mapstructure:"port"`
 	WindowsRootFolder string `mapstructure:"windows-root-folder"`
+	LinuxRootFolder   string `mapstructure:"linux-root-folder"`
+	SambaConfigFile   string `mapstructure:"samba-config-file"`
+	NFSExportsFile    string `mapstructure:"nfs-exports-file"`
+	// The port of the agent API over mutual TLS, it is served once the agent gets its certificate from the engine.
+	TLSPort int `mapstructure:"tls-port"`
+	// The certificate and private key of the agent, and the CA certificate of the engine which the clients must present
+	// a certificate signed by.
+	CertFile     string `mapstructure:"cert-file"`
+	KeyFile      string `mapstructure:"key-file"`
+	EngineCAFile string `mapstructure:"engine-ca-file"`
+	// The credentials which the engine calls the agent API with, they are the username and password of the host
+	// registered in the engine. All the calls are rejected if they are not configured.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// The time in seconds a session token of the agent is valid after its last use.
+	SessionTimeout int `mapstructure:"session-timeout"`
+	// The URL of the engine which the agent calls home to at startup with the bootstrap token issued by the engine,
+	// e.g. http://10.0.0.1:8080. The agent does not call home if it is empty.
+	EngineURL      string `mapstructure:"engine-url"`
+	BootstrapToken string `mapstructure:"bootstrap-token"`
+	// The IP address which the engine connects the agent by, the source address of the call is used if it is empty.
+	AdvertiseIP string `mapstructure:"advertise-ip"`
+	// The maximum number of the entries visited per second by the walk for the directory usage, 0 means no limit.
+	UsageWalkRate int `mapstructure:"usage-walk-rate"`
+	// The folder of the snapshots of the directories on Linux, it should be on the same file system as the root folder
+	// so that the snapshots can share the blocks with the directories. It is the root folder suffixed by "-snapshots"
+	// if it is empty.
+	LinuxSnapshotFolder string `mapstructure:"linux-snapshot-folder"`
+	// The folder where the files replicated to the directories on Linux are received before they are moved into the
+	// directories, it should be on the same file system as the root folder. It is the root folder suffixed by
+	// "-replication" if it is empty.
+	LinuxReplicationFolder string `mapstructure:"linux-replication-folder"`
+	// The file which the project IDs of the quotas on Linux are registered in, it is /etc/projid if it is empty.
+	ProjidFile string `mapstructure:"projid-file"`
+	// The folder which the CIFS shares are mounted under on Linux, it is /mnt if it is empty.
+	LinuxMountFolder string `mapstructure:"linux-mount-folder"`
+}
+
+type OntapConfig struct {
+	Port               int    `mapstructure:"port"`
+	SVM                string `mapstructure:"svm"`
+	Volume             string `mapstructure:"volume"`
+	InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify"`
+}
+
+type MagnaScaleConfig struct {
+	Port               int    `mapstructure:"port"`
+	FileSystem         string `mapstructure:"filesystem"`
+	InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify"`
+}
+
+type JobConfig struct {
+	// The number of the workers to run the items of the asynchronous jobs.
+	Workers int `mapstructure:"workers"`
+}
+
+type SchedulerConfig struct {
+	// The interval in seconds between the health checks of the registered hosts.
+	HealthCheckInterval int `mapstructure:"health-check-interval"`
+	// The number of the consecutive failed health checks before the host is unreachable.
+	UnreachableThreshold int `mapstructure:"unreachable-threshold"`
+	// The maximum interval in seconds to back off from the unreachable host.
+	MaxBackoff int `mapstructure:"max-backoff"`
+	// The number of the latest health checks kept for each host.
+	HealthHistorySize int `mapstructure:"health-history-size"`
+	// The interval in seconds between the heartbeats of the agents, the host is not checked while its heartbeats arrive.
+	HeartbeatInterval int `mapstructure:"heartbeat-interval"`
+	// The seconds for which the usage of the directories is used before it is collected again.
+	UsageCacheTTL int `mapstructure:"usage-cache-ttl"`
+	// The interval in seconds between the checks of the snapshot policies.
+	SnapshotPolicyInterval int `mapstructure:"snapshot-policy-interval"`
+	// The interval in seconds between the checks of the scheduled replications.
+	ReplicationInterval int `mapstructure:"replication-interval"`
+}
+
+type AuthConfig struct {
+	// The key to sign the tokens of the portal API. A random key is used if it is empty, so the tokens are invalid
+	// once the engine restarts.
+	SecretKey string `mapstructure:"secret-key"`
+	// The lifetime in seconds of the tokens.
+	TokenExpiration int `mapstructure:"token-expiration"`
+	// The password of the account 'admin', which is created at startup if there is no account.
+	AdminPassword string `mapstructure:"admin-password"`
+	// The lifetime in seconds of the bootstrap tokens which the agents call home with.
+	BootstrapTokenExpiration int `mapstructure:"bootstrap-token-expiration"`
+}
+
+type PKIConfig struct {
+	// The certificate and private key of the CA built in the engine, they are created at the first use if they do not exist.
+	CACertFile string `mapstructure:"ca-cert-file"`
+	CAKeyFile  string `mapstructure:"ca-key-file"`
+}
+
+type SecurityConfig struct {
+	// The file of the keys to encrypt the passwords, it is created at the first use if it does not exist.
+	// The keys in the environment variable DME_ENCRYPTION_KEYS are used instead if it is set.
+	KeyFile string `mapstructure:"key-file"`
+}
+
+type IdentityConfig struct {
+	// The URL of the LDAP server, e.g. ldaps://dc.corp.example.com:636. The domain users and groups are not resolved
+	// if it is empty.
+	URL string `mapstructure:"url"`
+	// The DN and the password to bind the LDAP server, the server is searched anonymously if the DN is empty.
+	BindDN       string `mapstructure:"bind-dn"`
+	BindPassword string `mapstructure:"bind-password"`
+	// The DN which the users and the groups are searched under, e.g. DC=corp,DC=example,DC=com.
+	BaseDN string `mapstructure:"base-dn"`
+	// The NetBIOS name of the domain which qualifies the names given to the hosts, e.g. CORP\alice.
+	Domain string `mapstructure:"domain"`
+	// The attribute of the account names and the object classes of the users and the groups, which are
+	// sAMAccountName, user and group of Active Directory by default, e.g. uid, posixAccount and posixGroup of OpenLDAP.
+	NameAttribute      string `mapstructure:"name-attribute"`
+	UserObjectClass    string `mapstructure:"user-object-class"`
+	GroupObjectClass   string `mapstructure:"group-object-class"`
+	InsecureSkipVerify bool   `mapstructure:"insecure-skip-verify"`
+	// The seconds for which the resolved identities are cached before they are resolved again.
+	CacheTTL int `mapstructure:"cache-ttl"`
 }
 
 type Configuration struct {
 	WebService WebServiceConfig `mapstructure:"webservice"`
 	Logger     LoggerConfig     `mapstructure:"logger"`
 	Agent      AgentConfig      `mapstructure:"agent"`
+	Ontap      OntapConfig      `mapstructure:"ontap"`
+	MagnaScale MagnaScaleConfig `mapstructure:"magnascale"`
+	Job        JobConfig        `mapstructure:"job"`
+	Scheduler  SchedulerConfig  `mapstructure:"scheduler"`
+	Auth       AuthConfig       `mapstructure:"auth"`
+	PKI        PKIConfig        `mapstructure:"pki"`
+	Security   SecurityConfig   `mapstructure:"security"`
+	Identity   IdentityConfig   `mapstructure:"identity"`
 }
 
 var Config Configuration
@@ -1,5 +1,14 @@
 package common
 
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
 type TraceIDKey string
 type HostContextkey string
 
@@ -34,6 +43,15 @@ type SystemInfo struct {
 	BuildNumber    string `json:"build_number"`
 }
 
+// AgentStatus is reported by the agent in its heartbeats.
+type AgentStatus struct {
+	AgentVersion string `json:"agent_version"`
+	// The load average of the last minute on Linux, or the load percentage of the processors on Windows.
+	Load float64 `json:"load"`
+	// The time in seconds since the host booted.
+	Uptime int64 `json:"uptime"`
+}
+
 type DirectoryDetail struct {
 	Name           string `json:"name"`
 	CreationTime   string `json:"creation_time"`
@@ -44,6 +62,144 @@ type DirectoryDetail struct {
 	ParentFullPath string `json:"parent_full_path"`
 }
 
+// DirectoryUpdate is the change of the directory, the directory is renamed in the same parent.
+type DirectoryUpdate struct {
+	NewName string `json:"new_name"`
+}
+
+// Validate checks the new name is a name in the parent directory rather than a path.
+func (u DirectoryUpdate) Validate() error {
+	if u.NewName == "" || u.NewName == "." || u.NewName == ".." || strings.ContainsAny(u.NewName, `/\`) {
+		return fmt.Errorf("invalid name of the directory: %s", u.NewName)
+	}
+
+	return nil
+}
+
+// DirectoryQuota is the quota of a directory and its usage, a limit of 0 means no limit.
+type DirectoryQuota struct {
+	SoftLimitBytes int64 `json:"soft_limit_bytes"`
+	HardLimitBytes int64 `json:"hard_limit_bytes"`
+	SoftLimitFiles int64 `json:"soft_limit_files"`
+	HardLimitFiles int64 `json:"hard_limit_files"`
+	UsedBytes      int64 `json:"used_bytes"`
+	UsedFiles      int64 `json:"used_files"`
+}
+
+// HasLimit reports whether any limit is set in the quota.
+func (q DirectoryQuota) HasLimit() bool {
+	return q.SoftLimitBytes > 0 || q.HardLimitBytes > 0 || q.SoftLimitFiles > 0 || q.HardLimitFiles > 0
+}
+
+// Validate checks the limits are not negative, and the soft limit does not exceed the hard limit if both are set.
+func (q DirectoryQuota) Validate() error {
+	if q.SoftLimitBytes < 0 || q.HardLimitBytes < 0 || q.SoftLimitFiles < 0 || q.HardLimitFiles < 0 {
+		return errors.New("the quota limits must not be negative")
+	}
+
+	if q.HardLimitBytes > 0 && q.SoftLimitBytes > q.HardLimitBytes {
+		return errors.New("the soft limit of capacity exceeds the hard limit")
+	}
+
+	if q.HardLimitFiles > 0 && q.SoftLimitFiles > q.HardLimitFiles {
+		return errors.New("the soft limit of files exceeds the hard limit")
+	}
+
+	return nil
+}
+
+// DirectoryUsage is collected by walking the directory tree on the host.
+type DirectoryUsage struct {
+	UsedBytes int64 `json:"used_bytes"`
+	FileCount int64 `json:"file_count"`
+	// The largest files in descending order of size.
+	LargestFiles []FileUsage `json:"largest_files"`
+	// The files by the age of their last modification, from the newest bucket to the oldest.
+	AgeHistogram []AgeBucket `json:"age_histogram"`
+}
+
+type FileUsage struct {
+	// The path relative to the directory.
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	LastWriteTime string `json:"last_write_time"`
+}
+
+type AgeBucket struct {
+	// The bucket holds the files modified at least MinAgeDays and less than MaxAgeDays ago, 0 MaxAgeDays means no bound.
+	MinAgeDays int   `json:"min_age_days"`
+	MaxAgeDays int   `json:"max_age_days"`
+	FileCount  int64 `json:"file_count"`
+	Bytes      int64 `json:"bytes"`
+}
+
+// The values of ACLEntry, they are normalized from the POSIX ACLs on Linux and the NTFS ACLs on Windows.
+const (
+	PrincipalTypeUser     = "user"
+	PrincipalTypeGroup    = "group"
+	PrincipalTypeEveryone = "everyone"
+
+	ACLTypeAllow = "allow"
+	ACLTypeDeny  = "deny"
+
+	ACLPermissionRead   = "read"
+	ACLPermissionWrite  = "write"
+	ACLPermissionModify = "modify"
+	ACLPermissionFull   = "full"
+)
+
+type ACLEntry struct {
+	// The name of the user or the group, it is ignored for everyone.
+	Principal     string `json:"principal"`
+	PrincipalType string `json:"principal_type"`
+	Type          string `json:"type"`
+	Permission    string `json:"permission"`
+	// The entry is inherited by the files and the directories created in the directory.
+	Inherit bool `json:"inherit"`
+	// The entry applies to the children only, not the directory itself.
+	InheritOnly bool `json:"inherit_only"`
+	// The entry is inherited from the parent directory, it is reported only and never set.
+	Inherited bool `json:"inherited"`
+}
+
+type DirectoryACL struct {
+	Owner string `json:"owner"`
+	// The owning group of the directory on Linux.
+	Group   string     `json:"group"`
+	Entries []ACLEntry `json:"entries"`
+}
+
+// Validate checks the values of the entries.
+func (acl DirectoryACL) Validate() error {
+	for _, entry := range acl.Entries {
+		switch entry.PrincipalType {
+		case PrincipalTypeUser, PrincipalTypeGroup:
+			if entry.Principal == "" {
+				return fmt.Errorf("the principal of the %s entry is empty", entry.PrincipalType)
+			}
+		case PrincipalTypeEveryone:
+		default:
+			return fmt.Errorf("invalid principal type: %s", entry.PrincipalType)
+		}
+
+		if entry.Type != ACLTypeAllow && entry.Type != ACLTypeDeny {
+			return fmt.Errorf("invalid type of the entry: %s", entry.Type)
+		}
+
+		switch entry.Permission {
+		case ACLPermissionRead, ACLPermissionWrite, ACLPermissionModify, ACLPermissionFull:
+		default:
+			return fmt.Errorf("invalid permission: %s", entry.Permission)
+		}
+
+		if entry.InheritOnly && !entry.Inherit {
+			return fmt.Errorf("the entry of %s applies to nothing since it is inherit-only but not inherited", entry.Principal)
+		}
+	}
+
+	return nil
+}
+
 type LocalUserDetail struct {
 	Name                 string `json:"name"`
 	UID                  string `json:"user_id"`
@@ -57,6 +213,131 @@ type LocalUserDetail struct {
 	IsDisabled           bool   `json:"is_disabled"`
 }
 
+// LocalUserUpdate is the change of the local user, the empty password and the nil Disabled are not changed.
+type LocalUserUpdate struct {
+	Password string `json:"password,omitempty"`
+	Disabled *bool  `json:"disabled,omitempty"`
+	// Unlock unlocks the account locked out by the failed logons.
+	Unlock bool `json:"unlock,omitempty"`
+}
+
+// IsEmpty reports whether nothing is changed by the update.
+func (u LocalUserUpdate) IsEmpty() bool {
+	return u.Password == "" && u.Disabled == nil && !u.Unlock
+}
+
+type LocalGroupDetail struct {
+	Name        string `json:"name"`
+	GID         string `json:"group_id"`
+	Description string `json:"description"`
+	// The names of the members without the domain or the server name.
+	Members []string `json:"members"`
+}
+
+// The access levels of the users to the shares.
+const (
+	SharePermissionRead   = "read"
+	SharePermissionChange = "change"
+	SharePermissionFull   = "full"
+	SharePermissionDeny   = "deny"
+)
+
+// ShareAccess is the access level of the user or the group to the share, the deny one takes precedence over the others.
+// Either UserName or GroupName is set.
+type ShareAccess struct {
+	UserName   string `json:"username,omitempty"`
+	GroupName  string `json:"groupname,omitempty"`
+	Permission string `json:"permission"`
+}
+
+// IsGroup reports whether the access level is given to the group.
+func (a ShareAccess) IsGroup() bool {
+	return a.GroupName != ""
+}
+
+// Principal returns the name of the user or the group.
+func (a ShareAccess) Principal() string {
+	if a.IsGroup() {
+		return a.GroupName
+	}
+
+	return a.UserName
+}
+
+// ValidateShareAccess checks the access levels, every user and every group is given one level at most.
+func ValidateShareAccess(access []ShareAccess) error {
+	principals := make(map[string]bool, len(access))
+
+	for _, entry := range access {
+		if entry.UserName == "" && entry.GroupName == "" {
+			return errors.New("neither the username nor the groupname of the share access is given")
+		}
+
+		if entry.UserName != "" && entry.GroupName != "" {
+			return fmt.Errorf("both the user %s and the group %s are given in one share access", entry.UserName, entry.GroupName)
+		}
+
+		switch entry.Permission {
+		case SharePermissionRead, SharePermissionChange, SharePermissionFull, SharePermissionDeny:
+		default:
+			return fmt.Errorf("invalid permission of the share access: %s", entry.Permission)
+		}
+
+		principalType := PrincipalTypeUser
+		if entry.IsGroup() {
+			principalType = PrincipalTypeGroup
+		}
+
+		key := principalType + ":" + strings.ToLower(entry.Principal())
+		if principals[key] {
+			return fmt.Errorf("the %s %s is given more than one access level", principalType, entry.Principal())
+		}
+		principals[key] = true
+	}
+
+	return nil
+}
+
+// GrantShareAccess returns the access levels with the granted ones, the level of the user or the group given already is replaced.
+func GrantShareAccess(access, granted []ShareAccess) []ShareAccess {
+	var userNames, groupNames []string
+	for _, entry := range granted {
+		if entry.IsGroup() {
+			groupNames = append(groupNames, entry.GroupName)
+		} else {
+			userNames = append(userNames, entry.UserName)
+		}
+	}
+
+	return append(RevokeShareAccess(access, userNames, groupNames), granted...)
+}
+
+// RevokeShareAccess returns the access levels without the ones of the users and the groups, the names are case insensitive.
+func RevokeShareAccess(access []ShareAccess, userNames, groupNames []string) []ShareAccess {
+	result := make([]ShareAccess, 0, len(access))
+
+	for _, entry := range access {
+		names := userNames
+		if entry.IsGroup() {
+			names = groupNames
+		}
+
+		revoked := false
+		for _, name := range names {
+			if strings.EqualFold(entry.Principal(), name) {
+				revoked = true
+				break
+			}
+		}
+
+		if !revoked {
+			result = append(result, entry)
+		}
+	}
+
+	return result
+}
+
 type ShareDetail struct {
 	Name          string `json:"name"`
 	Description   string `json:"description"`
@@ -64,8 +345,160 @@ type ShareDetail struct {
 	State         string `json:"state"`
 }
 
+// ShareUpdate is the change of the share, the nil fields are not changed.
+type ShareUpdate struct {
+	Description *string `json:"description,omitempty"`
+}
+
+// IsEmpty reports whether nothing is changed by the update.
+func (u ShareUpdate) IsEmpty() bool {
+	return u.Description == nil
+}
+
+type NFSClient struct {
+	// The client in the format of exports(5), e.g. 192.168.0.10, 192.168.0.0/24, *.example.com or *.
+	Host       string `json:"host"`
+	Access     string `json:"access"`
+	RootSquash bool   `json:"root_squash"`
+}
+
+// The host name, the wildcard, e.g. *.example.com, or the netgroup, e.g. @trusted, of the NFS client.
+var nfsClientHostPattern = regexp.MustCompile(`^@?[A-Za-z0-9*?]([A-Za-z0-9*?._-]*[A-Za-z0-9*?])?$`)
+
+// ValidateNFSClientHost accepts the IP address, the network in CIDR or netmask notation, the host name with the
+// wildcards and the netgroup, which are the forms of the clients in exports(5).
+func ValidateNFSClientHost(host string) error {
+	if net.ParseIP(host) != nil || nfsClientHostPattern.MatchString(host) {
+		return nil
+	}
+
+	if _, _, err := net.ParseCIDR(host); err == nil {
+		return nil
+	}
+
+	if address, mask, found := strings.Cut(host, "/"); found && net.ParseIP(address).To4() != nil && net.ParseIP(mask).To4() != nil {
+		return nil
+	}
+
+	return fmt.Errorf("invalid NFS client host %q", host)
+}
+
+type NFSExportDetail struct {
+	Name          string      `json:"name"`
+	DirectoryPath string      `json:"directory_path"`
+	Clients       []NFSClient `json:"clients"`
+}
+
+// The methods which the snapshots of the directories are taken by.
+const (
+	SnapshotMethodBtrfs   = "btrfs"
+	SnapshotMethodReflink = "reflink"
+	SnapshotMethodCopy    = "copy"
+)
+
+// SnapshotDetail is a point-in-time copy of a directory on its host.
+type SnapshotDetail struct {
+	Name          string    `json:"name"`
+	DirectoryName string    `json:"directory_name"`
+	Method        string    `json:"method"`
+	CreationTime  time.Time `json:"creation_time"`
+}
+
+// ValidateSnapshotName checks the name of the snapshot is a name rather than a path.
+func ValidateSnapshotName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid name of the snapshot: %s", name)
+	}
+
+	return nil
+}
+
+// The frequencies which the snapshot policies take the snapshots at.
+const (
+	SnapshotFrequencyHourly = "hourly"
+	SnapshotFrequencyDaily  = "daily"
+	SnapshotFrequencyWeekly = "weekly"
+)
+
+var snapshotFrequencyIntervals = map[string]time.Duration{
+	SnapshotFrequencyHourly: time.Hour,
+	SnapshotFrequencyDaily:  24 * time.Hour,
+	SnapshotFrequencyWeekly: 7 * 24 * time.Hour,
+}
+
+// SnapshotFrequencyInterval returns the interval between the snapshots of the frequency, or false if it is unknown.
+func SnapshotFrequencyInterval(frequency string) (time.Duration, bool) {
+	interval, ok := snapshotFrequencyIntervals[frequency]
+
+	return interval, ok
+}
+
+// ValidateSnapshotPolicy checks the policy names its snapshots by the name, and keeps at least one snapshot.
+func ValidateSnapshotPolicy(name, frequency string, keep int) error {
+	if err := ValidateSnapshotName(name); err != nil {
+		return fmt.Errorf("invalid name of the snapshot policy: %s", name)
+	}
+
+	if _, ok := SnapshotFrequencyInterval(frequency); !ok {
+		return fmt.Errorf("invalid frequency of the snapshot policy: %s", frequency)
+	}
+
+	if keep < 1 {
+		return fmt.Errorf("the snapshot policy must keep at least 1 snapshot")
+	}
+
+	return nil
+}
+
+// The types of the entries in the manifest of the directory replicated.
+const (
+	ReplicationEntryDirectory = "directory"
+	ReplicationEntryFile      = "file"
+	ReplicationEntrySymlink   = "symlink"
+)
+
+// ReplicationEntry is a directory, file or symbolic link in the manifest of the directory replicated, its path is
+// relative to the directory and separated by "/". The checksum is set for the files only.
+type ReplicationEntry struct {
+	Path       string    `json:"path"`
+	Type       string    `json:"type"`
+	Mode       uint32    `json:"mode"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	SHA256     string    `json:"sha256,omitempty"`
+	LinkTarget string    `json:"link_target,omitempty"`
+}
+
+// ReplicationSource tells the destination agent where to pull the directory from. The token is issued by the source
+// agent for reading the directory only, the certificate of the source agent is pinned to the fingerprint if the agent
+// is connected by mutual TLS.
+type ReplicationSource struct {
+	Scheme          string `json:"scheme"`
+	Address         string `json:"address"`
+	CertFingerprint string `json:"cert_fingerprint"`
+	Token           string `json:"token"`
+}
+
+// ReplicationResult is what a transfer of the replication did to the destination directory.
+type ReplicationResult struct {
+	FilesTransferred int64 `json:"files_transferred"`
+	BytesTransferred int64 `json:"bytes_transferred"`
+	// The files whose transfer was interrupted before and resumed from the chunks received.
+	FilesResumed   int64 `json:"files_resumed"`
+	FilesUnchanged int64 `json:"files_unchanged"`
+	FilesDeleted   int64 `json:"files_deleted"`
+}
+
+const (
+	// ReplicationTokenHeader is the header of the request in which the destination agent sends the replication token.
+	ReplicationTokenHeader = "X-Replication-Token"
+	// ReplicationChunkHeader is the header of the response in which the source agent returns the checksum of the chunk.
+	ReplicationChunkHeader = "X-Chunk-SHA256"
+)
+
+// AgentTokenHeader is the header of the response in which the agent returns the session token.
+const AgentTokenHeader = "X-Agent-Token"
+
 type FailedRESTResponse struct {
 	Error string `json:"error"`
 }
-
-var SecurityKey = "0123456789ABCDEF0123456789ABCDEF"
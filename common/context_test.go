@@ -0,0 +1,32 @@
+package common
+
+import "testing"
+
+func TestValidateNFSClientHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{host: "192.168.0.10"},
+		{host: "192.168.0.0/24"},
+		{host: "192.168.0.0/255.255.255.0"},
+		{host: "fd00::/64"},
+		{host: "*"},
+		{host: "*.example.com"},
+		{host: "client-01.example.com"},
+		{host: "@trusted"},
+		{host: "", wantErr: true},
+		{host: "x\n/ *(rw,no_root_squash)", wantErr: true},
+		{host: "client(rw)", wantErr: true},
+		{host: "client name", wantErr: true},
+		{host: "192.168.0.0/33", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if err := ValidateNFSClientHost(tt.host); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateNFSClientHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EncryptionKeysEnv is the environment variable of the encryption keys, e.g. "k2:<base64 key>,k1:<base64 key>".
+// The first key is the current key. The keys in it take precedence over the key file.
+const EncryptionKeysEnv = "DME_ENCRYPTION_KEYS"
+
+// The key which encrypted the secrets before the key management, the secrets without key ID are decrypted by it.
+// It is never used to encrypt, the secrets are encrypted by the current key once the keys are rotated.
+const legacyEncryptionKey = "0123456789ABCDEF0123456789ABCDEF"
+
+var (
+	ErrKeyNotFound         = errors.New("the encryption key is not found")
+	ErrRotationUnsupported = errors.New("the key store does not support rotation")
+)
+
+// KeyStore keeps the keys to encrypt the secrets, e.g. the passwords in database. The local key file is the built-in
+// implementation, an external KMS can be used by implementing the interface and calling SetKeyStore at startup.
+type KeyStore interface {
+	// CurrentKey returns the ID and the value of the key to encrypt the new secrets.
+	CurrentKey() (keyID string, key []byte, err error)
+	// GetKey returns the key by its ID to decrypt the secrets encrypted by it, or ErrKeyNotFound.
+	GetKey(keyID string) (key []byte, err error)
+	// Rotate creates a new key which becomes the current key. The old keys are kept to decrypt the existing secrets.
+	Rotate() (keyID string, err error)
+}
+
+var (
+	keyStoreMu sync.Mutex
+	keyStore   KeyStore
+)
+
+// SetKeyStore replaces the key store, e.g. by the client of an external KMS.
+func SetKeyStore(store KeyStore) {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+
+	keyStore = store
+}
+
+// GetKeyStore returns the key store. By default the keys are loaded from the environment variable DME_ENCRYPTION_KEYS
+// if it is set, or from the key file of the configuration [security] which is created at the first use.
+func GetKeyStore() (KeyStore, error) {
+	keyStoreMu.Lock()
+	defer keyStoreMu.Unlock()
+
+	if keyStore != nil {
+		return keyStore, nil
+	}
+
+	var err error
+	if value := os.Getenv(EncryptionKeysEnv); value != "" {
+		keyStore, err = NewEnvKeyStore(value)
+	} else {
+		keyStore, err = NewFileKeyStore(Config.Security.KeyFile)
+	}
+	if err != nil {
+		keyStore = nil
+		return nil, err
+	}
+
+	return keyStore, nil
+}
+
+// EncryptSecret encrypts the secret by the current key, the ID of the key is embedded in the result as "<key ID>:<ciphertext>".
+func EncryptSecret(plaintext string) (string, error) {
+	store, err := GetKeyStore()
+	if err != nil {
+		return "", err
+	}
+
+	keyID, key, err := store.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := Encrypt(plaintext, string(key))
+	if err != nil {
+		return "", err
+	}
+
+	return keyID + ":" + ciphertext, nil
+}
+
+// DecryptSecret decrypts the secret by the key whose ID is embedded in it.
+func DecryptSecret(secret string) (string, error) {
+	keyID, ciphertext, found := strings.Cut(secret, ":")
+	if !found {
+		return Decrypt(secret, legacyEncryptionKey)
+	}
+
+	store, err := GetKeyStore()
+	if err != nil {
+		return "", err
+	}
+
+	key, err := store.GetKey(keyID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the encryption key %s: %w", keyID, err)
+	}
+
+	return Decrypt(ciphertext, string(key))
+}
+
+// IsEncryptedByCurrentKey reports whether the secret is encrypted by the current key, i.e. it need not be re-encrypted.
+func IsEncryptedByCurrentKey(secret string) (bool, error) {
+	store, err := GetKeyStore()
+	if err != nil {
+		return false, err
+	}
+
+	currentKeyID, _, err := store.CurrentKey()
+	if err != nil {
+		return false, err
+	}
+
+	keyID, _, found := strings.Cut(secret, ":")
+
+	return found && keyID == currentKeyID, nil
+}
+
+type encryptionKey struct {
+	ID        string    `json:"id"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newEncryptionKey() (encryptionKey, error) {
+	id := make([]byte, 4)
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(id); err != nil {
+		return encryptionKey{}, err
+	}
+	if _, err := rand.Read(key); err != nil {
+		return encryptionKey{}, err
+	}
+
+	return encryptionKey{ID: hex.EncodeToString(id), Key: key, CreatedAt: time.Now()}, nil
+}
+
+// FileKeyStore keeps the keys in a local JSON file which is readable by the owner only.
+type FileKeyStore struct {
+	mu   sync.Mutex
+	path string
+	data struct {
+		CurrentKeyID string          `json:"current_key_id"`
+		Keys         []encryptionKey `json:"keys"`
+	}
+}
+
+// NewFileKeyStore loads the keys from the file, the file is created with a new key if it does not exist.
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	if path == "" {
+		return nil, errors.New("the key file is not configured")
+	}
+
+	store := &FileKeyStore{path: path}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := store.Rotate(); err != nil {
+			return nil, err
+		}
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read the key file: %w", err)
+	}
+
+	if err := json.Unmarshal(content, &store.data); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+
+	if _, err := store.getKey(store.data.CurrentKeyID); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: the current key %s is missing", path, store.data.CurrentKeyID)
+	}
+
+	return store, nil
+}
+
+func (s *FileKeyStore) CurrentKey() (string, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.getKey(s.data.CurrentKeyID)
+
+	return s.data.CurrentKeyID, key, err
+}
+
+func (s *FileKeyStore) GetKey(keyID string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getKey(keyID)
+}
+
+func (s *FileKeyStore) getKey(keyID string) ([]byte, error) {
+	for _, key := range s.data.Keys {
+		if key.ID == keyID {
+			return key.Key, nil
+		}
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// Rotate adds a new key to the file as the current key.
+func (s *FileKeyStore) Rotate() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := newEncryptionKey()
+	if err != nil {
+		return "", err
+	}
+
+	data := s.data
+	data.Keys = append(append([]encryptionKey{}, data.Keys...), key)
+	data.CurrentKeyID = key.ID
+
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return "", err
+	}
+
+	// Write a temporary file and rename it, so that the keys are never lost by a partial write.
+	tempFile := s.path + ".tmp"
+	if err := os.WriteFile(tempFile, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to save the key file: %w", err)
+	}
+	if err := os.Rename(tempFile, s.path); err != nil {
+		return "", fmt.Errorf("failed to save the key file: %w", err)
+	}
+
+	s.data = data
+
+	return key.ID, nil
+}
+
+// EnvKeyStore keeps the keys given by the environment variable, its keys are rotated by changing the variable.
+type EnvKeyStore struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// NewEnvKeyStore parses the keys in the format "<key ID>:<base64 key>,...", the first key is the current key.
+func NewEnvKeyStore(value string) (*EnvKeyStore, error) {
+	store := &EnvKeyStore{keys: make(map[string][]byte)}
+
+	for _, item := range strings.Split(value, ",") {
+		keyID, encodedKey, found := strings.Cut(strings.TrimSpace(item), ":")
+		if !found || keyID == "" {
+			return nil, fmt.Errorf("invalid encryption key in %s, the format is <key ID>:<base64 key>", EncryptionKeysEnv)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("invalid encryption key %s in %s, it must be %d bytes in base64", keyID, EncryptionKeysEnv, KeySize)
+		}
+
+		if store.currentKeyID == "" {
+			store.currentKeyID = keyID
+		}
+		store.keys[keyID] = key
+	}
+
+	return store, nil
+}
+
+func (s *EnvKeyStore) CurrentKey() (string, []byte, error) {
+	return s.currentKeyID, s.keys[s.currentKeyID], nil
+}
+
+func (s *EnvKeyStore) GetKey(keyID string) ([]byte, error) {
+	if key, exist := s.keys[keyID]; exist {
+		return key, nil
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+func (s *EnvKeyStore) Rotate() (string, error) {
+	return "", ErrRotationUnsupported
+}
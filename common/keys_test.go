@@ -0,0 +1,113 @@
+package common
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func useKeyStore(t *testing.T, store KeyStore) {
+	SetKeyStore(store)
+	t.Cleanup(func() { SetKeyStore(nil) })
+}
+
+func TestFileKeyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "keys.json")
+
+	store, err := NewFileKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewFileKeyStore() error = %v", err)
+	}
+	useKeyStore(t, store)
+
+	secret, err := EncryptSecret("Password123")
+	if err != nil {
+		t.Fatalf("EncryptSecret() error = %v", err)
+	}
+
+	oldKeyID, _, _ := store.CurrentKey()
+	if !strings.HasPrefix(secret, oldKeyID+":") {
+		t.Errorf("EncryptSecret() = %v, want the key ID %v embedded", secret, oldKeyID)
+	}
+
+	newKeyID, err := store.Rotate()
+	if err != nil || newKeyID == oldKeyID {
+		t.Fatalf("Rotate() = %v, error = %v", newKeyID, err)
+	}
+
+	// The secret encrypted by the old key is still decrypted after the rotation, also by the reloaded key store.
+	reloaded, err := NewFileKeyStore(path)
+	if err != nil {
+		t.Fatalf("NewFileKeyStore() error = %v", err)
+	}
+	useKeyStore(t, reloaded)
+
+	if keyID, _, _ := reloaded.CurrentKey(); keyID != newKeyID {
+		t.Errorf("CurrentKey() = %v, want %v", keyID, newKeyID)
+	}
+
+	if current, _ := IsEncryptedByCurrentKey(secret); current {
+		t.Errorf("IsEncryptedByCurrentKey() = true, want false after the rotation")
+	}
+
+	if plaintext, err := DecryptSecret(secret); err != nil || plaintext != "Password123" {
+		t.Errorf("DecryptSecret() = %v, error = %v", plaintext, err)
+	}
+}
+
+func TestDecryptSecret(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte("ABCDEF0123456789ABCDEF0123456789"))
+	store, err := NewEnvKeyStore("k2:" + key + ",k1:" + key)
+	if err != nil {
+		t.Fatalf("NewEnvKeyStore() error = %v", err)
+	}
+	useKeyStore(t, store)
+
+	legacySecret, _ := Encrypt("Password123", legacyEncryptionKey)
+	k1Secret, _ := Encrypt("Password123", "ABCDEF0123456789ABCDEF0123456789")
+
+	tests := []struct {
+		name    string
+		secret  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "test_legacy_secret",
+			secret: legacySecret,
+			want:   "Password123",
+		},
+		{
+			name:   "test_old_key",
+			secret: "k1:" + k1Secret,
+			want:   "Password123",
+		},
+		{
+			name:    "test_unknown_key",
+			secret:  "k0:" + k1Secret,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptSecret(tt.secret)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecryptSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("DecryptSecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := store.Rotate(); err != ErrRotationUnsupported {
+		t.Errorf("Rotate() error = %v, want %v", err, ErrRotationUnsupported)
+	}
+
+	if _, err := NewEnvKeyStore("k1:short"); err == nil {
+		t.Errorf("NewEnvKeyStore() expected an error for the invalid key")
+	}
+}
@@ -308,10 +308,10 @@ func MaskPassword(data interface{}) interface{} {
 	}
 
 	if value.Kind() == reflect.String {
-		// 定义一个正则表达式，匹配 "password": "..."
-		re := regexp.MustCompile(`("password":\s*")([^\\"]+)(")`)
+		// 定义一个正则表达式，匹配 "password": "..." 和 "token": "..."，以及 "heartbeat_token": "..." 等
+		re := regexp.MustCompile(`("(?:\w+_)?(?:password|token)":\s*")([^\\"]+)(")`)
 
-		// 使用 ReplaceAllString 方法，将匹配到的 "password" 值替换为 "********"
+		// 使用 ReplaceAllString 方法，将匹配到的 "password" 和 "token" 值替换为 "********"
 		maskedInput := re.ReplaceAllString(data.(string), `$1********$3`)
 
 		return maskedInput
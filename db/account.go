@@ -0,0 +1,56 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// Account is the user of the portal API, which is not to be confused with the local user on the hosts.
+type Account struct {
+	gorm.Model
+	Name string `gorm:"unique;column:name"`
+	// The bcrypt hash of the password, the password itself is never stored.
+	PasswordHash string `gorm:"column:password_hash"`
+	// The role of the account, i.e. admin, operator or read-only.
+	Role string `gorm:"column:role"`
+}
+
+func (a *Account) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(a).First(a).Error
+}
+
+func (a *Account) Save(engine *DatabaseEngine) error {
+	return engine.DB.Save(a).Error
+}
+
+func (a *Account) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Unscoped().Where(a).Delete(a).Error
+}
+
+type AccountList struct {
+	Accounts []Account
+}
+
+func (al *AccountList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := Account{}
+
+	if filter.Pagination != nil {
+		return errors.New("invalid filter: pagination is not supported")
+	}
+
+	if _, err := Query(engine, model, filter, &al.Accounts); err != nil {
+		return fmt.Errorf("failed to query the accounts by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+// Count returns the number of the accounts with the role, or all the accounts if the role is empty.
+func (al *AccountList) Count(engine *DatabaseEngine, role string) (count int64, err error) {
+	err = engine.DB.Model(&Account{}).Where(&Account{Role: role}).Count(&count).Error
+
+	return count, err
+}
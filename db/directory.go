@@ -3,6 +3,7 @@ package db
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"gorm.io/gorm"
@@ -18,6 +19,18 @@ type Directory struct {
 	FullPath       string `gorm:"column:full_path"`
 	ParentFullPath string `gorm:"column:parent_full_path"`
 
+	// The quota limits of the directory, 0 means no limit.
+	SoftLimitBytes int64 `gorm:"column:soft_limit_bytes"`
+	HardLimitBytes int64 `gorm:"column:hard_limit_bytes"`
+	SoftLimitFiles int64 `gorm:"column:soft_limit_files"`
+	HardLimitFiles int64 `gorm:"column:hard_limit_files"`
+	// The usage of the directory reported by its host at UsageUpdateTime.
+	UsedBytes       int64              `gorm:"column:used_bytes"`
+	UsedFiles       int64              `gorm:"column:used_files"`
+	LargestFiles    []common.FileUsage `gorm:"column:largest_files;serializer:json"`
+	AgeHistogram    []common.AgeBucket `gorm:"column:age_histogram;serializer:json"`
+	UsageUpdateTime *time.Time         `gorm:"column:usage_update_time"`
+
 	HostIP string `gorm:"column:host_ip"` // Foreign key column for the Host's IP
 }
 
@@ -28,6 +41,12 @@ func (d *Directory) Get(engine *DatabaseEngine) error {
 func (d *Directory) Save(engine *DatabaseEngine) error {
 	return engine.DB.Save(d).Error
 }
+
+// Update saves the columns of the Directory only.
+func (d *Directory) Update(engine *DatabaseEngine, columns ...string) error {
+	return engine.DB.Model(d).Select(columns).Updates(d).Error
+}
+
 func (d *Directory) Delete(engine *DatabaseEngine) error {
 	return engine.DB.Unscoped().Where(d).Delete(d).Error
 }
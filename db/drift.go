@@ -0,0 +1,89 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// DriftReport is the result of a reconciliation of the host, every difference between the records in database
+// and the resources on the host is recorded as a drift item.
+type DriftReport struct {
+	gorm.Model
+	HostIP       string `gorm:"index;column:host_ip"`
+	TraceID      string `gorm:"column:trace_id"`
+	AutoImport   bool   `gorm:"column:auto_import"`
+	MarkStale    bool   `gorm:"column:mark_stale"`
+	MissingCount int    `gorm:"column:missing_count"`
+	ExtraCount   int    `gorm:"column:extra_count"`
+	ChangedCount int    `gorm:"column:changed_count"`
+
+	// Association for the items of the report
+	Items []DriftItem `gorm:"foreignKey:DriftReportID"`
+}
+
+type DriftItem struct {
+	gorm.Model
+	DriftReportID uint   `gorm:"index;column:drift_report_id"`
+	ResourceType  string `gorm:"column:resource_type"`
+	Name          string `gorm:"column:name"`
+	DriftType     string `gorm:"column:drift_type"`
+	// The changed attributes in the form of "attribute: old -> new".
+	Detail string `gorm:"column:detail"`
+	Action string `gorm:"column:action"`
+	Error  string `gorm:"column:error"`
+}
+
+func (r *DriftReport) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(r).Preload("Items").First(r).Error
+}
+
+// Save saves the report with its items.
+func (r *DriftReport) Save(engine *DatabaseEngine) error {
+	return engine.DB.Session(&gorm.Session{FullSaveAssociations: true}).Save(r).Error
+}
+
+type DriftReportList struct {
+	Reports []DriftReport
+}
+
+func (rl *DriftReportList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := DriftReport{}
+
+	if filter.Pagination != nil {
+		return errors.New("invalid filter: pagination is not supported")
+	}
+
+	filter.PreloadModel = "Items"
+	if _, err := Query(engine, model, filter, &rl.Reports); err != nil {
+		return fmt.Errorf("failed to query the drift reports by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationDriftReport struct {
+	Reports    []DriftReport
+	TotalCount int64
+}
+
+func (rl *DriftReportList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationReport PaginationDriftReport, err error) {
+	model := DriftReport{}
+
+	if filter.Pagination == nil {
+		return paginationReport, errors.New("invalid filter: missing pagination")
+	}
+
+	filter.PreloadModel = "Items"
+	totalCount, err := Query(engine, model, filter, &rl.Reports)
+	if err != nil {
+		return paginationReport, fmt.Errorf("failed to query drift reports by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationReport.Reports = rl.Reports
+	paginationReport.TotalCount = totalCount
+
+	return paginationReport, nil
+}
@@ -41,10 +41,26 @@ func GetDatabaseEngine() (*DatabaseEngine, error) {
 	engine = &DatabaseEngine{
 		DB: db.Debug(),
 		Models: map[string]interface{}{
-			"host_info":  &Host{},
-			"share":      &CIFSShare{},
-			"directory":  &Directory{},
-			"local_user": &LocalUser{},
+			"host_info":         &Host{},
+			"share":             &CIFSShare{},
+			"share_access":      &CIFSShareAccess{},
+			"directory":         &Directory{},
+			"local_user":        &LocalUser{},
+			"local_group":       &LocalGroup{},
+			"group_member":      &LocalGroupMember{},
+			"nfs_export":        &NFSExport{},
+			"nfs_client":        &NFSExportClient{},
+			"job":               &Job{},
+			"job_item":          &JobItem{},
+			"host_health_check": &HostHealthCheck{},
+			"drift_report":      &DriftReport{},
+			"drift_item":        &DriftItem{},
+			"account":           &Account{},
+			"identity":          &Identity{},
+			"snapshot":          &Snapshot{},
+			"snapshot_policy":   &SnapshotPolicy{},
+			"policy_directory":  &SnapshotPolicyDirectory{},
+			"replication":       &Replication{},
 		},
 	}
 
@@ -58,6 +74,11 @@ func (engine *DatabaseEngine) Migrate() error {
 		models = append(models, model)
 	}
 
+	// The columns are dropped before the auto migration, which creates the indexes lost by SQLite on dropping them.
+	if err := migrateCIFSShareAccess(engine.DB); err != nil {
+		return fmt.Errorf("error occurred while migrating the access of the shares: %w", err)
+	}
+
 	if err := engine.DB.AutoMigrate(models...); err != nil {
 		return fmt.Errorf("error occurred during auto migration: %w", err)
 	}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+type NFSExport struct {
+	gorm.Model
+	HostIP        string `gorm:"column:host_ip"`
+	DirectoryName string `gorm:"column:directory_name"`
+	// The path to mount the export, e.g. 192.168.0.1:/srv/dme/data.
+	Path string `gorm:"uniqueIndex:idx_nfs_export_unique;column:path"`
+
+	// Association for the clients allowed to mount the export
+	Clients []NFSExportClient `gorm:"foreignKey:NFSExportID"`
+}
+
+type NFSExportClient struct {
+	gorm.Model
+	NFSExportID uint   `gorm:"index;column:nfs_export_id"`
+	Host        string `gorm:"column:host"`
+	Access      string `gorm:"column:access"`
+	RootSquash  bool   `gorm:"column:root_squash"`
+}
+
+func (e *NFSExport) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(e).Preload("Clients").First(e).Error
+}
+
+// Save saves the export with its clients, the clients not in the export any more are removed.
+func (e *NFSExport) Save(engine *DatabaseEngine) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Clients").Save(e).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("nfs_export_id = ?", e.ID).Delete(&NFSExportClient{}).Error; err != nil {
+			return err
+		}
+
+		for i := range e.Clients {
+			e.Clients[i].ID = 0
+			e.Clients[i].NFSExportID = e.ID
+		}
+
+		if len(e.Clients) == 0 {
+			return nil
+		}
+
+		return tx.Create(&e.Clients).Error
+	})
+}
+
+func (e *NFSExport) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(e).First(e).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("nfs_export_id = ?", e.ID).Delete(&NFSExportClient{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(e).Error
+	})
+}
+
+type NFSExportList struct {
+	Exports []NFSExport
+}
+
+func (el *NFSExportList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := NFSExport{}
+
+	if filter.Pagination != nil {
+		return fmt.Errorf("invalid filter: pagination is not supported")
+	}
+
+	filter.PreloadModel = "Clients"
+	if _, err := Query(engine, model, filter, &el.Exports); err != nil {
+		return fmt.Errorf("failed to query the exports by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationNFSExport struct {
+	Exports    []NFSExport
+	TotalCount int64
+}
+
+func (el *NFSExportList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationExport PaginationNFSExport, err error) {
+	model := NFSExport{}
+
+	if filter.Pagination == nil {
+		return paginationExport, fmt.Errorf("invalid filter: missing pagination")
+	}
+
+	filter.PreloadModel = "Clients"
+	totalCount, err := Query(engine, model, filter, &el.Exports)
+	if err != nil {
+		return paginationExport, fmt.Errorf("failed to query exports by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationExport.Exports = el.Exports
+	paginationExport.TotalCount = totalCount
+
+	return paginationExport, nil
+}
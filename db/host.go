@@ -3,6 +3,7 @@ package db
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"gorm.io/gorm"
@@ -15,11 +16,33 @@ type Host struct {
 	Username       string `gorm:"column:username"`
 	Password       string `gorm:"type:password;column:password"`
 	StorageType    string `gorm:"column:storage_type"`
+	Scheme         string `gorm:"column:scheme"`
+	Port           int    `gorm:"column:port"`
 	Caption        string `gorm:"column:os_type"`
 	OSArchitecture string `gorm:"column:os_arch"`
 	OSVersion      string `gorm:"column:os_version"`
 	BuildNumber    string `gorm:"column:build_number"`
 	Connected      bool   `json:"connected,omitempty"`
+	// Skip the verification of the certificate of the storage management API.
+	InsecureSkipVerify bool `gorm:"column:insecure_skip_verify"`
+	// The fingerprint of the certificate issued to the agent, the connections to the agent are pinned to it.
+	CertFingerprint string `gorm:"column:cert_fingerprint"`
+	// The state of the health check, i.e. connected, degraded or unreachable.
+	HealthState string `gorm:"column:health_state"`
+	// The number of the consecutive failed health checks.
+	FailureCount    int        `gorm:"column:failure_count"`
+	LastCheckTime   *time.Time `gorm:"column:last_check_time"`
+	LastSuccessTime *time.Time `gorm:"column:last_success_time"`
+	StateChangeTime *time.Time `gorm:"column:state_change_time"`
+	// The health check of the host is skipped until the time, to back off from the unreachable host.
+	NextCheckTime *time.Time `gorm:"column:next_check_time"`
+	// The host whose agent called home is pending until it is approved, it is not managed until then.
+	RegistrationState string `gorm:"column:registration_state;default:registered"`
+	// The status reported by the latest heartbeat of the agent.
+	AgentVersion      string     `gorm:"column:agent_version"`
+	Load              float64    `gorm:"column:load"`
+	Uptime            int64      `gorm:"column:uptime"`
+	LastHeartbeatTime *time.Time `gorm:"column:last_heartbeat_time"`
 
 	// Association for the Host's Directories using foreign key
 	Directories []Directory `gorm:"foreignKey:HostIP;references:IP"`
@@ -32,7 +55,7 @@ func (h *Host) Get(engine *DatabaseEngine) error {
 		return err
 	}
 
-	h.Password, err = common.Decrypt(h.Password, common.SecurityKey)
+	h.Password, err = common.DecryptSecret(h.Password)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt password: %w", err)
 	}
@@ -42,7 +65,7 @@ func (h *Host) Get(engine *DatabaseEngine) error {
 
 // Save a Host to the database.
 func (h *Host) Save(engine *DatabaseEngine) (err error) {
-	h.Password, err = common.Encrypt(h.Password, common.SecurityKey)
+	h.Password, err = common.EncryptSecret(h.Password)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
@@ -50,6 +73,28 @@ func (h *Host) Save(engine *DatabaseEngine) (err error) {
 	return engine.DB.Save(h).Error
 }
 
+// UpdateHealth saves the health state of the Host only, the other columns, e.g. the encrypted password, are left untouched.
+func (h *Host) UpdateHealth(engine *DatabaseEngine) error {
+	return engine.DB.Model(h).
+		Select("connected", "health_state", "failure_count", "last_check_time", "last_success_time", "state_change_time", "next_check_time").
+		Updates(h).Error
+}
+
+// Update saves the columns of the Host only, the password is encrypted if it is selected.
+func (h *Host) Update(engine *DatabaseEngine, columns ...string) (err error) {
+	for _, column := range columns {
+		if column == "password" {
+			h.Password, err = common.EncryptSecret(h.Password)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt password: %w", err)
+			}
+			break
+		}
+	}
+
+	return engine.DB.Model(h).Select(columns).Updates(h).Error
+}
+
 // Delete a Host from the database.
 func (h *Host) Delete(engine *DatabaseEngine) error {
 	return engine.DB.Unscoped().Where(h).Delete(h).Error
@@ -74,7 +119,7 @@ func (hl *HostList) Get(engine *DatabaseEngine, filter *common.QueryFilter) erro
 	for i := range hl.Hosts {
 		if hl.Hosts[i].Password != "" {
 			var err error
-			hl.Hosts[i].Password, err = common.Decrypt(hl.Hosts[i].Password, common.SecurityKey)
+			hl.Hosts[i].Password, err = common.DecryptSecret(hl.Hosts[i].Password)
 			if err != nil {
 				return fmt.Errorf("failed to decrypt password: %w", err)
 			}
@@ -104,7 +149,7 @@ func (hl *HostList) Pagination(engine *DatabaseEngine, filter *common.QueryFilte
 
 	for i := range hl.Hosts {
 		if hl.Hosts[i].Password != "" {
-			hl.Hosts[i].Password, err = common.Decrypt(hl.Hosts[i].Password, common.SecurityKey)
+			hl.Hosts[i].Password, err = common.DecryptSecret(hl.Hosts[i].Password)
 			if err != nil {
 				return paginationHost, fmt.Errorf("failed to decrypt password: %w", err)
 			}
@@ -124,7 +169,7 @@ func (hl *HostList) Save(engine *DatabaseEngine) (err error) {
 	}
 
 	for i, host := range hl.Hosts {
-		hl.Hosts[i].Password, err = common.Encrypt(host.Password, common.SecurityKey)
+		hl.Hosts[i].Password, err = common.EncryptSecret(host.Password)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt password for host %v: %w", host.ComputerName, err)
 		}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// HostHealthCheck is the result of a health check of the host.
+type HostHealthCheck struct {
+	gorm.Model
+	HostIP    string    `gorm:"index;column:host_ip"`
+	State     string    `gorm:"column:state"`
+	CheckTime time.Time `gorm:"column:check_time"`
+	// The time in milliseconds taken by the check.
+	Latency int64  `gorm:"column:latency"`
+	Error   string `gorm:"column:error"`
+}
+
+func (c *HostHealthCheck) Save(engine *DatabaseEngine) error {
+	return engine.DB.Save(c).Error
+}
+
+type HostHealthCheckList struct {
+	Checks []HostHealthCheck
+}
+
+// Get retrieves the latest health checks of the host, the latest one is the first.
+func (cl *HostHealthCheckList) Get(engine *DatabaseEngine, hostIP string, limit int) error {
+	return engine.DB.Where("host_ip = ?", hostIP).Order("check_time DESC").Limit(limit).Find(&cl.Checks).Error
+}
+
+// Prune keeps the latest health checks of the host only.
+func (cl *HostHealthCheckList) Prune(engine *DatabaseEngine, hostIP string, keep int) error {
+	latest := engine.DB.Model(&HostHealthCheck{}).Select("id").Where("host_ip = ?", hostIP).Order("check_time DESC").Limit(keep)
+
+	return engine.DB.Unscoped().Where("host_ip = ? AND id NOT IN (?)", hostIP, latest).Delete(&HostHealthCheck{}).Error
+}
+
+// Delete deletes all the health checks of the host.
+func (cl *HostHealthCheckList) Delete(engine *DatabaseEngine, hostIP string) error {
+	return engine.DB.Unscoped().Where("host_ip = ?", hostIP).Delete(&HostHealthCheck{}).Error
+}
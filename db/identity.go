@@ -0,0 +1,41 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Identity caches the domain user or group resolved by the directory service.
+type Identity struct {
+	gorm.Model
+	// The account name in lower case, the account names are case insensitive.
+	Key         string `gorm:"uniqueIndex:idx_identity_unique;column:key"`
+	Type        string `gorm:"uniqueIndex:idx_identity_unique;column:type"`
+	Name        string `gorm:"column:name"`
+	Domain      string `gorm:"column:domain"`
+	DisplayName string `gorm:"column:display_name"`
+	// The SID, or the UID or the GID of the identity.
+	IdentityID  string    `gorm:"column:identity_id"`
+	DN          string    `gorm:"column:dn"`
+	ResolveTime time.Time `gorm:"column:resolve_time"`
+}
+
+func (i *Identity) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(i).First(i).Error
+}
+
+// Save saves the identity, the one cached by the same key and type is replaced.
+func (i *Identity) Save(engine *DatabaseEngine) error {
+	var cached Identity
+	err := engine.DB.Where(&Identity{Key: i.Key, Type: i.Type}).First(&cached).Error
+	if err == nil {
+		i.ID = cached.ID
+		i.CreatedAt = cached.CreatedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return engine.DB.Save(i).Error
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// Job is an asynchronous batch operation, every item of the batch is recorded as a job item.
+type Job struct {
+	gorm.Model
+	Type           string     `gorm:"index;column:type"`
+	State          string     `gorm:"index;column:state"`
+	TraceID        string     `gorm:"column:trace_id"`
+	TotalCount     int        `gorm:"column:total_count"`
+	SucceededCount int        `gorm:"column:succeeded_count"`
+	FailedCount    int        `gorm:"column:failed_count"`
+	CancelledCount int        `gorm:"column:cancelled_count"`
+	StartedAt      *time.Time `gorm:"column:started_at"`
+	FinishedAt     *time.Time `gorm:"column:finished_at"`
+
+	// Association for the items of the job
+	Items []JobItem `gorm:"foreignKey:JobID"`
+}
+
+type JobItem struct {
+	gorm.Model
+	JobID     uint   `gorm:"index;column:job_id"`
+	ItemIndex int    `gorm:"column:item_index"`
+	Name      string `gorm:"column:name"`
+	State     string `gorm:"column:state"`
+	// The result of the item in JSON.
+	Result string `gorm:"column:result"`
+	Error  string `gorm:"column:error"`
+}
+
+func (j *Job) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(j).Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("item_index")
+	}).First(j).Error
+}
+
+// Save saves the job with its items.
+func (j *Job) Save(engine *DatabaseEngine) error {
+	return engine.DB.Session(&gorm.Session{FullSaveAssociations: true}).Save(j).Error
+}
+
+// UpdateProgress saves the state and the counters of the job, together with the item changed if any, so the other
+// items are not saved again.
+func (j *Job) UpdateProgress(engine *DatabaseEngine, item *JobItem) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if item != nil {
+			if err := tx.Model(item).Select("state", "result", "error").Updates(item).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(j).Select("state", "succeeded_count", "failed_count", "cancelled_count", "started_at", "finished_at").
+			Updates(j).Error
+	})
+}
+
+type JobList struct {
+	Jobs []Job
+}
+
+func (jl *JobList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := Job{}
+
+	if filter.Pagination != nil {
+		return errors.New("invalid filter: pagination is not supported")
+	}
+
+	if _, err := Query(engine, model, filter, &jl.Jobs); err != nil {
+		return fmt.Errorf("failed to query the jobs by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationJob struct {
+	Jobs       []Job
+	TotalCount int64
+}
+
+func (jl *JobList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationJob PaginationJob, err error) {
+	model := Job{}
+
+	if filter.Pagination == nil {
+		return paginationJob, errors.New("invalid filter: missing pagination")
+	}
+
+	totalCount, err := Query(engine, model, filter, &jl.Jobs)
+	if err != nil {
+		return paginationJob, fmt.Errorf("failed to query jobs by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationJob.Jobs = jl.Jobs
+	paginationJob.TotalCount = totalCount
+
+	return paginationJob, nil
+}
+
+// Fail marks the jobs in the given states and their items which are not finished as failed,
+// e.g. for the jobs interrupted by the restart of the engine.
+func (jl *JobList) Fail(engine *DatabaseEngine, states []string, failedState string, reason string) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		var jobIDs []uint
+		if err := tx.Model(&Job{}).Where("state IN ?", states).Pluck("id", &jobIDs).Error; err != nil {
+			return err
+		}
+
+		if len(jobIDs) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&JobItem{}).Where("job_id IN ? AND state IN ?", jobIDs, states).
+			Updates(map[string]interface{}{"state": failedState, "error": reason}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&Job{}).Where("id IN ?", jobIDs).
+			Updates(map[string]interface{}{
+				"state":        failedState,
+				"failed_count": gorm.Expr("total_count - succeeded_count - cancelled_count"),
+				"finished_at":  time.Now(),
+			}).Error
+	})
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+type LocalGroup struct {
+	gorm.Model
+	HostIP      string `gorm:"uniqueIndex:idx_local_group_unique;column:host_ip"`
+	Name        string `gorm:"uniqueIndex:idx_local_group_unique;column:name"`
+	GID         string `gorm:"column:group_id"`
+	Description string `gorm:"column:description"`
+	// Stale is set by the reconciliation once the group is not found on the host any more.
+	Stale bool `gorm:"column:stale"`
+
+	// Association for the local users which are members of the group
+	Members []LocalGroupMember `gorm:"foreignKey:LocalGroupID"`
+}
+
+type LocalGroupMember struct {
+	gorm.Model
+	LocalGroupID uint   `gorm:"index;column:local_group_id"`
+	UserName     string `gorm:"column:username"`
+}
+
+func (g *LocalGroup) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(g).Preload("Members").First(g).Error
+}
+
+// Save saves the group with its members, the members not in the group any more are removed.
+func (g *LocalGroup) Save(engine *DatabaseEngine) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members").Save(g).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("local_group_id = ?", g.ID).Delete(&LocalGroupMember{}).Error; err != nil {
+			return err
+		}
+
+		for i := range g.Members {
+			g.Members[i].ID = 0
+			g.Members[i].LocalGroupID = g.ID
+		}
+
+		if len(g.Members) == 0 {
+			return nil
+		}
+
+		return tx.Create(&g.Members).Error
+	})
+}
+
+func (g *LocalGroup) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(g).First(g).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("local_group_id = ?", g.ID).Delete(&LocalGroupMember{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(g).Error
+	})
+}
+
+type LocalGroupList struct {
+	LocalGroups []LocalGroup
+}
+
+func (gl *LocalGroupList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := LocalGroup{}
+
+	if filter.Pagination != nil {
+		return fmt.Errorf("invalid filter: pagination is not supported")
+	}
+
+	filter.PreloadModel = "Members"
+	if _, err := Query(engine, model, filter, &gl.LocalGroups); err != nil {
+		return fmt.Errorf("failed to query the local groups by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationLocalGroup struct {
+	LocalGroups []LocalGroup
+	TotalCount  int64
+}
+
+func (gl *LocalGroupList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationLocalGroup PaginationLocalGroup, err error) {
+	model := LocalGroup{}
+
+	if filter.Pagination == nil {
+		return paginationLocalGroup, fmt.Errorf("invalid filter: missing pagination")
+	}
+
+	filter.PreloadModel = "Members"
+	totalCount, err := Query(engine, model, filter, &gl.LocalGroups)
+	if err != nil {
+		return paginationLocalGroup, fmt.Errorf("failed to query local groups by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationLocalGroup.LocalGroups = gl.LocalGroups
+	paginationLocalGroup.TotalCount = totalCount
+
+	return paginationLocalGroup, nil
+}
@@ -22,6 +22,8 @@ type LocalUser struct {
 	IsPasswordChangeable bool   `gorm:"column:is_password_changeable"`
 	IsPasswordRequired   bool   `gorm:"column:is_password_required"`
 	IsLockout            bool   `gorm:"column:is_lockout"`
+	// Stale is set by the reconciliation once the user is not found on the host any more.
+	Stale bool `gorm:"column:stale"`
 }
 
 func (u *LocalUser) Get(engine *DatabaseEngine) (err error) {
@@ -30,7 +32,7 @@ func (u *LocalUser) Get(engine *DatabaseEngine) (err error) {
 		return err
 	}
 
-	u.Password, err = common.Decrypt(u.Password, common.SecurityKey)
+	u.Password, err = common.DecryptSecret(u.Password)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt password: %w", err)
 	}
@@ -39,7 +41,7 @@ func (u *LocalUser) Get(engine *DatabaseEngine) (err error) {
 }
 
 func (u *LocalUser) Save(engine *DatabaseEngine) (err error) {
-	u.Password, err = common.Encrypt(u.Password, common.SecurityKey)
+	u.Password, err = common.EncryptSecret(u.Password)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt password: %w", err)
 	}
@@ -47,6 +49,11 @@ func (u *LocalUser) Save(engine *DatabaseEngine) (err error) {
 	return engine.DB.Save(u).Error
 }
 
+// Update saves the columns of the LocalUser only, so the encrypted password is left untouched unless it is selected.
+func (u *LocalUser) Update(engine *DatabaseEngine, columns ...string) error {
+	return engine.DB.Model(u).Select(columns).Updates(u).Error
+}
+
 func (u *LocalUser) Delete(engine *DatabaseEngine) error {
 	return engine.DB.Unscoped().Where(u).Delete(u).Error
 }
@@ -69,7 +76,7 @@ func (ul *LocalUserList) Get(engine *DatabaseEngine, filter *common.QueryFilter)
 	for i := range ul.LocalUsers {
 		if ul.LocalUsers[i].Password != "" {
 			var err error
-			ul.LocalUsers[i].Password, err = common.Decrypt(ul.LocalUsers[i].Password, common.SecurityKey)
+			ul.LocalUsers[i].Password, err = common.DecryptSecret(ul.LocalUsers[i].Password)
 			if err != nil {
 				return fmt.Errorf("failed to decrypt password: %w", err)
 			}
@@ -98,7 +105,7 @@ func (ul *LocalUserList) Pagination(engine *DatabaseEngine, filter *common.Query
 
 	for i := range ul.LocalUsers {
 		if ul.LocalUsers[i].Password != "" {
-			ul.LocalUsers[i].Password, err = common.Decrypt(ul.LocalUsers[i].Password, common.SecurityKey)
+			ul.LocalUsers[i].Password, err = common.DecryptSecret(ul.LocalUsers[i].Password)
 			if err != nil {
 				return paginationLocalUser, fmt.Errorf("failed to decrypt password: %w", err)
 			}
@@ -118,7 +125,7 @@ func (ul *LocalUserList) Save(engine *DatabaseEngine) (err error) {
 
 	for i := range ul.LocalUsers {
 		// Encrypt the password
-		ul.LocalUsers[i].Password, err = common.Encrypt(ul.LocalUsers[i].Password, common.SecurityKey)
+		ul.LocalUsers[i].Password, err = common.EncryptSecret(ul.LocalUsers[i].Password)
 		if err != nil {
 			return fmt.Errorf("failed to encrypt password for user %v: %w", ul.LocalUsers[i].Name, err)
 		}
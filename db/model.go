@@ -81,6 +81,11 @@ func Query(engine *DatabaseEngine, model interface{}, filter *common.QueryFilter
 		db = db.Select("*")
 	}
 
+	// 预加载关联的模型，查询的属性中需要包含关联的主键
+	if filter.PreloadModel != "" {
+		db = db.Preload(filter.PreloadModel)
+	}
+
 	if filter.Pagination != nil {
 		page := filter.Pagination.Page
 		pageSize := filter.Pagination.PageSize
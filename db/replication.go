@@ -0,0 +1,94 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// Replication keeps the destination directory the same as the source directory on another host, a directory is the
+// destination of one replication at most.
+type Replication struct {
+	gorm.Model
+	SourceHostIP             string `gorm:"index:idx_replication_source;column:source_host_ip"`
+	SourceDirectoryName      string `gorm:"index:idx_replication_source;column:source_directory_name"`
+	DestinationHostIP        string `gorm:"uniqueIndex:idx_replication_unique;column:destination_host_ip"`
+	DestinationDirectoryName string `gorm:"uniqueIndex:idx_replication_unique;column:destination_directory_name"`
+	// The frequency of the transfers, the directory is transferred on request only if it is empty.
+	Frequency string `gorm:"column:frequency"`
+
+	// The start time of the last transfer, and of the last successful one, since which the destination lags behind.
+	LastRunTime     *time.Time `gorm:"column:last_run_time"`
+	LastSuccessTime *time.Time `gorm:"column:last_success_time"`
+	LastResult      string     `gorm:"column:last_result"`
+	LastError       string     `gorm:"column:last_error"`
+	// The milliseconds which the last transfer took.
+	LastDuration     int64 `gorm:"column:last_duration"`
+	FilesTransferred int64 `gorm:"column:files_transferred"`
+	BytesTransferred int64 `gorm:"column:bytes_transferred"`
+	FilesResumed     int64 `gorm:"column:files_resumed"`
+	FilesUnchanged   int64 `gorm:"column:files_unchanged"`
+	FilesDeleted     int64 `gorm:"column:files_deleted"`
+}
+
+func (r *Replication) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(r).First(r).Error
+}
+
+func (r *Replication) Save(engine *DatabaseEngine) error {
+	return engine.DB.Save(r).Error
+}
+
+// Update saves the columns of the replication only, e.g. the result of a transfer without the frequency changed
+// during the transfer.
+func (r *Replication) Update(engine *DatabaseEngine, columns ...string) error {
+	return engine.DB.Model(r).Select(columns).Updates(r).Error
+}
+
+// Delete deletes the replications matching the fields set.
+func (r *Replication) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Unscoped().Where(r).Delete(&Replication{}).Error
+}
+
+type ReplicationList struct {
+	Replications []Replication
+}
+
+func (rl *ReplicationList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := Replication{}
+
+	if filter.Pagination != nil {
+		return fmt.Errorf("invalid filter: pagination is not supported")
+	}
+
+	if _, err := Query(engine, model, filter, &rl.Replications); err != nil {
+		return fmt.Errorf("failed to query the replications by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationReplication struct {
+	Replications []Replication
+	TotalCount   int64
+}
+
+func (rl *ReplicationList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationReplication PaginationReplication, err error) {
+	model := Replication{}
+
+	if filter.Pagination == nil {
+		return paginationReplication, fmt.Errorf("invalid filter: missing pagination")
+	}
+
+	totalCount, err := Query(engine, model, filter, &rl.Replications)
+	if err != nil {
+		return paginationReplication, fmt.Errorf("failed to query replications by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationReplication.Replications = rl.Replications
+	paginationReplication.TotalCount = totalCount
+
+	return paginationReplication, nil
+}
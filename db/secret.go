@@ -0,0 +1,70 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// ReencryptPasswords re-encrypts the passwords of the hosts and the local users which are not encrypted by the current
+// key, and returns the number of the re-encrypted passwords. It runs in a transaction, so either all of the passwords
+// are re-encrypted or none of them.
+func ReencryptPasswords(engine *DatabaseEngine) (count int, err error) {
+	err = engine.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&Host{}, &LocalUser{}} {
+			n, err := reencryptPasswordColumn(tx, model)
+			if err != nil {
+				return err
+			}
+			count += n
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func reencryptPasswordColumn(tx *gorm.DB, model interface{}) (int, error) {
+	var rows []struct {
+		ID       uint
+		Password string
+	}
+
+	// The deleted rows are re-encrypted as well, so that no password depends on the old keys.
+	if err := tx.Unscoped().Model(model).Select("id", "password").Where("password <> ''").Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, row := range rows {
+		current, err := common.IsEncryptedByCurrentKey(row.Password)
+		if err != nil {
+			return 0, err
+		}
+		if current {
+			continue
+		}
+
+		plaintext, err := common.DecryptSecret(row.Password)
+		if err != nil {
+			return 0, fmt.Errorf("failed to decrypt the password of %T %d: %w", model, row.ID, err)
+		}
+
+		secret, err := common.EncryptSecret(plaintext)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := tx.Unscoped().Model(model).Where("id = ?", row.ID).UpdateColumn("password", secret).Error; err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	return count, nil
+}
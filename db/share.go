@@ -9,25 +9,112 @@ import (
 
 type CIFSShare struct {
 	gorm.Model
-	Name            string `gorm:"column:name"`
-	HostIP          string `gorm:"column:host_ip"`
-	Path            string `gorm:"uniqueIndex:idx_cifs_share_unique;column:path"`
-	DirectoryName   string `gorm:"column:directory_name"`
-	MountPoint      string `gorm:"column:mount_point"`
-	Description     string `gorm:"column:description"`
-	AccessUserNames string `gorm:"column:access_usernames"`
+	Name          string `gorm:"column:name"`
+	HostIP        string `gorm:"column:host_ip"`
+	Path          string `gorm:"uniqueIndex:idx_cifs_share_unique;column:path"`
+	DirectoryName string `gorm:"column:directory_name"`
+	MountPoint    string `gorm:"column:mount_point"`
+	Description   string `gorm:"column:description"`
+	// Stale is set by the reconciliation once the share is not found on the host any more.
+	Stale bool `gorm:"column:stale"`
+
+	// Association for the access levels of the users to the share
+	Access []CIFSShareAccess `gorm:"foreignKey:CIFSShareID"`
+}
+
+type CIFSShareAccess struct {
+	gorm.Model
+	CIFSShareID uint   `gorm:"index;column:cifs_share_id"`
+	UserName    string `gorm:"column:username"`
+	GroupName   string `gorm:"column:groupname"`
+	Permission  string `gorm:"column:permission"`
 }
 
 func (c *CIFSShare) Get(engine *DatabaseEngine) error {
-	return engine.DB.Where(c).First(c).Error
+	return engine.DB.Where(c).Preload("Access").First(c).Error
 }
 
+// Save saves the share with its access levels, the levels not in the share any more are removed.
 func (c *CIFSShare) Save(engine *DatabaseEngine) error {
-	return engine.DB.Save(c).Error
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Access").Save(c).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("cifs_share_id = ?", c.ID).Delete(&CIFSShareAccess{}).Error; err != nil {
+			return err
+		}
+
+		for i := range c.Access {
+			c.Access[i].ID = 0
+			c.Access[i].CIFSShareID = c.ID
+		}
+
+		if len(c.Access) == 0 {
+			return nil
+		}
+
+		return tx.Create(&c.Access).Error
+	})
+}
+
+// Update saves the columns of the CIFSShare only.
+func (c *CIFSShare) Update(engine *DatabaseEngine, columns ...string) error {
+	return engine.DB.Model(c).Select(columns).Updates(c).Error
 }
 
 func (c *CIFSShare) Delete(engine *DatabaseEngine) error {
-	return engine.DB.Unscoped().Where(c).Delete(c).Error
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		var shares []CIFSShare
+		if err := tx.Where(c).Find(&shares).Error; err != nil {
+			return err
+		}
+
+		for _, share := range shares {
+			if err := tx.Unscoped().Where("cifs_share_id = ?", share.ID).Delete(&CIFSShareAccess{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Where(c).Delete(c).Error
+	})
+}
+
+// migrateCIFSShareAccess moves the users in the column access_usernames of the older versions, which were given the
+// full access, to the access levels of the shares, and drops the column.
+func migrateCIFSShareAccess(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&CIFSShare{}, "access_usernames") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&CIFSShareAccess{}); err != nil {
+			return err
+		}
+
+		var shares []struct {
+			ID              uint
+			AccessUserNames string `gorm:"column:access_usernames"`
+		}
+		if err := tx.Model(&CIFSShare{}).Unscoped().Select("id", "access_usernames").Find(&shares).Error; err != nil {
+			return err
+		}
+
+		var access []CIFSShareAccess
+		for _, share := range shares {
+			for _, userName := range common.SplitToList(share.AccessUserNames) {
+				access = append(access, CIFSShareAccess{CIFSShareID: share.ID, UserName: userName, Permission: common.SharePermissionFull})
+			}
+		}
+
+		if len(access) > 0 {
+			if err := tx.Create(&access).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().DropColumn(&CIFSShare{}, "access_usernames")
+	})
 }
 
 type CIFSShareList struct {
@@ -41,6 +128,7 @@ func (cl *CIFSShareList) Get(engine *DatabaseEngine, filter *common.QueryFilter)
 		return fmt.Errorf("invalid filter: pagination is not supported")
 	}
 
+	filter.PreloadModel = "Access"
 	if _, err := Query(engine, model, filter, &cl.Shares); err != nil {
 		return fmt.Errorf("failed to query the shares by the filter %v in database: %w", filter, err)
 	}
@@ -61,6 +149,7 @@ func (cl *CIFSShareList) Pagination(engine *DatabaseEngine, filter *common.Query
 		return paginationShare, fmt.Errorf("invalid filter: missing pagination")
 	}
 
+	filter.PreloadModel = "Access"
 	var totalCount int64
 	totalCount, err = Query(engine, model, filter, &cl.Shares)
 	if err != nil {
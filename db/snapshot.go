@@ -0,0 +1,77 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// Snapshot is a point-in-time copy of a managed directory, which is kept on the host of the directory.
+type Snapshot struct {
+	gorm.Model
+	// The directory which the snapshot is taken of.
+	DirectoryID   uint      `gorm:"index;column:directory_id"`
+	HostIP        string    `gorm:"uniqueIndex:idx_snapshot_unique;column:host_ip"`
+	DirectoryName string    `gorm:"uniqueIndex:idx_snapshot_unique;column:directory_name"`
+	Name          string    `gorm:"uniqueIndex:idx_snapshot_unique;column:name"`
+	Method        string    `gorm:"column:method"`
+	CreationTime  time.Time `gorm:"column:creation_time"`
+	// The snapshot policy which took the snapshot, it is empty for the snapshots taken on request.
+	PolicyName string `gorm:"index;column:policy_name"`
+}
+
+func (s *Snapshot) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(s).First(s).Error
+}
+
+func (s *Snapshot) Save(engine *DatabaseEngine) error {
+	return engine.DB.Save(s).Error
+}
+
+// Delete deletes the snapshots matching the fields set, e.g. all the snapshots of a directory if no name is set.
+func (s *Snapshot) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Unscoped().Where(s).Delete(&Snapshot{}).Error
+}
+
+type SnapshotList struct {
+	Snapshots []Snapshot
+}
+
+func (sl *SnapshotList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := Snapshot{}
+
+	if filter.Pagination != nil {
+		return fmt.Errorf("invalid filter: pagination is not supported")
+	}
+
+	if _, err := Query(engine, model, filter, &sl.Snapshots); err != nil {
+		return fmt.Errorf("failed to query the snapshots by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationSnapshot struct {
+	Snapshots  []Snapshot
+	TotalCount int64
+}
+
+func (sl *SnapshotList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationSnapshot PaginationSnapshot, err error) {
+	model := Snapshot{}
+
+	if filter.Pagination == nil {
+		return paginationSnapshot, fmt.Errorf("invalid filter: missing pagination")
+	}
+
+	totalCount, err := Query(engine, model, filter, &sl.Snapshots)
+	if err != nil {
+		return paginationSnapshot, fmt.Errorf("failed to query snapshots by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationSnapshot.Snapshots = sl.Snapshots
+	paginationSnapshot.TotalCount = totalCount
+
+	return paginationSnapshot, nil
+}
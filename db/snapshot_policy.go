@@ -0,0 +1,111 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"gorm.io/gorm"
+)
+
+// SnapshotPolicy takes the snapshots of the directories attached to it at the frequency, and keeps the latest ones.
+type SnapshotPolicy struct {
+	gorm.Model
+	Name      string `gorm:"uniqueIndex;column:name"`
+	Frequency string `gorm:"column:frequency"`
+	Keep      int    `gorm:"column:keep"`
+
+	// Association for the directories which the policy is attached to
+	Directories []SnapshotPolicyDirectory `gorm:"foreignKey:SnapshotPolicyID"`
+}
+
+type SnapshotPolicyDirectory struct {
+	gorm.Model
+	SnapshotPolicyID uint   `gorm:"uniqueIndex:idx_snapshot_policy_directory_unique;column:snapshot_policy_id"`
+	DirectoryID      uint   `gorm:"index;column:directory_id"`
+	HostIP           string `gorm:"uniqueIndex:idx_snapshot_policy_directory_unique;column:host_ip"`
+	DirectoryName    string `gorm:"uniqueIndex:idx_snapshot_policy_directory_unique;column:directory_name"`
+	// LastRunTime is the time when the policy took the last snapshot of the directory, it is nil until the first one.
+	LastRunTime *time.Time `gorm:"column:last_run_time"`
+}
+
+func (p *SnapshotPolicy) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(p).Preload("Directories").First(p).Error
+}
+
+// Save saves the policy only, the directories are attached and detached by SnapshotPolicyDirectory.
+func (p *SnapshotPolicy) Save(engine *DatabaseEngine) error {
+	return engine.DB.Omit("Directories").Save(p).Error
+}
+
+// Delete deletes the policy and detaches it from the directories.
+func (p *SnapshotPolicy) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(p).First(p).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("snapshot_policy_id = ?", p.ID).Delete(&SnapshotPolicyDirectory{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(p).Error
+	})
+}
+
+func (d *SnapshotPolicyDirectory) Get(engine *DatabaseEngine) error {
+	return engine.DB.Where(d).First(d).Error
+}
+
+func (d *SnapshotPolicyDirectory) Save(engine *DatabaseEngine) error {
+	return engine.DB.Save(d).Error
+}
+
+// Delete deletes the attachments matching the fields set, e.g. detaches all the policies from a directory if no
+// policy is set.
+func (d *SnapshotPolicyDirectory) Delete(engine *DatabaseEngine) error {
+	return engine.DB.Unscoped().Where(d).Delete(&SnapshotPolicyDirectory{}).Error
+}
+
+type SnapshotPolicyList struct {
+	SnapshotPolicies []SnapshotPolicy
+}
+
+func (pl *SnapshotPolicyList) Get(engine *DatabaseEngine, filter *common.QueryFilter) error {
+	model := SnapshotPolicy{}
+
+	if filter.Pagination != nil {
+		return fmt.Errorf("invalid filter: pagination is not supported")
+	}
+
+	filter.PreloadModel = "Directories"
+	if _, err := Query(engine, model, filter, &pl.SnapshotPolicies); err != nil {
+		return fmt.Errorf("failed to query the snapshot policies by the filter %v in database: %w", filter, err)
+	}
+
+	return nil
+}
+
+type PaginationSnapshotPolicy struct {
+	SnapshotPolicies []SnapshotPolicy
+	TotalCount       int64
+}
+
+func (pl *SnapshotPolicyList) Pagination(engine *DatabaseEngine, filter *common.QueryFilter) (paginationSnapshotPolicy PaginationSnapshotPolicy, err error) {
+	model := SnapshotPolicy{}
+
+	if filter.Pagination == nil {
+		return paginationSnapshotPolicy, fmt.Errorf("invalid filter: missing pagination")
+	}
+
+	filter.PreloadModel = "Directories"
+	totalCount, err := Query(engine, model, filter, &pl.SnapshotPolicies)
+	if err != nil {
+		return paginationSnapshotPolicy, fmt.Errorf("failed to query snapshot policies by the filter %v in the database: %w", filter, err)
+	}
+
+	paginationSnapshotPolicy.SnapshotPolicies = pl.SnapshotPolicies
+	paginationSnapshotPolicy.TotalCount = totalCount
+
+	return paginationSnapshotPolicy, nil
+}
@@ -1,25 +1,246 @@
 package driver
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/client"
 	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/pki"
 )
 
+// The time limit of the walk for the directory usage, which takes much longer than the other calls of the agent.
+const agentUsageTimeout = 10 * time.Minute
+
+// The time limit of taking and restoring the snapshots, the directories are copied if the file system cannot share blocks.
+const agentSnapshotTimeout = 30 * time.Minute
+
+// The time limit of a transfer of the replication, the transfer cut by the limit is resumed by the next one.
+const agentReplicationTimeout = 24 * time.Hour
+
+const (
+	// The ports of the agent's web service over plain HTTP and mutual TLS if the host does not specify one.
+	defaultAgentPort    = 8080
+	defaultAgentTLSPort = 8443
+)
+
+func init() {
+	Register("workstation", NewAgentDriver)
+}
+
+// AgentDriver manages the workstation by the REST API of the agent running on it.
 type AgentDriver struct {
+	config     HostConfig
+	restClient *client.RestClient
 }
 
-func (d *AgentDriver) CreateDirectory(ctx context.Context, name string) (directoryDetails common.DirectoryDetail, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
+func NewAgentDriver(config HostConfig) (Driver, error) {
+	hostContext := common.HostContext{IP: config.IP, Username: config.Username, Password: config.Password}
+
+	// The agent is connected by plain HTTP until it is enrolled at the registration.
+	switch config.Scheme {
+	case "", "http":
+		port := config.Port
+		if port == 0 {
+			port = defaultAgentPort
+		}
+
+		return &AgentDriver{
+			config:     config,
+			restClient: client.GetRestClient("http", hostContext, port, "agent", common.AgentTokenHeader, "", true),
+		}, nil
+	case "https":
+		if config.CertFingerprint == "" {
+			return nil, errors.New("the agent over mutual TLS requires the fingerprint of its certificate")
+		}
+
+		port := config.Port
+		if port == 0 {
+			port = defaultAgentTLSPort
+		}
+
+		tlsConfig, err := pki.ClientTLSConfig(config.CertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+
+		restClient := client.GetRestClient("https", hostContext, port, "agent", common.AgentTokenHeader, "", true)
+		restClient.SetTLSConfig(tlsConfig)
+
+		return &AgentDriver{config: config, restClient: restClient}, nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme of the agent: %s", config.Scheme)
+	}
+}
+
+// Enroll issues the certificate of the agent by the CA of the engine, the agent is served over mutual TLS since then.
+// The agent which already has a certificate signed by the CA, e.g. it was registered before, keeps its certificate.
+func (d *AgentDriver) Enroll(ctx context.Context) (*Enrollment, error) {
+	ca, err := pki.GetCA()
+	if err != nil {
+		return nil, err
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	response, err := restClient.Get("certificates/request")
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return nil, fmt.Errorf("failed to get the certificate signing request of the agent: %s", result.Error)
+	}
+
+	var certificateRequest struct {
+		CSR      string `json:"csr"`
+		Enrolled bool   `json:"enrolled"`
+		TLSPort  int    `json:"tls_port"`
+	}
+	if err := restClient.GetResponseBody(response, &certificateRequest); err != nil {
+		return nil, err
+	}
+
+	enrollment := &Enrollment{Scheme: "https", Port: certificateRequest.TLSPort}
+	if enrollment.Port == 0 {
+		enrollment.Port = defaultAgentTLSPort
+	}
+
+	if certificateRequest.Enrolled {
+		if enrollment.CertFingerprint, err = d.getCertificateFingerprint(ctx, enrollment.Port); err != nil {
+			return nil, fmt.Errorf("the agent already has a certificate which is not issued by the engine: %w", err)
+		}
+
+		return enrollment, nil
+	}
+
+	certPEM, fingerprint, err := ca.SignAgentCertificate([]byte(certificateRequest.CSR), d.config.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(struct {
+		Certificate   string `json:"certificate"`
+		CACertificate string `json:"ca_certificate"`
+	}{
+		Certificate:   string(certPEM),
+		CACertificate: string(ca.CertificatePEM()),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err = restClient.Post("certificates/install", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return nil, fmt.Errorf("failed to install the certificate on the agent: %s", result.Error)
+	}
+	response.Body.Close()
+
+	enrollment.CertFingerprint = fingerprint
+
+	return enrollment, nil
+}
+
+// SendHeartbeatToken sends the heartbeat token to the enrolled agent over mutual TLS only, so that the token is
+// given to the agent which owns the certificate of the host, not to whoever calls home with its IP address.
+func (d *AgentDriver) SendHeartbeatToken(ctx context.Context, token string, interval time.Duration) error {
+	if d.config.Scheme != "https" {
+		return errors.New("the heartbeat token is sent to the agent over mutual TLS only, the agent is not enrolled")
+	}
+
+	body, err := json.Marshal(struct {
+		Token             string `json:"token"`
+		HeartbeatInterval int    `json:"heartbeat_interval"`
+	}{
+		Token:             token,
+		HeartbeatInterval: int(interval.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	response, err := restClient.Post("heartbeat/token", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to send the heartbeat token to the agent: %s", result.Error)
+	}
+	response.Body.Close()
+
+	return nil
+}
+
+// getCertificateFingerprint returns the fingerprint of the certificate which the agent serves over mutual TLS,
+// it fails if the agent has no certificate signed by the CA of the engine.
+func (d *AgentDriver) getCertificateFingerprint(ctx context.Context, port int) (string, error) {
+	tlsConfig, err := pki.ClientTLSConfig("")
+	if err != nil {
+		return "", err
+	}
+
+	dialer := tls.Dialer{NetDialer: &net.Dialer{Timeout: 5 * time.Second}, Config: tlsConfig}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(d.config.IP, strconv.Itoa(port)))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	certificates := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return "", errors.New("no certificate is served by the agent")
+	}
 
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+	return pki.Fingerprint(certificates[0].Raw), nil
+}
+
+func (d *AgentDriver) getRestClient(ctx context.Context) *client.RestClient {
+	return d.restClient.WithContext(ctx)
+}
+
+// requireMutualTLS rejects sending the passwords to the agent which is not enrolled yet. The passwords are sent in
+// plaintext, they are protected by the mutual TLS channel only, so the keys of the database never leave the engine.
+func (d *AgentDriver) requireMutualTLS() error {
+	if d.config.Scheme != "https" {
+		return errors.New("the passwords are sent to the agent over mutual TLS only, the agent is not enrolled")
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) Capabilities() []Capability {
+	return []Capability{CapabilityDirectory, CapabilityCIFS, CapabilityNFS, CapabilityLocalUser, CapabilityMount, CapabilityQuota, CapabilityUsage, CapabilityACL, CapabilityShareAccess, CapabilityUnlockUser, CapabilityLocalGroup, CapabilitySnapshot, CapabilityReplication}
+}
+
+func (d *AgentDriver) CreateDirectory(ctx context.Context, name string) (directoryDetails common.DirectoryDetail, err error) {
+	restClient := d.getRestClient(ctx)
 
 	// Create the request body as a string
 	request_body := fmt.Sprintf(`{"name": "%s"}`, name)
@@ -44,10 +265,7 @@ func (d *AgentDriver) CreateDirectory(ctx context.Context, name string) (directo
 }
 
 func (d *AgentDriver) DeleteDirectory(ctx context.Context, name string) (err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+	restClient := d.getRestClient(ctx)
 
 	// Create the request body as a string
 	body := fmt.Sprintf(`{"name": "%s"}`, name)
@@ -68,11 +286,43 @@ func (d *AgentDriver) DeleteDirectory(ctx context.Context, name string) (err err
 	return nil
 }
 
-func (d *AgentDriver) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
+func (d *AgentDriver) UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name string `json:"name"`
+		common.DirectoryUpdate
+	}{
+		Name:            name,
+		DirectoryUpdate: update,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("directories/update", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to update the directory: %s", result.Error)
+	}
+
+	return nil
+}
 
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+func (d *AgentDriver) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
+	restClient := d.getRestClient(ctx)
 
 	url := fmt.Sprintf("directories/detail?name=%s", name)
 
@@ -97,10 +347,7 @@ func (d *AgentDriver) GetDirectoryDetail(ctx context.Context, name string) (deta
 }
 
 func (d *AgentDriver) GetDirectoriesDetail(ctx context.Context, names []string) (detail []common.DirectoryDetail, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+	restClient := d.getRestClient(ctx)
 
 	url := fmt.Sprintf("directories/detail?name=%s", strings.Join(names, ","))
 
@@ -120,22 +367,19 @@ func (d *AgentDriver) GetDirectoriesDetail(ctx context.Context, names []string)
 	return detail, err
 }
 
-func (d *AgentDriver) CreateCIFSShare(ctx context.Context, name, directory_name, description string, usernames []string) (err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+func (d *AgentDriver) CreateCIFSShare(ctx context.Context, name, directory_name, description string, access []common.ShareAccess) (err error) {
+	restClient := d.getRestClient(ctx)
 
 	body := struct {
-		ShareName     string   `json:"share_name"`
-		DirectoryName string   `json:"directory_name"`
-		Description   string   `json:"description"`
-		Usernames     []string `json:"usernames"`
+		ShareName     string               `json:"share_name"`
+		DirectoryName string               `json:"directory_name"`
+		Description   string               `json:"description"`
+		Access        []common.ShareAccess `json:"access"`
 	}{
 		ShareName:     name,
 		DirectoryName: directory_name,
 		Description:   description,
-		Usernames:     usernames,
+		Access:        access,
 	}
 	request_body, err := json.Marshal(body)
 	if err != nil {
@@ -160,10 +404,7 @@ func (d *AgentDriver) CreateCIFSShare(ctx context.Context, name, directory_name,
 }
 
 func (d *AgentDriver) DeleteCIFSShare(ctx context.Context, name string) (err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+	restClient := d.getRestClient(ctx)
 
 	body := struct {
 		ShareName string `json:"share_name"`
@@ -192,24 +433,15 @@ func (d *AgentDriver) DeleteCIFSShare(ctx context.Context, name string) (err err
 	return nil
 }
 
-func (d *AgentDriver) MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
-
-	encryptedPassword, _ := common.Encrypt(password, common.SecurityKey)
+func (d *AgentDriver) UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error) {
+	restClient := d.getRestClient(ctx)
 
 	body := struct {
-		MountPoint string `json:"mount_point"`
-		SharePath  string `json:"share_path"`
-		UserName   string `json:"username"`
-		Password   string `json:"password"`
+		ShareName string `json:"share_name"`
+		common.ShareUpdate
 	}{
-		MountPoint: mountPoint,
-		SharePath:  sharePath,
-		UserName:   userName,
-		Password:   encryptedPassword,
+		ShareName:   name,
+		ShareUpdate: update,
 	}
 	request_body, err := json.Marshal(body)
 	if err != nil {
@@ -219,7 +451,7 @@ func (d *AgentDriver) MountCIFSShare(ctx context.Context, mountPoint, sharePath,
 	// Convert the string to an io.Reader
 	reader := strings.NewReader(string(request_body))
 
-	response, err := restClient.Post("shares/mount", reader)
+	response, err := restClient.Post("shares/update", reader)
 	if err != nil {
 		return err
 	}
@@ -227,22 +459,24 @@ func (d *AgentDriver) MountCIFSShare(ctx context.Context, mountPoint, sharePath,
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to mount a cifs share")
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to update the cifs share: %s", result.Error)
 	}
 
 	return nil
 }
 
-func (d *AgentDriver) UnmountCIFSShare(ctx context.Context, mountPoint string) (err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+func (d *AgentDriver) GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error) {
+	restClient := d.getRestClient(ctx)
 
 	body := struct {
-		MountPoint string `json:"mount_point"`
+		ShareName string               `json:"share_name"`
+		Access    []common.ShareAccess `json:"access"`
 	}{
-		MountPoint: mountPoint,
+		ShareName: name,
+		Access:    access,
 	}
 	request_body, err := json.Marshal(body)
 	if err != nil {
@@ -252,7 +486,7 @@ func (d *AgentDriver) UnmountCIFSShare(ctx context.Context, mountPoint string) (
 	// Convert the string to an io.Reader
 	reader := strings.NewReader(string(request_body))
 
-	response, err := restClient.Post("shares/unmount", reader)
+	response, err := restClient.Post("shares/access/grant", reader)
 	if err != nil {
 		return err
 	}
@@ -260,89 +494,66 @@ func (d *AgentDriver) UnmountCIFSShare(ctx context.Context, mountPoint string) (
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to unmount a cifs share")
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to grant the access to the share: %s", result.Error)
 	}
 
 	return nil
 }
 
-func (d *AgentDriver) CreateLocalUser(ctx context.Context, name, password string) (localUserDetail common.LocalUserDetail, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+func (d *AgentDriver) RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error) {
+	restClient := d.getRestClient(ctx)
 
-	// Create the request body as a string
-	request_body := fmt.Sprintf(`{"name": "%s", "password": "%s"}`, name, password)
+	body := struct {
+		ShareName  string   `json:"share_name"`
+		UserNames  []string `json:"usernames"`
+		GroupNames []string `json:"groupnames"`
+	}{
+		ShareName:  name,
+		UserNames:  userNames,
+		GroupNames: groupNames,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
 
 	// Convert the string to an io.Reader
-	reader := strings.NewReader(request_body)
+	reader := strings.NewReader(string(request_body))
 
-	response, err := restClient.Post("users/create", reader)
+	response, err := restClient.Post("shares/access/revoke", reader)
 	if err != nil {
-		localUserDetail.Name = name
-		return localUserDetail, err
+		return err
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		localUserDetail.Name = name
-		return localUserDetail, fmt.Errorf("Failed")
-	}
-
-	restClient.GetResponseBody(response, &localUserDetail)
-
-	return localUserDetail, err
-}
-
-func (d *AgentDriver) DeleteLocalUser(ctx context.Context, name string) (err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
-
-	// Create the request body as a string
-	body := fmt.Sprintf(`{"name": "%s"}`, name)
-
-	// Convert the string to an io.Reader
-	reader := strings.NewReader(body)
-
-	response, err := restClient.Post("users/delete", reader)
-	if err != nil {
-		return err
-	} else if response.StatusCode != http.StatusOK {
 		var result common.FailedRESTResponse
 		restClient.GetResponseBody(response, &result)
 
-		return fmt.Errorf(result.Error)
+		return fmt.Errorf("failed to revoke the access to the share: %s", result.Error)
 	}
 
 	return nil
 }
 
-func (d *AgentDriver) GetLocalUserDetail(ctx context.Context, name string) (detail common.LocalUserDetail, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
-
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+func (d *AgentDriver) GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error) {
+	restClient := d.getRestClient(ctx)
 
-	escapedName := url.QueryEscape(name)
-	escapedName = strings.ReplaceAll(escapedName, "+", "%20")
-
-	url := fmt.Sprintf("users/detail?name=%s", escapedName)
+	url := fmt.Sprintf("shares/detail?name=%s", strings.Join(names, ","))
 
 	response, err := restClient.Get(url)
 	if err != nil {
-		detail.Name = name
 		return detail, err
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		detail.Name = name
-		return detail, fmt.Errorf("Failed")
+		return detail, fmt.Errorf("failed to get the details of the cifs shares")
 	}
 
 	restClient.GetResponseBody(response, &detail)
@@ -350,46 +561,842 @@ func (d *AgentDriver) GetLocalUserDetail(ctx context.Context, name string) (deta
 	return detail, err
 }
 
-func (d *AgentDriver) GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
+func (d *AgentDriver) MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error) {
+	if err = d.requireMutualTLS(); err != nil {
+		return err
+	}
 
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+	restClient := d.getRestClient(ctx)
 
-	escapedNames := make([]string, 0, len(names))
-	for _, name := range names {
-		escapedName := url.QueryEscape(name)
-		escapedName = strings.ReplaceAll(escapedName, "+", "%20")
-		escapedNames = append(escapedNames, escapedName)
+	body := struct {
+		MountPoint string `json:"mount_point"`
+		SharePath  string `json:"share_path"`
+		UserName   string `json:"username"`
+		Password   string `json:"password"`
+	}{
+		MountPoint: mountPoint,
+		SharePath:  sharePath,
+		UserName:   userName,
+		Password:   password,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
 	}
 
-	url := fmt.Sprintf("users/detail?name=%s", strings.Join(escapedNames, ","))
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
 
-	response, err := restClient.Get(url)
+	response, err := restClient.Post("shares/mount", reader)
 	if err != nil {
-		return detail, err
+		return err
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		return detail, fmt.Errorf("Failed")
+		return fmt.Errorf("failed to mount a cifs share")
 	}
 
-	restClient.GetResponseBody(response, &detail)
-
-	return detail, err
+	return nil
 }
 
-func (d *AgentDriver) GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error) {
-	hostContext := ctx.Value(common.HostContextkey("hostContext")).(common.HostContext)
-	traceID := ctx.Value(common.TraceIDKey("TraceID")).(string)
+func (d *AgentDriver) UnmountCIFSShare(ctx context.Context, mountPoint string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		MountPoint string `json:"mount_point"`
+	}{
+		MountPoint: mountPoint,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
 
-	restClient := client.GetRestClient("http", hostContext, 8080, "agent", "", traceID, false)
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
 
-	response, err := restClient.Get("system-info")
+	response, err := restClient.Post("shares/unmount", reader)
 	if err != nil {
-		return systemInfo, err
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to unmount a cifs share")
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		DirectoryName string             `json:"directory_name"`
+		Clients       []common.NFSClient `json:"clients"`
+	}{
+		DirectoryName: directoryName,
+		Clients:       clients,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("exports/create", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to create the nfs export: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) DeleteNFSExport(ctx context.Context, directoryName string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		DirectoryName string `json:"directory_name"`
+	}{
+		DirectoryName: directoryName,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("exports/delete", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to delete the nfs export: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error) {
+	exports, err := d.GetNFSExportsDetail(ctx, []string{directoryName})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(exports) == 0 {
+		return detail, fmt.Errorf("the directory %s is not exported", directoryName)
+	}
+
+	return exports[0], nil
+}
+
+// GetNFSExportsDetail returns the exports of the directories, or all the exports on the host if no name is given.
+func (d *AgentDriver) GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	escapedNames := make([]string, 0, len(directoryNames))
+	for _, name := range directoryNames {
+		escapedNames = append(escapedNames, url.QueryEscape(name))
+	}
+
+	url := fmt.Sprintf("exports/detail?name=%s", strings.Join(escapedNames, ","))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return detail, fmt.Errorf("failed to get the nfs exports")
+	}
+
+	err = restClient.GetResponseBody(response, &detail)
+
+	return detail, err
+}
+
+// GetDirectoryUsage lets the agent walk the directory, the walk is stopped on the agent once the context is done.
+func (d *AgentDriver) GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error) {
+	restClient := d.getRestClient(ctx).WithTimeout(agentUsageTimeout)
+
+	url := fmt.Sprintf("directories/usage?name=%s", url.QueryEscape(name))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return usage, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return usage, fmt.Errorf("failed to get the usage of the directory: %s", result.Error)
+	}
+
+	err = restClient.GetResponseBody(response, &usage)
+
+	return usage, err
+}
+
+func (d *AgentDriver) SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name string `json:"name"`
+		common.DirectoryQuota
+	}{
+		Name:           name,
+		DirectoryQuota: quota,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("directories/quota/set", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to set the quota of the directory: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) ClearDirectoryQuota(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name string `json:"name"`
+	}{
+		Name: name,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("directories/quota/clear", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to clear the quota of the directory: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error) {
+	restClient := d.getRestClient(ctx)
+
+	url := fmt.Sprintf("directories/quota/detail?name=%s", url.QueryEscape(name))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return quota, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return quota, fmt.Errorf("failed to get the quota of the directory: %s", result.Error)
+	}
+
+	err = restClient.GetResponseBody(response, &quota)
+
+	return quota, err
+}
+
+func (d *AgentDriver) GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error) {
+	restClient := d.getRestClient(ctx)
+
+	url := fmt.Sprintf("directories/acl?name=%s", url.QueryEscape(name))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return acl, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return acl, fmt.Errorf("failed to get the ACL of the directory: %s", result.Error)
+	}
+
+	err = restClient.GetResponseBody(response, &acl)
+
+	return acl, err
+}
+
+func (d *AgentDriver) SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name string `json:"name"`
+		common.DirectoryACL
+	}{
+		Name:         name,
+		DirectoryACL: acl,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("directories/acl/set", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to set the ACL of the directory: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) CreateLocalUser(ctx context.Context, name, password string) (localUserDetail common.LocalUserDetail, err error) {
+	if err = d.requireMutualTLS(); err != nil {
+		localUserDetail.Name = name
+		return localUserDetail, err
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	// Create the request body as a string
+	request_body := fmt.Sprintf(`{"name": "%s", "password": "%s"}`, name, password)
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(request_body)
+
+	response, err := restClient.Post("users/create", reader)
+	if err != nil {
+		localUserDetail.Name = name
+		return localUserDetail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		localUserDetail.Name = name
+		return localUserDetail, fmt.Errorf("Failed")
+	}
+
+	restClient.GetResponseBody(response, &localUserDetail)
+
+	return localUserDetail, err
+}
+
+func (d *AgentDriver) DeleteLocalUser(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	// Create the request body as a string
+	body := fmt.Sprintf(`{"name": "%s"}`, name)
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(body)
+
+	response, err := restClient.Post("users/delete", reader)
+	if err != nil {
+		return err
+	} else if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf(result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) UpdateLocalUser(ctx context.Context, name string, update common.LocalUserUpdate) (err error) {
+	if update.Password != "" {
+		if err = d.requireMutualTLS(); err != nil {
+			return err
+		}
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name string `json:"name"`
+		common.LocalUserUpdate
+	}{
+		Name:            name,
+		LocalUserUpdate: update,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("users/update", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to update the local user: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) GetLocalUserDetail(ctx context.Context, name string) (detail common.LocalUserDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	escapedName := url.QueryEscape(name)
+	escapedName = strings.ReplaceAll(escapedName, "+", "%20")
+
+	url := fmt.Sprintf("users/detail?name=%s", escapedName)
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		detail.Name = name
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		detail.Name = name
+		return detail, fmt.Errorf("Failed")
+	}
+
+	restClient.GetResponseBody(response, &detail)
+
+	return detail, err
+}
+
+func (d *AgentDriver) GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	escapedNames := make([]string, 0, len(names))
+	for _, name := range names {
+		escapedName := url.QueryEscape(name)
+		escapedName = strings.ReplaceAll(escapedName, "+", "%20")
+		escapedNames = append(escapedNames, escapedName)
+	}
+
+	url := fmt.Sprintf("users/detail?name=%s", strings.Join(escapedNames, ","))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return detail, fmt.Errorf("Failed")
+	}
+
+	restClient.GetResponseBody(response, &detail)
+
+	return detail, err
+}
+
+func (d *AgentDriver) CreateLocalGroup(ctx context.Context, name, description string) (detail common.LocalGroupDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}{
+		Name:        name,
+		Description: description,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("groups/create", reader)
+	if err != nil {
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return detail, fmt.Errorf("failed to create the local group: %s", result.Error)
+	}
+
+	// The GID or the SID is assigned by the host.
+	return d.GetLocalGroupDetail(ctx, name)
+}
+
+func (d *AgentDriver) DeleteLocalGroup(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name string `json:"name"`
+	}{
+		Name: name,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post("groups/delete", reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to delete the local group: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	return d.changeLocalGroupMembers(ctx, "groups/members/add", name, members)
+}
+
+func (d *AgentDriver) RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	return d.changeLocalGroupMembers(ctx, "groups/members/remove", name, members)
+}
+
+func (d *AgentDriver) changeLocalGroupMembers(ctx context.Context, path, name string, members []string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := struct {
+		Name    string   `json:"name"`
+		Members []string `json:"members"`
+	}{
+		Name:    name,
+		Members: members,
+	}
+	request_body, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+
+	// Convert the string to an io.Reader
+	reader := strings.NewReader(string(request_body))
+
+	response, err := restClient.Post(path, reader)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to change the members of the local group: %s", result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error) {
+	groups, err := d.GetLocalGroupsDetail(ctx, []string{name})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(groups) == 0 {
+		return detail, fmt.Errorf("the local group %s does not exist", name)
+	}
+
+	return groups[0], nil
+}
+
+func (d *AgentDriver) GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	escapedNames := make([]string, 0, len(names))
+	for _, name := range names {
+		escapedNames = append(escapedNames, url.QueryEscape(name))
+	}
+
+	url := fmt.Sprintf("groups/detail?name=%s", strings.Join(escapedNames, ","))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return detail, fmt.Errorf("failed to get the local groups")
+	}
+
+	err = restClient.GetResponseBody(response, &detail)
+
+	return detail, err
+}
+
+func (d *AgentDriver) CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error) {
+	restClient := d.getRestClient(ctx).WithTimeout(agentSnapshotTimeout)
+
+	request_body, err := json.Marshal(map[string]string{"directory_name": directoryName, "name": name})
+	if err != nil {
+		return
+	}
+
+	response, err := restClient.Post("snapshots/create", strings.NewReader(string(request_body)))
+	if err != nil {
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return detail, fmt.Errorf("failed to create the snapshot of the directory: %s", result.Error)
+	}
+
+	err = restClient.GetResponseBody(response, &detail)
+
+	return detail, err
+}
+
+func (d *AgentDriver) DeleteSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return d.postSnapshot(d.getRestClient(ctx), "snapshots/delete", directoryName, name, "delete")
+}
+
+func (d *AgentDriver) ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	url := fmt.Sprintf("snapshots?directory_name=%s", url.QueryEscape(directoryName))
+
+	response, err := restClient.Get(url)
+	if err != nil {
+		return detail, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return detail, fmt.Errorf("failed to get the snapshots of the directory: %s", result.Error)
+	}
+
+	err = restClient.GetResponseBody(response, &detail)
+
+	return detail, err
+}
+
+func (d *AgentDriver) RestoreSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return d.postSnapshot(d.getRestClient(ctx).WithTimeout(agentSnapshotTimeout), "snapshots/restore", directoryName, name, "restore")
+}
+
+// CreateReplicationSource lets the agent issue the token for the destination agent to read the directory, the agent
+// is reached by the destination agent at the same address as the engine reaches it, over mutual TLS only.
+func (d *AgentDriver) CreateReplicationSource(ctx context.Context, directoryName string) (source common.ReplicationSource, err error) {
+	if d.config.Scheme != "https" {
+		return source, errors.New("the directory is replicated over mutual TLS only, the source agent is not enrolled")
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	request_body, err := json.Marshal(map[string]string{"directory_name": directoryName})
+	if err != nil {
+		return source, err
+	}
+
+	response, err := restClient.Post("replication/token", strings.NewReader(string(request_body)))
+	if err != nil {
+		return source, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return source, fmt.Errorf("failed to create the replication token of the directory: %s", result.Error)
+	}
+
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err = restClient.GetResponseBody(response, &token); err != nil {
+		return source, err
+	}
+
+	port := d.config.Port
+	if port == 0 {
+		port = defaultAgentTLSPort
+	}
+
+	return common.ReplicationSource{
+		Scheme:          "https",
+		Address:         net.JoinHostPort(d.config.IP, strconv.Itoa(port)),
+		CertFingerprint: d.config.CertFingerprint,
+		Token:           token.Token,
+	}, nil
+}
+
+func (d *AgentDriver) PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error) {
+	// The destination agent presents its certificate to the source agent.
+	if d.config.Scheme != "https" {
+		return result, errors.New("the directory is replicated over mutual TLS only, the destination agent is not enrolled")
+	}
+
+	restClient := d.getRestClient(ctx).WithTimeout(agentReplicationTimeout)
+
+	request_body, err := json.Marshal(struct {
+		DirectoryName string                   `json:"directory_name"`
+		Source        common.ReplicationSource `json:"source"`
+	}{
+		DirectoryName: directoryName,
+		Source:        source,
+	})
+	if err != nil {
+		return result, err
+	}
+
+	response, err := restClient.Post("replication/pull", strings.NewReader(string(request_body)))
+	if err != nil {
+		return result, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var failure common.FailedRESTResponse
+		restClient.GetResponseBody(response, &failure)
+
+		return result, fmt.Errorf("failed to pull the replication into the directory: %s", failure.Error)
+	}
+
+	err = restClient.GetResponseBody(response, &result)
+
+	return result, err
+}
+
+// postSnapshot posts the snapshot of the directory to the agent API, the action is reported in the error.
+func (d *AgentDriver) postSnapshot(restClient *client.RestClient, path, directoryName, name, action string) error {
+	request_body, err := json.Marshal(map[string]string{"directory_name": directoryName, "name": name})
+	if err != nil {
+		return err
+	}
+
+	response, err := restClient.Post(path, strings.NewReader(string(request_body)))
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return fmt.Errorf("failed to %s the snapshot of the directory: %s", action, result.Error)
+	}
+
+	return nil
+}
+
+func (d *AgentDriver) GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error) {
+	restClient := d.getRestClient(ctx)
+
+	response, err := restClient.Get("system-info")
+	if err != nil {
+		return systemInfo, err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var result common.FailedRESTResponse
+		restClient.GetResponseBody(response, &result)
+
+		return systemInfo, fmt.Errorf("failed to get the system information of the agent: %s", result.Error)
 	}
 
 	err = restClient.GetResponseBody(response, &systemInfo)
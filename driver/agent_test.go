@@ -0,0 +1,93 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/client"
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+func TestAgentDriver_Cancel(t *testing.T) {
+	// The agent does not respond until the test is finished.
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	driver, err := NewAgentDriver(HostConfig{StorageType: "workstation", IP: serverURL.Hostname(), Port: port})
+	if err != nil {
+		t.Fatalf("NewAgentDriver() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err = driver.CreateDirectory(ctx, "data")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateDirectory() error = %v, want %v", err, context.Canceled)
+	}
+
+	// The request is aborted by the cancellation rather than the timeout of the client.
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("CreateDirectory() returns after %v, want it to return once the context is cancelled", elapsed)
+	}
+}
+
+func TestAgentDriver_CreateReplicationSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent/replication/token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		io.WriteString(w, `{"token": "replication-token"}`)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	// The agent which is not enrolled is rejected before it is called.
+	driver, err := NewAgentDriver(HostConfig{StorageType: "workstation", IP: serverURL.Hostname(), Port: port})
+	if err != nil {
+		t.Fatalf("NewAgentDriver() error = %v", err)
+	}
+	if _, err = driver.CreateReplicationSource(context.Background(), "data"); err == nil {
+		t.Errorf("CreateReplicationSource() of the agent not enrolled error = nil")
+	}
+
+	// The enrolled agent is served over plain HTTP by the test server, only the scheme of its configuration matters.
+	config := HostConfig{StorageType: "workstation", Scheme: "https", IP: serverURL.Hostname(), Port: port, CertFingerprint: "fingerprint"}
+	driver = &AgentDriver{
+		config:     config,
+		restClient: client.GetRestClient("http", common.HostContext{IP: config.IP}, port, "agent", common.AgentTokenHeader, "", true),
+	}
+
+	source, err := driver.CreateReplicationSource(context.Background(), "data")
+	if err != nil {
+		t.Fatalf("CreateReplicationSource() error = %v", err)
+	}
+
+	// The destination agent reaches the source agent at the address which the engine connects it by.
+	want := common.ReplicationSource{Scheme: "https", Address: serverURL.Host, CertFingerprint: "fingerprint", Token: "replication-token"}
+	if source != want {
+		t.Errorf("CreateReplicationSource() = %+v, want %+v", source, want)
+	}
+}
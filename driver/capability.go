@@ -0,0 +1,95 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Capability is a group of the operations which a driver may support.
+type Capability string
+
+const (
+	CapabilityDirectory Capability = "directory"
+	CapabilityCIFS      Capability = "cifs"
+	CapabilityNFS       Capability = "nfs"
+	CapabilityLocalUser Capability = "local_user"
+	// The local groups and their members.
+	CapabilityLocalGroup Capability = "local_group"
+	CapabilityQuota      Capability = "quota"
+	CapabilityUsage      Capability = "usage"
+	CapabilityMount      Capability = "mount"
+	CapabilityACL        Capability = "acl"
+	// The access levels other than full, and the changes of the access on the existing shares.
+	CapabilityShareAccess Capability = "share_access"
+	// Unlocking the local users locked out by the failed logons.
+	CapabilityUnlockUser Capability = "unlock_user"
+	// The point-in-time copies of the directories, which the directories can be restored from.
+	CapabilitySnapshot Capability = "snapshot"
+	// Replicating the directories from one host to another, the hosts transfer the files to each other directly.
+	CapabilityReplication Capability = "replication"
+)
+
+// UnsupportedOperationError is returned if the storage type has no driver, or its driver does not support the operation.
+type UnsupportedOperationError struct {
+	StorageType string
+	Capability  Capability
+}
+
+func (e *UnsupportedOperationError) Error() string {
+	if e.Capability == "" {
+		return fmt.Sprintf("unsupported storage type %s", e.StorageType)
+	}
+
+	return fmt.Sprintf("unsupported operation for storage type %s: %s", e.StorageType, e.Capability)
+}
+
+// IsUnsupportedOperation reports whether any error in err's tree is an UnsupportedOperationError.
+func IsUnsupportedOperation(err error) bool {
+	var unsupportedErr *UnsupportedOperationError
+
+	return errors.As(err, &unsupportedErr)
+}
+
+// HasCapability reports whether the driver declares the capability.
+func HasCapability(driver Driver, capability Capability) bool {
+	for _, c := range driver.Capabilities() {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetCapabilities returns the capabilities of the driver of the storage type, or nil if the storage type has no driver.
+func GetCapabilities(storageType string) []Capability {
+	registryMu.Lock()
+	factory, exist := factories[storageType]
+	registryMu.Unlock()
+
+	if !exist {
+		return nil
+	}
+
+	// The factory does not connect to the host, so an instance without host is enough to ask for the capabilities.
+	driver, err := factory(HostConfig{StorageType: storageType})
+	if err != nil {
+		return nil
+	}
+
+	return driver.Capabilities()
+}
+
+// GetDriverFor returns the driver instance of the host if it supports the capability.
+func GetDriverFor(config HostConfig, capability Capability) (Driver, error) {
+	driver, err := GetDriver(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !HasCapability(driver, capability) {
+		return nil, &UnsupportedOperationError{StorageType: config.StorageType, Capability: capability}
+	}
+
+	return driver, nil
+}
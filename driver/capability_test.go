@@ -0,0 +1,160 @@
+package driver
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestGetDriverFor(t *testing.T) {
+	tests := []struct {
+		name            string
+		storageType     string
+		capability      Capability
+		wantErr         bool
+		wantUnsupported bool
+	}{
+		{
+			name:        "Workstation supports NFS",
+			storageType: "workstation",
+			capability:  CapabilityNFS,
+		},
+		{
+			name:        "ONTAP supports CIFS",
+			storageType: "ontap",
+			capability:  CapabilityCIFS,
+		},
+		{
+			name:            "ONTAP does not support NFS",
+			storageType:     "ontap",
+			capability:      CapabilityNFS,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:        "MagnaScale supports local users",
+			storageType: "magnascale",
+			capability:  CapabilityLocalUser,
+		},
+		{
+			name:            "MagnaScale does not support mounts",
+			storageType:     "magnascale",
+			capability:      CapabilityMount,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:        "Workstation supports quotas",
+			storageType: "workstation",
+			capability:  CapabilityQuota,
+		},
+		{
+			name:            "ONTAP does not support quotas",
+			storageType:     "ontap",
+			capability:      CapabilityQuota,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:            "MagnaScale does not support share access levels",
+			storageType:     "magnascale",
+			capability:      CapabilityShareAccess,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:            "ONTAP does not support unlocking users",
+			storageType:     "ontap",
+			capability:      CapabilityUnlockUser,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:        "Workstation supports snapshots",
+			storageType: "workstation",
+			capability:  CapabilitySnapshot,
+		},
+		{
+			name:            "ONTAP does not support snapshots",
+			storageType:     "ontap",
+			capability:      CapabilitySnapshot,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:        "Workstation supports replication",
+			storageType: "workstation",
+			capability:  CapabilityReplication,
+		},
+		{
+			name:            "MagnaScale does not support replication",
+			storageType:     "magnascale",
+			capability:      CapabilityReplication,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+		{
+			name:            "Unknown storage type",
+			storageType:     "unknown",
+			capability:      CapabilityDirectory,
+			wantErr:         true,
+			wantUnsupported: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetDriverFor(HostConfig{StorageType: tt.storageType, IP: "192.168.0.10"}, tt.capability)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetDriverFor() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if IsUnsupportedOperation(err) != tt.wantUnsupported {
+				t.Errorf("IsUnsupportedOperation() = %v, want %v", IsUnsupportedOperation(err), tt.wantUnsupported)
+			}
+			if !tt.wantErr && got == nil {
+				t.Errorf("GetDriverFor() returns nil driver")
+			}
+		})
+	}
+}
+
+func TestIsUnsupportedOperation(t *testing.T) {
+	unsupportedErr := &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityNFS}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "Unsupported operation",
+			err:  unsupportedErr,
+			want: true,
+		},
+		{
+			name: "Wrapped unsupported operation",
+			err:  fmt.Errorf("failed to create the export: %w", unsupportedErr),
+			want: true,
+		},
+		{
+			name: "Other error",
+			err:  fmt.Errorf("failed to create the export"),
+			want: false,
+		},
+		{
+			name: "No error",
+			err:  nil,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsUnsupportedOperation(tt.err); got != tt.want {
+				t.Errorf("IsUnsupportedOperation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, want := unsupportedErr.Error(), "unsupported operation for storage type ontap: nfs"; got != want {
+		t.Errorf("UnsupportedOperationError.Error() = %v, want %v", got, want)
+	}
+}
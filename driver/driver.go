@@ -2,6 +2,7 @@ package driver
 
 import (
 	"context"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
 )
@@ -11,14 +12,27 @@ type Driver interface {
 
 	DeleteDirectory(ctx context.Context, name string) (err error)
 
+	// UpdateDirectory renames the directory, it fails if the new name is used already.
+	UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error)
+
 	GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error)
 
 	GetDirectoriesDetail(ctx context.Context, names []string) (detail []common.DirectoryDetail, err error)
 
-	CreateCIFSShare(ctx context.Context, name, directory_name, description string, usernames []string) (err error)
+	CreateCIFSShare(ctx context.Context, name, directory_name, description string, access []common.ShareAccess) (err error)
 
 	DeleteCIFSShare(ctx context.Context, name string) (err error)
 
+	UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error)
+
+	// GrantCIFSShareAccess gives the access levels to the users and the groups, the level of the one given already is replaced.
+	GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error)
+
+	RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error)
+
+	// GetCIFSSharesDetail returns the details of the shares, or all the shares on the host if no names are given.
+	GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error)
+
 	MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error)
 
 	UnmountCIFSShare(ctx context.Context, mountPoint string) (err error)
@@ -27,22 +41,92 @@ type Driver interface {
 
 	DeleteLocalUser(ctx context.Context, name string) (err error)
 
+	// UpdateLocalUser resets the password of the user, unlocks it and enables or disables it, the fields not set are not changed.
+	UpdateLocalUser(ctx context.Context, name string, update common.LocalUserUpdate) (err error)
+
 	GetLocalUserDetail(ctx context.Context, name string) (detail common.LocalUserDetail, err error)
 
 	GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error)
 
+	CreateLocalGroup(ctx context.Context, name, description string) (detail common.LocalGroupDetail, err error)
+
+	DeleteLocalGroup(ctx context.Context, name string) (err error)
+
+	// AddLocalGroupMembers adds the local users to the group, the users which are members already are not changed.
+	AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error)
+
+	RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error)
+
+	GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error)
+
+	// GetLocalGroupsDetail returns the details of the groups, or all the local groups on the host if no names are given.
+	GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error)
+
+	CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error)
+
+	DeleteNFSExport(ctx context.Context, directoryName string) (err error)
+
+	GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error)
+
+	GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error)
+
+	// GetDirectoryUsage returns the used bytes, the file count, the largest files and the age histogram of the directory.
+	GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error)
+
+	// SetDirectoryQuota sets the soft and hard limits of the capacity and the files in the directory, 0 means no limit.
+	SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error)
+
+	ClearDirectoryQuota(ctx context.Context, name string) (err error)
+
+	// GetDirectoryQuota returns the quota limits of the directory with its usage.
+	GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error)
+
+	// GetDirectoryACL returns the owner and the permissions of the directory in the normalized ACL.
+	GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error)
+
+	// SetDirectoryACL replaces the permissions of the directory, the inherited entries are not changed.
+	SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error)
+
+	// CreateSnapshot takes a point-in-time copy of the directory, the name is unique among the snapshots of the directory.
+	CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error)
+
+	DeleteSnapshot(ctx context.Context, directoryName, name string) (err error)
+
+	// ListSnapshots returns the snapshots of the directory in the order of their creation.
+	ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error)
+
+	// RestoreSnapshot replaces the content of the directory by the snapshot, the changes since the snapshot are lost.
+	RestoreSnapshot(ctx context.Context, directoryName, name string) (err error)
+
+	// CreateReplicationSource returns where the destination host pulls the directory from, with the token allowing it
+	// to read the directory only.
+	CreateReplicationSource(ctx context.Context, directoryName string) (source common.ReplicationSource, err error)
+
+	// PullReplication makes the directory the same as the source directory, only the files changed are transferred.
+	PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error)
+
 	GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error)
+
+	// Capabilities returns the groups of the operations supported by the driver.
+	Capabilities() []Capability
 }
 
-func GetDriver(storageType string) Driver {
-	drivers := map[string]Driver{
-		"workstation": &AgentDriver{},
-	}
+// Enrollment is the connection settings of the host after it is enrolled.
+type Enrollment struct {
+	Scheme string
+	Port   int
+	// The fingerprint of the certificate issued to the host, the later connections are pinned to it.
+	CertFingerprint string
+}
 
-	driver, ok := drivers[storageType]
-	if !ok {
-		return nil
-	}
+// Enroller is implemented by the driver whose host is connected by mutual TLS, e.g. the agent.
+type Enroller interface {
+	// Enroll issues the certificate of the host by the CA of the engine, and returns the settings to connect it since then.
+	Enroll(ctx context.Context) (*Enrollment, error)
+}
 
-	return driver
+// HeartbeatTokenReceiver is implemented by the driver whose host sends the heartbeats to the engine, e.g. the agent.
+type HeartbeatTokenReceiver interface {
+	// SendHeartbeatToken sends the token which the host sends the heartbeats with, and the interval between them.
+	SendHeartbeatToken(ctx context.Context, token string, interval time.Duration) error
 }
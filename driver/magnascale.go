@@ -0,0 +1,631 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/client"
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The header of the session token returned by MagnaScale, the token is used instead of the password once it is returned.
+const magnaScaleTokenKey = "X-Auth-Token"
+
+// The layout of the time returned by MagnaScale is RFC 3339, it is converted to the layout used by the agents.
+const magnaScaleTimeLayout = "2006-01-02 15:04:05"
+
+// MagnaScaleDriver manages the MagnaScale scale-out NAS by the management REST API v1.
+// The directories are the top level directories in the file system specified by the configuration [magnascale].
+// The session token is kept by the driver instance of the host, so the password is sent only once in a while.
+type MagnaScaleDriver struct {
+	config     HostConfig
+	restClient *client.RestClient
+}
+
+func init() {
+	Register("magnascale", NewMagnaScaleDriver)
+}
+
+func NewMagnaScaleDriver(config HostConfig) (Driver, error) {
+	port := config.Port
+	if port == 0 {
+		port = common.Config.MagnaScale.Port
+	}
+	if port == 0 {
+		port = 8443
+	}
+
+	hostContext := common.HostContext{IP: config.IP, Username: config.Username, Password: config.Password}
+
+	restClient := client.GetRestClient("https", hostContext, port, "api/v1", magnaScaleTokenKey, "", true)
+	restClient.SetTLSConfig(&tls.Config{InsecureSkipVerify: config.InsecureSkipVerify || common.Config.MagnaScale.InsecureSkipVerify})
+	restClient.SetTimeout(30 * time.Second)
+
+	return &MagnaScaleDriver{config: config, restClient: restClient}, nil
+}
+
+type magnaScaleItems[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"`
+}
+
+type magnaScaleErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type magnaScaleSystem struct {
+	Name    string `json:"name"`
+	Model   string `json:"model"`
+	Version string `json:"version"`
+	Build   string `json:"build"`
+}
+
+type magnaScaleDirectory struct {
+	Name       string `json:"name"`
+	Path       string `json:"path,omitempty"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	AccessedAt string `json:"accessed_at,omitempty"`
+	ModifiedAt string `json:"modified_at,omitempty"`
+}
+
+type magnaScaleSMBShare struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Comment string   `json:"comment,omitempty"`
+	Users   []string `json:"users,omitempty"`
+}
+
+type magnaScaleNFSClient struct {
+	Host       string `json:"host"`
+	Access     string `json:"access"`
+	RootSquash bool   `json:"root_squash"`
+}
+
+type magnaScaleNFSExport struct {
+	ID      string                `json:"id,omitempty"`
+	Path    string                `json:"path"`
+	Clients []magnaScaleNFSClient `json:"clients"`
+}
+
+type magnaScaleUser struct {
+	Name        string `json:"name"`
+	UID         string `json:"uid,omitempty"`
+	FullName    string `json:"full_name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Password    string `json:"password,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	Locked      bool   `json:"locked"`
+}
+
+func (d *MagnaScaleDriver) Capabilities() []Capability {
+	return []Capability{CapabilityDirectory, CapabilityCIFS, CapabilityNFS, CapabilityLocalUser, CapabilityUnlockUser}
+}
+
+func (d *MagnaScaleDriver) getRestClient(ctx context.Context) *client.RestClient {
+	return d.restClient.WithContext(ctx)
+}
+
+func (d *MagnaScaleDriver) getFileSystemURL(format string, args ...interface{}) string {
+	return fmt.Sprintf("filesystems/%s/", url.PathEscape(common.Config.MagnaScale.FileSystem)) + fmt.Sprintf(format, args...)
+}
+
+// getMagnaScaleError returns the error of the failed request with the message returned by MagnaScale.
+func getMagnaScaleError(restClient *client.RestClient, response *http.Response, action string) error {
+	var result magnaScaleErrorResponse
+	if err := restClient.GetResponseBody(response, &result); err != nil || result.Error.Message == "" {
+		return fmt.Errorf("failed to %s on MagnaScale: %s", action, response.Status)
+	}
+
+	return fmt.Errorf("failed to %s on MagnaScale: %s", action, result.Error.Message)
+}
+
+// do sends the request and unmarshals the response body into the result if it is not nil.
+func (d *MagnaScaleDriver) do(restClient *client.RestClient, method, url string, body, result interface{}, action string) error {
+	var reader io.Reader
+	if body != nil {
+		requestBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = strings.NewReader(string(requestBody))
+	}
+
+	var response *http.Response
+	var err error
+
+	switch method {
+	case http.MethodGet:
+		response, err = restClient.Get(url)
+	case http.MethodPost:
+		response, err = restClient.Post(url, reader)
+	case http.MethodPatch:
+		response, err = restClient.Patch(url, reader)
+	case http.MethodDelete:
+		response, err = restClient.Delete(url)
+	default:
+		return fmt.Errorf("unsupported method %s", method)
+	}
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return getMagnaScaleError(restClient, response, action)
+	}
+
+	if result == nil || response.StatusCode == http.StatusNoContent {
+		response.Body.Close()
+		return nil
+	}
+
+	return restClient.GetResponseBody(response, result)
+}
+
+func toMagnaScaleTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+
+	return t.Local().Format(magnaScaleTimeLayout)
+}
+
+func toMagnaScaleDirectoryDetail(directory magnaScaleDirectory) common.DirectoryDetail {
+	return common.DirectoryDetail{
+		Name:           directory.Name,
+		CreationTime:   toMagnaScaleTime(directory.CreatedAt),
+		LastAccessTime: toMagnaScaleTime(directory.AccessedAt),
+		LastWriteTime:  toMagnaScaleTime(directory.ModifiedAt),
+		Exist:          true,
+		FullPath:       directory.Path,
+		ParentFullPath: path.Dir(directory.Path),
+	}
+}
+
+func (d *MagnaScaleDriver) getDirectories(restClient *client.RestClient, names []string) ([]magnaScaleDirectory, error) {
+	requestURL := d.getFileSystemURL("directories")
+	if len(names) > 0 {
+		requestURL += "?names=" + url.QueryEscape(strings.Join(names, ","))
+	}
+
+	var result magnaScaleItems[magnaScaleDirectory]
+	if err := d.do(restClient, http.MethodGet, requestURL, nil, &result, "get the directories"); err != nil {
+		return nil, err
+	}
+
+	return result.Items, nil
+}
+
+func (d *MagnaScaleDriver) CreateDirectory(ctx context.Context, name string) (directoryDetails common.DirectoryDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	var directory magnaScaleDirectory
+	if err = d.do(restClient, http.MethodPost, d.getFileSystemURL("directories"), magnaScaleDirectory{Name: name}, &directory, "create the directory "+name); err != nil {
+		return directoryDetails, err
+	}
+
+	return toMagnaScaleDirectoryDetail(directory), nil
+}
+
+func (d *MagnaScaleDriver) DeleteDirectory(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	return d.do(restClient, http.MethodDelete, d.getFileSystemURL("directories/%s", url.PathEscape(name)), nil, nil, "delete the directory "+name)
+}
+
+func (d *MagnaScaleDriver) UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error) {
+	body := magnaScaleDirectory{Name: update.NewName}
+
+	return d.do(d.getRestClient(ctx), http.MethodPatch, d.getFileSystemURL("directories/%s", url.PathEscape(name)), body, nil, "rename the directory "+name)
+}
+
+func (d *MagnaScaleDriver) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
+	directories, err := d.getDirectories(d.getRestClient(ctx), []string{name})
+	if err != nil || len(directories) == 0 {
+		detail.Name = name
+		detail.Exist = false
+		if err == nil {
+			err = fmt.Errorf("the directory %s does not exist", name)
+		}
+		return detail, err
+	}
+
+	return toMagnaScaleDirectoryDetail(directories[0]), nil
+}
+
+func (d *MagnaScaleDriver) GetDirectoriesDetail(ctx context.Context, names []string) (detail []common.DirectoryDetail, err error) {
+	directories, err := d.getDirectories(d.getRestClient(ctx), names)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, directory := range directories {
+		detail = append(detail, toMagnaScaleDirectoryDetail(directory))
+	}
+
+	return detail, nil
+}
+
+// CreateCIFSShare creates the SMB share with the users of full access, MagnaScale supports no other access levels
+// and no groups.
+func (d *MagnaScaleDriver) CreateCIFSShare(ctx context.Context, name, directory_name, description string, access []common.ShareAccess) (err error) {
+	var usernames []string
+	for _, entry := range access {
+		if entry.Permission != common.SharePermissionFull || entry.IsGroup() {
+			return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityShareAccess}
+		}
+
+		usernames = append(usernames, entry.UserName)
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	directories, err := d.getDirectories(restClient, []string{directory_name})
+	if err != nil {
+		return err
+	}
+
+	if len(directories) == 0 {
+		return fmt.Errorf("the directory %s does not exist", directory_name)
+	}
+
+	body := magnaScaleSMBShare{
+		Name:    name,
+		Path:    directories[0].Path,
+		Comment: description,
+		Users:   usernames,
+	}
+
+	return d.do(restClient, http.MethodPost, "smb/shares", body, nil, "create the CIFS share "+name)
+}
+
+func (d *MagnaScaleDriver) DeleteCIFSShare(ctx context.Context, name string) (err error) {
+	return d.do(d.getRestClient(ctx), http.MethodDelete, "smb/shares/"+url.PathEscape(name), nil, nil, "delete the CIFS share "+name)
+}
+
+func (d *MagnaScaleDriver) UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error) {
+	if update.Description == nil {
+		return nil
+	}
+
+	body := struct {
+		Comment string `json:"comment"`
+	}{
+		Comment: *update.Description,
+	}
+
+	return d.do(d.getRestClient(ctx), http.MethodPatch, "smb/shares/"+url.PathEscape(name), body, nil, "update the CIFS share "+name)
+}
+
+func (d *MagnaScaleDriver) GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityShareAccess}
+}
+
+func (d *MagnaScaleDriver) RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityShareAccess}
+}
+
+// GetCIFSSharesDetail returns the SMB shares, or all of them if no names are given.
+func (d *MagnaScaleDriver) GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error) {
+	requestURL := "smb/shares"
+	if len(names) > 0 {
+		requestURL += "?names=" + url.QueryEscape(strings.Join(names, ","))
+	}
+
+	var result magnaScaleItems[magnaScaleSMBShare]
+	if err = d.do(d.getRestClient(ctx), http.MethodGet, requestURL, nil, &result, "get the CIFS shares"); err != nil {
+		return detail, err
+	}
+
+	for _, share := range result.Items {
+		detail = append(detail, common.ShareDetail{
+			Name:          share.Name,
+			Description:   share.Comment,
+			DirectoryPath: share.Path,
+			State:         "online",
+		})
+	}
+
+	return detail, nil
+}
+
+func (d *MagnaScaleDriver) MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityMount}
+}
+
+func (d *MagnaScaleDriver) UnmountCIFSShare(ctx context.Context, mountPoint string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityMount}
+}
+
+func (d *MagnaScaleDriver) CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	directories, err := d.getDirectories(restClient, []string{directoryName})
+	if err != nil {
+		return err
+	}
+
+	if len(directories) == 0 {
+		return fmt.Errorf("the directory %s does not exist", directoryName)
+	}
+
+	body := magnaScaleNFSExport{Path: directories[0].Path}
+	for _, client := range clients {
+		body.Clients = append(body.Clients, magnaScaleNFSClient(client))
+	}
+
+	return d.do(restClient, http.MethodPost, "nfs/exports", body, nil, "create the NFS export of "+directoryName)
+}
+
+func (d *MagnaScaleDriver) getNFSExports(restClient *client.RestClient) ([]magnaScaleNFSExport, error) {
+	var result magnaScaleItems[magnaScaleNFSExport]
+	if err := d.do(restClient, http.MethodGet, "nfs/exports", nil, &result, "get the NFS exports"); err != nil {
+		return nil, err
+	}
+
+	return result.Items, nil
+}
+
+func (d *MagnaScaleDriver) DeleteNFSExport(ctx context.Context, directoryName string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	directories, err := d.getDirectories(restClient, []string{directoryName})
+	if err != nil {
+		return err
+	}
+
+	if len(directories) == 0 {
+		return fmt.Errorf("the directory %s does not exist", directoryName)
+	}
+
+	exports, err := d.getNFSExports(restClient)
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.Path == directories[0].Path {
+			return d.do(restClient, http.MethodDelete, "nfs/exports/"+url.PathEscape(export.ID), nil, nil, "delete the NFS export of "+directoryName)
+		}
+	}
+
+	return fmt.Errorf("the directory %s is not exported", directoryName)
+}
+
+func (d *MagnaScaleDriver) GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error) {
+	exports, err := d.GetNFSExportsDetail(ctx, []string{directoryName})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(exports) == 0 {
+		return detail, fmt.Errorf("the directory %s is not exported", directoryName)
+	}
+
+	return exports[0], nil
+}
+
+// GetNFSExportsDetail returns the exports of the directories, or all the exports of the file system if no name is given.
+func (d *MagnaScaleDriver) GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	directories, err := d.getDirectories(restClient, directoryNames)
+	if err != nil {
+		return detail, err
+	}
+
+	exports, err := d.getNFSExports(restClient)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, directory := range directories {
+		for _, export := range exports {
+			if export.Path != directory.Path {
+				continue
+			}
+
+			exportDetail := common.NFSExportDetail{Name: directory.Name, DirectoryPath: export.Path}
+			for _, client := range export.Clients {
+				exportDetail.Clients = append(exportDetail.Clients, common.NFSClient(client))
+			}
+			detail = append(detail, exportDetail)
+		}
+	}
+
+	return detail, nil
+}
+
+func toMagnaScaleLocalUserDetail(user magnaScaleUser) common.LocalUserDetail {
+	detail := common.LocalUserDetail{
+		Name:               user.Name,
+		UID:                user.UID,
+		FullName:           user.FullName,
+		Description:        user.Description,
+		Status:             "OK",
+		IsPasswordRequired: true,
+		IsLockout:          user.Locked,
+		IsDisabled:         !user.Enabled,
+	}
+
+	if detail.IsLockout || detail.IsDisabled {
+		detail.Status = "Degraded"
+	}
+
+	return detail
+}
+
+func (d *MagnaScaleDriver) getLocalUsers(restClient *client.RestClient, names []string) ([]magnaScaleUser, error) {
+	requestURL := "users"
+	if len(names) > 0 {
+		requestURL += "?names=" + url.QueryEscape(strings.Join(names, ","))
+	}
+
+	var result magnaScaleItems[magnaScaleUser]
+	if err := d.do(restClient, http.MethodGet, requestURL, nil, &result, "get the local users"); err != nil {
+		return nil, err
+	}
+
+	return result.Items, nil
+}
+
+func (d *MagnaScaleDriver) CreateLocalUser(ctx context.Context, name, password string) (localUserDetail common.LocalUserDetail, err error) {
+	var user magnaScaleUser
+	if err = d.do(d.getRestClient(ctx), http.MethodPost, "users", magnaScaleUser{Name: name, Password: password, Enabled: true}, &user, "create the local user "+name); err != nil {
+		localUserDetail.Name = name
+		return localUserDetail, err
+	}
+
+	return toMagnaScaleLocalUserDetail(user), nil
+}
+
+func (d *MagnaScaleDriver) DeleteLocalUser(ctx context.Context, name string) (err error) {
+	return d.do(d.getRestClient(ctx), http.MethodDelete, "users/"+url.PathEscape(name), nil, nil, "delete the local user "+name)
+}
+
+// UpdateLocalUser sends the changed fields only, the locked user is unlocked by clearing its locked flag.
+func (d *MagnaScaleDriver) UpdateLocalUser(ctx context.Context, name string, update common.LocalUserUpdate) (err error) {
+	body := struct {
+		Password string `json:"password,omitempty"`
+		Enabled  *bool  `json:"enabled,omitempty"`
+		Locked   *bool  `json:"locked,omitempty"`
+	}{
+		Password: update.Password,
+	}
+
+	if update.Disabled != nil {
+		enabled := !*update.Disabled
+		body.Enabled = &enabled
+	}
+
+	if update.Unlock {
+		locked := false
+		body.Locked = &locked
+	}
+
+	return d.do(d.getRestClient(ctx), http.MethodPatch, "users/"+url.PathEscape(name), body, nil, "update the local user "+name)
+}
+
+func (d *MagnaScaleDriver) GetLocalUserDetail(ctx context.Context, name string) (detail common.LocalUserDetail, err error) {
+	users, err := d.getLocalUsers(d.getRestClient(ctx), []string{name})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(users) == 0 {
+		return detail, fmt.Errorf("the local user %s does not exist", name)
+	}
+
+	return toMagnaScaleLocalUserDetail(users[0]), nil
+}
+
+func (d *MagnaScaleDriver) GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error) {
+	users, err := d.getLocalUsers(d.getRestClient(ctx), names)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, user := range users {
+		detail = append(detail, toMagnaScaleLocalUserDetail(user))
+	}
+
+	return detail, nil
+}
+
+func (d *MagnaScaleDriver) CreateLocalGroup(ctx context.Context, name, description string) (detail common.LocalGroupDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityLocalGroup}
+}
+
+func (d *MagnaScaleDriver) DeleteLocalGroup(ctx context.Context, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityLocalGroup}
+}
+
+func (d *MagnaScaleDriver) AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityLocalGroup}
+}
+
+func (d *MagnaScaleDriver) RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityLocalGroup}
+}
+
+func (d *MagnaScaleDriver) GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityLocalGroup}
+}
+
+func (d *MagnaScaleDriver) GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityLocalGroup}
+}
+
+func (d *MagnaScaleDriver) CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilitySnapshot}
+}
+
+func (d *MagnaScaleDriver) DeleteSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilitySnapshot}
+}
+
+func (d *MagnaScaleDriver) ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilitySnapshot}
+}
+
+func (d *MagnaScaleDriver) RestoreSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilitySnapshot}
+}
+
+func (d *MagnaScaleDriver) CreateReplicationSource(ctx context.Context, directoryName string) (source common.ReplicationSource, err error) {
+	return source, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityReplication}
+}
+
+func (d *MagnaScaleDriver) PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error) {
+	return result, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityReplication}
+}
+
+func (d *MagnaScaleDriver) GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error) {
+	return usage, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityUsage}
+}
+
+func (d *MagnaScaleDriver) SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityQuota}
+}
+
+func (d *MagnaScaleDriver) ClearDirectoryQuota(ctx context.Context, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityQuota}
+}
+
+func (d *MagnaScaleDriver) GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error) {
+	return quota, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityQuota}
+}
+
+func (d *MagnaScaleDriver) GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error) {
+	return acl, &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityACL}
+}
+
+func (d *MagnaScaleDriver) SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error) {
+	return &UnsupportedOperationError{StorageType: "magnascale", Capability: CapabilityACL}
+}
+
+func (d *MagnaScaleDriver) GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error) {
+	var system magnaScaleSystem
+	if err = d.do(d.getRestClient(ctx), http.MethodGet, "system", nil, &system, "get the system"); err != nil {
+		return systemInfo, err
+	}
+
+	return common.SystemInfo{
+		ComputerName:   system.Name,
+		Caption:        "MagnaScale",
+		OSArchitecture: system.Model,
+		OSVersion:      system.Version,
+		BuildNumber:    system.Build,
+	}, nil
+}
@@ -0,0 +1,721 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+const (
+	testMagnaScaleUsername   = "admin"
+	testMagnaScalePassword   = "Passw0rd"
+	testMagnaScaleToken      = "3f1c2a9e7b"
+	testMagnaScaleFileSystem = "fs0"
+	testMagnaScaleTime       = "2023-11-20T08:30:00Z"
+)
+
+// fakeMagnaScaleServer serves the subset of the MagnaScale REST API v1 used by MagnaScaleDriver, the state is kept in memory.
+type fakeMagnaScaleServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	directories []magnaScaleDirectory
+	shares      []magnaScaleSMBShare
+	exports     []magnaScaleNFSExport
+	users       []magnaScaleUser
+	nextUID     int
+	// The authorization schemes used by the requests in order, e.g. "Basic" or "Bearer".
+	authSchemes []string
+}
+
+func newFakeMagnaScaleServer(t *testing.T) *fakeMagnaScaleServer {
+	server := &fakeMagnaScaleServer{nextUID: 2001}
+
+	prefix := "/api/v1/filesystems/" + testMagnaScaleFileSystem
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/system", server.handleSystem)
+	mux.HandleFunc(prefix+"/directories", server.handleDirectories)
+	mux.HandleFunc(prefix+"/directories/", server.handleDirectory)
+	mux.HandleFunc("/api/v1/smb/shares", server.handleShares)
+	mux.HandleFunc("/api/v1/smb/shares/", server.handleShare)
+	mux.HandleFunc("/api/v1/nfs/exports", server.handleExports)
+	mux.HandleFunc("/api/v1/nfs/exports/", server.handleExport)
+	mux.HandleFunc("/api/v1/users", server.handleUsers)
+	mux.HandleFunc("/api/v1/users/", server.handleUser)
+
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		scheme, _, _ := strings.Cut(authorization, " ")
+
+		server.mu.Lock()
+		server.authSchemes = append(server.authSchemes, scheme)
+		server.mu.Unlock()
+
+		if authorization != "Bearer "+testMagnaScaleToken {
+			if username, password, ok := r.BasicAuth(); !ok || username != testMagnaScaleUsername || password != testMagnaScalePassword {
+				writeMagnaScaleError(w, http.StatusUnauthorized, "unauthorized", "Invalid credentials.")
+				return
+			}
+		}
+
+		// The session token is returned for each authenticated request.
+		w.Header().Set(magnaScaleTokenKey, testMagnaScaleToken)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	// Point the driver to the fake server.
+	config := common.Config.MagnaScale
+	t.Cleanup(func() { common.Config.MagnaScale = config })
+
+	common.Config.MagnaScale = common.MagnaScaleConfig{FileSystem: testMagnaScaleFileSystem}
+
+	return server
+}
+
+func (s *fakeMagnaScaleServer) context() context.Context {
+	return context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "test-trace-id")
+}
+
+func (s *fakeMagnaScaleServer) newDriver() *MagnaScaleDriver {
+	serverURL, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	driver, _ := NewMagnaScaleDriver(HostConfig{
+		StorageType:        "magnascale",
+		IP:                 serverURL.Hostname(),
+		Username:           testMagnaScaleUsername,
+		Password:           testMagnaScalePassword,
+		Port:               port,
+		InsecureSkipVerify: true,
+	})
+
+	return driver.(*MagnaScaleDriver)
+}
+
+func (s *fakeMagnaScaleServer) addDirectory(name string) magnaScaleDirectory {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	directory := magnaScaleDirectory{
+		Name:       name,
+		Path:       fmt.Sprintf("/%s/%s", testMagnaScaleFileSystem, name),
+		CreatedAt:  testMagnaScaleTime,
+		AccessedAt: testMagnaScaleTime,
+		ModifiedAt: testMagnaScaleTime,
+	}
+	s.directories = append(s.directories, directory)
+
+	return directory
+}
+
+func (s *fakeMagnaScaleServer) addUser(name string, enabled bool) magnaScaleUser {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := magnaScaleUser{Name: name, UID: strconv.Itoa(s.nextUID), Enabled: enabled}
+	s.users = append(s.users, user)
+	s.nextUID++
+
+	return user
+}
+
+func (s *fakeMagnaScaleServer) AuthSchemes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.authSchemes...)
+}
+
+func writeMagnaScaleJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeMagnaScaleError(w http.ResponseWriter, statusCode int, code, message string) {
+	var body magnaScaleErrorResponse
+	body.Error.Code = code
+	body.Error.Message = message
+
+	writeMagnaScaleJSON(w, statusCode, body)
+}
+
+// matchMagnaScaleName matches the name by the query like "a,b", all names are matched if the query is empty.
+func matchMagnaScaleName(query, name string) bool {
+	return query == "" || containsString(strings.Split(query, ","), name)
+}
+
+func (s *fakeMagnaScaleServer) handleSystem(w http.ResponseWriter, r *http.Request) {
+	writeMagnaScaleJSON(w, http.StatusOK, magnaScaleSystem{Name: "magna01", Model: "MS-4000", Version: "3.2.1", Build: "3.2.1-20231015"})
+}
+
+func (s *fakeMagnaScaleServer) handleDirectories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		result := magnaScaleItems[magnaScaleDirectory]{Items: []magnaScaleDirectory{}}
+		for _, directory := range s.directories {
+			if matchMagnaScaleName(r.URL.Query().Get("names"), directory.Name) {
+				result.Items = append(result.Items, directory)
+			}
+		}
+		result.Total = len(result.Items)
+
+		writeMagnaScaleJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var directory magnaScaleDirectory
+		if err := json.NewDecoder(r.Body).Decode(&directory); err != nil {
+			writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		for _, existing := range s.directories {
+			if existing.Name == directory.Name {
+				s.mu.Unlock()
+				writeMagnaScaleError(w, http.StatusConflict, "already_exists", fmt.Sprintf("Directory %s already exists.", directory.Name))
+				return
+			}
+		}
+		s.mu.Unlock()
+
+		writeMagnaScaleJSON(w, http.StatusCreated, s.addDirectory(directory.Name))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeMagnaScaleServer) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	for i, directory := range s.directories {
+		if directory.Name != name {
+			continue
+		}
+
+		if r.Method == http.MethodPatch {
+			var update magnaScaleDirectory
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", err.Error())
+				return
+			}
+			s.directories[i].Name = update.Name
+			s.directories[i].Path = fmt.Sprintf("/%s/%s", testMagnaScaleFileSystem, update.Name)
+			writeMagnaScaleJSON(w, http.StatusOK, s.directories[i])
+			return
+		}
+
+		s.directories = append(s.directories[:i], s.directories[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeMagnaScaleError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Directory %s does not exist.", name))
+}
+
+func (s *fakeMagnaScaleServer) handleShares(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		result := magnaScaleItems[magnaScaleSMBShare]{Items: []magnaScaleSMBShare{}}
+		for _, share := range s.shares {
+			if matchMagnaScaleName(r.URL.Query().Get("names"), share.Name) {
+				result.Items = append(result.Items, share)
+			}
+		}
+		result.Total = len(result.Items)
+
+		writeMagnaScaleJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var share magnaScaleSMBShare
+		if err := json.NewDecoder(r.Body).Decode(&share); err != nil {
+			writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.shares = append(s.shares, share)
+		writeMagnaScaleJSON(w, http.StatusCreated, share)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeMagnaScaleServer) handleShare(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/smb/shares/")
+	for i, share := range s.shares {
+		if share.Name == name {
+			s.shares = append(s.shares[:i], s.shares[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeMagnaScaleError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Share %s does not exist.", name))
+}
+
+func (s *fakeMagnaScaleServer) handleExports(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		writeMagnaScaleJSON(w, http.StatusOK, magnaScaleItems[magnaScaleNFSExport]{Items: s.exports, Total: len(s.exports)})
+	case http.MethodPost:
+		var export magnaScaleNFSExport
+		if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+			writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		export.ID = strconv.Itoa(len(s.exports) + 1)
+		s.exports = append(s.exports, export)
+		writeMagnaScaleJSON(w, http.StatusCreated, export)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeMagnaScaleServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/nfs/exports/")
+	for i, export := range s.exports {
+		if export.ID == id {
+			s.exports = append(s.exports[:i], s.exports[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeMagnaScaleError(w, http.StatusNotFound, "not_found", fmt.Sprintf("Export %s does not exist.", id))
+}
+
+func (s *fakeMagnaScaleServer) handleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		result := magnaScaleItems[magnaScaleUser]{Items: []magnaScaleUser{}}
+		for _, user := range s.users {
+			if matchMagnaScaleName(r.URL.Query().Get("names"), user.Name) {
+				result.Items = append(result.Items, user)
+			}
+		}
+		result.Total = len(result.Items)
+
+		writeMagnaScaleJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var user magnaScaleUser
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		if user.Password == "" {
+			writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", "Password is required.")
+			return
+		}
+
+		writeMagnaScaleJSON(w, http.StatusCreated, s.addUser(user.Name, user.Enabled))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeMagnaScaleServer) handleUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/users/")
+	for i, user := range s.users {
+		if user.Name != name {
+			continue
+		}
+
+		if r.Method == http.MethodPatch {
+			// The fields left out are not changed.
+			var update map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				writeMagnaScaleError(w, http.StatusBadRequest, "invalid_request", err.Error())
+				return
+			}
+			if enabled, ok := update["enabled"].(bool); ok {
+				s.users[i].Enabled = enabled
+			}
+			if locked, ok := update["locked"].(bool); ok {
+				s.users[i].Locked = locked
+			}
+			if password, ok := update["password"].(string); ok {
+				s.users[i].Password = password
+			}
+			writeMagnaScaleJSON(w, http.StatusOK, s.users[i])
+			return
+		}
+
+		s.users = append(s.users[:i], s.users[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeMagnaScaleError(w, http.StatusNotFound, "not_found", fmt.Sprintf("User %s does not exist.", name))
+}
+
+func testMagnaScaleLocalTime() string {
+	t, _ := time.Parse(time.RFC3339, testMagnaScaleTime)
+	return t.Local().Format(magnaScaleTimeLayout)
+}
+
+func TestMagnaScaleDriver_GetSystemInfo(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+
+	d := server.newDriver()
+	got, err := d.GetSystemInfo(server.context())
+	if err != nil {
+		t.Errorf("MagnaScaleDriver.GetSystemInfo() error = %v", err)
+		return
+	}
+
+	want := common.SystemInfo{ComputerName: "magna01", Caption: "MagnaScale", OSArchitecture: "MS-4000", OSVersion: "3.2.1", BuildNumber: "3.2.1-20231015"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MagnaScaleDriver.GetSystemInfo() = %v, want %v", got, want)
+	}
+}
+
+func TestMagnaScaleDriver_CreateDirectory(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addDirectory("existing")
+
+	tests := []struct {
+		name       string
+		dirName    string
+		wantDetail common.DirectoryDetail
+		wantErr    bool
+	}{
+		{
+			name:    "Create a directory",
+			dirName: "data",
+			wantDetail: common.DirectoryDetail{
+				Name:           "data",
+				CreationTime:   testMagnaScaleLocalTime(),
+				LastAccessTime: testMagnaScaleLocalTime(),
+				LastWriteTime:  testMagnaScaleLocalTime(),
+				Exist:          true,
+				FullPath:       "/fs0/data",
+				ParentFullPath: "/fs0",
+			},
+		},
+		{
+			name:    "Directory already exists",
+			dirName: "existing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver()
+			gotDetail, err := d.CreateDirectory(server.context(), tt.dirName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MagnaScaleDriver.CreateDirectory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("MagnaScaleDriver.CreateDirectory() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestMagnaScaleDriver_DeleteDirectory(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addDirectory("data")
+
+	tests := []struct {
+		name    string
+		dirName string
+		wantErr bool
+	}{
+		{
+			name:    "Delete the directory",
+			dirName: "data",
+		},
+		{
+			name:    "Directory does not exist",
+			dirName: "data",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver()
+			if err := d.DeleteDirectory(server.context(), tt.dirName); (err != nil) != tt.wantErr {
+				t.Errorf("MagnaScaleDriver.DeleteDirectory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMagnaScaleDriver_UpdateDirectory(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addDirectory("data")
+
+	d := server.newDriver()
+	if err := d.UpdateDirectory(server.context(), "data", common.DirectoryUpdate{NewName: "archive"}); err != nil {
+		t.Fatalf("MagnaScaleDriver.UpdateDirectory() error = %v", err)
+	}
+	if err := d.UpdateDirectory(server.context(), "data", common.DirectoryUpdate{NewName: "archive"}); err == nil {
+		t.Errorf("MagnaScaleDriver.UpdateDirectory() renames the missing directory without error")
+	}
+
+	detail, err := d.GetDirectoryDetail(server.context(), "archive")
+	if err != nil {
+		t.Fatalf("MagnaScaleDriver.GetDirectoryDetail() error = %v", err)
+	}
+	if want := "/" + testMagnaScaleFileSystem + "/archive"; detail.FullPath != want {
+		t.Errorf("MagnaScaleDriver.UpdateDirectory() path = %v, want %v", detail.FullPath, want)
+	}
+}
+
+func TestMagnaScaleDriver_CreateCIFSShare(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addDirectory("data")
+
+	d := server.newDriver()
+	access := []common.ShareAccess{{UserName: "alice", Permission: common.SharePermissionFull}}
+	if err := d.CreateCIFSShare(server.context(), "data", "data", "Data share", access); err != nil {
+		t.Errorf("MagnaScaleDriver.CreateCIFSShare() error = %v", err)
+		return
+	}
+
+	want := []magnaScaleSMBShare{{Name: "data", Path: "/fs0/data", Comment: "Data share", Users: []string{"alice"}}}
+	if !reflect.DeepEqual(server.shares, want) {
+		t.Errorf("MagnaScaleDriver.CreateCIFSShare() shares = %v, want %v", server.shares, want)
+	}
+
+	if err := d.CreateCIFSShare(server.context(), "logs", "logs", "", nil); err == nil {
+		t.Errorf("MagnaScaleDriver.CreateCIFSShare() on a missing directory returns no error")
+	}
+
+	// MagnaScale gives the users the full access only.
+	access = []common.ShareAccess{{UserName: "bob", Permission: common.SharePermissionRead}}
+	if err := d.CreateCIFSShare(server.context(), "data2", "data", "", access); !IsUnsupportedOperation(err) {
+		t.Errorf("MagnaScaleDriver.CreateCIFSShare() with the read access error = %v, want unsupported operation", err)
+	}
+}
+
+func TestMagnaScaleDriver_GetCIFSSharesDetail(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.shares = []magnaScaleSMBShare{
+		{Name: "data", Path: "/fs0/data", Comment: "Data share"},
+		{Name: "logs", Path: "/fs0/logs"},
+	}
+
+	d := server.newDriver()
+	gotDetail, err := d.GetCIFSSharesDetail(server.context(), nil)
+	if err != nil {
+		t.Errorf("MagnaScaleDriver.GetCIFSSharesDetail() error = %v", err)
+		return
+	}
+
+	wantDetail := []common.ShareDetail{
+		{Name: "data", Description: "Data share", DirectoryPath: "/fs0/data", State: "online"},
+		{Name: "logs", DirectoryPath: "/fs0/logs", State: "online"},
+	}
+	if !reflect.DeepEqual(gotDetail, wantDetail) {
+		t.Errorf("MagnaScaleDriver.GetCIFSSharesDetail() = %v, want %v", gotDetail, wantDetail)
+	}
+
+	gotDetail, err = d.GetCIFSSharesDetail(server.context(), []string{"logs"})
+	if err != nil || !reflect.DeepEqual(gotDetail, wantDetail[1:]) {
+		t.Errorf("MagnaScaleDriver.GetCIFSSharesDetail() by name = %v, %v, want %v", gotDetail, err, wantDetail[1:])
+	}
+}
+
+func TestMagnaScaleDriver_NFSExport(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addDirectory("data")
+	server.addDirectory("logs")
+
+	d := server.newDriver()
+	ctx := server.context()
+	clients := []common.NFSClient{{Host: "192.168.0.0/24", Access: "rw", RootSquash: true}}
+
+	if err := d.CreateNFSExport(ctx, "data", clients); err != nil {
+		t.Errorf("MagnaScaleDriver.CreateNFSExport() error = %v", err)
+		return
+	}
+
+	gotDetail, err := d.GetNFSExportsDetail(ctx, nil)
+	if err != nil {
+		t.Errorf("MagnaScaleDriver.GetNFSExportsDetail() error = %v", err)
+		return
+	}
+	wantDetail := []common.NFSExportDetail{{Name: "data", DirectoryPath: "/fs0/data", Clients: clients}}
+	if !reflect.DeepEqual(gotDetail, wantDetail) {
+		t.Errorf("MagnaScaleDriver.GetNFSExportsDetail() = %v, want %v", gotDetail, wantDetail)
+	}
+
+	if _, err := d.GetNFSExportDetail(ctx, "logs"); err == nil {
+		t.Errorf("MagnaScaleDriver.GetNFSExportDetail() of the directory not exported returns no error")
+	}
+
+	if err := d.DeleteNFSExport(ctx, "data"); err != nil {
+		t.Errorf("MagnaScaleDriver.DeleteNFSExport() error = %v", err)
+	}
+	if len(server.exports) != 0 {
+		t.Errorf("MagnaScaleDriver.DeleteNFSExport() exports = %v, want none", server.exports)
+	}
+}
+
+func TestMagnaScaleDriver_CreateLocalUser(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		wantDetail common.LocalUserDetail
+		wantErr    bool
+	}{
+		{
+			name:       "Create a local user",
+			username:   "alice",
+			password:   "Passw0rd",
+			wantDetail: common.LocalUserDetail{Name: "alice", UID: "2001", Status: "OK", IsPasswordRequired: true},
+		},
+		{
+			name:       "Password is required",
+			username:   "bob",
+			wantDetail: common.LocalUserDetail{Name: "bob"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver()
+			gotDetail, err := d.CreateLocalUser(server.context(), tt.username, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MagnaScaleDriver.CreateLocalUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("MagnaScaleDriver.CreateLocalUser() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestMagnaScaleDriver_GetLocalUsersDetail(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addUser("alice", true)
+	server.addUser("bob", false)
+
+	d := server.newDriver()
+	gotDetail, err := d.GetLocalUsersDetail(server.context(), []string{"bob"})
+	if err != nil {
+		t.Errorf("MagnaScaleDriver.GetLocalUsersDetail() error = %v", err)
+		return
+	}
+
+	wantDetail := []common.LocalUserDetail{{Name: "bob", UID: "2002", Status: "Degraded", IsPasswordRequired: true, IsDisabled: true}}
+	if !reflect.DeepEqual(gotDetail, wantDetail) {
+		t.Errorf("MagnaScaleDriver.GetLocalUsersDetail() = %v, want %v", gotDetail, wantDetail)
+	}
+
+	if err := d.DeleteLocalUser(server.context(), "alice"); err != nil {
+		t.Errorf("MagnaScaleDriver.DeleteLocalUser() error = %v", err)
+	}
+}
+
+func TestMagnaScaleDriver_UpdateLocalUser(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addUser("alice", false)
+	server.users[0].Locked = true
+
+	enabled := false
+	d := server.newDriver()
+	if err := d.UpdateLocalUser(server.context(), "alice", common.LocalUserUpdate{Password: "N3wPassw0rd", Disabled: &enabled, Unlock: true}); err != nil {
+		t.Fatalf("MagnaScaleDriver.UpdateLocalUser() error = %v", err)
+	}
+
+	gotDetail, err := d.GetLocalUserDetail(server.context(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDetail := common.LocalUserDetail{Name: "alice", UID: "2001", Status: "OK", IsPasswordRequired: true}
+	if !reflect.DeepEqual(gotDetail, wantDetail) {
+		t.Errorf("MagnaScaleDriver.UpdateLocalUser() = %v, want %v", gotDetail, wantDetail)
+	}
+	if password := server.users[0].Password; password != "N3wPassw0rd" {
+		t.Errorf("MagnaScaleDriver.UpdateLocalUser() password = %q", password)
+	}
+}
+
+func TestMagnaScaleDriver_SessionToken(t *testing.T) {
+	server := newFakeMagnaScaleServer(t)
+	server.addDirectory("data")
+
+	// Creating a share gets the directory first, the second request uses the session token.
+	d := server.newDriver()
+	if err := d.CreateCIFSShare(server.context(), "data", "data", "", nil); err != nil {
+		t.Errorf("MagnaScaleDriver.CreateCIFSShare() error = %v", err)
+		return
+	}
+
+	if got, want := server.AuthSchemes(), []string{"Basic", "Bearer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("MagnaScaleDriver authorization schemes = %v, want %v", got, want)
+	}
+}
+
+func TestMagnaScaleDriver_MountCIFSShare(t *testing.T) {
+	d := &MagnaScaleDriver{}
+	if err := d.MountCIFSShare(context.Background(), "/mnt/data", `\\192.168.0.10\data`, "alice", "Passw0rd"); !IsUnsupportedOperation(err) {
+		t.Errorf("MagnaScaleDriver.MountCIFSShare() error = %v, want an unsupported operation error", err)
+	}
+}
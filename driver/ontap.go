@@ -0,0 +1,801 @@
+package driver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/client"
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The interval to poll the state of the asynchronous ONTAP jobs.
+var ontapJobPollInterval = time.Second
+
+// OntapDriver manages the NetApp ONTAP cluster by the REST API.
+// The directories are the qtrees in the volume of the SVM specified by the configuration [ontap],
+// the CIFS shares and the local users are those of the CIFS server of the SVM.
+type OntapDriver struct {
+	config     HostConfig
+	restClient *client.RestClient
+}
+
+func init() {
+	Register("ontap", NewOntapDriver)
+}
+
+func NewOntapDriver(config HostConfig) (Driver, error) {
+	port := config.Port
+	if port == 0 {
+		port = common.Config.Ontap.Port
+	}
+	if port == 0 {
+		port = 443
+	}
+
+	hostContext := common.HostContext{IP: config.IP, Username: config.Username, Password: config.Password}
+
+	restClient := client.GetRestClient("https", hostContext, port, "api", "", "", true)
+	restClient.SetTLSConfig(&tls.Config{InsecureSkipVerify: config.InsecureSkipVerify || common.Config.Ontap.InsecureSkipVerify})
+	restClient.SetTimeout(30 * time.Second)
+
+	return &OntapDriver{config: config, restClient: restClient}, nil
+}
+
+func (d *OntapDriver) Capabilities() []Capability {
+	return []Capability{CapabilityDirectory, CapabilityCIFS, CapabilityLocalUser, CapabilityShareAccess}
+}
+
+type ontapReference struct {
+	Name string `json:"name,omitempty"`
+	UUID string `json:"uuid,omitempty"`
+}
+
+type ontapRecords[T any] struct {
+	Records    []T `json:"records"`
+	NumRecords int `json:"num_records"`
+}
+
+type ontapErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+		Code    string `json:"code"`
+		Target  string `json:"target"`
+	} `json:"error"`
+}
+
+type ontapJobLink struct {
+	UUID string `json:"uuid"`
+}
+
+type ontapJobResponse struct {
+	Job *ontapJobLink `json:"job"`
+}
+
+type ontapJob struct {
+	UUID    string `json:"uuid"`
+	State   string `json:"state"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type ontapCluster struct {
+	Name    string `json:"name"`
+	UUID    string `json:"uuid"`
+	Version struct {
+		Full       string `json:"full"`
+		Generation int    `json:"generation"`
+		Major      int    `json:"major"`
+		Minor      int    `json:"minor"`
+	} `json:"version"`
+}
+
+type ontapNode struct {
+	Name  string `json:"name"`
+	Model string `json:"model"`
+}
+
+type ontapQtree struct {
+	ID            int            `json:"id"`
+	Name          string         `json:"name"`
+	Path          string         `json:"path"`
+	SecurityStyle string         `json:"security_style,omitempty"`
+	SVM           ontapReference `json:"svm"`
+	Volume        ontapReference `json:"volume"`
+}
+
+type ontapCIFSShareACL struct {
+	UserOrGroup string `json:"user_or_group"`
+	Permission  string `json:"permission"`
+	Type        string `json:"type,omitempty"`
+}
+
+type ontapCIFSShare struct {
+	Name    string              `json:"name"`
+	Path    string              `json:"path"`
+	Comment string              `json:"comment,omitempty"`
+	SVM     ontapReference      `json:"svm"`
+	ACLs    []ontapCIFSShareACL `json:"acls,omitempty"`
+}
+
+type ontapCIFSLocalUser struct {
+	Name            string         `json:"name"`
+	SID             string         `json:"sid,omitempty"`
+	FullName        string         `json:"full_name,omitempty"`
+	Description     string         `json:"description,omitempty"`
+	Password        string         `json:"password,omitempty"`
+	AccountDisabled bool           `json:"account_disabled"`
+	SVM             ontapReference `json:"svm"`
+}
+
+func (d *OntapDriver) getRestClient(ctx context.Context) *client.RestClient {
+	return d.restClient.WithContext(ctx)
+}
+
+// getOntapError returns the error of the failed request with the message returned by ONTAP.
+func getOntapError(restClient *client.RestClient, response *http.Response, action string) error {
+	var result ontapErrorResponse
+	if err := restClient.GetResponseBody(response, &result); err != nil || result.Error.Message == "" {
+		return fmt.Errorf("failed to %s on ONTAP: %s", action, response.Status)
+	}
+
+	return fmt.Errorf("failed to %s on ONTAP: %s", action, result.Error.Message)
+}
+
+func (d *OntapDriver) get(ctx context.Context, restClient *client.RestClient, url string, result interface{}, action string) error {
+	response, err := restClient.Get(url)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return getOntapError(restClient, response, action)
+	}
+
+	return restClient.GetResponseBody(response, result)
+}
+
+// send sends the request which changes the configuration, and waits until the job is finished if ONTAP runs it asynchronously.
+func (d *OntapDriver) send(ctx context.Context, restClient *client.RestClient, method, url string, body interface{}, action string) error {
+	var response *http.Response
+
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	switch method {
+	case http.MethodPost:
+		response, err = restClient.Post(url, strings.NewReader(string(requestBody)))
+	case http.MethodPatch:
+		response, err = restClient.Patch(url, strings.NewReader(string(requestBody)))
+	case http.MethodDelete:
+		response, err = restClient.Delete(url)
+	default:
+		return fmt.Errorf("unsupported method %s", method)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusAccepted:
+	default:
+		return getOntapError(restClient, response, action)
+	}
+
+	var result ontapJobResponse
+	if err := restClient.GetResponseBody(response, &result); err != nil || result.Job == nil {
+		// The synchronous request may return no body.
+		return nil
+	}
+
+	return d.waitJob(ctx, restClient, result.Job.UUID, action)
+}
+
+func (d *OntapDriver) waitJob(ctx context.Context, restClient *client.RestClient, uuid, action string) error {
+	for {
+		var job ontapJob
+		if err := d.get(ctx, restClient, fmt.Sprintf("cluster/jobs/%s?fields=state,message,code", uuid), &job, action); err != nil {
+			return err
+		}
+
+		switch job.State {
+		case "success":
+			return nil
+		case "failure":
+			return fmt.Errorf("failed to %s on ONTAP: %s", action, job.Message)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ontapJobPollInterval):
+		}
+	}
+}
+
+func (d *OntapDriver) getSVM(ctx context.Context, restClient *client.RestClient) (svm ontapReference, err error) {
+	var result ontapRecords[ontapReference]
+
+	url := fmt.Sprintf("svm/svms?name=%s&fields=name,uuid", url.QueryEscape(common.Config.Ontap.SVM))
+	if err = d.get(ctx, restClient, url, &result, "get the SVM"); err != nil {
+		return svm, err
+	}
+
+	if len(result.Records) == 0 {
+		return svm, fmt.Errorf("the SVM %s does not exist on ONTAP", common.Config.Ontap.SVM)
+	}
+
+	return result.Records[0], nil
+}
+
+func (d *OntapDriver) getQtrees(ctx context.Context, restClient *client.RestClient, names []string) ([]ontapQtree, error) {
+	query := url.Values{}
+	query.Set("svm.name", common.Config.Ontap.SVM)
+	query.Set("volume.name", common.Config.Ontap.Volume)
+	query.Set("fields", "id,name,path,security_style,svm,volume")
+	if len(names) > 0 {
+		query.Set("name", strings.Join(names, "|"))
+	}
+
+	var result ontapRecords[ontapQtree]
+	if err := d.get(ctx, restClient, "storage/qtrees?"+query.Encode(), &result, "get the qtrees"); err != nil {
+		return nil, err
+	}
+
+	qtrees := make([]ontapQtree, 0, len(result.Records))
+	for _, qtree := range result.Records {
+		// The qtree 0 with empty name is the volume itself.
+		if qtree.Name != "" {
+			qtrees = append(qtrees, qtree)
+		}
+	}
+
+	return qtrees, nil
+}
+
+func (d *OntapDriver) getQtree(ctx context.Context, restClient *client.RestClient, name string) (qtree ontapQtree, err error) {
+	qtrees, err := d.getQtrees(ctx, restClient, []string{name})
+	if err != nil {
+		return qtree, err
+	}
+
+	if len(qtrees) == 0 {
+		return qtree, fmt.Errorf("the qtree %s does not exist in the volume %s", name, common.Config.Ontap.Volume)
+	}
+
+	return qtrees[0], nil
+}
+
+func toOntapDirectoryDetail(qtree ontapQtree) common.DirectoryDetail {
+	return common.DirectoryDetail{
+		Name:           qtree.Name,
+		Exist:          true,
+		FullPath:       qtree.Path,
+		ParentFullPath: path.Dir(qtree.Path),
+	}
+}
+
+func (d *OntapDriver) CreateDirectory(ctx context.Context, name string) (directoryDetails common.DirectoryDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := ontapQtree{
+		Name:   name,
+		SVM:    ontapReference{Name: common.Config.Ontap.SVM},
+		Volume: ontapReference{Name: common.Config.Ontap.Volume},
+	}
+
+	if err = d.send(ctx, restClient, http.MethodPost, "storage/qtrees", body, "create the qtree "+name); err != nil {
+		return directoryDetails, err
+	}
+
+	return d.GetDirectoryDetail(ctx, name)
+}
+
+func (d *OntapDriver) DeleteDirectory(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	qtree, err := d.getQtree(ctx, restClient, name)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("storage/qtrees/%s/%d", qtree.Volume.UUID, qtree.ID)
+
+	return d.send(ctx, restClient, http.MethodDelete, url, nil, "delete the qtree "+name)
+}
+
+// UpdateDirectory renames the qtree in the volume.
+func (d *OntapDriver) UpdateDirectory(ctx context.Context, name string, update common.DirectoryUpdate) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	qtree, err := d.getQtree(ctx, restClient, name)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("storage/qtrees/%s/%d", qtree.Volume.UUID, qtree.ID)
+	body := struct {
+		Name string `json:"name"`
+	}{
+		Name: update.NewName,
+	}
+
+	return d.send(ctx, restClient, http.MethodPatch, url, body, "rename the qtree "+name)
+}
+
+func (d *OntapDriver) GetDirectoryDetail(ctx context.Context, name string) (detail common.DirectoryDetail, err error) {
+	qtree, err := d.getQtree(ctx, d.getRestClient(ctx), name)
+	if err != nil {
+		detail.Name = name
+		detail.Exist = false
+		return detail, err
+	}
+
+	return toOntapDirectoryDetail(qtree), nil
+}
+
+func (d *OntapDriver) GetDirectoriesDetail(ctx context.Context, names []string) (detail []common.DirectoryDetail, err error) {
+	qtrees, err := d.getQtrees(ctx, d.getRestClient(ctx), names)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, qtree := range qtrees {
+		detail = append(detail, toOntapDirectoryDetail(qtree))
+	}
+
+	return detail, nil
+}
+
+// The permissions of the share ACLs on ONTAP for the access levels.
+var ontapSharePermissions = map[string]string{
+	common.SharePermissionRead:   "read",
+	common.SharePermissionChange: "change",
+	common.SharePermissionFull:   "full_control",
+	common.SharePermissionDeny:   "no_access",
+}
+
+func (d *OntapDriver) CreateCIFSShare(ctx context.Context, name, directory_name, description string, access []common.ShareAccess) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	qtree, err := d.getQtree(ctx, restClient, directory_name)
+	if err != nil {
+		return err
+	}
+
+	body := ontapCIFSShare{
+		Name:    name,
+		Path:    qtree.Path,
+		Comment: description,
+		SVM:     ontapReference{Name: common.Config.Ontap.SVM},
+	}
+
+	for _, entry := range access {
+		body.ACLs = append(body.ACLs, ontapCIFSShareACL{UserOrGroup: entry.Principal(), Permission: ontapSharePermissions[entry.Permission], Type: "windows"})
+	}
+
+	return d.send(ctx, restClient, http.MethodPost, "protocols/cifs/shares", body, "create the CIFS share "+name)
+}
+
+func (d *OntapDriver) DeleteCIFSShare(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	svm, err := d.getSVM(ctx, restClient)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("protocols/cifs/shares/%s/%s", svm.UUID, url.PathEscape(name))
+
+	return d.send(ctx, restClient, http.MethodDelete, url, nil, "delete the CIFS share "+name)
+}
+
+func (d *OntapDriver) UpdateCIFSShare(ctx context.Context, name string, update common.ShareUpdate) (err error) {
+	if update.Description == nil {
+		return nil
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	svm, err := d.getSVM(ctx, restClient)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("protocols/cifs/shares/%s/%s", svm.UUID, url.PathEscape(name))
+	body := struct {
+		Comment string `json:"comment"`
+	}{
+		Comment: *update.Description,
+	}
+
+	return d.send(ctx, restClient, http.MethodPatch, url, body, "update the CIFS share "+name)
+}
+
+// getCIFSShareACLs returns the URL of the ACLs of the share and the ACLs of the Windows users and groups on it.
+func (d *OntapDriver) getCIFSShareACLs(ctx context.Context, restClient *client.RestClient, name string) (aclURL string, acls []ontapCIFSShareACL, err error) {
+	svm, err := d.getSVM(ctx, restClient)
+	if err != nil {
+		return aclURL, acls, err
+	}
+
+	aclURL = fmt.Sprintf("protocols/cifs/shares/%s/%s/acls", svm.UUID, url.PathEscape(name))
+
+	var result ontapRecords[ontapCIFSShareACL]
+	if err = d.get(ctx, restClient, aclURL+"?type=windows&fields=user_or_group,permission,type", &result, "get the ACLs of the CIFS share "+name); err != nil {
+		return aclURL, acls, err
+	}
+
+	return aclURL, result.Records, nil
+}
+
+// GrantCIFSShareAccess changes the permission of the ACL of the user or the group, or adds the ACL if it has none.
+func (d *OntapDriver) GrantCIFSShareAccess(ctx context.Context, name string, access []common.ShareAccess) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	aclURL, acls, err := d.getCIFSShareACLs(ctx, restClient, name)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range access {
+		acl := ontapCIFSShareACL{Permission: ontapSharePermissions[entry.Permission]}
+		action := fmt.Sprintf("grant the access to the CIFS share %s to %s", name, entry.Principal())
+
+		if index := findOntapCIFSShareACL(acls, entry.Principal()); index >= 0 {
+			aclPath := fmt.Sprintf("%s/%s/windows", aclURL, url.PathEscape(acls[index].UserOrGroup))
+			err = d.send(ctx, restClient, http.MethodPatch, aclPath, acl, action)
+		} else {
+			acl.UserOrGroup = entry.Principal()
+			acl.Type = "windows"
+			err = d.send(ctx, restClient, http.MethodPost, aclURL, acl, action)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokeCIFSShareAccess removes the ACLs of the users and the groups, the ones without ACL are skipped. The users and
+// the groups share the names of the ACLs.
+func (d *OntapDriver) RevokeCIFSShareAccess(ctx context.Context, name string, userNames, groupNames []string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	aclURL, acls, err := d.getCIFSShareACLs(ctx, restClient, name)
+	if err != nil {
+		return err
+	}
+
+	for _, accountName := range append(append([]string{}, userNames...), groupNames...) {
+		index := findOntapCIFSShareACL(acls, accountName)
+		if index < 0 {
+			continue
+		}
+
+		aclPath := fmt.Sprintf("%s/%s/windows", aclURL, url.PathEscape(acls[index].UserOrGroup))
+		if err = d.send(ctx, restClient, http.MethodDelete, aclPath, nil, fmt.Sprintf("revoke the access to the CIFS share %s from %s", name, accountName)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func findOntapCIFSShareACL(acls []ontapCIFSShareACL, accountName string) int {
+	for i, acl := range acls {
+		if strings.EqualFold(acl.UserOrGroup, accountName) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// GetCIFSSharesDetail returns the CIFS shares of the SVM, or all of them if no names are given.
+func (d *OntapDriver) GetCIFSSharesDetail(ctx context.Context, names []string) (detail []common.ShareDetail, err error) {
+	query := url.Values{}
+	query.Set("svm.name", common.Config.Ontap.SVM)
+	query.Set("fields", "name,path,comment")
+	if len(names) > 0 {
+		query.Set("name", strings.Join(names, "|"))
+	}
+
+	var result ontapRecords[ontapCIFSShare]
+	if err = d.get(ctx, d.getRestClient(ctx), "protocols/cifs/shares?"+query.Encode(), &result, "get the CIFS shares"); err != nil {
+		return detail, err
+	}
+
+	for _, share := range result.Records {
+		// The default administrative shares of the CIFS server are not managed by the engine.
+		switch strings.ToLower(share.Name) {
+		case "admin$", "c$", "ipc$":
+			continue
+		}
+
+		detail = append(detail, common.ShareDetail{
+			Name:          share.Name,
+			Description:   share.Comment,
+			DirectoryPath: share.Path,
+			State:         "online",
+		})
+	}
+
+	return detail, nil
+}
+
+func (d *OntapDriver) MountCIFSShare(ctx context.Context, mountPoint, sharePath, userName, password string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityMount}
+}
+
+func (d *OntapDriver) UnmountCIFSShare(ctx context.Context, mountPoint string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityMount}
+}
+
+func (d *OntapDriver) CreateNFSExport(ctx context.Context, directoryName string, clients []common.NFSClient) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityNFS}
+}
+
+func (d *OntapDriver) DeleteNFSExport(ctx context.Context, directoryName string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityNFS}
+}
+
+func (d *OntapDriver) GetNFSExportDetail(ctx context.Context, directoryName string) (detail common.NFSExportDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityNFS}
+}
+
+func (d *OntapDriver) GetNFSExportsDetail(ctx context.Context, directoryNames []string) (detail []common.NFSExportDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityNFS}
+}
+
+func (d *OntapDriver) GetDirectoryUsage(ctx context.Context, name string) (usage common.DirectoryUsage, err error) {
+	return usage, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityUsage}
+}
+
+func (d *OntapDriver) SetDirectoryQuota(ctx context.Context, name string, quota common.DirectoryQuota) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityQuota}
+}
+
+func (d *OntapDriver) ClearDirectoryQuota(ctx context.Context, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityQuota}
+}
+
+func (d *OntapDriver) GetDirectoryQuota(ctx context.Context, name string) (quota common.DirectoryQuota, err error) {
+	return quota, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityQuota}
+}
+
+func (d *OntapDriver) GetDirectoryACL(ctx context.Context, name string) (acl common.DirectoryACL, err error) {
+	return acl, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityACL}
+}
+
+func (d *OntapDriver) SetDirectoryACL(ctx context.Context, name string, acl common.DirectoryACL) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityACL}
+}
+
+// getOntapLocalUserName removes the CIFS server name from the local user name, e.g. "CIFS01\alice" to "alice".
+func getOntapLocalUserName(name string) string {
+	if index := strings.LastIndex(name, `\`); index >= 0 {
+		return name[index+1:]
+	}
+
+	return name
+}
+
+func toOntapLocalUserDetail(user ontapCIFSLocalUser) common.LocalUserDetail {
+	detail := common.LocalUserDetail{
+		Name:               getOntapLocalUserName(user.Name),
+		UID:                user.SID,
+		FullName:           user.FullName,
+		Description:        user.Description,
+		Status:             "OK",
+		IsPasswordRequired: true,
+		IsDisabled:         user.AccountDisabled,
+	}
+
+	if detail.IsDisabled {
+		detail.Status = "Degraded"
+	}
+
+	return detail
+}
+
+func (d *OntapDriver) getLocalUsers(ctx context.Context, restClient *client.RestClient, names []string) ([]ontapCIFSLocalUser, error) {
+	query := url.Values{}
+	query.Set("svm.name", common.Config.Ontap.SVM)
+	query.Set("fields", "name,sid,full_name,description,account_disabled,svm")
+
+	var result ontapRecords[ontapCIFSLocalUser]
+	if err := d.get(ctx, restClient, "protocols/cifs/local-users?"+query.Encode(), &result, "get the CIFS local users"); err != nil {
+		return nil, err
+	}
+
+	// The names returned by ONTAP are prefixed by the CIFS server name, so they are filtered here.
+	if len(names) == 0 {
+		return result.Records, nil
+	}
+
+	users := make([]ontapCIFSLocalUser, 0, len(names))
+	for _, user := range result.Records {
+		for _, name := range names {
+			if getOntapLocalUserName(user.Name) == name {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+
+	return users, nil
+}
+
+func (d *OntapDriver) CreateLocalUser(ctx context.Context, name, password string) (localUserDetail common.LocalUserDetail, err error) {
+	restClient := d.getRestClient(ctx)
+
+	body := ontapCIFSLocalUser{
+		Name:     name,
+		Password: password,
+		SVM:      ontapReference{Name: common.Config.Ontap.SVM},
+	}
+
+	if err = d.send(ctx, restClient, http.MethodPost, "protocols/cifs/local-users", body, "create the CIFS local user "+name); err != nil {
+		localUserDetail.Name = name
+		return localUserDetail, err
+	}
+
+	return d.GetLocalUserDetail(ctx, name)
+}
+
+func (d *OntapDriver) DeleteLocalUser(ctx context.Context, name string) (err error) {
+	restClient := d.getRestClient(ctx)
+
+	users, err := d.getLocalUsers(ctx, restClient, []string{name})
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		return fmt.Errorf("the CIFS local user %s does not exist", name)
+	}
+
+	url := fmt.Sprintf("protocols/cifs/local-users/%s/%s", users[0].SVM.UUID, users[0].SID)
+
+	return d.send(ctx, restClient, http.MethodDelete, url, nil, "delete the CIFS local user "+name)
+}
+
+// UpdateLocalUser resets the password and enables or disables the CIFS local user, ONTAP has no REST API to unlock it.
+func (d *OntapDriver) UpdateLocalUser(ctx context.Context, name string, update common.LocalUserUpdate) (err error) {
+	if update.Unlock {
+		return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityUnlockUser}
+	}
+
+	restClient := d.getRestClient(ctx)
+
+	users, err := d.getLocalUsers(ctx, restClient, []string{name})
+	if err != nil {
+		return err
+	}
+
+	if len(users) == 0 {
+		return fmt.Errorf("the CIFS local user %s does not exist", name)
+	}
+
+	url := fmt.Sprintf("protocols/cifs/local-users/%s/%s", users[0].SVM.UUID, users[0].SID)
+	body := struct {
+		Password        string `json:"password,omitempty"`
+		AccountDisabled *bool  `json:"account_disabled,omitempty"`
+	}{
+		Password:        update.Password,
+		AccountDisabled: update.Disabled,
+	}
+
+	return d.send(ctx, restClient, http.MethodPatch, url, body, "update the CIFS local user "+name)
+}
+
+func (d *OntapDriver) GetLocalUserDetail(ctx context.Context, name string) (detail common.LocalUserDetail, err error) {
+	users, err := d.getLocalUsers(ctx, d.getRestClient(ctx), []string{name})
+	if err != nil {
+		return detail, err
+	}
+
+	if len(users) == 0 {
+		return detail, fmt.Errorf("the CIFS local user %s does not exist", name)
+	}
+
+	return toOntapLocalUserDetail(users[0]), nil
+}
+
+func (d *OntapDriver) GetLocalUsersDetail(ctx context.Context, names []string) (detail []common.LocalUserDetail, err error) {
+	users, err := d.getLocalUsers(ctx, d.getRestClient(ctx), names)
+	if err != nil {
+		return detail, err
+	}
+
+	for _, user := range users {
+		detail = append(detail, toOntapLocalUserDetail(user))
+	}
+
+	return detail, nil
+}
+
+func (d *OntapDriver) CreateLocalGroup(ctx context.Context, name, description string) (detail common.LocalGroupDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityLocalGroup}
+}
+
+func (d *OntapDriver) DeleteLocalGroup(ctx context.Context, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityLocalGroup}
+}
+
+func (d *OntapDriver) AddLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityLocalGroup}
+}
+
+func (d *OntapDriver) RemoveLocalGroupMembers(ctx context.Context, name string, members []string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityLocalGroup}
+}
+
+func (d *OntapDriver) GetLocalGroupDetail(ctx context.Context, name string) (detail common.LocalGroupDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityLocalGroup}
+}
+
+func (d *OntapDriver) GetLocalGroupsDetail(ctx context.Context, names []string) (detail []common.LocalGroupDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityLocalGroup}
+}
+
+func (d *OntapDriver) CreateSnapshot(ctx context.Context, directoryName, name string) (detail common.SnapshotDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilitySnapshot}
+}
+
+func (d *OntapDriver) DeleteSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilitySnapshot}
+}
+
+func (d *OntapDriver) ListSnapshots(ctx context.Context, directoryName string) (detail []common.SnapshotDetail, err error) {
+	return detail, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilitySnapshot}
+}
+
+func (d *OntapDriver) RestoreSnapshot(ctx context.Context, directoryName, name string) (err error) {
+	return &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilitySnapshot}
+}
+
+func (d *OntapDriver) CreateReplicationSource(ctx context.Context, directoryName string) (source common.ReplicationSource, err error) {
+	return source, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityReplication}
+}
+
+func (d *OntapDriver) PullReplication(ctx context.Context, directoryName string, source common.ReplicationSource) (result common.ReplicationResult, err error) {
+	return result, &UnsupportedOperationError{StorageType: "ontap", Capability: CapabilityReplication}
+}
+
+func (d *OntapDriver) GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error) {
+	restClient := d.getRestClient(ctx)
+
+	var cluster ontapCluster
+	if err = d.get(ctx, restClient, "cluster?fields=name,uuid,version", &cluster, "get the cluster"); err != nil {
+		return systemInfo, err
+	}
+
+	var nodes ontapRecords[ontapNode]
+	if err = d.get(ctx, restClient, "cluster/nodes?fields=name,model", &nodes, "get the cluster nodes"); err != nil {
+		return systemInfo, err
+	}
+
+	systemInfo = common.SystemInfo{
+		ComputerName: cluster.Name,
+		Caption:      "NetApp ONTAP",
+		OSVersion:    fmt.Sprintf("%d.%d.%d", cluster.Version.Generation, cluster.Version.Major, cluster.Version.Minor),
+		BuildNumber:  cluster.Version.Full,
+	}
+
+	if len(nodes.Records) > 0 {
+		systemInfo.OSArchitecture = nodes.Records[0].Model
+	}
+
+	return systemInfo, nil
+}
@@ -0,0 +1,1057 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+const (
+	testOntapUsername   = "admin"
+	testOntapPassword   = "Passw0rd"
+	testOntapSVM        = "svm0"
+	testOntapSVMUUID    = "3b5d3c4a-8a4e-11ee-9c5e-005056bb1234"
+	testOntapVolume     = "dme"
+	testOntapVolumeUUID = "7f2b11c8-8a4e-11ee-9c5e-005056bb1234"
+	testOntapCIFSServer = "CIFS01"
+)
+
+// fakeOntapServer serves the subset of the ONTAP REST API used by OntapDriver, the state is kept in memory.
+type fakeOntapServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	qtrees  []ontapQtree
+	shares  []ontapCIFSShare
+	users   []ontapCIFSLocalUser
+	nextID  int
+	nextSID int
+	// The requests received in the format of "METHOD /path", the queries are not included.
+	requests []string
+}
+
+func newFakeOntapServer(t *testing.T) *fakeOntapServer {
+	server := &fakeOntapServer{nextID: 1, nextSID: 1001}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/cluster", server.handleCluster)
+	mux.HandleFunc("/api/cluster/nodes", server.handleNodes)
+	mux.HandleFunc("/api/cluster/jobs/", server.handleJob)
+	mux.HandleFunc("/api/svm/svms", server.handleSVMs)
+	mux.HandleFunc("/api/storage/qtrees", server.handleQtrees)
+	mux.HandleFunc("/api/storage/qtrees/", server.handleQtree)
+	mux.HandleFunc("/api/protocols/cifs/shares", server.handleShares)
+	mux.HandleFunc("/api/protocols/cifs/shares/", server.handleShare)
+	mux.HandleFunc("/api/protocols/cifs/local-users", server.handleLocalUsers)
+	mux.HandleFunc("/api/protocols/cifs/local-users/", server.handleLocalUser)
+
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		server.requests = append(server.requests, r.Method+" "+r.URL.Path)
+		server.mu.Unlock()
+
+		if username, password, ok := r.BasicAuth(); !ok || username != testOntapUsername || password != testOntapPassword {
+			writeOntapError(w, http.StatusUnauthorized, "6691623", "User is not authorized.")
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	// Point the driver to the fake server.
+	config := common.Config.Ontap
+	t.Cleanup(func() { common.Config.Ontap = config })
+
+	common.Config.Ontap = common.OntapConfig{SVM: testOntapSVM, Volume: testOntapVolume}
+
+	interval := ontapJobPollInterval
+	ontapJobPollInterval = time.Millisecond
+	t.Cleanup(func() { ontapJobPollInterval = interval })
+
+	return server
+}
+
+func (s *fakeOntapServer) context() context.Context {
+	return context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "test-trace-id")
+}
+
+// newDriver returns the driver of the fake server which logins with the password.
+func (s *fakeOntapServer) newDriver(password string) *OntapDriver {
+	serverURL, _ := url.Parse(s.URL)
+	port, _ := strconv.Atoi(serverURL.Port())
+
+	driver, _ := NewOntapDriver(HostConfig{
+		StorageType:        "ontap",
+		IP:                 serverURL.Hostname(),
+		Username:           testOntapUsername,
+		Password:           password,
+		Port:               port,
+		InsecureSkipVerify: true,
+	})
+
+	return driver.(*OntapDriver)
+}
+
+func (s *fakeOntapServer) addQtree(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.qtrees = append(s.qtrees, ontapQtree{
+		ID:     s.nextID,
+		Name:   name,
+		Path:   fmt.Sprintf("/%s/%s", testOntapVolume, name),
+		SVM:    ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID},
+		Volume: ontapReference{Name: testOntapVolume, UUID: testOntapVolumeUUID},
+	})
+	s.nextID++
+}
+
+func (s *fakeOntapServer) addLocalUser(name string, disabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = append(s.users, ontapCIFSLocalUser{
+		Name:            testOntapCIFSServer + `\` + name,
+		SID:             fmt.Sprintf("S-1-5-21-256008430-3394229847-3930036330-%d", s.nextSID),
+		FullName:        name,
+		AccountDisabled: disabled,
+		SVM:             ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID},
+	})
+	s.nextSID++
+}
+
+func (s *fakeOntapServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+func writeOntapJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/hal+json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeOntapError(w http.ResponseWriter, statusCode int, code, message string) {
+	var body ontapErrorResponse
+	body.Error.Code = code
+	body.Error.Message = message
+
+	writeOntapJSON(w, statusCode, body)
+}
+
+// writeOntapJob answers the request which ONTAP runs asynchronously, the job is always finished successfully.
+func writeOntapJob(w http.ResponseWriter) {
+	writeOntapJSON(w, http.StatusAccepted, ontapJobResponse{Job: &ontapJobLink{UUID: "b7a4d5f6-8a4e-11ee-9c5e-005056bb1234"}})
+}
+
+func containsString(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOntapName matches the name by the ONTAP query like "a|b", all names are matched if the query is empty.
+func matchOntapName(query, name string) bool {
+	return query == "" || containsString(strings.Split(query, "|"), name)
+}
+
+func (s *fakeOntapServer) handleCluster(w http.ResponseWriter, r *http.Request) {
+	writeOntapJSON(w, http.StatusOK, map[string]interface{}{
+		"name": "cluster1",
+		"uuid": "1cd8a442-86d1-11e0-ae1c-123478563412",
+		"version": map[string]interface{}{
+			"full":       "NetApp Release 9.13.1: Tue Jul 25 10:19:28 UTC 2023",
+			"generation": 9,
+			"major":      13,
+			"minor":      1,
+		},
+	})
+}
+
+func (s *fakeOntapServer) handleNodes(w http.ResponseWriter, r *http.Request) {
+	writeOntapJSON(w, http.StatusOK, ontapRecords[ontapNode]{
+		Records:    []ontapNode{{Name: "cluster1-01", Model: "FAS8700"}, {Name: "cluster1-02", Model: "FAS8700"}},
+		NumRecords: 2,
+	})
+}
+
+func (s *fakeOntapServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	writeOntapJSON(w, http.StatusOK, ontapJob{UUID: strings.TrimPrefix(r.URL.Path, "/api/cluster/jobs/"), State: "success", Code: 0})
+}
+
+func (s *fakeOntapServer) handleSVMs(w http.ResponseWriter, r *http.Request) {
+	result := ontapRecords[ontapReference]{Records: []ontapReference{}}
+	if matchOntapName(r.URL.Query().Get("name"), testOntapSVM) {
+		result.Records = append(result.Records, ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID})
+	}
+	result.NumRecords = len(result.Records)
+
+	writeOntapJSON(w, http.StatusOK, result)
+}
+
+func (s *fakeOntapServer) handleQtrees(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		query := r.URL.Query()
+		result := ontapRecords[ontapQtree]{Records: []ontapQtree{}}
+		if query.Get("volume.name") == testOntapVolume && query.Get("svm.name") == testOntapSVM {
+			// The qtree 0 represents the volume itself.
+			if query.Get("name") == "" {
+				result.Records = append(result.Records, ontapQtree{ID: 0, Path: "/" + testOntapVolume, Volume: ontapReference{Name: testOntapVolume, UUID: testOntapVolumeUUID}})
+			}
+			for _, qtree := range s.qtrees {
+				if matchOntapName(query.Get("name"), qtree.Name) {
+					result.Records = append(result.Records, qtree)
+				}
+			}
+		}
+		result.NumRecords = len(result.Records)
+
+		writeOntapJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var qtree ontapQtree
+		if err := json.NewDecoder(r.Body).Decode(&qtree); err != nil {
+			writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+			return
+		}
+
+		if qtree.SVM.Name != testOntapSVM || qtree.Volume.Name != testOntapVolume {
+			writeOntapError(w, http.StatusBadRequest, "917927", "The specified volume was not found.")
+			return
+		}
+
+		s.mu.Lock()
+		for _, existing := range s.qtrees {
+			if existing.Name == qtree.Name {
+				s.mu.Unlock()
+				writeOntapError(w, http.StatusConflict, "5242887", fmt.Sprintf("Qtree \"%s\" already exists.", qtree.Name))
+				return
+			}
+		}
+		s.mu.Unlock()
+
+		s.addQtree(qtree.Name)
+		writeOntapJob(w)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeOntapServer) handleQtree(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, qtree := range s.qtrees {
+		if r.URL.Path != fmt.Sprintf("/api/storage/qtrees/%s/%d", qtree.Volume.UUID, qtree.ID) {
+			continue
+		}
+
+		if r.Method == http.MethodPatch {
+			var update ontapQtree
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+				return
+			}
+			s.qtrees[i].Name = update.Name
+			s.qtrees[i].Path = fmt.Sprintf("/%s/%s", testOntapVolume, update.Name)
+		} else {
+			s.qtrees = append(s.qtrees[:i], s.qtrees[i+1:]...)
+		}
+
+		writeOntapJob(w)
+		return
+	}
+
+	writeOntapError(w, http.StatusNotFound, "4", "entry doesn't exist")
+}
+
+func (s *fakeOntapServer) handleShares(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		query := r.URL.Query()
+		result := ontapRecords[ontapCIFSShare]{Records: []ontapCIFSShare{}}
+		for _, share := range s.shares {
+			if query.Get("svm.name") == testOntapSVM && matchOntapName(query.Get("name"), share.Name) {
+				result.Records = append(result.Records, share)
+			}
+		}
+		result.NumRecords = len(result.Records)
+
+		writeOntapJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var share ontapCIFSShare
+		if err := json.NewDecoder(r.Body).Decode(&share); err != nil {
+			writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for _, existing := range s.shares {
+			if strings.EqualFold(existing.Name, share.Name) {
+				writeOntapError(w, http.StatusConflict, "655399", fmt.Sprintf("Share \"%s\" already exists.", share.Name))
+				return
+			}
+		}
+
+		share.SVM.UUID = testOntapSVMUUID
+		s.shares = append(s.shares, share)
+
+		writeOntapJSON(w, http.StatusCreated, struct{}{})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleShare serves the share in the path "{svm.uuid}/{name}", and its ACLs in "{svm.uuid}/{name}/acls[/{user}/{type}]".
+func (s *fakeOntapServer) handleShare(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/protocols/cifs/shares/"+testOntapSVMUUID+"/"), "/")
+
+	index := -1
+	for i, share := range s.shares {
+		if share.Name == segments[0] {
+			index = i
+		}
+	}
+	if index < 0 {
+		writeOntapError(w, http.StatusNotFound, "4", "entry doesn't exist")
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		s.shares = append(s.shares[:index], s.shares[index+1:]...)
+		writeOntapJSON(w, http.StatusOK, struct{}{})
+	case len(segments) == 1 && r.Method == http.MethodPatch:
+		var share ontapCIFSShare
+		if err := json.NewDecoder(r.Body).Decode(&share); err != nil {
+			writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+			return
+		}
+
+		s.shares[index].Comment = share.Comment
+		writeOntapJSON(w, http.StatusOK, struct{}{})
+	case len(segments) == 2 && r.Method == http.MethodGet:
+		result := ontapRecords[ontapCIFSShareACL]{Records: s.shares[index].ACLs, NumRecords: len(s.shares[index].ACLs)}
+		writeOntapJSON(w, http.StatusOK, result)
+	case len(segments) == 2 && r.Method == http.MethodPost:
+		var acl ontapCIFSShareACL
+		if err := json.NewDecoder(r.Body).Decode(&acl); err != nil {
+			writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+			return
+		}
+
+		s.shares[index].ACLs = append(s.shares[index].ACLs, acl)
+		writeOntapJSON(w, http.StatusCreated, struct{}{})
+	case len(segments) == 4:
+		acls := s.shares[index].ACLs
+		for i := range acls {
+			if acls[i].UserOrGroup != segments[2] || acls[i].Type != segments[3] {
+				continue
+			}
+
+			switch r.Method {
+			case http.MethodPatch:
+				var acl ontapCIFSShareACL
+				if err := json.NewDecoder(r.Body).Decode(&acl); err != nil {
+					writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+					return
+				}
+				acls[i].Permission = acl.Permission
+			case http.MethodDelete:
+				s.shares[index].ACLs = append(acls[:i], acls[i+1:]...)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			writeOntapJSON(w, http.StatusOK, struct{}{})
+			return
+		}
+
+		writeOntapError(w, http.StatusNotFound, "4", "entry doesn't exist")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeOntapServer) handleLocalUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		result := ontapRecords[ontapCIFSLocalUser]{Records: []ontapCIFSLocalUser{}}
+		if r.URL.Query().Get("svm.name") == testOntapSVM {
+			result.Records = append(result.Records, s.users...)
+		}
+		result.NumRecords = len(result.Records)
+
+		writeOntapJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		var user ontapCIFSLocalUser
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+			return
+		}
+
+		if user.Password == "" {
+			writeOntapError(w, http.StatusBadRequest, "655628", "Password is required.")
+			return
+		}
+
+		s.addLocalUser(user.Name, false)
+		writeOntapJSON(w, http.StatusCreated, struct{}{})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *fakeOntapServer) handleLocalUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPatch {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, user := range s.users {
+		if r.URL.Path != fmt.Sprintf("/api/protocols/cifs/local-users/%s/%s", testOntapSVMUUID, user.SID) {
+			continue
+		}
+
+		if r.Method == http.MethodPatch {
+			// The fields left out are not changed.
+			var update map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				writeOntapError(w, http.StatusBadRequest, "262179", err.Error())
+				return
+			}
+			if disabled, ok := update["account_disabled"].(bool); ok {
+				s.users[i].AccountDisabled = disabled
+			}
+			if password, ok := update["password"].(string); ok {
+				s.users[i].Password = password
+			}
+		} else {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+		}
+
+		writeOntapJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+
+	writeOntapError(w, http.StatusNotFound, "4", "entry doesn't exist")
+}
+
+func TestOntapDriver_GetSystemInfo(t *testing.T) {
+	server := newFakeOntapServer(t)
+
+	tests := []struct {
+		name           string
+		password       string
+		wantSystemInfo common.SystemInfo
+		wantErr        bool
+	}{
+		{
+			name:     "Get the cluster info",
+			password: testOntapPassword,
+			wantSystemInfo: common.SystemInfo{
+				ComputerName:   "cluster1",
+				Caption:        "NetApp ONTAP",
+				OSArchitecture: "FAS8700",
+				OSVersion:      "9.13.1",
+				BuildNumber:    "NetApp Release 9.13.1: Tue Jul 25 10:19:28 UTC 2023",
+			},
+		},
+		{
+			name:     "Wrong password",
+			password: "wrong",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(tt.password)
+			gotSystemInfo, err := d.GetSystemInfo(server.context())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.GetSystemInfo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotSystemInfo, tt.wantSystemInfo) {
+				t.Errorf("OntapDriver.GetSystemInfo() = %v, want %v", gotSystemInfo, tt.wantSystemInfo)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_CreateDirectory(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addQtree("existing")
+
+	tests := []struct {
+		name        string
+		dirName     string
+		wantDetail  common.DirectoryDetail
+		wantErr     bool
+		wantRequest string
+	}{
+		{
+			name:        "Create a qtree",
+			dirName:     "data",
+			wantDetail:  common.DirectoryDetail{Name: "data", Exist: true, FullPath: "/dme/data", ParentFullPath: "/dme"},
+			wantRequest: "POST /api/storage/qtrees",
+		},
+		{
+			name:    "Qtree already exists",
+			dirName: "existing",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			gotDetail, err := d.CreateDirectory(server.context(), tt.dirName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.CreateDirectory() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("OntapDriver.CreateDirectory() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+			if tt.wantRequest != "" && !containsString(server.Requests(), tt.wantRequest) {
+				t.Errorf("OntapDriver.CreateDirectory() requests = %v, want %v", server.Requests(), tt.wantRequest)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_DeleteDirectory(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addQtree("data")
+
+	tests := []struct {
+		name    string
+		dirName string
+		wantErr bool
+	}{
+		{
+			name:    "Delete the qtree",
+			dirName: "data",
+		},
+		{
+			name:    "Qtree does not exist",
+			dirName: "data",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			if err := d.DeleteDirectory(server.context(), tt.dirName); (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.DeleteDirectory() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if !containsString(server.Requests(), fmt.Sprintf("DELETE /api/storage/qtrees/%s/1", testOntapVolumeUUID)) {
+		t.Errorf("OntapDriver.DeleteDirectory() requests = %v", server.Requests())
+	}
+}
+
+func TestOntapDriver_UpdateDirectory(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addQtree("data")
+
+	d := server.newDriver(testOntapPassword)
+	if err := d.UpdateDirectory(server.context(), "data", common.DirectoryUpdate{NewName: "archive"}); err != nil {
+		t.Fatalf("OntapDriver.UpdateDirectory() error = %v", err)
+	}
+	if err := d.UpdateDirectory(server.context(), "data", common.DirectoryUpdate{NewName: "archive"}); err == nil {
+		t.Errorf("OntapDriver.UpdateDirectory() renames the missing qtree without error")
+	}
+
+	detail, err := d.GetDirectoryDetail(server.context(), "archive")
+	if err != nil {
+		t.Fatalf("OntapDriver.GetDirectoryDetail() error = %v", err)
+	}
+	if detail.FullPath != "/"+testOntapVolume+"/archive" {
+		t.Errorf("OntapDriver.UpdateDirectory() path = %v", detail.FullPath)
+	}
+	if !containsString(server.Requests(), fmt.Sprintf("PATCH /api/storage/qtrees/%s/1", testOntapVolumeUUID)) {
+		t.Errorf("OntapDriver.UpdateDirectory() requests = %v", server.Requests())
+	}
+}
+
+func TestOntapDriver_GetDirectoriesDetail(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addQtree("data")
+	server.addQtree("logs")
+
+	tests := []struct {
+		name       string
+		names      []string
+		wantDetail []common.DirectoryDetail
+	}{
+		{
+			name:  "All qtrees without the volume itself",
+			names: nil,
+			wantDetail: []common.DirectoryDetail{
+				{Name: "data", Exist: true, FullPath: "/dme/data", ParentFullPath: "/dme"},
+				{Name: "logs", Exist: true, FullPath: "/dme/logs", ParentFullPath: "/dme"},
+			},
+		},
+		{
+			name:  "The qtrees by name",
+			names: []string{"logs", "missing"},
+			wantDetail: []common.DirectoryDetail{
+				{Name: "logs", Exist: true, FullPath: "/dme/logs", ParentFullPath: "/dme"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			gotDetail, err := d.GetDirectoriesDetail(server.context(), tt.names)
+			if err != nil {
+				t.Errorf("OntapDriver.GetDirectoriesDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("OntapDriver.GetDirectoriesDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_CreateCIFSShare(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addQtree("data")
+
+	tests := []struct {
+		name        string
+		shareName   string
+		dirName     string
+		description string
+		access      []common.ShareAccess
+		wantShare   ontapCIFSShare
+		wantErr     bool
+	}{
+		{
+			name:        "Create a share on the qtree",
+			shareName:   "data$",
+			dirName:     "data",
+			description: "Data share",
+			access: []common.ShareAccess{
+				{UserName: "alice", Permission: common.SharePermissionFull},
+				{UserName: "bob", Permission: common.SharePermissionRead},
+			},
+			wantShare: ontapCIFSShare{
+				Name:    "data$",
+				Path:    "/dme/data",
+				Comment: "Data share",
+				SVM:     ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID},
+				ACLs: []ontapCIFSShareACL{
+					{UserOrGroup: "alice", Permission: "full_control", Type: "windows"},
+					{UserOrGroup: "bob", Permission: "read", Type: "windows"},
+				},
+			},
+		},
+		{
+			name:      "Qtree does not exist",
+			shareName: "logs",
+			dirName:   "logs",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			err := d.CreateCIFSShare(server.context(), tt.shareName, tt.dirName, tt.description, tt.access)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.CreateCIFSShare() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(server.shares) != 1 || !reflect.DeepEqual(server.shares[0], tt.wantShare) {
+				t.Errorf("OntapDriver.CreateCIFSShare() shares = %v, want %v", server.shares, tt.wantShare)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_DeleteCIFSShare(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.shares = []ontapCIFSShare{{Name: "data", Path: "/dme/data", SVM: ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID}}}
+
+	tests := []struct {
+		name      string
+		shareName string
+		wantErr   bool
+	}{
+		{
+			name:      "Delete the share",
+			shareName: "data",
+		},
+		{
+			name:      "Share does not exist",
+			shareName: "data",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			if err := d.DeleteCIFSShare(server.context(), tt.shareName); (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.DeleteCIFSShare() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_UpdateCIFSShare(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.shares = []ontapCIFSShare{{Name: "data", Path: "/dme/data", Comment: "data", SVM: ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID}}}
+
+	d := server.newDriver(testOntapPassword)
+
+	// Nothing is sent if the description is not changed.
+	if err := d.UpdateCIFSShare(server.context(), "data", common.ShareUpdate{}); err != nil {
+		t.Fatalf("OntapDriver.UpdateCIFSShare() error = %v", err)
+	}
+	if len(server.Requests()) != 0 {
+		t.Errorf("OntapDriver.UpdateCIFSShare() requests = %v", server.Requests())
+	}
+
+	description := ""
+	if err := d.UpdateCIFSShare(server.context(), "data", common.ShareUpdate{Description: &description}); err != nil {
+		t.Fatalf("OntapDriver.UpdateCIFSShare() error = %v", err)
+	}
+	if comment := server.shares[0].Comment; comment != description {
+		t.Errorf("OntapDriver.UpdateCIFSShare() comment = %q, want %q", comment, description)
+	}
+
+	if err := d.UpdateCIFSShare(server.context(), "missing", common.ShareUpdate{Description: &description}); err == nil {
+		t.Errorf("OntapDriver.UpdateCIFSShare() updates the missing share without error")
+	}
+}
+
+func TestOntapDriver_GrantCIFSShareAccess(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.shares = []ontapCIFSShare{{
+		Name: "data",
+		Path: "/dme/data",
+		SVM:  ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID},
+		ACLs: []ontapCIFSShareACL{
+			{UserOrGroup: "Everyone", Permission: "full_control", Type: "windows"},
+			{UserOrGroup: `CIFS01\alice`, Permission: "read", Type: "windows"},
+		},
+	}}
+
+	d := server.newDriver(testOntapPassword)
+
+	// The ACL of alice is changed, and the one of bob is added.
+	access := []common.ShareAccess{
+		{UserName: `cifs01\ALICE`, Permission: common.SharePermissionChange},
+		{UserName: "bob", Permission: common.SharePermissionDeny},
+	}
+	if err := d.GrantCIFSShareAccess(server.context(), "data", access); err != nil {
+		t.Fatalf("OntapDriver.GrantCIFSShareAccess() error = %v", err)
+	}
+	// The users and the groups without ACL are skipped.
+	if err := d.RevokeCIFSShareAccess(server.context(), "data", []string{"carol"}, []string{"Everyone", "staff"}); err != nil {
+		t.Fatalf("OntapDriver.RevokeCIFSShareAccess() error = %v", err)
+	}
+	if err := d.GrantCIFSShareAccess(server.context(), "logs", access); err == nil {
+		t.Errorf("OntapDriver.GrantCIFSShareAccess() on a missing share returns no error")
+	}
+
+	wantACLs := []ontapCIFSShareACL{
+		{UserOrGroup: `CIFS01\alice`, Permission: "change", Type: "windows"},
+		{UserOrGroup: "bob", Permission: "no_access", Type: "windows"},
+	}
+	if !reflect.DeepEqual(server.shares[0].ACLs, wantACLs) {
+		t.Errorf("OntapDriver.GrantCIFSShareAccess() ACLs = %v, want %v", server.shares[0].ACLs, wantACLs)
+	}
+}
+
+func TestOntapDriver_GetCIFSSharesDetail(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.shares = []ontapCIFSShare{
+		{Name: "c$", Path: "/", SVM: ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID}},
+		{Name: "data", Path: "/dme/data", Comment: "Data share", SVM: ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID}},
+		{Name: "logs$", Path: "/dme/logs", SVM: ontapReference{Name: testOntapSVM, UUID: testOntapSVMUUID}},
+	}
+
+	data := common.ShareDetail{Name: "data", Description: "Data share", DirectoryPath: "/dme/data", State: "online"}
+	logs := common.ShareDetail{Name: "logs$", DirectoryPath: "/dme/logs", State: "online"}
+
+	tests := []struct {
+		name       string
+		names      []string
+		wantDetail []common.ShareDetail
+	}{
+		{
+			name:       "All shares except the administrative shares",
+			wantDetail: []common.ShareDetail{data, logs},
+		},
+		{
+			name:       "The shares by name",
+			names:      []string{"logs$"},
+			wantDetail: []common.ShareDetail{logs},
+		},
+		{
+			name:  "Share does not exist",
+			names: []string{"backup"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			gotDetail, err := d.GetCIFSSharesDetail(server.context(), tt.names)
+			if err != nil {
+				t.Errorf("OntapDriver.GetCIFSSharesDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("OntapDriver.GetCIFSSharesDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_CreateLocalUser(t *testing.T) {
+	server := newFakeOntapServer(t)
+
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		wantDetail common.LocalUserDetail
+		wantErr    bool
+	}{
+		{
+			name:     "Create a CIFS local user",
+			username: "alice",
+			password: "Passw0rd",
+			wantDetail: common.LocalUserDetail{
+				Name:               "alice",
+				UID:                "S-1-5-21-256008430-3394229847-3930036330-1001",
+				FullName:           "alice",
+				Status:             "OK",
+				IsPasswordRequired: true,
+			},
+		},
+		{
+			name:       "Password is required",
+			username:   "bob",
+			wantDetail: common.LocalUserDetail{Name: "bob"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			gotDetail, err := d.CreateLocalUser(server.context(), tt.username, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.CreateLocalUser() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("OntapDriver.CreateLocalUser() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_DeleteLocalUser(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addLocalUser("alice", false)
+
+	tests := []struct {
+		name     string
+		username string
+		wantErr  bool
+	}{
+		{
+			name:     "Delete the CIFS local user",
+			username: "alice",
+		},
+		{
+			name:     "User does not exist",
+			username: "alice",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			if err := d.DeleteLocalUser(server.context(), tt.username); (err != nil) != tt.wantErr {
+				t.Errorf("OntapDriver.DeleteLocalUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_UpdateLocalUser(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addLocalUser("alice", false)
+
+	disabled := true
+
+	tests := []struct {
+		name         string
+		username     string
+		update       common.LocalUserUpdate
+		wantDisabled bool
+		wantErr      bool
+	}{
+		{
+			name:     "Reset the password",
+			username: "alice",
+			update:   common.LocalUserUpdate{Password: "N3wPassw0rd"},
+		},
+		{
+			name:         "Disable the CIFS local user",
+			username:     "alice",
+			update:       common.LocalUserUpdate{Disabled: &disabled},
+			wantDisabled: true,
+		},
+		{
+			name:         "Unlock is not supported",
+			username:     "alice",
+			update:       common.LocalUserUpdate{Unlock: true},
+			wantDisabled: true,
+			wantErr:      true,
+		},
+		{
+			name:     "User does not exist",
+			username: "bob",
+			update:   common.LocalUserUpdate{Disabled: &disabled},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			if err := d.UpdateLocalUser(server.context(), tt.username, tt.update); (err != nil) != tt.wantErr {
+				t.Fatalf("OntapDriver.UpdateLocalUser() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			detail, err := d.GetLocalUserDetail(server.context(), tt.username)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detail.IsDisabled != tt.wantDisabled {
+				t.Errorf("OntapDriver.UpdateLocalUser() disabled = %v, want %v", detail.IsDisabled, tt.wantDisabled)
+			}
+		})
+	}
+
+	if password := server.users[0].Password; password != "N3wPassw0rd" {
+		t.Errorf("OntapDriver.UpdateLocalUser() password = %q", password)
+	}
+}
+
+func TestOntapDriver_GetLocalUsersDetail(t *testing.T) {
+	server := newFakeOntapServer(t)
+	server.addLocalUser("alice", false)
+	server.addLocalUser("bob", true)
+
+	alice := common.LocalUserDetail{
+		Name:               "alice",
+		UID:                "S-1-5-21-256008430-3394229847-3930036330-1001",
+		FullName:           "alice",
+		Status:             "OK",
+		IsPasswordRequired: true,
+	}
+	bob := common.LocalUserDetail{
+		Name:               "bob",
+		UID:                "S-1-5-21-256008430-3394229847-3930036330-1002",
+		FullName:           "bob",
+		Status:             "Degraded",
+		IsPasswordRequired: true,
+		IsDisabled:         true,
+	}
+
+	tests := []struct {
+		name       string
+		names      []string
+		wantDetail []common.LocalUserDetail
+	}{
+		{
+			name:       "All CIFS local users",
+			wantDetail: []common.LocalUserDetail{alice, bob},
+		},
+		{
+			name:       "The users by name without the CIFS server name",
+			names:      []string{"bob"},
+			wantDetail: []common.LocalUserDetail{bob},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := server.newDriver(testOntapPassword)
+			gotDetail, err := d.GetLocalUsersDetail(server.context(), tt.names)
+			if err != nil {
+				t.Errorf("OntapDriver.GetLocalUsersDetail() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotDetail, tt.wantDetail) {
+				t.Errorf("OntapDriver.GetLocalUsersDetail() = %v, want %v", gotDetail, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestOntapDriver_CreateNFSExport(t *testing.T) {
+	server := newFakeOntapServer(t)
+
+	d := server.newDriver(testOntapPassword)
+	err := d.CreateNFSExport(server.context(), "data", []common.NFSClient{{Host: "*", Access: "rw", RootSquash: true}})
+	if !IsUnsupportedOperation(err) {
+		t.Errorf("OntapDriver.CreateNFSExport() error = %v, want an unsupported operation error", err)
+	}
+	if len(server.Requests()) != 0 {
+		t.Errorf("OntapDriver.CreateNFSExport() requests = %v, want none", server.Requests())
+	}
+}
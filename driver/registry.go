@@ -0,0 +1,103 @@
+package driver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// HostConfig is the connection settings of a registered host, the driver instance of the host is constructed from it.
+type HostConfig struct {
+	StorageType string
+	IP          string
+	Username    string
+	Password    string
+	// The scheme and the port of the management API, the empty scheme and 0 mean the defaults of the storage type.
+	Scheme string
+	Port   int
+	// Skip the verification of the server certificate, e.g. for the self-signed certificate of the storage.
+	InsecureSkipVerify bool
+	// The fingerprint of the certificate issued to the agent at the registration. The agent is connected by mutual TLS
+	// and its certificate is pinned to it, or by plain HTTP if it is empty, e.g. during the registration.
+	CertFingerprint string
+}
+
+// Factory constructs the driver instance of a host. It should not connect to the host, the connection is made on demand.
+type Factory func(config HostConfig) (Driver, error)
+
+type driverInstance struct {
+	config HostConfig
+	driver Driver
+}
+
+var (
+	registryMu sync.Mutex
+	factories  = make(map[string]Factory)
+	// The driver instances cached by the host IP.
+	instances = make(map[string]driverInstance)
+)
+
+// Register makes the driver available for the storage type. The drivers usually register themselves in init,
+// so that a driver out of this package can be linked in by importing its package for the side effect.
+// Register panics if it is called twice for the same storage type or the factory is nil.
+func Register(storageType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("driver: Register factory is nil")
+	}
+
+	if _, exist := factories[storageType]; exist {
+		panic("driver: Register called twice for storage type " + storageType)
+	}
+
+	factories[storageType] = factory
+}
+
+// StorageTypes returns the sorted storage types which have a registered driver.
+func StorageTypes() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	storageTypes := make([]string, 0, len(factories))
+	for storageType := range factories {
+		storageTypes = append(storageTypes, storageType)
+	}
+	sort.Strings(storageTypes)
+
+	return storageTypes
+}
+
+// GetDriver returns the driver instance of the host. The instance is cached and reused by the later calls,
+// it is constructed again if the connection settings of the host are changed.
+func GetDriver(config HostConfig) (Driver, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if instance, exist := instances[config.IP]; exist && instance.config == config {
+		return instance.driver, nil
+	}
+
+	factory, exist := factories[config.StorageType]
+	if !exist {
+		return nil, &UnsupportedOperationError{StorageType: config.StorageType}
+	}
+
+	driver, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the %s driver of the host %s: %w", config.StorageType, config.IP, err)
+	}
+
+	instances[config.IP] = driverInstance{config: config, driver: driver}
+
+	return driver, nil
+}
+
+// RemoveDriver drops the cached driver instance of the host, e.g. when the host is unregistered.
+func RemoveDriver(ip string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	delete(instances, ip)
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() of a registered storage type does not panic")
+		}
+	}()
+
+	Register("workstation", NewAgentDriver)
+}
+
+func TestStorageTypes(t *testing.T) {
+	if got, want := StorageTypes(), []string{"magnascale", "ontap", "workstation"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("StorageTypes() = %v, want %v", got, want)
+	}
+}
+
+func TestGetDriver(t *testing.T) {
+	config := HostConfig{StorageType: "workstation", IP: "192.168.0.20", Username: "admin", Password: "Passw0rd"}
+	t.Cleanup(func() { RemoveDriver(config.IP) })
+
+	first, err := GetDriver(config)
+	if err != nil {
+		t.Errorf("GetDriver() error = %v", err)
+		return
+	}
+
+	// The instance is cached for the host.
+	if second, _ := GetDriver(config); second != first {
+		t.Errorf("GetDriver() returns a new instance for the same host")
+	}
+
+	// The instance is constructed again once the settings of the host are changed.
+	changed := config
+	changed.Port = 18080
+	third, _ := GetDriver(changed)
+	if third == first {
+		t.Errorf("GetDriver() returns the cached instance after the settings are changed")
+	}
+	if got := third.(*AgentDriver).config; got != changed {
+		t.Errorf("GetDriver() config = %v, want %v", got, changed)
+	}
+
+	RemoveDriver(config.IP)
+	if fourth, _ := GetDriver(changed); fourth == third {
+		t.Errorf("GetDriver() returns the removed instance")
+	}
+
+	if _, err := GetDriver(HostConfig{StorageType: "unknown", IP: "192.168.0.21"}); !IsUnsupportedOperation(err) {
+		t.Errorf("GetDriver() error = %v, want an unsupported operation error", err)
+	}
+}
@@ -0,0 +1,103 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+// The types of the identities in the directory service.
+const (
+	TypeUser  = "user"
+	TypeGroup = "group"
+)
+
+var (
+	ErrNotFound      = errors.New("the identity is not found in the directory service")
+	ErrNotConfigured = errors.New("no directory service is configured")
+)
+
+// Identity is a user or a group of the directory service, e.g. Active Directory.
+type Identity struct {
+	// The account name without the domain, e.g. alice.
+	Name string `json:"name"`
+	// The NetBIOS name of the domain, e.g. CORP.
+	Domain      string `json:"domain,omitempty"`
+	Type        string `json:"type"`
+	DisplayName string `json:"display_name,omitempty"`
+	// The SID of the Active Directory identities, or the UID or the GID of the POSIX ones.
+	ID string `json:"id,omitempty"`
+	DN string `json:"dn"`
+}
+
+// QualifiedName returns the name qualified by the domain, e.g. CORP\alice, which the hosts resolve by their domain.
+func (i Identity) QualifiedName() string {
+	if i.Domain == "" {
+		return i.Name
+	}
+
+	return i.Domain + `\` + i.Name
+}
+
+// Source resolves and searches the identities of a directory service. LDAP is the built-in implementation, another
+// service can be used by implementing the interface and calling SetSource at startup.
+type Source interface {
+	// Resolve returns the identity of the type by its account name, or ErrNotFound.
+	Resolve(ctx context.Context, name, identityType string) (Identity, error)
+	// Search returns at most limit users and groups whose account name or display name contains the query.
+	Search(ctx context.Context, query string, limit int) ([]Identity, error)
+}
+
+var (
+	sourceMu sync.Mutex
+	source   Source
+)
+
+// SetSource replaces the source of the identities.
+func SetSource(s Source) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	source = s
+}
+
+// GetSource returns the source of the identities. By default it is the LDAP server of the configuration [identity],
+// or ErrNotConfigured if its URL is empty.
+func GetSource() (Source, error) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	if source != nil {
+		return source, nil
+	}
+
+	if common.Config.Identity.URL == "" {
+		return nil, ErrNotConfigured
+	}
+
+	source = NewLDAPSource(common.Config.Identity)
+
+	return source, nil
+}
+
+// IsDomainName reports whether the name is qualified by a domain, e.g. CORP\alice or alice@corp.example.com, while
+// the names of the local users and groups are not.
+func IsDomainName(name string) bool {
+	return strings.Contains(name, `\`) || strings.Contains(name, "@")
+}
+
+// AccountName returns the account name without the domain, e.g. alice of CORP\alice or alice@corp.example.com.
+func AccountName(name string) string {
+	if _, account, found := strings.Cut(name, `\`); found {
+		return account
+	}
+
+	if account, _, found := strings.Cut(name, "@"); found {
+		return account
+	}
+
+	return name
+}
@@ -0,0 +1,172 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// The defaults of the configuration [identity], which suit Active Directory.
+const (
+	defaultNameAttribute    = "sAMAccountName"
+	defaultUserObjectClass  = "user"
+	defaultGroupObjectClass = "group"
+	defaultLDAPTimeout      = 10 * time.Second
+)
+
+// LDAPSource resolves the identities by searching the LDAP server, e.g. a domain controller of Active Directory.
+// It connects and binds for every call, so that it does not keep the connections idle between the rare lookups.
+type LDAPSource struct {
+	config common.IdentityConfig
+}
+
+func NewLDAPSource(config common.IdentityConfig) *LDAPSource {
+	if config.NameAttribute == "" {
+		config.NameAttribute = defaultNameAttribute
+	}
+	if config.UserObjectClass == "" {
+		config.UserObjectClass = defaultUserObjectClass
+	}
+	if config.GroupObjectClass == "" {
+		config.GroupObjectClass = defaultGroupObjectClass
+	}
+
+	return &LDAPSource{config: config}
+}
+
+// connect dials the LDAP server and binds by the configured DN, the connection is anonymous if no DN is configured.
+func (s *LDAPSource) connect(ctx context.Context) (*ldap.Conn, error) {
+	timeout := defaultLDAPTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	conn, err := ldap.DialURL(s.config.URL, ldap.DialWithTLSConfig(&tls.Config{InsecureSkipVerify: s.config.InsecureSkipVerify}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect the LDAP server %s: %w", s.config.URL, err)
+	}
+	conn.SetTimeout(timeout)
+
+	if s.config.BindDN != "" {
+		if err = conn.Bind(s.config.BindDN, s.config.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to bind the LDAP server as %s: %w", s.config.BindDN, err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (s *LDAPSource) search(ctx context.Context, filter string, limit int) ([]Identity, error) {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	attributes := []string{"objectClass", s.config.NameAttribute, "displayName", "objectSid", "uidNumber", "gidNumber"}
+	request := ldap.NewSearchRequest(s.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, limit, 0, false, filter, attributes, nil)
+
+	// The entries found before the size limit is exceeded are still returned.
+	result, err := conn.Search(request)
+	if err != nil && !(ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) && result != nil) {
+		return nil, fmt.Errorf("failed to search the LDAP server by %s: %w", filter, err)
+	}
+
+	identities := make([]Identity, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		identities = append(identities, s.toIdentity(entry))
+	}
+
+	return identities, nil
+}
+
+func (s *LDAPSource) toIdentity(entry *ldap.Entry) Identity {
+	identity := Identity{
+		Name:        entry.GetAttributeValue(s.config.NameAttribute),
+		Domain:      s.config.Domain,
+		Type:        TypeUser,
+		DisplayName: entry.GetAttributeValue("displayName"),
+		DN:          entry.DN,
+	}
+
+	for _, objectClass := range entry.GetAttributeValues("objectClass") {
+		if strings.EqualFold(objectClass, s.config.GroupObjectClass) {
+			identity.Type = TypeGroup
+			break
+		}
+	}
+
+	if sid := entry.GetRawAttributeValue("objectSid"); len(sid) > 0 {
+		identity.ID = decodeSID(sid)
+	} else if identity.Type == TypeGroup {
+		identity.ID = entry.GetAttributeValue("gidNumber")
+	} else {
+		identity.ID = entry.GetAttributeValue("uidNumber")
+	}
+
+	return identity
+}
+
+func (s *LDAPSource) objectClass(identityType string) string {
+	if identityType == TypeGroup {
+		return s.config.GroupObjectClass
+	}
+
+	return s.config.UserObjectClass
+}
+
+func (s *LDAPSource) Resolve(ctx context.Context, name, identityType string) (identity Identity, err error) {
+	filter := fmt.Sprintf("(&(objectClass=%s)(%s=%s))", ldap.EscapeFilter(s.objectClass(identityType)), s.config.NameAttribute, ldap.EscapeFilter(name))
+
+	identities, err := s.search(ctx, filter, 1)
+	if err != nil {
+		return identity, err
+	}
+
+	if len(identities) == 0 {
+		return identity, fmt.Errorf("%w: the %s %s", ErrNotFound, identityType, name)
+	}
+
+	return identities[0], nil
+}
+
+func (s *LDAPSource) Search(ctx context.Context, query string, limit int) ([]Identity, error) {
+	objectClasses := fmt.Sprintf("(|(objectClass=%s)(objectClass=%s))", ldap.EscapeFilter(s.config.UserObjectClass), ldap.EscapeFilter(s.config.GroupObjectClass))
+
+	filter := fmt.Sprintf("(&%s(%s=*))", objectClasses, s.config.NameAttribute)
+	if query != "" {
+		escaped := ldap.EscapeFilter(query)
+		filter = fmt.Sprintf("(&%s(|(%s=*%s*)(displayName=*%s*)))", objectClasses, s.config.NameAttribute, escaped, escaped)
+	}
+
+	return s.search(ctx, filter, limit)
+}
+
+// decodeSID returns the string form of the binary SID, e.g. S-1-5-21-1004336348-1177238915-682003330-512.
+func decodeSID(sid []byte) string {
+	// The revision, the count of the sub-authorities, the 48-bit big-endian authority and the 32-bit little-endian
+	// sub-authorities.
+	if len(sid) < 8 || len(sid) != 8+4*int(sid[1]) {
+		return ""
+	}
+
+	var authority uint64
+	for _, b := range sid[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	parts := []string{"S", strconv.Itoa(int(sid[0])), strconv.FormatUint(authority, 10)}
+	for i := 0; i < int(sid[1]); i++ {
+		parts = append(parts, strconv.FormatUint(uint64(binary.LittleEndian.Uint32(sid[8+4*i:])), 10))
+	}
+
+	return strings.Join(parts, "-")
+}
@@ -0,0 +1,493 @@
+package identity
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+const (
+	testBindDN       = "CN=dme,CN=Users,DC=corp,DC=example,DC=com"
+	testBindPassword = "Passw0rd"
+	testBaseDN       = "DC=corp,DC=example,DC=com"
+)
+
+// The LDAP result codes and the tags of the protocol operations used by fakeLDAPServer.
+const (
+	ldapResultSuccess            = 0
+	ldapResultSizeLimitExceeded  = 4
+	ldapResultInvalidCredentials = 49
+
+	ldapBindRequest       = 0
+	ldapBindResponse      = 1
+	ldapUnbindRequest     = 2
+	ldapSearchRequest     = 3
+	ldapSearchResultEntry = 4
+	ldapSearchResultDone  = 5
+)
+
+type fakeLDAPEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+// fakeLDAPServer serves the subset of LDAPv3 used by LDAPSource, i.e. the simple bind and the search with the filters
+// and, or, not, equality, substrings and present.
+type fakeLDAPServer struct {
+	listener net.Listener
+	entries  []fakeLDAPEntry
+
+	mu sync.Mutex
+	// The number of the search requests received.
+	searches int
+}
+
+func newFakeLDAPServer(t *testing.T, entries ...fakeLDAPEntry) *fakeLDAPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := &fakeLDAPServer{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeLDAPServer) Searches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.searches
+}
+
+func (s *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		request, err := ber.ReadPacket(conn)
+		if err != nil || len(request.Children) < 2 {
+			return
+		}
+
+		messageID := request.Children[0].Value.(int64)
+		operation := request.Children[1]
+
+		switch operation.Tag {
+		case ldapBindRequest:
+			code := ldapResultSuccess
+			if operation.Children[1].Data.String() != testBindDN || operation.Children[2].Data.String() != testBindPassword {
+				code = ldapResultInvalidCredentials
+			}
+			conn.Write(ldapMessage(messageID, ldapResult(ldapBindResponse, code)))
+		case ldapSearchRequest:
+			s.mu.Lock()
+			s.searches++
+			s.mu.Unlock()
+
+			sizeLimit := int(operation.Children[3].Value.(int64))
+			filter := operation.Children[6]
+
+			code, found := ldapResultSuccess, 0
+			for _, entry := range s.entries {
+				if !matchFilter(filter, entry) {
+					continue
+				}
+				if sizeLimit > 0 && found == sizeLimit {
+					code = ldapResultSizeLimitExceeded
+					break
+				}
+				conn.Write(ldapMessage(messageID, ldapEntry(entry)))
+				found++
+			}
+			conn.Write(ldapMessage(messageID, ldapResult(ldapSearchResultDone, code)))
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+func ldapMessage(messageID int64, operation *ber.Packet) []byte {
+	message := ber.NewSequence("LDAP message")
+	message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "message ID"))
+	message.AppendChild(operation)
+
+	return message.Bytes()
+}
+
+func ldapResult(tag ber.Tag, code int) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "result code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnostic message"))
+
+	return result
+}
+
+func ldapEntry(entry fakeLDAPEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResultEntry, nil, "search result entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "object name"))
+
+	attributes := ber.NewSequence("attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.NewSequence("attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "value"))
+		}
+		attribute.AppendChild(set)
+
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+
+	return result
+}
+
+func (e fakeLDAPEntry) values(attribute string) []string {
+	for name, values := range e.attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+// matchFilter evaluates the filter in the form of RFC 4511, the values are compared case-insensitively.
+func matchFilter(filter *ber.Packet, entry fakeLDAPEntry) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !matchFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if matchFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return !matchFilter(filter.Children[0], entry)
+	case 3: // equality
+		for _, value := range entry.values(filter.Children[0].Data.String()) {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	case 4: // substrings
+		for _, value := range entry.values(filter.Children[0].Data.String()) {
+			if matchSubstrings(strings.ToLower(value), filter.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		return len(entry.values(filter.Data.String())) > 0
+	}
+
+	return false
+}
+
+func matchSubstrings(value string, substrings []*ber.Packet) bool {
+	for _, substring := range substrings {
+		part := strings.ToLower(substring.Data.String())
+
+		switch substring.Tag {
+		case 0: // initial
+			if !strings.HasPrefix(value, part) {
+				return false
+			}
+			value = value[len(part):]
+		case 1: // any
+			i := strings.Index(value, part)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(part):]
+		case 2: // final
+			if !strings.HasSuffix(value, part) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// encodeSID returns the binary form of the SID of the sub-authorities in the NT authority.
+func encodeSID(subAuthorities ...uint32) string {
+	sid := []byte{1, byte(len(subAuthorities)), 0, 0, 0, 0, 0, 5}
+	for _, subAuthority := range subAuthorities {
+		sid = binary.LittleEndian.AppendUint32(sid, subAuthority)
+	}
+
+	return string(sid)
+}
+
+func newTestDirectory(t *testing.T) *fakeLDAPServer {
+	return newFakeLDAPServer(t,
+		fakeLDAPEntry{
+			dn: "CN=Alice Smith,CN=Users," + testBaseDN,
+			attributes: map[string][]string{
+				"objectClass":    {"top", "person", "organizationalPerson", "user"},
+				"sAMAccountName": {"alice"},
+				"displayName":    {"Alice Smith"},
+				"objectSid":      {encodeSID(21, 1004336348, 1177238915, 682003330, 1105)},
+			},
+		},
+		fakeLDAPEntry{
+			dn: "CN=Bob Jones,CN=Users," + testBaseDN,
+			attributes: map[string][]string{
+				"objectClass":    {"top", "person", "organizationalPerson", "user"},
+				"sAMAccountName": {"bob"},
+				"displayName":    {"Bob Jones"},
+				"objectSid":      {encodeSID(21, 1004336348, 1177238915, 682003330, 1106)},
+			},
+		},
+		fakeLDAPEntry{
+			dn: "CN=Domain Admins,CN=Users," + testBaseDN,
+			attributes: map[string][]string{
+				"objectClass":    {"top", "group"},
+				"sAMAccountName": {"Domain Admins"},
+				"objectSid":      {encodeSID(21, 1004336348, 1177238915, 682003330, 512)},
+			},
+		},
+		fakeLDAPEntry{
+			dn: "CN=Smith Family,CN=Users," + testBaseDN,
+			attributes: map[string][]string{
+				"objectClass":    {"top", "group"},
+				"sAMAccountName": {"smith-family"},
+				"displayName":    {"Smith Family"},
+				"objectSid":      {encodeSID(21, 1004336348, 1177238915, 682003330, 1201)},
+			},
+		},
+	)
+}
+
+func newTestSource(server *fakeLDAPServer) *LDAPSource {
+	return NewLDAPSource(common.IdentityConfig{
+		URL:          server.URL(),
+		BindDN:       testBindDN,
+		BindPassword: testBindPassword,
+		BaseDN:       testBaseDN,
+		Domain:       "CORP",
+	})
+}
+
+func TestLDAPSourceResolve(t *testing.T) {
+	source := newTestSource(newTestDirectory(t))
+
+	user, err := source.Resolve(context.Background(), "ALICE", TypeUser)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	want := Identity{
+		Name:        "alice",
+		Domain:      "CORP",
+		Type:        TypeUser,
+		DisplayName: "Alice Smith",
+		ID:          "S-1-5-21-1004336348-1177238915-682003330-1105",
+		DN:          "CN=Alice Smith,CN=Users," + testBaseDN,
+	}
+	if user != want {
+		t.Errorf("Resolve() = %+v, want %+v", user, want)
+	}
+	if user.QualifiedName() != `CORP\alice` {
+		t.Errorf("QualifiedName() = %q, want %q", user.QualifiedName(), `CORP\alice`)
+	}
+
+	group, err := source.Resolve(context.Background(), "Domain Admins", TypeGroup)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if group.Type != TypeGroup || group.ID != "S-1-5-21-1004336348-1177238915-682003330-512" {
+		t.Errorf("Resolve() = %+v, want the group Domain Admins", group)
+	}
+}
+
+func TestLDAPSourceResolveNotFound(t *testing.T) {
+	source := newTestSource(newTestDirectory(t))
+
+	tests := []struct {
+		name         string
+		identityType string
+	}{
+		{"carol", TypeUser},
+		// The identity of the other type is not resolved.
+		{"Domain Admins", TypeUser},
+		{"alice", TypeGroup},
+		// The special characters are escaped rather than matching any identity.
+		{"*", TypeUser},
+	}
+
+	for _, tt := range tests {
+		if _, err := source.Resolve(context.Background(), tt.name, tt.identityType); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Resolve(%q, %q) error = %v, want ErrNotFound", tt.name, tt.identityType, err)
+		}
+	}
+}
+
+func TestLDAPSourceResolvePOSIX(t *testing.T) {
+	server := newFakeLDAPServer(t,
+		fakeLDAPEntry{
+			dn: "uid=alice,ou=people,dc=example,dc=com",
+			attributes: map[string][]string{
+				"objectClass": {"top", "inetOrgPerson", "posixAccount"},
+				"uid":         {"alice"},
+				"uidNumber":   {"10001"},
+			},
+		},
+		fakeLDAPEntry{
+			dn: "cn=engineers,ou=groups,dc=example,dc=com",
+			attributes: map[string][]string{
+				"objectClass": {"top", "posixGroup"},
+				"uid":         {"engineers"},
+				"gidNumber":   {"20001"},
+			},
+		},
+	)
+
+	source := NewLDAPSource(common.IdentityConfig{
+		URL:              server.URL(),
+		BindDN:           testBindDN,
+		BindPassword:     testBindPassword,
+		BaseDN:           "dc=example,dc=com",
+		NameAttribute:    "uid",
+		UserObjectClass:  "posixAccount",
+		GroupObjectClass: "posixGroup",
+	})
+
+	user, err := source.Resolve(context.Background(), "alice", TypeUser)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if user.ID != "10001" || user.QualifiedName() != "alice" {
+		t.Errorf("Resolve() = %+v, want the UID 10001 without domain", user)
+	}
+
+	group, err := source.Resolve(context.Background(), "engineers", TypeGroup)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if group.Type != TypeGroup || group.ID != "20001" {
+		t.Errorf("Resolve() = %+v, want the group of the GID 20001", group)
+	}
+}
+
+func TestLDAPSourceSearch(t *testing.T) {
+	source := newTestSource(newTestDirectory(t))
+
+	tests := []struct {
+		query string
+		limit int
+		want  []string
+	}{
+		// Both the account names and the display names are searched.
+		{"smith", 10, []string{"alice", "smith-family"}},
+		{"ADMIN", 10, []string{"Domain Admins"}},
+		{"carol", 10, []string{}},
+		{"", 10, []string{"alice", "bob", "Domain Admins", "smith-family"}},
+		// The identities found before the size limit is exceeded are returned.
+		{"", 2, []string{"alice", "bob"}},
+	}
+
+	for _, tt := range tests {
+		identities, err := source.Search(context.Background(), tt.query, tt.limit)
+		if err != nil {
+			t.Fatalf("Search(%q, %d) error = %v", tt.query, tt.limit, err)
+		}
+
+		names := make([]string, len(identities))
+		for i, identity := range identities {
+			names[i] = identity.Name
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Search(%q, %d) = %v, want %v", tt.query, tt.limit, names, tt.want)
+		}
+	}
+}
+
+func TestLDAPSourceBindFailure(t *testing.T) {
+	server := newTestDirectory(t)
+
+	source := newTestSource(server)
+	source.config.BindPassword = "wrong"
+
+	_, err := source.Resolve(context.Background(), "alice", TypeUser)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Resolve() error = %v, want the failure to bind", err)
+	}
+	if server.Searches() != 0 {
+		t.Errorf("searches = %d, want no search after the failure to bind", server.Searches())
+	}
+}
+
+func TestDecodeSID(t *testing.T) {
+	tests := []struct {
+		sid  []byte
+		want string
+	}{
+		{[]byte(encodeSID(21, 1004336348, 1177238915, 682003330, 512)), "S-1-5-21-1004336348-1177238915-682003330-512"},
+		{[]byte(encodeSID(32, 544)), "S-1-5-32-544"},
+		// The SID whose length does not match the count of the sub-authorities is invalid.
+		{[]byte(encodeSID(32, 544))[:11], ""},
+		{[]byte{1}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := decodeSID(tt.sid); got != tt.want {
+			t.Errorf("decodeSID(%v) = %q, want %q", tt.sid, got, tt.want)
+		}
+	}
+}
+
+func TestAccountName(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   bool
+		expected string
+	}{
+		{`CORP\alice`, true, "alice"},
+		{"alice@corp.example.com", true, "alice"},
+		{"alice", false, "alice"},
+	}
+
+	for _, tt := range tests {
+		if got := IsDomainName(tt.name); got != tt.domain {
+			t.Errorf("IsDomainName(%q) = %v, want %v", tt.name, got, tt.domain)
+		}
+		if got := AccountName(tt.name); got != tt.expected {
+			t.Errorf("AccountName(%q) = %q, want %q", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleReadOnly = "read-only"
+)
+
+const defaultAdminName = "admin"
+
+// roleLevels ranks the roles, a role is granted all the permissions of the lower ones.
+var roleLevels = map[string]int{
+	RoleReadOnly: 1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+var (
+	// ErrInvalidCredentials is returned if the account does not exist or the password is wrong.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrLastAdmin is returned on deleting the last account with the role admin.
+	ErrLastAdmin = errors.New("the last admin account cannot be deleted")
+)
+
+// IsValidRole reports whether the role is one of admin, operator and read-only.
+func IsValidRole(role string) bool {
+	_, exist := roleLevels[role]
+
+	return exist
+}
+
+// HasRole reports whether the role is granted the permissions of the required role.
+func HasRole(role, requiredRole string) bool {
+	level, exist := roleLevels[role]
+
+	return exist && level >= roleLevels[requiredRole]
+}
+
+type Account struct {
+	Name      string
+	Password  string
+	Role      string
+	CreatedAt time.Time
+}
+
+func (a *Account) Create(ctx context.Context) error {
+	if !IsValidRole(a.Role) {
+		return fmt.Errorf("invalid role %s", a.Role)
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(a.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash the password: %w", err)
+	}
+
+	account := db.Account{
+		Name:         a.Name,
+		PasswordHash: string(passwordHash),
+		Role:         a.Role,
+	}
+	if err = account.Save(engine); err != nil {
+		return err
+	}
+
+	a.Password = ""
+	a.CreatedAt = account.CreatedAt
+
+	return nil
+}
+
+func (a *Account) Delete(ctx context.Context) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	account := db.Account{Name: a.Name}
+	if err = account.Get(engine); err != nil {
+		return err
+	}
+
+	// Nobody is able to manage the accounts any more without an admin.
+	if account.Role == RoleAdmin {
+		accountList := db.AccountList{}
+		count, err := accountList.Count(engine, RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if count <= 1 {
+			return ErrLastAdmin
+		}
+	}
+
+	return account.Delete(engine)
+}
+
+// Authenticate verifies the password of the account, and gets the role of the account.
+func (a *Account) Authenticate(ctx context.Context) error {
+	// The empty name matches any account in the query.
+	if a.Name == "" {
+		return ErrInvalidCredentials
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	account := db.Account{Name: a.Name}
+	if err = account.Get(engine); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(a.Password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	a.Password = ""
+	a.Role = account.Role
+	a.CreatedAt = account.CreatedAt
+
+	return nil
+}
+
+type AccountList struct {
+	Accounts []Account
+}
+
+func (al *AccountList) Get(ctx context.Context, filter *common.QueryFilter) ([]Account, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	accountList := db.AccountList{}
+	if err = accountList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	for _, account := range accountList.Accounts {
+		al.Accounts = append(al.Accounts, Account{
+			Name:      account.Name,
+			Role:      account.Role,
+			CreatedAt: account.CreatedAt,
+		})
+	}
+
+	return al.Accounts, nil
+}
+
+// InitializeAccounts creates the account 'admin' with the configured password if there is no account,
+// so that the portal API is accessible on the first startup.
+func InitializeAccounts() error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	accountList := db.AccountList{}
+	count, err := accountList.Count(engine, "")
+	if err != nil || count > 0 {
+		return err
+	}
+
+	if common.Config.Auth.AdminPassword == "" {
+		return errors.New("no password is configured for the initial admin account")
+	}
+
+	admin := Account{
+		Name:     defaultAdminName,
+		Password: common.Config.Auth.AdminPassword,
+		Role:     RoleAdmin,
+	}
+
+	return admin.Create(context.Background())
+}
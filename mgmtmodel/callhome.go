@@ -0,0 +1,220 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+	"gorm.io/gorm"
+)
+
+const (
+	RegistrationStatePending    = "pending"
+	RegistrationStateRegistered = "registered"
+)
+
+const defaultHeartbeatInterval = 30 * time.Second
+
+// The storage type of the hosts which call home, only the agents call home.
+const callHomeStorageType = "workstation"
+
+var ErrHostNotPending = errors.New("the host is not pending for approval")
+
+// ErrHostRegistered is returned if the registered host calls home, the call home is not authenticated as the host,
+// so it must not change the host.
+var ErrHostRegistered = errors.New("the host is registered already")
+
+// HeartbeatInterval returns the interval between the heartbeats of the agents.
+func HeartbeatInterval() time.Duration {
+	if interval := time.Duration(common.Config.Scheduler.HeartbeatInterval) * time.Second; interval > 0 {
+		return interval
+	}
+
+	return defaultHeartbeatInterval
+}
+
+// hasRecentHeartbeat reports whether the heartbeats of the host arrive, i.e. the latest one is received within
+// two intervals, so that one lost heartbeat does not make the engine check the host.
+func hasRecentHeartbeat(host db.Host, now time.Time) bool {
+	return host.LastHeartbeatTime != nil && now.Sub(*host.LastHeartbeatTime) < 2*HeartbeatInterval()
+}
+
+// CallHome records the host whose agent called home with its system information. An unknown host is saved as pending
+// until it is approved, the system information and the status of a pending host are refreshed.
+// ErrHostRegistered is returned for a registered host, anyone with the bootstrap token may call home with its IP address.
+func (h *Host) CallHome(ctx context.Context, systemInfo common.SystemInfo, status common.AgentStatus) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	host := db.Host{IP: h.IP}
+	err = host.Get(engine)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		host = db.Host{
+			IP:                h.IP,
+			StorageType:       callHomeStorageType,
+			Port:              h.Port,
+			RegistrationState: RegistrationStatePending,
+		}
+		setSystemInfo(&host, systemInfo)
+		setAgentStatus(&host, status, now)
+		getHealthPolicy().apply(&host, now, nil)
+
+		if err := host.Save(engine); err != nil {
+			return fmt.Errorf("failed to save the host %s: %w", h.IP, err)
+		}
+	} else if err != nil {
+		return err
+	} else if host.RegistrationState != RegistrationStatePending {
+		return ErrHostRegistered
+	} else {
+		host.Port = h.Port
+		setSystemInfo(&host, systemInfo)
+		setAgentStatus(&host, status, now)
+		if err := host.Update(engine, "name", "os_type", "os_arch", "os_version", "build_number", "agent_version", "load", "uptime",
+			"last_heartbeat_time", "port"); err != nil {
+			return fmt.Errorf("failed to save the host %s: %w", h.IP, err)
+		}
+
+		if err := recordHeartbeatHealth(engine, &host, now); err != nil {
+			return err
+		}
+	}
+
+	common.DeepCopy(host, h)
+	h.Password = ""
+
+	return nil
+}
+
+// Heartbeat records the status of the host reported by its agent, and regards the host as connected.
+// gorm.ErrRecordNotFound is returned if the host is unknown, e.g. it is unregistered, so the agent calls home again.
+func (h *Host) Heartbeat(ctx context.Context, status common.AgentStatus) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: h.IP}
+	if err := host.Get(engine); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	setAgentStatus(&host, status, now)
+	if err := host.Update(engine, "agent_version", "load", "uptime", "last_heartbeat_time"); err != nil {
+		return fmt.Errorf("failed to save the heartbeat of the host %s: %w", h.IP, err)
+	}
+
+	if err := recordHeartbeatHealth(engine, &host, now); err != nil {
+		return err
+	}
+
+	common.DeepCopy(host, h)
+	h.Password = ""
+
+	return nil
+}
+
+// SendHeartbeatToken sends the heartbeat token to the agent of the registered host over mutual TLS, the certificate of
+// the agent is pinned at the enrollment. The registered host calls home after its agent restarts, and gets the token so.
+func (h *Host) SendHeartbeatToken(ctx context.Context, token string) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: h.IP}
+	if err := host.Get(engine); err != nil {
+		return err
+	}
+
+	if host.RegistrationState != RegistrationStateRegistered {
+		return fmt.Errorf("the host %s is not registered", h.IP)
+	}
+
+	common.DeepCopy(host, h)
+
+	hostDriver, err := driver.GetDriver(h.getHostConfig())
+	h.Password = ""
+	if err != nil {
+		return err
+	}
+
+	receiver, ok := hostDriver.(driver.HeartbeatTokenReceiver)
+	if !ok {
+		return fmt.Errorf("the host %s does not send the heartbeats", h.IP)
+	}
+
+	return receiver.SendHeartbeatToken(ctx, token, HeartbeatInterval())
+}
+
+// recordHeartbeatHealth applies the heartbeat as a successful health check. Only the change of the state is kept in the
+// history, so that the history is not flooded by the heartbeats.
+func recordHeartbeatHealth(engine *db.DatabaseEngine, host *db.Host, checkTime time.Time) error {
+	policy := getHealthPolicy()
+	state := host.HealthState
+
+	policy.apply(host, checkTime, nil)
+	if err := host.UpdateHealth(engine); err != nil {
+		return fmt.Errorf("failed to save the health state of the host %s: %w", host.IP, err)
+	}
+
+	if host.HealthState == state {
+		return nil
+	}
+
+	return saveHealthCheck(engine, host, checkTime, 0, nil, policy)
+}
+
+// Approve registers the pending host with the credentials of its agent, the agent is enrolled as the registration.
+func (h *Host) Approve(ctx context.Context) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: h.IP}
+	if err := host.Get(engine); err != nil {
+		return err
+	}
+
+	if host.RegistrationState != RegistrationStatePending {
+		return ErrHostNotPending
+	}
+
+	username, password := h.Username, h.Password
+	common.DeepCopy(host, h)
+	h.Username, h.Password = username, password
+
+	if err := h.connect(ctx); err != nil {
+		return err
+	}
+
+	common.DeepCopy(h, &host)
+
+	return host.Update(engine, "username", "password", "scheme", "port", "cert_fingerprint", "name", "os_type", "os_arch",
+		"os_version", "build_number", "connected", "health_state", "registration_state")
+}
+
+func setSystemInfo(host *db.Host, systemInfo common.SystemInfo) {
+	host.ComputerName = systemInfo.ComputerName
+	host.Caption = systemInfo.Caption
+	host.OSArchitecture = systemInfo.OSArchitecture
+	host.OSVersion = systemInfo.OSVersion
+	host.BuildNumber = systemInfo.BuildNumber
+}
+
+func setAgentStatus(host *db.Host, status common.AgentStatus, heartbeatTime time.Time) {
+	host.AgentVersion = status.AgentVersion
+	host.Load = status.Load
+	host.Uptime = status.Uptime
+	host.LastHeartbeatTime = &heartbeatTime
+}
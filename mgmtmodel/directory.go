@@ -3,13 +3,19 @@ package mgmtmodel
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/cryingmouse/data_management_engine/db"
 	"github.com/cryingmouse/data_management_engine/driver"
 	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 )
 
+// ErrDirectoryInUse is returned on renaming the directory which is shared, exported, snapshotted or replicated, the
+// shares, the exports, the snapshots and the replications would lose it.
+var ErrDirectoryInUse = errors.New("the directory is shared, exported, snapshotted or replicated")
+
 type Directory struct {
 	Name           string
 	HostIP         string
@@ -19,6 +25,16 @@ type Directory struct {
 	Exist          bool
 	FullPath       string
 	ParentFullPath string
+
+	SoftLimitBytes  int64
+	HardLimitBytes  int64
+	SoftLimitFiles  int64
+	HardLimitFiles  int64
+	UsedBytes       int64
+	UsedFiles       int64
+	LargestFiles    []common.FileUsage
+	AgeHistogram    []common.AgeBucket
+	UsageUpdateTime *time.Time
 }
 
 func (d *Directory) Create(ctx context.Context) (err error) {
@@ -32,14 +48,11 @@ func (d *Directory) Create(ctx context.Context) (err error) {
 	if err = host.Get(engine); err != nil {
 		return err
 	}
-	driver := driver.GetDriver(host.StorageType)
-
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityDirectory)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
+
 	directoryDetails, err := driver.CreateDirectory(ctx, d.Name)
 	if err != nil {
 		return err
@@ -73,18 +86,22 @@ func (d *Directory) Delete(ctx context.Context) (err error) {
 		return err
 	}
 
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityDirectory)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-	driver := driver.GetDriver(host.StorageType)
 	if err := driver.DeleteDirectory(ctx, d.Name); err != nil {
 		return err
 	}
 
+	if err := deleteDirectorySnapshots(engine, host.IP, d.Name); err != nil {
+		return err
+	}
+
+	if err := deleteDirectoryReplications(engine, host.IP, d.Name); err != nil {
+		return err
+	}
+
 	directory := db.Directory{
 		Name:   d.Name,
 		HostIP: host.IP,
@@ -111,6 +128,229 @@ func (d *Directory) Get(ctx context.Context) (*Directory, error) {
 	return d, nil
 }
 
+// Update renames the directory on its host, and saves the details of the directory by the new name.
+func (d *Directory) Update(ctx context.Context, update common.DirectoryUpdate) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	directory, hostDriver, err := d.getDirectoryDriver(engine, driver.CapabilityDirectory)
+	if err != nil {
+		return err
+	}
+
+	if inUse, err := isDirectoryInUse(engine, directory); err != nil {
+		return err
+	} else if inUse {
+		return ErrDirectoryInUse
+	}
+
+	if err = hostDriver.UpdateDirectory(ctx, d.Name, update); err != nil {
+		return err
+	}
+
+	// The directory is renamed already, so it is saved by the new name even if its details are not got.
+	directory.Name = update.NewName
+	if detail, err := hostDriver.GetDirectoryDetail(ctx, update.NewName); err == nil {
+		common.DeepCopy(detail, &directory)
+	}
+
+	if err = directory.Save(engine); err != nil {
+		return err
+	}
+
+	common.DeepCopy(directory, d)
+
+	return nil
+}
+
+// isDirectoryInUse reports whether the directory has any share, export, snapshot, snapshot policy or replication in the
+// database.
+func isDirectoryInUse(engine *db.DatabaseEngine, directory db.Directory) (bool, error) {
+	share := db.CIFSShare{HostIP: directory.HostIP, DirectoryName: directory.Name}
+	if err := share.Get(engine); err == nil {
+		return true, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	export := db.NFSExport{HostIP: directory.HostIP, DirectoryName: directory.Name}
+	if err := export.Get(engine); err == nil {
+		return true, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	snapshot := db.Snapshot{HostIP: directory.HostIP, DirectoryName: directory.Name}
+	if err := snapshot.Get(engine); err == nil {
+		return true, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	attachment := db.SnapshotPolicyDirectory{HostIP: directory.HostIP, DirectoryName: directory.Name}
+	if err := attachment.Get(engine); err == nil {
+		return true, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	for _, replication := range []db.Replication{
+		{SourceHostIP: directory.HostIP, SourceDirectoryName: directory.Name},
+		{DestinationHostIP: directory.HostIP, DestinationDirectoryName: directory.Name},
+	} {
+		if err := replication.Get(engine); err == nil {
+			return true, nil
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// getDirectoryDriver returns the managed directory and the driver of its host which supports the capability.
+func (d *Directory) getDirectoryDriver(engine *db.DatabaseEngine, capability driver.Capability) (directory db.Directory, hostDriver driver.Driver, err error) {
+	directory = db.Directory{Name: d.Name, HostIP: d.HostIP}
+	if err = directory.Get(engine); err != nil {
+		return directory, nil, err
+	}
+
+	host := db.Host{IP: d.HostIP}
+	if err = host.Get(engine); err != nil {
+		return directory, nil, err
+	}
+
+	hostDriver, err = getHostDriver(host, capability)
+
+	return directory, hostDriver, err
+}
+
+// SetQuota applies the quota limits of the directory on its host and saves them, the quota is cleared if no limit is set.
+func (d *Directory) SetQuota(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	directory, hostDriver, err := d.getDirectoryDriver(engine, driver.CapabilityQuota)
+	if err != nil {
+		return err
+	}
+
+	quota := common.DirectoryQuota{
+		SoftLimitBytes: d.SoftLimitBytes,
+		HardLimitBytes: d.HardLimitBytes,
+		SoftLimitFiles: d.SoftLimitFiles,
+		HardLimitFiles: d.HardLimitFiles,
+	}
+
+	if quota.HasLimit() {
+		err = hostDriver.SetDirectoryQuota(ctx, d.Name, quota)
+	} else {
+		err = hostDriver.ClearDirectoryQuota(ctx, d.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"soft_limit_bytes", "hard_limit_bytes", "soft_limit_files", "hard_limit_files"}
+
+	directory.SoftLimitBytes = quota.SoftLimitBytes
+	directory.HardLimitBytes = quota.HardLimitBytes
+	directory.SoftLimitFiles = quota.SoftLimitFiles
+	directory.HardLimitFiles = quota.HardLimitFiles
+
+	// The limits are set already, so the usage is left as it was if it cannot be refreshed.
+	if usage, err := hostDriver.GetDirectoryQuota(ctx, d.Name); err == nil {
+		setDirectoryUsage(&directory, usage, time.Now())
+		columns = append(columns, "used_bytes", "used_files", "usage_update_time")
+	}
+
+	if err = directory.Update(engine, columns...); err != nil {
+		return err
+	}
+
+	common.DeepCopy(directory, d)
+
+	return nil
+}
+
+// GetQuota queries the quota and the usage of the directory on its host, and refreshes the ones saved.
+func (d *Directory) GetQuota(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	directory, hostDriver, err := d.getDirectoryDriver(engine, driver.CapabilityQuota)
+	if err != nil {
+		return err
+	}
+
+	quota, err := hostDriver.GetDirectoryQuota(ctx, d.Name)
+	if err != nil {
+		return err
+	}
+
+	directory.SoftLimitBytes = quota.SoftLimitBytes
+	directory.HardLimitBytes = quota.HardLimitBytes
+	directory.SoftLimitFiles = quota.SoftLimitFiles
+	directory.HardLimitFiles = quota.HardLimitFiles
+	setDirectoryUsage(&directory, quota, time.Now())
+
+	err = directory.Update(engine, "soft_limit_bytes", "hard_limit_bytes", "soft_limit_files", "hard_limit_files",
+		"used_bytes", "used_files", "usage_update_time")
+	if err != nil {
+		return err
+	}
+
+	common.DeepCopy(directory, d)
+
+	return nil
+}
+
+// GetACL returns the ACL of the directory on its host, the ACL is not saved since it may be changed on the host.
+func (d *Directory) GetACL(ctx context.Context) (acl common.DirectoryACL, err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return acl, err
+	}
+
+	_, hostDriver, err := d.getDirectoryDriver(engine, driver.CapabilityACL)
+	if err != nil {
+		return acl, err
+	}
+
+	return hostDriver.GetDirectoryACL(ctx, d.Name)
+}
+
+// SetACL replaces the ACL of the directory on its host.
+func (d *Directory) SetACL(ctx context.Context, acl common.DirectoryACL) (err error) {
+	if err = acl.Validate(); err != nil {
+		return err
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	_, hostDriver, err := d.getDirectoryDriver(engine, driver.CapabilityACL)
+	if err != nil {
+		return err
+	}
+
+	return hostDriver.SetDirectoryACL(ctx, d.Name, acl)
+}
+
+func setDirectoryUsage(directory *db.Directory, quota common.DirectoryQuota, updateTime time.Time) {
+	directory.UsedBytes = quota.UsedBytes
+	directory.UsedFiles = quota.UsedFiles
+	directory.UsageUpdateTime = &updateTime
+}
+
 type DirectoryList struct {
 	Directories []Directory
 }
@@ -141,14 +381,11 @@ func (dl *DirectoryList) Create(ctx context.Context) error {
 				return err
 			}
 
-			hostContext := common.HostContext{
-				IP:       host.IP,
-				Username: host.Username,
-				Password: host.Password,
+			driver, err := getHostDriver(host, driver.CapabilityDirectory)
+			if err != nil {
+				resultErr = errors.Join(resultErr, err)
+				return err
 			}
-			ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-			driver := driver.GetDriver(host.StorageType)
 			directoryDetail, err := driver.CreateDirectory(ctx, directory.Name)
 			if err != nil {
 				resultErr = errors.Join(resultErr, err)
@@ -201,14 +438,11 @@ func (dl *DirectoryList) Delete(ctx context.Context, filter *common.QueryFilter)
 				return err
 			}
 
-			hostContext := common.HostContext{
-				IP:       host.IP,
-				Username: host.Username,
-				Password: host.Password,
+			driver, err := getHostDriver(host, driver.CapabilityDirectory)
+			if err != nil {
+				resultErr = errors.Join(resultErr, err)
+				return err
 			}
-			ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-			driver := driver.GetDriver(host.StorageType)
 			if err := driver.DeleteDirectory(ctx, directory.Name); err != nil {
 				resultErr = errors.Join(resultErr, err)
 				return err
@@ -225,6 +459,16 @@ func (dl *DirectoryList) Delete(ctx context.Context, filter *common.QueryFilter)
 		return err
 	}
 
+	for _, directory := range dl.Directories {
+		if err := deleteDirectorySnapshots(engine, directory.HostIP, directory.Name); err != nil {
+			return err
+		}
+
+		if err := deleteDirectoryReplications(engine, directory.HostIP, directory.Name); err != nil {
+			return err
+		}
+	}
+
 	directoryList := db.DirectoryList{}
 	if err := common.DeepCopy(dl.Directories, &directoryList.Directories); err != nil {
 		return err
@@ -275,14 +519,7 @@ func (dl *DirectoryList) Pagination(ctx context.Context, filter *common.QueryFil
 		TotalCount: paginationDirs.TotalCount,
 	}
 
-	for _, _directory := range paginationDirs.Directories {
-		directory := Directory{
-			Name:   _directory.Name,
-			HostIP: _directory.HostIP,
-		}
-
-		paginationDirList.Directories = append(paginationDirList.Directories, directory)
-	}
+	common.DeepCopy(paginationDirs.Directories, &paginationDirList.Directories)
 
 	return &paginationDirList, nil
 }
@@ -0,0 +1,75 @@
+package mgmtmodel
+
+import (
+	"testing"
+
+	"github.com/cryingmouse/data_management_engine/db"
+)
+
+func Test_isDirectoryInUse(t *testing.T) {
+	// The database is opened with the job workers.
+	setupJobWorkers(t)
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The records are deleted afterwards, so that the test can run again on the same database.
+	records := []interface {
+		Save(*db.DatabaseEngine) error
+	}{
+		&db.Snapshot{HostIP: "192.0.2.20", DirectoryName: "snapshotted", Name: "daily-1"},
+		&db.Replication{
+			SourceHostIP:             "192.0.2.20",
+			SourceDirectoryName:      "source",
+			DestinationHostIP:        "192.0.2.21",
+			DestinationDirectoryName: "replica",
+		},
+	}
+	for _, r := range records {
+		record := r // 避免闭包问题
+		if err := record.Save(engine); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { engine.DB.Unscoped().Delete(record) })
+	}
+
+	tests := []struct {
+		name      string
+		directory db.Directory
+		wantInUse bool
+	}{
+		{
+			name:      "Directory without snapshot or replication",
+			directory: db.Directory{HostIP: "192.0.2.20", Name: "free"},
+		},
+		{
+			name:      "Directory with snapshot",
+			directory: db.Directory{HostIP: "192.0.2.20", Name: "snapshotted"},
+			wantInUse: true,
+		},
+		{
+			name:      "Source directory of replication",
+			directory: db.Directory{HostIP: "192.0.2.20", Name: "source"},
+			wantInUse: true,
+		},
+		{
+			name:      "Destination directory of replication",
+			directory: db.Directory{HostIP: "192.0.2.21", Name: "replica"},
+			wantInUse: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inUse, err := isDirectoryInUse(engine, tt.directory)
+			if err != nil {
+				t.Fatalf("isDirectoryInUse() error = %v", err)
+			}
+			if inUse != tt.wantInUse {
+				t.Errorf("isDirectoryInUse() = %v, want %v", inUse, tt.wantInUse)
+			}
+		})
+	}
+}
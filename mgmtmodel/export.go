@@ -0,0 +1,191 @@
+package mgmtmodel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+)
+
+type NFSExport struct {
+	HostIP        string
+	DirectoryName string
+	ExportPath    string
+	Clients       []common.NFSClient
+}
+
+func (e *NFSExport) Create(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	// Get the right driver and call driver to create export.
+	host := db.Host{IP: e.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+	driver, err := getHostDriver(host, driver.CapabilityNFS)
+	if err != nil {
+		return err
+	}
+
+	if err = driver.CreateNFSExport(ctx, e.DirectoryName, e.Clients); err != nil {
+		return err
+	}
+
+	// The full path of the directory is only known by the host.
+	exportDetail, err := driver.GetNFSExportDetail(ctx, e.DirectoryName)
+	if err != nil {
+		return err
+	}
+
+	e.ExportPath = buildNFSExportPath(host.IP, exportDetail.DirectoryPath)
+	e.Clients = exportDetail.Clients
+
+	export := db.NFSExport{
+		HostIP:        e.HostIP,
+		DirectoryName: e.DirectoryName,
+		Path:          e.ExportPath,
+		Clients:       toNFSExportClients(e.Clients),
+	}
+
+	return export.Save(engine)
+}
+
+func (e *NFSExport) Delete(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: e.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	driver, err := getHostDriver(host, driver.CapabilityNFS)
+	if err != nil {
+		return err
+	}
+	if err := driver.DeleteNFSExport(ctx, e.DirectoryName); err != nil {
+		return err
+	}
+
+	export := db.NFSExport{
+		HostIP:        e.HostIP,
+		DirectoryName: e.DirectoryName,
+	}
+	return export.Delete(engine)
+}
+
+func (e *NFSExport) Get(ctx context.Context) (*NFSExport, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	export := db.NFSExport{
+		HostIP:        e.HostIP,
+		DirectoryName: e.DirectoryName,
+	}
+	if err = export.Get(engine); err != nil {
+		return nil, err
+	}
+
+	*e = fromNFSExport(export)
+
+	return e, nil
+}
+
+func buildNFSExportPath(ip string, directoryPath string) string {
+	return fmt.Sprintf("%s:%s", ip, directoryPath)
+}
+
+func toNFSExportClients(clients []common.NFSClient) []db.NFSExportClient {
+	exportClients := make([]db.NFSExportClient, len(clients))
+	for i, client := range clients {
+		exportClients[i] = db.NFSExportClient{
+			Host:       client.Host,
+			Access:     client.Access,
+			RootSquash: client.RootSquash,
+		}
+	}
+
+	return exportClients
+}
+
+func fromNFSExport(export db.NFSExport) NFSExport {
+	e := NFSExport{
+		HostIP:        export.HostIP,
+		DirectoryName: export.DirectoryName,
+		ExportPath:    export.Path,
+	}
+
+	for _, client := range export.Clients {
+		e.Clients = append(e.Clients, common.NFSClient{
+			Host:       client.Host,
+			Access:     client.Access,
+			RootSquash: client.RootSquash,
+		})
+	}
+
+	return e
+}
+
+type NFSExportList struct {
+	Exports []NFSExport
+}
+
+func (el *NFSExportList) Get(ctx context.Context, filter *common.QueryFilter) ([]NFSExport, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	exportList := db.NFSExportList{}
+
+	if err = exportList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	for _, export := range exportList.Exports {
+		el.Exports = append(el.Exports, fromNFSExport(export))
+	}
+
+	return el.Exports, nil
+}
+
+type PaginationNFSExport struct {
+	Exports    []NFSExport
+	Page       int
+	Limit      int
+	TotalCount int64
+}
+
+func (el *NFSExportList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationNFSExport, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	exportList := db.NFSExportList{}
+	paginationExports, err := exportList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationExportList := PaginationNFSExport{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationExports.TotalCount,
+	}
+
+	for _, export := range paginationExports.Exports {
+		paginationExportList.Exports = append(paginationExportList.Exports, fromNFSExport(export))
+	}
+
+	return &paginationExportList, nil
+}
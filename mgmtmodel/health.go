@@ -0,0 +1,246 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	HealthStateConnected   = "connected"
+	HealthStateDegraded    = "degraded"
+	HealthStateUnreachable = "unreachable"
+)
+
+const (
+	defaultHealthCheckInterval  = 60 * time.Second
+	defaultUnreachableThreshold = 3
+	defaultMaxBackoff           = time.Hour
+	defaultHealthHistorySize    = 100
+)
+
+// The number of the hosts checked at the same time, so a large fleet does not open a connection to every host at once.
+const maxConcurrentHealthChecks = 8
+
+type HostHealthCheck struct {
+	State     string
+	CheckTime time.Time
+	Latency   int64
+	Error     string
+}
+
+type HostHealth struct {
+	IP              string
+	Connected       bool
+	HealthState     string
+	FailureCount    int
+	LastCheckTime   *time.Time
+	LastSuccessTime *time.Time
+	StateChangeTime *time.Time
+	NextCheckTime   *time.Time
+
+	History []HostHealthCheck
+}
+
+// healthPolicy decides the health state of the host by the results of the consecutive health checks.
+type healthPolicy struct {
+	interval             time.Duration
+	unreachableThreshold int
+	maxBackoff           time.Duration
+	historySize          int
+}
+
+// HealthCheckInterval returns the interval between the health checks of the registered hosts.
+func HealthCheckInterval() time.Duration {
+	return getHealthPolicy().interval
+}
+
+func getHealthPolicy() healthPolicy {
+	config := common.Config.Scheduler
+
+	policy := healthPolicy{
+		interval:             time.Duration(config.HealthCheckInterval) * time.Second,
+		unreachableThreshold: config.UnreachableThreshold,
+		maxBackoff:           time.Duration(config.MaxBackoff) * time.Second,
+		historySize:          config.HealthHistorySize,
+	}
+
+	if policy.interval <= 0 {
+		policy.interval = defaultHealthCheckInterval
+	}
+	if policy.unreachableThreshold <= 0 {
+		policy.unreachableThreshold = defaultUnreachableThreshold
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = defaultMaxBackoff
+	}
+	if policy.historySize <= 0 {
+		policy.historySize = defaultHealthHistorySize
+	}
+
+	return policy
+}
+
+// backoff returns the interval before the next check of the unreachable host, it is doubled for every failed check.
+func (p healthPolicy) backoff(failureCount int) time.Duration {
+	backoff := p.interval
+	for i := p.unreachableThreshold; i <= failureCount && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+
+	return backoff
+}
+
+// apply updates the health state of the host by the result of the check made at the time.
+func (p healthPolicy) apply(host *db.Host, checkTime time.Time, checkErr error) {
+	var state string
+
+	host.LastCheckTime = &checkTime
+	host.NextCheckTime = nil
+
+	if checkErr == nil {
+		state = HealthStateConnected
+		host.Connected = true
+		host.FailureCount = 0
+		host.LastSuccessTime = &checkTime
+	} else {
+		host.Connected = false
+		host.FailureCount++
+
+		if host.FailureCount >= p.unreachableThreshold {
+			state = HealthStateUnreachable
+
+			nextCheckTime := checkTime.Add(p.backoff(host.FailureCount))
+			host.NextCheckTime = &nextCheckTime
+		} else {
+			state = HealthStateDegraded
+		}
+	}
+
+	if host.HealthState != state {
+		host.HealthState = state
+		host.StateChangeTime = &checkTime
+	}
+}
+
+// checkHostHealth checks the host by getting its system information, and records the result.
+// The error is returned only if the result fails to be saved.
+func checkHostHealth(ctx context.Context, engine *db.DatabaseEngine, dbHost *db.Host, policy healthPolicy) error {
+	var host Host
+	common.DeepCopy(*dbHost, &host)
+
+	checkTime := time.Now()
+	_, checkErr := host.GetSystemInfo(ctx)
+
+	latency := time.Since(checkTime)
+
+	policy.apply(dbHost, checkTime, checkErr)
+	if err := dbHost.UpdateHealth(engine); err != nil {
+		return fmt.Errorf("failed to save the health state of the host %s: %w", dbHost.IP, err)
+	}
+
+	return saveHealthCheck(engine, dbHost, checkTime, latency, checkErr, policy)
+}
+
+// saveHealthCheck adds the health check to the history of the host, the oldest ones beyond the history size are dropped.
+func saveHealthCheck(engine *db.DatabaseEngine, dbHost *db.Host, checkTime time.Time, latency time.Duration, checkErr error, policy healthPolicy) error {
+	check := db.HostHealthCheck{
+		HostIP:    dbHost.IP,
+		State:     dbHost.HealthState,
+		CheckTime: checkTime,
+		Latency:   latency.Milliseconds(),
+	}
+	if checkErr != nil {
+		check.Error = checkErr.Error()
+	}
+
+	if err := check.Save(engine); err != nil {
+		return fmt.Errorf("failed to save the health check of the host %s: %w", dbHost.IP, err)
+	}
+
+	checkList := db.HostHealthCheckList{}
+
+	return checkList.Prune(engine, dbHost.IP, policy.historySize)
+}
+
+// GetHealth returns the health state of the host with its latest health checks.
+func (h *Host) GetHealth(ctx context.Context, limit int) (*HostHealth, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	host := db.Host{IP: h.IP}
+	if err = host.Get(engine); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 {
+		limit = getHealthPolicy().historySize
+	}
+
+	checkList := db.HostHealthCheckList{}
+	if err = checkList.Get(engine, host.IP, limit); err != nil {
+		return nil, err
+	}
+
+	health := HostHealth{}
+	common.DeepCopy(host, &health)
+	common.DeepCopy(checkList.Checks, &health.History)
+
+	return &health, nil
+}
+
+// Update checks the health of the registered hosts. Every host is checked independently, the unreachable hosts
+// are skipped until their next check time, and the hosts whose heartbeats arrive are not checked at all.
+// The errors to save the results are joined and returned.
+func (hl *HostList) Update(ctx context.Context) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	hostList := db.HostList{}
+	if err := hostList.Get(engine, &common.QueryFilter{}); err != nil {
+		return err
+	}
+
+	policy := getHealthPolicy()
+	now := time.Now()
+
+	// The checks do not stop each other, so their errors are collected instead of being returned to the group.
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentHealthChecks)
+
+	errs := make([]error, len(hostList.Hosts))
+
+	for i := range hostList.Hosts {
+		index := i // 避免闭包问题
+		dbHost := hostList.Hosts[index]
+		if dbHost.NextCheckTime != nil && now.Before(*dbHost.NextCheckTime) {
+			continue
+		}
+		if dbHost.RegistrationState == RegistrationStatePending || hasRecentHeartbeat(dbHost, now) {
+			continue
+		}
+
+		g.Go(func() error {
+			errs[index] = checkHostHealth(ctx, engine, &dbHost, policy)
+
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,133 @@
+package mgmtmodel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/db"
+)
+
+func Test_healthPolicy_apply(t *testing.T) {
+	policy := healthPolicy{
+		interval:             time.Minute,
+		unreachableThreshold: 3,
+		maxBackoff:           10 * time.Minute,
+	}
+	checkErr := errors.New("timeout")
+	checkTime := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		host             db.Host
+		checkErr         error
+		wantState        string
+		wantFailureCount int
+		wantStateChanged bool
+		wantBackoff      time.Duration
+	}{
+		{
+			name:             "First check succeeds",
+			host:             db.Host{},
+			wantState:        HealthStateConnected,
+			wantStateChanged: true,
+		},
+		{
+			name:             "Connected host fails",
+			host:             db.Host{HealthState: HealthStateConnected},
+			checkErr:         checkErr,
+			wantState:        HealthStateDegraded,
+			wantFailureCount: 1,
+			wantStateChanged: true,
+		},
+		{
+			name:             "Degraded host fails again",
+			host:             db.Host{HealthState: HealthStateDegraded, FailureCount: 1},
+			checkErr:         checkErr,
+			wantState:        HealthStateDegraded,
+			wantFailureCount: 2,
+		},
+		{
+			name:             "Degraded host becomes unreachable",
+			host:             db.Host{HealthState: HealthStateDegraded, FailureCount: 2},
+			checkErr:         checkErr,
+			wantState:        HealthStateUnreachable,
+			wantFailureCount: 3,
+			wantStateChanged: true,
+			wantBackoff:      2 * time.Minute,
+		},
+		{
+			name:             "Back off exponentially from the unreachable host",
+			host:             db.Host{HealthState: HealthStateUnreachable, FailureCount: 4},
+			checkErr:         checkErr,
+			wantState:        HealthStateUnreachable,
+			wantFailureCount: 5,
+			wantBackoff:      8 * time.Minute,
+		},
+		{
+			name:             "Back off no more than the maximum",
+			host:             db.Host{HealthState: HealthStateUnreachable, FailureCount: 10},
+			checkErr:         checkErr,
+			wantState:        HealthStateUnreachable,
+			wantFailureCount: 11,
+			wantBackoff:      10 * time.Minute,
+		},
+		{
+			name:             "Unreachable host recovers",
+			host:             db.Host{HealthState: HealthStateUnreachable, FailureCount: 5},
+			wantState:        HealthStateConnected,
+			wantStateChanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := tt.host
+			policy.apply(&host, checkTime, tt.checkErr)
+
+			if host.HealthState != tt.wantState {
+				t.Errorf("apply() state = %v, want %v", host.HealthState, tt.wantState)
+			}
+			if host.FailureCount != tt.wantFailureCount {
+				t.Errorf("apply() failure count = %v, want %v", host.FailureCount, tt.wantFailureCount)
+			}
+			if host.Connected != (tt.checkErr == nil) {
+				t.Errorf("apply() connected = %v, want %v", host.Connected, tt.checkErr == nil)
+			}
+			if stateChanged := host.StateChangeTime != nil; stateChanged != tt.wantStateChanged {
+				t.Errorf("apply() state changed = %v, want %v", stateChanged, tt.wantStateChanged)
+			}
+
+			var backoff time.Duration
+			if host.NextCheckTime != nil {
+				backoff = host.NextCheckTime.Sub(checkTime)
+			}
+			if backoff != tt.wantBackoff {
+				t.Errorf("apply() backoff = %v, want %v", backoff, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+func Test_hasRecentHeartbeat(t *testing.T) {
+	now := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	recent := now.Add(-HeartbeatInterval())
+	stale := now.Add(-3 * HeartbeatInterval())
+
+	tests := []struct {
+		name string
+		host db.Host
+		want bool
+	}{
+		{name: "No heartbeat", host: db.Host{}, want: false},
+		{name: "Recent heartbeat", host: db.Host{LastHeartbeatTime: &recent}, want: true},
+		{name: "Stale heartbeat", host: db.Host{LastHeartbeatTime: &stale}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasRecentHeartbeat(tt.host, now); got != tt.want {
+				t.Errorf("hasRecentHeartbeat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,9 @@ package mgmtmodel
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/cryingmouse/data_management_engine/db"
@@ -19,17 +21,64 @@ type Host struct {
 	Username       string `json:"username,omitempty"`
 	Password       string `json:"password,omitempty"`
 	StorageType    string `json:"storage_type,omitempty"`
+	Scheme         string `json:"scheme,omitempty"`
+	Port           int    `json:"port,omitempty"`
 	Caption        string `json:"caption,omitempty"`
 	OSArchitecture string `json:"os_arch,omitempty"`
 	OSVersion      string `json:"os_verion,omitempty"`
 	BuildNumber    string `json:"build_number,omitempty"`
 	Connected      bool   `json:"connected,omitempty"`
+	HealthState    string `json:"health_state,omitempty"`
+	// Skip the verification of the certificate of the storage management API.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+	// The fingerprint of the certificate issued to the agent at the registration.
+	CertFingerprint string `json:"cert_fingerprint,omitempty"`
+	// The host whose agent called home is pending until it is approved.
+	RegistrationState string     `json:"registration_state,omitempty"`
+	AgentVersion      string     `json:"agent_version,omitempty"`
+	Load              float64    `json:"load,omitempty"`
+	Uptime            int64      `json:"uptime,omitempty"`
+	LastHeartbeatTime *time.Time `json:"last_heartbeat_time,omitempty"`
 
 	Directories []Directory `json:"directories,omitempty"`
 }
 
 func (h *Host) Register(ctx context.Context) error {
-	systemInfo, err := h.GetSystemInfo(ctx)
+	if err := h.connect(ctx); err != nil {
+		return err
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	var host db.Host
+
+	common.DeepCopy(h, &host)
+
+	err = host.Save(engine)
+	if sqliteErr, ok := err.(sqlite3.Error); ok {
+		switch sqliteErr.ExtendedCode {
+		// Map SQLite ErrNo to specific error scenarios
+		case sqlite3.ErrConstraintUnique: // SQLite constraint violation
+			error := common.ErrHostAlreadyRegistered
+			error.Params = []string{host.IP}
+			return error
+		}
+	}
+
+	return nil
+}
+
+// connect enrolls the host and gets its system information, the host is regarded as registered and connected since then.
+func (h *Host) connect(ctx context.Context) error {
+	var systemInfo common.SystemInfo
+
+	err := h.enroll(ctx)
+	if err == nil {
+		systemInfo, err = h.GetSystemInfo(ctx)
+	}
 	if err != nil {
 		if common.IsHttpTimeout(err) {
 			definedErr := common.ErrRegisterHostConnectedError
@@ -47,27 +96,37 @@ func (h *Host) Register(ctx context.Context) error {
 	h.OSVersion = systemInfo.OSVersion
 	h.BuildNumber = systemInfo.BuildNumber
 	h.Connected = true
+	h.HealthState = HealthStateConnected
+	h.RegistrationState = RegistrationStateRegistered
 
-	engine, err := db.GetDatabaseEngine()
+	return nil
+}
+
+// enroll issues the certificate of the host if its driver connects it by mutual TLS. The scheme, the port and
+// the fingerprint of the certificate are kept with the host, so that the later connections are pinned to it.
+func (h *Host) enroll(ctx context.Context) error {
+	h.Scheme = ""
+	h.CertFingerprint = ""
+
+	hostDriver, err := driver.GetDriver(h.getHostConfig())
 	if err != nil {
 		return err
 	}
 
-	var host db.Host
-
-	common.DeepCopy(h, &host)
+	enroller, ok := hostDriver.(driver.Enroller)
+	if !ok {
+		return nil
+	}
 
-	err = host.Save(engine)
-	if sqliteErr, ok := err.(sqlite3.Error); ok {
-		switch sqliteErr.ExtendedCode {
-		// Map SQLite ErrNo to specific error scenarios
-		case sqlite3.ErrConstraintUnique: // SQLite constraint violation
-			error := common.ErrHostAlreadyRegistered
-			error.Params = []string{host.IP}
-			return error
-		}
+	enrollment, err := enroller.Enroll(ctx)
+	if err != nil {
+		return err
 	}
 
+	h.Scheme = enrollment.Scheme
+	h.Port = enrollment.Port
+	h.CertFingerprint = enrollment.CertFingerprint
+
 	return nil
 }
 
@@ -109,7 +168,19 @@ func (h *Host) Unregister(ctx context.Context) error {
 		}
 		return definedErr
 	}
-	return host.Delete(engine)
+	// Delete by the IP address only, the fetched host has the decrypted password which never matches the saved one.
+	if err := (&db.Host{IP: h.IP}).Delete(engine); err != nil {
+		return err
+	}
+
+	checkList := db.HostHealthCheckList{}
+	if err := checkList.Delete(engine, h.IP); err != nil {
+		return err
+	}
+
+	driver.RemoveDriver(h.IP)
+
+	return nil
 }
 
 func (h *Host) Get(ctx context.Context) (*Host, error) {
@@ -146,33 +217,23 @@ func (hl *HostList) getIPList() []string {
 func (hl *HostList) Register(ctx context.Context) error {
 	g, _ := errgroup.WithContext(context.Background())
 
-	results := make([]common.SystemInfo, len(hl.Hosts))
-	var resultErr error
+	errs := make([]error, len(hl.Hosts))
 
-	for i, h := range hl.Hosts {
+	for i := range hl.Hosts {
 		index := i // 避免闭包问题
-		host := h  // 避免闭包问题
 		g.Go(func() error {
-			systemInfo, err := host.GetSystemInfo(ctx)
-			if err != nil {
-				resultErr = errors.Join(resultErr, err)
+			// Enroll each host as Host.Register does, so the hosts registered in batch are connected by mutual TLS too.
+			if err := hl.Hosts[index].connect(ctx); err != nil {
+				errs[index] = err
 				return err
 			}
-			results[index] = systemInfo // 保存协程的返回值
 
 			return nil
 		})
 	}
 
 	if err := g.Wait(); err != nil {
-		if resultErr != nil {
-			return resultErr
-		}
-		return err
-	}
-
-	if err := common.DeepCopy(results, &hl.Hosts); err != nil {
-		return err
+		return errors.Join(errs...)
 	}
 
 	dbHostList := db.HostList{}
@@ -212,41 +273,20 @@ func (hl *HostList) Unregister(ctx context.Context) error {
 
 	common.DeepCopy(hl.Hosts, &hostList.Hosts)
 
-	return hostList.Delete(engine, nil)
-}
-
-func (hl *HostList) Update(ctx context.Context) error {
-	engine, err := db.GetDatabaseEngine()
-	if err != nil {
-		panic(err)
-	}
-
-	hostList := db.HostList{}
-	if err := hostList.Get(engine, &common.QueryFilter{}); err != nil {
+	if err := hostList.Delete(engine, nil); err != nil {
 		return err
 	}
 
-	g, _ := errgroup.WithContext(context.Background())
-
-	for _, h := range hostList.Hosts {
-		dbHost := h // 避免闭包问题
-		g.Go(func() error {
-			var host Host
-			common.DeepCopy(dbHost, &host)
-
-			if _, err := host.GetSystemInfo(ctx); err != nil {
-				dbHost.Connected = false
-				dbHost.Save(engine)
-				return err
-			}
-			dbHost.Connected = true
-			dbHost.Save(engine)
+	checkList := db.HostHealthCheckList{}
+	for _, host := range hl.Hosts {
+		if err := checkList.Delete(engine, host.IP); err != nil {
+			return err
+		}
 
-			return nil
-		})
+		driver.RemoveDriver(host.IP)
 	}
 
-	return g.Wait()
+	return nil
 }
 
 func (hl *HostList) Get(ctx context.Context, filter *common.QueryFilter) ([]Host, error) {
@@ -296,15 +336,43 @@ func (hl *HostList) Pagination(ctx context.Context, filter *common.QueryFilter)
 }
 
 func (h *Host) GetSystemInfo(ctx context.Context) (systemInfo common.SystemInfo, err error) {
-	hostContext := common.HostContext{
-		IP:       h.IP,
-		Username: h.Username,
-		Password: h.Password,
+	driver, err := driver.GetDriver(h.getHostConfig())
+	if err != nil {
+		return systemInfo, err
 	}
 
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
+	return driver.GetSystemInfo(ctx)
+}
 
-	driver := driver.GetDriver(h.StorageType)
+func (h *Host) getHostConfig() driver.HostConfig {
+	return driver.HostConfig{
+		StorageType:        h.StorageType,
+		IP:                 h.IP,
+		Scheme:             h.Scheme,
+		Username:           h.Username,
+		Password:           h.Password,
+		Port:               h.Port,
+		InsecureSkipVerify: h.InsecureSkipVerify,
+		CertFingerprint:    h.CertFingerprint,
+	}
+}
 
-	return driver.GetSystemInfo(ctx)
+// getHostDriver returns the driver instance of the registered host if it supports the capability.
+func getHostDriver(host db.Host, capability driver.Capability) (driver.Driver, error) {
+	if host.RegistrationState == RegistrationStatePending {
+		return nil, fmt.Errorf("the host %s is pending for approval", host.IP)
+	}
+
+	config := driver.HostConfig{
+		StorageType:        host.StorageType,
+		IP:                 host.IP,
+		Scheme:             host.Scheme,
+		Username:           host.Username,
+		Password:           host.Password,
+		Port:               host.Port,
+		InsecureSkipVerify: host.InsecureSkipVerify,
+		CertFingerprint:    host.CertFingerprint,
+	}
+
+	return driver.GetDriverFor(config, capability)
 }
@@ -0,0 +1,78 @@
+package mgmtmodel
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+)
+
+const enrollStorageType = "test-enroll"
+
+var registerEnrollDriverOnce sync.Once
+
+// enrollDriver enrolls its host as the agent driver does, the other operations are not implemented.
+type enrollDriver struct {
+	driver.Driver
+	config driver.HostConfig
+}
+
+func (d *enrollDriver) Enroll(ctx context.Context) (*driver.Enrollment, error) {
+	return &driver.Enrollment{Scheme: "https", Port: 8443, CertFingerprint: "fingerprint-" + d.config.IP}, nil
+}
+
+func (d *enrollDriver) GetSystemInfo(ctx context.Context) (common.SystemInfo, error) {
+	return common.SystemInfo{ComputerName: "host-" + d.config.IP}, nil
+}
+
+func TestHostList_Register(t *testing.T) {
+	// The database is opened with the job workers.
+	setupJobWorkers(t)
+
+	registerEnrollDriverOnce.Do(func() {
+		driver.Register(enrollStorageType, func(config driver.HostConfig) (driver.Driver, error) {
+			return &enrollDriver{config: config}, nil
+		})
+	})
+
+	hostList := HostList{
+		Hosts: []Host{
+			{IP: "192.0.2.10", Username: "admin", Password: "Password123", StorageType: enrollStorageType},
+			{IP: "192.0.2.11", Username: "admin", Password: "Password123", StorageType: enrollStorageType},
+		},
+	}
+	if err := hostList.Register(context.Background()); err != nil {
+		t.Fatalf("HostList.Register() error = %v", err)
+	}
+	// The hosts are deleted afterwards, so that the test can run again on the same database.
+	t.Cleanup(func() {
+		if engine, err := db.GetDatabaseEngine(); err == nil {
+			for _, host := range hostList.Hosts {
+				(&db.Host{IP: host.IP}).Delete(engine)
+			}
+		}
+	})
+
+	for _, registered := range hostList.Hosts {
+		host := &Host{IP: registered.IP}
+		if _, err := host.Get(context.Background()); err != nil {
+			t.Fatalf("Host.Get() error = %v", err)
+		}
+
+		if host.Scheme != "https" || host.Port != 8443 {
+			t.Errorf("The host %s is connected by %s on port %d, want https on port 8443", host.IP, host.Scheme, host.Port)
+		}
+		if want := "fingerprint-" + host.IP; host.CertFingerprint != want {
+			t.Errorf("The fingerprint of the host %s = %q, want %q", host.IP, host.CertFingerprint, want)
+		}
+		if want := "host-" + host.IP; host.ComputerName != want {
+			t.Errorf("The computer name of the host %s = %q, want %q", host.IP, host.ComputerName, want)
+		}
+		if host.HealthState != HealthStateConnected || host.RegistrationState != RegistrationStateRegistered {
+			t.Errorf("The host %s is %s and %s, want connected and registered", host.IP, host.HealthState, host.RegistrationState)
+		}
+	}
+}
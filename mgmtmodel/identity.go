@@ -0,0 +1,157 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/identity"
+	"gorm.io/gorm"
+)
+
+const defaultIdentityCacheTTL = time.Hour
+
+// The maximum number of the identities returned by a search of the directory service.
+const maxIdentitySearchLimit = 100
+
+// IdentityCacheTTL returns how long the resolved identities are used before they are resolved again.
+func IdentityCacheTTL() time.Duration {
+	if ttl := time.Duration(common.Config.Identity.CacheTTL) * time.Second; ttl > 0 {
+		return ttl
+	}
+
+	return defaultIdentityCacheTTL
+}
+
+// ResolveIdentity returns the domain user or group by its name, e.g. CORP\alice. The identity is resolved by the
+// directory service and cached, the cached one is returned until IdentityCacheTTL passes.
+func ResolveIdentity(ctx context.Context, name, identityType string) (identity.Identity, error) {
+	source, err := identity.GetSource()
+	if err != nil {
+		return identity.Identity{}, err
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return identity.Identity{}, err
+	}
+
+	accountName := identity.AccountName(name)
+
+	cached := db.Identity{Key: strings.ToLower(accountName), Type: identityType}
+	if err = cached.Get(engine); err == nil && time.Since(cached.ResolveTime) < IdentityCacheTTL() {
+		return fromIdentityCache(cached), nil
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return identity.Identity{}, err
+	}
+
+	resolved, err := source.Resolve(ctx, accountName, identityType)
+	if err != nil {
+		return identity.Identity{}, err
+	}
+
+	if err = cacheIdentity(engine, resolved); err != nil {
+		return identity.Identity{}, err
+	}
+
+	return resolved, nil
+}
+
+// SearchIdentities returns the domain users and groups whose name contains the query, the identities found are cached.
+func SearchIdentities(ctx context.Context, query string, limit int) ([]identity.Identity, error) {
+	source, err := identity.GetSource()
+	if err != nil {
+		return nil, err
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > maxIdentitySearchLimit {
+		limit = maxIdentitySearchLimit
+	}
+
+	identities, err := source.Search(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, found := range identities {
+		if err = cacheIdentity(engine, found); err != nil {
+			return nil, err
+		}
+	}
+
+	return identities, nil
+}
+
+// resolveShareAccess checks the domain users and groups in the access levels by the directory service, and qualifies
+// their names by the domain. The local users and groups are not checked, and neither are the domain ones if no
+// directory service is configured.
+func resolveShareAccess(ctx context.Context, access []common.ShareAccess) ([]common.ShareAccess, error) {
+	resolved := make([]common.ShareAccess, len(access))
+
+	for i, entry := range access {
+		resolved[i] = entry
+
+		if !identity.IsDomainName(entry.Principal()) {
+			continue
+		}
+
+		identityType := identity.TypeUser
+		if entry.IsGroup() {
+			identityType = identity.TypeGroup
+		}
+
+		found, err := ResolveIdentity(ctx, entry.Principal(), identityType)
+		if errors.Is(err, identity.ErrNotConfigured) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if entry.IsGroup() {
+			resolved[i].GroupName = found.QualifiedName()
+		} else {
+			resolved[i].UserName = found.QualifiedName()
+		}
+	}
+
+	// The different names of one identity, e.g. CORP\alice and alice@corp.example.com, are qualified to the same one.
+	if err := common.ValidateShareAccess(resolved); err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+func cacheIdentity(engine *db.DatabaseEngine, found identity.Identity) error {
+	cached := db.Identity{
+		Key:         strings.ToLower(found.Name),
+		Type:        found.Type,
+		Name:        found.Name,
+		Domain:      found.Domain,
+		DisplayName: found.DisplayName,
+		IdentityID:  found.ID,
+		DN:          found.DN,
+		ResolveTime: time.Now(),
+	}
+
+	return cached.Save(engine)
+}
+
+func fromIdentityCache(cached db.Identity) identity.Identity {
+	return identity.Identity{
+		Name:        cached.Name,
+		Domain:      cached.Domain,
+		Type:        cached.Type,
+		DisplayName: cached.DisplayName,
+		ID:          cached.IdentityID,
+		DN:          cached.DN,
+	}
+}
@@ -0,0 +1,384 @@
+package mgmtmodel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	JobStatePending    = "pending"
+	JobStateRunning    = "running"
+	JobStateCancelling = "cancelling"
+	JobStateSucceeded  = "succeeded"
+	JobStateFailed     = "failed"
+	JobStateCancelled  = "cancelled"
+)
+
+const defaultJobWorkers = 4
+
+// ErrJobFinished is returned if the job to cancel is already finished.
+var ErrJobFinished = errors.New("the job is already finished")
+
+// JobTask runs the item at the index of the job, the result is recorded in JSON if the item succeeds.
+// The context is cancelled once the job is cancelled, so the task should pass it down into the driver.
+type JobTask func(ctx context.Context, index int) (result interface{}, err error)
+
+type JobItem struct {
+	ItemIndex int
+	Name      string
+	State     string
+	Result    string
+	Error     string
+}
+
+type Job struct {
+	ID             uint
+	Type           string
+	State          string
+	TraceID        string
+	TotalCount     int
+	SucceededCount int
+	FailedCount    int
+	CancelledCount int
+	CreatedAt      time.Time
+	StartedAt      *time.Time
+	FinishedAt     *time.Time
+
+	Items []JobItem
+}
+
+// runningJob is the job which has items to run, its state is saved into database whenever an item is changed.
+type runningJob struct {
+	mu        sync.Mutex
+	job       db.Job
+	task      JobTask
+	ctx       context.Context
+	cancel    context.CancelFunc
+	remaining int
+}
+
+type jobItemTask struct {
+	job   *runningJob
+	index int
+}
+
+var (
+	jobMu          sync.Mutex
+	runningJobs    = make(map[uint]*runningJob)
+	jobQueue       chan jobItemTask
+	jobWorkersOnce sync.Once
+)
+
+// StartJobWorkers starts the worker pool running the items of the jobs. The jobs which are interrupted by
+// the last shutdown of the engine are marked as failed first. It takes effect at the first call only.
+func StartJobWorkers() (err error) {
+	jobWorkersOnce.Do(func() {
+		var engine *db.DatabaseEngine
+		if engine, err = db.GetDatabaseEngine(); err == nil {
+			jobList := db.JobList{}
+			err = jobList.Fail(engine, []string{JobStatePending, JobStateRunning, JobStateCancelling}, JobStateFailed,
+				"the job is interrupted by the shutdown of the engine")
+		}
+
+		workers := common.Config.Job.Workers
+		if workers <= 0 {
+			workers = defaultJobWorkers
+		}
+
+		jobQueue = make(chan jobItemTask)
+		for i := 0; i < workers; i++ {
+			go runJobWorker()
+		}
+	})
+
+	return err
+}
+
+// SubmitJob saves the job with an item for each of the names and returns it immediately, the items are run by the worker pool.
+func SubmitJob(ctx context.Context, jobType string, names []string, task JobTask) (*Job, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no items to run in the job")
+	}
+
+	if err := StartJobWorkers(); err != nil {
+		return nil, err
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	traceID, _ := ctx.Value(common.TraceIDKey("TraceID")).(string)
+
+	job := db.Job{
+		Type:       jobType,
+		State:      JobStatePending,
+		TraceID:    traceID,
+		TotalCount: len(names),
+	}
+	for index, name := range names {
+		job.Items = append(job.Items, db.JobItem{
+			ItemIndex: index,
+			Name:      name,
+			State:     JobStatePending,
+		})
+	}
+
+	if err := job.Save(engine); err != nil {
+		return nil, fmt.Errorf("failed to save the job in database: %w", err)
+	}
+
+	// The job outlives the request, so it runs with its own context which is cancelled by Cancel.
+	jobCtx, cancel := context.WithCancel(context.WithValue(context.Background(), common.TraceIDKey("TraceID"), traceID))
+	rj := &runningJob{
+		job:       job,
+		task:      task,
+		ctx:       jobCtx,
+		cancel:    cancel,
+		remaining: len(names),
+	}
+
+	jobMu.Lock()
+	runningJobs[job.ID] = rj
+	jobMu.Unlock()
+
+	var result Job
+	common.DeepCopy(job, &result)
+
+	go func() {
+		for index := range names {
+			select {
+			case jobQueue <- jobItemTask{job: rj, index: index}:
+			case <-jobCtx.Done():
+				rj.finishItem(index, nil, jobCtx.Err())
+			}
+		}
+	}()
+
+	return &result, nil
+}
+
+func runJobWorker() {
+	for t := range jobQueue {
+		t.job.run(t.index)
+	}
+}
+
+func (rj *runningJob) run(index int) {
+	// The item waiting in the queue is not run any more once the job is cancelled.
+	if err := rj.ctx.Err(); err != nil {
+		rj.finishItem(index, nil, err)
+		return
+	}
+
+	rj.startItem(index)
+
+	result, err := rj.runTask(index)
+
+	rj.finishItem(index, result, err)
+}
+
+func (rj *runningJob) runTask(index int) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic in the job item %d: %v", index, r)
+		}
+	}()
+
+	return rj.task(rj.ctx, index)
+}
+
+func (rj *runningJob) startItem(index int) {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+
+	rj.job.Items[index].State = JobStateRunning
+	if rj.job.State == JobStatePending {
+		now := time.Now()
+		rj.job.State = JobStateRunning
+		rj.job.StartedAt = &now
+	}
+
+	rj.save(index)
+}
+
+func (rj *runningJob) finishItem(index int, result interface{}, err error) {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+
+	item := &rj.job.Items[index]
+	switch {
+	case err == nil:
+		item.State = JobStateSucceeded
+		if result != nil {
+			if data, err := json.Marshal(result); err == nil {
+				item.Result = string(data)
+			}
+		}
+		rj.job.SucceededCount++
+	case rj.ctx.Err() != nil:
+		// The item fails because the job is cancelled.
+		item.State = JobStateCancelled
+		item.Error = err.Error()
+		rj.job.CancelledCount++
+	default:
+		item.State = JobStateFailed
+		item.Error = err.Error()
+		rj.job.FailedCount++
+	}
+
+	rj.remaining--
+	if rj.remaining > 0 {
+		rj.save(index)
+		return
+	}
+
+	now := time.Now()
+	rj.job.FinishedAt = &now
+	if rj.job.StartedAt == nil {
+		rj.job.StartedAt = &now
+	}
+
+	switch {
+	case rj.job.CancelledCount > 0:
+		rj.job.State = JobStateCancelled
+	case rj.job.FailedCount > 0:
+		rj.job.State = JobStateFailed
+	default:
+		rj.job.State = JobStateSucceeded
+	}
+
+	rj.save(index)
+	rj.cancel()
+
+	jobMu.Lock()
+	delete(runningJobs, rj.job.ID)
+	jobMu.Unlock()
+}
+
+// save saves the state of the job with the item at the index, or without any item if the index is negative.
+// The caller must hold the lock of the job.
+func (rj *runningJob) save(index int) {
+	var item *db.JobItem
+	if index >= 0 {
+		item = &rj.job.Items[index]
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err == nil {
+		err = rj.job.UpdateProgress(engine, item)
+	}
+
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": rj.job.TraceID,
+			"JobID":   rj.job.ID,
+			"error":   err.Error(),
+		}).Error("Failed to save the job.")
+	}
+}
+
+func (j *Job) Get(ctx context.Context) (*Job, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	job := db.Job{}
+	job.ID = j.ID
+	if err = job.Get(engine); err != nil {
+		return nil, err
+	}
+
+	common.DeepCopy(job, j)
+
+	return j, nil
+}
+
+// Cancel cancels the job, the items which are running are cancelled through their context and the others are skipped.
+// The job is in state 'cancelling' until all of its items are finished.
+func (j *Job) Cancel(ctx context.Context) (*Job, error) {
+	jobMu.Lock()
+	rj, exist := runningJobs[j.ID]
+	jobMu.Unlock()
+
+	if !exist {
+		if _, err := j.Get(ctx); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrJobFinished
+	}
+
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+
+	if rj.remaining > 0 && rj.job.State != JobStateCancelling {
+		rj.job.State = JobStateCancelling
+		rj.save(-1)
+	}
+	rj.cancel()
+
+	common.DeepCopy(rj.job, j)
+
+	return j, nil
+}
+
+type JobList struct {
+	Jobs []Job
+}
+
+func (jl *JobList) Get(ctx context.Context, filter *common.QueryFilter) ([]Job, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	jobList := db.JobList{}
+	if err = jobList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	common.DeepCopy(jobList.Jobs, &jl.Jobs)
+
+	return jl.Jobs, nil
+}
+
+type PaginationJob struct {
+	Jobs       []Job
+	Page       int
+	Limit      int
+	TotalCount int64
+}
+
+func (jl *JobList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationJob, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	jobList := db.JobList{}
+	paginationJobs, err := jobList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationJobList := PaginationJob{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationJobs.TotalCount,
+	}
+
+	common.DeepCopy(paginationJobs.Jobs, &paginationJobList.Jobs)
+
+	return &paginationJobList, nil
+}
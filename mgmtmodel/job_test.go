@@ -0,0 +1,334 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+)
+
+const testJobWorkers = 2
+
+var (
+	jobDatabaseOnce  sync.Once
+	jobDatabaseDir   string
+	jobDatabaseErr   error
+	interruptedJobID uint
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	if jobDatabaseDir != "" {
+		os.RemoveAll(jobDatabaseDir)
+	}
+
+	os.Exit(code)
+}
+
+// setupJobWorkers opens the database in a temporary folder and starts the worker pool once for all the tests of
+// the jobs. An interrupted job is saved before the worker pool is started, so it is marked as failed on starting.
+func setupJobWorkers(t *testing.T) {
+	t.Helper()
+
+	jobDatabaseOnce.Do(func() {
+		dir, err := os.MkdirTemp("", "dme-job-test-")
+		if err != nil {
+			jobDatabaseErr = err
+			return
+		}
+		jobDatabaseDir = dir
+
+		if err = os.Mkdir(filepath.Join(dir, "db"), 0755); err != nil {
+			jobDatabaseErr = err
+			return
+		}
+
+		common.Config.Logger.LogFile = filepath.Join(dir, "engine.log")
+		common.Config.Logger.AuditLogFile = filepath.Join(dir, "audit.log")
+		common.Config.Security.KeyFile = filepath.Join(dir, "keys.json")
+		common.Config.Job.Workers = testJobWorkers
+		common.SetupLoggers()
+
+		// The database is opened in the working directory, which is restored once the database is opened.
+		wd, err := os.Getwd()
+		if err != nil {
+			jobDatabaseErr = err
+			return
+		}
+		if err = os.Chdir(dir); err != nil {
+			jobDatabaseErr = err
+			return
+		}
+
+		engine, err := db.GetDatabaseEngine()
+		if chdirErr := os.Chdir(wd); err == nil {
+			err = chdirErr
+		}
+		if err == nil {
+			err = engine.Migrate()
+		}
+		if err != nil {
+			jobDatabaseErr = err
+			return
+		}
+
+		// SQLite allows a single writer, so the jobs of the tests are saved one by one.
+		sqlDB, err := engine.DB.DB()
+		if err != nil {
+			jobDatabaseErr = err
+			return
+		}
+		sqlDB.SetMaxOpenConns(1)
+
+		job := db.Job{
+			Type:           "interrupted",
+			State:          JobStateRunning,
+			TotalCount:     3,
+			SucceededCount: 1,
+			Items: []db.JobItem{
+				{ItemIndex: 0, Name: "item0", State: JobStateSucceeded},
+				{ItemIndex: 1, Name: "item1", State: JobStateRunning},
+				{ItemIndex: 2, Name: "item2", State: JobStatePending},
+			},
+		}
+		if err = job.Save(engine); err != nil {
+			jobDatabaseErr = err
+			return
+		}
+		interruptedJobID = job.ID
+
+		jobDatabaseErr = StartJobWorkers()
+	})
+
+	if jobDatabaseErr != nil {
+		t.Fatalf("Failed to set up the job workers: %v", jobDatabaseErr)
+	}
+}
+
+// waitJob waits until the job satisfies the condition, and returns the job saved in the database.
+func waitJob(t *testing.T, id uint, condition func(job *Job) bool) *Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job := &Job{ID: id}
+		if _, err := job.Get(context.Background()); err != nil {
+			t.Fatalf("Job.Get() error = %v", err)
+		}
+
+		if condition(job) {
+			return job
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("The job %d is still in state %s", id, job.State)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func isJobFinished(job *Job) bool {
+	return job.FinishedAt != nil
+}
+
+func TestSubmitJob(t *testing.T) {
+	setupJobWorkers(t)
+
+	if _, err := SubmitJob(context.Background(), "test", nil, nil); err == nil {
+		t.Errorf("SubmitJob() without items error = nil, want error")
+	}
+
+	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), "trace-submit")
+	names := []string{"item0", "item1", "item2"}
+	submitted, err := SubmitJob(ctx, "test", names, func(ctx context.Context, index int) (interface{}, error) {
+		if index == 1 {
+			return nil, errors.New("item1 fails")
+		}
+
+		return map[string]int{"index": index}, nil
+	})
+	if err != nil {
+		t.Fatalf("SubmitJob() error = %v", err)
+	}
+
+	if submitted.ID == 0 || submitted.State != JobStatePending || submitted.TotalCount != len(names) ||
+		submitted.TraceID != "trace-submit" || len(submitted.Items) != len(names) {
+		t.Errorf("SubmitJob() = %+v, want a pending job of %d items", submitted, len(names))
+	}
+
+	job := waitJob(t, submitted.ID, isJobFinished)
+
+	if job.State != JobStateFailed || job.SucceededCount != 2 || job.FailedCount != 1 || job.CancelledCount != 0 {
+		t.Errorf("Job state = %s, counts = %d/%d/%d, want %s, counts = 2/1/0", job.State,
+			job.SucceededCount, job.FailedCount, job.CancelledCount, JobStateFailed)
+	}
+	if job.StartedAt == nil {
+		t.Errorf("Job.StartedAt = nil, want the time the first item started")
+	}
+
+	wantItems := []JobItem{
+		{ItemIndex: 0, Name: "item0", State: JobStateSucceeded, Result: `{"index":0}`},
+		{ItemIndex: 1, Name: "item1", State: JobStateFailed, Error: "item1 fails"},
+		{ItemIndex: 2, Name: "item2", State: JobStateSucceeded, Result: `{"index":2}`},
+	}
+	if len(job.Items) != len(wantItems) {
+		t.Fatalf("Job.Items = %+v, want %+v", job.Items, wantItems)
+	}
+	for i, want := range wantItems {
+		if job.Items[i] != want {
+			t.Errorf("Job.Items[%d] = %+v, want %+v", i, job.Items[i], want)
+		}
+	}
+}
+
+func TestSubmitJob_workerPool(t *testing.T) {
+	setupJobWorkers(t)
+
+	started := make(chan int)
+	release := make(chan struct{})
+	var running, maxRunning int32
+
+	names := []string{"item0", "item1", "item2", "item3"}
+	submitted, err := SubmitJob(context.Background(), "test", names, func(ctx context.Context, index int) (interface{}, error) {
+		count := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if count <= max || atomic.CompareAndSwapInt32(&maxRunning, max, count) {
+				break
+			}
+		}
+
+		started <- index
+		<-release
+
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("SubmitJob() error = %v", err)
+	}
+
+	for i := 0; i < testJobWorkers; i++ {
+		<-started
+	}
+
+	select {
+	case index := <-started:
+		t.Errorf("The item %d started while %d items are running", index, testJobWorkers)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The items are run in order, so the first items are running while the others are still pending.
+	job := waitJob(t, submitted.ID, func(job *Job) bool {
+		return job.Items[0].State == JobStateRunning && job.Items[1].State == JobStateRunning
+	})
+	if job.State != JobStateRunning || job.StartedAt == nil {
+		t.Errorf("Job state = %s, StartedAt = %v, want %s", job.State, job.StartedAt, JobStateRunning)
+	}
+	for _, item := range job.Items[testJobWorkers:] {
+		if item.State != JobStatePending {
+			t.Errorf("Job item %d state = %s, want %s", item.ItemIndex, item.State, JobStatePending)
+		}
+	}
+
+	close(release)
+	for i := testJobWorkers; i < len(names); i++ {
+		<-started
+	}
+
+	job = waitJob(t, submitted.ID, isJobFinished)
+	if job.State != JobStateSucceeded || job.SucceededCount != len(names) {
+		t.Errorf("Job state = %s, succeeded = %d, want %s, succeeded = %d", job.State, job.SucceededCount,
+			JobStateSucceeded, len(names))
+	}
+
+	if got := atomic.LoadInt32(&maxRunning); got != testJobWorkers {
+		t.Errorf("Max running items = %d, want %d", got, testJobWorkers)
+	}
+}
+
+func TestJob_Cancel(t *testing.T) {
+	setupJobWorkers(t)
+
+	started := make(chan int, 3)
+
+	names := []string{"item0", "item1", "item2"}
+	submitted, err := SubmitJob(context.Background(), "test", names, func(ctx context.Context, index int) (interface{}, error) {
+		started <- index
+		<-ctx.Done()
+
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("SubmitJob() error = %v", err)
+	}
+
+	<-started
+
+	cancelled, err := (&Job{ID: submitted.ID}).Cancel(context.Background())
+	if err != nil {
+		t.Fatalf("Job.Cancel() error = %v", err)
+	}
+	if cancelled.State != JobStateCancelling {
+		t.Errorf("Job.Cancel() state = %s, want %s", cancelled.State, JobStateCancelling)
+	}
+
+	job := waitJob(t, submitted.ID, isJobFinished)
+	if job.State != JobStateCancelled || job.CancelledCount != len(names) {
+		t.Errorf("Job state = %s, cancelled = %d, want %s, cancelled = %d", job.State, job.CancelledCount,
+			JobStateCancelled, len(names))
+	}
+	for _, item := range job.Items {
+		if item.State != JobStateCancelled || item.Error == "" {
+			t.Errorf("Job item %d state = %s, error = %q, want %s with the error", item.ItemIndex, item.State,
+				item.Error, JobStateCancelled)
+		}
+	}
+
+	// The job is removed from the running jobs once it is finished.
+	waitRemoved := time.Now().Add(5 * time.Second)
+	for {
+		_, err = (&Job{ID: submitted.ID}).Cancel(context.Background())
+		if errors.Is(err, ErrJobFinished) || time.Now().After(waitRemoved) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Job.Cancel() of the finished job error = %v, want %v", err, ErrJobFinished)
+	}
+}
+
+func TestStartJobWorkers_failInterruptedJobs(t *testing.T) {
+	setupJobWorkers(t)
+
+	job := &Job{ID: interruptedJobID}
+	if _, err := job.Get(context.Background()); err != nil {
+		t.Fatalf("Job.Get() error = %v", err)
+	}
+
+	if job.State != JobStateFailed || job.FinishedAt == nil || job.SucceededCount != 1 || job.FailedCount != 2 {
+		t.Errorf("Job state = %s, FinishedAt = %v, counts = %d/%d, want %s, finished, counts = 1/2", job.State,
+			job.FinishedAt, job.SucceededCount, job.FailedCount, JobStateFailed)
+	}
+
+	wantStates := []string{JobStateSucceeded, JobStateFailed, JobStateFailed}
+	for i, item := range job.Items {
+		if item.State != wantStates[i] {
+			t.Errorf("Job item %d state = %s, want %s", i, item.State, wantStates[i])
+		}
+		if item.State == JobStateFailed && item.Error == "" {
+			t.Errorf("Job item %d error is empty, want the reason", i)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+)
+
+type KeyRotation struct {
+	// The ID of the key which encrypts the passwords now.
+	KeyID string
+	// The number of the passwords re-encrypted by the key.
+	ReencryptedCount int
+}
+
+// RotateEncryptionKey creates a new encryption key and re-encrypts the passwords in database by it. If the key store
+// does not support rotation, e.g. the keys are given by the environment variable, the passwords are re-encrypted by
+// its current key, i.e. the new key should be put in front of the variable before the call.
+func RotateEncryptionKey(ctx context.Context) (*KeyRotation, error) {
+	store, err := common.GetKeyStore()
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := store.Rotate()
+	if errors.Is(err, common.ErrRotationUnsupported) {
+		keyID, _, err = store.CurrentKey()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := db.ReencryptPasswords(engine)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyRotation{KeyID: keyID, ReencryptedCount: count}, nil
+}
@@ -0,0 +1,285 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+	"gorm.io/gorm"
+)
+
+type LocalGroup struct {
+	HostIP      string
+	GID         string
+	Name        string
+	Description string
+	Members     []string
+	Stale       bool
+}
+
+// Create creates the group on its host with the members, and saves the group reported by the host.
+func (g *LocalGroup) Create(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: g.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+	hostDriver, err := getHostDriver(host, driver.CapabilityLocalGroup)
+	if err != nil {
+		return err
+	}
+
+	detail, err := hostDriver.CreateLocalGroup(ctx, g.Name, g.Description)
+	if err != nil {
+		return err
+	}
+
+	if len(g.Members) > 0 {
+		if err = hostDriver.AddLocalGroupMembers(ctx, g.Name, g.Members); err != nil {
+			return err
+		}
+
+		if detail, err = hostDriver.GetLocalGroupDetail(ctx, g.Name); err != nil {
+			return err
+		}
+	}
+
+	return g.save(engine, detail)
+}
+
+func (g *LocalGroup) Delete(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: g.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	hostDriver, err := getHostDriver(host, driver.CapabilityLocalGroup)
+	if err != nil {
+		return err
+	}
+	if err := hostDriver.DeleteLocalGroup(ctx, g.Name); err != nil {
+		return err
+	}
+
+	localGroup := db.LocalGroup{
+		HostIP: g.HostIP,
+		Name:   g.Name,
+	}
+	return localGroup.Delete(engine)
+}
+
+func (g *LocalGroup) Get(ctx context.Context) (*LocalGroup, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	localGroup := db.LocalGroup{
+		HostIP: g.HostIP,
+		Name:   g.Name,
+	}
+	if err = localGroup.Get(engine); err != nil {
+		return nil, err
+	}
+
+	*g = fromLocalGroup(localGroup)
+
+	return g, nil
+}
+
+// AddMembers adds the local users to the group on its host, and saves the members reported by the host.
+func (g *LocalGroup) AddMembers(ctx context.Context, members []string) (err error) {
+	return g.updateMembers(ctx, func(hostDriver driver.Driver) error {
+		return hostDriver.AddLocalGroupMembers(ctx, g.Name, members)
+	})
+}
+
+// RemoveMembers removes the local users from the group on its host, and saves the members reported by the host.
+func (g *LocalGroup) RemoveMembers(ctx context.Context, members []string) (err error) {
+	return g.updateMembers(ctx, func(hostDriver driver.Driver) error {
+		return hostDriver.RemoveLocalGroupMembers(ctx, g.Name, members)
+	})
+}
+
+// updateMembers changes the members on the host by the update, the group must be managed by the engine already.
+func (g *LocalGroup) updateMembers(ctx context.Context, update func(hostDriver driver.Driver) error) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	localGroup := db.LocalGroup{HostIP: g.HostIP, Name: g.Name}
+	if err = localGroup.Get(engine); err != nil {
+		return err
+	}
+
+	host := db.Host{IP: g.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	hostDriver, err := getHostDriver(host, driver.CapabilityLocalGroup)
+	if err != nil {
+		return err
+	}
+
+	if err = update(hostDriver); err != nil {
+		return err
+	}
+
+	detail, err := hostDriver.GetLocalGroupDetail(ctx, g.Name)
+	if err != nil {
+		return err
+	}
+
+	return g.save(engine, detail)
+}
+
+// Manage saves the group existing on its host already, so that it is managed by the engine.
+func (g *LocalGroup) Manage(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	host := db.Host{IP: g.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+	hostDriver, err := getHostDriver(host, driver.CapabilityLocalGroup)
+	if err != nil {
+		return err
+	}
+
+	detail, err := hostDriver.GetLocalGroupDetail(ctx, g.Name)
+	if err != nil {
+		return err
+	}
+
+	return g.save(engine, detail)
+}
+
+func (g *LocalGroup) Unmanage(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	localGroup := db.LocalGroup{
+		HostIP: g.HostIP,
+		Name:   g.Name,
+	}
+	return localGroup.Delete(engine)
+}
+
+// save saves the group by the detail reported by the host, the group saved already is replaced.
+func (g *LocalGroup) save(engine *db.DatabaseEngine, detail common.LocalGroupDetail) error {
+	localGroup := db.LocalGroup{HostIP: g.HostIP, Name: detail.Name}
+	if err := localGroup.Get(engine); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	localGroup.GID = detail.GID
+	localGroup.Description = detail.Description
+	localGroup.Stale = false
+	localGroup.Members = toLocalGroupMembers(detail.Members)
+
+	if err := localGroup.Save(engine); err != nil {
+		return err
+	}
+
+	*g = fromLocalGroup(localGroup)
+
+	return nil
+}
+
+func toLocalGroupMembers(members []string) []db.LocalGroupMember {
+	groupMembers := make([]db.LocalGroupMember, len(members))
+	for i, member := range members {
+		groupMembers[i] = db.LocalGroupMember{UserName: member}
+	}
+
+	return groupMembers
+}
+
+func fromLocalGroup(localGroup db.LocalGroup) LocalGroup {
+	g := LocalGroup{
+		HostIP:      localGroup.HostIP,
+		GID:         localGroup.GID,
+		Name:        localGroup.Name,
+		Description: localGroup.Description,
+		Stale:       localGroup.Stale,
+	}
+
+	for _, member := range localGroup.Members {
+		g.Members = append(g.Members, member.UserName)
+	}
+
+	return g
+}
+
+type LocalGroupList struct {
+	LocalGroups []LocalGroup
+}
+
+func (gl *LocalGroupList) Get(ctx context.Context, filter *common.QueryFilter) ([]LocalGroup, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	localGroupList := db.LocalGroupList{}
+
+	if err = localGroupList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	for _, localGroup := range localGroupList.LocalGroups {
+		gl.LocalGroups = append(gl.LocalGroups, fromLocalGroup(localGroup))
+	}
+
+	return gl.LocalGroups, nil
+}
+
+type PaginationLocalGroup struct {
+	LocalGroups []LocalGroup
+	Page        int
+	Limit       int
+	TotalCount  int64
+}
+
+func (gl *LocalGroupList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationLocalGroup, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	localGroupList := db.LocalGroupList{}
+	paginationLocalGroups, err := localGroupList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationLocalGroupList := PaginationLocalGroup{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationLocalGroups.TotalCount,
+	}
+
+	for _, localGroup := range paginationLocalGroups.LocalGroups {
+		paginationLocalGroupList.LocalGroups = append(paginationLocalGroupList.LocalGroups, fromLocalGroup(localGroup))
+	}
+
+	return &paginationLocalGroupList, nil
+}
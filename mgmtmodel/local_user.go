@@ -23,6 +23,7 @@ type LocalUser struct {
 	IsPasswordChangeable bool
 	IsPasswordRequired   bool
 	IsLockout            bool
+	Stale                bool
 }
 
 func (u *LocalUser) Create(ctx context.Context) (err error) {
@@ -36,14 +37,11 @@ func (u *LocalUser) Create(ctx context.Context) (err error) {
 	if err = host.Get(engine); err != nil {
 		return err
 	}
-	driver := driver.GetDriver(host.StorageType)
-
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityLocalUser)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
+
 	localUserDetail, err := driver.CreateLocalUser(ctx, u.Name, u.Password)
 	if err != nil {
 		return err
@@ -74,15 +72,11 @@ func (u *LocalUser) Delete(ctx context.Context) (err error) {
 		return err
 	}
 
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
-	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
 	// Delete the local user on agent host.
-	driver := driver.GetDriver(host.StorageType)
+	driver, err := getHostDriver(host, driver.CapabilityLocalUser)
+	if err != nil {
+		return err
+	}
 	if err := driver.DeleteLocalUser(ctx, u.Name); err != nil {
 		return err
 	}
@@ -113,6 +107,54 @@ func (u *LocalUser) Get(ctx context.Context) (*LocalUser, error) {
 	return u, nil
 }
 
+// Update changes the local user on its host, and saves the new password and the status of the user reported by the host.
+func (u *LocalUser) Update(ctx context.Context, update common.LocalUserUpdate) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	localUser := db.LocalUser{HostIP: u.HostIP, Name: u.Name}
+	if err = localUser.Get(engine); err != nil {
+		return err
+	}
+
+	host := db.Host{IP: u.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	hostDriver, err := getHostDriver(host, driver.CapabilityLocalUser)
+	if err != nil {
+		return err
+	}
+
+	if err = hostDriver.UpdateLocalUser(ctx, u.Name, update); err != nil {
+		return err
+	}
+
+	if update.Password != "" {
+		localUser.Password = update.Password
+	}
+
+	// The status is changed as requested if the host does not report it.
+	if detail, err := hostDriver.GetLocalUserDetail(ctx, u.Name); err == nil {
+		common.DeepCopy(detail, &localUser)
+	} else {
+		if update.Disabled != nil {
+			localUser.IsDisabled = *update.Disabled
+		}
+		if update.Unlock {
+			localUser.IsLockout = false
+		}
+	}
+
+	// update the content in mgmt model before save to database.
+	common.DeepCopy(localUser, u)
+
+	return localUser.Save(engine)
+}
+
 func (u *LocalUser) Manage(ctx context.Context) (err error) {
 	engine, err := db.GetDatabaseEngine()
 	if err != nil {
@@ -124,14 +166,11 @@ func (u *LocalUser) Manage(ctx context.Context) (err error) {
 	if err = host.Get(engine); err != nil {
 		return err
 	}
-	driver := driver.GetDriver(host.StorageType)
-
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityLocalUser)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
+
 	localUserDetail, err := driver.GetLocalUserDetail(ctx, u.Name)
 	if err != nil {
 		return err
@@ -193,14 +232,11 @@ func (ul *LocalUserList) Create(ctx context.Context) error {
 				return err
 			}
 
-			hostContext := common.HostContext{
-				IP:       host.IP,
-				Username: host.Username,
-				Password: host.Password,
+			driver, err := getHostDriver(host, driver.CapabilityLocalUser)
+			if err != nil {
+				resultErr = errors.Join(resultErr, err)
+				return err
 			}
-			ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-			driver := driver.GetDriver(host.StorageType)
 			localUserDetail, err := driver.CreateLocalUser(ctx, localUser.Name, localUser.Password)
 			if err != nil {
 				resultErr = errors.Join(resultErr, err)
@@ -255,14 +291,11 @@ func (ul *LocalUserList) Delete(ctx context.Context, filter *common.QueryFilter)
 				return err
 			}
 
-			hostContext := common.HostContext{
-				IP:       host.IP,
-				Username: host.Username,
-				Password: host.Password,
+			driver, err := getHostDriver(host, driver.CapabilityLocalUser)
+			if err != nil {
+				resultErr = errors.Join(resultErr, err)
+				return err
 			}
-			ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-			driver := driver.GetDriver(host.StorageType)
 			localUserDetail, err := driver.GetLocalUserDetail(ctx, localUser.Name)
 			if err != nil {
 				resultErr = errors.Join(resultErr, err)
@@ -337,14 +370,11 @@ func (ul *LocalUserList) Manage(ctx context.Context) error {
 				return err
 			}
 
-			hostContext := common.HostContext{
-				IP:       host.IP,
-				Username: host.Username,
-				Password: host.Password,
+			driver, err := getHostDriver(host, driver.CapabilityLocalUser)
+			if err != nil {
+				resultErr = errors.Join(resultErr, err)
+				return err
 			}
-			ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-			driver := driver.GetDriver(host.StorageType)
 			localUserDetail, err := driver.GetLocalUserDetail(ctx, localUser.Name)
 			if err != nil {
 				resultErr = errors.Join(resultErr, err)
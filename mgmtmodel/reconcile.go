@@ -0,0 +1,471 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+)
+
+const (
+	DriftResourceDirectory = "directory"
+	DriftResourceShare     = "share"
+	DriftResourceLocalUser = "local_user"
+)
+
+const (
+	// DriftTypeMissing is the resource which is recorded in database but not found on the host.
+	DriftTypeMissing = "missing"
+	// DriftTypeExtra is the resource which is found on the host but not recorded in database.
+	DriftTypeExtra = "extra"
+	// DriftTypeChanged is the resource whose attributes on the host differ from its record.
+	DriftTypeChanged = "changed"
+)
+
+const (
+	DriftActionImported    = "imported"
+	DriftActionUpdated     = "updated"
+	DriftActionMarkedStale = "marked_stale"
+)
+
+type DriftItem struct {
+	ResourceType string
+	Name         string
+	DriftType    string
+	Detail       string
+	Action       string
+	Error        string
+}
+
+type DriftReport struct {
+	ID           uint
+	HostIP       string
+	TraceID      string
+	AutoImport   bool
+	MarkStale    bool
+	MissingCount int
+	ExtraCount   int
+	ChangedCount int
+	CreatedAt    time.Time
+
+	Items []DriftItem
+}
+
+type ReconcileOptions struct {
+	// AutoImport imports the extra resources into database and refreshes the records of the changed ones.
+	AutoImport bool
+	// MarkStale marks the records of the missing resources as stale.
+	MarkStale bool
+}
+
+// attributeChanges collects the attributes of a resource which differ from its record.
+type attributeChanges []string
+
+func (c *attributeChanges) compare(attribute string, recorded, actual interface{}) {
+	if recorded != actual {
+		*c = append(*c, fmt.Sprintf("%s: %v -> %v", attribute, recorded, actual))
+	}
+}
+
+func (c attributeChanges) String() string {
+	return strings.Join(c, "; ")
+}
+
+// getShareDirectoryName returns the name of the shared directory by its path on either Linux or Windows.
+func getShareDirectoryName(directoryPath string) string {
+	directoryPath = strings.TrimRight(directoryPath, `/\`)
+
+	return directoryPath[strings.LastIndexAny(directoryPath, `/\`)+1:]
+}
+
+// reconciliation compares the records of a host in database with the resources on the host.
+type reconciliation struct {
+	engine  *db.DatabaseEngine
+	host    db.Host
+	options ReconcileOptions
+	report  db.DriftReport
+}
+
+// addItem records the drift, the error to take the action on the record is kept in the item.
+func (r *reconciliation) addItem(resourceType, name, driftType, detail, action string, err error) {
+	item := db.DriftItem{
+		ResourceType: resourceType,
+		Name:         name,
+		DriftType:    driftType,
+		Detail:       detail,
+		Action:       action,
+	}
+	if err != nil {
+		item.Action = ""
+		item.Error = err.Error()
+	}
+
+	switch driftType {
+	case DriftTypeMissing:
+		r.report.MissingCount++
+	case DriftTypeExtra:
+		r.report.ExtraCount++
+	case DriftTypeChanged:
+		r.report.ChangedCount++
+	}
+
+	r.report.Items = append(r.report.Items, item)
+}
+
+func (r *reconciliation) getHostFilter() *common.QueryFilter {
+	return &common.QueryFilter{
+		Conditions: struct {
+			HostIP string
+		}{
+			HostIP: r.host.IP,
+		},
+	}
+}
+
+func (r *reconciliation) reconcileDirectories(ctx context.Context, hostDriver driver.Driver) error {
+	details, err := hostDriver.GetDirectoriesDetail(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get the directories on the host %s: %w", r.host.IP, err)
+	}
+
+	directoryList := db.DirectoryList{}
+	if err = directoryList.Get(r.engine, r.getHostFilter()); err != nil {
+		return err
+	}
+
+	actual := make(map[string]common.DirectoryDetail, len(details))
+	for _, detail := range details {
+		actual[detail.Name] = detail
+	}
+
+	recorded := make(map[string]bool, len(directoryList.Directories))
+	for _, directory := range directoryList.Directories {
+		recorded[directory.Name] = true
+
+		detail, exist := actual[directory.Name]
+		if !exist {
+			var action string
+			var err error
+			if r.options.MarkStale && directory.Exist {
+				directory.Exist = false
+				action, err = DriftActionMarkedStale, directory.Update(r.engine, "exist")
+			}
+			r.addItem(DriftResourceDirectory, directory.Name, DriftTypeMissing, "", action, err)
+			continue
+		}
+
+		var changes attributeChanges
+		changes.compare("exist", directory.Exist, detail.Exist)
+		changes.compare("full_path", directory.FullPath, detail.FullPath)
+		changes.compare("creation_time", directory.CreationTime, detail.CreationTime)
+		changes.compare("last_write_time", directory.LastWriteTime, detail.LastWriteTime)
+		if len(changes) == 0 {
+			continue
+		}
+
+		var action string
+		var err error
+		if r.options.AutoImport {
+			directory.Exist = detail.Exist
+			directory.FullPath = detail.FullPath
+			directory.ParentFullPath = detail.ParentFullPath
+			directory.CreationTime = detail.CreationTime
+			directory.LastAccessTime = detail.LastAccessTime
+			directory.LastWriteTime = detail.LastWriteTime
+			action, err = DriftActionUpdated, directory.Update(r.engine, "exist", "full_path", "parent_full_path",
+				"creation_time", "last_access_time", "last_write_time")
+		}
+		r.addItem(DriftResourceDirectory, directory.Name, DriftTypeChanged, changes.String(), action, err)
+	}
+
+	for _, detail := range details {
+		if recorded[detail.Name] {
+			continue
+		}
+
+		var action string
+		var err error
+		if r.options.AutoImport {
+			directory := db.Directory{
+				Name:           detail.Name,
+				HostIP:         r.host.IP,
+				CreationTime:   detail.CreationTime,
+				LastAccessTime: detail.LastAccessTime,
+				LastWriteTime:  detail.LastWriteTime,
+				Exist:          detail.Exist,
+				FullPath:       detail.FullPath,
+				ParentFullPath: detail.ParentFullPath,
+			}
+			action, err = DriftActionImported, directory.Save(r.engine)
+		}
+		r.addItem(DriftResourceDirectory, detail.Name, DriftTypeExtra, "", action, err)
+	}
+
+	return nil
+}
+
+func (r *reconciliation) reconcileShares(ctx context.Context, hostDriver driver.Driver) error {
+	details, err := hostDriver.GetCIFSSharesDetail(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get the shares on the host %s: %w", r.host.IP, err)
+	}
+
+	shareList := db.CIFSShareList{}
+	if err = shareList.Get(r.engine, r.getHostFilter()); err != nil {
+		return err
+	}
+
+	actual := make(map[string]common.ShareDetail, len(details))
+	for _, detail := range details {
+		actual[detail.Name] = detail
+	}
+
+	recorded := make(map[string]bool, len(shareList.Shares))
+	for _, share := range shareList.Shares {
+		recorded[share.Name] = true
+
+		detail, exist := actual[share.Name]
+		if !exist {
+			var action string
+			var err error
+			if r.options.MarkStale && !share.Stale {
+				share.Stale = true
+				action, err = DriftActionMarkedStale, share.Update(r.engine, "stale")
+			}
+			r.addItem(DriftResourceShare, share.Name, DriftTypeMissing, "", action, err)
+			continue
+		}
+
+		var changes attributeChanges
+		changes.compare("stale", share.Stale, false)
+		changes.compare("directory_name", share.DirectoryName, getShareDirectoryName(detail.DirectoryPath))
+		changes.compare("description", share.Description, detail.Description)
+		if len(changes) == 0 {
+			continue
+		}
+
+		var action string
+		var err error
+		if r.options.AutoImport {
+			share.Stale = false
+			share.DirectoryName = getShareDirectoryName(detail.DirectoryPath)
+			share.Description = detail.Description
+			action, err = DriftActionUpdated, share.Update(r.engine, "stale", "directory_name", "description")
+		}
+		r.addItem(DriftResourceShare, share.Name, DriftTypeChanged, changes.String(), action, err)
+	}
+
+	for _, detail := range details {
+		if recorded[detail.Name] {
+			continue
+		}
+
+		var action string
+		var err error
+		if r.options.AutoImport {
+			share := db.CIFSShare{
+				Name:          detail.Name,
+				HostIP:        r.host.IP,
+				Path:          buildCIFSSharePath(r.host.IP, detail.Name),
+				DirectoryName: getShareDirectoryName(detail.DirectoryPath),
+				Description:   detail.Description,
+			}
+			action, err = DriftActionImported, share.Save(r.engine)
+		}
+		r.addItem(DriftResourceShare, detail.Name, DriftTypeExtra, "", action, err)
+	}
+
+	return nil
+}
+
+func (r *reconciliation) reconcileLocalUsers(ctx context.Context, hostDriver driver.Driver) error {
+	details, err := hostDriver.GetLocalUsersDetail(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to get the local users on the host %s: %w", r.host.IP, err)
+	}
+
+	localUserList := db.LocalUserList{}
+	if err = localUserList.Get(r.engine, r.getHostFilter()); err != nil {
+		return err
+	}
+
+	actual := make(map[string]common.LocalUserDetail, len(details))
+	for _, detail := range details {
+		actual[detail.Name] = detail
+	}
+
+	recorded := make(map[string]bool, len(localUserList.LocalUsers))
+	for _, localUser := range localUserList.LocalUsers {
+		recorded[localUser.Name] = true
+
+		detail, exist := actual[localUser.Name]
+		if !exist {
+			var action string
+			var err error
+			if r.options.MarkStale && !localUser.Stale {
+				localUser.Stale = true
+				action, err = DriftActionMarkedStale, localUser.Update(r.engine, "stale")
+			}
+			r.addItem(DriftResourceLocalUser, localUser.Name, DriftTypeMissing, "", action, err)
+			continue
+		}
+
+		var changes attributeChanges
+		changes.compare("stale", localUser.Stale, false)
+		changes.compare("user_id", localUser.UID, detail.UID)
+		changes.compare("full_name", localUser.Fullname, detail.FullName)
+		changes.compare("description", localUser.Description, detail.Description)
+		changes.compare("is_disabled", localUser.IsDisabled, detail.IsDisabled)
+		changes.compare("is_lockout", localUser.IsLockout, detail.IsLockout)
+		if len(changes) == 0 {
+			continue
+		}
+
+		var action string
+		var err error
+		if r.options.AutoImport {
+			localUser.Stale = false
+			common.DeepCopy(detail, &localUser)
+			localUser.Fullname = detail.FullName
+			action, err = DriftActionUpdated, localUser.Update(r.engine, "stale", "user_id", "full_name", "description",
+				"status", "is_disabled", "is_password_expired", "is_password_changeable", "is_password_required", "is_lockout")
+		}
+		r.addItem(DriftResourceLocalUser, localUser.Name, DriftTypeChanged, changes.String(), action, err)
+	}
+
+	for _, detail := range details {
+		if recorded[detail.Name] {
+			continue
+		}
+
+		var action string
+		var err error
+		if r.options.AutoImport {
+			// The password of the imported user is unknown to the engine.
+			localUser := db.LocalUser{HostIP: r.host.IP}
+			common.DeepCopy(detail, &localUser)
+			localUser.Fullname = detail.FullName
+			action, err = DriftActionImported, localUser.Save(r.engine)
+		}
+		r.addItem(DriftResourceLocalUser, detail.Name, DriftTypeExtra, "", action, err)
+	}
+
+	return nil
+}
+
+// Reconcile compares the directories, shares and local users recorded in database with the ones on the host, and
+// saves the differences as a drift report. The resources which the driver of the host does not support are skipped.
+func (h *Host) Reconcile(ctx context.Context, options ReconcileOptions) (*DriftReport, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	host := db.Host{IP: h.IP}
+	if err = host.Get(engine); err != nil {
+		return nil, err
+	}
+
+	traceID, _ := ctx.Value(common.TraceIDKey("TraceID")).(string)
+
+	r := reconciliation{
+		engine:  engine,
+		host:    host,
+		options: options,
+		report: db.DriftReport{
+			HostIP:     host.IP,
+			TraceID:    traceID,
+			AutoImport: options.AutoImport,
+			MarkStale:  options.MarkStale,
+		},
+	}
+
+	steps := []struct {
+		capability driver.Capability
+		reconcile  func(ctx context.Context, hostDriver driver.Driver) error
+	}{
+		{capability: driver.CapabilityDirectory, reconcile: r.reconcileDirectories},
+		{capability: driver.CapabilityCIFS, reconcile: r.reconcileShares},
+		{capability: driver.CapabilityLocalUser, reconcile: r.reconcileLocalUsers},
+	}
+
+	for _, step := range steps {
+		hostDriver, err := getHostDriver(host, step.capability)
+		if err != nil {
+			var unsupportedErr *driver.UnsupportedOperationError
+			if errors.As(err, &unsupportedErr) && unsupportedErr.Capability != "" {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if err = step.reconcile(ctx, hostDriver); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = r.report.Save(engine); err != nil {
+		return nil, fmt.Errorf("failed to save the drift report of the host %s: %w", host.IP, err)
+	}
+
+	report := DriftReport{}
+	common.DeepCopy(r.report, &report)
+
+	return &report, nil
+}
+
+type DriftReportList struct {
+	Reports []DriftReport
+}
+
+func (rl *DriftReportList) Get(ctx context.Context, filter *common.QueryFilter) ([]DriftReport, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	reportList := db.DriftReportList{}
+	if err = reportList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	common.DeepCopy(reportList.Reports, &rl.Reports)
+
+	return rl.Reports, nil
+}
+
+type PaginationDriftReport struct {
+	Reports    []DriftReport
+	Page       int
+	Limit      int
+	TotalCount int64
+}
+
+func (rl *DriftReportList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationDriftReport, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	reportList := db.DriftReportList{}
+	paginationReports, err := reportList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationReportList := PaginationDriftReport{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationReports.TotalCount,
+	}
+
+	common.DeepCopy(paginationReports.Reports, &paginationReportList.Reports)
+
+	return &paginationReportList, nil
+}
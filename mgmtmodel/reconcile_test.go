@@ -0,0 +1,50 @@
+package mgmtmodel
+
+import "testing"
+
+func Test_getShareDirectoryName(t *testing.T) {
+	tests := []struct {
+		name          string
+		directoryPath string
+		want          string
+	}{
+		{
+			name:          "Linux path",
+			directoryPath: "/mnt/data/share1",
+			want:          "share1",
+		},
+		{
+			name:          "Windows path",
+			directoryPath: `C:\test\share1`,
+			want:          "share1",
+		},
+		{
+			name:          "ONTAP path with trailing slash",
+			directoryPath: "/dme/share1/",
+			want:          "share1",
+		},
+		{
+			name:          "Name only",
+			directoryPath: "share1",
+			want:          "share1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getShareDirectoryName(tt.directoryPath); got != tt.want {
+				t.Errorf("getShareDirectoryName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_attributeChanges_compare(t *testing.T) {
+	var changes attributeChanges
+	changes.compare("description", "old", "new")
+	changes.compare("is_disabled", false, false)
+	changes.compare("exist", false, true)
+
+	if got, want := changes.String(), "description: old -> new; exist: false -> true"; got != want {
+		t.Errorf("attributeChanges.String() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,461 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+const (
+	ReplicationResultSucceeded = "succeeded"
+	ReplicationResultFailed    = "failed"
+)
+
+const defaultReplicationInterval = 60 * time.Second
+
+// The number of the replications transferred at the same time by the schedule.
+const maxConcurrentReplications = 4
+
+var (
+	// ErrReplicationExists is returned on creating the replication to the directory which is a destination already.
+	ErrReplicationExists = errors.New("the destination directory is replicated already")
+	// ErrReplicationLoop is returned on creating the replication to the directory which the source is replicated from.
+	ErrReplicationLoop = errors.New("the source directory is replicated from the destination directory")
+	// ErrReplicationRunning is returned on transferring or deleting the replication being transferred.
+	ErrReplicationRunning = errors.New("the replication is being transferred")
+)
+
+// The replications being transferred by their destination directory, a replication is transferred once at a time.
+var (
+	replicationMu       sync.Mutex
+	runningReplications = make(map[string]bool)
+)
+
+// ReplicationInterval returns the interval between the checks of the replications, the replications are transferred
+// by their frequency at the checks.
+func ReplicationInterval() time.Duration {
+	if interval := time.Duration(common.Config.Scheduler.ReplicationInterval) * time.Second; interval > 0 {
+		return interval
+	}
+
+	return defaultReplicationInterval
+}
+
+// Replication keeps the destination directory the same as the source directory on another host. The destination
+// agent pulls the files changed from the source agent, and the files not in the source directory are deleted.
+type Replication struct {
+	SourceHostIP             string
+	SourceDirectoryName      string
+	DestinationHostIP        string
+	DestinationDirectoryName string
+	Frequency                string
+	Running                  bool
+	LastRunTime              *time.Time
+	LastSuccessTime          *time.Time
+	LastResult               string
+	LastError                string
+	LastDuration             time.Duration
+	LastTransfer             common.ReplicationResult
+}
+
+// Lag returns how long the destination lags behind the source, i.e. the time since the start of the last successful
+// transfer. It is nil if no transfer has succeeded.
+func (r *Replication) Lag(now time.Time) *time.Duration {
+	if r.LastSuccessTime == nil {
+		return nil
+	}
+
+	lag := now.Sub(*r.LastSuccessTime)
+
+	return &lag
+}
+
+func (r *Replication) Create(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	if err = validateReplicationFrequency(r.Frequency); err != nil {
+		return err
+	}
+
+	if r.SourceHostIP == r.DestinationHostIP && r.SourceDirectoryName == r.DestinationDirectoryName {
+		return errors.New("the source and the destination of the replication are the same directory")
+	}
+
+	source := Directory{Name: r.SourceDirectoryName, HostIP: r.SourceHostIP}
+	if _, _, err = source.getDirectoryDriver(engine, driver.CapabilityReplication); err != nil {
+		return err
+	}
+
+	destination := Directory{Name: r.DestinationDirectoryName, HostIP: r.DestinationHostIP}
+	if _, _, err = destination.getDirectoryDriver(engine, driver.CapabilityReplication); err != nil {
+		return err
+	}
+
+	existing := db.Replication{DestinationHostIP: r.DestinationHostIP, DestinationDirectoryName: r.DestinationDirectoryName}
+	if err = existing.Get(engine); err == nil {
+		return ErrReplicationExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	reverse := db.Replication{
+		SourceHostIP:             r.DestinationHostIP,
+		SourceDirectoryName:      r.DestinationDirectoryName,
+		DestinationHostIP:        r.SourceHostIP,
+		DestinationDirectoryName: r.SourceDirectoryName,
+	}
+	if err = reverse.Get(engine); err == nil {
+		return ErrReplicationLoop
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	replication := db.Replication{
+		SourceHostIP:             r.SourceHostIP,
+		SourceDirectoryName:      r.SourceDirectoryName,
+		DestinationHostIP:        r.DestinationHostIP,
+		DestinationDirectoryName: r.DestinationDirectoryName,
+		Frequency:                r.Frequency,
+	}
+	if err = replication.Save(engine); err != nil {
+		return err
+	}
+
+	*r = fromReplication(replication)
+
+	return nil
+}
+
+// Update changes the frequency of the replication, the empty frequency means it is transferred on request only.
+func (r *Replication) Update(ctx context.Context, frequency string) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	if err = validateReplicationFrequency(frequency); err != nil {
+		return err
+	}
+
+	replication := db.Replication{DestinationHostIP: r.DestinationHostIP, DestinationDirectoryName: r.DestinationDirectoryName}
+	if err = replication.Get(engine); err != nil {
+		return err
+	}
+
+	replication.Frequency = frequency
+	if err = replication.Update(engine, "frequency"); err != nil {
+		return err
+	}
+
+	*r = fromReplication(replication)
+
+	return nil
+}
+
+// Delete deletes the replication, the files replicated to the destination directory are kept.
+func (r *Replication) Delete(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	replication := db.Replication{DestinationHostIP: r.DestinationHostIP, DestinationDirectoryName: r.DestinationDirectoryName}
+	if err = replication.Get(engine); err != nil {
+		return err
+	}
+
+	if isReplicationRunning(replication) {
+		return ErrReplicationRunning
+	}
+
+	return replication.Delete(engine)
+}
+
+func (r *Replication) Get(ctx context.Context) (*Replication, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	replication := db.Replication{DestinationHostIP: r.DestinationHostIP, DestinationDirectoryName: r.DestinationDirectoryName}
+	if err = replication.Get(engine); err != nil {
+		return nil, err
+	}
+
+	*r = fromReplication(replication)
+
+	return r, nil
+}
+
+// Start transfers the replication in the background, the result of the transfer is saved with the replication.
+func (r *Replication) Start(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	replication := db.Replication{DestinationHostIP: r.DestinationHostIP, DestinationDirectoryName: r.DestinationDirectoryName}
+	if err = replication.Get(engine); err != nil {
+		return err
+	}
+
+	if !acquireReplication(replication) {
+		return ErrReplicationRunning
+	}
+
+	// The transfer outlives the request which starts it.
+	traceID, _ := ctx.Value(common.TraceIDKey("TraceID")).(string)
+	transferCtx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), traceID)
+
+	go func() {
+		defer releaseReplication(replication)
+
+		if err := transferReplication(transferCtx, engine, replication); err != nil {
+			common.Logger.WithFields(log.Fields{
+				"TraceID":     traceID,
+				"Destination": replication.DestinationHostIP + ":" + replication.DestinationDirectoryName,
+				"error":       err.Error(),
+			}).Error("Failed to transfer the replication.")
+		}
+	}()
+
+	*r = fromReplication(replication)
+	r.Running = true
+
+	return nil
+}
+
+// RunDueReplications transfers the replications whose frequency passes since their last transfer. The replication
+// failed is transferred again after its frequency passes, or on request.
+func RunDueReplications(ctx context.Context, now time.Time) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	replicationList := db.ReplicationList{}
+	if err = replicationList.Get(engine, &common.QueryFilter{}); err != nil {
+		return err
+	}
+
+	g, _ := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentReplications)
+
+	errs := make([]error, len(replicationList.Replications))
+
+	for i := range replicationList.Replications {
+		index := i // 避免闭包问题
+		replication := replicationList.Replications[index]
+
+		interval, ok := common.SnapshotFrequencyInterval(replication.Frequency)
+		if !ok || !isScheduleDue(replication.LastRunTime, interval, now) {
+			continue
+		}
+
+		g.Go(func() error {
+			if !acquireReplication(replication) {
+				return nil
+			}
+			defer releaseReplication(replication)
+
+			errs[index] = transferReplication(ctx, engine, replication)
+
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	return errors.Join(errs...)
+}
+
+// transferReplication lets the destination host pull the source directory, and saves the result of the transfer.
+func transferReplication(ctx context.Context, engine *db.DatabaseEngine, replication db.Replication) error {
+	start := time.Now()
+
+	result, err := pullReplication(ctx, engine, replication)
+
+	replication.LastRunTime = &start
+	replication.LastDuration = time.Since(start).Milliseconds()
+	replication.FilesTransferred = result.FilesTransferred
+	replication.BytesTransferred = result.BytesTransferred
+	replication.FilesResumed = result.FilesResumed
+	replication.FilesUnchanged = result.FilesUnchanged
+	replication.FilesDeleted = result.FilesDeleted
+
+	if err != nil {
+		replication.LastResult = ReplicationResultFailed
+		replication.LastError = err.Error()
+	} else {
+		replication.LastResult = ReplicationResultSucceeded
+		replication.LastError = ""
+		replication.LastSuccessTime = &start
+	}
+
+	saveErr := replication.Update(engine, "last_run_time", "last_success_time", "last_result", "last_error", "last_duration",
+		"files_transferred", "bytes_transferred", "files_resumed", "files_unchanged", "files_deleted")
+
+	return errors.Join(err, saveErr)
+}
+
+func pullReplication(ctx context.Context, engine *db.DatabaseEngine, replication db.Replication) (result common.ReplicationResult, err error) {
+	sourceModel := Directory{Name: replication.SourceDirectoryName, HostIP: replication.SourceHostIP}
+	_, sourceDriver, err := sourceModel.getDirectoryDriver(engine, driver.CapabilityReplication)
+	if err != nil {
+		return result, fmt.Errorf("failed to connect the source of the replication: %w", err)
+	}
+
+	destinationModel := Directory{Name: replication.DestinationDirectoryName, HostIP: replication.DestinationHostIP}
+	_, destinationDriver, err := destinationModel.getDirectoryDriver(engine, driver.CapabilityReplication)
+	if err != nil {
+		return result, fmt.Errorf("failed to connect the destination of the replication: %w", err)
+	}
+
+	source, err := sourceDriver.CreateReplicationSource(ctx, replication.SourceDirectoryName)
+	if err != nil {
+		return result, err
+	}
+
+	return destinationDriver.PullReplication(ctx, replication.DestinationDirectoryName, source)
+}
+
+func validateReplicationFrequency(frequency string) error {
+	if _, ok := common.SnapshotFrequencyInterval(frequency); frequency != "" && !ok {
+		return fmt.Errorf("invalid frequency of the replication: %s", frequency)
+	}
+
+	return nil
+}
+
+func replicationKey(replication db.Replication) string {
+	return replication.DestinationHostIP + ":" + replication.DestinationDirectoryName
+}
+
+// acquireReplication marks the replication as being transferred, it returns false if it is being transferred already.
+func acquireReplication(replication db.Replication) bool {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	key := replicationKey(replication)
+	if runningReplications[key] {
+		return false
+	}
+	runningReplications[key] = true
+
+	return true
+}
+
+func releaseReplication(replication db.Replication) {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	delete(runningReplications, replicationKey(replication))
+}
+
+func isReplicationRunning(replication db.Replication) bool {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	return runningReplications[replicationKey(replication)]
+}
+
+// deleteDirectoryReplications deletes the replications from and to the directory.
+func deleteDirectoryReplications(engine *db.DatabaseEngine, hostIP, directoryName string) error {
+	fromDirectory := db.Replication{SourceHostIP: hostIP, SourceDirectoryName: directoryName}
+	if err := fromDirectory.Delete(engine); err != nil {
+		return err
+	}
+
+	toDirectory := db.Replication{DestinationHostIP: hostIP, DestinationDirectoryName: directoryName}
+
+	return toDirectory.Delete(engine)
+}
+
+func fromReplication(replication db.Replication) Replication {
+	return Replication{
+		SourceHostIP:             replication.SourceHostIP,
+		SourceDirectoryName:      replication.SourceDirectoryName,
+		DestinationHostIP:        replication.DestinationHostIP,
+		DestinationDirectoryName: replication.DestinationDirectoryName,
+		Frequency:                replication.Frequency,
+		Running:                  isReplicationRunning(replication),
+		LastRunTime:              replication.LastRunTime,
+		LastSuccessTime:          replication.LastSuccessTime,
+		LastResult:               replication.LastResult,
+		LastError:                replication.LastError,
+		LastDuration:             time.Duration(replication.LastDuration) * time.Millisecond,
+		LastTransfer: common.ReplicationResult{
+			FilesTransferred: replication.FilesTransferred,
+			BytesTransferred: replication.BytesTransferred,
+			FilesResumed:     replication.FilesResumed,
+			FilesUnchanged:   replication.FilesUnchanged,
+			FilesDeleted:     replication.FilesDeleted,
+		},
+	}
+}
+
+type ReplicationList struct {
+	Replications []Replication
+}
+
+func (rl *ReplicationList) Get(ctx context.Context, filter *common.QueryFilter) ([]Replication, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	replicationList := db.ReplicationList{}
+	if err = replicationList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	for _, replication := range replicationList.Replications {
+		rl.Replications = append(rl.Replications, fromReplication(replication))
+	}
+
+	return rl.Replications, nil
+}
+
+type PaginationReplication struct {
+	Replications []Replication
+	Page         int
+	Limit        int
+	TotalCount   int64
+}
+
+func (rl *ReplicationList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationReplication, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	replicationList := db.ReplicationList{}
+	paginationReplications, err := replicationList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationReplicationList := PaginationReplication{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationReplications.TotalCount,
+	}
+
+	for _, replication := range paginationReplications.Replications {
+		paginationReplicationList.Replications = append(paginationReplicationList.Replications, fromReplication(replication))
+	}
+
+	return &paginationReplicationList, nil
+}
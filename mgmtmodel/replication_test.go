@@ -0,0 +1,21 @@
+package mgmtmodel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplication_Lag(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	lastSuccessTime := now.Add(-90 * time.Minute)
+
+	replication := Replication{}
+	if lag := replication.Lag(now); lag != nil {
+		t.Errorf("Lag() = %v, want nil if no transfer has succeeded", *lag)
+	}
+
+	replication.LastSuccessTime = &lastSuccessTime
+	if lag := replication.Lag(now); lag == nil || *lag != 90*time.Minute {
+		t.Errorf("Lag() = %v, want %v", lag, 90*time.Minute)
+	}
+}
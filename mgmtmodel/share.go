@@ -3,7 +3,6 @@ package mgmtmodel
 import (
 	"context"
 	"fmt"
-	"strings"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/cryingmouse/data_management_engine/db"
@@ -11,13 +10,14 @@ import (
 )
 
 type CIFSShare struct {
-	Name            string
-	HostIP          string
-	SharePath       string
-	DirectoryName   string
-	Description     string
-	MountPoint      string
-	AccessUserNames []string
+	Name          string
+	HostIP        string
+	SharePath     string
+	DirectoryName string
+	Description   string
+	MountPoint    string
+	Access        []common.ShareAccess
+	Stale         bool
 }
 
 func (c *CIFSShare) Create(ctx context.Context) (err error) {
@@ -31,15 +31,16 @@ func (c *CIFSShare) Create(ctx context.Context) (err error) {
 	if err = host.Get(engine); err != nil {
 		return err
 	}
-	driver := driver.GetDriver(host.StorageType)
+	driver, err := getHostDriver(host, driver.CapabilityCIFS)
+	if err != nil {
+		return err
+	}
 
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	if c.Access, err = resolveShareAccess(ctx, c.Access); err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-	if err = driver.CreateCIFSShare(ctx, c.Name, c.DirectoryName, c.Description, c.AccessUserNames); err != nil {
+
+	if err = driver.CreateCIFSShare(ctx, c.Name, c.DirectoryName, c.Description, c.Access); err != nil {
 		return err
 	}
 
@@ -50,7 +51,7 @@ func (c *CIFSShare) Create(ctx context.Context) (err error) {
 	if err = common.DeepCopy(c, &share); err != nil {
 		return err
 	}
-	share.AccessUserNames = strings.Join(c.AccessUserNames, ",")
+	share.Path = c.SharePath
 
 	return share.Save(engine)
 }
@@ -66,14 +67,10 @@ func (c *CIFSShare) Delete(ctx context.Context) (err error) {
 		return err
 	}
 
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityCIFS)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
-
-	driver := driver.GetDriver(host.StorageType)
 	if err := driver.DeleteCIFSShare(ctx, c.Name); err != nil {
 		return err
 	}
@@ -102,11 +99,112 @@ func (c *CIFSShare) Get(ctx context.Context) (*CIFSShare, error) {
 	}
 
 	common.DeepCopy(share, c)
-	c.AccessUserNames = strings.Split(share.AccessUserNames, ",")
 
 	return c, nil
 }
 
+// Update changes the share on its host, and saves the changed fields of the share.
+func (c *CIFSShare) Update(ctx context.Context, update common.ShareUpdate) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	share := db.CIFSShare{Name: c.Name, HostIP: c.HostIP}
+	if err = share.Get(engine); err != nil {
+		return err
+	}
+
+	host := db.Host{IP: c.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	hostDriver, err := getHostDriver(host, driver.CapabilityCIFS)
+	if err != nil {
+		return err
+	}
+
+	if err = hostDriver.UpdateCIFSShare(ctx, c.Name, update); err != nil {
+		return err
+	}
+
+	if update.Description != nil {
+		share.Description = *update.Description
+		if err = share.Update(engine, "description"); err != nil {
+			return err
+		}
+	}
+
+	common.DeepCopy(share, c)
+
+	return nil
+}
+
+// GrantAccess gives the access levels to the users and the groups on the share, the level of the one given already is
+// replaced.
+func (c *CIFSShare) GrantAccess(ctx context.Context, access []common.ShareAccess) (err error) {
+	if access, err = resolveShareAccess(ctx, access); err != nil {
+		return err
+	}
+
+	return c.updateAccess(ctx, func(hostDriver driver.Driver) error {
+		if err := hostDriver.GrantCIFSShareAccess(ctx, c.Name, access); err != nil {
+			return err
+		}
+
+		c.Access = common.GrantShareAccess(c.Access, access)
+
+		return nil
+	})
+}
+
+// RevokeAccess removes the access levels of the users and the groups on the share.
+func (c *CIFSShare) RevokeAccess(ctx context.Context, userNames, groupNames []string) (err error) {
+	return c.updateAccess(ctx, func(hostDriver driver.Driver) error {
+		if err := hostDriver.RevokeCIFSShareAccess(ctx, c.Name, userNames, groupNames); err != nil {
+			return err
+		}
+
+		c.Access = common.RevokeShareAccess(c.Access, userNames, groupNames)
+
+		return nil
+	})
+}
+
+// updateAccess changes the access on the host by the update, and saves the access levels of the share changed by it.
+func (c *CIFSShare) updateAccess(ctx context.Context, update func(hostDriver driver.Driver) error) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	share := db.CIFSShare{Name: c.Name, HostIP: c.HostIP}
+	if err = share.Get(engine); err != nil {
+		return err
+	}
+
+	host := db.Host{IP: c.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	hostDriver, err := getHostDriver(host, driver.CapabilityShareAccess)
+	if err != nil {
+		return err
+	}
+
+	common.DeepCopy(share, c)
+
+	if err = update(hostDriver); err != nil {
+		return err
+	}
+
+	common.DeepCopy(c.Access, &share.Access)
+
+	return share.Save(engine)
+}
+
 func (c *CIFSShare) Mount(ctx context.Context, userName, password string) (err error) {
 	engine, err := db.GetDatabaseEngine()
 	if err != nil {
@@ -118,14 +216,11 @@ func (c *CIFSShare) Mount(ctx context.Context, userName, password string) (err e
 	if err = host.Get(engine); err != nil {
 		return err
 	}
-	driver := driver.GetDriver(host.StorageType)
-
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityMount)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
+
 	if err = driver.MountCIFSShare(ctx, c.MountPoint, c.SharePath, userName, password); err != nil {
 		return err
 	}
@@ -152,14 +247,10 @@ func (c *CIFSShare) Unmount(ctx context.Context) (err error) {
 	if err = host.Get(engine); err != nil {
 		return err
 	}
-	driver := driver.GetDriver(host.StorageType)
-
-	hostContext := common.HostContext{
-		IP:       host.IP,
-		Username: host.Username,
-		Password: host.Password,
+	driver, err := getHostDriver(host, driver.CapabilityMount)
+	if err != nil {
+		return err
 	}
-	ctx = context.WithValue(ctx, common.HostContextkey("hostContext"), hostContext)
 
 	if err = driver.UnmountCIFSShare(ctx, c.MountPoint); err != nil {
 		return err
@@ -198,10 +289,6 @@ func (cl *CIFSShareList) Get(ctx context.Context, filter *common.QueryFilter) ([
 
 	common.DeepCopy(shareList.Shares, &cl.Shares)
 
-	for index, share := range shareList.Shares {
-		cl.Shares[index].AccessUserNames = strings.Split(share.AccessUserNames, ",")
-	}
-
 	return cl.Shares, nil
 }
 
@@ -232,13 +319,14 @@ func (cl *CIFSShareList) Pagination(ctx context.Context, filter *common.QueryFil
 
 	for _, _share := range paginationShares.Shares {
 		share := CIFSShare{
-			Name:            _share.Name,
-			HostIP:          _share.HostIP,
-			SharePath:       _share.Path,
-			DirectoryName:   _share.DirectoryName,
-			Description:     _share.Description,
-			AccessUserNames: strings.Split(_share.AccessUserNames, ","),
+			Name:          _share.Name,
+			HostIP:        _share.HostIP,
+			SharePath:     _share.Path,
+			DirectoryName: _share.DirectoryName,
+			Description:   _share.Description,
+			Stale:         _share.Stale,
 		}
+		common.DeepCopy(_share.Access, &share.Access)
 
 		paginationShareList.Shares = append(paginationShareList.Shares, share)
 	}
@@ -0,0 +1,225 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+	"gorm.io/gorm"
+)
+
+// The layout of the names given to the snapshots created without a name, e.g. 20231018-153000.
+const snapshotNameLayout = "20060102-150405"
+
+// ErrSnapshotExists is returned on creating the snapshot whose name is used by another snapshot of the directory.
+var ErrSnapshotExists = errors.New("the snapshot of the directory already exists")
+
+type Snapshot struct {
+	HostIP        string
+	DirectoryName string
+	Name          string
+	Method        string
+	CreationTime  time.Time
+	PolicyName    string
+}
+
+// Create takes the snapshot of the managed directory on its host and saves it, the snapshot is named by the time if
+// no name is given.
+func (s *Snapshot) Create(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	directoryModel := Directory{Name: s.DirectoryName, HostIP: s.HostIP}
+	directory, hostDriver, err := directoryModel.getDirectoryDriver(engine, driver.CapabilitySnapshot)
+	if err != nil {
+		return err
+	}
+
+	if s.Name == "" {
+		s.Name = time.Now().Format(snapshotNameLayout)
+	}
+
+	existing := db.Snapshot{HostIP: s.HostIP, DirectoryName: s.DirectoryName, Name: s.Name}
+	if err = existing.Get(engine); err == nil {
+		return ErrSnapshotExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	detail, err := hostDriver.CreateSnapshot(ctx, s.DirectoryName, s.Name)
+	if err != nil {
+		return err
+	}
+
+	snapshot := db.Snapshot{
+		DirectoryID:   directory.ID,
+		HostIP:        s.HostIP,
+		DirectoryName: s.DirectoryName,
+		Name:          detail.Name,
+		Method:        detail.Method,
+		CreationTime:  detail.CreationTime,
+		PolicyName:    s.PolicyName,
+	}
+	if err = snapshot.Save(engine); err != nil {
+		return err
+	}
+
+	*s = fromSnapshot(snapshot)
+
+	return nil
+}
+
+func (s *Snapshot) Delete(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	snapshot, hostDriver, err := s.getSnapshotDriver(engine)
+	if err != nil {
+		return err
+	}
+
+	if err = hostDriver.DeleteSnapshot(ctx, s.DirectoryName, s.Name); err != nil {
+		return err
+	}
+
+	return snapshot.Delete(engine)
+}
+
+// Restore replaces the content of the directory by the snapshot on its host, the snapshot is kept.
+func (s *Snapshot) Restore(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	snapshot, hostDriver, err := s.getSnapshotDriver(engine)
+	if err != nil {
+		return err
+	}
+
+	if err = hostDriver.RestoreSnapshot(ctx, s.DirectoryName, s.Name); err != nil {
+		return err
+	}
+
+	*s = fromSnapshot(snapshot)
+
+	return nil
+}
+
+func (s *Snapshot) Get(ctx context.Context) (*Snapshot, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := db.Snapshot{HostIP: s.HostIP, DirectoryName: s.DirectoryName, Name: s.Name}
+	if err = snapshot.Get(engine); err != nil {
+		return nil, err
+	}
+
+	*s = fromSnapshot(snapshot)
+
+	return s, nil
+}
+
+// getSnapshotDriver returns the managed snapshot and the driver of its host.
+func (s *Snapshot) getSnapshotDriver(engine *db.DatabaseEngine) (snapshot db.Snapshot, hostDriver driver.Driver, err error) {
+	snapshot = db.Snapshot{HostIP: s.HostIP, DirectoryName: s.DirectoryName, Name: s.Name}
+	if err = snapshot.Get(engine); err != nil {
+		return snapshot, nil, err
+	}
+
+	host := db.Host{IP: s.HostIP}
+	if err = host.Get(engine); err != nil {
+		return snapshot, nil, err
+	}
+
+	hostDriver, err = getHostDriver(host, driver.CapabilitySnapshot)
+
+	return snapshot, hostDriver, err
+}
+
+// deleteDirectorySnapshots deletes the saved snapshots of the directory, which are deleted with it on the host, and
+// detaches the snapshot policies from it.
+func deleteDirectorySnapshots(engine *db.DatabaseEngine, hostIP, directoryName string) error {
+	snapshot := db.Snapshot{HostIP: hostIP, DirectoryName: directoryName}
+	if err := snapshot.Delete(engine); err != nil {
+		return err
+	}
+
+	attachment := db.SnapshotPolicyDirectory{HostIP: hostIP, DirectoryName: directoryName}
+
+	return attachment.Delete(engine)
+}
+
+func fromSnapshot(snapshot db.Snapshot) Snapshot {
+	return Snapshot{
+		HostIP:        snapshot.HostIP,
+		DirectoryName: snapshot.DirectoryName,
+		Name:          snapshot.Name,
+		Method:        snapshot.Method,
+		CreationTime:  snapshot.CreationTime,
+		PolicyName:    snapshot.PolicyName,
+	}
+}
+
+type SnapshotList struct {
+	Snapshots []Snapshot
+}
+
+func (sl *SnapshotList) Get(ctx context.Context, filter *common.QueryFilter) ([]Snapshot, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotList := db.SnapshotList{}
+	if err = snapshotList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshotList.Snapshots {
+		sl.Snapshots = append(sl.Snapshots, fromSnapshot(snapshot))
+	}
+
+	return sl.Snapshots, nil
+}
+
+type PaginationSnapshot struct {
+	Snapshots  []Snapshot
+	Page       int
+	Limit      int
+	TotalCount int64
+}
+
+func (sl *SnapshotList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationSnapshot, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotList := db.SnapshotList{}
+	paginationSnapshots, err := snapshotList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationSnapshotList := PaginationSnapshot{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationSnapshots.TotalCount,
+	}
+
+	for _, snapshot := range paginationSnapshots.Snapshots {
+		paginationSnapshotList.Snapshots = append(paginationSnapshotList.Snapshots, fromSnapshot(snapshot))
+	}
+
+	return &paginationSnapshotList, nil
+}
@@ -0,0 +1,384 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
+)
+
+const defaultSnapshotPolicyInterval = 60 * time.Second
+
+// The number of the snapshots taken by the policies at the same time, the copies are heavy for the hosts.
+const maxConcurrentPolicySnapshots = 4
+
+var (
+	// ErrSnapshotPolicyExists is returned on creating the policy whose name is used by another policy.
+	ErrSnapshotPolicyExists = errors.New("the snapshot policy already exists")
+	// ErrSnapshotPolicyAttached is returned on attaching the policy to the directory which it is attached to already.
+	ErrSnapshotPolicyAttached = errors.New("the snapshot policy is attached to the directory already")
+)
+
+// SnapshotPolicyInterval returns the interval between the checks of the snapshot policies, the policies take the
+// snapshots of the directories which are due at the checks.
+func SnapshotPolicyInterval() time.Duration {
+	if interval := time.Duration(common.Config.Scheduler.SnapshotPolicyInterval) * time.Second; interval > 0 {
+		return interval
+	}
+
+	return defaultSnapshotPolicyInterval
+}
+
+type SnapshotPolicyDirectory struct {
+	HostIP        string
+	DirectoryName string
+	LastRunTime   *time.Time
+}
+
+// SnapshotPolicy takes the snapshots of the directories attached to it at the frequency, e.g. hourly, and deletes
+// the snapshots it took except the latest Keep ones.
+type SnapshotPolicy struct {
+	Name        string
+	Frequency   string
+	Keep        int
+	Directories []SnapshotPolicyDirectory
+}
+
+func (p *SnapshotPolicy) Create(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	if err = common.ValidateSnapshotPolicy(p.Name, p.Frequency, p.Keep); err != nil {
+		return err
+	}
+
+	policy := db.SnapshotPolicy{Name: p.Name}
+	if err = policy.Get(engine); err == nil {
+		return ErrSnapshotPolicyExists
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	policy.Frequency = p.Frequency
+	policy.Keep = p.Keep
+	if err = policy.Save(engine); err != nil {
+		return err
+	}
+
+	*p = fromSnapshotPolicy(policy)
+
+	return nil
+}
+
+// Update changes the frequency and the number of the snapshots kept, the empty frequency and the zero keep are not
+// changed. The snapshots beyond the new keep are deleted at the next run of the policy.
+func (p *SnapshotPolicy) Update(ctx context.Context, frequency string, keep int) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	policy := db.SnapshotPolicy{Name: p.Name}
+	if err = policy.Get(engine); err != nil {
+		return err
+	}
+
+	if frequency != "" {
+		policy.Frequency = frequency
+	}
+	if keep != 0 {
+		policy.Keep = keep
+	}
+
+	if err = common.ValidateSnapshotPolicy(policy.Name, policy.Frequency, policy.Keep); err != nil {
+		return err
+	}
+
+	if err = policy.Save(engine); err != nil {
+		return err
+	}
+
+	*p = fromSnapshotPolicy(policy)
+
+	return nil
+}
+
+// Delete deletes the policy and detaches it from the directories, the snapshots taken by the policy are kept.
+func (p *SnapshotPolicy) Delete(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	policy := db.SnapshotPolicy{Name: p.Name}
+
+	return policy.Delete(engine)
+}
+
+func (p *SnapshotPolicy) Get(ctx context.Context) (*SnapshotPolicy, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := db.SnapshotPolicy{Name: p.Name}
+	if err = policy.Get(engine); err != nil {
+		return nil, err
+	}
+
+	*p = fromSnapshotPolicy(policy)
+
+	return p, nil
+}
+
+// Attach attaches the policy to the managed directory, the policy takes the first snapshot of the directory at its
+// next check.
+func (p *SnapshotPolicy) Attach(ctx context.Context, hostIP, directoryName string) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	policy := db.SnapshotPolicy{Name: p.Name}
+	if err = policy.Get(engine); err != nil {
+		return err
+	}
+
+	directoryModel := Directory{Name: directoryName, HostIP: hostIP}
+	directory, _, err := directoryModel.getDirectoryDriver(engine, driver.CapabilitySnapshot)
+	if err != nil {
+		return err
+	}
+
+	attachment := db.SnapshotPolicyDirectory{SnapshotPolicyID: policy.ID, HostIP: hostIP, DirectoryName: directoryName}
+	if err = attachment.Get(engine); err == nil {
+		return ErrSnapshotPolicyAttached
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	attachment.DirectoryID = directory.ID
+	if err = attachment.Save(engine); err != nil {
+		return err
+	}
+
+	policy.Directories = append(policy.Directories, attachment)
+	*p = fromSnapshotPolicy(policy)
+
+	return nil
+}
+
+// Detach detaches the policy from the directory, the snapshots taken by the policy are kept.
+func (p *SnapshotPolicy) Detach(ctx context.Context, hostIP, directoryName string) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	policy := db.SnapshotPolicy{Name: p.Name}
+	if err = policy.Get(engine); err != nil {
+		return err
+	}
+
+	attachment := db.SnapshotPolicyDirectory{SnapshotPolicyID: policy.ID, HostIP: hostIP, DirectoryName: directoryName}
+	if err = attachment.Get(engine); err != nil {
+		return err
+	}
+
+	return attachment.Delete(engine)
+}
+
+// run takes the snapshot of the attached directory, and deletes the snapshots it took except the latest Keep ones.
+func (p *SnapshotPolicy) run(ctx context.Context, engine *db.DatabaseEngine, attachment db.SnapshotPolicyDirectory, now time.Time) error {
+	snapshot := Snapshot{
+		HostIP:        attachment.HostIP,
+		DirectoryName: attachment.DirectoryName,
+		Name:          fmt.Sprintf("%s-%s", p.Name, now.Format(snapshotNameLayout)),
+		PolicyName:    p.Name,
+	}
+	if err := snapshot.Create(ctx); err != nil {
+		return fmt.Errorf("failed to take the snapshot of the directory %s on the host %s by the policy %s: %w",
+			attachment.DirectoryName, attachment.HostIP, p.Name, err)
+	}
+
+	attachment.LastRunTime = &now
+	if err := attachment.Save(engine); err != nil {
+		return err
+	}
+
+	snapshotList := db.SnapshotList{}
+	filter := common.QueryFilter{
+		Conditions: db.Snapshot{HostIP: attachment.HostIP, DirectoryName: attachment.DirectoryName, PolicyName: p.Name},
+	}
+	if err := snapshotList.Get(engine, &filter); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, expired := range expiredSnapshots(snapshotList.Snapshots, p.Keep) {
+		snapshot := fromSnapshot(expired)
+		if err := snapshot.Delete(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete the expired snapshot %s of the directory %s on the host %s: %w",
+				expired.Name, expired.DirectoryName, expired.HostIP, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isScheduleDue reports whether the scheduled work, e.g. the snapshot of a policy, has to run. It is due once the
+// interval passes since its last run, so the runs missed while the engine is down are caught up by one run at the
+// first check after the engine starts.
+func isScheduleDue(lastRunTime *time.Time, interval time.Duration, now time.Time) bool {
+	return lastRunTime == nil || now.Sub(*lastRunTime) >= interval
+}
+
+// expiredSnapshots returns the snapshots except the latest keep ones.
+func expiredSnapshots(snapshots []db.Snapshot, keep int) []db.Snapshot {
+	if len(snapshots) <= keep {
+		return nil
+	}
+
+	sorted := make([]db.Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreationTime.After(sorted[j].CreationTime)
+	})
+
+	return sorted[keep:]
+}
+
+func fromSnapshotPolicy(policy db.SnapshotPolicy) SnapshotPolicy {
+	p := SnapshotPolicy{
+		Name:        policy.Name,
+		Frequency:   policy.Frequency,
+		Keep:        policy.Keep,
+		Directories: []SnapshotPolicyDirectory{},
+	}
+
+	for _, attachment := range policy.Directories {
+		p.Directories = append(p.Directories, SnapshotPolicyDirectory{
+			HostIP:        attachment.HostIP,
+			DirectoryName: attachment.DirectoryName,
+			LastRunTime:   attachment.LastRunTime,
+		})
+	}
+
+	return p
+}
+
+// RunSnapshotPolicies lets the policies take the snapshots of the directories which are due, and delete the expired
+// snapshots. The failure of a directory does not stop the others, and the directory is retried at the next check.
+func RunSnapshotPolicies(ctx context.Context, now time.Time) error {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	policyList := db.SnapshotPolicyList{}
+	if err = policyList.Get(engine, &common.QueryFilter{}); err != nil {
+		return err
+	}
+
+	type policyRun struct {
+		policy     SnapshotPolicy
+		attachment db.SnapshotPolicyDirectory
+	}
+
+	var runs []policyRun
+	var errs []error
+	for _, policy := range policyList.SnapshotPolicies {
+		interval, ok := common.SnapshotFrequencyInterval(policy.Frequency)
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid frequency of the snapshot policy %s: %s", policy.Name, policy.Frequency))
+			continue
+		}
+
+		for _, attachment := range policy.Directories {
+			if isScheduleDue(attachment.LastRunTime, interval, now) {
+				runs = append(runs, policyRun{policy: fromSnapshotPolicy(policy), attachment: attachment})
+			}
+		}
+	}
+
+	g, _ := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentPolicySnapshots)
+
+	runErrs := make([]error, len(runs))
+
+	for i := range runs {
+		index := i // 避免闭包问题
+		g.Go(func() error {
+			runErrs[index] = runs[index].policy.run(ctx, engine, runs[index].attachment, now)
+
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	return errors.Join(append(errs, runErrs...)...)
+}
+
+type SnapshotPolicyList struct {
+	SnapshotPolicies []SnapshotPolicy
+}
+
+func (pl *SnapshotPolicyList) Get(ctx context.Context, filter *common.QueryFilter) ([]SnapshotPolicy, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	policyList := db.SnapshotPolicyList{}
+	if err = policyList.Get(engine, filter); err != nil {
+		return nil, err
+	}
+
+	for _, policy := range policyList.SnapshotPolicies {
+		pl.SnapshotPolicies = append(pl.SnapshotPolicies, fromSnapshotPolicy(policy))
+	}
+
+	return pl.SnapshotPolicies, nil
+}
+
+type PaginationSnapshotPolicy struct {
+	SnapshotPolicies []SnapshotPolicy
+	Page             int
+	Limit            int
+	TotalCount       int64
+}
+
+func (pl *SnapshotPolicyList) Pagination(ctx context.Context, filter *common.QueryFilter) (*PaginationSnapshotPolicy, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	policyList := db.SnapshotPolicyList{}
+	paginationPolicies, err := policyList.Pagination(engine, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	paginationPolicyList := PaginationSnapshotPolicy{
+		Page:       filter.Pagination.Page,
+		Limit:      filter.Pagination.PageSize,
+		TotalCount: paginationPolicies.TotalCount,
+	}
+
+	for _, policy := range paginationPolicies.SnapshotPolicies {
+		paginationPolicyList.SnapshotPolicies = append(paginationPolicyList.SnapshotPolicies, fromSnapshotPolicy(policy))
+	}
+
+	return &paginationPolicyList, nil
+}
@@ -0,0 +1,71 @@
+package mgmtmodel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/db"
+)
+
+func Test_isScheduleDue(t *testing.T) {
+	now := time.Date(2023, 11, 1, 12, 0, 0, 0, time.UTC)
+	timeAgo := func(d time.Duration) *time.Time {
+		lastRunTime := now.Add(-d)
+		return &lastRunTime
+	}
+
+	tests := []struct {
+		name        string
+		lastRunTime *time.Time
+		want        bool
+	}{
+		{name: "Never run", lastRunTime: nil, want: true},
+		{name: "Run within the interval", lastRunTime: timeAgo(59 * time.Minute), want: false},
+		{name: "Interval passes exactly", lastRunTime: timeAgo(time.Hour), want: true},
+		{name: "Runs missed while the engine is down", lastRunTime: timeAgo(26 * time.Hour), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isScheduleDue(tt.lastRunTime, time.Hour, now); got != tt.want {
+				t.Errorf("isScheduleDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expiredSnapshots(t *testing.T) {
+	base := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := func(name string, hours int) db.Snapshot {
+		return db.Snapshot{Name: name, CreationTime: base.Add(time.Duration(hours) * time.Hour)}
+	}
+
+	// The snapshots are not in the order of their creation.
+	snapshots := []db.Snapshot{snapshot("s2", 2), snapshot("s0", 0), snapshot("s3", 3), snapshot("s1", 1)}
+
+	tests := []struct {
+		name string
+		keep int
+		want []string
+	}{
+		{name: "Keep more than taken", keep: 5, want: nil},
+		{name: "Keep all taken", keep: 4, want: nil},
+		{name: "Delete the oldest ones", keep: 2, want: []string{"s1", "s0"}},
+		{name: "Keep the latest only", keep: 1, want: []string{"s2", "s1", "s0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := expiredSnapshots(snapshots, tt.keep)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expiredSnapshots() returns %d snapshots, want %d", len(got), len(tt.want))
+			}
+
+			for i, name := range tt.want {
+				if got[i].Name != name {
+					t.Errorf("expiredSnapshots()[%d] = %s, want %s", i, got[i].Name, name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package mgmtmodel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/db"
+	"github.com/cryingmouse/data_management_engine/driver"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultUsageCacheTTL = time.Hour
+
+// The number of the directories walked at the same time, the walks are heavy for the hosts.
+const maxConcurrentUsageWalks = 4
+
+// UsageCacheTTL returns how long the usage of the directories is used before it is collected again.
+func UsageCacheTTL() time.Duration {
+	if ttl := time.Duration(common.Config.Scheduler.UsageCacheTTL) * time.Second; ttl > 0 {
+		return ttl
+	}
+
+	return defaultUsageCacheTTL
+}
+
+// isUsageStale reports whether the usage of the directory has to be collected again.
+func (d *Directory) isUsageStale(now time.Time) bool {
+	return d.UsageUpdateTime == nil || now.Sub(*d.UsageUpdateTime) >= UsageCacheTTL()
+}
+
+// CollectUsage lets the host walk the directory, and saves the usage with the time of the collection.
+func (d *Directory) CollectUsage(ctx context.Context) (err error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return err
+	}
+
+	directory := db.Directory{Name: d.Name, HostIP: d.HostIP}
+	if err = directory.Get(engine); err != nil {
+		return err
+	}
+
+	host := db.Host{IP: d.HostIP}
+	if err = host.Get(engine); err != nil {
+		return err
+	}
+
+	hostDriver, err := getHostDriver(host, driver.CapabilityUsage)
+	if err != nil {
+		return err
+	}
+
+	usage, err := hostDriver.GetDirectoryUsage(ctx, d.Name)
+	if err != nil {
+		return fmt.Errorf("failed to collect the usage of the directory %s on the host %s: %w", d.Name, d.HostIP, err)
+	}
+
+	now := time.Now()
+	directory.UsedBytes = usage.UsedBytes
+	directory.UsedFiles = usage.FileCount
+	directory.LargestFiles = usage.LargestFiles
+	directory.AgeHistogram = usage.AgeHistogram
+	directory.UsageUpdateTime = &now
+
+	if err = directory.Update(engine, "used_bytes", "used_files", "largest_files", "age_histogram", "usage_update_time"); err != nil {
+		return err
+	}
+
+	common.DeepCopy(directory, d)
+
+	return nil
+}
+
+// CollectUsage collects the usage of the directories whose usage is older than UsageCacheTTL, the others keep the
+// usage saved. The directories on the storage which cannot report the usage are skipped.
+func (dl *DirectoryList) CollectUsage(ctx context.Context) error {
+	now := time.Now()
+
+	g, _ := errgroup.WithContext(ctx)
+	g.SetLimit(maxConcurrentUsageWalks)
+
+	errs := make([]error, len(dl.Directories))
+
+	for i := range dl.Directories {
+		index := i // 避免闭包问题
+		if !dl.Directories[index].isUsageStale(now) {
+			continue
+		}
+
+		g.Go(func() error {
+			err := dl.Directories[index].CollectUsage(ctx)
+			if err != nil && !driver.IsUnsupportedOperation(err) {
+				errs[index] = err
+			}
+
+			return nil
+		})
+	}
+
+	g.Wait()
+
+	return errors.Join(errs...)
+}
+
+// HostCapacity sums up the usage and the quotas of the directories managed on the host.
+type HostCapacity struct {
+	HostIP         string
+	DirectoryCount int
+	UsedBytes      int64
+	UsedFiles      int64
+	// The sum of the hard limits of the directories with the limit of the capacity.
+	QuotaHardLimitBytes int64
+	// The number of the directories without the limit of the capacity, which may grow up to the file system.
+	UnlimitedDirectoryCount int
+	// The oldest usage summed up, it is nil if the usage of any directory has never been collected.
+	UsageUpdateTime *time.Time
+}
+
+// GetCapacity sums up the directories on the host, the usage older than UsageCacheTTL is collected again.
+// The error of the collection is returned with the capacity summed up by the usage saved.
+func (h *Host) GetCapacity(ctx context.Context) (*HostCapacity, error) {
+	engine, err := db.GetDatabaseEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	host := db.Host{IP: h.IP}
+	if err = host.Get(engine); err != nil {
+		return nil, err
+	}
+
+	directoryList := DirectoryList{}
+	filter := common.QueryFilter{
+		Conditions: struct {
+			HostIP string
+		}{
+			HostIP: h.IP,
+		},
+	}
+	if _, err = directoryList.Get(ctx, &filter); err != nil {
+		return nil, err
+	}
+
+	collectErr := directoryList.CollectUsage(ctx)
+
+	capacity := HostCapacity{HostIP: h.IP, DirectoryCount: len(directoryList.Directories)}
+	neverCollected := false
+	for _, directory := range directoryList.Directories {
+		capacity.UsedBytes += directory.UsedBytes
+		capacity.UsedFiles += directory.UsedFiles
+
+		if directory.HardLimitBytes > 0 {
+			capacity.QuotaHardLimitBytes += directory.HardLimitBytes
+		} else {
+			capacity.UnlimitedDirectoryCount++
+		}
+
+		if directory.UsageUpdateTime == nil {
+			neverCollected = true
+		} else if capacity.UsageUpdateTime == nil || directory.UsageUpdateTime.Before(*capacity.UsageUpdateTime) {
+			capacity.UsageUpdateTime = directory.UsageUpdateTime
+		}
+	}
+
+	if neverCollected {
+		capacity.UsageUpdateTime = nil
+	}
+
+	return &capacity, collectErr
+}
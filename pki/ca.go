@@ -0,0 +1,230 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+)
+
+const (
+	caValidity                = 10 * 365 * 24 * time.Hour
+	agentCertificateValidity  = 5 * 365 * 24 * time.Hour
+	clientCertificateValidity = 365 * 24 * time.Hour
+
+	// The common name of the client certificate which the engine presents to the agents.
+	engineCommonName = "data_management_engine"
+)
+
+// CA is the certificate authority built in the engine. It signs the certificates of the agents at the host
+// registration and the client certificate which the engine presents to them.
+type CA struct {
+	Certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+
+	mu         sync.Mutex
+	clientCert *tls.Certificate
+}
+
+var (
+	caOnce sync.Once
+	ca     *CA
+	caErr  error
+)
+
+// GetCA returns the CA of the engine, it is loaded from the files specified by the configuration [pki],
+// and created at the first call if the files do not exist.
+func GetCA() (*CA, error) {
+	caOnce.Do(func() {
+		ca, caErr = LoadOrCreateCA(common.Config.PKI.CACertFile, common.Config.PKI.CAKeyFile)
+	})
+
+	return ca, caErr
+}
+
+// LoadOrCreateCA loads the CA from the certificate and key files, a self-signed CA is created and saved into
+// the files if the certificate file does not exist.
+func LoadOrCreateCA(certFile, keyFile string) (*CA, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("the certificate and key files of the CA are not configured")
+	}
+
+	if _, err := os.Stat(certFile); errors.Is(err, os.ErrNotExist) {
+		return createCA(certFile, keyFile)
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the certificate of the CA: %w", err)
+	}
+
+	cert, err := ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := LoadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Certificate: cert, key: key, certPEM: certPEM}, nil
+}
+
+func createCA(certFile, keyFile string) (*CA, error) {
+	key, err := LoadOrCreateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: engineCommonName + " CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate of the CA: %w", err)
+	}
+
+	certPEM := encodeCertificate(der)
+	if err := writeFile(certFile, certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save the certificate of the CA: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{Certificate: cert, key: key, certPEM: certPEM}, nil
+}
+
+// CertificatePEM returns the certificate of the CA in PEM, the agents trust the client certificates signed by it.
+func (ca *CA) CertificatePEM() []byte {
+	return ca.certPEM
+}
+
+// CertPool returns the pool which contains the certificate of the CA only.
+func (ca *CA) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+
+	return pool
+}
+
+// SignAgentCertificate issues the certificate of the agent at the IP address by its certificate signing request in
+// PEM. It returns the certificate in PEM and its fingerprint. The agent serves its API by the certificate, and presents
+// it to the other agents to pull the directories replicated from them.
+func (ca *CA) SignAgentCertificate(csrPEM []byte, ip string) (certPEM []byte, fingerprint string, err error) {
+	csr, err := ParseCertificateRequestPEM(csrPEM)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, "", fmt.Errorf("invalid signature of the certificate signing request: %w", err)
+	}
+
+	address := net.ParseIP(ip)
+	if address == nil {
+		return nil, "", fmt.Errorf("invalid IP address of the agent: %s", ip)
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The subject and the IP address are decided by the engine, only the public key is taken from the request.
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: ip},
+		IPAddresses:  []net.IP{address},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(agentCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sign the certificate of the agent %s: %w", ip, err)
+	}
+
+	return encodeCertificate(der), Fingerprint(der), nil
+}
+
+// ClientCertificate returns the client certificate of the engine. It is issued in memory at the first call,
+// and issued again once it is about to expire.
+func (ca *CA) ClientCertificate() (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.clientCert != nil && time.Until(ca.clientCert.Leaf.NotAfter) > 24*time.Hour {
+		return ca.clientCert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: engineCommonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(clientCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue the client certificate of the engine: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.clientCert = &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+
+	return ca.clientCert, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
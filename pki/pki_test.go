@@ -0,0 +1,283 @@
+package pki
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreateCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca", "ca.crt")
+	keyFile := filepath.Join(dir, "ca", "ca.key")
+
+	created, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+	if !created.Certificate.IsCA {
+		t.Errorf("LoadOrCreateCA() created a certificate which is not a CA")
+	}
+
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("LoadOrCreateCA() saved the key with %v, error = %v", info.Mode().Perm(), err)
+	}
+
+	loaded, err := LoadOrCreateCA(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+	if !loaded.Certificate.Equal(created.Certificate) {
+		t.Errorf("LoadOrCreateCA() did not load the saved CA")
+	}
+
+	if _, err := LoadOrCreateCA("", keyFile); err == nil {
+		t.Errorf("LoadOrCreateCA() expected an error for the missing certificate file")
+	}
+}
+
+func TestCA_SignAgentCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	key, err := LoadOrCreateKey(filepath.Join(dir, "agent.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateKey() error = %v", err)
+	}
+
+	csr, err := CreateCertificateRequest(key, "agent")
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		csr     []byte
+		ip      string
+		wantErr bool
+	}{
+		{name: "Valid request", csr: csr, ip: "127.0.0.1"},
+		{name: "Invalid IP address", csr: csr, ip: "agent", wantErr: true},
+		{name: "Invalid request", csr: []byte("invalid"), ip: "127.0.0.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, fingerprint, err := ca.SignAgentCertificate(tt.csr, tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SignAgentCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			cert, err := ParseCertificatePEM(certPEM)
+			if err != nil {
+				t.Fatalf("ParseCertificatePEM() error = %v", err)
+			}
+			if len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != tt.ip {
+				t.Errorf("SignAgentCertificate() IP addresses = %v, want %s", cert.IPAddresses, tt.ip)
+			}
+			if fingerprint != Fingerprint(cert.Raw) {
+				t.Errorf("SignAgentCertificate() fingerprint = %s, want %s", fingerprint, Fingerprint(cert.Raw))
+			}
+
+			if err := VerifyAgentCertificate(certPEM, ca.CertificatePEM(), key); err != nil {
+				t.Errorf("VerifyAgentCertificate() error = %v", err)
+			}
+
+			otherKey, _ := LoadOrCreateKey(filepath.Join(t.TempDir(), "other.key"))
+			if err := VerifyAgentCertificate(certPEM, ca.CertificatePEM(), otherKey); err == nil {
+				t.Errorf("VerifyAgentCertificate() expected an error for the other key")
+			}
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	// Enroll the agent as the engine does at the registration.
+	key, _ := LoadOrCreateKey(filepath.Join(dir, "agent.key"))
+	csr, _ := CreateCertificateRequest(key, "agent")
+	certPEM, fingerprint, err := ca.SignAgentCertificate(csr, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("SignAgentCertificate() error = %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "agent.crt"), certPEM, 0644)
+	os.WriteFile(filepath.Join(dir, "engine-ca.crt"), ca.CertificatePEM(), 0644)
+
+	serverConfig, err := ServerTLSConfig(filepath.Join(dir, "agent.crt"), filepath.Join(dir, "agent.key"), filepath.Join(dir, "engine-ca.crt"))
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	otherCA, err := LoadOrCreateCA(filepath.Join(dir, "other-ca.crt"), filepath.Join(dir, "other-ca.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		ca          *CA
+		fingerprint string
+		wantErr     bool
+	}{
+		{name: "Pinned fingerprint", ca: ca, fingerprint: fingerprint},
+		{name: "No pinned fingerprint", ca: ca},
+		{name: "Other fingerprint", ca: ca, fingerprint: Fingerprint([]byte("other")), wantErr: true},
+		{name: "Other CA", ca: otherCA, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tt.ca.clientTLSConfig(tt.fingerprint)}}
+
+			response, err := client.Get(server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer response.Body.Close()
+
+			body, _ := io.ReadAll(response.Body)
+			if string(body) != engineCommonName {
+				t.Errorf("Get() client common name = %s, want %s", body, engineCommonName)
+			}
+		})
+	}
+
+	// The client without a certificate is rejected by the agent.
+	insecureClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.CertPool()}}}
+	if response, err := insecureClient.Get(server.URL); err == nil {
+		response.Body.Close()
+		t.Errorf("Get() expected an error for the client without certificate")
+	}
+}
+
+func TestIsEngineCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	clientCert, err := ca.ClientCertificate()
+	if err != nil {
+		t.Fatalf("ClientCertificate() error = %v", err)
+	}
+	if !IsEngineCertificate(clientCert.Leaf) {
+		t.Errorf("IsEngineCertificate() = false for the client certificate of the engine")
+	}
+
+	key, _ := LoadOrCreateKey(filepath.Join(dir, "agent.key"))
+	csr, _ := CreateCertificateRequest(key, engineCommonName)
+	certPEM, _, err := ca.SignAgentCertificate(csr, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("SignAgentCertificate() error = %v", err)
+	}
+	agentCert, err := ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatalf("ParseCertificatePEM() error = %v", err)
+	}
+	if IsEngineCertificate(agentCert) {
+		t.Errorf("IsEngineCertificate() = true for the certificate of the agent")
+	}
+}
+
+func TestPeerTLS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca, err := LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "engine-ca.crt"), ca.CertificatePEM(), 0644)
+
+	// Enroll the agents as the engine does at the registration.
+	fingerprints := map[string]string{}
+	for _, name := range []string{"source", "destination"} {
+		key, _ := LoadOrCreateKey(filepath.Join(dir, name+".key"))
+		csr, _ := CreateCertificateRequest(key, name)
+		certPEM, fingerprint, err := ca.SignAgentCertificate(csr, "127.0.0.1")
+		if err != nil {
+			t.Fatalf("SignAgentCertificate() error = %v", err)
+		}
+		os.WriteFile(filepath.Join(dir, name+".crt"), certPEM, 0644)
+		fingerprints[name] = fingerprint
+	}
+
+	serverConfig, err := ServerTLSConfig(filepath.Join(dir, "source.crt"), filepath.Join(dir, "source.key"), filepath.Join(dir, "engine-ca.crt"))
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, Fingerprint(r.TLS.PeerCertificates[0].Raw))
+	}))
+	server.TLS = serverConfig
+	server.StartTLS()
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		wantErr     bool
+	}{
+		{name: "Pinned fingerprint", fingerprint: fingerprints["source"]},
+		{name: "Other fingerprint", fingerprint: fingerprints["destination"], wantErr: true},
+		{name: "No pinned fingerprint", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := PeerTLSConfig(filepath.Join(dir, "destination.crt"), filepath.Join(dir, "destination.key"), filepath.Join(dir, "engine-ca.crt"), tt.fingerprint)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("PeerTLSConfig() error = %v", err)
+				}
+				return
+			}
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+
+			response, err := client.Get(server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer response.Body.Close()
+
+			// The source agent accepts the certificate of the destination agent as a client certificate.
+			body, _ := io.ReadAll(response.Body)
+			if string(body) != fingerprints["destination"] {
+				t.Errorf("Get() client fingerprint = %s, want %s", body, fingerprints["destination"])
+			}
+		})
+	}
+}
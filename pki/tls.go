@@ -0,0 +1,236 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate in DER, in lower case hex.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientTLSConfig returns the TLS configuration for the engine to connect to the agent. The engine presents its
+// client certificate, and accepts the certificate of the agent only if it is signed by the CA and its fingerprint
+// is the pinned one. Any certificate signed by the CA is accepted if the fingerprint is empty.
+func ClientTLSConfig(fingerprint string) (*tls.Config, error) {
+	ca, err := GetCA()
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.clientTLSConfig(fingerprint), nil
+}
+
+func (ca *CA) clientTLSConfig(fingerprint string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    ca.CertPool(),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return ca.ClientCertificate()
+		},
+		// It is called after the chain is verified by RootCAs.
+		VerifyPeerCertificate: pinFingerprint(fingerprint),
+	}
+}
+
+// PeerTLSConfig returns the TLS configuration for the agent to connect to another agent, e.g. to pull the directory
+// replicated from it. The agent presents its own certificate, and accepts the certificate of the other agent only if
+// it is signed by the CA in caFile and its fingerprint is the pinned one.
+func PeerTLSConfig(certFile, keyFile, caFile, fingerprint string) (*tls.Config, error) {
+	if fingerprint == "" {
+		return nil, errors.New("the agent over mutual TLS requires the fingerprint of its certificate")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the certificate of the agent: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA certificate of the engine: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("invalid CA certificate of the engine")
+	}
+
+	return &tls.Config{
+		MinVersion:            tls.VersionTLS12,
+		Certificates:          []tls.Certificate{cert},
+		RootCAs:               pool,
+		VerifyPeerCertificate: pinFingerprint(fingerprint),
+	}, nil
+}
+
+// pinFingerprint returns the check that the certificate of the agent has the fingerprint, any certificate passes if
+// the fingerprint is empty.
+func pinFingerprint(fingerprint string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if fingerprint == "" {
+			return nil
+		}
+
+		if len(rawCerts) == 0 || !strings.EqualFold(Fingerprint(rawCerts[0]), fingerprint) {
+			return errors.New("the certificate of the agent does not match the pinned fingerprint")
+		}
+
+		return nil
+	}
+}
+
+// ServerTLSConfig returns the TLS configuration for the agent to serve its API. Only the clients presenting a
+// certificate signed by the CA in caFile are accepted.
+func ServerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the certificate of the agent: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the CA certificate of the engine: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("invalid CA certificate of the engine")
+	}
+
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}, nil
+}
+
+// IsEngineCertificate reports whether the client certificate verified by ServerTLSConfig is the one of the engine.
+// The certificates of the agents are signed by the same CA, but their common names are their IP addresses.
+func IsEngineCertificate(cert *x509.Certificate) bool {
+	return cert.Subject.CommonName == engineCommonName && len(cert.IPAddresses) == 0
+}
+
+// VerifyAgentCertificate checks that the certificate in PEM is signed by the CA in PEM and matches the private key,
+// so that the agent does not install a certificate it cannot serve with.
+func VerifyAgentCertificate(certPEM, caPEM []byte, key *ecdsa.PrivateKey) error {
+	cert, err := ParseCertificatePEM(certPEM)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return errors.New("invalid CA certificate")
+	}
+
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+		return fmt.Errorf("the certificate is not signed by the CA: %w", err)
+	}
+
+	if publicKey, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || !publicKey.Equal(&key.PublicKey) {
+		return errors.New("the certificate does not match the private key")
+	}
+
+	return nil
+}
+
+// CreateCertificateRequest returns the certificate signing request in PEM for the key.
+func CreateCertificateRequest(key *ecdsa.PrivateKey, commonName string) ([]byte, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the certificate signing request: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// LoadOrCreateKey loads the ECDSA private key from the file, a new P-256 key is generated and saved into the file
+// if it does not exist.
+func LoadOrCreateKey(keyFile string) (*ecdsa.PrivateKey, error) {
+	if _, err := os.Stat(keyFile); err == nil {
+		return LoadKey(keyFile)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save the private key: %w", err)
+	}
+
+	return key, nil
+}
+
+// LoadKey loads the ECDSA private key in PEM from the file.
+func LoadKey(keyFile string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid private key in %s", keyFile)
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// ParseCertificatePEM parses the first certificate in PEM.
+func ParseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid certificate in PEM")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParseCertificateRequestPEM parses the certificate signing request in PEM.
+func ParseCertificateRequestPEM(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("invalid certificate signing request in PEM")
+	}
+
+	return x509.ParseCertificateRequest(block.Bytes)
+}
+
+func encodeCertificate(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// writeFile writes the file and creates its directory if it does not exist.
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(name, data, perm)
+}
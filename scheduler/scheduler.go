@@ -7,22 +7,58 @@ import (
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/cryingmouse/data_management_engine/mgmtmodel"
 	"github.com/go-co-op/gocron"
+	log "github.com/sirupsen/logrus"
 )
 
 func updateRegisteredHostInfo() {
-	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), common.GenerateTraceID())
+	traceID := common.GenerateTraceID()
+	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), traceID)
 	hostListModel := mgmtmodel.HostList{}
-	hostListModel.Update(ctx)
+	if err := hostListModel.Update(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Failed to check the health of the registered hosts.")
+	}
+}
+
+func runSnapshotPolicies() {
+	traceID := common.GenerateTraceID()
+	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), traceID)
+	if err := mgmtmodel.RunSnapshotPolicies(ctx, time.Now()); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Failed to run the snapshot policies.")
+	}
+}
+
+func runReplications() {
+	traceID := common.GenerateTraceID()
+	ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), traceID)
+	if err := mgmtmodel.RunDueReplications(ctx, time.Now()); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Failed to transfer the replications.")
+	}
 }
 
 func StartScheduler() {
 	// 创建一个新的计划任务
 	s := gocron.NewScheduler(time.UTC)
 
-	// 每隔一段时间执行异步任务
+	// 上一次检查未完成时跳过本次执行，避免同一任务并发执行
+	s.SingletonModeAll()
+
+	// 将异步任务添加到计划中，按照配置的间隔执行健康检查
+	s.Every(mgmtmodel.HealthCheckInterval()).Do(updateRegisteredHostInfo)
+
+	// 按照配置的间隔检查快照策略，任务在启动时立即执行一次，补上停机期间错过的快照
+	s.Every(mgmtmodel.SnapshotPolicyInterval()).Do(runSnapshotPolicies)
 
-	// 将异步任务添加到计划中，每隔2秒执行一次
-	s.Every(60).Seconds().Do(updateRegisteredHostInfo)
+	// 按照配置的间隔检查复制关系，到期的复制在后台传输，启动时同样补上停机期间错过的传输
+	s.Every(mgmtmodel.ReplicationInterval()).Do(runReplications)
 
 	// 开始计划任务的调度
 	s.StartAsync()
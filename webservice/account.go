@@ -0,0 +1,129 @@
+package webservice
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type AccountResponse struct {
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func CreateAccountHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name     string `json:"name" binding:"required"`
+		Password string `json:"password" binding:"required,validatePassword"`
+		Role     string `json:"role" binding:"required,oneof=admin operator read-only"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	accountModel := mgmtmodel.Account{
+		Name:     request.Name,
+		Password: request.Password,
+		Role:     request.Role,
+	}
+
+	if err := accountModel.Create(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"Name":    request.Name,
+			"error":   err.Error(),
+		}).Error("Failed to create the account.")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the account", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, AccountResponse{
+		Name:      accountModel.Name,
+		Role:      accountModel.Role,
+		CreatedAt: accountModel.CreatedAt,
+	})
+}
+
+func DeleteAccountHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	accountModel := mgmtmodel.Account{Name: request.Name}
+
+	if err := accountModel.Delete(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"Name":    request.Name,
+			"error":   err.Error(),
+		}).Error("Failed to delete the account.")
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ErrorResponse(c, http.StatusNotFound, "The account is not found", err.Error())
+		case errors.Is(err, mgmtmodel.ErrLastAdmin):
+			ErrorResponse(c, http.StatusConflict, "Failed to delete the account", err.Error())
+		default:
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the account", err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetAccountsHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	accountListModel := mgmtmodel.AccountList{}
+	filter := common.QueryFilter{
+		Conditions: struct {
+			Role string
+		}{
+			Role: c.Query("role"),
+		},
+	}
+
+	accounts, err := accountListModel.Get(ctx, &filter)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the accounts", err.Error())
+		return
+	}
+
+	accountList := make([]AccountResponse, len(accounts))
+	for i, account := range accounts {
+		accountList[i] = AccountResponse{
+			Name:      account.Name,
+			Role:      account.Role,
+			CreatedAt: account.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, accountList)
+}
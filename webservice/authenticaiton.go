@@ -1,91 +1,390 @@
 package webservice
 
-// import (
-// 	"fmt"
-// 	"net/http"
-// 	"strings"
-// 	"time"
-
-// 	"github.com/dgrijalva/jwt-go"
-// 	"github.com/gin-gonic/gin"
-// )
-
-// func getTokenHandler(c *gin.Context) {
-// 	var credentials Credentials
-
-// 	if err := c.ShouldBindJSON(&credentials); err != nil {
-// 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-// 		return
-// 	}
-
-// 	// 假设验证用户名和密码的逻辑
-// 	if credentials.Username != "admin" || credentials.Password != "password" {
-// 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-// 		return
-// 	}
-
-// 	// 生成JWT令牌
-// 	token := jwt.New(jwt.SigningMethodHS256)
-// 	claims := token.Claims.(jwt.MapClaims)
-// 	claims["username"] = credentials.Username
-// 	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
-
-// 	tokenString, err := token.SignedString([]byte("cryingmouse"))
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-// 		return
-// 	}
-
-// 	c.JSON(http.StatusOK, gin.H{"token": tokenString})
-// }
-
-// func extractToken(authorizationHeader string) (string, error) {
-// 	const bearerPrefix = "Bearer "
-
-// 	// 检查授权头部是否以Bearer开头
-// 	if !strings.HasPrefix(authorizationHeader, bearerPrefix) {
-// 		return "", fmt.Errorf("authorization header does not contain Bearer prefix")
-// 	}
-
-// 	// 提取令牌字符串
-// 	token := strings.TrimPrefix(authorizationHeader, bearerPrefix)
-
-// 	return token, nil
-// }
-
-// func authMiddleware() gin.HandlerFunc {
-// 	return func(c *gin.Context) {
-// 		authorizationHeader := c.GetHeader("Authorization")
-
-// 		tokenString, err := extractToken(authorizationHeader)
-// 		if err != nil {
-// 			fmt.Println("Error:", err)
-// 			return
-// 		}
-
-// 		// 检查令牌是否存在
-// 		if tokenString == "" {
-// 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing token"})
-// 			c.Abort()
-// 			return
-// 		}
-
-// 		// 解析和验证JWT令牌
-// 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-// 			return []byte("cryingmouse"), nil
-// 		})
-
-// 		if err != nil || !token.Valid {
-// 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-// 			c.Abort()
-// 			return
-// 		}
-
-// 		// 将令牌中的声明信息传递给下一个处理程序
-// 		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-// 			c.Set("username", claims["username"])
-// 		}
-
-// 		c.Next()
-// 	}
-// }
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	tokenIssuer            = "data_management_engine"
+	defaultTokenExpiration = time.Hour
+
+	defaultAgentSessionTimeout = 30 * time.Minute
+
+	// The audiences of the tokens which the agents call home and send the heartbeats with,
+	// the tokens of the portal API have no audience.
+	bootstrapTokenAudience          = "agent-bootstrap"
+	heartbeatTokenAudience          = "agent-heartbeat"
+	defaultBootstrapTokenExpiration = 24 * time.Hour
+	// The heartbeat token expires after the heartbeat intervals.
+	heartbeatTokenIntervals = 10
+)
+
+// TokenClaims is the payload of the token, the subject is the name of the account.
+type TokenClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+var (
+	signingKey     []byte
+	signingKeyOnce sync.Once
+)
+
+func getSigningKey() []byte {
+	signingKeyOnce.Do(func() {
+		if common.Config.Auth.SecretKey != "" {
+			signingKey = []byte(common.Config.Auth.SecretKey)
+			return
+		}
+
+		signingKey = make([]byte, 32)
+		rand.Read(signingKey)
+		common.Logger.Warn("No secret key is configured to sign the tokens, the tokens are invalid once the engine restarts.")
+	})
+
+	return signingKey
+}
+
+func issueToken(account mgmtmodel.Account) (tokenString string, expiresAt time.Time, err error) {
+	expiration := time.Duration(common.Config.Auth.TokenExpiration) * time.Second
+	if expiration <= 0 {
+		expiration = defaultTokenExpiration
+	}
+
+	now := time.Now()
+	expiresAt = now.Add(expiration)
+
+	claims := TokenClaims{
+		Role: account.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   account.Name,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	tokenString, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getSigningKey())
+
+	return tokenString, expiresAt, err
+}
+
+// issueBootstrapToken returns the token which the agents call home with, the subject is the account which issues it.
+func issueBootstrapToken(account string) (tokenString string, expiresAt time.Time, err error) {
+	expiration := time.Duration(common.Config.Auth.BootstrapTokenExpiration) * time.Second
+	if expiration <= 0 {
+		expiration = defaultBootstrapTokenExpiration
+	}
+
+	now := time.Now()
+	expiresAt = now.Add(expiration)
+
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   account,
+			Audience:  jwt.ClaimStrings{bootstrapTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	tokenString, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getSigningKey())
+
+	return tokenString, expiresAt, err
+}
+
+// getHeartbeatTokenExpiration returns how long the heartbeat token is valid. Every heartbeat is responded with a new
+// token, so the token lives a few intervals and several heartbeats may be lost before it expires.
+func getHeartbeatTokenExpiration() time.Duration {
+	return heartbeatTokenIntervals * mgmtmodel.HeartbeatInterval()
+}
+
+// issueHeartbeatToken returns the token which the agent of the host sends the heartbeats with, the subject is the IP
+// address of the host.
+func issueHeartbeatToken(ip string) (string, error) {
+	now := time.Now()
+
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   ip,
+			Audience:  jwt.ClaimStrings{heartbeatTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(getHeartbeatTokenExpiration())),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(getSigningKey())
+}
+
+// parseToken validates the token for the audience, the token of the portal API is expected if the audience is empty.
+func parseToken(tokenString, audience string) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer)}
+	if audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return getSigningKey(), nil
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The tokens of the agents must not be used to call the portal API.
+	if audience == "" && len(claims.Audience) != 0 {
+		return nil, errors.New("token is not valid for the portal API")
+	}
+
+	return claims, nil
+}
+
+func extractToken(authorizationHeader string) (string, error) {
+	const bearerPrefix = "Bearer "
+
+	// 检查授权头部是否以Bearer开头
+	if !strings.HasPrefix(authorizationHeader, bearerPrefix) {
+		return "", fmt.Errorf("authorization header does not contain Bearer prefix")
+	}
+
+	// 提取令牌字符串
+	token := strings.TrimPrefix(authorizationHeader, bearerPrefix)
+	if token == "" {
+		return "", fmt.Errorf("missing token")
+	}
+
+	return token, nil
+}
+
+func GetTokenHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	account := mgmtmodel.Account{Name: request.Username, Password: request.Password}
+	if err := account.Authenticate(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":  traceID,
+			"Username": request.Username,
+			"error":    err.Error(),
+		}).Warn("Failed to authenticate the account.")
+
+		if errors.Is(err, mgmtmodel.ErrInvalidCredentials) {
+			ErrorResponse(c, http.StatusUnauthorized, "Failed to authenticate the account", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to authenticate the account", err.Error())
+		}
+		return
+	}
+
+	token, expiresAt, err := issueToken(account)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token", err.Error())
+		return
+	}
+
+	// The caller is known from now on, so the audit log records who gets the token.
+	c.Set("Username", account.Name)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expiresAt,
+	})
+}
+
+// AuthMiddleware validates the token of the request, and sets the name and the role of the caller into the context.
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := extractToken(c.GetHeader("Authorization"))
+
+		var claims *TokenClaims
+		if err == nil {
+			claims, err = parseToken(tokenString, "")
+		}
+
+		if err != nil {
+			common.Logger.WithFields(log.Fields{
+				"TraceID": c.Request.Header.Get("X-Trace-ID"),
+				"URL":     c.Request.URL,
+				"error":   err.Error(),
+			}).Warn("Unauthorized request.")
+			ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Set("Username", claims.Subject)
+		c.Set("Role", claims.Role)
+
+		c.Next()
+	}
+}
+
+// Authorize rejects the request unless the role of the caller has the permissions of the required role.
+// It must be used after AuthMiddleware.
+func Authorize(requiredRole string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role := c.GetString("Role"); !mgmtmodel.HasRole(role, requiredRole) {
+			common.Logger.WithFields(log.Fields{
+				"TraceID":  c.Request.Header.Get("X-Trace-ID"),
+				"URL":      c.Request.URL,
+				"Username": c.GetString("Username"),
+				"Role":     role,
+			}).Warn("Forbidden request.")
+			ErrorResponse(c, http.StatusForbidden, "Forbidden", fmt.Sprintf("the role %s is required", requiredRole))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// agentSessionStore keeps the session tokens issued by the agent with their expiration time.
+type agentSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]time.Time
+}
+
+var agentSessions = agentSessionStore{sessions: make(map[string]time.Time)}
+
+func getAgentSessionTimeout() time.Duration {
+	if timeout := time.Duration(common.Config.Agent.SessionTimeout) * time.Second; timeout > 0 {
+		return timeout
+	}
+
+	return defaultAgentSessionTimeout
+}
+
+// issue returns a new session token, the expired ones are dropped meanwhile.
+func (s *agentSessionStore) issue() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for session, expiresAt := range s.sessions {
+		if now.After(expiresAt) {
+			delete(s.sessions, session)
+		}
+	}
+	s.sessions[token] = now.Add(getAgentSessionTimeout())
+
+	return token, nil
+}
+
+// validate reports whether the session token is valid, the expiration time of the valid token is extended.
+func (s *agentSessionStore) validate(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiresAt, exist := s.sessions[token]
+	if !exist {
+		return false
+	}
+
+	now := time.Now()
+	if now.After(expiresAt) {
+		delete(s.sessions, token)
+		return false
+	}
+	s.sessions[token] = now.Add(getAgentSessionTimeout())
+
+	return true
+}
+
+// validateAgentCredentials compares the credentials with those in the configuration [agent] in constant time.
+func validateAgentCredentials(username, password string) bool {
+	config := common.Config.Agent
+	if config.Username == "" || config.Password == "" {
+		return false
+	}
+
+	usernameMatched := subtle.ConstantTimeCompare([]byte(username), []byte(config.Username)) == 1
+	passwordMatched := subtle.ConstantTimeCompare([]byte(password), []byte(config.Password)) == 1
+
+	return usernameMatched && passwordMatched
+}
+
+// authenticateAgentRequest authenticates the request by the Basic credentials or the session token,
+// and returns the session token for the later requests.
+func authenticateAgentRequest(r *http.Request) (string, error) {
+	if username, password, ok := r.BasicAuth(); ok {
+		if !validateAgentCredentials(username, password) {
+			return "", errors.New("invalid username or password")
+		}
+
+		return agentSessions.issue()
+	}
+
+	token, err := extractToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return "", errors.New("missing credentials or token")
+	}
+
+	if !agentSessions.validate(token) {
+		return "", errors.New("invalid or expired token")
+	}
+
+	return token, nil
+}
+
+// AgentAuthMiddleware authenticates the caller of the agent API by the credentials in the configuration [agent]
+// or the session token issued by the agent. The session token is responded in the header X-Agent-Token,
+// so that the engine sends it instead of the credentials afterwards.
+func AgentAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := authenticateAgentRequest(c.Request)
+		if err != nil {
+			common.Logger.WithFields(log.Fields{
+				"TraceID": c.Request.Header.Get("X-Trace-ID"),
+				"IP":      c.ClientIP(),
+				"URL":     c.Request.URL,
+				"error":   err.Error(),
+			}).Warn("Unauthorized agent request.")
+			c.Header("WWW-Authenticate", `Basic realm="agent"`)
+			ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", err.Error())
+			c.Abort()
+			return
+		}
+
+		c.Header(common.AgentTokenHeader, token)
+
+		c.Next()
+	}
+}
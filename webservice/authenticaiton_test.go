@@ -0,0 +1,274 @@
+package webservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAuthRouter(t *testing.T) *gin.Engine {
+	if common.Logger == nil {
+		common.Logger = log.New()
+		t.Cleanup(func() { common.Logger = nil })
+	}
+
+	router := gin.New()
+	portal := router.Group("/api")
+	portal.Use(AuthMiddleware())
+	portal.GET("/hosts", func(c *gin.Context) { c.String(http.StatusOK, c.GetString("Username")) })
+	portal.POST("/directories/create", Authorize(mgmtmodel.RoleOperator), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	return router
+}
+
+func newTestToken(t *testing.T, name, role string) string {
+	token, _, err := issueToken(mgmtmodel.Account{Name: name, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	router := setupAuthRouter(t)
+
+	expiredToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+		Role: mgmtmodel.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   "alice",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}).SignedString(getSigningKey())
+
+	forgedToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+		Role: mgmtmodel.RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:  tokenIssuer,
+			Subject: "mallory",
+		},
+	}).SignedString([]byte("not the signing key"))
+
+	bootstrapToken, _, _ := issueBootstrapToken("alice")
+	heartbeatToken, _ := issueHeartbeatToken("192.168.0.10")
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		authorization string
+		wantStatus    int
+	}{
+		{
+			name:       "test_missing_token",
+			method:     "GET",
+			url:        "/api/hosts",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "test_expired_token",
+			method:        "GET",
+			url:           "/api/hosts",
+			authorization: "Bearer " + expiredToken,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "test_forged_token",
+			method:        "GET",
+			url:           "/api/hosts",
+			authorization: "Bearer " + forgedToken,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "test_bootstrap_token",
+			method:        "GET",
+			url:           "/api/hosts",
+			authorization: "Bearer " + bootstrapToken,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "test_heartbeat_token",
+			method:        "GET",
+			url:           "/api/hosts",
+			authorization: "Bearer " + heartbeatToken,
+			wantStatus:    http.StatusUnauthorized,
+		},
+		{
+			name:          "test_read_only_get",
+			method:        "GET",
+			url:           "/api/hosts",
+			authorization: "Bearer " + newTestToken(t, "bob", mgmtmodel.RoleReadOnly),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "test_read_only_create",
+			method:        "POST",
+			url:           "/api/directories/create",
+			authorization: "Bearer " + newTestToken(t, "bob", mgmtmodel.RoleReadOnly),
+			wantStatus:    http.StatusForbidden,
+		},
+		{
+			name:          "test_operator_create",
+			method:        "POST",
+			url:           "/api/directories/create",
+			authorization: "Bearer " + newTestToken(t, "carol", mgmtmodel.RoleOperator),
+			wantStatus:    http.StatusOK,
+		},
+		{
+			name:          "test_admin_create",
+			method:        "POST",
+			url:           "/api/directories/create",
+			authorization: "Bearer " + newTestToken(t, "alice", mgmtmodel.RoleAdmin),
+			wantStatus:    http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.url, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	bootstrapToken, _, _ := issueBootstrapToken("alice")
+	heartbeatToken, _ := issueHeartbeatToken("192.168.0.10")
+
+	expiredHeartbeatToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   "192.168.0.10",
+			Audience:  jwt.ClaimStrings{heartbeatTokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}).SignedString(getSigningKey())
+
+	tests := []struct {
+		name     string
+		token    string
+		audience string
+		wantErr  bool
+	}{
+		{name: "test_bootstrap_token", token: bootstrapToken, audience: bootstrapTokenAudience},
+		{name: "test_heartbeat_token", token: heartbeatToken, audience: heartbeatTokenAudience},
+		{name: "test_expired_heartbeat_token", token: expiredHeartbeatToken, audience: heartbeatTokenAudience, wantErr: true},
+		{name: "test_portal_token", token: newTestToken(t, "alice", mgmtmodel.RoleAdmin)},
+		{name: "test_bootstrap_token_for_heartbeat", token: bootstrapToken, audience: heartbeatTokenAudience, wantErr: true},
+		{name: "test_heartbeat_token_for_call_home", token: heartbeatToken, audience: bootstrapTokenAudience, wantErr: true},
+		{name: "test_portal_token_for_call_home", token: newTestToken(t, "alice", mgmtmodel.RoleAdmin), audience: bootstrapTokenAudience, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseToken(tt.token, tt.audience)
+			assert.Equal(t, tt.wantErr, err != nil, "parseToken() error = %v", err)
+		})
+	}
+}
+
+func TestAgentAuthMiddleware(t *testing.T) {
+	if common.Logger == nil {
+		common.Logger = log.New()
+		t.Cleanup(func() { common.Logger = nil })
+	}
+
+	agentConfig := common.Config.Agent
+	t.Cleanup(func() { common.Config.Agent = agentConfig })
+	common.Config.Agent.Username = "admin"
+	common.Config.Agent.Password = "Passw0rd"
+
+	router := gin.New()
+	agent := router.Group("/agent")
+	agent.Use(AgentAuthMiddleware())
+	agent.GET("/system-info", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// The session token is got by the valid credentials.
+	req, _ := http.NewRequest("GET", "/agent/system-info", nil)
+	req.SetBasicAuth("admin", "Passw0rd")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	sessionToken := w.Header().Get(common.AgentTokenHeader)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, sessionToken)
+
+	tests := []struct {
+		name          string
+		username      string
+		password      string
+		authorization string
+		wantStatus    int
+		wantToken     bool
+	}{
+		{
+			name:       "test_missing_credentials",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "test_valid_credentials",
+			username:   "admin",
+			password:   "Passw0rd",
+			wantStatus: http.StatusOK,
+			wantToken:  true,
+		},
+		{
+			name:       "test_invalid_password",
+			username:   "admin",
+			password:   "wrong",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:          "test_valid_session_token",
+			authorization: "Bearer " + sessionToken,
+			wantStatus:    http.StatusOK,
+			wantToken:     true,
+		},
+		{
+			name:          "test_unknown_session_token",
+			authorization: "Bearer 0123456789abcdef",
+			wantStatus:    http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/agent/system-info", nil)
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantToken, w.Header().Get(common.AgentTokenHeader) != "")
+			if tt.wantStatus == http.StatusUnauthorized {
+				assert.Contains(t, w.Body.String(), `"error"`)
+			}
+		})
+	}
+
+	// No call is accepted if the credentials of the agent are not configured.
+	common.Config.Agent.Password = ""
+	req, _ = http.NewRequest("GET", "/agent/system-info", nil)
+	req.SetBasicAuth("admin", "")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
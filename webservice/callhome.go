@@ -0,0 +1,494 @@
+package webservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/agent"
+	"github.com/cryingmouse/data_management_engine/client"
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// The interval before the agent calls home again after a failure, the engine decides the interval of the heartbeats.
+const defaultCallHomeInterval = 30 * time.Second
+
+type CallHomeResponse struct {
+	HeartbeatToken string `json:"heartbeat_token"`
+	// The interval in seconds between the heartbeats.
+	HeartbeatInterval int    `json:"heartbeat_interval"`
+	RegistrationState string `json:"registration_state"`
+}
+
+// CreateBootstrapTokenHandler issues a bootstrap token, the agents configured with it call home to the engine.
+func CreateBootstrapTokenHandler(c *gin.Context) {
+	token, expiresAt, err := issueBootstrapToken(c.GetString("Username"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+// CallHomeHandler saves the host whose agent calls home with a bootstrap token, the unknown host is pending until
+// it is approved. It responds the token which the agent sends the heartbeats with.
+func CallHomeHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Token string `json:"token" binding:"required"`
+		// The IP address which the engine connects the agent by, the source address of the request is used if it is empty.
+		IP         string             `json:"ip" binding:"omitempty,ip"`
+		Port       int                `json:"port" binding:"required,min=1,max=65535"`
+		SystemInfo common.SystemInfo  `json:"system_info"`
+		Status     common.AgentStatus `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if _, err := parseToken(request.Token, bootstrapTokenAudience); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"IP":      c.ClientIP(),
+			"error":   err.Error(),
+		}).Warn("Unauthorized call home.")
+		ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", err.Error())
+		return
+	}
+
+	hostModel := mgmtmodel.Host{IP: request.IP, Port: request.Port}
+	if hostModel.IP == "" {
+		hostModel.IP = c.ClientIP()
+	}
+
+	err := hostModel.CallHome(ctx, request.SystemInfo, request.Status)
+	if errors.Is(err, mgmtmodel.ErrHostRegistered) {
+		sendHeartbeatToken(ctx, traceID, hostModel)
+		ErrorResponse(c, http.StatusConflict, "The host is registered already", "the heartbeat token is sent to the agent over mutual TLS")
+		return
+	}
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"IP":      hostModel.IP,
+			"error":   err.Error(),
+		}).Error("Failed to save the host which calls home.")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to save the host", err.Error())
+		return
+	}
+
+	heartbeatToken, err := issueHeartbeatToken(hostModel.IP)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token", err.Error())
+		return
+	}
+
+	common.Logger.WithFields(log.Fields{
+		"TraceID":           traceID,
+		"IP":                hostModel.IP,
+		"RegistrationState": hostModel.RegistrationState,
+	}).Info("The host calls home.")
+
+	c.JSON(http.StatusOK, CallHomeResponse{
+		HeartbeatToken:    heartbeatToken,
+		HeartbeatInterval: int(mgmtmodel.HeartbeatInterval().Seconds()),
+		RegistrationState: hostModel.RegistrationState,
+	})
+}
+
+// sendHeartbeatToken sends a new heartbeat token to the agent of the registered host over mutual TLS, instead of
+// responding it to the caller, who may be anyone with the bootstrap token.
+func sendHeartbeatToken(ctx context.Context, traceID string, hostModel mgmtmodel.Host) {
+	heartbeatToken, err := issueHeartbeatToken(hostModel.IP)
+	if err == nil {
+		err = hostModel.SendHeartbeatToken(ctx, heartbeatToken)
+	}
+
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"IP":      hostModel.IP,
+			"error":   err.Error(),
+		}).Error("Failed to send the heartbeat token to the registered host.")
+		return
+	}
+
+	common.Logger.WithFields(log.Fields{
+		"TraceID": traceID,
+		"IP":      hostModel.IP,
+	}).Info("The registered host calls home, the heartbeat token is sent to its agent.")
+}
+
+// HeartbeatHandler records the heartbeat of the agent, the host is the subject of the heartbeat token.
+// It responds a new token, so that the agent keeps the token from expiring.
+// The agent calls home again if the host is not found, e.g. it is unregistered.
+func HeartbeatHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Token  string             `json:"token" binding:"required"`
+		Status common.AgentStatus `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	claims, err := parseToken(request.Token, heartbeatTokenAudience)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"IP":      c.ClientIP(),
+			"error":   err.Error(),
+		}).Warn("Unauthorized heartbeat.")
+		ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", err.Error())
+		return
+	}
+
+	hostModel := mgmtmodel.Host{IP: claims.Subject}
+	if err := hostModel.Heartbeat(ctx, request.Status); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"IP":      hostModel.IP,
+			"error":   err.Error(),
+		}).Error("Failed to record the heartbeat of the host.")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The host is not found", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to record the heartbeat", err.Error())
+		}
+		return
+	}
+
+	heartbeatToken, err := issueHeartbeatToken(hostModel.IP)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to generate token", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"heartbeat_token":    heartbeatToken,
+		"registration_state": hostModel.RegistrationState,
+	})
+}
+
+// SetHeartbeatTokenOnAgentHandler receives the heartbeat token from the engine over mutual TLS, the engine sends it
+// once the registered host calls home, e.g. after the agent restarts.
+func SetHeartbeatTokenOnAgentHandler(c *gin.Context) {
+	_, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Token string `json:"token" binding:"required"`
+		// The interval in seconds between the heartbeats.
+		HeartbeatInterval int `json:"heartbeat_interval" binding:"min=0"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if c.Request.TLS == nil {
+		ErrorResponse(c, http.StatusForbidden, "The heartbeat token is received over mutual TLS only", "")
+		return
+	}
+
+	if agentCallHome == nil {
+		ErrorResponse(c, http.StatusConflict, "Failed to set the heartbeat token", "the agent does not call home to the engine")
+		return
+	}
+
+	agentCallHome.setHeartbeat(request.Token, time.Duration(request.HeartbeatInterval)*time.Second)
+
+	c.Status(http.StatusOK)
+}
+
+// ApproveHostHandler registers the pending host with the credentials of its agent.
+func ApproveHostHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		IP       string `json:"ip" binding:"required,ip"`
+		Username string `json:"username" binding:"required"`
+		Password string `json:"password" binding:"required,validatePassword"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+
+		SetErrorToContext(c, common.ErrRegisterHostInvalidRequest.Error(), err)
+		return
+	}
+
+	hostModel := mgmtmodel.Host{}
+	common.DeepCopy(request, &hostModel)
+
+	if err := hostModel.Approve(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":   traceID,
+			"HostModel": common.MaskPassword(hostModel),
+			"error":     err.Error(),
+		}).Error("Failed to approve the host.")
+
+		var definedErr *common.Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ErrorResponse(c, http.StatusNotFound, "The host is not found", err.Error())
+		case errors.Is(err, mgmtmodel.ErrHostNotPending):
+			ErrorResponse(c, http.StatusConflict, "Failed to approve the host", err.Error())
+		case errors.As(err, &definedErr):
+			SetErrorToContext(c, "", definedErr)
+		default:
+			SetErrorToContext(c, common.ErrRegisterHostUnknown.Error(), err)
+		}
+		return
+	}
+
+	hostResponse := HostResponse{}
+	common.DeepCopy(hostModel, &hostResponse)
+
+	c.JSON(http.StatusOK, hostResponse)
+}
+
+// callHomeClient calls home to the engine for the agent and sends the heartbeats.
+type callHomeClient struct {
+	restClient *client.RestClient
+
+	// The heartbeat token is set by the engine over mutual TLS as well, so it is guarded by the mutex.
+	mu             sync.Mutex
+	heartbeatToken string
+	interval       time.Duration
+}
+
+// The client which calls home for the agent, it is nil if the engine is not configured.
+var agentCallHome *callHomeClient
+
+// setHeartbeat keeps the heartbeat token and the interval between the heartbeats, the interval is kept unchanged
+// if it is not given.
+func (c *callHomeClient) setHeartbeat(token string, interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.heartbeatToken = token
+	if interval > 0 {
+		c.interval = interval
+	}
+}
+
+func (c *callHomeClient) getHeartbeat() (token string, interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.heartbeatToken, c.interval
+}
+
+// newEngineClient returns the client of the portal API of the engine at the URL, e.g. http://10.0.0.1:8080.
+func newEngineClient(engineURL string) (*client.RestClient, error) {
+	u, err := url.Parse(engineURL)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid URL of the engine: %s", engineURL)
+	}
+
+	port := 80
+	if u.Scheme == "https" {
+		port = 443
+	}
+	if u.Port() != "" {
+		if port, err = strconv.Atoi(u.Port()); err != nil {
+			return nil, fmt.Errorf("invalid URL of the engine: %s", engineURL)
+		}
+	}
+
+	prefixURL := path.Join(strings.Trim(u.Path, "/"), "api")
+
+	return client.GetRestClient(u.Scheme, common.HostContext{IP: u.Hostname()}, port, prefixURL, "", "", false), nil
+}
+
+// startCallHome calls home to the engine in the configuration [agent] and sends the heartbeats in background.
+// It does nothing if the engine is not configured.
+func startCallHome() {
+	config := common.Config.Agent
+	if config.EngineURL == "" {
+		return
+	}
+
+	restClient, err := newEngineClient(config.EngineURL)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{"error": err.Error()}).Error("Failed to call home to the engine.")
+		return
+	}
+
+	agentCallHome = &callHomeClient{restClient: restClient, interval: defaultCallHomeInterval}
+	go agentCallHome.run()
+}
+
+// run calls home until it gets the heartbeat token, and sends the heartbeats since then. It calls home again if the
+// heartbeat is rejected, e.g. the token expires, the host is unregistered or the engine is restarted with another
+// signing key. The engine sends the token of the registered host over mutual TLS instead of responding it.
+func (c *callHomeClient) run() {
+	for {
+		traceID := common.GenerateTraceID()
+		ctx := context.WithValue(context.Background(), common.TraceIDKey("TraceID"), traceID)
+
+		var err error
+		if token, _ := c.getHeartbeat(); token == "" {
+			err = c.callHome(ctx)
+		} else {
+			err = c.heartbeat(ctx, token)
+		}
+
+		if err != nil {
+			common.Logger.WithFields(log.Fields{
+				"TraceID": traceID,
+				"Engine":  common.Config.Agent.EngineURL,
+				"error":   err.Error(),
+			}).Warn("Failed to report to the engine.")
+		}
+
+		_, interval := c.getHeartbeat()
+		time.Sleep(interval)
+	}
+}
+
+func (c *callHomeClient) callHome(ctx context.Context) error {
+	localAgent := agent.GetAgent()
+
+	systemInfo, err := localAgent.GetSystemInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, err := localAgent.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := map[string]interface{}{
+		"token":       common.Config.Agent.BootstrapToken,
+		"ip":          common.Config.Agent.AdvertiseIP,
+		"port":        getAgentPort(),
+		"system_info": systemInfo,
+		"status":      status,
+	}
+
+	var response CallHomeResponse
+	if err := c.post(ctx, "hosts/call-home", request, &response); err != nil {
+		return fmt.Errorf("failed to call home: %w", err)
+	}
+
+	c.setHeartbeat(response.HeartbeatToken, time.Duration(response.HeartbeatInterval)*time.Second)
+
+	common.Logger.WithFields(log.Fields{
+		"Engine":            common.Config.Agent.EngineURL,
+		"RegistrationState": response.RegistrationState,
+	}).Info("Call home to the engine successfully.")
+
+	return nil
+}
+
+// heartbeat sends the heartbeat with the token, and keeps the new token responded by the engine.
+func (c *callHomeClient) heartbeat(ctx context.Context, token string) error {
+	status, err := agent.GetAgent().GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	request := map[string]interface{}{
+		"token":  token,
+		"status": status,
+	}
+
+	var response struct {
+		HeartbeatToken string `json:"heartbeat_token"`
+	}
+	err = c.post(ctx, "hosts/heartbeat", request, &response)
+
+	var statusErr *engineStatusError
+	if errors.As(err, &statusErr) && (statusErr.statusCode == http.StatusUnauthorized || statusErr.statusCode == http.StatusNotFound) {
+		c.setHeartbeat("", 0)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send the heartbeat: %w", err)
+	}
+
+	if response.HeartbeatToken != "" {
+		c.setHeartbeat(response.HeartbeatToken, 0)
+	}
+
+	return nil
+}
+
+// engineStatusError is the error responded by the engine.
+type engineStatusError struct {
+	statusCode int
+	message    string
+}
+
+func (e *engineStatusError) Error() string {
+	return fmt.Sprintf("the engine responds %d: %s", e.statusCode, e.message)
+}
+
+// post sends the request to the engine, and unmarshals the response into the result if it is not nil.
+func (c *callHomeClient) post(ctx context.Context, url string, request, result interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	restClient := c.restClient.WithContext(ctx)
+
+	response, err := restClient.Post(url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		var errorResponse struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		}
+		restClient.GetResponseBody(response, &errorResponse)
+
+		return &engineStatusError{statusCode: response.StatusCode, message: strings.TrimSpace(errorResponse.Message + " " + errorResponse.Error)}
+	}
+
+	if result == nil {
+		response.Body.Close()
+		return nil
+	}
+
+	return restClient.GetResponseBody(response, result)
+}
@@ -0,0 +1,241 @@
+package webservice
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/pki"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAgentPort    = 8080
+	defaultAgentTLSPort = 8443
+)
+
+var (
+	agentTLSMu     sync.Mutex
+	agentTLSServer *http.Server
+	// The handler of the web service, it is served over mutual TLS as well once the agent has its certificate.
+	agentTLSHandler http.Handler
+)
+
+func getAgentPort() int {
+	if port := common.Config.Agent.Port; port != 0 {
+		return port
+	}
+
+	return defaultAgentPort
+}
+
+func getAgentTLSPort() int {
+	if port := common.Config.Agent.TLSPort; port != 0 {
+		return port
+	}
+
+	return defaultAgentTLSPort
+}
+
+// getAgentAddress returns the address which the agent listens on with the port.
+func getAgentAddress(port int) string {
+	return net.JoinHostPort(common.Config.Agent.ListenAddress, strconv.Itoa(port))
+}
+
+// isAgentEnrolled reports whether the agent has the certificate issued by the engine.
+func isAgentEnrolled() bool {
+	certFile := common.Config.Agent.CertFile
+	if certFile == "" {
+		return false
+	}
+
+	_, err := os.Stat(certFile)
+
+	return err == nil
+}
+
+// startAgentTLSServer serves the web service over mutual TLS, only the clients with a certificate signed by
+// the CA of the engine are accepted. It does nothing if the server is already started.
+func startAgentTLSServer() error {
+	agentTLSMu.Lock()
+	defer agentTLSMu.Unlock()
+
+	if agentTLSServer != nil {
+		return nil
+	}
+
+	config := common.Config.Agent
+	tlsConfig, err := pki.ServerTLSConfig(config.CertFile, config.KeyFile, config.EngineCAFile)
+	if err != nil {
+		return err
+	}
+
+	listener, err := tls.Listen("tcp", getAgentAddress(getAgentTLSPort()), tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	agentTLSServer = &http.Server{Handler: agentTLSHandler}
+	go func() {
+		if err := agentTLSServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			common.Logger.WithFields(log.Fields{"error": err.Error()}).Error("The agent web service over mutual TLS is stopped.")
+		}
+	}()
+
+	return nil
+}
+
+// AgentTLSMiddleware rejects the agent API over plain HTTP once the agent has its certificate, and over mutual TLS
+// unless the client is the engine, so that the agent is managed only by the engine which issued the certificate.
+// The other agents hold the certificates signed by the same CA, they are accepted by the replication API only.
+func AgentTLSMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkAgentTLS(c) {
+			return
+		}
+
+		if state := c.Request.TLS; state != nil {
+			if len(state.PeerCertificates) == 0 || !pki.IsEngineCertificate(state.PeerCertificates[0]) {
+				ErrorResponse(c, http.StatusForbidden, "The agent API requires the client certificate of the engine", "")
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// ReplicationTLSMiddleware rejects the replication API over plain HTTP once the agent has its certificate,
+// the destination agents present their own certificates signed by the CA of the engine.
+func ReplicationTLSMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkAgentTLS(c) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// checkAgentTLS aborts the request over plain HTTP if the agent has its certificate.
+func checkAgentTLS(c *gin.Context) bool {
+	if c.Request.TLS == nil && isAgentEnrolled() {
+		ErrorResponse(c, http.StatusForbidden, "The agent API requires mutual TLS", "")
+		c.Abort()
+		return false
+	}
+
+	return true
+}
+
+// GetCertificateRequestOnAgentHandler responds the certificate signing request of the agent for the engine to sign,
+// with the port over mutual TLS and whether the agent already has a certificate.
+// The private key is generated at the first call and never leaves the agent.
+func GetCertificateRequestOnAgentHandler(c *gin.Context) {
+	_, traceID := SetTraceIDToContext(c)
+
+	keyFile := common.Config.Agent.KeyFile
+	if keyFile == "" {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the certificate signing request", "the key file of the agent is not configured")
+		return
+	}
+
+	key, err := pki.LoadOrCreateKey(keyFile)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Failed to load the private key of the agent.")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the certificate signing request", err.Error())
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	csr, err := pki.CreateCertificateRequest(key, hostname)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the certificate signing request", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"csr":      string(csr),
+		"enrolled": isAgentEnrolled(),
+		"tls_port": getAgentTLSPort(),
+	})
+}
+
+// InstallCertificateOnAgentHandler installs the certificate signed by the engine, and trusts the CA of the engine
+// for the client certificates. The certificate is installed only once, the agent is served over mutual TLS since then.
+func InstallCertificateOnAgentHandler(c *gin.Context) {
+	_, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Certificate   string `json:"certificate" binding:"required"`
+		CACertificate string `json:"ca_certificate" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if isAgentEnrolled() {
+		ErrorResponse(c, http.StatusConflict, "Failed to install the certificate", "the agent already has a certificate")
+		return
+	}
+
+	config := common.Config.Agent
+	if config.CertFile == "" || config.EngineCAFile == "" {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to install the certificate", "the certificate files of the agent are not configured")
+		return
+	}
+
+	key, err := pki.LoadKey(config.KeyFile)
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Failed to install the certificate", "no certificate signing request is created by the agent")
+		return
+	}
+
+	if err := pki.VerifyAgentCertificate([]byte(request.Certificate), []byte(request.CACertificate), key); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid certificate.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid certificate", err.Error())
+		return
+	}
+
+	// The certificate is written last, the agent is regarded as enrolled once it exists.
+	if err := os.WriteFile(config.EngineCAFile, []byte(request.CACertificate), 0644); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to install the certificate", err.Error())
+		return
+	}
+	if err := os.WriteFile(config.CertFile, []byte(request.Certificate), 0644); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to install the certificate", err.Error())
+		return
+	}
+
+	if err := startAgentTLSServer(); err != nil {
+		// Remove the certificate so that the agent can be enrolled again.
+		os.Remove(config.CertFile)
+
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Failed to start the agent web service over mutual TLS.")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to start the agent web service over mutual TLS", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
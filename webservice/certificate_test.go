@@ -0,0 +1,111 @@
+package webservice
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/pki"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentTLSMiddleware(t *testing.T) {
+	if common.Logger == nil {
+		common.Logger = log.New()
+		t.Cleanup(func() { common.Logger = nil })
+	}
+
+	dir := t.TempDir()
+
+	ca, err := pki.LoadOrCreateCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateCA() error = %v", err)
+	}
+
+	engineCert, err := ca.ClientCertificate()
+	if err != nil {
+		t.Fatalf("ClientCertificate() error = %v", err)
+	}
+
+	key, _ := pki.LoadOrCreateKey(filepath.Join(dir, "agent.key"))
+	csr, _ := pki.CreateCertificateRequest(key, "agent")
+	certPEM, _, err := ca.SignAgentCertificate(csr, "192.0.2.10")
+	if err != nil {
+		t.Fatalf("SignAgentCertificate() error = %v", err)
+	}
+	agentCert, err := pki.ParseCertificatePEM(certPEM)
+	if err != nil {
+		t.Fatalf("ParseCertificatePEM() error = %v", err)
+	}
+
+	// The agent is regarded as enrolled once its certificate exists.
+	agentConfig := common.Config.Agent
+	t.Cleanup(func() { common.Config.Agent = agentConfig })
+	common.Config.Agent.CertFile = filepath.Join(dir, "agent.crt")
+	if err := os.WriteFile(common.Config.Agent.CertFile, certPEM, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Group("/agent", AgentTLSMiddleware()).GET("/system-info", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.Group("/replication", ReplicationTLSMiddleware()).GET("/manifest", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		path       string
+		peer       *x509.Certificate
+		plain      bool
+		wantStatus int
+	}{
+		{
+			name:       "test_engine_on_agent_api",
+			path:       "/agent/system-info",
+			peer:       engineCert.Leaf,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "test_other_agent_on_agent_api",
+			path:       "/agent/system-info",
+			peer:       agentCert,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test_plain_http_on_agent_api",
+			path:       "/agent/system-info",
+			plain:      true,
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "test_other_agent_on_replication_api",
+			path:       "/replication/manifest",
+			peer:       agentCert,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "test_plain_http_on_replication_api",
+			path:       "/replication/manifest",
+			plain:      true,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if !tt.plain {
+				req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.peer}}
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package webservice
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/agent"
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/cryingmouse/data_management_engine/mgmtmodel"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type DirectoryResponse struct {
@@ -20,6 +24,17 @@ type DirectoryResponse struct {
 	Exist          bool   `json:"exist,omitempty"`
 	FullPath       string `json:"full_path,omitempty"`
 	ParentFullPath string `json:"parent_full_path,omitempty"`
+
+	SoftLimitBytes  int64      `json:"soft_limit_bytes"`
+	HardLimitBytes  int64      `json:"hard_limit_bytes"`
+	SoftLimitFiles  int64      `json:"soft_limit_files"`
+	HardLimitFiles  int64      `json:"hard_limit_files"`
+	UsedBytes       int64      `json:"used_bytes"`
+	UsedFiles       int64      `json:"used_files"`
+	UsageUpdateTime *time.Time `json:"usage_update_time,omitempty"`
+	// The details of the usage are returned with the query parameter with_usage=true only.
+	LargestFiles []common.FileUsage `json:"largest_files,omitempty"`
+	AgeHistogram []common.AgeBucket `json:"age_histogram,omitempty"`
 }
 
 type PaginationDirectoryResponse struct {
@@ -34,6 +49,69 @@ type requestDirectory struct {
 	HostIP string `json:"host_ip" binding:"required,ip"`
 }
 
+// requestDirectoryUpdate renames the directory in the same parent.
+type requestDirectoryUpdate struct {
+	Name   string `json:"name" binding:"required"`
+	HostIP string `json:"host_ip" binding:"required,ip"`
+	common.DirectoryUpdate
+}
+
+// requestDirectoryQuota sets the limits of the directory, the quota is cleared if all the limits are 0.
+type requestDirectoryQuota struct {
+	Name   string `json:"name" binding:"required"`
+	HostIP string `json:"host_ip" binding:"required,ip"`
+	common.DirectoryQuota
+}
+
+// requestDirectoryACL replaces the ACL of the directory, the inherited entries are not changed.
+type requestDirectoryACL struct {
+	Name   string `json:"name" binding:"required"`
+	HostIP string `json:"host_ip" binding:"required,ip"`
+	common.DirectoryACL
+}
+
+type DirectoryACLResponse struct {
+	Name   string `json:"name"`
+	HostIP string `json:"host_ip"`
+	common.DirectoryACL
+}
+
+// getDirectoryNames returns the names of the directories in the form of 'host_ip:name' to name the items of the job.
+func getDirectoryNames(directoryListModel mgmtmodel.DirectoryList) []string {
+	names := make([]string, len(directoryListModel.Directories))
+	for i, directory := range directoryListModel.Directories {
+		names[i] = directory.HostIP + ":" + directory.Name
+	}
+
+	return names
+}
+
+// toDirectoryResponses converts the directories, the details of the usage are dropped unless they are asked for.
+func toDirectoryResponses(directories []mgmtmodel.Directory, withUsage bool) []DirectoryResponse {
+	directoryResponses := make([]DirectoryResponse, len(directories))
+	common.DeepCopy(directories, &directoryResponses)
+
+	if !withUsage {
+		for i := range directoryResponses {
+			directoryResponses[i].LargestFiles = nil
+			directoryResponses[i].AgeHistogram = nil
+		}
+	}
+
+	return directoryResponses
+}
+
+// collectDirectoryUsage refreshes the stale usage of the directories. The directories are responded with the usage
+// saved if the collection fails, so the failure is logged only, and the age of the usage tells the staleness.
+func collectDirectoryUsage(ctx context.Context, traceID string, directoryListModel *mgmtmodel.DirectoryList) {
+	if err := directoryListModel.CollectUsage(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Warning("Failed to collect the usage of the directories.")
+	}
+}
+
 func CreateDirectoryHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -51,7 +129,7 @@ func CreateDirectoryHandler(c *gin.Context) {
 	common.DeepCopy(request, &directoryModel)
 
 	if err := directoryModel.Create(ctx); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the directory", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the directory", err.Error())
 		return
 	}
 
@@ -77,8 +155,23 @@ func CreateDirectoriesHandler(c *gin.Context) {
 	directoryListModel := mgmtmodel.DirectoryList{}
 	common.DeepCopy(request, &directoryListModel.Directories)
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeCreateDirectories, getDirectoryNames(directoryListModel), func(ctx context.Context, index int) (interface{}, error) {
+			directoryModel := directoryListModel.Directories[index]
+			if err := directoryModel.Create(ctx); err != nil {
+				return nil, err
+			}
+
+			directoryResponse := DirectoryResponse{}
+			common.DeepCopy(directoryModel, &directoryResponse)
+
+			return directoryResponse, nil
+		})
+		return
+	}
+
 	if err := directoryListModel.Create(ctx); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the directories", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the directories", err.Error())
 		return
 	}
 
@@ -105,7 +198,7 @@ func DeleteDirectoryHandler(c *gin.Context) {
 	common.DeepCopy(request, &directoryModel)
 
 	if err := directoryModel.Delete(ctx); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the directory", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to delete the directory", err.Error())
 		return
 	}
 
@@ -128,8 +221,17 @@ func DeleteDirectoriesHandler(c *gin.Context) {
 	directoryListModel := mgmtmodel.DirectoryList{}
 	common.DeepCopy(request, &directoryListModel.Directories)
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeDeleteDirectories, getDirectoryNames(directoryListModel), func(ctx context.Context, index int) (interface{}, error) {
+			directoryModel := directoryListModel.Directories[index]
+
+			return nil, directoryModel.Delete(ctx)
+		})
+		return
+	}
+
 	if err := directoryListModel.Delete(ctx, nil); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the directories", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to delete the directories", err.Error())
 		return
 	}
 
@@ -145,6 +247,7 @@ func GetDirectoriesHandler(c *gin.Context) {
 	nameKeyword := c.Query("q")
 	page, _ := strconv.Atoi(c.Query("page"))
 	limit, _ := strconv.Atoi(c.Query("limit"))
+	withUsage, _ := strconv.ParseBool(c.Query("with_usage"))
 
 	if hostIP != "" && validateIPAddress(hostIP) != nil {
 		common.Logger.WithFields(log.Fields{
@@ -173,16 +276,16 @@ func GetDirectoriesHandler(c *gin.Context) {
 
 		if page == 0 && limit == 0 {
 			// Query directories without pagination.
-			directories, err := directoryListModel.Get(ctx, &filter)
-			if err != nil {
+			if _, err := directoryListModel.Get(ctx, &filter); err != nil {
 				ErrorResponse(c, http.StatusInternalServerError, "Failed to get the directories", err.Error())
 				return
 			}
 
-			directoryList := make([]DirectoryResponse, len(directories))
-			common.DeepCopy(directories, &directoryList)
+			if withUsage {
+				collectDirectoryUsage(ctx, traceID, &directoryListModel)
+			}
 
-			c.JSON(http.StatusOK, directoryList)
+			c.JSON(http.StatusOK, toDirectoryResponses(directoryListModel.Directories, withUsage))
 		} else {
 			// Query directories with pagination.
 			filter.Pagination = &common.Pagination{
@@ -196,13 +299,16 @@ func GetDirectoriesHandler(c *gin.Context) {
 				return
 			}
 
-			paginationDirList := PaginationDirectoryResponse{
-				Page:       page,
-				Limit:      limit,
-				TotalCount: paginationDirs.TotalCount,
+			if withUsage {
+				collectDirectoryUsage(ctx, traceID, &mgmtmodel.DirectoryList{Directories: paginationDirs.Directories})
 			}
 
-			common.DeepCopy(paginationDirs.Directories, &paginationDirList.Directories)
+			paginationDirList := PaginationDirectoryResponse{
+				Directories: toDirectoryResponses(paginationDirs.Directories, withUsage),
+				Page:        page,
+				Limit:       limit,
+				TotalCount:  paginationDirs.TotalCount,
+			}
 
 			c.JSON(http.StatusOK, paginationDirList)
 		}
@@ -218,13 +324,202 @@ func GetDirectoriesHandler(c *gin.Context) {
 			return
 		}
 
-		directoryInfo := DirectoryResponse{}
-		common.DeepCopy(directory, &directoryInfo)
+		directoryListModel := mgmtmodel.DirectoryList{Directories: []mgmtmodel.Directory{*directory}}
+		if withUsage {
+			collectDirectoryUsage(ctx, traceID, &directoryListModel)
+		}
+
+		c.JSON(http.StatusOK, toDirectoryResponses(directoryListModel.Directories, withUsage))
+	}
+}
+
+func UpdateDirectoryHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestDirectoryUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := request.DirectoryUpdate.Validate(); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	directoryModel := mgmtmodel.Directory{Name: request.Name, HostIP: request.HostIP}
+	if err := directoryModel.Update(ctx, request.DirectoryUpdate); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The directory is not found", err.Error())
+		} else if errors.Is(err, mgmtmodel.ErrDirectoryInUse) {
+			ErrorResponse(c, http.StatusConflict, "Failed to update the directory", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to update the directory", err.Error())
+		}
+		return
+	}
+
+	directoryResponse := DirectoryResponse{}
+	common.DeepCopy(directoryModel, &directoryResponse)
+
+	c.JSON(http.StatusOK, directoryResponse)
+}
+
+func SetDirectoryQuotaHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestDirectoryQuota
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := request.DirectoryQuota.Validate(); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	directoryModel := mgmtmodel.Directory{
+		Name:           request.Name,
+		HostIP:         request.HostIP,
+		SoftLimitBytes: request.SoftLimitBytes,
+		HardLimitBytes: request.HardLimitBytes,
+		SoftLimitFiles: request.SoftLimitFiles,
+		HardLimitFiles: request.HardLimitFiles,
+	}
+
+	if err := directoryModel.SetQuota(ctx); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The directory is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to set the quota of the directory", err.Error())
+		}
+		return
+	}
+
+	directoryResponse := DirectoryResponse{}
+	common.DeepCopy(directoryModel, &directoryResponse)
+
+	c.JSON(http.StatusOK, directoryResponse)
+}
+
+// GetDirectoryQuotaHandler queries the quota and the usage of the directory on its host, the saved ones are refreshed.
+func GetDirectoryQuotaHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	name := c.Query("name")
+	hostIP := c.Query("host_ip")
+
+	if name == "" || validateIPAddress(hostIP) != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
+		return
+	}
+
+	directoryModel := mgmtmodel.Directory{Name: name, HostIP: hostIP}
+	if err := directoryModel.GetQuota(ctx); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The directory is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to get the quota of the directory", err.Error())
+		}
+		return
+	}
+
+	directoryResponse := DirectoryResponse{}
+	common.DeepCopy(directoryModel, &directoryResponse)
+
+	c.JSON(http.StatusOK, directoryResponse)
+}
+
+func SetDirectoryACLHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestDirectoryACL
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := request.DirectoryACL.Validate(); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	directoryModel := mgmtmodel.Directory{Name: request.Name, HostIP: request.HostIP}
+	if err := directoryModel.SetACL(ctx, request.DirectoryACL); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The directory is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to set the ACL of the directory", err.Error())
+		}
+		return
+	}
+
+	// The ACL is read back, since the host may add the entries such as the base ones of POSIX.
+	acl, err := directoryModel.GetACL(ctx)
+	if err != nil {
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to get the ACL of the directory", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, DirectoryACLResponse{Name: request.Name, HostIP: request.HostIP, DirectoryACL: acl})
+}
 
-		directoryInfoList := []DirectoryResponse{directoryInfo}
+func GetDirectoryACLHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
 
-		c.JSON(http.StatusOK, directoryInfoList)
+	name := c.Query("name")
+	hostIP := c.Query("host_ip")
+
+	if name == "" || validateIPAddress(hostIP) != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
+		return
 	}
+
+	directoryModel := mgmtmodel.Directory{Name: name, HostIP: hostIP}
+	acl, err := directoryModel.GetACL(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The directory is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to get the ACL of the directory", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, DirectoryACLResponse{Name: name, HostIP: hostIP, DirectoryACL: acl})
 }
 
 func CreateDirectoryOnAgentHandler(c *gin.Context) {
@@ -282,6 +577,37 @@ func DeleteDirectoryOnAgentHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+func UpdateDirectoryOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name" binding:"required"`
+		common.DirectoryUpdate
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	// The agent checks the new name as well, so it is never renamed out of the root folder.
+	if err := request.DirectoryUpdate.Validate(); err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.UpdateDirectory(ctx, request.Name, request.DirectoryUpdate); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update the directory", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func CreateDirectoriesOnAgentHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -347,20 +673,16 @@ func DeleteDirectoriesOnAgentHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// GetDirectoryDetailOnAgentHandler responds the detail of the directory for a single name, otherwise a list of the
+// directories, which has all the directories in the root folder if no name is given.
 func GetDirectoryDetailOnAgentHandler(c *gin.Context) {
-	ctx, traceID := SetTraceIDToContext(c)
+	ctx, _ := SetTraceIDToContext(c)
 
 	name := c.Query("name")
 	names := common.SplitToList(name)
 
 	agent := agent.GetAgent()
-	if len(names) == 0 {
-		common.Logger.WithFields(log.Fields{
-			"TraceID": traceID,
-			"URL":     c.Request.URL,
-		}).Error("Invalid request.")
-		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
-	} else if len(names) == 1 {
+	if len(names) == 1 {
 		directoryDetail, err := agent.GetDirectoryDetail(ctx, name)
 		if err != nil {
 			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the directory details", err.Error())
@@ -375,6 +697,125 @@ func GetDirectoryDetailOnAgentHandler(c *gin.Context) {
 			return
 		}
 
+		if directoriesDetail == nil {
+			directoriesDetail = []common.DirectoryDetail{}
+		}
+
 		c.JSON(http.StatusOK, directoriesDetail)
 	}
 }
+
+func SetDirectoryQuotaOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name"`
+		common.DirectoryQuota
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.SetDirectoryQuota(ctx, request.Name, request.DirectoryQuota); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to set the quota of the directory", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func ClearDirectoryQuotaOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.ClearDirectoryQuota(ctx, request.Name); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to clear the quota of the directory", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetDirectoryQuotaOnAgentHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	agent := agent.GetAgent()
+	quota, err := agent.GetDirectoryQuota(ctx, c.Query("name"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the quota of the directory", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, quota)
+}
+
+func SetDirectoryACLOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name"`
+		common.DirectoryACL
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.SetDirectoryACL(ctx, request.Name, request.DirectoryACL); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to set the ACL of the directory", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetDirectoryACLOnAgentHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	agent := agent.GetAgent()
+	acl, err := agent.GetDirectoryACL(ctx, c.Query("name"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the ACL of the directory", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, acl)
+}
+
+// GetDirectoryUsageOnAgentHandler walks the directory, the walk is stopped once the engine gives up the request.
+func GetDirectoryUsageOnAgentHandler(c *gin.Context) {
+	_, traceID := SetTraceIDToContext(c)
+	ctx := context.WithValue(c.Request.Context(), common.TraceIDKey("TraceID"), traceID)
+
+	agent := agent.GetAgent()
+	usage, err := agent.GetDirectoryUsage(ctx, c.Query("name"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the usage of the directory", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
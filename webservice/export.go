@@ -0,0 +1,291 @@
+package webservice
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cryingmouse/data_management_engine/agent"
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type NFSExportResponse struct {
+	HostIP        string             `json:"host_ip,omitempty"`
+	DirectoryName string             `json:"directory_name,omitempty"`
+	ExportPath    string             `json:"export_path,omitempty"`
+	Clients       []common.NFSClient `json:"clients,omitempty"`
+}
+
+type PaginationNFSExportResponse struct {
+	Exports    []NFSExportResponse `json:"exports"`
+	Page       int                 `json:"page"`
+	Limit      int                 `json:"limit"`
+	TotalCount int64               `json:"total_count"`
+}
+
+type NFSClientRequest struct {
+	Host   string `json:"host" binding:"required"`
+	Access string `json:"access" binding:"required,oneof=rw ro"`
+	// The root user of the client is squashed unless root_squash is false explicitly.
+	RootSquash *bool `json:"root_squash"`
+}
+
+func validateNFSClients(requests []NFSClientRequest) error {
+	for _, request := range requests {
+		if err := common.ValidateNFSClientHost(request.Host); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func toNFSClients(requests []NFSClientRequest) []common.NFSClient {
+	clients := make([]common.NFSClient, len(requests))
+	for i, request := range requests {
+		clients[i] = common.NFSClient{
+			Host:       request.Host,
+			Access:     request.Access,
+			RootSquash: request.RootSquash == nil || *request.RootSquash,
+		}
+	}
+
+	return clients
+}
+
+func toNFSExportResponse(export mgmtmodel.NFSExport) NFSExportResponse {
+	return NFSExportResponse{
+		HostIP:        export.HostIP,
+		DirectoryName: export.DirectoryName,
+		ExportPath:    export.ExportPath,
+		Clients:       export.Clients,
+	}
+}
+
+func CreateExportHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		HostIP        string             `json:"host_ip" binding:"required"`
+		DirectoryName string             `json:"directory_name" binding:"required"`
+		Clients       []NFSClientRequest `json:"clients" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := validateNFSClients(request.Clients); err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	exportModel := mgmtmodel.NFSExport{
+		HostIP:        request.HostIP,
+		DirectoryName: request.DirectoryName,
+		Clients:       toNFSClients(request.Clients),
+	}
+
+	if err := exportModel.Create(ctx); err != nil {
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the export", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, toNFSExportResponse(exportModel))
+}
+
+func DeleteExportHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		HostIP        string `json:"host_ip" binding:"required"`
+		DirectoryName string `json:"directory_name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	exportModel := mgmtmodel.NFSExport{
+		HostIP:        request.HostIP,
+		DirectoryName: request.DirectoryName,
+	}
+
+	if err := exportModel.Delete(ctx); err != nil {
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to delete the export", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetExportsHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	directoryName := c.Query("directory_name")
+	hostIP := c.Query("host_ip")
+	fields := c.Query("fields")
+	nameKeyword := c.Query("q")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	if hostIP != "" && validateIPAddress(hostIP) != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
+		return
+	}
+
+	if directoryName == "" || hostIP == "" {
+		exportListModel := mgmtmodel.NFSExportList{}
+		filter := common.QueryFilter{
+			Fields: common.SplitToList(fields),
+			Keyword: map[string]string{
+				"directory_name": nameKeyword,
+			},
+			Conditions: struct {
+				HostIP        string
+				DirectoryName string
+			}{
+				HostIP:        hostIP,
+				DirectoryName: directoryName,
+			},
+		}
+
+		if page == 0 && limit == 0 {
+			// Query exports without pagination.
+			exports, err := exportListModel.Get(ctx, &filter)
+			if err != nil {
+				ErrorResponse(c, http.StatusInternalServerError, "Failed to get the exports", err.Error())
+				return
+			}
+
+			exportList := make([]NFSExportResponse, 0, len(exports))
+			for _, export := range exports {
+				exportList = append(exportList, toNFSExportResponse(export))
+			}
+
+			c.JSON(http.StatusOK, exportList)
+		} else {
+			// Query exports with pagination.
+			filter.Pagination = &common.Pagination{
+				Page:     page,
+				PageSize: limit,
+			}
+
+			paginationExports, err := exportListModel.Pagination(ctx, &filter)
+			if err != nil {
+				ErrorResponse(c, http.StatusInternalServerError, "Failed to get the exports", err.Error())
+				return
+			}
+
+			paginationExportList := PaginationNFSExportResponse{
+				Page:       page,
+				Limit:      limit,
+				TotalCount: paginationExports.TotalCount,
+				Exports:    make([]NFSExportResponse, 0, len(paginationExports.Exports)),
+			}
+
+			for _, export := range paginationExports.Exports {
+				paginationExportList.Exports = append(paginationExportList.Exports, toNFSExportResponse(export))
+			}
+
+			c.JSON(http.StatusOK, paginationExportList)
+		}
+	} else {
+		exportModel := mgmtmodel.NFSExport{
+			HostIP:        hostIP,
+			DirectoryName: directoryName,
+		}
+
+		export, err := exportModel.Get(ctx)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the export", err.Error())
+			return
+		}
+
+		c.JSON(http.StatusOK, []NFSExportResponse{toNFSExportResponse(*export)})
+	}
+}
+
+func CreateExportOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string             `json:"directory_name" binding:"required"`
+		Clients       []NFSClientRequest `json:"clients" binding:"required,min=1,dive"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+
+	if err := agent.CreateNFSExport(ctx, request.DirectoryName, toNFSClients(request.Clients)); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the export", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func DeleteExportOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string `json:"directory_name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.DeleteNFSExport(ctx, request.DirectoryName); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the export", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// GetExportOnAgentHandler always responds a list, which has all the exports on the host if no name is given.
+func GetExportOnAgentHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	names := common.SplitToList(c.Query("name"))
+
+	agent := agent.GetAgent()
+	exportsDetail, err := agent.GetNFSExportsDetail(ctx, names)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the exports detail", err.Error())
+		return
+	}
+
+	if exportsDetail == nil {
+		exportsDetail = []common.NFSExportDetail{}
+	}
+
+	c.JSON(http.StatusOK, exportsDetail)
+}
@@ -1,15 +1,19 @@
 package webservice
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/cryingmouse/data_management_engine/agent"
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/cryingmouse/data_management_engine/mgmtmodel"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
@@ -22,11 +26,52 @@ type HostResponse struct {
 	IP             string `json:"ip,omitempty"`
 	ComputerName   string `json:"name,omitempty"`
 	StorageType    string `json:"storage_type,omitempty"`
+	Scheme         string `json:"scheme,omitempty"`
+	Port           int    `json:"port,omitempty"`
 	Caption        string `json:"os_type,omitempty"`
 	OSArchitecture string `json:"os_arch,omitempty"`
 	OSVersion      string `json:"os_version,omitempty"`
 	BuildNumber    string `json:"build_number,omitempty"`
 	Username       string `json:"username,omitempty"`
+	HealthState    string `json:"health_state,omitempty"`
+	// The fingerprint of the certificate of the agent, the engine connects the agent only if its certificate matches it.
+	CertFingerprint string `json:"cert_fingerprint,omitempty"`
+	// The host whose agent called home is pending until it is approved.
+	RegistrationState string `json:"registration_state,omitempty"`
+	// The status reported by the latest heartbeat of the agent.
+	AgentVersion      string     `json:"agent_version,omitempty"`
+	Load              float64    `json:"load,omitempty"`
+	Uptime            int64      `json:"uptime,omitempty"`
+	LastHeartbeatTime *time.Time `json:"last_heartbeat_time,omitempty"`
+}
+
+type HostHealthCheckResponse struct {
+	State     string    `json:"state"`
+	CheckTime time.Time `json:"check_time"`
+	Latency   int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type HostHealthResponse struct {
+	IP              string                    `json:"ip"`
+	Connected       bool                      `json:"connected"`
+	HealthState     string                    `json:"health_state"`
+	FailureCount    int                       `json:"failure_count"`
+	LastCheckTime   *time.Time                `json:"last_check_time,omitempty"`
+	LastSuccessTime *time.Time                `json:"last_success_time,omitempty"`
+	StateChangeTime *time.Time                `json:"state_change_time,omitempty"`
+	NextCheckTime   *time.Time                `json:"next_check_time,omitempty"`
+	History         []HostHealthCheckResponse `json:"history"`
+}
+
+type HostCapacityResponse struct {
+	HostIP                  string     `json:"host_ip"`
+	DirectoryCount          int        `json:"directory_count"`
+	UsedBytes               int64      `json:"used_bytes"`
+	UsedFiles               int64      `json:"used_files"`
+	QuotaHardLimitBytes     int64      `json:"quota_hard_limit_bytes"`
+	UnlimitedDirectoryCount int        `json:"unlimited_directory_count"`
+	UsageUpdateTime         *time.Time `json:"usage_update_time,omitempty"`
 }
 
 type PaginationHostResponse struct {
@@ -36,6 +81,16 @@ type PaginationHostResponse struct {
 	TotalCount int64          `json:"total_count"`
 }
 
+// getHostIPs returns the IP addresses of the hosts to name the items of the job.
+func getHostIPs(hostListModel mgmtmodel.HostList) []string {
+	ips := make([]string, len(hostListModel.Hosts))
+	for i, host := range hostListModel.Hosts {
+		ips[i] = host.IP
+	}
+
+	return ips
+}
+
 func RegisterHostHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -44,6 +99,9 @@ func RegisterHostHandler(c *gin.Context) {
 		Username    string `json:"username" binding:"required"`
 		Password    string `json:"password" binding:"required,validatePassword"`
 		StorageType string `json:"storage_type" binding:"required,oneof=workstation ontap magnascale"`
+		// The port of the agent or the storage management API, the default port of the storage type is used if it is not set.
+		Port               int  `json:"port" binding:"omitempty,min=1,max=65535"`
+		InsecureSkipVerify bool `json:"insecure_skip_verify"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -98,6 +156,9 @@ func RegisterHostsHandler(c *gin.Context) {
 		Username    string `json:"username" binding:"required"`
 		Password    string `json:"password" binding:"required,validatePassword"`
 		StorageType string `json:"storage_type" binding:"required,oneof=workstation ontap magnascale"`
+		// The port of the agent or the storage management API, the default port of the storage type is used if it is not set.
+		Port               int  `json:"port" binding:"omitempty,min=1,max=65535"`
+		InsecureSkipVerify bool `json:"insecure_skip_verify"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		common.Logger.WithFields(log.Fields{
@@ -116,6 +177,21 @@ func RegisterHostsHandler(c *gin.Context) {
 		"HostListModel": common.MaskPassword(hostListModel),
 	}).Debug("Copy host list model.")
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeRegisterHosts, getHostIPs(hostListModel), func(ctx context.Context, index int) (interface{}, error) {
+			hostModel := hostListModel.Hosts[index]
+			if err := hostModel.Register(ctx); err != nil {
+				return nil, err
+			}
+
+			hostResponse := HostResponse{}
+			common.DeepCopy(hostModel, &hostResponse)
+
+			return hostResponse, nil
+		})
+		return
+	}
+
 	if err := hostListModel.Register(ctx); err != nil {
 		common.Logger.WithFields(log.Fields{
 			"TraceID":       traceID,
@@ -213,6 +289,15 @@ func UnregisterHostsHandler(c *gin.Context) {
 		"HostListModel": hostListModel,
 	}).Debug("Copy host list model.")
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeUnregisterHosts, getHostIPs(hostListModel), func(ctx context.Context, index int) (interface{}, error) {
+			hostModel := hostListModel.Hosts[index]
+
+			return nil, hostModel.Unregister(ctx)
+		})
+		return
+	}
+
 	if err := hostListModel.Unregister(ctx); err != nil {
 		common.Logger.WithFields(log.Fields{
 			"TraceID":       traceID,
@@ -394,6 +479,88 @@ func GetRegisteredHostsHandler(c *gin.Context) {
 	}
 }
 
+func GetHostHealthHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	hostIP := c.Param("ip")
+	limit, errLimit := strconv.Atoi(c.DefaultQuery("limit", "0"))
+
+	if validateIPAddress(hostIP) != nil || errLimit != nil || limit < 0 {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+
+		SetErrorToContext(c, common.ErrGetRegisteredHostInvalidRequest.Error(), nil)
+		return
+	}
+
+	hostModel := mgmtmodel.Host{IP: hostIP}
+
+	health, err := hostModel.GetHealth(ctx, limit)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":   traceID,
+			"HostModel": hostModel,
+			"error":     err.Error(),
+		}).Error("Failed to get the health of the host.")
+
+		definedErr := common.ErrGetRegisteredHost
+		hostModelStr, _ := json.Marshal(hostModel)
+		definedErr.Params = []string{
+			string(hostModelStr),
+			err.Error(),
+		}
+		SetErrorToContext(c, "", definedErr)
+		return
+	}
+
+	hostHealthResponse := HostHealthResponse{}
+	common.DeepCopy(health, &hostHealthResponse)
+
+	c.JSON(http.StatusOK, hostHealthResponse)
+}
+
+// GetHostCapacityHandler sums up the usage and the quotas of the directories on the host. The stale usage is
+// collected again, the saved one is summed up if the collection fails.
+func GetHostCapacityHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	hostIP := c.Param("ip")
+	if validateIPAddress(hostIP) != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
+		return
+	}
+
+	hostModel := mgmtmodel.Host{IP: hostIP}
+
+	capacity, err := hostModel.GetCapacity(ctx)
+	if capacity == nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The host is not found", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the capacity of the host", err.Error())
+		}
+		return
+	}
+
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Warning("Failed to collect the usage of the directories.")
+	}
+
+	hostCapacityResponse := HostCapacityResponse{}
+	common.DeepCopy(capacity, &hostCapacityResponse)
+
+	c.JSON(http.StatusOK, hostCapacityResponse)
+}
+
 func GetSystemInfoOnAgentHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -0,0 +1,58 @@
+package webservice
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cryingmouse/data_management_engine/identity"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+)
+
+type IdentityResponse struct {
+	Name          string `json:"name"`
+	Domain        string `json:"domain,omitempty"`
+	QualifiedName string `json:"qualified_name"`
+	Type          string `json:"type"`
+	DisplayName   string `json:"display_name,omitempty"`
+	ID            string `json:"id,omitempty"`
+	DN            string `json:"dn"`
+}
+
+func toIdentityResponse(found identity.Identity) IdentityResponse {
+	return IdentityResponse{
+		Name:          found.Name,
+		Domain:        found.Domain,
+		QualifiedName: found.QualifiedName(),
+		Type:          found.Type,
+		DisplayName:   found.DisplayName,
+		ID:            found.ID,
+		DN:            found.DN,
+	}
+}
+
+// GetIdentitiesHandler searches the domain users and groups of the directory service by the query q, so that they
+// can be chosen for the access of the shares by their qualified names.
+func GetIdentitiesHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	query := c.Query("q")
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	identities, err := mgmtmodel.SearchIdentities(ctx, query, limit)
+	if errors.Is(err, identity.ErrNotConfigured) {
+		ErrorResponse(c, http.StatusBadRequest, "No directory service is configured", err.Error())
+		return
+	} else if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to search the identities", err.Error())
+		return
+	}
+
+	identityList := make([]IdentityResponse, len(identities))
+	for i, found := range identities {
+		identityList[i] = toIdentityResponse(found)
+	}
+
+	c.JSON(http.StatusOK, identityList)
+}
@@ -0,0 +1,236 @@
+package webservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	JobTypeRegisterHosts      = "hosts.batch-register"
+	JobTypeUnregisterHosts    = "hosts.batch-unregister"
+	JobTypeCreateDirectories  = "directories.batch-create"
+	JobTypeDeleteDirectories  = "directories.batch-delete"
+	JobTypeCreateLocalUsers   = "users.batch-create"
+	JobTypeDeleteLocalUsers   = "users.batch-delete"
+	JobTypeManageLocalUsers   = "users.batch-manage"
+	JobTypeUnmanageLocalUsers = "users.batch-unmanage"
+	JobTypeReconcileHost      = "hosts.reconcile"
+)
+
+type JobItemResponse struct {
+	Index  int             `json:"index"`
+	Name   string          `json:"name"`
+	State  string          `json:"state"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type JobResponse struct {
+	ID             uint              `json:"id"`
+	Type           string            `json:"type"`
+	State          string            `json:"state"`
+	TotalCount     int               `json:"total_count"`
+	SucceededCount int               `json:"succeeded_count"`
+	FailedCount    int               `json:"failed_count"`
+	CancelledCount int               `json:"cancelled_count"`
+	CreatedAt      time.Time         `json:"created_at"`
+	StartedAt      *time.Time        `json:"started_at,omitempty"`
+	FinishedAt     *time.Time        `json:"finished_at,omitempty"`
+	Items          []JobItemResponse `json:"items,omitempty"`
+}
+
+type PaginationJobResponse struct {
+	Jobs       []JobResponse `json:"jobs"`
+	Page       int           `json:"page"`
+	Limit      int           `json:"limit"`
+	TotalCount int64         `json:"total_count"`
+}
+
+func newJobResponse(job mgmtmodel.Job) JobResponse {
+	jobResponse := JobResponse{
+		ID:             job.ID,
+		Type:           job.Type,
+		State:          job.State,
+		TotalCount:     job.TotalCount,
+		SucceededCount: job.SucceededCount,
+		FailedCount:    job.FailedCount,
+		CancelledCount: job.CancelledCount,
+		CreatedAt:      job.CreatedAt,
+		StartedAt:      job.StartedAt,
+		FinishedAt:     job.FinishedAt,
+	}
+
+	for _, item := range job.Items {
+		itemResponse := JobItemResponse{
+			Index: item.ItemIndex,
+			Name:  item.Name,
+			State: item.State,
+			Error: item.Error,
+		}
+		if item.Result != "" {
+			itemResponse.Result = json.RawMessage(item.Result)
+		}
+
+		jobResponse.Items = append(jobResponse.Items, itemResponse)
+	}
+
+	return jobResponse
+}
+
+// isAsyncRequest reports whether the batch operation is requested to run as a job, i.e. with the query '?async=true'.
+func isAsyncRequest(c *gin.Context) bool {
+	async, _ := strconv.ParseBool(c.Query("async"))
+
+	return async
+}
+
+// submitJob runs the batch operation as a job, and responds the job with status 202 without waiting for it.
+func submitJob(c *gin.Context, ctx context.Context, jobType string, names []string, task mgmtmodel.JobTask) {
+	job, err := mgmtmodel.SubmitJob(ctx, jobType, names, task)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": GetTraceIDFromContext(ctx),
+			"JobType": jobType,
+			"error":   err.Error(),
+		}).Error("Failed to submit the job.")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to submit the job", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, newJobResponse(*job))
+}
+
+func getJobID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+
+	return uint(id), err
+}
+
+func GetJobHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	id, err := getJobID(c)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	jobModel := mgmtmodel.Job{ID: id}
+	job, err := jobModel.Get(ctx)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The job is not found", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the job", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(*job))
+}
+
+func GetJobsHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	jobType := c.Query("type")
+	state := c.Query("state")
+	fields := c.Query("fields")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	jobListModel := mgmtmodel.JobList{}
+	filter := common.QueryFilter{
+		Fields: common.SplitToList(fields),
+		Conditions: struct {
+			Type  string
+			State string
+		}{
+			Type:  jobType,
+			State: state,
+		},
+	}
+
+	if page == 0 && limit == 0 {
+		// Query jobs without pagination.
+		jobs, err := jobListModel.Get(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the jobs", err.Error())
+			return
+		}
+
+		jobList := make([]JobResponse, len(jobs))
+		for i, job := range jobs {
+			jobList[i] = newJobResponse(job)
+		}
+
+		c.JSON(http.StatusOK, jobList)
+	} else {
+		// Query jobs with pagination.
+		filter.Pagination = &common.Pagination{
+			Page:     page,
+			PageSize: limit,
+		}
+
+		paginationJobs, err := jobListModel.Pagination(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the jobs", err.Error())
+			return
+		}
+
+		paginationJobList := PaginationJobResponse{
+			Jobs:       make([]JobResponse, len(paginationJobs.Jobs)),
+			Page:       page,
+			Limit:      limit,
+			TotalCount: paginationJobs.TotalCount,
+		}
+		for i, job := range paginationJobs.Jobs {
+			paginationJobList.Jobs[i] = newJobResponse(job)
+		}
+
+		c.JSON(http.StatusOK, paginationJobList)
+	}
+}
+
+func CancelJobHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	id, err := getJobID(c)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	jobModel := mgmtmodel.Job{ID: id}
+	job, err := jobModel.Cancel(ctx)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			ErrorResponse(c, http.StatusNotFound, "The job is not found", err.Error())
+		case errors.Is(err, mgmtmodel.ErrJobFinished):
+			ErrorResponse(c, http.StatusConflict, "Failed to cancel the job", err.Error())
+		default:
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to cancel the job", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newJobResponse(*job))
+}
@@ -0,0 +1,425 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cryingmouse/data_management_engine/agent"
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type LocalGroupResponse struct {
+	HostIP      string   `json:"host_ip,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	GID         string   `json:"id,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members"`
+	Stale       bool     `json:"stale,omitempty"`
+}
+
+type PaginationLocalGroupResponse struct {
+	LocalGroups []LocalGroupResponse `json:"groups"`
+	Page        int                  `json:"page"`
+	Limit       int                  `json:"limit"`
+	TotalCount  int64                `json:"total_count"`
+}
+
+type requestLocalGroup struct {
+	Name   string `json:"name" binding:"required"`
+	HostIP string `json:"host_ip" binding:"required,ip"`
+}
+
+type requestLocalGroupMembers struct {
+	Name    string   `json:"name" binding:"required"`
+	HostIP  string   `json:"host_ip" binding:"required,ip"`
+	Members []string `json:"members" binding:"required,min=1"`
+}
+
+func toLocalGroupResponse(localGroup mgmtmodel.LocalGroup) LocalGroupResponse {
+	response := LocalGroupResponse{
+		HostIP:      localGroup.HostIP,
+		Name:        localGroup.Name,
+		GID:         localGroup.GID,
+		Description: localGroup.Description,
+		Members:     localGroup.Members,
+		Stale:       localGroup.Stale,
+	}
+
+	if response.Members == nil {
+		response.Members = []string{}
+	}
+
+	return response
+}
+
+func CreateLocalGroupHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name        string   `json:"name" binding:"required"`
+		HostIP      string   `json:"host_ip" binding:"required,ip"`
+		Description string   `json:"description"`
+		Members     []string `json:"members"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	localGroupModel := mgmtmodel.LocalGroup{
+		HostIP:      request.HostIP,
+		Name:        request.Name,
+		Description: request.Description,
+		Members:     request.Members,
+	}
+
+	if err := localGroupModel.Create(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":    traceID,
+			"LocalGroup": request.HostIP + ":" + request.Name,
+			"error":      err.Error(),
+		}).Error("Failed to create the local group.")
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the local group", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, toLocalGroupResponse(localGroupModel))
+}
+
+func DeleteLocalGroupHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestLocalGroup
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	localGroupModel := mgmtmodel.LocalGroup{HostIP: request.HostIP, Name: request.Name}
+	if err := localGroupModel.Delete(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":    traceID,
+			"LocalGroup": request.HostIP + ":" + request.Name,
+			"error":      err.Error(),
+		}).Error("Failed to delete the local group.")
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to delete the local group", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// AddLocalGroupMembersHandler adds the local users to the group managed by the engine.
+func AddLocalGroupMembersHandler(c *gin.Context) {
+	changeLocalGroupMembers(c, "Failed to add the members to the local group", (*mgmtmodel.LocalGroup).AddMembers)
+}
+
+// RemoveLocalGroupMembersHandler removes the local users from the group managed by the engine.
+func RemoveLocalGroupMembersHandler(c *gin.Context) {
+	changeLocalGroupMembers(c, "Failed to remove the members from the local group", (*mgmtmodel.LocalGroup).RemoveMembers)
+}
+
+// changeLocalGroupMembers changes the members of the group by the change, and responds the group with its members.
+func changeLocalGroupMembers(c *gin.Context, message string, change func(g *mgmtmodel.LocalGroup, ctx context.Context, members []string) error) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestLocalGroupMembers
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	localGroupModel := mgmtmodel.LocalGroup{HostIP: request.HostIP, Name: request.Name}
+	if err := change(&localGroupModel, ctx, request.Members); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":    traceID,
+			"LocalGroup": request.HostIP + ":" + request.Name,
+			"error":      err.Error(),
+		}).Error(message + ".")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The local group is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), message, err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toLocalGroupResponse(localGroupModel))
+}
+
+func ManageLocalGroupHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestLocalGroup
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	localGroupModel := mgmtmodel.LocalGroup{HostIP: request.HostIP, Name: request.Name}
+	if err := localGroupModel.Manage(ctx); err != nil {
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to manage the local group", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, toLocalGroupResponse(localGroupModel))
+}
+
+func UnmanageLocalGroupHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestLocalGroup
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	localGroupModel := mgmtmodel.LocalGroup{HostIP: request.HostIP, Name: request.Name}
+	if err := localGroupModel.Unmanage(ctx); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to unmanage the local group", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetLocalGroupsHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	groupName := c.Query("name")
+	hostIP := c.Query("host_ip")
+	fields := c.Query("fields")
+	nameKeyword := c.Query("q")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	if hostIP != "" && validateIPAddress(hostIP) != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
+		return
+	}
+
+	if groupName == "" || hostIP == "" {
+		localGroupListModel := mgmtmodel.LocalGroupList{}
+		filter := common.QueryFilter{
+			Fields: common.SplitToList(fields),
+			Keyword: map[string]string{
+				"name": nameKeyword,
+			},
+			Conditions: struct {
+				HostIP string
+				Name   string
+			}{
+				HostIP: hostIP,
+				Name:   groupName,
+			},
+		}
+
+		if page == 0 && limit == 0 {
+			// Query local groups without pagination.
+			localGroups, err := localGroupListModel.Get(ctx, &filter)
+			if err != nil {
+				ErrorResponse(c, http.StatusInternalServerError, "Failed to get the local groups", err.Error())
+				return
+			}
+
+			localGroupList := make([]LocalGroupResponse, 0, len(localGroups))
+			for _, localGroup := range localGroups {
+				localGroupList = append(localGroupList, toLocalGroupResponse(localGroup))
+			}
+
+			c.JSON(http.StatusOK, localGroupList)
+		} else {
+			// Query local groups with pagination.
+			filter.Pagination = &common.Pagination{
+				Page:     page,
+				PageSize: limit,
+			}
+
+			paginationLocalGroups, err := localGroupListModel.Pagination(ctx, &filter)
+			if err != nil {
+				ErrorResponse(c, http.StatusInternalServerError, "Failed to get the local groups", err.Error())
+				return
+			}
+
+			paginationLocalGroupList := PaginationLocalGroupResponse{
+				Page:        page,
+				Limit:       limit,
+				TotalCount:  paginationLocalGroups.TotalCount,
+				LocalGroups: make([]LocalGroupResponse, 0, len(paginationLocalGroups.LocalGroups)),
+			}
+
+			for _, localGroup := range paginationLocalGroups.LocalGroups {
+				paginationLocalGroupList.LocalGroups = append(paginationLocalGroupList.LocalGroups, toLocalGroupResponse(localGroup))
+			}
+
+			c.JSON(http.StatusOK, paginationLocalGroupList)
+		}
+	} else {
+		localGroupModel := mgmtmodel.LocalGroup{
+			HostIP: hostIP,
+			Name:   groupName,
+		}
+
+		localGroup, err := localGroupModel.Get(ctx)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				ErrorResponse(c, http.StatusNotFound, "The local group is not found", err.Error())
+			} else {
+				ErrorResponse(c, http.StatusInternalServerError, "Failed to get the local group", err.Error())
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, []LocalGroupResponse{toLocalGroupResponse(*localGroup)})
+	}
+}
+
+func CreateLocalGroupOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.CreateLocalGroup(ctx, request.Name, request.Description); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the local group", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func DeleteLocalGroupOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.DeleteLocalGroup(ctx, request.Name); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the local group", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func AddLocalGroupMembersOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name    string   `json:"name" binding:"required"`
+		Members []string `json:"members" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.AddLocalGroupMembers(ctx, request.Name, request.Members); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to add the members to the local group", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func RemoveLocalGroupMembersOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name    string   `json:"name" binding:"required"`
+		Members []string `json:"members" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.RemoveLocalGroupMembers(ctx, request.Name, request.Members); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to remove the members from the local group", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// GetLocalGroupOnAgentHandler always responds a list, which has all the local groups on the host if no name is given.
+func GetLocalGroupOnAgentHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	names := common.SplitToList(c.Query("name"))
+
+	agent := agent.GetAgent()
+	localGroupsDetail, err := agent.GetLocalGroupsDetail(ctx, names)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the local groups detail", err.Error())
+		return
+	}
+
+	if localGroupsDetail == nil {
+		localGroupsDetail = []common.LocalGroupDetail{}
+	}
+
+	c.JSON(http.StatusOK, localGroupsDetail)
+}
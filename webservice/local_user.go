@@ -1,7 +1,9 @@
 package webservice
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/cryingmouse/data_management_engine/mgmtmodel"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type LocalUserResponse struct {
@@ -24,6 +27,7 @@ type LocalUserResponse struct {
 	IsPasswordExpired    bool   `json:"is_password_expired"`
 	IsPasswordChangeable bool   `json:"is_password_changeable"`
 	IsLockout            bool   `json:"is_lockout"`
+	Stale                bool   `json:"stale,omitempty"`
 }
 
 type PaginationLocalUserResponse struct {
@@ -44,6 +48,25 @@ type requestLocalUserWithPassword struct {
 	HostIP   string `json:"host_ip" binding:"required"`
 }
 
+// requestLocalUserUpdate changes the local user, the fields not given are not changed.
+type requestLocalUserUpdate struct {
+	Name     string `json:"name" binding:"required"`
+	HostIP   string `json:"host_ip" binding:"required,ip"`
+	Password string `json:"password" binding:"omitempty,validatePassword"`
+	Disabled *bool  `json:"disabled"`
+	Unlock   bool   `json:"unlock"`
+}
+
+// getLocalUserNames returns the names of the local users in the form of 'host_ip:name' to name the items of the job.
+func getLocalUserNames(localUserListModel mgmtmodel.LocalUserList) []string {
+	names := make([]string, len(localUserListModel.LocalUsers))
+	for i, localUser := range localUserListModel.LocalUsers {
+		names[i] = localUser.HostIP + ":" + localUser.Name
+	}
+
+	return names
+}
+
 func CreateLocalUserHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -112,6 +135,21 @@ func CreateLocalUsersHandler(c *gin.Context) {
 		"LocalUserList": common.MaskPassword(localUserListModel),
 	}).Debug("Copy request to LocalUserList model.")
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeCreateLocalUsers, getLocalUserNames(localUserListModel), func(ctx context.Context, index int) (interface{}, error) {
+			localUserModel := localUserListModel.LocalUsers[index]
+			if err := localUserModel.Create(ctx); err != nil {
+				return nil, err
+			}
+
+			localUserResponse := LocalUserResponse{}
+			common.DeepCopy(localUserModel, &localUserResponse)
+
+			return localUserResponse, nil
+		})
+		return
+	}
+
 	// Create the local users
 	if err := localUserListModel.Create(ctx); err != nil {
 		common.Logger.WithFields(log.Fields{
@@ -199,6 +237,15 @@ func DeleteLocalUsersHandler(c *gin.Context) {
 		"LocalUserList": localUserListModel,
 	}).Debug("Copy request to LocalUserList model.")
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeDeleteLocalUsers, getLocalUserNames(localUserListModel), func(ctx context.Context, index int) (interface{}, error) {
+			localUserModel := localUserListModel.LocalUsers[index]
+
+			return nil, localUserModel.Delete(ctx)
+		})
+		return
+	}
+
 	// Delete the local users
 	if err := localUserListModel.Delete(ctx, nil); err != nil {
 		common.Logger.WithFields(log.Fields{
@@ -218,6 +265,47 @@ func DeleteLocalUsersHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+func UpdateLocalUserHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestLocalUserUpdate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	update := common.LocalUserUpdate{Password: request.Password, Disabled: request.Disabled, Unlock: request.Unlock}
+	if update.IsEmpty() {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "nothing of the local user is changed")
+		return
+	}
+
+	localUserModel := mgmtmodel.LocalUser{Name: request.Name, HostIP: request.HostIP}
+	if err := localUserModel.Update(ctx, update); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":   traceID,
+			"LocalUser": request.HostIP + ":" + request.Name,
+			"error":     err.Error(),
+		}).Error("Failed to update the local user.")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The local user is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to update the local user", err.Error())
+		}
+		return
+	}
+
+	localUserResponse := LocalUserResponse{}
+	common.DeepCopy(localUserModel, &localUserResponse)
+
+	c.JSON(http.StatusOK, localUserResponse)
+}
+
 func GetlocalUsersHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -390,6 +478,21 @@ func ManageLocalUsersHandler(c *gin.Context) {
 	var localUserListModel mgmtmodel.LocalUserList
 	common.DeepCopy(request, &localUserListModel.LocalUsers)
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeManageLocalUsers, getLocalUserNames(localUserListModel), func(ctx context.Context, index int) (interface{}, error) {
+			localUserModel := localUserListModel.LocalUsers[index]
+			if err := localUserModel.Manage(ctx); err != nil {
+				return nil, err
+			}
+
+			localUserResponse := LocalUserResponse{}
+			common.DeepCopy(localUserModel, &localUserResponse)
+
+			return localUserResponse, nil
+		})
+		return
+	}
+
 	if err := localUserListModel.Manage(ctx); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the local users", err.Error())
 		return
@@ -441,6 +544,15 @@ func UnmanageLocalUsersHandler(c *gin.Context) {
 	var localUserListModel mgmtmodel.LocalUserList
 	common.DeepCopy(request, &localUserListModel.LocalUsers)
 
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeUnmanageLocalUsers, getLocalUserNames(localUserListModel), func(ctx context.Context, index int) (interface{}, error) {
+			localUserModel := localUserListModel.LocalUsers[index]
+
+			return nil, localUserModel.Unmanage(ctx)
+		})
+		return
+	}
+
 	if err := localUserListModel.Unmanage(ctx, nil); err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to unmanage the local users", err.Error())
 		return
@@ -505,20 +617,40 @@ func DeleteLocalUserOnAgentHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-func GetLocalUserOnAgentHandler(c *gin.Context) {
+// GetLocalUserOnAgentHandler lists all the local users on the host if no name is given.
+func UpdateLocalUserOnAgentHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
+	var request struct {
+		Name string `json:"name" binding:"required"`
+		common.LocalUserUpdate
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.UpdateLocalUser(ctx, request.Name, request.LocalUserUpdate); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update the local user", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetLocalUserOnAgentHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
 	name := c.Query("name")
 	names := common.SplitToList(name)
 
 	agent := agent.GetAgent()
-	if len(names) == 0 {
-		common.Logger.WithFields(log.Fields{
-			"TraceID": traceID,
-			"URL":     c.Request.URL,
-		}).Error("Invalid request.")
-		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
-	} else if len(names) == 1 {
+	if len(names) == 1 {
 		localUserDetail, err := agent.GetLocalUserDetail(ctx, name)
 		if err != nil {
 			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the local user detail", err.Error())
@@ -533,6 +665,10 @@ func GetLocalUserOnAgentHandler(c *gin.Context) {
 			return
 		}
 
+		if localUsersDetail == nil {
+			localUsersDetail = []common.LocalUserDetail{}
+		}
+
 		c.JSON(http.StatusOK, localUsersDetail)
 	}
 }
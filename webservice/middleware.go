@@ -56,9 +56,10 @@ func LoggingMiddleware() gin.HandlerFunc {
 		// Capture the response body
 		responseBody := writer.body.Bytes()
 
-		// Log the response information
+		// Log the response information, the caller is set into the context by AuthMiddleware.
 		common.AuditLogger.WithFields(log.Fields{
 			"TraceID":      traceID,
+			"User":         c.GetString("Username"),
 			"URL":          c.Request.URL.Path,
 			"Status":       c.Writer.Status(),
 			"ResponseBody": common.MaskPassword(string(responseBody)),
@@ -66,6 +67,7 @@ func LoggingMiddleware() gin.HandlerFunc {
 
 		common.Logger.WithFields(log.Fields{
 			"TraceID":      traceID,
+			"User":         c.GetString("Username"),
 			"URL":          c.Request.URL.Path,
 			"Status":       c.Writer.Status(),
 			"ResponseBody": common.MaskPassword(string(responseBody)),
@@ -155,7 +157,7 @@ func I18nMiddleware() gin.HandlerFunc {
 				if errorCode, exist := c.Get("ErrorCode"); exist {
 					response["error_code"] = errorCode
 				}
-				c.JSON(http.StatusInternalServerError, response)
+				c.JSON(GetErrorStatusCode(err.(error), http.StatusInternalServerError), response)
 				return
 			}
 		}
@@ -0,0 +1,176 @@
+package webservice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type DriftItemResponse struct {
+	ResourceType string `json:"resource_type"`
+	Name         string `json:"name"`
+	DriftType    string `json:"drift_type"`
+	Detail       string `json:"detail,omitempty"`
+	Action       string `json:"action,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type DriftReportResponse struct {
+	ID           uint                `json:"id"`
+	HostIP       string              `json:"host_ip"`
+	AutoImport   bool                `json:"auto_import"`
+	MarkStale    bool                `json:"mark_stale"`
+	MissingCount int                 `json:"missing_count"`
+	ExtraCount   int                 `json:"extra_count"`
+	ChangedCount int                 `json:"changed_count"`
+	CreatedAt    time.Time           `json:"created_at"`
+	Items        []DriftItemResponse `json:"items"`
+}
+
+type PaginationDriftReportResponse struct {
+	Reports    []DriftReportResponse `json:"reports"`
+	Page       int                   `json:"page"`
+	Limit      int                   `json:"limit"`
+	TotalCount int64                 `json:"total_count"`
+}
+
+func newDriftReportResponse(report mgmtmodel.DriftReport) DriftReportResponse {
+	reportResponse := DriftReportResponse{Items: []DriftItemResponse{}}
+	common.DeepCopy(report, &reportResponse)
+
+	return reportResponse
+}
+
+// ReconcileHostHandler compares the records of the host with its resources and responds the drift report.
+// The reconciliation runs as a job with the query '?async=true'.
+func ReconcileHostHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		AutoImport bool `json:"auto_import"`
+		MarkStale  bool `json:"mark_stale"`
+	}
+
+	hostIP := c.Param("ip")
+	// The options are optional, so the request may have no body.
+	err := c.ShouldBindJSON(&request)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err == nil {
+		err = validateIPAddress(hostIP)
+	}
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	hostModel := mgmtmodel.Host{IP: hostIP}
+	options := mgmtmodel.ReconcileOptions{
+		AutoImport: request.AutoImport,
+		MarkStale:  request.MarkStale,
+	}
+
+	if isAsyncRequest(c) {
+		submitJob(c, ctx, JobTypeReconcileHost, []string{hostIP}, func(ctx context.Context, index int) (interface{}, error) {
+			report, err := hostModel.Reconcile(ctx, options)
+			if err != nil {
+				return nil, err
+			}
+
+			return newDriftReportResponse(*report), nil
+		})
+		return
+	}
+
+	report, err := hostModel.Reconcile(ctx, options)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"HostIP":  hostIP,
+			"error":   err.Error(),
+		}).Error("Failed to reconcile the host.")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The host is not registered", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to reconcile the host", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newDriftReportResponse(*report))
+}
+
+func GetDriftReportsHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	hostIP := c.Query("host_ip")
+	fields := c.Query("fields")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	reportListModel := mgmtmodel.DriftReportList{}
+	filter := common.QueryFilter{
+		Fields: common.SplitToList(fields),
+		Conditions: struct {
+			HostIP string
+		}{
+			HostIP: hostIP,
+		},
+	}
+
+	if page == 0 && limit == 0 {
+		// Query drift reports without pagination.
+		reports, err := reportListModel.Get(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the drift reports", err.Error())
+			return
+		}
+
+		reportList := make([]DriftReportResponse, len(reports))
+		for i, report := range reports {
+			reportList[i] = newDriftReportResponse(report)
+		}
+
+		c.JSON(http.StatusOK, reportList)
+	} else {
+		// Query drift reports with pagination.
+		filter.Pagination = &common.Pagination{
+			Page:     page,
+			PageSize: limit,
+		}
+
+		paginationReports, err := reportListModel.Pagination(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the drift reports", err.Error())
+			return
+		}
+
+		paginationReportList := PaginationDriftReportResponse{
+			Reports:    make([]DriftReportResponse, len(paginationReports.Reports)),
+			Page:       page,
+			Limit:      limit,
+			TotalCount: paginationReports.TotalCount,
+		}
+		for i, report := range paginationReports.Reports {
+			paginationReportList.Reports[i] = newDriftReportResponse(report)
+		}
+
+		c.JSON(http.StatusOK, paginationReportList)
+	}
+}
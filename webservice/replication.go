@@ -0,0 +1,478 @@
+package webservice
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/agent"
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// The replication token is valid until it is not used for the time, a transfer may take much longer.
+const defaultReplicationTokenTimeout = time.Hour
+
+// The key of the directory which the replication token is issued for in the gin context.
+const replicationDirectoryKey = "ReplicationDirectory"
+
+type replicationToken struct {
+	directoryName string
+	expiresAt     time.Time
+}
+
+// replicationTokenStore keeps the tokens issued by the source agent for the destination agents to read the
+// directories replicated.
+type replicationTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]replicationToken
+}
+
+var replicationTokens = replicationTokenStore{tokens: make(map[string]replicationToken)}
+
+// issue returns a new token to read the directory, the expired ones are dropped meanwhile.
+func (s *replicationTokenStore) issue(directoryName string) (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(data)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for issued, replication := range s.tokens {
+		if now.After(replication.expiresAt) {
+			delete(s.tokens, issued)
+		}
+	}
+	s.tokens[token] = replicationToken{directoryName: directoryName, expiresAt: now.Add(defaultReplicationTokenTimeout)}
+
+	return token, nil
+}
+
+// validate returns the directory which the token is issued for, the expiration time of the valid token is extended.
+func (s *replicationTokenStore) validate(token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replication, exist := s.tokens[token]
+	if !exist {
+		return "", false
+	}
+
+	now := time.Now()
+	if now.After(replication.expiresAt) {
+		delete(s.tokens, token)
+		return "", false
+	}
+	replication.expiresAt = now.Add(defaultReplicationTokenTimeout)
+	s.tokens[token] = replication
+
+	return replication.directoryName, true
+}
+
+// ReplicationAuthMiddleware authenticates the destination agent by the replication token in the header
+// X-Replication-Token, the directory which the token is issued for is the only one it can read.
+func ReplicationAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		directoryName, ok := replicationTokens.validate(c.GetHeader(common.ReplicationTokenHeader))
+		if !ok {
+			common.Logger.WithFields(log.Fields{
+				"TraceID": c.Request.Header.Get("X-Trace-ID"),
+				"IP":      c.ClientIP(),
+				"URL":     c.Request.URL,
+			}).Warn("Unauthorized replication request.")
+			ErrorResponse(c, http.StatusUnauthorized, "Unauthorized", "invalid or expired replication token")
+			c.Abort()
+			return
+		}
+
+		c.Set(replicationDirectoryKey, directoryName)
+
+		c.Next()
+	}
+}
+
+type ReplicationResponse struct {
+	SourceHostIP             string                   `json:"source_host_ip"`
+	SourceDirectoryName      string                   `json:"source_directory_name"`
+	DestinationHostIP        string                   `json:"destination_host_ip"`
+	DestinationDirectoryName string                   `json:"destination_directory_name"`
+	Frequency                string                   `json:"frequency"`
+	Running                  bool                     `json:"running"`
+	LagSeconds               *int64                   `json:"lag_seconds"`
+	LastRunTime              *time.Time               `json:"last_run_time"`
+	LastSuccessTime          *time.Time               `json:"last_success_time"`
+	LastResult               string                   `json:"last_result"`
+	LastError                string                   `json:"last_error"`
+	LastDurationMilliseconds int64                    `json:"last_duration_ms"`
+	LastTransfer             common.ReplicationResult `json:"last_transfer"`
+}
+
+type PaginationReplicationResponse struct {
+	Replications []ReplicationResponse `json:"replications"`
+	Page         int                   `json:"page"`
+	Limit        int                   `json:"limit"`
+	TotalCount   int64                 `json:"total_count"`
+}
+
+type requestReplicationDestination struct {
+	DestinationHostIP        string `json:"destination_host_ip" binding:"required,ip"`
+	DestinationDirectoryName string `json:"destination_directory_name" binding:"required"`
+}
+
+func toReplicationResponse(replication mgmtmodel.Replication, now time.Time) ReplicationResponse {
+	response := ReplicationResponse{
+		SourceHostIP:             replication.SourceHostIP,
+		SourceDirectoryName:      replication.SourceDirectoryName,
+		DestinationHostIP:        replication.DestinationHostIP,
+		DestinationDirectoryName: replication.DestinationDirectoryName,
+		Frequency:                replication.Frequency,
+		Running:                  replication.Running,
+		LastRunTime:              replication.LastRunTime,
+		LastSuccessTime:          replication.LastSuccessTime,
+		LastResult:               replication.LastResult,
+		LastError:                replication.LastError,
+		LastDurationMilliseconds: replication.LastDuration.Milliseconds(),
+		LastTransfer:             replication.LastTransfer,
+	}
+
+	if lag := replication.Lag(now); lag != nil {
+		seconds := int64(lag.Seconds())
+		response.LagSeconds = &seconds
+	}
+
+	return response
+}
+
+// replicationErrorStatusCode returns 404 if the replication or the directory is not found, and 409 if the replication
+// conflicts with another one or the transfer being run.
+func replicationErrorStatusCode(err error) int {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, mgmtmodel.ErrReplicationExists) || errors.Is(err, mgmtmodel.ErrReplicationLoop) || errors.Is(err, mgmtmodel.ErrReplicationRunning) {
+		return http.StatusConflict
+	}
+
+	return GetErrorStatusCode(err, http.StatusInternalServerError)
+}
+
+// CreateReplicationHandler creates the replication from the source directory to the destination directory on another
+// host. The replication is transferred at the frequency, e.g. hourly, or on request only if the frequency is empty.
+func CreateReplicationHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		SourceHostIP             string `json:"source_host_ip" binding:"required,ip"`
+		SourceDirectoryName      string `json:"source_directory_name" binding:"required"`
+		DestinationHostIP        string `json:"destination_host_ip" binding:"required,ip"`
+		DestinationDirectoryName string `json:"destination_directory_name" binding:"required"`
+		Frequency                string `json:"frequency"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if _, ok := common.SnapshotFrequencyInterval(request.Frequency); request.Frequency != "" && !ok {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "invalid frequency of the replication: "+request.Frequency)
+		return
+	}
+
+	if request.SourceHostIP == request.DestinationHostIP && request.SourceDirectoryName == request.DestinationDirectoryName {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "the source and the destination of the replication are the same directory")
+		return
+	}
+
+	replicationModel := mgmtmodel.Replication{
+		SourceHostIP:             request.SourceHostIP,
+		SourceDirectoryName:      request.SourceDirectoryName,
+		DestinationHostIP:        request.DestinationHostIP,
+		DestinationDirectoryName: request.DestinationDirectoryName,
+		Frequency:                request.Frequency,
+	}
+
+	if err := replicationModel.Create(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":     traceID,
+			"Source":      request.SourceHostIP + ":" + request.SourceDirectoryName,
+			"Destination": request.DestinationHostIP + ":" + request.DestinationDirectoryName,
+			"error":       err.Error(),
+		}).Error("Failed to create the replication.")
+		ErrorResponse(c, replicationErrorStatusCode(err), "Failed to create the replication", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, toReplicationResponse(replicationModel, time.Now()))
+}
+
+// DeleteReplicationHandler deletes the replication to the destination directory, the files replicated are kept.
+func DeleteReplicationHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestReplicationDestination
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	replicationModel := mgmtmodel.Replication{
+		DestinationHostIP:        request.DestinationHostIP,
+		DestinationDirectoryName: request.DestinationDirectoryName,
+	}
+	if err := replicationModel.Delete(ctx); err != nil {
+		ErrorResponse(c, replicationErrorStatusCode(err), "Failed to delete the replication", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// RunReplicationHandler starts to transfer the replication in the background, the result is shown by
+// GET /api/replications once the transfer is finished.
+func RunReplicationHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestReplicationDestination
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	replicationModel := mgmtmodel.Replication{
+		DestinationHostIP:        request.DestinationHostIP,
+		DestinationDirectoryName: request.DestinationDirectoryName,
+	}
+	if err := replicationModel.Start(ctx); err != nil {
+		ErrorResponse(c, replicationErrorStatusCode(err), "Failed to start the replication", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusAccepted, toReplicationResponse(replicationModel, time.Now()))
+}
+
+// UpdateReplicationHandler changes the frequency of the replication, the empty frequency means it is transferred on
+// request only.
+func UpdateReplicationHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		requestReplicationDestination
+		Frequency *string `json:"frequency" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if _, ok := common.SnapshotFrequencyInterval(*request.Frequency); *request.Frequency != "" && !ok {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "invalid frequency of the replication: "+*request.Frequency)
+		return
+	}
+
+	replicationModel := mgmtmodel.Replication{
+		DestinationHostIP:        request.DestinationHostIP,
+		DestinationDirectoryName: request.DestinationDirectoryName,
+	}
+	if err := replicationModel.Update(ctx, *request.Frequency); err != nil {
+		ErrorResponse(c, replicationErrorStatusCode(err), "Failed to update the replication", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, toReplicationResponse(replicationModel, time.Now()))
+}
+
+// GetReplicationsHandler lists the replications with how long the destinations lag behind and the result of the last
+// transfers.
+func GetReplicationsHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	sourceHostIP := c.Query("source_host_ip")
+	destinationHostIP := c.Query("destination_host_ip")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	replicationListModel := mgmtmodel.ReplicationList{}
+	filter := common.QueryFilter{
+		Conditions: struct {
+			SourceHostIP      string
+			DestinationHostIP string
+		}{
+			SourceHostIP:      sourceHostIP,
+			DestinationHostIP: destinationHostIP,
+		},
+	}
+
+	now := time.Now()
+
+	if page == 0 && limit == 0 {
+		// Query replications without pagination.
+		replications, err := replicationListModel.Get(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the replications", err.Error())
+			return
+		}
+
+		replicationList := make([]ReplicationResponse, 0, len(replications))
+		for _, replication := range replications {
+			replicationList = append(replicationList, toReplicationResponse(replication, now))
+		}
+
+		c.JSON(http.StatusOK, replicationList)
+	} else {
+		// Query replications with pagination.
+		filter.Pagination = &common.Pagination{
+			Page:     page,
+			PageSize: limit,
+		}
+
+		paginationReplications, err := replicationListModel.Pagination(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the replications", err.Error())
+			return
+		}
+
+		paginationReplicationList := PaginationReplicationResponse{
+			Page:         page,
+			Limit:        limit,
+			TotalCount:   paginationReplications.TotalCount,
+			Replications: make([]ReplicationResponse, 0, len(paginationReplications.Replications)),
+		}
+
+		for _, replication := range paginationReplications.Replications {
+			paginationReplicationList.Replications = append(paginationReplicationList.Replications, toReplicationResponse(replication, now))
+		}
+
+		c.JSON(http.StatusOK, paginationReplicationList)
+	}
+}
+
+// CreateReplicationTokenOnAgentHandler issues the token which the destination agent reads the directory with.
+func CreateReplicationTokenOnAgentHandler(c *gin.Context) {
+	_, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string `json:"directory_name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	token, err := replicationTokens.issue(request.DirectoryName)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the replication token", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// PullReplicationOnAgentHandler makes the directory the same as the directory of the source agent, it responds once
+// the transfer is finished.
+func PullReplicationOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string                   `json:"directory_name" binding:"required"`
+		Source        common.ReplicationSource `json:"source"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	result, err := agent.PullReplication(ctx, request.DirectoryName, request.Source)
+	if err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":   traceID,
+			"Directory": request.DirectoryName,
+			"Source":    request.Source.Address,
+			"error":     err.Error(),
+		}).Error("Failed to pull the replication.")
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to pull the replication", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetReplicationManifestHandler responds the entries of the directory which the replication token is issued for.
+func GetReplicationManifestHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	agent := agent.GetAgent()
+	manifest, err := agent.GetReplicationManifest(ctx, c.GetString(replicationDirectoryKey))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the replication manifest", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, manifest)
+}
+
+// GetReplicationChunkHandler responds the chunk of the file in the directory which the replication token is issued
+// for, the checksum of the chunk is responded in the header X-Chunk-SHA256.
+func GetReplicationChunkHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "invalid offset of the chunk")
+		return
+	}
+
+	length, err := strconv.ParseInt(c.Query("length"), 10, 64)
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "invalid length of the chunk")
+		return
+	}
+
+	agent := agent.GetAgent()
+	chunk, err := agent.ReadReplicationChunk(ctx, c.GetString(replicationDirectoryKey), c.Query("path"), offset, length)
+	if err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Failed to read the replication chunk", err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(chunk)
+	c.Header(common.ReplicationChunkHeader, hex.EncodeToString(sum[:]))
+	c.Data(http.StatusOK, "application/octet-stream", chunk)
+}
@@ -1,6 +1,7 @@
 package webservice
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -9,15 +10,17 @@ import (
 	"github.com/cryingmouse/data_management_engine/mgmtmodel"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type CIFSShareResponse struct {
-	HostIP          string   `json:"host_ip,omitempty"`
-	Name            string   `json:"share_name,omitempty"`
-	Path            string   `json:"share_path,omitempty"`
-	DirectoryName   string   `json:"directory_name,omitempty"`
-	Description     string   `json:"description,omitempty"`
-	AccessUserNames []string `json:"access_users,omitempty"`
+	HostIP        string               `json:"host_ip,omitempty"`
+	Name          string               `json:"share_name,omitempty"`
+	Path          string               `json:"share_path,omitempty"`
+	DirectoryName string               `json:"directory_name,omitempty"`
+	Description   string               `json:"description,omitempty"`
+	Access        []common.ShareAccess `json:"access,omitempty"`
+	Stale         bool                 `json:"stale,omitempty"`
 }
 
 type PaginationShareResponse struct {
@@ -31,11 +34,13 @@ func CreateShareHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
 	var request struct {
-		HostIP          string   `json:"host_ip" binding:"required"`
-		Name            string   `json:"share_name" binding:"required"`
-		DirectoryName   string   `json:"directory_name" binding:"required"`
-		Description     string   `json:"description" binding:"required"`
-		AccessUserNames []string `json:"access_users" binding:"required"`
+		HostIP        string               `json:"host_ip" binding:"required"`
+		Name          string               `json:"share_name" binding:"required"`
+		DirectoryName string               `json:"directory_name" binding:"required"`
+		Description   string               `json:"description" binding:"required"`
+		Access        []common.ShareAccess `json:"access"`
+		// The users given the full access, it is kept for the clients of the older versions.
+		AccessUserNames []string `json:"access_users"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		common.Logger.WithFields(log.Fields{
@@ -46,11 +51,149 @@ func CreateShareHandler(c *gin.Context) {
 		return
 	}
 
+	access := append(request.Access, toFullShareAccess(request.AccessUserNames)...)
+	if err := common.ValidateShareAccess(access); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
 	shareModel := mgmtmodel.CIFSShare{}
 	common.DeepCopy(request, &shareModel)
+	shareModel.Access = access
 
 	if err := shareModel.Create(ctx); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the share", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the share", err.Error())
+		return
+	}
+
+	shareResponse := CIFSShareResponse{}
+	common.DeepCopy(shareModel, &shareResponse)
+
+	c.JSON(http.StatusOK, shareResponse)
+}
+
+// toFullShareAccess gives the full access to the users, as the shares were created by the older versions.
+func toFullShareAccess(userNames []string) []common.ShareAccess {
+	access := make([]common.ShareAccess, len(userNames))
+	for i, userName := range userNames {
+		access[i] = common.ShareAccess{UserName: userName, Permission: common.SharePermissionFull}
+	}
+
+	return access
+}
+
+// UpdateShareHandler changes the fields of the share given in the request, the others are not changed.
+func UpdateShareHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		HostIP string `json:"host_ip" binding:"required,ip"`
+		Name   string `json:"share_name" binding:"required"`
+		common.ShareUpdate
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if request.ShareUpdate.IsEmpty() {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "nothing of the share is changed")
+		return
+	}
+
+	shareModel := mgmtmodel.CIFSShare{Name: request.Name, HostIP: request.HostIP}
+	if err := shareModel.Update(ctx, request.ShareUpdate); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The share is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to update the share", err.Error())
+		}
+		return
+	}
+
+	shareResponse := CIFSShareResponse{}
+	common.DeepCopy(shareModel, &shareResponse)
+
+	c.JSON(http.StatusOK, shareResponse)
+}
+
+// GrantShareAccessHandler gives the access levels to the users and the groups on the existing share.
+func GrantShareAccessHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		HostIP string               `json:"host_ip" binding:"required,ip"`
+		Name   string               `json:"share_name" binding:"required"`
+		Access []common.ShareAccess `json:"access" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := common.ValidateShareAccess(request.Access); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	shareModel := mgmtmodel.CIFSShare{Name: request.Name, HostIP: request.HostIP}
+	if err := shareModel.GrantAccess(ctx, request.Access); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The share is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to grant the access to the share", err.Error())
+		}
+		return
+	}
+
+	shareResponse := CIFSShareResponse{}
+	common.DeepCopy(shareModel, &shareResponse)
+
+	c.JSON(http.StatusOK, shareResponse)
+}
+
+// RevokeShareAccessHandler removes the access levels of the users and the groups on the existing share.
+func RevokeShareAccessHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		HostIP     string   `json:"host_ip" binding:"required,ip"`
+		Name       string   `json:"share_name" binding:"required"`
+		UserNames  []string `json:"usernames" binding:"required_without=GroupNames"`
+		GroupNames []string `json:"groupnames" binding:"required_without=UserNames"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	shareModel := mgmtmodel.CIFSShare{Name: request.Name, HostIP: request.HostIP}
+	if err := shareModel.RevokeAccess(ctx, request.UserNames, request.GroupNames); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The share is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to revoke the access to the share", err.Error())
+		}
 		return
 	}
 
@@ -80,7 +223,7 @@ func DeleteShareHandler(c *gin.Context) {
 	common.DeepCopy(request, &shareModel)
 
 	if err := shareModel.Delete(ctx); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the share", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the share", err.Error())
 		return
 	}
 
@@ -110,7 +253,7 @@ func MountCIFSShareHandler(c *gin.Context) {
 	common.DeepCopy(request, &shareModel)
 
 	if err := shareModel.Mount(ctx, request.UserName, request.Password); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to mount the share", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to mount the share", err.Error())
 		return
 	}
 
@@ -137,7 +280,7 @@ func UnmountShareHandler(c *gin.Context) {
 	common.DeepCopy(request, &shareModel)
 
 	if err := shareModel.Unmount(ctx); err != nil {
-		ErrorResponse(c, http.StatusInternalServerError, "Failed to unmount the share", err.Error())
+		ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to unmount the share", err.Error())
 		return
 	}
 
@@ -239,10 +382,12 @@ func CreateShareOnAgentHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
 	var request struct {
-		ShareName     string   `json:"share_name" binding:"required"`
-		DirectoryName string   `json:"directory_name" binding:"required"`
-		Description   string   `json:"description" binding:"required"`
-		UserNames     []string `json:"usernames" binding:"required"`
+		ShareName     string               `json:"share_name" binding:"required"`
+		DirectoryName string               `json:"directory_name" binding:"required"`
+		Description   string               `json:"description" binding:"required"`
+		Access        []common.ShareAccess `json:"access"`
+		// The users given the full access by the engines of the older versions.
+		UserNames []string `json:"usernames"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
 		common.Logger.WithFields(log.Fields{
@@ -255,7 +400,8 @@ func CreateShareOnAgentHandler(c *gin.Context) {
 
 	agent := agent.GetAgent()
 
-	err := agent.CreateCIFSShare(ctx, request.ShareName, request.DirectoryName, request.Description, request.UserNames)
+	access := append(request.Access, toFullShareAccess(request.UserNames)...)
+	err := agent.CreateCIFSShare(ctx, request.ShareName, request.DirectoryName, request.Description, access)
 	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the share", err.Error())
 		return
@@ -264,6 +410,58 @@ func CreateShareOnAgentHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+func GrantShareAccessOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		ShareName string               `json:"share_name" binding:"required"`
+		Access    []common.ShareAccess `json:"access" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.GrantCIFSShareAccess(ctx, request.ShareName, request.Access); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to grant the access to the share", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func RevokeShareAccessOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	// The groups are not given by the engines of the older versions.
+	var request struct {
+		ShareName  string   `json:"share_name" binding:"required"`
+		UserNames  []string `json:"usernames"`
+		GroupNames []string `json:"groupnames"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.RevokeCIFSShareAccess(ctx, request.ShareName, request.UserNames, request.GroupNames); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke the access to the share", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func DeleteShareOnAgentHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -288,6 +486,31 @@ func DeleteShareOnAgentHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+func UpdateShareOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		ShareName string `json:"share_name" binding:"required"`
+		common.ShareUpdate
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.UpdateCIFSShare(ctx, request.ShareName, request.ShareUpdate); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to update the share", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func MountShareOnAgentHandler(c *gin.Context) {
 	ctx, traceID := SetTraceIDToContext(c)
 
@@ -308,9 +531,7 @@ func MountShareOnAgentHandler(c *gin.Context) {
 
 	agent := agent.GetAgent()
 
-	plaintext, _ := common.Decrypt(request.Password, common.SecurityKey)
-
-	err := agent.MountCIFSShare(ctx, request.MountPoint, request.SharePath, request.UserName, plaintext)
+	err := agent.MountCIFSShare(ctx, request.MountPoint, request.SharePath, request.UserName, request.Password)
 	if err != nil {
 		ErrorResponse(c, http.StatusInternalServerError, "Failed to mount the share", err.Error())
 		return
@@ -343,20 +564,15 @@ func UnmountShareOnAgentHandler(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
+// GetShareOnAgentHandler responds all the shares on the host in a list if no name is given.
 func GetShareOnAgentHandler(c *gin.Context) {
-	ctx, traceID := SetTraceIDToContext(c)
+	ctx, _ := SetTraceIDToContext(c)
 
 	name := c.Query("name")
 	names := common.SplitToList(name)
 
 	agent := agent.GetAgent()
-	if len(names) == 0 {
-		common.Logger.WithFields(log.Fields{
-			"TraceID": traceID,
-			"URL":     c.Request.URL,
-		}).Error("Invalid request.")
-		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
-	} else if len(names) == 1 {
+	if len(names) == 1 {
 		ShareDetail, err := agent.GetCIFSShareDetail(ctx, name)
 		if err != nil {
 			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the share detail", err.Error())
@@ -371,6 +587,10 @@ func GetShareOnAgentHandler(c *gin.Context) {
 			return
 		}
 
+		if SharesDetail == nil {
+			SharesDetail = []common.ShareDetail{}
+		}
+
 		c.JSON(http.StatusOK, SharesDetail)
 	}
 }
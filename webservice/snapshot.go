@@ -0,0 +1,332 @@
+package webservice
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/agent"
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type SnapshotResponse struct {
+	HostIP        string    `json:"host_ip"`
+	DirectoryName string    `json:"directory_name"`
+	Name          string    `json:"name"`
+	Method        string    `json:"method"`
+	CreationTime  time.Time `json:"creation_time"`
+	PolicyName    string    `json:"policy_name,omitempty"`
+}
+
+type PaginationSnapshotResponse struct {
+	Snapshots  []SnapshotResponse `json:"snapshots"`
+	Page       int                `json:"page"`
+	Limit      int                `json:"limit"`
+	TotalCount int64              `json:"total_count"`
+}
+
+type requestSnapshot struct {
+	HostIP        string `json:"host_ip" binding:"required,ip"`
+	DirectoryName string `json:"directory_name" binding:"required"`
+	Name          string `json:"name" binding:"required"`
+}
+
+func toSnapshotResponse(snapshot mgmtmodel.Snapshot) SnapshotResponse {
+	return SnapshotResponse{
+		HostIP:        snapshot.HostIP,
+		DirectoryName: snapshot.DirectoryName,
+		Name:          snapshot.Name,
+		Method:        snapshot.Method,
+		CreationTime:  snapshot.CreationTime,
+		PolicyName:    snapshot.PolicyName,
+	}
+}
+
+// CreateSnapshotHandler takes the snapshot of the managed directory, it is named by the time if no name is given.
+func CreateSnapshotHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		HostIP        string `json:"host_ip" binding:"required,ip"`
+		DirectoryName string `json:"directory_name" binding:"required"`
+		Name          string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if request.Name != "" {
+		if err := common.ValidateSnapshotName(request.Name); err != nil {
+			ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+			return
+		}
+	}
+
+	snapshotModel := mgmtmodel.Snapshot{
+		HostIP:        request.HostIP,
+		DirectoryName: request.DirectoryName,
+		Name:          request.Name,
+	}
+
+	if err := snapshotModel.Create(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":   traceID,
+			"Directory": request.HostIP + ":" + request.DirectoryName,
+			"error":     err.Error(),
+		}).Error("Failed to create the snapshot.")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The directory is not found", err.Error())
+		} else if errors.Is(err, mgmtmodel.ErrSnapshotExists) {
+			ErrorResponse(c, http.StatusConflict, "Failed to create the snapshot", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to create the snapshot", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toSnapshotResponse(snapshotModel))
+}
+
+func DeleteSnapshotHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestSnapshot
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	snapshotModel := mgmtmodel.Snapshot{
+		HostIP:        request.HostIP,
+		DirectoryName: request.DirectoryName,
+		Name:          request.Name,
+	}
+
+	if err := snapshotModel.Delete(ctx); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The snapshot is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to delete the snapshot", err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// RestoreSnapshotHandler replaces the content of the directory by the snapshot, the changes since the snapshot are lost.
+func RestoreSnapshotHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestSnapshot
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	snapshotModel := mgmtmodel.Snapshot{
+		HostIP:        request.HostIP,
+		DirectoryName: request.DirectoryName,
+		Name:          request.Name,
+	}
+
+	if err := snapshotModel.Restore(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":  traceID,
+			"Snapshot": request.HostIP + ":" + request.DirectoryName + "@" + request.Name,
+			"error":    err.Error(),
+		}).Error("Failed to restore the snapshot.")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The snapshot is not found", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to restore the snapshot", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toSnapshotResponse(snapshotModel))
+}
+
+func GetSnapshotsHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	hostIP := c.Query("host_ip")
+	directoryName := c.Query("directory_name")
+	policyName := c.Query("policy_name")
+	fields := c.Query("fields")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	if hostIP != "" && validateIPAddress(hostIP) != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"URL":     c.Request.URL,
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "")
+		return
+	}
+
+	snapshotListModel := mgmtmodel.SnapshotList{}
+	filter := common.QueryFilter{
+		Fields: common.SplitToList(fields),
+		Conditions: struct {
+			HostIP        string
+			DirectoryName string
+			PolicyName    string
+		}{
+			HostIP:        hostIP,
+			DirectoryName: directoryName,
+			PolicyName:    policyName,
+		},
+	}
+
+	if page == 0 && limit == 0 {
+		// Query snapshots without pagination.
+		snapshots, err := snapshotListModel.Get(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the snapshots", err.Error())
+			return
+		}
+
+		snapshotList := make([]SnapshotResponse, 0, len(snapshots))
+		for _, snapshot := range snapshots {
+			snapshotList = append(snapshotList, toSnapshotResponse(snapshot))
+		}
+
+		c.JSON(http.StatusOK, snapshotList)
+	} else {
+		// Query snapshots with pagination.
+		filter.Pagination = &common.Pagination{
+			Page:     page,
+			PageSize: limit,
+		}
+
+		paginationSnapshots, err := snapshotListModel.Pagination(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the snapshots", err.Error())
+			return
+		}
+
+		paginationSnapshotList := PaginationSnapshotResponse{
+			Page:       page,
+			Limit:      limit,
+			TotalCount: paginationSnapshots.TotalCount,
+			Snapshots:  make([]SnapshotResponse, 0, len(paginationSnapshots.Snapshots)),
+		}
+
+		for _, snapshot := range paginationSnapshots.Snapshots {
+			paginationSnapshotList.Snapshots = append(paginationSnapshotList.Snapshots, toSnapshotResponse(snapshot))
+		}
+
+		c.JSON(http.StatusOK, paginationSnapshotList)
+	}
+}
+
+func CreateSnapshotOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string `json:"directory_name" binding:"required"`
+		Name          string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	detail, err := agent.CreateSnapshot(ctx, request.DirectoryName, request.Name)
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to create the snapshot", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+func DeleteSnapshotOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string `json:"directory_name" binding:"required"`
+		Name          string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.DeleteSnapshot(ctx, request.DirectoryName, request.Name); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the snapshot", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func RestoreSnapshotOnAgentHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		DirectoryName string `json:"directory_name" binding:"required"`
+		Name          string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	agent := agent.GetAgent()
+	if err := agent.RestoreSnapshot(ctx, request.DirectoryName, request.Name); err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to restore the snapshot", err.Error())
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetSnapshotsOnAgentHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	agent := agent.GetAgent()
+	snapshots, err := agent.ListSnapshots(ctx, c.Query("directory_name"))
+	if err != nil {
+		ErrorResponse(c, http.StatusInternalServerError, "Failed to get the snapshots", err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshots)
+}
@@ -0,0 +1,305 @@
+package webservice
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type SnapshotPolicyDirectoryResponse struct {
+	HostIP        string     `json:"host_ip"`
+	DirectoryName string     `json:"directory_name"`
+	LastRunTime   *time.Time `json:"last_run_time"`
+}
+
+type SnapshotPolicyResponse struct {
+	Name        string                            `json:"name"`
+	Frequency   string                            `json:"frequency"`
+	Keep        int                               `json:"keep"`
+	Directories []SnapshotPolicyDirectoryResponse `json:"directories"`
+}
+
+type PaginationSnapshotPolicyResponse struct {
+	SnapshotPolicies []SnapshotPolicyResponse `json:"policies"`
+	Page             int                      `json:"page"`
+	Limit            int                      `json:"limit"`
+	TotalCount       int64                    `json:"total_count"`
+}
+
+type requestSnapshotPolicyDirectory struct {
+	Name          string `json:"name" binding:"required"`
+	HostIP        string `json:"host_ip" binding:"required,ip"`
+	DirectoryName string `json:"directory_name" binding:"required"`
+}
+
+func toSnapshotPolicyResponse(policy mgmtmodel.SnapshotPolicy) SnapshotPolicyResponse {
+	response := SnapshotPolicyResponse{
+		Name:        policy.Name,
+		Frequency:   policy.Frequency,
+		Keep:        policy.Keep,
+		Directories: make([]SnapshotPolicyDirectoryResponse, 0, len(policy.Directories)),
+	}
+
+	for _, directory := range policy.Directories {
+		response.Directories = append(response.Directories, SnapshotPolicyDirectoryResponse{
+			HostIP:        directory.HostIP,
+			DirectoryName: directory.DirectoryName,
+			LastRunTime:   directory.LastRunTime,
+		})
+	}
+
+	return response
+}
+
+// CreateSnapshotPolicyHandler creates the policy which takes the snapshots at the frequency, e.g. hourly, and keeps
+// the latest ones.
+func CreateSnapshotPolicyHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name      string `json:"name" binding:"required"`
+		Frequency string `json:"frequency" binding:"required"`
+		Keep      int    `json:"keep" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if err := common.ValidateSnapshotPolicy(request.Name, request.Frequency, request.Keep); err != nil {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	policyModel := mgmtmodel.SnapshotPolicy{
+		Name:      request.Name,
+		Frequency: request.Frequency,
+		Keep:      request.Keep,
+	}
+
+	if err := policyModel.Create(ctx); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"Policy":  request.Name,
+			"error":   err.Error(),
+		}).Error("Failed to create the snapshot policy.")
+
+		if errors.Is(err, mgmtmodel.ErrSnapshotPolicyExists) {
+			ErrorResponse(c, http.StatusConflict, "Failed to create the snapshot policy", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to create the snapshot policy", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toSnapshotPolicyResponse(policyModel))
+}
+
+// DeleteSnapshotPolicyHandler deletes the policy, the snapshots taken by the policy are kept.
+func DeleteSnapshotPolicyHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	policyModel := mgmtmodel.SnapshotPolicy{Name: request.Name}
+	if err := policyModel.Delete(ctx); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The snapshot policy is not found", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to delete the snapshot policy", err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// UpdateSnapshotPolicyHandler changes the frequency or the number of the snapshots kept by the policy.
+func UpdateSnapshotPolicyHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request struct {
+		Name      string `json:"name" binding:"required"`
+		Frequency string `json:"frequency"`
+		Keep      int    `json:"keep"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	if request.Frequency == "" && request.Keep == 0 {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "nothing of the snapshot policy is changed")
+		return
+	}
+
+	if _, ok := common.SnapshotFrequencyInterval(request.Frequency); request.Frequency != "" && !ok {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", fmt.Sprintf("invalid frequency of the snapshot policy: %s", request.Frequency))
+		return
+	}
+
+	if request.Keep < 0 {
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", "the snapshot policy must keep at least 1 snapshot")
+		return
+	}
+
+	policyModel := mgmtmodel.SnapshotPolicy{Name: request.Name}
+	if err := policyModel.Update(ctx, request.Frequency, request.Keep); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The snapshot policy is not found", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to update the snapshot policy", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toSnapshotPolicyResponse(policyModel))
+}
+
+// AttachSnapshotPolicyHandler attaches the policy to the managed directory, the first snapshot is taken at the next
+// check of the policies.
+func AttachSnapshotPolicyHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestSnapshotPolicyDirectory
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	policyModel := mgmtmodel.SnapshotPolicy{Name: request.Name}
+	if err := policyModel.Attach(ctx, request.HostIP, request.DirectoryName); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID":   traceID,
+			"Policy":    request.Name,
+			"Directory": request.HostIP + ":" + request.DirectoryName,
+			"error":     err.Error(),
+		}).Error("Failed to attach the snapshot policy.")
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The snapshot policy or the directory is not found", err.Error())
+		} else if errors.Is(err, mgmtmodel.ErrSnapshotPolicyAttached) {
+			ErrorResponse(c, http.StatusConflict, "Failed to attach the snapshot policy", err.Error())
+		} else {
+			ErrorResponse(c, GetErrorStatusCode(err, http.StatusInternalServerError), "Failed to attach the snapshot policy", err.Error())
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, toSnapshotPolicyResponse(policyModel))
+}
+
+// DetachSnapshotPolicyHandler detaches the policy from the directory, the snapshots taken by the policy are kept.
+func DetachSnapshotPolicyHandler(c *gin.Context) {
+	ctx, traceID := SetTraceIDToContext(c)
+
+	var request requestSnapshotPolicyDirectory
+	if err := c.ShouldBindJSON(&request); err != nil {
+		common.Logger.WithFields(log.Fields{
+			"TraceID": traceID,
+			"error":   err.Error(),
+		}).Error("Invalid request.")
+		ErrorResponse(c, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	policyModel := mgmtmodel.SnapshotPolicy{Name: request.Name}
+	if err := policyModel.Detach(ctx, request.HostIP, request.DirectoryName); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorResponse(c, http.StatusNotFound, "The snapshot policy is not attached to the directory", err.Error())
+		} else {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to detach the snapshot policy", err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func GetSnapshotPoliciesHandler(c *gin.Context) {
+	ctx, _ := SetTraceIDToContext(c)
+
+	name := c.Query("name")
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	policyListModel := mgmtmodel.SnapshotPolicyList{}
+	filter := common.QueryFilter{
+		Conditions: struct {
+			Name string
+		}{
+			Name: name,
+		},
+	}
+
+	if page == 0 && limit == 0 {
+		// Query snapshot policies without pagination.
+		policies, err := policyListModel.Get(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the snapshot policies", err.Error())
+			return
+		}
+
+		policyList := make([]SnapshotPolicyResponse, 0, len(policies))
+		for _, policy := range policies {
+			policyList = append(policyList, toSnapshotPolicyResponse(policy))
+		}
+
+		c.JSON(http.StatusOK, policyList)
+	} else {
+		// Query snapshot policies with pagination.
+		filter.Pagination = &common.Pagination{
+			Page:     page,
+			PageSize: limit,
+		}
+
+		paginationPolicies, err := policyListModel.Pagination(ctx, &filter)
+		if err != nil {
+			ErrorResponse(c, http.StatusInternalServerError, "Failed to get the snapshot policies", err.Error())
+			return
+		}
+
+		paginationPolicyList := PaginationSnapshotPolicyResponse{
+			Page:             page,
+			Limit:            limit,
+			TotalCount:       paginationPolicies.TotalCount,
+			SnapshotPolicies: make([]SnapshotPolicyResponse, 0, len(paginationPolicies.SnapshotPolicies)),
+		}
+
+		for _, policy := range paginationPolicies.SnapshotPolicies {
+			paginationPolicyList.SnapshotPolicies = append(paginationPolicyList.SnapshotPolicies, toSnapshotPolicyResponse(policy))
+		}
+
+		c.JSON(http.StatusOK, paginationPolicyList)
+	}
+}
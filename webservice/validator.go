@@ -2,6 +2,8 @@ package webservice
 
 import (
 	"regexp"
+	"strings"
+	"unicode"
 
 	"github.com/cryingmouse/data_management_engine/common"
 	"github.com/go-playground/validator/v10"
@@ -10,6 +12,11 @@ import (
 func PasswordValidator(fl validator.FieldLevel) bool {
 	password := fl.Field().String()
 
+	// The agents write the password as a line to chpasswd and smbpasswd.
+	if strings.IndexFunc(password, unicode.IsControl) >= 0 {
+		return false
+	}
+
 	if len(password) >= 8 && regexp.MustCompile(`[A-Z]+`).MatchString(password) && regexp.MustCompile(`[a-z]+`).MatchString(password) && regexp.MustCompile(`[0-9]+`).MatchString(password) {
 		return true
 	}
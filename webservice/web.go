@@ -3,10 +3,15 @@ package webservice
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/cryingmouse/data_management_engine/common"
+	"github.com/cryingmouse/data_management_engine/driver"
+	"github.com/cryingmouse/data_management_engine/identity"
+	"github.com/cryingmouse/data_management_engine/mgmtmodel"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -28,7 +33,8 @@ var (
 	Validate        *validator.Validate
 )
 
-func Start() {
+// newRouter returns the router with the middlewares shared by the engine and the agent.
+func newRouter() *gin.Engine {
 	Validate = binding.Validator.Engine().(*validator.Validate)
 	Validate.RegisterValidation("validatePassword", PasswordValidator)
 
@@ -39,70 +45,202 @@ func Start() {
 	router.Use(cors.Default())
 	router.Use(TraceMiddleware(), LoggingMiddleware(), TimeoutMiddleware(100000*time.Second), I18nMiddleware())
 
+	return router
+}
+
+// StartEngine serves the portal API of the engine.
+func StartEngine() {
+	router := newRouter()
+
 	// Router 'portal' for Portal
 	portal := router.Group("/api")
 
-	// Router 'agent' for Agent
-	agent := router.Group("/agent")
-
 	// ====================================
 	// Portal related APIs
 	// ====================================
+	// The APIs registered before AuthMiddleware are called without token.
+	portal.POST("/auth/token", GetTokenHandler)
+	// The agents call home and send the heartbeats with the tokens in the request body.
+	portal.POST("/hosts/call-home", CallHomeHandler)
+	portal.POST("/hosts/heartbeat", HeartbeatHandler)
+	// Portal API about swagger-ui
+	portal.Static("/docs", "./docs/swagger-ui/dist")
+
+	// The role read-only is enough to call any GET API, the others require the role operator or admin.
+	portal.Use(AuthMiddleware())
+	admin := Authorize(mgmtmodel.RoleAdmin)
+	operator := Authorize(mgmtmodel.RoleOperator)
+
+	// Portal API about account
+	portal.POST("/accounts/create", admin, CreateAccountHandler)
+	portal.POST("/accounts/delete", admin, DeleteAccountHandler)
+	portal.GET("/accounts", admin, GetAccountsHandler)
 	// Portal API about host
-	portal.POST("/hosts/register", RegisterHostHandler)
-	portal.POST("/hosts/batch-register", RegisterHostsHandler)
-	portal.POST("/hosts/unregister", UnregisterHostHandler)
-	portal.POST("/hosts/batch-unregister", UnregisterHostsHandler)
+	portal.POST("/hosts/register", admin, RegisterHostHandler)
+	portal.POST("/hosts/batch-register", admin, RegisterHostsHandler)
+	portal.POST("/hosts/unregister", admin, UnregisterHostHandler)
+	portal.POST("/hosts/batch-unregister", admin, UnregisterHostsHandler)
+	portal.POST("/hosts/bootstrap-token", admin, CreateBootstrapTokenHandler)
+	portal.POST("/hosts/approve", admin, ApproveHostHandler)
 	portal.GET("/hosts", GetRegisteredHostsHandler)
+	portal.GET("/hosts/:ip/health", GetHostHealthHandler)
+	portal.GET("/hosts/:ip/capacity", GetHostCapacityHandler)
+	portal.POST("/hosts/:ip/reconcile", operator, ReconcileHostHandler)
 	// Portal API about directory
-	portal.POST("/directories/create", CreateDirectoryHandler)
-	portal.POST("/directories/batch-create", CreateDirectoriesHandler)
-	portal.POST("/directories/delete", DeleteDirectoryHandler)
-	portal.POST("/directories/batch-delete", DeleteDirectoriesHandler)
+	portal.POST("/directories/create", operator, CreateDirectoryHandler)
+	portal.POST("/directories/batch-create", operator, CreateDirectoriesHandler)
+	portal.POST("/directories/delete", operator, DeleteDirectoryHandler)
+	portal.POST("/directories/batch-delete", operator, DeleteDirectoriesHandler)
 	portal.GET("/directories", GetDirectoriesHandler)
+	portal.PATCH("/directories", operator, UpdateDirectoryHandler)
+	portal.POST("/directories/quota", operator, SetDirectoryQuotaHandler)
+	portal.GET("/directories/quota", GetDirectoryQuotaHandler)
+	portal.POST("/directories/acl", operator, SetDirectoryACLHandler)
+	portal.GET("/directories/acl", GetDirectoryACLHandler)
 	// Portal API about local user
-	portal.POST("/users/create", CreateLocalUserHandler)
-	portal.POST("/users/batch-create", CreateLocalUsersHandler)
-	portal.POST("/users/delete", DeleteLocalUserHandler)
-	portal.POST("/users/batch-delete", DeleteLocalUsersHandler)
-	portal.POST("/users/manage", ManageLocalUserHandler)
-	portal.POST("/users/batch-manage", ManageLocalUsersHandler)
-	portal.POST("/users/unmanage", UnmanageLocalUserHandler)
-	portal.POST("/users/batch-unmanage", UnmanageLocalUsersHandler)
+	portal.POST("/users/create", operator, CreateLocalUserHandler)
+	portal.POST("/users/batch-create", operator, CreateLocalUsersHandler)
+	portal.POST("/users/delete", operator, DeleteLocalUserHandler)
+	portal.POST("/users/batch-delete", operator, DeleteLocalUsersHandler)
+	portal.POST("/users/manage", operator, ManageLocalUserHandler)
+	portal.POST("/users/batch-manage", operator, ManageLocalUsersHandler)
+	portal.POST("/users/unmanage", operator, UnmanageLocalUserHandler)
+	portal.POST("/users/batch-unmanage", operator, UnmanageLocalUsersHandler)
 	portal.GET("/users", GetlocalUsersHandler)
+	portal.PATCH("/users", operator, UpdateLocalUserHandler)
+	// Portal API about local group
+	portal.POST("/groups/create", operator, CreateLocalGroupHandler)
+	portal.POST("/groups/delete", operator, DeleteLocalGroupHandler)
+	portal.POST("/groups/members/add", operator, AddLocalGroupMembersHandler)
+	portal.POST("/groups/members/remove", operator, RemoveLocalGroupMembersHandler)
+	portal.POST("/groups/manage", operator, ManageLocalGroupHandler)
+	portal.POST("/groups/unmanage", operator, UnmanageLocalGroupHandler)
+	portal.GET("/groups", GetLocalGroupsHandler)
+	// Portal API about domain identity
+	portal.GET("/identities", GetIdentitiesHandler)
 	// Portal API about share
-	portal.POST("/shares/create", CreateShareHandler)
-	portal.POST("/shares/delete", DeleteShareHandler)
-	portal.POST("/shares/mount", MountCIFSShareHandler)
-	portal.POST("/shares/unmount", UnmountShareHandler)
+	portal.POST("/shares/create", operator, CreateShareHandler)
+	portal.POST("/shares/delete", operator, DeleteShareHandler)
+	portal.POST("/shares/mount", operator, MountCIFSShareHandler)
+	portal.POST("/shares/unmount", operator, UnmountShareHandler)
+	portal.POST("/shares/access/grant", operator, GrantShareAccessHandler)
+	portal.POST("/shares/access/revoke", operator, RevokeShareAccessHandler)
 	portal.GET("/shares", GetSharesHandler)
+	portal.PATCH("/shares", operator, UpdateShareHandler)
+	// Portal API about snapshot
+	portal.POST("/snapshots/create", operator, CreateSnapshotHandler)
+	portal.POST("/snapshots/delete", operator, DeleteSnapshotHandler)
+	portal.POST("/snapshots/restore", operator, RestoreSnapshotHandler)
+	portal.GET("/snapshots", GetSnapshotsHandler)
+
+	portal.POST("/policies/create", operator, CreateSnapshotPolicyHandler)
+	portal.POST("/policies/delete", operator, DeleteSnapshotPolicyHandler)
+	portal.POST("/policies/attach", operator, AttachSnapshotPolicyHandler)
+	portal.POST("/policies/detach", operator, DetachSnapshotPolicyHandler)
+	portal.GET("/policies", GetSnapshotPoliciesHandler)
+	portal.PATCH("/policies", operator, UpdateSnapshotPolicyHandler)
+	// Portal API about replication
+	portal.POST("/replications/create", operator, CreateReplicationHandler)
+	portal.POST("/replications/delete", operator, DeleteReplicationHandler)
+	portal.POST("/replications/run", operator, RunReplicationHandler)
+	portal.GET("/replications", GetReplicationsHandler)
+	portal.PATCH("/replications", operator, UpdateReplicationHandler)
+	// Portal API about NFS export
+	portal.POST("/exports/create", operator, CreateExportHandler)
+	portal.POST("/exports/delete", operator, DeleteExportHandler)
+	portal.GET("/exports", GetExportsHandler)
+	// Portal API about job
+	portal.GET("/jobs", GetJobsHandler)
+	portal.GET("/jobs/:id", GetJobHandler)
+	portal.POST("/jobs/:id/cancel", operator, CancelJobHandler)
+	// Portal API about drift
+	portal.GET("/drift", GetDriftReportsHandler)
 
-	// Portal API about swagger-ui
-	portal.Static("/docs", "./docs/swagger-ui/dist")
+	router.Run(fmt.Sprintf(":%d", common.Config.WebService.Port))
+}
+
+// StartAgent serves the agent API over plain HTTP, and over mutual TLS as well once the agent has its certificate.
+func StartAgent() {
+	router := newRouter()
+
+	// Router 'agent' for Agent, every API of the agent requires the credentials or the session token of the agent.
+	agent := router.Group("/agent")
+	agent.Use(AgentAuthMiddleware())
 
 	// ====================================
 	// Agent related APIs
 	// ====================================
+	// The APIs registered before AgentTLSMiddleware are called over plain HTTP to enroll the agent.
+	agent.GET("/certificates/request", GetCertificateRequestOnAgentHandler)
+	agent.POST("/certificates/install", InstallCertificateOnAgentHandler)
+
+	agent.Use(AgentTLSMiddleware())
 	// Agent API about host
 	agent.GET("/system-info", GetSystemInfoOnAgentHandler)
+	agent.POST("/heartbeat/token", SetHeartbeatTokenOnAgentHandler)
 	// Agent API about directory
 	agent.GET("/directories/detail", GetDirectoryDetailOnAgentHandler)
 	agent.POST("/directories/create", CreateDirectoryOnAgentHandler)
 	agent.POST("/directories/batch-create", CreateDirectoriesOnAgentHandler)
 	agent.POST("/directories/delete", DeleteDirectoryOnAgentHandler)
 	agent.POST("/directories/batch-delete", DeleteDirectoriesOnAgentHandler)
+	agent.POST("/directories/update", UpdateDirectoryOnAgentHandler)
+	agent.POST("/directories/quota/set", SetDirectoryQuotaOnAgentHandler)
+	agent.POST("/directories/quota/clear", ClearDirectoryQuotaOnAgentHandler)
+	agent.GET("/directories/quota/detail", GetDirectoryQuotaOnAgentHandler)
+	agent.POST("/directories/acl/set", SetDirectoryACLOnAgentHandler)
+	agent.GET("/directories/acl", GetDirectoryACLOnAgentHandler)
+	agent.GET("/directories/usage", GetDirectoryUsageOnAgentHandler)
 	// Agent API about share
 	agent.POST("/shares/create", CreateShareOnAgentHandler)
 	agent.POST("/shares/delete", DeleteShareOnAgentHandler)
+	agent.POST("/shares/update", UpdateShareOnAgentHandler)
 	agent.POST("/shares/mount", MountShareOnAgentHandler)
 	agent.POST("/shares/unmount", UnmountShareOnAgentHandler)
+	agent.POST("/shares/access/grant", GrantShareAccessOnAgentHandler)
+	agent.POST("/shares/access/revoke", RevokeShareAccessOnAgentHandler)
 	agent.GET("/shares/detail", GetShareOnAgentHandler)
+	// Agent API about NFS export
+	agent.POST("/exports/create", CreateExportOnAgentHandler)
+	agent.POST("/exports/delete", DeleteExportOnAgentHandler)
+	agent.GET("/exports/detail", GetExportOnAgentHandler)
 	// Agent API about local user
 	agent.POST("/users/create", CreateLocalUserOnAgentHandler)
 	agent.POST("/users/delete", DeleteLocalUserOnAgentHandler)
+	agent.POST("/users/update", UpdateLocalUserOnAgentHandler)
 	agent.GET("/users/detail", GetLocalUserOnAgentHandler)
+	// Agent API about local group
+	agent.POST("/groups/create", CreateLocalGroupOnAgentHandler)
+	agent.POST("/groups/delete", DeleteLocalGroupOnAgentHandler)
+	agent.POST("/groups/members/add", AddLocalGroupMembersOnAgentHandler)
+	agent.POST("/groups/members/remove", RemoveLocalGroupMembersOnAgentHandler)
+	agent.GET("/groups/detail", GetLocalGroupOnAgentHandler)
+	// Agent API about snapshot
+	agent.POST("/snapshots/create", CreateSnapshotOnAgentHandler)
+	agent.POST("/snapshots/delete", DeleteSnapshotOnAgentHandler)
+	agent.POST("/snapshots/restore", RestoreSnapshotOnAgentHandler)
+	agent.GET("/snapshots", GetSnapshotsOnAgentHandler)
+	// Agent API about replication
+	agent.POST("/replication/token", CreateReplicationTokenOnAgentHandler)
+	agent.POST("/replication/pull", PullReplicationOnAgentHandler)
+
+	// Router 'replication' for the destination agents, which read the directory by the token issued by the agent
+	// instead of the credentials of the agent.
+	replication := router.Group("/replication")
+	replication.Use(ReplicationAuthMiddleware(), ReplicationTLSMiddleware())
+	replication.GET("/manifest", GetReplicationManifestHandler)
+	replication.GET("/chunk", GetReplicationChunkHandler)
+
+	agentTLSHandler = router
+	if isAgentEnrolled() {
+		if err := startAgentTLSServer(); err != nil {
+			common.Logger.WithFields(log.Fields{"error": err.Error()}).Error("Failed to start the agent web service over mutual TLS.")
+		}
+	}
 
-	router.Run(fmt.Sprintf(":%d", common.Config.WebService.Port))
+	startCallHome()
+
+	router.Run(getAgentAddress(getAgentPort()))
 }
 
 func SetTraceIDToContext(c *gin.Context) (context.Context, string) {
@@ -226,6 +364,15 @@ func ErrorResponse(c *gin.Context, statusCode int, message string, errMessage st
 	c.JSON(statusCode, response)
 }
 
+// GetErrorStatusCode returns 400 if the operation is not supported by the storage type of the host, or the given status code otherwise.
+func GetErrorStatusCode(err error, statusCode int) int {
+	if driver.IsUnsupportedOperation(err) || errors.Is(err, identity.ErrNotFound) {
+		return http.StatusBadRequest
+	}
+
+	return statusCode
+}
+
 func SetErrorToContext(c *gin.Context, errorCode string, err interface{}) {
 	if err != nil {
 		c.Set("Error", err)
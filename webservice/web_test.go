@@ -27,7 +27,7 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
-	common.InitializeConfig("config.ini")
+	common.InitializeConfig("agent.ini")
 
 	shareRouter = gin.Default()
 	shareAgnet = shareRouter.Group("/agent")